@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ============================================================================
+// AUDIT TRANSCRIPT (-audit WINDOW)
+// ============================================================================
+//
+// After the migration the regulator wants evidence of exactly what was sent
+// to the network and what it answered. With -audit CHG0012345 every command
+// of every ssh session (collections, runbook and rollback config pushes,
+// probes, watches), every NETCONF get and every SNMP poll is appended with
+// its response to one transcript per maintenance window:
+//
+//   <output>/audit/CHG0012345.jsonl
+//
+// one JSON record per line: n, time, seq and source (see sample_stamp.go),
+// kind (start, command, netconf, snmp), window, host, address, user, command,
+// response, error, prev and hash. hash is the SHA-256 of the record with an
+// empty hash, prev is the hash of the record before it (64 zeros for the
+// first), so removing, reordering or editing any record breaks the chain
+// from there on. Each process that joins the window first writes a start
+// record with the operator, the machine and the command line. The file is
+// only ever appended to; a transcript that does not verify is not extended.
+//
+// Credentials the tool knows (-p, the vault, the inventory, SNMP, the API,
+// store and NetBox tokens) are replaced with <redacted> wherever they
+// appear, and so are the values after password, secret, snmp-server
+// community, key-string and SNMPv3 auth/priv keywords in commands and
+// responses. Redaction happens
+// before hashing: the transcript never holds them.
+//
+//   -audit-verify FILE   checks the chain and prints its head hash
+//   -audit-export FILE   verifies it and writes <file>_evidence.tar.gz: the
+//                        transcript, a readable TRANSCRIPT.txt and the
+//                        verification, signed with -bundle-key like a run
+//                        bundle (check it with -verify-bundle)
+
+const (
+	auditDirName  = "audit"
+	auditGenesis  = "0000000000000000000000000000000000000000000000000000000000000000"
+	auditRedacted = "<redacted>"
+)
+
+// auditRedactions hide credentials in configuration commands and in the
+// running-config; group 1 is kept
+var auditRedactions = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(\b(?:password|secret)(?: encrypted| clear)?(?: \d{1,2})? )\S+`),
+	regexp.MustCompile(`(?i)(\bsnmp-server community )\S+`),
+	regexp.MustCompile(`(?i)(\bkey-string(?: \d)? )\S+`),
+	regexp.MustCompile(`(?i)(\b(?:auth (?:md5|sha)|priv (?:des|3des|aes(?: \d+)?))(?: encrypted| clear)? )\S+`),
+}
+
+// AuditRecord is one line of a transcript
+type AuditRecord struct {
+	N        int    `json:"n"`
+	Time     string `json:"time"`
+	Seq      uint64 `json:"seq"`
+	Source   string `json:"source"`
+	Kind     string `json:"kind"` // start, command, netconf, snmp
+	Window   string `json:"window"`
+	Host     string `json:"host,omitempty"`
+	Address  string `json:"address,omitempty"`
+	User     string `json:"user,omitempty"`
+	Command  string `json:"command"`
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Prev     string `json:"prev"`
+	Hash     string `json:"hash"`
+}
+
+// digest is the record's hash: SHA-256 of its JSON with an empty hash
+func (r AuditRecord) digest() string {
+	r.Hash = ""
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// auditLog appends to the transcript of one window; nil-safe
+type auditLog struct {
+	mu      sync.Mutex
+	path    string
+	window  string
+	file    *os.File
+	n       int
+	last    string
+	secrets []string
+}
+
+// auditSecrets are the credentials to redact: the run's, the vault's, the
+// inventory's and the bearer tokens
+func auditSecrets(config *Config, devices map[string]DeviceInfo) []string {
+	seen := make(map[string]bool)
+	var secrets []string
+	add := func(s string) {
+		// Very short values would redact ordinary words
+		if len(s) >= 4 && !strings.HasPrefix(s, "env:") && !seen[s] {
+			seen[s] = true
+			secrets = append(secrets, s)
+		}
+	}
+	add(config.Password)
+	add(config.KeyPass)
+	if secret := resolveSecret(config.EnableSecret); secret != enableLogin {
+		add(secret)
+	}
+	for _, c := range config.Vault {
+		add(c.Password)
+		add(c.Enable)
+	}
+	for _, token := range []string{config.APIToken, config.StoreToken, config.NetBoxToken} {
+		add(resolveSecret(token))
+	}
+	add(resolveSecret(config.SNMPCommunity))
+	for _, spec := range []string{config.SNMPAuth, config.SNMPPriv} {
+		if _, pass, ok := strings.Cut(spec, ":"); ok {
+			add(resolveSecret(pass))
+		}
+	}
+	for _, d := range devices {
+		add(d.KeyPass)
+	}
+	// Longest first, so a password containing another is replaced whole
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	return secrets
+}
+
+// openAuditLog verifies the window's transcript, if any, and appends a
+// start record to it
+func openAuditLog(outputDir, window string, secrets []string) (*auditLog, error) {
+	if window == "" || strings.ContainsAny(window, `/\`) || strings.HasPrefix(window, ".") {
+		return nil, fmt.Errorf("window name %q (letters, digits, - and _)", window)
+	}
+	dir := filepath.Join(outputDir, auditDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	a := &auditLog{path: filepath.Join(dir, window+".jsonl"), window: window, last: auditGenesis, secrets: secrets}
+	if _, err := os.Stat(a.path); err == nil {
+		records, err := readAuditTranscript(a.path)
+		if err != nil {
+			return nil, fmt.Errorf("%s does not verify, not extending it: %v", a.path, err)
+		}
+		if len(records) > 0 {
+			a.n, a.last = records[len(records)-1].N, records[len(records)-1].Hash
+		}
+	}
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	a.file = file
+
+	operator := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		operator = u.Username
+	}
+	if err := a.append(AuditRecord{Kind: "start", User: operator,
+		Command: strings.Join(append([]string{filepath.Base(os.Args[0])}, redactArgs(os.Args[1:])...), " ")}); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// redact removes the known secrets and credential values from text
+func (a *auditLog) redact(text string) string {
+	return redactCredentials(text, a.secrets)
+}
+
+// redactCredentials replaces secrets, then the values auditRedactions
+// match, with <redacted>
+func redactCredentials(text string, secrets []string) string {
+	for _, s := range secrets {
+		text = strings.ReplaceAll(text, s, auditRedacted)
+	}
+	for _, re := range auditRedactions {
+		text = re.ReplaceAllString(text, "${1}"+auditRedacted)
+	}
+	return text
+}
+
+// append chains and writes one record
+func (a *auditLog) append(r AuditRecord) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stamp := newSampleStamp()
+	a.n++
+	r.N, r.Time, r.Seq, r.Source, r.Window = a.n, stamp.UTC(), stamp.Seq, stamp.Source, a.window
+	r.Command, r.Response, r.Error = a.redact(r.Command), a.redact(r.Response), a.redact(r.Error)
+	r.Prev = a.last
+	r.Hash = r.digest()
+	line, err := json.Marshal(r)
+	if err != nil {
+		a.n--
+		return err
+	}
+	// One write per record: an interrupted run leaves whole lines
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		a.n--
+		return err
+	}
+	a.last = r.Hash
+	return nil
+}
+
+// commands records a batch of one ssh session; a session that failed
+// records its error against every command
+func (a *auditLog) commands(c *SSHClient, commands []string, outputs map[string]string, err error) {
+	if a == nil {
+		return
+	}
+	for _, cmd := range commands {
+		r := AuditRecord{Kind: "command", Host: c.name, Address: c.host, User: c.username, Command: cmd, Response: outputs[cmd]}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		if werr := a.append(r); werr != nil {
+			log.Printf("✗ Audit transcript %s: %v", a.path, werr)
+			return
+		}
+	}
+}
+
+// netconf records one NETCONF get
+func (a *auditLog) netconf(c *SSHClient, name, reply string, err error) {
+	if a == nil {
+		return
+	}
+	r := AuditRecord{Kind: "netconf", Host: c.name, Address: c.host, User: c.username, Command: name, Response: reply}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if werr := a.append(r); werr != nil {
+		log.Printf("✗ Audit transcript %s: %v", a.path, werr)
+	}
+}
+
+// snmp records one SNMP poll
+func (a *auditLog) snmp(c *SSHClient, conf *snmpConfig, name, reply string, err error) {
+	if a == nil {
+		return
+	}
+	r := AuditRecord{Kind: "snmp", Host: c.name, Address: c.host, User: conf.user, Command: name, Response: reply}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if werr := a.append(r); werr != nil {
+		log.Printf("✗ Audit transcript %s: %v", a.path, werr)
+	}
+}
+
+// readAuditTranscript reads a transcript and checks its chain
+func readAuditTranscript(path string) ([]AuditRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []AuditRecord
+	prev := auditGenesis
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var r AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return records, fmt.Errorf("line %d: %v", line, err)
+		}
+		switch {
+		case r.N != len(records)+1:
+			return records, fmt.Errorf("line %d: record %d where %d was expected (records removed or reordered)", line, r.N, len(records)+1)
+		case r.Prev != prev:
+			return records, fmt.Errorf("line %d: record %d does not chain to the record before it", line, r.N)
+		case r.digest() != r.Hash:
+			return records, fmt.Errorf("line %d: record %d was altered (hash mismatch)", line, r.N)
+		}
+		prev = r.Hash
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// auditSummary describes a verified transcript
+func auditSummary(path string, records []AuditRecord) string {
+	var b strings.Builder
+	hosts := make(map[string]bool)
+	starts, commands, failed := 0, 0, 0
+	windows := make(map[string]bool)
+	for _, r := range records {
+		windows[r.Window] = true
+		switch r.Kind {
+		case "start":
+			starts++
+		default:
+			commands++
+			hosts[r.Host] = true
+			if r.Error != "" {
+				failed++
+			}
+		}
+	}
+	var names []string
+	for w := range windows {
+		names = append(names, w)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(&b, "Transcript: %s\n", path)
+	fmt.Fprintf(&b, "Window:     %s\n", strings.Join(names, ", "))
+	fmt.Fprintf(&b, "Records:    %d (%d sessions started, %d commands on %d devices, %d with errors)\n",
+		len(records), starts, commands, len(hosts), failed)
+	if len(records) > 0 {
+		fmt.Fprintf(&b, "From:       %s\n", records[0].Time)
+		fmt.Fprintf(&b, "To:         %s\n", records[len(records)-1].Time)
+		fmt.Fprintf(&b, "Head hash:  %s\n", records[len(records)-1].Hash)
+	}
+	fmt.Fprintf(&b, "Chain:      verified, every record chains to the one before it\n")
+	return b.String()
+}
+
+// verifyAuditTranscript checks a transcript for -audit-verify
+func verifyAuditTranscript(path string) error {
+	records, err := readAuditTranscript(path)
+	if err != nil {
+		return err
+	}
+	fmt.Print(auditSummary(path, records))
+	return nil
+}
+
+// exportAuditTranscript writes the signed evidence bundle of a transcript
+func exportAuditTranscript(path, keyPath string) (string, error) {
+	records, err := readAuditTranscript(path)
+	if err != nil {
+		return "", fmt.Errorf("%s does not verify: %v", path, err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	priv, err := loadOrCreateBundleKey(keyPath)
+	if err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	for _, r := range records {
+		fmt.Fprintf(&text, "================================================================================\n")
+		switch r.Kind {
+		case "start":
+			fmt.Fprintf(&text, " #%d %s  START by %s on %s\n", r.N, r.Time, orDash(r.User), r.Source)
+			fmt.Fprintf(&text, " %s\n", r.Command)
+			continue
+		default:
+			fmt.Fprintf(&text, " #%d %s  %s (%s) as %s\n", r.N, r.Time, r.Host, r.Address, orDash(r.User))
+			fmt.Fprintf(&text, " %s> %s\n", strings.ToUpper(r.Kind), r.Command)
+		}
+		fmt.Fprintf(&text, "--------------------------------------------------------------------------------\n")
+		if r.Error != "" {
+			fmt.Fprintf(&text, "ERROR: %s\n", r.Error)
+		}
+		if r.Response != "" {
+			fmt.Fprintf(&text, "%s\n", r.Response)
+		}
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	files := map[string][]byte{
+		filepath.Base(path): raw,
+		"TRANSCRIPT.txt":    []byte(text.String()),
+		"VERIFY.txt":        []byte(auditSummary(filepath.Base(path), records)),
+	}
+	out := strings.TrimSuffix(path, filepath.Ext(path)) + "_evidence.tar.gz"
+	if err := writeSignedBundle(out, "audit_"+name+"/", files, priv); err != nil {
+		return "", err
+	}
+	return out, nil
+}
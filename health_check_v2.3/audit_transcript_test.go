@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeAuditFixture writes a start record and three commands to a fresh
+// transcript and returns its path
+func writeAuditFixture(t *testing.T) string {
+	t.Helper()
+	args := os.Args
+	os.Args = []string{"ssh_health_check", "-u", "hc", "-p", "hunter22", "-api-token", "tok-inline-9f", "-audit", "CHG1"}
+	defer func() { os.Args = args }()
+
+	config := &Config{Password: "hunter22", APIToken: "tok-inline-9f", StoreToken: "env:AUDIT_TEST_UNSET"}
+	a, err := openAuditLog(t.TempDir(), "CHG1", auditSecrets(config, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.file.Close()
+
+	c := &SSHClient{name: "PE1", host: "192.0.2.1", username: "hc"}
+	commands := []string{"show version", "show running-config", "show clock"}
+	a.commands(c, commands, map[string]string{
+		"show version": "Cisco IOS XR Software, Version 7.5.2",
+		"show running-config": "snmp-server community s3cr3tComm RO\n" +
+			"key chain OSPF\n key 1\n  key-string 7 0822455D0A16\n" +
+			"username admin secret 5 $1$abcd$efgh\n",
+		"show clock": "12:00:00.000 UTC Sat Oct 17 2026",
+	}, nil)
+	return a.path
+}
+
+func TestAuditRedaction(t *testing.T) {
+	path := writeAuditFixture(t)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter22", "tok-inline-9f", "s3cr3tComm", "0822455D0A16", "$1$abcd$efgh"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("transcript holds %q", secret)
+		}
+	}
+	records, err := readAuditTranscript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[0].Kind != "start" {
+		t.Fatalf("%d records, want a start record and 3 commands", len(records))
+	}
+	if want := "-p REDACTED -api-token REDACTED"; !strings.Contains(records[0].Command, want) {
+		t.Errorf("start record %q, want %q", records[0].Command, want)
+	}
+	if want := "snmp-server community <redacted> RO"; !strings.Contains(records[2].Response, want) {
+		t.Errorf("running-config %q, want %q", records[2].Response, want)
+	}
+}
+
+// Editing, reordering or removing a record breaks the chain
+func TestAuditChain(t *testing.T) {
+	path := writeAuditFixture(t)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	tests := []struct {
+		name   string
+		tamper func([]string) []string
+		want   string
+	}{
+		{"edited", func(l []string) []string {
+			l[1] = strings.Replace(l[1], "7.5.2", "7.9.9", 1)
+			return l
+		}, "altered"},
+		{"reordered", func(l []string) []string {
+			l[2], l[3] = l[3], l[2]
+			return l
+		}, "removed or reordered"},
+		{"removed", func(l []string) []string {
+			return append(l[:2], l[3:]...)
+		}, "removed or reordered"},
+		{"renumbered", func(l []string) []string {
+			// Dropping record 2 and renumbering the rest still breaks prev
+			l = append(l[:1], l[2:]...)
+			l[1] = strings.Replace(l[1], `"n":3`, `"n":2`, 1)
+			return l
+		}, "does not chain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := tt.tamper(append([]string(nil), lines...))
+			file := filepath.Join(t.TempDir(), "CHG1.jsonl")
+			if err := os.WriteFile(file, []byte(strings.Join(tampered, "\n")+"\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readAuditTranscript(file); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// WORKER AUTOSCALING (-autoscale MIN-MAX)
+// ============================================================================
+//
+// A fixed -w is either too low for a 600-device access sweep or high enough
+// to trip the AAA servers. With -autoscale 4-32 the collection starts at -w
+// (clamped to the bounds) and adjusts after every window of completed
+// devices (one per active worker):
+//
+//   - more than 10% of the window failed with a timeout, refused or reset
+//     connection or an authentication error: halve the workers
+//   - otherwise, no such failures, devices still queued and the average
+//     session no more than 1.5x the fastest window seen: grow by half
+//
+// Devices that are simply unreachable do not count as pressure. MAX workers
+// are started; the rest wait for a slot.
+
+// autoscalePressure marks errors that suggest the devices or AAA are overloaded
+var autoscalePressure = []string{"timeout", "timed out", "refused", "reset by peer", "denied", "authentication"}
+
+type workerScaler struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	min    int
+	max    int
+	limit  int
+	active int
+	peak   int
+	queued func() int
+
+	done     int           // completions in the current window
+	pressure int           // of which overload failures
+	total    time.Duration // session time of the window
+	best     time.Duration // fastest window average so far
+}
+
+// parseAutoscale reads MIN-MAX; an empty spec disables autoscaling
+func parseAutoscale(spec string, start int, queued func() int) (*workerScaler, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	lo, hi, ok := strings.Cut(spec, "-")
+	floor, err1 := strconv.Atoi(strings.TrimSpace(lo))
+	ceiling, err2 := strconv.Atoi(strings.TrimSpace(hi))
+	if !ok || err1 != nil || err2 != nil || floor < 1 || ceiling < floor {
+		return nil, fmt.Errorf("invalid bounds %q (expected MIN-MAX, e.g. 4-32)", spec)
+	}
+	if start < floor {
+		start = floor
+	}
+	if start > ceiling {
+		start = ceiling
+	}
+	s := &workerScaler{min: floor, max: ceiling, limit: start, peak: start, queued: queued}
+	s.cond = sync.NewCond(&s.mu)
+	return s, nil
+}
+
+// workers is the number of goroutines to start
+func (s *workerScaler) workers(fixed int) int {
+	if s == nil {
+		return fixed
+	}
+	return s.max
+}
+
+// acquire blocks until the worker may take a device
+func (s *workerScaler) acquire() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	for s.active >= s.limit {
+		s.cond.Wait()
+	}
+	s.active++
+	s.mu.Unlock()
+}
+
+// cancel returns a slot that was not used
+func (s *workerScaler) cancel() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.active--
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+// release returns the slot and feeds the device outcome into the window
+func (s *workerScaler) release(r *DeviceResult, took time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	defer s.cond.Broadcast()
+
+	s.done++
+	s.total += took
+	if !r.Success {
+		msg := strings.ToLower(r.ErrorMessage)
+		for _, p := range autoscalePressure {
+			if strings.Contains(msg, p) {
+				s.pressure++
+				break
+			}
+		}
+	}
+	if s.done < s.limit || s.done < 2 {
+		return
+	}
+
+	avg := s.total / time.Duration(s.done)
+	old := s.limit
+	switch {
+	case s.pressure*10 > s.done:
+		s.limit = old / 2
+	case s.pressure == 0 && s.queued() > 0 && (s.best == 0 || avg <= s.best*3/2):
+		s.limit = old + (old+1)/2
+	}
+	if s.limit < s.min {
+		s.limit = s.min
+	}
+	if s.limit > s.max {
+		s.limit = s.max
+	}
+	if s.limit > s.peak {
+		s.peak = s.limit
+	}
+	if s.best == 0 || avg < s.best {
+		s.best = avg
+	}
+	if s.limit != old {
+		log.Printf("AUTOSCALE: %d -> %d workers (avg %s per device, %d/%d overload errors, %d queued)",
+			old, s.limit, avg.Round(100*time.Millisecond), s.pressure, s.done, s.queued())
+	}
+	s.done, s.pressure, s.total = 0, 0, 0
+}
+
+// String describes the bounds for the start-of-run log line
+func (s *workerScaler) String() string {
+	return fmt.Sprintf("%d-%d workers (autoscale, starting at %d)", s.min, s.max, s.limit)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// SCHEDULED BASELINES AND RETENTION
+// ============================================================================
+//
+//   -schedule 1h [-schedule-for 48h]   collect -phase every hour (for 48h, or
+//                                      until interrupted)
+//   -retain 48 | 72h | 48,72h          after each collection keep only the
+//                                      newest 48 runs of the phase and/or the
+//                                      runs younger than 72h
+//   -baselines                         list the runs of -phase and exit
+//
+// Runs are the <output>/<phase>/<timestamp> directories of NewOutputWriter.
+// Instead of typing their paths, -compare, -golden-mark and -golden-compare
+// accept a selector:
+//
+//   PHASE@latest     the newest run of the phase
+//   PHASE@3          the third newest (as numbered by -baselines)
+//   PHASE@20261017_09  the newest run whose timestamp starts with this
+//
+// The newest run of a phase is never removed by -retain.
+
+// runEntry is one collection directory of a phase
+type runEntry struct {
+	Dir  string
+	Time time.Time
+}
+
+// listRuns returns the runs of a phase, newest first
+func listRuns(outputDir, phase string) ([]runEntry, error) {
+	base := filepath.Join(outputDir, phase)
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return nil, err
+	}
+	var runs []runEntry
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		t, err := time.ParseInLocation("20060102_150405", e.Name(), time.Local)
+		if err != nil {
+			continue
+		}
+		runs = append(runs, runEntry{filepath.Join(base, e.Name()), t})
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Time.After(runs[j].Time) })
+	return runs, nil
+}
+
+// resolveRunSelector turns PHASE@latest|N|TIMESTAMP into a run directory;
+// anything without "@" is returned unchanged as a path
+func resolveRunSelector(outputDir, sel string) (string, error) {
+	phase, which, ok := strings.Cut(sel, "@")
+	if !ok {
+		return sel, nil
+	}
+	runs, err := listRuns(outputDir, phase)
+	if err != nil || len(runs) == 0 {
+		return "", fmt.Errorf("%s: no runs of phase %q under %s", sel, phase, outputDir)
+	}
+	if which == "" || which == "latest" {
+		return runs[0].Dir, nil
+	}
+	if n, err := strconv.Atoi(which); err == nil && len(which) < 8 {
+		if n < 1 || n > len(runs) {
+			return "", fmt.Errorf("%s: phase %q has %d runs", sel, phase, len(runs))
+		}
+		return runs[n-1].Dir, nil
+	}
+	for _, r := range runs {
+		if strings.HasPrefix(filepath.Base(r.Dir), which) {
+			return r.Dir, nil
+		}
+	}
+	return "", fmt.Errorf("%s: no run of phase %q starts with %q", sel, phase, which)
+}
+
+// parseRetention reads "N", "DURATION" or "N,DURATION"; zero values keep all
+func parseRetention(spec string) (keep int, maxAge time.Duration, err error) {
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if n, convErr := strconv.Atoi(part); convErr == nil && n > 0 {
+			keep = n
+			continue
+		}
+		d, durErr := time.ParseDuration(part)
+		if durErr != nil || d <= 0 {
+			return 0, 0, fmt.Errorf("invalid retention %q (expected a run count and/or a duration, e.g. 48,72h)", part)
+		}
+		maxAge = d
+	}
+	return keep, maxAge, nil
+}
+
+// pruneRuns removes the runs of a phase beyond the retention policy
+func pruneRuns(outputDir, phase, spec string) (int, error) {
+	keep, maxAge, err := parseRetention(spec)
+	if err != nil || (keep == 0 && maxAge == 0) {
+		return 0, err
+	}
+	runs, err := listRuns(outputDir, phase)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for i, r := range runs {
+		if i == 0 {
+			continue
+		}
+		if (keep > 0 && i >= keep) || (maxAge > 0 && time.Since(r.Time) > maxAge) {
+			if err := os.RemoveAll(r.Dir); err != nil {
+				log.Printf("✗ Retention: cannot remove %s: %v", r.Dir, err)
+				continue
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// listBaselines prints the runs of a phase with their device counts
+func listBaselines(outputDir, phase string) error {
+	runs, err := listRuns(outputDir, phase)
+	if err != nil || len(runs) == 0 {
+		return fmt.Errorf("no runs of phase %q under %s", phase, outputDir)
+	}
+	fmt.Printf("Runs of phase %s (select with %s@N, %s@latest or %s@TIMESTAMP):\n\n", phase, phase, phase, phase)
+	table := newTextTable("#", "TIMESTAMP", "DEVICES", "FAILED", "DIRECTORY").alignRight(0, 2, 3)
+	for i, r := range runs {
+		devices, failed := "-", "-"
+		if csvFile := findCSVFile(r.Dir); csvFile != "" {
+			if data, err := loadGoldenCSV(csvFile); err == nil {
+				hosts := make(map[string]bool)
+				down := 0
+				for k := range data {
+					hosts[k.Host] = true
+					if k.Command == "CONNECTION" {
+						down++
+					}
+				}
+				devices, failed = strconv.Itoa(len(hosts)), strconv.Itoa(down)
+			}
+		}
+		table.add("", i+1, r.Time.Format("2006-01-02 15:04:05"), devices, failed, r.Dir)
+	}
+	table.write(os.Stdout)
+	return nil
+}
+
+// runSchedule collects every config.Schedule until config.ScheduleFor has
+// passed (0 = until interrupted), applying -retain after each collection
+func runSchedule(config *Config, targetDevices []DeviceInfo, commands *CommandSet) {
+	start := time.Now()
+	log.Printf("SCHEDULE: collecting %s every %s", config.Phase, config.Schedule)
+	if config.ScheduleFor > 0 {
+		log.Printf("SCHEDULE: until %s", start.Add(config.ScheduleFor).Format("2006-01-02 15:04"))
+	}
+	for n := 1; ; n++ {
+		next := time.Now().Add(config.Schedule)
+		writer, results := runCollection(config, targetDevices, commands, config.Phase)
+		printRunFooter(writer, results)
+		if removed, err := pruneRuns(config.OutputDir, config.Phase, config.Retain); err != nil {
+			log.Printf("✗ Retention: %v", err)
+		} else if removed > 0 {
+			log.Printf("Retention: removed %d old %s runs", removed, config.Phase)
+		}
+
+		if config.ScheduleFor > 0 && next.Sub(start) > config.ScheduleFor {
+			log.Printf("SCHEDULE: done after %d collections", n)
+			return
+		}
+		if config.Stop.stopping() {
+			log.Printf("SCHEDULE: stopped after %d collections", n)
+			return
+		}
+		log.Printf("SCHEDULE: collection %d done, next at %s", n, next.Format("15:04:05"))
+		if !config.Stop.sleep(time.Until(next)) {
+			log.Printf("SCHEDULE: stopped after %d collections", n)
+			return
+		}
+	}
+}
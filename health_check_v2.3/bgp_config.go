@@ -0,0 +1,242 @@
+package main
+
+import (
+	"strings"
+)
+
+// ============================================================================
+// RUNNING-CONFIG PARSER - BGP neighbors, VRF policies, route-policies
+// ============================================================================
+
+// BGPNeighborConfig is one configured BGP neighbor (global or per VRF)
+type BGPNeighborConfig struct {
+	VRF         string // "default" for the global table
+	Address     string
+	RemoteAS    string
+	Description string
+	PolicyIn    string
+	PolicyOut   string
+	UseGroup    string // XR "use neighbor-group"
+}
+
+const neighborGroupVRF = "__neighbor-group__"
+
+// VRFPolicyConfig is the import/export policy attached to a VRF
+type VRFPolicyConfig struct {
+	VRF    string
+	Import string
+	Export string
+}
+
+// RunningConfig holds the parts of a running-config the audits need
+type RunningConfig struct {
+	LocalAS       string
+	Neighbors     []*BGPNeighborConfig
+	VRFPolicies   map[string]*VRFPolicyConfig
+	RoutePolicies map[string][]string // XR route-policy name -> body lines
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// isRunningConfig matches "show running-config" / "show run" and section variants
+func isRunningConfig(command string) bool {
+	c := strings.ToLower(strings.TrimSpace(command))
+	return strings.HasPrefix(c, "show running-config") || strings.HasPrefix(c, "show run")
+}
+
+// parseRunningConfig understands both IOS-XR (hierarchical neighbor blocks,
+// route-policy) and IOS-XE (flat "neighbor X ..." lines, route-map) layouts.
+func parseRunningConfig(output string) *RunningConfig {
+	rc := &RunningConfig{
+		VRFPolicies:   make(map[string]*VRFPolicyConfig),
+		RoutePolicies: make(map[string][]string),
+	}
+
+	neighbor := func(vrf, addr string) *BGPNeighborConfig {
+		for _, n := range rc.Neighbors {
+			if n.VRF == vrf && n.Address == addr {
+				return n
+			}
+		}
+		n := &BGPNeighborConfig{VRF: vrf, Address: addr}
+		rc.Neighbors = append(rc.Neighbors, n)
+		return n
+	}
+	vrfPolicy := func(vrf string) *VRFPolicyConfig {
+		if p, ok := rc.VRFPolicies[vrf]; ok {
+			return p
+		}
+		p := &VRFPolicyConfig{VRF: vrf}
+		rc.VRFPolicies[vrf] = p
+		return p
+	}
+
+	section := ""     // bgp, vrf, rpl
+	sectionName := "" // VRF or route-policy name
+	bgpVRF := "default"
+	bgpVRFIndent := -1
+	var xrNeighbor *BGPNeighborConfig
+	xrNeighborIndent := -1
+
+	for _, raw := range strings.Split(output, "\n") {
+		line := strings.TrimRight(raw, "\r ")
+		t := strings.TrimSpace(line)
+		if t == "" || t == "!" {
+			continue
+		}
+		ind := indentOf(line)
+		f := strings.Fields(t)
+
+		if ind == 0 {
+			xrNeighbor, xrNeighborIndent = nil, -1
+			bgpVRF, bgpVRFIndent = "default", -1
+			switch {
+			case len(f) >= 3 && f[0] == "router" && f[1] == "bgp":
+				section, rc.LocalAS = "bgp", f[2]
+			case len(f) == 2 && f[0] == "vrf":
+				section, sectionName = "vrf", f[1]
+			case len(f) == 3 && f[0] == "vrf" && f[1] == "definition":
+				section, sectionName = "vrf", f[2]
+			case len(f) == 3 && f[0] == "ip" && f[1] == "vrf":
+				section, sectionName = "vrf", f[2]
+			case len(f) >= 2 && f[0] == "route-policy":
+				section, sectionName = "rpl", f[1]
+				rc.RoutePolicies[sectionName] = []string{}
+			case t == "end-policy":
+				section = ""
+			default:
+				section = ""
+			}
+			continue
+		}
+
+		switch section {
+		case "rpl":
+			rc.RoutePolicies[sectionName] = append(rc.RoutePolicies[sectionName], t)
+
+		case "vrf":
+			switch {
+			case len(f) == 3 && f[0] == "import" && f[1] == "route-policy":
+				vrfPolicy(sectionName).Import = f[2]
+			case len(f) == 3 && f[0] == "export" && f[1] == "route-policy":
+				vrfPolicy(sectionName).Export = f[2]
+			case len(f) == 3 && f[0] == "import" && f[1] == "map":
+				vrfPolicy(sectionName).Import = f[2]
+			case len(f) == 3 && f[0] == "export" && f[1] == "map":
+				vrfPolicy(sectionName).Export = f[2]
+			}
+
+		case "bgp":
+			if xrNeighbor != nil && ind <= xrNeighborIndent {
+				xrNeighbor, xrNeighborIndent = nil, -1
+			}
+			if bgpVRFIndent >= 0 && ind <= bgpVRFIndent && !(len(f) == 2 && f[0] == "vrf") {
+				bgpVRF, bgpVRFIndent = "default", -1
+			}
+
+			switch {
+			// XR: " vrf NAME" block inside router bgp
+			case len(f) == 2 && f[0] == "vrf":
+				bgpVRF, bgpVRFIndent = f[1], ind
+			// XE: " address-family ipv4 vrf NAME"
+			case len(f) >= 4 && f[0] == "address-family" && f[2] == "vrf":
+				bgpVRF, bgpVRFIndent = f[3], ind
+			// XR: "  neighbor 10.0.0.1" opens a neighbor block
+			case len(f) == 2 && f[0] == "neighbor":
+				xrNeighbor, xrNeighborIndent = neighbor(bgpVRF, f[1]), ind
+			// XR: " neighbor-group NAME" is tracked like a neighbor for inheritance
+			case len(f) == 2 && f[0] == "neighbor-group":
+				xrNeighbor, xrNeighborIndent = neighbor(neighborGroupVRF, f[1]), ind
+			// XE: "neighbor A <attr> ..."
+			case len(f) >= 3 && f[0] == "neighbor":
+				n := neighbor(bgpVRF, f[1])
+				switch f[2] {
+				case "remote-as":
+					if len(f) >= 4 {
+						n.RemoteAS = f[3]
+					}
+				case "description":
+					n.Description = strings.Join(f[3:], " ")
+				case "route-map":
+					if len(f) >= 5 {
+						setPolicy(n, f[3], f[4])
+					}
+				}
+			case xrNeighbor != nil:
+				switch {
+				case f[0] == "remote-as" && len(f) >= 2:
+					xrNeighbor.RemoteAS = f[1]
+				case f[0] == "description":
+					xrNeighbor.Description = strings.Join(f[1:], " ")
+				case f[0] == "route-policy" && len(f) >= 3:
+					setPolicy(xrNeighbor, f[1], f[2])
+				case f[0] == "use" && len(f) >= 3 && f[1] == "neighbor-group":
+					xrNeighbor.UseGroup = f[2]
+				}
+			}
+		}
+	}
+
+	// Resolve neighbor-group inheritance, then drop the group pseudo-entries
+	groups := make(map[string]*BGPNeighborConfig)
+	var neighbors []*BGPNeighborConfig
+	for _, n := range rc.Neighbors {
+		if n.VRF == neighborGroupVRF {
+			groups[n.Address] = n
+		} else {
+			neighbors = append(neighbors, n)
+		}
+	}
+	for _, n := range neighbors {
+		if g, ok := groups[n.UseGroup]; ok {
+			if n.RemoteAS == "" {
+				n.RemoteAS = g.RemoteAS
+			}
+			if n.Description == "" {
+				n.Description = g.Description
+			}
+			if n.PolicyIn == "" {
+				n.PolicyIn = g.PolicyIn
+			}
+			if n.PolicyOut == "" {
+				n.PolicyOut = g.PolicyOut
+			}
+		}
+	}
+	rc.Neighbors = neighbors
+	return rc
+}
+
+func setPolicy(n *BGPNeighborConfig, name, direction string) {
+	switch direction {
+	case "in":
+		if n.PolicyIn == "" {
+			n.PolicyIn = name
+		}
+	case "out":
+		if n.PolicyOut == "" {
+			n.PolicyOut = name
+		}
+	}
+}
+
+// isPermissivePolicy reports whether a route-policy accepts everything
+// unconditionally (body is only "pass"/"done"), or is named like a pass-all.
+func (rc *RunningConfig) isPermissivePolicy(name string) bool {
+	upper := strings.ToUpper(name)
+	if upper == "PASS" || upper == "PASS-ALL" || upper == "PASS_ALL" || upper == "PERMIT-ALL" || upper == "ALLOW-ALL" {
+		return true
+	}
+	body, ok := rc.RoutePolicies[name]
+	if !ok || len(body) == 0 {
+		return false
+	}
+	for _, l := range body {
+		if l != "pass" && l != "done" {
+			return false
+		}
+	}
+	return true
+}
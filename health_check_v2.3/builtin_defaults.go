@@ -0,0 +1,96 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// BUILT-IN DEFAULTS (single-binary release)
+// ============================================================================
+//
+// The binary carries its own copy of the shipped command files, next to the
+// noise patterns (noise_patterns.go) and window monitors (sampling.go), so
+// it runs from a USB stick with only a target list and inventory beside it.
+// Reports, OS detection and the check policies are code and need no files.
+//
+// A file on disk always wins: a command file named on the command line (or
+// the default command.txt, command_iosxr.txt, ...) is read from disk when it
+// exists, with its includes, and only a missing file with a shipped name
+// falls back to the built-in copy. The run log says which one was used.
+//
+//   -write-defaults DIR   writes the built-in files to DIR for editing; files
+//                         already there are left alone
+
+//go:embed command.txt command_iosxr.txt command_iosxe.txt command_l2switch.txt
+var builtinCommandFiles embed.FS
+
+// loadCommandFile reads a command file from disk, else the built-in copy of
+// the same name; source says where the commands came from
+func loadCommandFile(path string) ([]string, string, error) {
+	if _, err := os.Stat(path); err == nil || !os.IsNotExist(err) {
+		cmds, err := readCommandFile(path)
+		return cmds, path, err
+	}
+	name := filepath.Base(path)
+	data, err := builtinCommandFiles.ReadFile(name)
+	if err != nil {
+		return nil, path, fmt.Errorf("%s: no such file and no built-in copy", path)
+	}
+	var cmds []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || seen[line] {
+			continue
+		}
+		seen[line] = true
+		cmds = append(cmds, line)
+	}
+	return cmds, "built-in " + name, nil
+}
+
+// writeDefaults writes the built-in files to dir without overwriting any
+func writeDefaults(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	files := map[string]string{
+		"noise_patterns.txt": defaultNoisePatterns,
+		"monitors.txt":       strings.Join(defaultMonitors, "\n") + "\n",
+	}
+	entries, err := builtinCommandFiles.ReadDir(".")
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		data, err := builtinCommandFiles.ReadFile(e.Name())
+		if err != nil {
+			return err
+		}
+		files[e.Name()] = string(data)
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			log.Printf("  %s exists, left as is", path)
+			continue
+		}
+		if err := os.WriteFile(path, []byte(files[name]), 0644); err != nil {
+			return err
+		}
+		log.Printf("✓ %s", path)
+	}
+	return nil
+}
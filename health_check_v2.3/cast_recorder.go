@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ============================================================================
+// SESSION RECORDING (-record)
+// ============================================================================
+//
+// Prompt-driven sessions (see expect_session.go) can be recorded as
+// asciinema v2 casts, one <host>_<ts>.cast per ssh session, so cutover
+// evidence can be replayed in asciinema-player during the post-implementation
+// review. The cast holds what the device printed ("o" events) and what the
+// tool typed ("i" events), timed from session start. Events are appended as
+// they happen, so an interrupted session still replays up to the break.
+// Passwords never pass through the session's stdin and are not recorded.
+
+const (
+	castWidth  = 200
+	castHeight = 50
+)
+
+// castRecorder writes one asciinema v2 cast
+type castRecorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	start   time.Time
+	pending []byte // incomplete UTF-8 sequence held back from the last output
+}
+
+// newCastRecorder creates <dir>/<name>_<ts>.cast and writes its header
+func newCastRecorder(dir, name, title string) (*castRecorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	path := filepath.Join(dir, fmt.Sprintf("%s_%s.cast", name, start.Format("20060102_150405.000")))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	header, _ := json.Marshal(map[string]interface{}{
+		"version":   2,
+		"width":     castWidth,
+		"height":    castHeight,
+		"timestamp": start.Unix(),
+		"title":     title,
+		"env":       map[string]string{"TERM": "vt100", "SHELL": "/bin/sh"},
+	})
+	if _, err := fmt.Fprintf(file, "%s\n", header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &castRecorder{file: file, start: start}, nil
+}
+
+func (r *castRecorder) event(kind string, data []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	if kind == "o" {
+		// A multi-byte character may be split across reads
+		data = append(r.pending, data...)
+		cut := len(data)
+		for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(data[i]) {
+				if !utf8.FullRune(data[i:]) {
+					cut = i
+				}
+				break
+			}
+		}
+		r.pending = append([]byte(nil), data[cut:]...)
+		data = data[:cut]
+	}
+	if len(data) == 0 {
+		return
+	}
+	line, _ := json.Marshal([]interface{}{
+		float64(time.Since(r.start).Microseconds()) / 1e6, kind, string(data),
+	})
+	fmt.Fprintf(r.file, "%s\n", line)
+}
+
+// output records bytes the device printed
+func (r *castRecorder) output(p []byte) { r.event("o", p) }
+
+// input records bytes sent to the device
+func (r *castRecorder) input(p []byte) { r.event("i", p) }
+
+// close flushes any held-back bytes and closes the cast
+func (r *castRecorder) close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	if len(r.pending) > 0 {
+		line, _ := json.Marshal([]interface{}{float64(time.Since(r.start).Microseconds()) / 1e6, "o", string(r.pending)})
+		fmt.Fprintf(r.file, "%s\n", line)
+	}
+	r.file.Close()
+	r.file = nil
+}
+
+// recordedInput tees what the tool types into the session's cast
+type recordedInput struct {
+	io.WriteCloser
+	rec *castRecorder
+}
+
+func (w recordedInput) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.rec.input(p[:n])
+	return n, err
+}
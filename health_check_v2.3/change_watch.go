@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// CONFIG CHANGE WATCH (-change-watch)
+// ============================================================================
+//
+// Snapshots see a change only when its effects show. With -change-watch 1m
+// the -window and -runbook runs also poll the configuration identity of the
+// targets in the background, one light command per device:
+//
+//   IOS-XR   show configuration commit list   newest commit ID, user, time
+//   others   show running-config              SHA-256 of the config without
+//                                             the timestamp and size lines
+//
+// A changed identity is a commit. It is expected on the devices the MOP
+// changes at that moment: the devices of the runbook "config" step that is
+// running, of a rollback action, and in window mode the -change-allow list.
+// Any other commit is an out-of-process change: it is logged, alerted to
+// -notify at once (event config-change, critical) and recorded with the
+// expected ones in <output>/CONFIG_CHANGES_<ts>.log. When a config step or
+// rollback ends, its devices are polled again and their new identity becomes
+// the reference, so a commit that lands at the end of the step is not
+// reported as out of process on the next poll.
+
+var (
+	xrCommitRe      = regexp.MustCompile(`^\s*1\s+(\S+)\s+(\S+)\s+(\S+)\s+(\S+)\s+(.+?)\s*$`)
+	iosLastChangeRe = regexp.MustCompile(`^! Last configuration change at (.+)$`)
+)
+
+// configIdentity is what identifies the configuration of a device
+type configIdentity struct {
+	ID     string // commit ID (XR) or config hash
+	Detail string // who and when, as far as the device says
+}
+
+// changeWatcher polls the targets of a window or runbook for commits
+type changeWatcher struct {
+	config  *Config
+	devices []DeviceInfo
+	logFile string
+
+	mu      sync.Mutex
+	known   map[string]configIdentity
+	allowed map[string]string // host -> MOP step that may change it
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newChangeWatcher returns nil when -change-watch is off; the methods of a
+// nil watcher do nothing
+func newChangeWatcher(config *Config, targets []DeviceInfo) *changeWatcher {
+	if config.ChangeWatch <= 0 {
+		return nil
+	}
+	return &changeWatcher{
+		config:  config,
+		devices: targets,
+		logFile: filepath.Join(config.OutputDir, fmt.Sprintf("CONFIG_CHANGES_%s.log", time.Now().Format("20060102_150405"))),
+		known:   make(map[string]configIdentity),
+		allowed: make(map[string]string),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// configIdentityCommand is the command a device's identity is read with
+func configIdentityCommand(d DeviceInfo) string {
+	if d.DetectedOS == "IOS-XR" {
+		return "show configuration commit list"
+	}
+	return "show running-config"
+}
+
+// parseConfigIdentity reads the identity from the output of
+// configIdentityCommand; false when there is none
+func parseConfigIdentity(command, output string) (configIdentity, bool) {
+	if isCommandRejected(output) || isIncompleteOutput(output) {
+		return configIdentity{}, false
+	}
+	if strings.Contains(command, "commit list") {
+		for _, line := range strings.Split(output, "\n") {
+			if m := xrCommitRe.FindStringSubmatch(line); m != nil {
+				return configIdentity{ID: m[1], Detail: fmt.Sprintf("commit %s by %s (%s) at %s", m[1], m[2], m[4], m[5])}, true
+			}
+		}
+		return configIdentity{}, false
+	}
+
+	h := sha256.New()
+	id := configIdentity{}
+	lines := 0
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, " \r")
+		if m := iosLastChangeRe.FindStringSubmatch(line); m != nil {
+			id.Detail = "last change at " + m[1]
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "Building configuration") || strings.HasPrefix(line, "Current configuration") ||
+			strings.HasPrefix(line, "! NVRAM config last updated") || strings.HasPrefix(line, "! No configuration change") ||
+			strings.HasPrefix(line, "ntp clock-period") {
+			continue
+		}
+		h.Write([]byte(line + "\n"))
+		lines++
+	}
+	if lines == 0 {
+		return configIdentity{}, false
+	}
+	id.ID = hex.EncodeToString(h.Sum(nil))[:16]
+	return id, true
+}
+
+// poll reads the identity of the devices; hosts that could not be read are
+// missing from the result
+func (w *changeWatcher) poll(devices []DeviceInfo) map[string]configIdentity {
+	var mu sync.Mutex
+	ids := make(map[string]configIdentity)
+	forEachDevice(w.config, devices, func(d DeviceInfo) {
+		command := configIdentityCommand(d)
+		outputs, err := newDeviceClient(d, w.config).ExecuteCommands([]string{command})
+		if err != nil {
+			return
+		}
+		if id, ok := parseConfigIdentity(command, outputs[command]); ok {
+			mu.Lock()
+			ids[strings.ToUpper(d.Hostname)] = id
+			mu.Unlock()
+		}
+	})
+	return ids
+}
+
+// record appends one line to CONFIG_CHANGES_<ts>.log
+func (w *changeWatcher) record(format string, args ...interface{}) {
+	os.MkdirAll(w.config.OutputDir, 0755)
+	f, err := os.OpenFile(w.logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("✗ Config change log: %v", err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%s  %s\n", time.Now().Format("2006-01-02 15:04:05"), fmt.Sprintf(format, args...))
+}
+
+// start takes the reference identities and polls every -change-watch
+// until stop
+func (w *changeWatcher) start() {
+	if w == nil {
+		return
+	}
+	w.known = w.poll(w.devices)
+	w.record("watching %d of %d devices every %s", len(w.known), len(w.devices), w.config.ChangeWatch)
+	log.Printf("CHANGE WATCH: %d devices every %s (log: %s)", len(w.known), w.config.ChangeWatch, w.logFile)
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(w.config.ChangeWatch)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				w.check(w.poll(w.devices))
+			}
+		}
+	}()
+}
+
+// check compares a poll with the known identities and reports the commits
+func (w *changeWatcher) check(ids map[string]configIdentity) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, d := range w.devices {
+		host := strings.ToUpper(d.Hostname)
+		id, ok := ids[host]
+		if !ok {
+			continue
+		}
+		prev, seen := w.known[host]
+		w.known[host] = id
+		if !seen || prev.ID == id.ID {
+			continue
+		}
+		detail := orDash(id.Detail)
+		if step, ok := w.allowed[host]; ok {
+			log.Printf("CHANGE: %s: %s (expected, %s)", d.Hostname, detail, step)
+			w.record("EXPECTED %s: %s (%s)", d.Hostname, detail, step)
+			continue
+		}
+		log.Printf("⚠ CHANGE: %s: out-of-process config change: %s", d.Hostname, detail)
+		w.record("OUT-OF-PROCESS %s: %s", d.Hostname, detail)
+		w.config.Notify.notify(Alert{Event: "config-change", Severity: "critical", Device: d.Hostname, Check: "config change watch",
+			Details: []string{"configuration changed outside the MOP: " + detail}})
+	}
+}
+
+// allow marks devices as changed by the MOP step until settle
+func (w *changeWatcher) allow(step string, devices []DeviceInfo) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, d := range devices {
+		w.allowed[strings.ToUpper(d.Hostname)] = step
+	}
+}
+
+// settle ends the allowance of devices: their commits are taken in as
+// expected and their current identity becomes the reference
+func (w *changeWatcher) settle(devices []DeviceInfo) {
+	if w == nil {
+		return
+	}
+	w.check(w.poll(devices))
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, d := range devices {
+		delete(w.allowed, strings.ToUpper(d.Hostname))
+	}
+}
+
+// close stops the polling and takes a last poll
+func (w *changeWatcher) close() {
+	if w == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+	w.check(w.poll(w.devices))
+	w.record("stopped")
+}
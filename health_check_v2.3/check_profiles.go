@@ -0,0 +1,397 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// CHECK PROFILES (-profiles, PROFILES_<ts>.log)
+// ============================================================================
+//
+// Every device ran the same commands and was judged by the same checks, so
+// an access switch without BGP showed empty BGP tables and a core router
+// with one LDP neighbor left passed. The profiles file (YAML, see
+// yaml_subset.go) gives each kind of device its own checks:
+//
+//   profiles:
+//     - name: core
+//       match: [ASR9906, "Core*"]
+//       require:
+//         LDP_Neighbors: ">= 2"
+//         BGP_Neighbors_Established: ">= 2"
+//         ISIS_Adjacencies_Up: 2          # a bare number is a minimum
+//     - name: access
+//       match: ["ASR92*", L2-SWITCH, UPE9]
+//       skip: [bgp, ldp, segment-routing]
+//     - name: default                     # no match: every other device
+//
+// A match entry is a hostname, Device_Type, Role or detected OS, without
+// case; one ending in "*" is a prefix, as for -role-workers. The first
+// profile with a matching entry is the device's profile; a profile without
+// match catches the devices no other profile matched.
+//
+//   skip      command categories (bgp, ldp, isis, ospf, bfd, l2vpn, vrf,
+//             route-summary, mpls-forwarding, interfaces, ...) that are not
+//             sent to the device, and checks (isis, segment-routing, disk,
+//             node-pair, ...) whose results are left out of the roll-up and
+//             the validation export for it
+//   require   metrics of the SUMMARY (summed over the commands that give
+//             them) with >=, <=, >, <, == or != and a number; FAIL when not
+//             met, NOT_COLLECTED when no command gave the metric
+//
+// PROFILES_<ts>.log lists the profile of each device with its skipped
+// checks and requirements; the requirements are the "profile" check of the
+// roll-up and validation export.
+
+// ProfileRequirement is one metric limit of a profile
+type ProfileRequirement struct {
+	Metric string
+	Op     string
+	Value  float64
+}
+
+// met reports whether v satisfies the requirement
+func (r ProfileRequirement) met(v float64) bool {
+	switch r.Op {
+	case "<=":
+		return v <= r.Value
+	case ">":
+		return v > r.Value
+	case "<":
+		return v < r.Value
+	case "==":
+		return v == r.Value
+	case "!=":
+		return v != r.Value
+	}
+	return v >= r.Value
+}
+
+// CheckProfile is one profile of the file
+type CheckProfile struct {
+	Name    string
+	Match   []string // upper case; "X*" is a prefix
+	Skip    map[string]bool
+	Require []ProfileRequirement
+}
+
+// checkProfiles is the loaded -profiles file; nil means one profile for all
+type checkProfiles struct {
+	Source   string
+	Profiles []CheckProfile
+}
+
+// loadCheckProfiles reads and validates the profiles file
+func loadCheckProfiles(path string) (*checkProfiles, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseYAML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	top, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a profiles list", path)
+	}
+	c := &checkProfiles{Source: path}
+	list, _ := top["profiles"].([]interface{})
+	names := make(map[string]bool)
+	defaults := 0
+	for i, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: profile %d: expected name, match, skip and require", path, i+1)
+		}
+		p := CheckProfile{Skip: make(map[string]bool)}
+		p.Name, _ = yamlString(m, "name")
+		if p.Name == "" {
+			return nil, fmt.Errorf("%s: profile %d has no name", path, i+1)
+		}
+		if names[strings.ToUpper(p.Name)] {
+			return nil, fmt.Errorf("%s: profile %s defined twice", path, p.Name)
+		}
+		names[strings.ToUpper(p.Name)] = true
+
+		match, err := yamlStrings(m, "match")
+		if err != nil {
+			return nil, fmt.Errorf("%s: profile %s: %v", path, p.Name, err)
+		}
+		for _, s := range match {
+			p.Match = append(p.Match, strings.ToUpper(strings.TrimSpace(s)))
+		}
+		if len(p.Match) == 0 {
+			if defaults++; defaults > 1 {
+				return nil, fmt.Errorf("%s: profile %s: only one profile may leave out match", path, p.Name)
+			}
+		}
+		skip, err := yamlStrings(m, "skip")
+		if err != nil {
+			return nil, fmt.Errorf("%s: profile %s: %v", path, p.Name, err)
+		}
+		for _, s := range skip {
+			if s = strings.ToLower(strings.TrimSpace(s)); s == "connection" {
+				return nil, fmt.Errorf("%s: profile %s: the connection check cannot be skipped", path, p.Name)
+			}
+			p.Skip[s] = true
+		}
+
+		if req, ok := m["require"].(map[string]interface{}); ok {
+			for metric := range req {
+				spec, err := yamlString(req, metric)
+				if err != nil {
+					return nil, fmt.Errorf("%s: profile %s: %v", path, p.Name, err)
+				}
+				r, err := parseProfileRequirement(metric, spec)
+				if err != nil {
+					return nil, fmt.Errorf("%s: profile %s: %v", path, p.Name, err)
+				}
+				p.Require = append(p.Require, r)
+			}
+			sort.Slice(p.Require, func(i, j int) bool { return p.Require[i].Metric < p.Require[j].Metric })
+		} else if m["require"] != nil {
+			return nil, fmt.Errorf("%s: profile %s: require must map metrics to limits", path, p.Name)
+		}
+		c.Profiles = append(c.Profiles, p)
+	}
+	if len(c.Profiles) == 0 {
+		return nil, fmt.Errorf("%s: no profiles", path)
+	}
+	return c, nil
+}
+
+// parseProfileRequirement reads "OP N" or "N" (a minimum)
+func parseProfileRequirement(metric, spec string) (ProfileRequirement, error) {
+	r := ProfileRequirement{Metric: strings.TrimSpace(metric), Op: ">="}
+	s := strings.TrimSpace(spec)
+	for _, op := range []string{">=", "<=", "==", "!=", ">", "<"} {
+		if rest, ok := strings.CutPrefix(s, op); ok {
+			r.Op, s = op, strings.TrimSpace(rest)
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return r, fmt.Errorf("%s: limit %q (expected >=, <=, >, <, == or != and a number)", metric, spec)
+	}
+	r.Value = v
+	return r, nil
+}
+
+// deviceMatches reports whether one of the (upper-case) match entries
+// names the device by hostname, Device_Type, Role or OS; "X*" is a prefix
+func deviceMatches(match []string, d DeviceInfo) bool {
+	keys := []string{d.Hostname, d.DeviceType, d.Role, d.DetectedOS}
+	for _, m := range match {
+		prefix, isPrefix := strings.CutSuffix(m, "*")
+		for _, k := range keys {
+			k = strings.ToUpper(k)
+			if k != "" && (k == m || (isPrefix && strings.HasPrefix(k, prefix))) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// profileFor is the profile of a device; nil without profiles or a match
+func (c *checkProfiles) profileFor(d DeviceInfo) *CheckProfile {
+	if c == nil {
+		return nil
+	}
+	var fallback *CheckProfile
+	for i := range c.Profiles {
+		p := &c.Profiles[i]
+		if len(p.Match) == 0 {
+			fallback = p
+		} else if deviceMatches(p.Match, d) {
+			return p
+		}
+	}
+	return fallback
+}
+
+// filterCommands drops the commands of the categories the device's profile skips
+func (c *checkProfiles) filterCommands(d DeviceInfo, cmds []string) []string {
+	p := c.profileFor(d)
+	if p == nil || len(p.Skip) == 0 {
+		return cmds
+	}
+	var kept []string
+	for _, cmd := range cmds {
+		if !p.Skip[metricCategory(strings.ToLower(cmd))] {
+			kept = append(kept, cmd)
+		}
+	}
+	return kept
+}
+
+// dropSkipped removes the results of checks the devices' profiles skip
+func (c *checkProfiles) dropSkipped(v *validationSet) {
+	if c == nil {
+		return
+	}
+	kept := v.rows[:0]
+	for _, r := range v.rows {
+		if p := c.profileFor(v.devices[r.Hostname]); p == nil || !p.Skip[r.Check] {
+			kept = append(kept, r)
+		}
+	}
+	v.rows = kept
+}
+
+// ProfileRow is the outcome of one requirement on one device
+type ProfileRow struct {
+	Hostname    string
+	Profile     string
+	Requirement ProfileRequirement
+	Value       string
+	Status      string // OK, FAIL, NOT_COLLECTED
+}
+
+// deviceMetricTotals sums the numeric metrics of a device over its commands
+func deviceMetricTotals(r *DeviceResult) map[string]float64 {
+	totals := make(map[string]float64)
+	for _, e := range r.Results {
+		if isCommandRejected(e.Output) {
+			continue
+		}
+		for metric, value := range extractMetrics(strings.ToLower(e.Command), e.Output) {
+			if v, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64); err == nil {
+				totals[metric] += v
+			}
+		}
+	}
+	return totals
+}
+
+// checkProfileRequirements judges each collected device against the
+// requirements of its profile
+func checkProfileRequirements(results []*DeviceResult, c *checkProfiles) []ProfileRow {
+	var rows []ProfileRow
+	for _, r := range results {
+		p := c.profileFor(r.Device)
+		if p == nil {
+			continue
+		}
+		var totals map[string]float64
+		if r.Success {
+			totals = deviceMetricTotals(r)
+		}
+		for _, req := range p.Require {
+			row := ProfileRow{Hostname: r.Device.Hostname, Profile: p.Name, Requirement: req, Status: "NOT_COLLECTED"}
+			if v, ok := totals[req.Metric]; ok {
+				row.Value = strconv.FormatFloat(v, 'f', -1, 64)
+				row.Status = "OK"
+				if !req.met(v) {
+					row.Status = "FAIL"
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Hostname < rows[j].Hostname })
+	return rows
+}
+
+func (v *validationSet) addProfiles(rows []ProfileRow) {
+	for _, r := range rows {
+		v.add(r.Hostname, ValidationResult{Check: "profile", Item: r.Requirement.Metric, Value: r.Value,
+			Status: r.Status, Detail: fmt.Sprintf("%s needs %s %g", r.Profile, r.Requirement.Op, r.Requirement.Value)})
+	}
+}
+
+// WriteProfiles writes PROFILES_<ts>.log
+func (w *OutputWriter) WriteProfiles(results []*DeviceResult, c *checkProfiles, rows []ProfileRow) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("PROFILES_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	counts := make(map[string]int)
+	for _, r := range rows {
+		counts[r.Status]++
+	}
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Check Profiles\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s | Profiles: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"), c.Source)
+	fmt.Fprintf(file, " Requirements OK: %d | FAIL: %d | NOT_COLLECTED: %d\n", counts["OK"], counts["FAIL"], counts["NOT_COLLECTED"])
+	fmt.Fprintf(file, "================================================================================\n\n")
+
+	byHost := make(map[string][]ProfileRow)
+	for _, r := range rows {
+		byHost[r.Hostname] = append(byHost[r.Hostname], r)
+	}
+	sorted := append([]*DeviceResult{}, results...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Device.Hostname < sorted[j].Device.Hostname })
+
+	table := newTextTable("HOSTNAME", "PROFILE", "SKIPPED", "REQUIREMENTS", "STATUS")
+	for _, r := range sorted {
+		p := c.profileFor(r.Device)
+		if p == nil {
+			table.add(r.Device.Site, displayHost(r.Device.Hostname), "-", "-", "-", "no profile")
+			continue
+		}
+		var skipped []string
+		for s := range p.Skip {
+			skipped = append(skipped, s)
+		}
+		sort.Strings(skipped)
+		status := "OK"
+		met := 0
+		for _, row := range byHost[r.Device.Hostname] {
+			switch row.Status {
+			case "OK":
+				met++
+			case "FAIL":
+				status = "FAIL"
+			case "NOT_COLLECTED":
+				if status == "OK" {
+					status = "NOT_COLLECTED"
+				}
+			}
+		}
+		reqs := "-"
+		if len(p.Require) > 0 {
+			reqs = fmt.Sprintf("%d/%d met", met, len(p.Require))
+		}
+		table.add(r.Device.Site, displayHost(r.Device.Hostname), p.Name, orDash(strings.Join(skipped, ", ")), reqs, status)
+		for _, row := range byHost[r.Device.Hostname] {
+			if row.Status != "OK" {
+				table.note("    - %s is %s: %s", row.Requirement.Metric, orDash(row.Value), row.Status)
+			}
+		}
+	}
+	table.write(file)
+	return nil
+}
+
+// logProfiles prints the profile of each target at startup
+func logProfiles(c *checkProfiles, targets []DeviceInfo) {
+	counts := make(map[string]int)
+	for _, d := range targets {
+		if p := c.profileFor(d); p != nil {
+			counts[p.Name]++
+		} else {
+			counts["(none)"]++
+		}
+	}
+	var parts []string
+	for _, p := range c.Profiles {
+		parts = append(parts, fmt.Sprintf("%s: %d", p.Name, counts[p.Name]))
+	}
+	if n := counts["(none)"]; n > 0 {
+		parts = append(parts, fmt.Sprintf("no profile: %d", n))
+	}
+	log.Printf("✓ Check profiles from %s (%s)", c.Source, strings.Join(parts, ", "))
+}
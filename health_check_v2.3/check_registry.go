@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// CHECK REGISTRY AND DOCUMENTATION (describe)
+// ============================================================================
+//
+// The runbook described the checks by hand and drifted from the code. The
+// registry below is the one description of every check of the roll-up and
+// validation export: the flag that enables it, the commands it reads, its
+// statuses and what to do about a failure. The roll-up takes its report
+// names from here, and the describe command prints it with the commands of
+// the command files in use (-cmd-xr, -cmd-xe, -cmd-l2, -cmd-default):
+//
+//   ssh_health_check describe checks              every check, one line each
+//   ssh_health_check describe check isis          one check in full
+//   ssh_health_check describe command "show bgp summary"
+//                                                 the checks that read a command
+//
+// A check's commands per OS are the command file lines its reads function
+// accepts (the same category functions the checks use) plus the commands
+// the check adds to the command sets itself.
+
+// checkInfo documents one check
+type checkInfo struct {
+	Name        string
+	Title       string
+	Report      string // report file prefix, "" without a report of its own
+	EnabledBy   string
+	Reads       func(cmd string) bool // command file lines the check reads
+	Adds        map[string][]string   // commands the check adds per OS
+	Collects    string
+	Statuses    [][2]string // status, meaning; PASS/WARN/FAIL as rollupStatus sorts them
+	Remediation []string
+}
+
+// readsCategory accepts the commands of the given metric categories
+func readsCategory(categories ...string) func(string) bool {
+	return func(cmd string) bool {
+		c := metricCategory(strings.ToLower(cmd))
+		for _, want := range categories {
+			if c == want {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+var checkRegistry = []checkInfo{
+	{
+		Name: "connection", Title: "SSH/NETCONF collection", EnabledBy: "every run",
+		Collects: "login and the command set of the device's OS",
+		Statuses: [][2]string{{"OK", "every command ran"}, {"FAILED", "login, prompt or transport error; the device log starts with ERROR"}},
+		Remediation: []string{"check reachability and the management ACL from the jump host",
+			"check the credentials (-p, -key, -vault) and the inventory IP address",
+			"re-collect only the failed devices with -retry-failed RUN"},
+	},
+	{
+		Name: "ping", Title: "Ping tests", Report: "PING_STATS_", EnabledBy: "ping lines in the command files, -vrf-catalogue destinations",
+		Reads:    readsCategory("ping"),
+		Collects: "success rate, RTT and loss of every ping line",
+		Statuses: [][2]string{{"PASS", "success rate at or above the -ping-thresholds threshold"},
+			{"PARTIAL", "below the threshold, some replies"}, {"FAIL", "no replies"}},
+		Remediation: []string{"compare with the pre-check PING_STATS; a new loss points at the changed path",
+			"trace the destination in the VRF (-trace) and check the route and label on each hop"},
+	},
+	{
+		Name: "critical-vrf", Title: "Critical service gate", Report: "CRITICAL_SERVICES_", EnabledBy: "-critical-vrfs or VRF priorities in -vrf-catalogue",
+		Reads:    readsCategory("vrf", "route-summary", "ping"),
+		Collects: "VRF table, route summary per VRF and the VRF's ping tests on every hosting PE",
+		Statuses: [][2]string{{"OK", "routes in the VRF and its pings pass"},
+			{"FAIL", "no routes, a ping below threshold, or the VRF/RD the catalogue expects is missing"}},
+		Remediation: []string{"check the VPNv4 sessions to the route reflectors and the VRF's import route targets",
+			"-critical-abort stops the collection at the first failure; roll back per the MOP"},
+	},
+	{
+		Name: "eem-watcher", Title: "EEM watcher verification", Report: "EEM_WATCH_", EnabledBy: "watchers recorded by -eem-deploy",
+		Adds:     eemCommands,
+		Collects: "logging host, EEM applets and the watcher messages in the logging buffer",
+		Statuses: [][2]string{{"OK", "watchers in place, no down events"}, {"FIRED", "BGP/LDP down events logged"},
+			{"MISSING", "applets or logging host gone"}, {"NOT_COLLECTED", "no watcher output"}},
+		Remediation: []string{"read the fired events in EEM_WATCH and the device logging buffer",
+			"deploy again with -eem-deploy after a reload or config replace"},
+	},
+	{
+		Name: "disk", Title: "Install disk space", Report: "DISK_SPACE_", EnabledBy: "-disk-check",
+		Adds:     diskCheckCommands,
+		Collects: "size and free space of disk0:, disk1:, harddisk:, bootflash: and flash:",
+		Statuses: [][2]string{{"OK", "free space above -min-disk-free and -disk-min-pct"},
+			{"LOW", "below either limit"}, {"NOT_COLLECTED", "no filesystem output"}},
+		Remediation: []string{"remove inactive packages (install remove inactive) and old core and log files"},
+	},
+	{
+		Name: "readiness", Title: "Upgrade readiness", Report: "READINESS_", EnabledBy: "-upgrade-audit",
+		Adds:     upgradeAuditCommands,
+		Collects: "running version, install disk space and install state",
+		Statuses: [][2]string{{"READY", "target version or upgradable, disk space, committed software"},
+			{"NOT_READY", "a reason in the report"}},
+		Remediation: []string{"commit the active software (install commit) and remove inactive packages",
+			"free space on the install disk before copying the image"},
+	},
+	{
+		Name: "redundancy", Title: "RP redundancy", Report: "REDUNDANCY_", EnabledBy: "-redundancy",
+		Adds:     redundancyCommands,
+		Collects: "standby RP state, NSR and software of both RPs (and the Standby_IP login)",
+		Statuses: [][2]string{{"OK", "standby ready, NSR ready, same software"}, {"DEGRADED", "a reason in the report"},
+			{"NO_STANDBY", "no standby RP"}, {"NOT_COLLECTED", "no redundancy output"}},
+		Remediation: []string{"wait for the standby to reach STANDBY HOT / Node Ready before a switchover",
+			"install the active RP's software on the standby"},
+	},
+	{
+		Name: "segment-routing", Title: "Segment Routing", Report: "SR_CHECK_", EnabledBy: "-sr-check",
+		Adds:     srCommands,
+		Collects: "SRGB, prefix and adjacency SIDs, TI-LFA coverage and LDP sessions",
+		Statuses: [][2]string{{"OK", "fleet SRGB, unique prefix SID, adjacency SIDs, TI-LFA at -sr-tilfa-min"},
+			{"DEGRADED", "a reason in the report"}, {"LDP_ONLY", "its LSP has no SR capability"}, {"NOT_COLLECTED", "no IS-IS database"}},
+		Remediation: []string{"check segment-routing mpls under router isis and the prefix-sid on the loopback",
+			"align the global block with the rest of the fleet"},
+	},
+	{
+		Name: "isis", Title: "IS-IS neighbors", Report: "ISIS_", EnabledBy: "every run on devices running IS-IS",
+		Reads:    readsCategory("isis"),
+		Collects: "IS-IS adjacencies and their state",
+		Statuses: [][2]string{{"OK", "every adjacency Up"}, {"DEGRADED", "some not Up"}, {"DOWN", "none Up"},
+			{"NOT_COLLECTED", "IS-IS configured but no neighbor output"}},
+		Remediation: []string{"check the interface, MTU and authentication of the adjacency that is not Up"},
+	},
+	{
+		Name: "node-pair", Title: "Node pairs", Report: "PAIRS_", EnabledBy: "the inventory Pair column",
+		Reads:    readsCategory("vrf", "bgp", "interfaces"),
+		Collects: "VRFs, BGP sessions to the PEs and interface rates of both members",
+		Statuses: [][2]string{{"OK", "same VRFs, every PE on both members, traffic balanced"},
+			{"WARN", "a PE on one member only, or one member above -pair-skew"}, {"FAIL", "a VRF on one member only, or a PE on neither"},
+			{"NOT_COLLECTED", "a member not collected"}},
+		Remediation: []string{"compare the VRF and BGP configuration of both members",
+			"check the IGP metrics when traffic lands on one member"},
+	},
+	{
+		Name: "profile", Title: "Check profile requirements", Report: "PROFILES_", EnabledBy: "-profiles",
+		Collects:    "the SUMMARY metrics the device's profile requires",
+		Statuses:    [][2]string{{"OK", "requirement met"}, {"FAIL", "not met"}, {"NOT_COLLECTED", "no command gave the metric"}},
+		Remediation: []string{"see the check the metric belongs to (BGP, LDP, IS-IS, ...)"},
+	},
+	{
+		Name: "log-events", Title: "Logging events in the change window", Report: "LOG_EVENTS_", EnabledBy: "-log-window",
+		Adds:        logEventCommands,
+		Collects:    "interface flaps and BGP, OSPF, IS-IS and LDP downs logged inside the window",
+		Statuses:    [][2]string{{"OK", "no events in the window"}, {"EVENTS", "events in the window"}},
+		Remediation: []string{"match the events with the MOP steps; unplanned flaps need a look before closing"},
+	},
+	{
+		Name: "route-policy", Title: "Route-policy audit", Report: "RPL_AUDIT_", EnabledBy: "-rpl-audit [-rpl-intent]",
+		Reads:    isRunningConfig,
+		Collects: "route-policies on BGP neighbors and VRF import/export from the running config",
+		Statuses: [][2]string{{"OK", "policy attached as intended"}, {"PERMISSIVE", "pass-all policy"},
+			{"MISSING", "no policy"}, {"MISMATCH", "another policy than intended"}, {"NOT_CONFIGURED", "intended attach point not in the config"}},
+		Remediation: []string{"attach the intended policy; a pass-all policy leaks routes"},
+	},
+	{
+		Name: "ospf-intent", Title: "OSPF adjacency intent", Report: "OSPF_INTENT_", EnabledBy: "-ospf-intent",
+		Reads: func(cmd string) bool {
+			return metricCategory(strings.ToLower(cmd)) == "ospf" || strings.Contains(strings.ToLower(cmd), "ospf interface brief")
+		},
+		Collects: "OSPF neighbors and the area of each OSPF interface",
+		Statuses: [][2]string{{"OK", "FULL on the intended interface and area"}, {"WRONG_INTERFACE", "over another interface"},
+			{"WRONG_AREA", "in another area"}, {"NOT_FULL", "not FULL"}, {"MISSING", "no adjacency"}, {"UNEXPECTED", "FULL but not in the intent"}},
+		Remediation: []string{"check the cabling and the interface's OSPF area against the design"},
+	},
+}
+
+// checkByName finds a check of the registry
+func checkByName(name string) (checkInfo, bool) {
+	for _, c := range checkRegistry {
+		if strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return checkInfo{}, false
+}
+
+// commandsFor lists the commands a check runs on an OS with these command sets
+func (c checkInfo) commandsFor(cs *CommandSet, os string) []string {
+	var cmds []string
+	if c.Reads != nil {
+		for _, cmd := range cs.GetCommandsForOS(os) {
+			if c.Reads(cmd) {
+				cmds = append(cmds, cmd)
+			}
+		}
+	}
+	return mergeCommands(cmds, c.Adds[os])
+}
+
+var describeOSes = []string{"IOS-XR", "IOS-XE", "L2-SWITCH"}
+
+// runDescribe prints the documentation of the checks: describe checks,
+// describe check NAME or describe command CMD
+func runDescribe(w io.Writer, cs *CommandSet, args []string) error {
+	usage := fmt.Errorf("usage: describe checks | describe check NAME | describe command \"CMD\"")
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "checks":
+		table := newTextTable("CHECK", "REPORT", "ENABLED BY", "TITLE")
+		for _, c := range checkRegistry {
+			table.add("", c.Name, orDash(c.Report), c.EnabledBy, c.Title)
+		}
+		table.write(w)
+		fmt.Fprintf(w, "\ndescribe check NAME for the commands, statuses and remediation of a check\n")
+		return nil
+
+	case "check":
+		if len(args) != 2 {
+			return usage
+		}
+		c, ok := checkByName(args[1])
+		if !ok {
+			var names []string
+			for _, c := range checkRegistry {
+				names = append(names, c.Name)
+			}
+			return fmt.Errorf("no check %q (checks: %s)", args[1], strings.Join(names, ", "))
+		}
+		fmt.Fprintf(w, "%s - %s\n", c.Name, c.Title)
+		fmt.Fprintf(w, "  Enabled by: %s\n", c.EnabledBy)
+		report := "-"
+		if c.Report != "" {
+			report = c.Report + "<ts>.log"
+		}
+		fmt.Fprintf(w, "  Report:     %s\n", report)
+		fmt.Fprintf(w, "  Collects:   %s\n", c.Collects)
+		fmt.Fprintf(w, "\n  Commands:\n")
+		for _, os := range describeOSes {
+			cmds := c.commandsFor(cs, os)
+			if len(cmds) == 0 {
+				fmt.Fprintf(w, "    %-10s -\n", os)
+				continue
+			}
+			for i, cmd := range cmds {
+				label := ""
+				if i == 0 {
+					label = os
+				}
+				fmt.Fprintf(w, "    %-10s %s\n", label, cmd)
+			}
+		}
+		fmt.Fprintf(w, "\n  Statuses:\n")
+		for _, s := range c.Statuses {
+			fmt.Fprintf(w, "    %-15s %-5s %s\n", s[0], rollupStatus(s[0]), s[1])
+		}
+		fmt.Fprintf(w, "\n  Remediation:\n")
+		for _, r := range c.Remediation {
+			fmt.Fprintf(w, "    - %s\n", r)
+		}
+		return nil
+
+	case "command":
+		if len(args) < 2 {
+			return usage
+		}
+		cmd := strings.Join(args[1:], " ")
+		var readers []string
+		for _, c := range checkRegistry {
+			reads := c.Reads != nil && c.Reads(cmd)
+			for _, os := range describeOSes {
+				for _, a := range c.Adds[os] {
+					reads = reads || strings.EqualFold(a, cmd)
+				}
+			}
+			if reads {
+				readers = append(readers, c.Name)
+			}
+		}
+		sort.Strings(readers)
+		category := metricCategory(strings.ToLower(cmd))
+		fmt.Fprintf(w, "%s\n", cmd)
+		fmt.Fprintf(w, "  Metric category: %s\n", orDash(category))
+		fmt.Fprintf(w, "  Read by checks:  %s\n", orDash(strings.Join(readers, ", ")))
+		var in []string
+		for _, os := range describeOSes {
+			for _, c := range cs.GetCommandsForOS(os) {
+				if strings.EqualFold(c, cmd) {
+					in = append(in, os)
+				}
+			}
+		}
+		fmt.Fprintf(w, "  In command sets: %s\n", orDash(strings.Join(in, ", ")))
+		return nil
+	}
+	return usage
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// COMMAND DEADLINES AND THE UNREACHABLE-DEVICE CIRCUIT BREAKER
+// ============================================================================
+//
+// A device that stops answering costs the full -timeout on every pass: each
+// window snapshot, exporter poll and runbook wait poll waits out the same
+// dead session again. Three limits bound that:
+//
+//   -timeout        the whole session
+//   -cmd-deadline   each command, in script sessions as in expect sessions;
+//                   a command still running after it is cut off with
+//                   "(incomplete: no prompt within 1m0s)", the commands
+//                   after it are not run, and the earlier output is kept
+//   ctx             ExecuteContext runs a batch under a context: Ctrl-C
+//                   (shutdown.go) or a caller's deadline aborts the session
+//
+// The breaker counts consecutive timeouts per device: a session timeout, an
+// idle timeout, a connect timeout or a command cut off by -cmd-deadline.
+// After -breaker of them in a row the device is marked unreachable and its
+// sessions fail at once for -breaker-cooldown; then one session is let
+// through, which closes the breaker when it answers and opens it for another
+// cooldown when it times out again. Any answer resets the count.
+//
+//   ./health_check -window 2h -window-interval 5m -cmd-deadline 1m -breaker 3
+
+// deadlineCut starts the note of a command cut off by its deadline
+const deadlineCut = "no prompt within"
+
+// breakerTimeouts mark an error as a timeout
+var breakerTimeouts = []string{"timeout", "timed out", deadlineCut}
+
+// deadlineMsg says a command did not finish within its deadline
+func deadlineMsg(deadline time.Duration) string {
+	return fmt.Sprintf("%s %s", deadlineCut, deadline)
+}
+
+// ctxReason is the abort reason of a done context: "timeout" for a
+// deadline, else its cause ("interrupted" on Ctrl-C)
+func ctxReason(ctx context.Context) string {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "timeout"
+	}
+	return context.Cause(ctx).Error()
+}
+
+// circuitBreaker marks devices unreachable after consecutive timeouts
+type circuitBreaker struct {
+	after    int
+	cooldown time.Duration
+
+	mu      sync.Mutex
+	devices map[string]*breakerState
+}
+
+type breakerState struct {
+	timeouts  int
+	openUntil time.Time // sessions fail fast until then
+}
+
+// newCircuitBreaker returns nil (off) for after <= 0
+func newCircuitBreaker(after int, cooldown time.Duration) *circuitBreaker {
+	if after <= 0 {
+		return nil
+	}
+	return &circuitBreaker{after: after, cooldown: cooldown, devices: make(map[string]*breakerState)}
+}
+
+func breakerKey(c *SSHClient) string {
+	return fmt.Sprintf("%s:%d", c.host, c.port)
+}
+
+func breakerName(c *SSHClient) string {
+	if c.name != "" {
+		return c.name
+	}
+	return c.host
+}
+
+// allow fails a session to an unreachable device; past the cooldown it lets
+// one session through and holds the others back for another cooldown
+func (b *circuitBreaker) allow(c *SSHClient) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := b.devices[breakerKey(c)]
+	if st == nil || st.timeouts < b.after {
+		return nil
+	}
+	if now := time.Now(); now.Before(st.openUntil) {
+		return fmt.Errorf("unreachable: %d consecutive timeouts, next try at %s (-breaker)",
+			st.timeouts, st.openUntil.Format("15:04:05"))
+	}
+	st.openUntil = time.Now().Add(b.cooldown)
+	log.Printf("↻ %s: trying the unreachable device again", breakerName(c))
+	return nil
+}
+
+// observe counts a finished session: a timeout, or a command cut off by
+// its deadline, adds one; anything else resets the count
+func (b *circuitBreaker) observe(c *SSHClient, outputs map[string]string, err error) {
+	if b == nil {
+		return
+	}
+	timedOut := false
+	if err != nil {
+		timedOut = breakerTimedOut(err.Error())
+	}
+	for _, out := range outputs {
+		if strings.Contains(out, "(incomplete: "+deadlineCut) {
+			timedOut = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := breakerKey(c)
+	st := b.devices[key]
+	if !timedOut {
+		if st != nil && st.timeouts >= b.after {
+			log.Printf("✓ %s: answers again, no longer unreachable", breakerName(c))
+		}
+		delete(b.devices, key)
+		return
+	}
+	if st == nil {
+		st = &breakerState{}
+		b.devices[key] = st
+	}
+	st.timeouts++
+	if st.timeouts >= b.after {
+		st.openUntil = time.Now().Add(b.cooldown)
+		log.Printf("⛔ %s: %d consecutive timeouts, unreachable until %s", breakerName(c), st.timeouts, st.openUntil.Format("15:04:05"))
+	}
+}
+
+func breakerTimedOut(text string) bool {
+	text = strings.ToLower(text)
+	for _, hint := range breakerTimeouts {
+		if strings.Contains(text, hint) {
+			return true
+		}
+	}
+	return false
+}
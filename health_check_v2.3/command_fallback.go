@@ -0,0 +1,106 @@
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// ============================================================================
+// COMMAND FALLBACK CHAINS
+// ============================================================================
+//
+// A command file line may list alternatives separated by "||":
+//
+//   show vrf all detail || show vrf all
+//
+// The first alternative is sent with the rest of the command set. Any line
+// the device rejects ("% Invalid input", "% Incomplete command", ...) is
+// retried with its next alternative in a follow-up session, so one command
+// file works across software trains that spell a command differently.
+
+var rejectedMarkers = []string{
+	"% Invalid input",
+	"% Incomplete command",
+	"% Ambiguous command",
+	"% Invalid command",
+	"% Unknown command",
+	"% Unrecognized command",
+	"Invalid input detected",
+}
+
+// splitAlternatives returns the fallback chain of a command file line
+func splitAlternatives(line string) []string {
+	var chain []string
+	for _, alt := range strings.Split(line, "||") {
+		if alt = strings.TrimSpace(alt); alt != "" {
+			chain = append(chain, alt)
+		}
+	}
+	if len(chain) == 0 {
+		chain = []string{strings.TrimSpace(line)}
+	}
+	return chain
+}
+
+// isCommandRejected reports whether output is the device refusing the command
+func isCommandRejected(output string) bool {
+	head := output
+	if len(head) > 400 {
+		head = head[:400]
+	}
+	for _, m := range rejectedMarkers {
+		if strings.Contains(head, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// executeWithFallback runs every line's first alternative, then walks the
+// chains of rejected lines. It returns the command actually used per line
+// (so parsers see the real command text) and the outputs keyed by it.
+func executeWithFallback(client *SSHClient, lines []string) ([]string, map[string]string, error) {
+	chains := make([][]string, len(lines))
+	used := make([]string, len(lines))
+	for i, line := range lines {
+		chains[i] = splitAlternatives(line)
+		used[i] = chains[i][0]
+	}
+
+	outputs, err := client.ExecuteCommands(used)
+	if isIncompleteBatch(err) {
+		// Keep what a lost session collected; the rest reads "(not run: ...)"
+		log.Printf("⚠ %s: %v", breakerName(client), err)
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		var retry []string
+		var idx []int
+		for i, chain := range chains {
+			if attempt < len(chain) && used[i] == chain[attempt-1] && isCommandRejected(outputs[used[i]]) {
+				retry = append(retry, chain[attempt])
+				idx = append(idx, i)
+			}
+		}
+		if len(retry) == 0 {
+			break
+		}
+		more, err := client.ExecuteCommands(retry)
+		if err != nil {
+			// Keep the rejected output rather than failing the whole device
+			break
+		}
+		for k, i := range idx {
+			used[i] = retry[k]
+			outputs[retry[k]] = more[retry[k]]
+		}
+	}
+	return used, outputs, nil
+}
+
+// isVRFCommand matches every VRF listing variant the fallback chains use
+func isVRFCommand(command string) bool {
+	return strings.Contains(command, "show vrf") || strings.Contains(command, "show ip vrf")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// COMMAND FILE INCLUDES / DIRECTORIES
+// ============================================================================
+//
+// A command file may pull in shared sections:
+//
+//   !include common_core.txt
+//
+// Paths are relative to the including file. A command "file" may also be a
+// directory, in which case its *.txt files are read in name order
+// (e.g. commands/iosxr/00_common.txt, 10_mpls.txt). A command already
+// listed is not repeated, so a shared section can be included from several
+// places without running twice.
+
+const includeDirective = "!include"
+
+// readCommandFile returns the commands of a file or directory with includes expanded
+func readCommandFile(path string) ([]string, error) {
+	cmds, _, err := expandCommandFile(path)
+	return cmds, err
+}
+
+// commandFileSources lists every file that contributes to a command file
+func commandFileSources(path string) []string {
+	_, sources, _ := expandCommandFile(path)
+	return sources
+}
+
+func expandCommandFile(path string) ([]string, []string, error) {
+	var cmds, sources []string
+	seen := make(map[string]bool)
+	active := make(map[string]bool)
+	listed := make(map[string]bool)
+
+	var expand func(p string) error
+	expand = func(p string) error {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		if active[abs] {
+			return fmt.Errorf("include loop at %s", p)
+		}
+
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			files, _ := filepath.Glob(filepath.Join(p, "*.txt"))
+			sort.Strings(files)
+			for _, f := range files {
+				if err := expand(f); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		active[abs] = true
+		defer delete(active, abs)
+		if !listed[abs] {
+			listed[abs] = true
+			sources = append(sources, p)
+		}
+
+		lines, err := readLines(p)
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			if strings.HasPrefix(line, includeDirective+" ") {
+				inc := strings.TrimSpace(strings.TrimPrefix(line, includeDirective))
+				if !filepath.IsAbs(inc) {
+					inc = filepath.Join(filepath.Dir(p), inc)
+				}
+				if err := expand(inc); err != nil {
+					return fmt.Errorf("%s: %v", p, err)
+				}
+				continue
+			}
+			if !seen[line] {
+				seen[line] = true
+				cmds = append(cmds, line)
+			}
+		}
+		return nil
+	}
+
+	err := expand(path)
+	return cmds, sources, err
+}
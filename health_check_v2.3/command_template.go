@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// PLATFORM COMMAND TEMPLATES
+// ============================================================================
+//
+// The commands of a runbook step go to every device of the step as written,
+// so "ping 10.0.0.1 count 5" works on IOS-XR and is rejected by IOS-XE,
+// which wants "repeat 5". Instead of one step per platform the words that
+// differ are written as placeholders and filled in per device from its
+// detected OS:
+//
+//   {count}    count (IOS-XR)                repeat (IOS-XE, L2 switches)
+//   {commit}   commit (IOS-XR)               nothing, the line is left out
+//   {df}       donnotfrag (IOS-XR)           df-bit (IOS-XE, L2 switches)
+//   {os}       IOS-XR, IOS-XE, L2-SWITCH
+//
+//   - name: reachability
+//     type: wait
+//     devices: [UPE1, CSR1]
+//     command: ping vrf MGMT 10.0.0.1 {count} 5
+//     until: "Success rate is 100"
+//
+// An unknown placeholder is an error when the runbook is loaded.
+
+var commandPlaceholderRe = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// commandPlaceholders maps each placeholder to its value for a device OS
+var commandPlaceholders = map[string]func(deviceOS string) string{
+	"count": func(deviceOS string) string {
+		if deviceOS == "IOS-XR" {
+			return "count"
+		}
+		return "repeat"
+	},
+	"commit": func(deviceOS string) string {
+		if deviceOS == "IOS-XR" {
+			return "commit"
+		}
+		return ""
+	},
+	"df": func(deviceOS string) string {
+		if deviceOS == "IOS-XR" {
+			return "donnotfrag"
+		}
+		return "df-bit"
+	},
+	"os": func(deviceOS string) string {
+		return deviceOS
+	},
+}
+
+// checkCommandTemplate reports the first unknown placeholder of a command
+func checkCommandTemplate(command string) error {
+	for _, m := range commandPlaceholderRe.FindAllStringSubmatch(command, -1) {
+		if _, ok := commandPlaceholders[m[1]]; !ok {
+			names := make([]string, 0, len(commandPlaceholders))
+			for n := range commandPlaceholders {
+				names = append(names, "{"+n+"}")
+			}
+			sort.Strings(names)
+			return fmt.Errorf("%q: unknown placeholder {%s} (%s)", command, m[1], strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// expandCommand fills in the placeholders of a command for a device OS
+func expandCommand(command, deviceOS string) string {
+	if !strings.Contains(command, "{") {
+		return command
+	}
+	expanded := commandPlaceholderRe.ReplaceAllStringFunc(command, func(p string) string {
+		if value, ok := commandPlaceholders[p[1:len(p)-1]]; ok {
+			return value(deviceOS)
+		}
+		return p
+	})
+	return strings.Join(strings.Fields(expanded), " ")
+}
+
+// expandCommands fills in the placeholders of a command list for a device;
+// lines that expand to nothing are left out
+func expandCommands(commands []string, d DeviceInfo) []string {
+	out := make([]string, 0, len(commands))
+	for _, c := range commands {
+		if e := expandCommand(c, d.DetectedOS); e != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
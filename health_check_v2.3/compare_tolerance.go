@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// PRE/POST TOLERANCE BANDS (-compare-tolerance)
+// ============================================================================
+//
+// comparePhases classifies every SUMMARY metric of the post run against the
+// pre run (the baseline) as PASS, WARN or FAIL. Numeric metrics are judged by
+// their change relative to the baseline:
+//
+//   -compare-tolerance "2/10,VRF_Routes_=0.5/2,BGP_Prefixes_Received=5/20"
+//
+// The first WARN/FAIL pair (percent) applies to every metric (default 2/10);
+// NAME=WARN/FAIL overrides it for metrics starting with NAME, the longest
+// match winning. A change within WARN passes, up to FAIL warns, beyond FAIL
+// fails. A change in the better direction (more neighbors, fewer errors, see goldenDirection)
+// never fails, it only warns when outside the WARN band. A metric missing
+// after the change fails; a new one, or a changed text value, warns.
+//
+// Next to COMPARISON_REPORT.txt the deltas are written to
+// COMPARISON_REPORT.csv for spreadsheets and other report tooling, and the
+// WARN and FAIL rows alone to regressions.csv for the post-implementation
+// review deck.
+
+const defaultCompareTolerance = "2/10"
+
+// toleranceBand is the WARN and FAIL limit of a metric prefix, in percent
+type toleranceBand struct {
+	prefix     string
+	warn, fail float64
+}
+
+// toleranceBands is a parsed -compare-tolerance spec
+type toleranceBands struct {
+	spec      string
+	def       toleranceBand
+	overrides []toleranceBand
+	ifErrors  int64    // interface counter growth allowed (see interface_baseline.go)
+	qosIfaces []string // critical interfaces of the QoS check, empty = all (see qos_policy.go)
+}
+
+func parseBandLimits(s string) (float64, float64, error) {
+	w, f, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q: expected WARN/FAIL percentages", s)
+	}
+	warn, err1 := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(w), "%"), 64)
+	fail, err2 := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(f), "%"), 64)
+	if err1 != nil || err2 != nil || warn < 0 || fail < warn {
+		return 0, 0, fmt.Errorf("%q: expected WARN/FAIL percentages with WARN <= FAIL", s)
+	}
+	return warn, fail, nil
+}
+
+// parseToleranceBands reads "WARN/FAIL[,METRIC=WARN/FAIL...]"
+func parseToleranceBands(spec string) (*toleranceBands, error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = defaultCompareTolerance
+	}
+	b := &toleranceBands{spec: spec, ifErrors: defaultIfErrorThreshold}
+	b.def.warn, b.def.fail, _ = parseBandLimits(defaultCompareTolerance)
+	for i, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		name, limits, named := strings.Cut(item, "=")
+		if !named {
+			limits = item
+		}
+		warn, fail, err := parseBandLimits(limits)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case named:
+			b.overrides = append(b.overrides, toleranceBand{strings.TrimSpace(name), warn, fail})
+		case i == 0:
+			b.def = toleranceBand{"", warn, fail}
+		default:
+			return nil, fmt.Errorf("%q: only the first band may omit the metric name", item)
+		}
+	}
+	sort.SliceStable(b.overrides, func(i, j int) bool { return len(b.overrides[i].prefix) > len(b.overrides[j].prefix) })
+	return b, nil
+}
+
+// band returns the limits that apply to a metric
+func (b *toleranceBands) band(metric string) toleranceBand {
+	for _, o := range b.overrides {
+		if strings.HasPrefix(metric, o.prefix) {
+			return o
+		}
+	}
+	return b.def
+}
+
+// PhaseDelta is one metric of the pre/post comparison
+type PhaseDelta struct {
+	goldenKey
+	Pre, Post string
+	Delta     string // "+12 (+2.9%)", "" for text values
+	Status    string // PASS, WARN, FAIL
+	Reason    string
+}
+
+// classifyDelta judges one metric; inPre/inPost say whether the runs have it
+func (b *toleranceBands) classifyDelta(k goldenKey, pre, post string, inPre, inPost bool) PhaseDelta {
+	d := PhaseDelta{goldenKey: k, Pre: pre, Post: post, Status: "PASS"}
+	switch {
+	case k.Command == "CONNECTION":
+		if inPost {
+			d.Status, d.Reason = "FAIL", "device unreachable after the change"
+		}
+		return d
+	case !inPost:
+		d.Status, d.Reason = "FAIL", "missing after the change"
+		return d
+	case goldenIgnored[k.Metric]:
+		return d
+	case !inPre:
+		d.Status, d.Reason = "WARN", "new after the change"
+		return d
+	case k.Metric == "Captured":
+		if post != "Yes" {
+			d.Status, d.Reason = "FAIL", "not captured"
+		}
+		return d
+	}
+
+	p, err1 := strconv.ParseFloat(pre, 64)
+	a, err2 := strconv.ParseFloat(post, 64)
+	if err1 != nil || err2 != nil {
+		if pre != post {
+			d.Status, d.Reason = "WARN", "value changed"
+		}
+		return d
+	}
+	if a == p {
+		return d
+	}
+	pct := 100.0
+	if p != 0 {
+		pct = math.Abs(a-p) / math.Abs(p) * 100
+	}
+	sign := "+"
+	if a < p {
+		sign = "-"
+	}
+	d.Delta = fmt.Sprintf("%s%g (%s%.1f%%)", sign, math.Abs(a-p), sign, pct)
+
+	band := b.band(k.Metric)
+	dir := goldenDirection(k.Metric)
+	better := dir != 0 && (a > p) == (dir > 0)
+	switch {
+	case pct <= band.warn:
+	case better || dir == 0 || pct <= band.fail:
+		d.Status = "WARN"
+		d.Reason = fmt.Sprintf("outside the %g%% warn band", band.warn)
+	default:
+		d.Status = "FAIL"
+		d.Reason = fmt.Sprintf("outside the %g%% fail band", band.fail)
+	}
+	return d
+}
+
+// writeComparisonCSV writes the deltas next to the text report
+func writeComparisonCSV(path string, deltas []PhaseDelta) error {
+	file, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	fmt.Fprintf(file, "Hostname,Command,MetricName,Pre,Post,Delta,Status,Reason\n")
+	for _, d := range deltas {
+		fmt.Fprintf(file, "%s,%s,%s,%s,%s,%s,%s,%s\n", csvField(d.Host), csvField(d.Command), csvField(d.Metric),
+			csvField(d.Pre), csvField(d.Post), csvField(d.Delta), d.Status, csvField(d.Reason))
+	}
+	return nil
+}
+
+// writeRegressionsCSV writes only the WARN and FAIL deltas, numeric columns
+// left empty for text values and missing metrics
+func writeRegressionsCSV(path string, deltas []PhaseDelta) error {
+	file, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	fmt.Fprintf(file, "device,metric,pre,post,delta,delta_pct,severity,command,reason\n")
+	for _, d := range deltas {
+		if d.Status == "PASS" {
+			continue
+		}
+		delta, pct := "", ""
+		p, err1 := strconv.ParseFloat(d.Pre, 64)
+		a, err2 := strconv.ParseFloat(d.Post, 64)
+		if err1 == nil && err2 == nil {
+			delta = strconv.FormatFloat(a-p, 'f', -1, 64)
+			if p != 0 {
+				pct = strconv.FormatFloat((a-p)/math.Abs(p)*100, 'f', 1, 64)
+			}
+		}
+		fmt.Fprintf(file, "%s,%s,%s,%s,%s,%s,%s,%s,%s\n", csvField(d.Host), csvField(d.Metric), csvField(d.Pre),
+			csvField(d.Post), delta, pct, d.Status, csvField(d.Command), csvField(d.Reason))
+	}
+	return nil
+}
+
+// comparisonCSVPath is the CSV written beside a comparison report
+func comparisonCSVPath(report string) string {
+	return filepath.Join(filepath.Dir(report), strings.TrimSuffix(filepath.Base(report), filepath.Ext(report))+".csv")
+}
+
+// loadSummaryPair reads the SUMMARY csv of the pre and post directories
+func loadSummaryPair(preDir, postDir string) (pre, post map[goldenKey]string, err error) {
+	preCSV, postCSV := findCSVFile(preDir), findCSVFile(postDir)
+	if preCSV == "" || postCSV == "" {
+		return nil, nil, fmt.Errorf("could not find CSV summary files in pre/post directories")
+	}
+	if pre, err = loadGoldenCSV(preCSV); err != nil {
+		return nil, nil, fmt.Errorf("failed to load pre-migration data: %v", err)
+	}
+	if post, err = loadGoldenCSV(postCSV); err != nil {
+		return nil, nil, fmt.Errorf("failed to load post-migration data: %v", err)
+	}
+	log.Printf("Comparing:\n  Pre:  %s\n  Post: %s", preCSV, postCSV)
+	return pre, post, nil
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// CONFIGURATION BACKUP & DIFF
+// ============================================================================
+//
+// Every run that collects a full "show running-config" stores it off-box as
+//   <output>/configs/<HOSTNAME>/<HOSTNAME>_<ts>_<phase>.cfg
+//
+//   -config-backup            collect only the running-config from all targets
+//   -config-diff HOST         diff the two newest snapshots of HOST
+//   -config-diff a.cfg,b.cfg  diff two snapshot files
+//   -config-diff pre,post     diff every host between two run directories
+//
+// Diffs are unified (3 lines of context) and ignore the lines that change on
+// every save (build banners, "Last configuration change" stamps, clock lines).
+
+const configDirName = "configs"
+
+var volatileConfigRe = regexp.MustCompile(`^(Building configuration|Current configuration|!! Last configuration change|! Last configuration change|! NVRAM config last updated|!Time:|(Mon|Tue|Wed|Thu|Fri|Sat|Sun) \w{3} +\d+ \d+:\d+:\d+)`)
+
+// isFullRunningConfig matches the whole-config forms, not section filters
+func isFullRunningConfig(command string) bool {
+	c := strings.ToLower(strings.Join(strings.Fields(command), " "))
+	return c == "show running-config" || c == "show run"
+}
+
+// configBackupCommands is the command set of a -config-backup run
+func configBackupCommands() *CommandSet {
+	cmd := []string{"show running-config"}
+	return &CommandSet{IOSXR: cmd, IOSXE: cmd, L2Switch: cmd, Default: cmd}
+}
+
+// SaveConfigSnapshots stores each device's running-config under <outputDir>/configs
+func (w *OutputWriter) SaveConfigSnapshots(results []*DeviceResult, outputDir string) int {
+	saved := 0
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		for _, e := range r.Results {
+			if !isFullRunningConfig(e.Command) || isCommandRejected(e.Output) || strings.TrimSpace(e.Output) == "" {
+				continue
+			}
+			host := strings.ToUpper(r.Device.Hostname)
+			dir := filepath.Join(outputDir, configDirName, host)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				log.Printf("✗ Config backup %s: %v", host, err)
+				break
+			}
+			name := filepath.Join(dir, fmt.Sprintf("%s_%s_%s.cfg", host, w.timestamp, w.phase))
+			if err := writeFileAtomic(name, []byte(e.Output+"\n")); err != nil {
+				log.Printf("✗ Config backup %s: %v", host, err)
+				break
+			}
+			saved++
+			break
+		}
+	}
+	return saved
+}
+
+// configSnapshots lists a host's snapshot files, oldest first
+func configSnapshots(outputDir, host string) []string {
+	files, _ := filepath.Glob(filepath.Join(outputDir, configDirName, strings.ToUpper(host), "*.cfg"))
+	sort.Strings(files)
+	return files
+}
+
+func configLines(text string) []string {
+	var lines []string
+	for _, l := range strings.Split(strings.ReplaceAll(text, "\r", ""), "\n") {
+		if volatileConfigRe.MatchString(strings.TrimSpace(l)) {
+			continue
+		}
+		lines = append(lines, strings.TrimRight(l, " "))
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffOp is one line of an edit script: ' ' keep, '-' delete, '+' insert
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// maxDiffEdits bounds the Myers trace; beyond it the files are shown as replaced
+const maxDiffEdits = 4000
+
+// diffLines computes a shortest edit script with Myers' algorithm
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+	off := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	found := false
+	for d := 0; d <= max && d <= maxDiffEdits && !found; d++ {
+		// Keep v[-d-1 .. d+1] as it was before step d for the backtrack
+		snap := make([]int, 2*d+3)
+		copy(snap, v[off-d-1:off+d+2])
+		trace = append(trace, snap)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	if !found {
+		var ops []diffOp
+		for _, l := range a {
+			ops = append(ops, diffOp{'-', l})
+		}
+		for _, l := range b {
+			ops = append(ops, diffOp{'+', l})
+		}
+		return ops
+	}
+
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		snap := trace[d]
+		at := func(k int) int { return snap[k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x, y = x-1, y-1
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{'+', b[y-1]})
+			} else {
+				ops = append(ops, diffOp{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// unifiedDiff renders a and b as a unified diff; "" when they are equal
+func unifiedDiff(nameA, nameB string, a, b []string) string {
+	ops := diffLines(a, b)
+	changed := false
+	for _, op := range ops {
+		if op.kind != ' ' {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	const context = 3
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", nameA, nameB)
+
+	// line numbers (1-based) of each op in a and b
+	la, lb := make([]int, len(ops)), make([]int, len(ops))
+	ia, ib := 1, 1
+	for i, op := range ops {
+		la[i], lb[i] = ia, ib
+		if op.kind != '+' {
+			ia++
+		}
+		if op.kind != '-' {
+			ib++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		// extend the hunk while changes are within 2*context of each other
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			} else if j-end > 2*context {
+				break
+			}
+		}
+		stop := end + context + 1
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		countA, countB := 0, 0
+		for _, op := range ops[start:stop] {
+			if op.kind != '+' {
+				countA++
+			}
+			if op.kind != '-' {
+				countB++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", la[start], countA, lb[start], countB)
+		for _, op := range ops[start:stop] {
+			fmt.Fprintf(&sb, "%c%s\n", op.kind, op.text)
+		}
+		i = stop
+	}
+	return sb.String()
+}
+
+// runningConfigFromRun returns each host's full running-config of a run directory
+func runningConfigFromRun(dir string) (map[string]string, error) {
+	runs, err := loadRunLogs(dir)
+	if err != nil {
+		return nil, err
+	}
+	configs := make(map[string]string)
+	for host, results := range runs {
+		for _, e := range results {
+			if isFullRunningConfig(e.Command) {
+				configs[host] = e.Output
+				break
+			}
+		}
+	}
+	return configs, nil
+}
+
+// runConfigDiff handles the three -config-diff forms and writes CONFIG_DIFF_<ts>.txt
+func runConfigDiff(spec, outputDir string) (string, error) {
+	type pair struct{ host, nameA, nameB, a, b string }
+	var pairs []pair
+
+	parts := strings.Split(spec, ",")
+	switch {
+	case len(parts) == 1:
+		snaps := configSnapshots(outputDir, parts[0])
+		if len(snaps) < 2 {
+			return "", fmt.Errorf("%s has %d snapshot(s) under %s, need 2", parts[0], len(snaps), filepath.Join(outputDir, configDirName))
+		}
+		pa, pb := snaps[len(snaps)-2], snaps[len(snaps)-1]
+		a, err1 := os.ReadFile(pa)
+		b, err2 := os.ReadFile(pb)
+		if err1 != nil || err2 != nil {
+			return "", fmt.Errorf("cannot read snapshots of %s", parts[0])
+		}
+		pairs = append(pairs, pair{strings.ToUpper(parts[0]), pa, pb, string(a), string(b)})
+
+	case len(parts) == 2:
+		infoA, errA := os.Stat(parts[0])
+		infoB, errB := os.Stat(parts[1])
+		if errA != nil || errB != nil {
+			return "", fmt.Errorf("-config-diff: %s and %s must both exist", parts[0], parts[1])
+		}
+		if !infoA.IsDir() && !infoB.IsDir() {
+			a, _ := os.ReadFile(parts[0])
+			b, _ := os.ReadFile(parts[1])
+			pairs = append(pairs, pair{filepath.Base(parts[0]), parts[0], parts[1], string(a), string(b)})
+			break
+		}
+		pre, err := runningConfigFromRun(parts[0])
+		if err != nil {
+			return "", err
+		}
+		post, err := runningConfigFromRun(parts[1])
+		if err != nil {
+			return "", err
+		}
+		hosts := make(map[string]bool)
+		for h := range pre {
+			hosts[h] = true
+		}
+		for h := range post {
+			hosts[h] = true
+		}
+		var sorted []string
+		for h := range hosts {
+			sorted = append(sorted, h)
+		}
+		sort.Strings(sorted)
+		for _, h := range sorted {
+			pairs = append(pairs, pair{h, parts[0] + "/" + h, parts[1] + "/" + h, pre[h], post[h]})
+		}
+
+	default:
+		return "", fmt.Errorf("-config-diff takes HOST, a.cfg,b.cfg or pre_dir,post_dir")
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", err
+	}
+	outputFile := filepath.Join(outputDir, fmt.Sprintf("CONFIG_DIFF_%s.txt", time.Now().Format("20060102_150405")))
+	file, err := createAtomic(outputFile)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Configuration Diff\n")
+	fmt.Fprintf(file, " Generated: %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, "================================================================================\n")
+
+	changed := 0
+	for _, p := range pairs {
+		fmt.Fprintf(file, "\n=== %s ===\n", p.host)
+		switch {
+		case p.a == "":
+			fmt.Fprintf(file, "(no running-config in %s)\n", p.nameA)
+			continue
+		case p.b == "":
+			fmt.Fprintf(file, "(no running-config in %s)\n", p.nameB)
+			continue
+		}
+		diff := unifiedDiff(p.nameA, p.nameB, configLines(p.a), configLines(p.b))
+		if diff == "" {
+			fmt.Fprintf(file, "No changes\n")
+			continue
+		}
+		changed++
+		fmt.Fprint(file, diff)
+	}
+
+	fmt.Fprintf(file, "\n================================================================================\n")
+	fmt.Fprintf(file, " %d of %d configurations changed\n", changed, len(pairs))
+	fmt.Fprintf(file, "================================================================================\n")
+	return outputFile, nil
+}
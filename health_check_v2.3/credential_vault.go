@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// CREDENTIAL VAULT - AES-256-GCM, key derived from a master passphrase
+// ============================================================================
+//
+//   -vault init                      create an empty vault
+//   -vault add [-vault-entry NAME]   add/replace a credential ("default" or a hostname)
+//   -vault rotate                    re-encrypt under a new master passphrase
+//   -vault list                      show entry names and usernames
+//
+// The passphrase is read from $HC_VAULT_PASSPHRASE or prompted for. When
+// -u/-p are not given and the vault file exists, runs unlock it and use the
+// "default" entry, with per-hostname entries taking precedence.
+
+const (
+	vaultPassEnv      = "HC_VAULT_PASSPHRASE"
+	vaultIterations   = 600000
+	vaultDefaultEntry = "default"
+)
+
+// VaultCredential is one stored login
+type VaultCredential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Enable   string `json:"enable,omitempty"` // enable secret (see enable_mode.go)
+}
+
+// vaultFile is the on-disk form; only Data is secret
+type vaultFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Data       string `json:"data"`
+}
+
+func vaultCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// openVault decrypts the vault at path
+func openVault(path, passphrase string) (map[string]VaultCredential, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var vf vaultFile
+	if err := json.Unmarshal(data, &vf); err != nil {
+		return nil, fmt.Errorf("invalid vault %s: %v", path, err)
+	}
+	if vf.Version != 1 || vf.KDF != "pbkdf2-sha256" {
+		return nil, fmt.Errorf("unsupported vault format %d/%s", vf.Version, vf.KDF)
+	}
+	salt, err1 := base64.StdEncoding.DecodeString(vf.Salt)
+	nonce, err2 := base64.StdEncoding.DecodeString(vf.Nonce)
+	sealed, err3 := base64.StdEncoding.DecodeString(vf.Data)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, fmt.Errorf("corrupt vault %s", path)
+	}
+
+	aead, err := vaultCipher(passphrase, salt, vf.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, nonce, sealed, []byte(vf.KDF))
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or tampered vault")
+	}
+	entries := make(map[string]VaultCredential)
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return nil, fmt.Errorf("corrupt vault payload: %v", err)
+	}
+	return entries, nil
+}
+
+// saveVault encrypts entries with a fresh salt and nonce and replaces path atomically
+func saveVault(path, passphrase string, entries map[string]VaultCredential) error {
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	aead, err := vaultCipher(passphrase, salt, vaultIterations)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	vf := vaultFile{
+		Version:    1,
+		KDF:        "pbkdf2-sha256",
+		Iterations: vaultIterations,
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+	}
+	vf.Data = base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, plain, []byte(vf.KDF)))
+	data, err := json.MarshalIndent(vf, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".vault-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+var stdinReader = bufio.NewReader(os.Stdin)
+
+func promptLine(prompt string) string {
+	fmt.Fprint(os.Stderr, prompt)
+	line, _ := stdinReader.ReadString('\n')
+	return strings.TrimRight(line, "\r\n")
+}
+
+// promptSecret reads a line with terminal echo turned off (when stdin is a terminal)
+func promptSecret(prompt string) string {
+	stty := func(arg string) error {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = os.Stdin
+		return cmd.Run()
+	}
+	echoOff := stty("-echo") == nil
+	if !echoOff && onWindows {
+		fmt.Fprintf(os.Stderr, "(typed in the clear; set %s to avoid the prompt)\n", vaultPassEnv)
+	}
+	line := promptLine(prompt)
+	if echoOff {
+		stty("echo")
+		fmt.Fprintln(os.Stderr)
+	}
+	return line
+}
+
+// vaultPassphrase returns the master passphrase from the environment or a prompt
+func vaultPassphrase(prompt string, confirm bool) (string, error) {
+	if p := os.Getenv(vaultPassEnv); p != "" && !confirm {
+		return p, nil
+	}
+	p := promptSecret(prompt)
+	if p == "" {
+		return "", fmt.Errorf("empty passphrase")
+	}
+	if confirm && promptSecret("Repeat passphrase: ") != p {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+	return p, nil
+}
+
+// runVaultCommand handles the -vault init/add/rotate/list flows
+func runVaultCommand(config *Config) error {
+	path := config.VaultFile
+	switch config.VaultAction {
+	case "init":
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists (use -vault rotate to change the passphrase)", path)
+		}
+		pass, err := vaultPassphrase("New vault passphrase: ", true)
+		if err != nil {
+			return err
+		}
+		if err := saveVault(path, pass, map[string]VaultCredential{}); err != nil {
+			return err
+		}
+		log.Printf("✓ Vault created: %s (add credentials with -vault add)", path)
+
+	case "add":
+		pass, err := vaultPassphrase("Vault passphrase: ", false)
+		if err != nil {
+			return err
+		}
+		entries, err := openVault(path, pass)
+		if err != nil {
+			return err
+		}
+		name := strings.ToUpper(config.VaultEntry)
+		if strings.EqualFold(config.VaultEntry, vaultDefaultEntry) {
+			name = vaultDefaultEntry
+		}
+		cred := VaultCredential{Username: config.Username}
+		if cred.Username == "" {
+			cred.Username = promptLine(fmt.Sprintf("Username for %s: ", name))
+		}
+		cred.Password = promptSecret(fmt.Sprintf("Password for %s@%s: ", cred.Username, name))
+		if cred.Username == "" || cred.Password == "" {
+			return fmt.Errorf("username and password required")
+		}
+		cred.Enable = promptSecret(fmt.Sprintf("Enable secret for %s (empty for none): ", name))
+		_, replaced := entries[name]
+		entries[name] = cred
+		if err := saveVault(path, pass, entries); err != nil {
+			return err
+		}
+		if replaced {
+			log.Printf("✓ Vault entry %s updated", name)
+		} else {
+			log.Printf("✓ Vault entry %s added", name)
+		}
+
+	case "rotate":
+		old, err := vaultPassphrase("Current vault passphrase: ", false)
+		if err != nil {
+			return err
+		}
+		entries, err := openVault(path, old)
+		if err != nil {
+			return err
+		}
+		pass, err := vaultPassphrase("New vault passphrase: ", true)
+		if err != nil {
+			return err
+		}
+		if err := saveVault(path, pass, entries); err != nil {
+			return err
+		}
+		log.Printf("✓ Vault re-encrypted with the new passphrase (%d entries)", len(entries))
+
+	case "list":
+		pass, err := vaultPassphrase("Vault passphrase: ", false)
+		if err != nil {
+			return err
+		}
+		entries, err := openVault(path, pass)
+		if err != nil {
+			return err
+		}
+		var names []string
+		for n := range entries {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		fmt.Printf("%-20s %s\n", "ENTRY", "USERNAME")
+		for _, n := range names {
+			fmt.Printf("%-20s %s\n", n, entries[n].Username)
+		}
+
+	default:
+		return fmt.Errorf("unknown vault action %q (init, add, rotate, list)", config.VaultAction)
+	}
+	return nil
+}
+
+// unlockVaultCredentials fills missing -u/-p from the vault's default entry
+// and keeps the per-hostname entries for processDevice.
+func unlockVaultCredentials(config *Config) error {
+	pass, err := vaultPassphrase("Vault passphrase: ", false)
+	if err != nil {
+		return err
+	}
+	entries, err := openVault(config.VaultFile, pass)
+	if err != nil {
+		return err
+	}
+	if def, ok := entries[vaultDefaultEntry]; ok {
+		if config.Username == "" {
+			config.Username = def.Username
+		}
+		if config.Password == "" {
+			config.Password = def.Password
+		}
+		if config.EnableSecret == "" {
+			config.EnableSecret = def.Enable
+		}
+	}
+	config.Vault = entries
+	log.Printf("✓ Credentials unlocked from %s (%d entries)", config.VaultFile, len(entries))
+	return nil
+}
+
+// vaultCredential returns the per-device vault entry, if any
+func (config *Config) vaultCredential(d DeviceInfo) (VaultCredential, bool) {
+	c, ok := config.Vault[strings.ToUpper(d.Hostname)]
+	return c, ok
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// CRITICAL SERVICE GATE (-critical-vrfs)
+// ============================================================================
+//
+// Some VRFs matter more than the rest of the run: when teleprotection is
+// broken after a change, the engineers need to know now, not after the last
+// access switch answered. -critical-vrfs lists them, highest priority first:
+//
+//   -critical-vrfs TELEPROT,SCADA,CORP [-critical-abort]
+//
+// Every device is checked as its results come in. A device hosts a critical
+// VRF when its VRF table lists it; on each hosting PE the VRF fails when
+//
+//   - the route summary shows no routes in it (fewer than the -thresholds
+//     critical_min_routes or min_routes of its priority, see thresholds.go), or
+//   - a ping test in the VRF is below its -ping-thresholds threshold
+//
+// With -vrf-catalogue a PE the catalogue places the VRF on also fails when
+// its VRF table lacks the VRF or shows another RD (see vrf_catalogue.go).
+//
+// A failure raises a critical alert at once (-notify). With
+// -critical-abort the first failure also stops the collection: devices not
+// yet started are skipped and listed in the report, the reports are written
+// for the devices collected so far.
+//
+// The PEs hosting the critical VRFs are collected first, ordered by the
+// highest-priority VRF they host, as the route summary of the newest run in
+// the output directory shows it. Without an earlier run the inventory order
+// is kept. CRITICAL_SERVICES_<ts>.log has one row per VRF and hosting PE, in
+// priority order.
+
+// CriticalFinding is the state of one critical VRF on one PE
+type CriticalFinding struct {
+	Priority int // 1 = highest
+	VRF      string
+	Hostname string
+	Routes   string // "" = no route summary collected
+	Pings    string // passed/total
+	Status   string // OK, FAIL
+	Reasons  []string
+}
+
+// criticalGate checks the critical VRFs as devices finish; nil when
+// -critical-vrfs is not set
+type criticalGate struct {
+	vrfs       []string
+	abort      bool
+	thresholds *pingThresholds
+	catalogue  *vrfCatalogue
+	limits     *thresholdSet
+	notify     *notifier
+	phase      string
+
+	mu       sync.Mutex
+	findings []CriticalFinding
+	trigger  string // first failure that stopped the run
+	skipped  []string
+}
+
+func newCriticalGate(config *Config, phase string) *criticalGate {
+	var vrfs []string
+	for _, v := range strings.Split(config.CriticalVRFs, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			vrfs = append(vrfs, v)
+		}
+	}
+	if len(vrfs) == 0 {
+		return nil
+	}
+	return &criticalGate{vrfs: vrfs, abort: config.CriticalAbort, thresholds: config.Ping, catalogue: config.VRFs,
+		limits: config.Limits, notify: config.Notify, phase: phase}
+}
+
+// order moves the PEs hosting critical VRFs to the front, highest priority
+// first, by the route summary of the newest earlier run
+func (g *criticalGate) order(devices []DeviceInfo, outputDir string) []DeviceInfo {
+	if g == nil {
+		return devices
+	}
+	csvPath := newestSummaryCSV(outputDir)
+	if csvPath == "" {
+		return devices
+	}
+	data, err := loadGoldenCSV(csvPath)
+	if err != nil {
+		return devices
+	}
+	rank := make(map[string]int)
+	for k := range data {
+		vrf, ok := strings.CutPrefix(k.Metric, "VRF_Routes_")
+		if !ok {
+			continue
+		}
+		for i, v := range g.vrfs {
+			host := strings.ToUpper(k.Host)
+			if strings.EqualFold(v, vrf) && (rank[host] == 0 || i+1 < rank[host]) {
+				rank[host] = i + 1
+			}
+		}
+	}
+	if len(rank) == 0 {
+		return devices
+	}
+	ordered := append([]DeviceInfo{}, devices...)
+	key := func(d DeviceInfo) int {
+		if r := rank[strings.ToUpper(d.Hostname)]; r > 0 {
+			return r
+		}
+		return len(g.vrfs) + 1
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return key(ordered[i]) < key(ordered[j]) })
+	log.Printf("Critical VRFs: %d hosting PEs first (hosting from %s)", len(rank), filepath.Dir(csvPath))
+	return ordered
+}
+
+// newestSummaryCSV returns the SUMMARY csv of the newest run of any phase
+func newestSummaryCSV(outputDir string) string {
+	phases, _ := os.ReadDir(outputDir)
+	var newest runEntry
+	for _, p := range phases {
+		if !p.IsDir() {
+			continue
+		}
+		runs, _ := listRuns(outputDir, p.Name())
+		if len(runs) > 0 && runs[0].Time.After(newest.Time) {
+			newest = runs[0]
+		}
+	}
+	if newest.Dir == "" {
+		return ""
+	}
+	return findCSVFile(newest.Dir)
+}
+
+// stopped reports whether the run was aborted and records d as skipped
+func (g *criticalGate) stopped(d DeviceInfo) bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.trigger == "" {
+		return false
+	}
+	g.skipped = append(g.skipped, d.Hostname)
+	return true
+}
+
+// observe checks the critical VRFs a finished device hosts
+func (g *criticalGate) observe(r *DeviceResult) {
+	if g == nil || !r.Success {
+		return
+	}
+	findings := checkCriticalVRFs(r, g.vrfs, g.thresholds, g.catalogue, g.limits)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.findings = append(g.findings, findings...)
+	for _, f := range findings {
+		if f.Status != "FAIL" {
+			continue
+		}
+		log.Printf("✗ CRITICAL VRF %s (priority %d) failed on %s: %s", f.VRF, f.Priority, f.Hostname, strings.Join(f.Reasons, "; "))
+		g.notify.notify(Alert{Event: "fail", Severity: "critical", Device: f.Hostname, Check: "critical VRF " + f.VRF,
+			Phase: g.phase, Details: f.Reasons})
+		if g.abort && g.trigger == "" {
+			g.trigger = fmt.Sprintf("%s on %s", f.VRF, f.Hostname)
+			log.Printf("✗ -critical-abort: stopping the collection, devices not yet started are skipped")
+		}
+	}
+}
+
+// recall adds the findings of a device collected in an earlier pass of
+// the run (-retry-failed) without alerting again
+func (g *criticalGate) recall(r *DeviceResult) {
+	if g == nil || !r.Success {
+		return
+	}
+	findings := checkCriticalVRFs(r, g.vrfs, g.thresholds, g.catalogue, g.limits)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.findings = append(g.findings, findings...)
+}
+
+// report returns the findings in priority order, the abort trigger and the
+// skipped devices
+func (g *criticalGate) report() ([]CriticalFinding, string, []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	findings := append([]CriticalFinding{}, g.findings...)
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Priority != findings[j].Priority {
+			return findings[i].Priority < findings[j].Priority
+		}
+		return findings[i].Hostname < findings[j].Hostname
+	})
+	skipped := append([]string{}, g.skipped...)
+	sort.Strings(skipped)
+	return findings, g.trigger, skipped
+}
+
+// checkCriticalVRFs judges the critical VRFs hosted by one device, and
+// those the catalogue places on it; limits sets the routes each needs
+func checkCriticalVRFs(r *DeviceResult, vrfs []string, thresholds *pingThresholds, catalogue *vrfCatalogue, limits *thresholdSet) []CriticalFinding {
+	if thresholds == nil {
+		thresholds, _ = parsePingThresholds("")
+	}
+	hosted := make(map[string]bool)
+	rds := make(map[string]string)
+	routes := make(map[string]int)
+	summary, table := false, false
+	for _, e := range r.Results {
+		switch {
+		case isVRFCommand(e.Command):
+			table = true
+			for _, v := range parseVRFTable(e.Output) {
+				hosted[strings.ToUpper(v.Name)] = true
+				rds[strings.ToUpper(v.Name)] = v.RD
+			}
+		case metricCategory(e.Command) == "route-summary":
+			summary = true
+			for vrf, n := range parseRouteSummary(e.Output) {
+				routes[strings.ToUpper(vrf)] += n
+			}
+		}
+	}
+	pings := collectPingResults([]*DeviceResult{r})
+
+	var findings []CriticalFinding
+	for i, vrf := range vrfs {
+		name := strings.ToUpper(vrf)
+		def, placed := catalogue.hosting(vrf, r.Device.Hostname)
+		if !hosted[name] {
+			if placed && table {
+				findings = append(findings, CriticalFinding{Priority: i + 1, VRF: vrf, Hostname: r.Device.Hostname, Status: "FAIL",
+					Reasons: []string{"VRF not configured, the catalogue places it on this PE"}})
+			}
+			continue
+		}
+		f := CriticalFinding{Priority: i + 1, VRF: vrf, Hostname: r.Device.Hostname, Status: "OK"}
+		if placed && def.RD != "" && rds[name] != def.RD {
+			f.Reasons = append(f.Reasons, fmt.Sprintf("RD %s, the catalogue has %s", orDash(rds[name]), def.RD))
+		}
+		if summary {
+			f.Routes = fmt.Sprint(routes[name])
+			if need := limits.minRoutes(i + 1); routes[name] < need {
+				if routes[name] == 0 {
+					f.Reasons = append(f.Reasons, "no routes in the VRF")
+				} else {
+					f.Reasons = append(f.Reasons, fmt.Sprintf("%d routes in the VRF, need %d", routes[name], need))
+				}
+			}
+		}
+		passed, total := 0, 0
+		for _, p := range pings {
+			if !strings.EqualFold(p.VRF, vrf) {
+				continue
+			}
+			total++
+			if status := thresholds.status(p); status == "PASS" {
+				passed++
+			} else {
+				f.Reasons = append(f.Reasons, fmt.Sprintf("ping %s %s (%d%%, need %d%%)", p.Target, status, p.SuccessPct, thresholds.threshold(p)))
+			}
+		}
+		if total > 0 {
+			f.Pings = fmt.Sprintf("%d/%d", passed, total)
+		}
+		if len(f.Reasons) > 0 {
+			f.Status = "FAIL"
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// WriteCriticalServices writes CRITICAL_SERVICES_<ts>.log
+func (w *OutputWriter) WriteCriticalServices(vrfs []string, findings []CriticalFinding, trigger string, skipped []string) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("CRITICAL_SERVICES_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	counts := make(map[string]int)
+	for _, f := range findings {
+		counts[f.Status]++
+	}
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Critical Service Check\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, " Critical VRFs (priority order): %s\n", strings.Join(vrfs, ", "))
+	fmt.Fprintf(file, " OK: %d | FAIL: %d\n", counts["OK"], counts["FAIL"])
+	fmt.Fprintf(file, "================================================================================\n\n")
+
+	if trigger != "" {
+		fmt.Fprintf(file, "ABORTED: critical VRF %s failed; %d devices not validated:\n", trigger, len(skipped))
+		for _, h := range skipped {
+			fmt.Fprintf(file, "  %s\n", displayHost(h))
+		}
+		fmt.Fprintf(file, "\n")
+	}
+
+	table := newTextTable("PRIO", "VRF", "HOSTNAME", "ROUTES", "PINGS", "STATUS")
+	for _, f := range findings {
+		table.add(hostSite(f.Hostname), f.Priority, f.VRF, displayHost(f.Hostname), orDash(f.Routes), orDash(f.Pings), f.Status)
+		for _, reason := range f.Reasons {
+			table.note("    - %s", reason)
+		}
+	}
+	table.write(file)
+
+	hosting := make(map[string]bool)
+	for _, f := range findings {
+		hosting[strings.ToUpper(f.VRF)] = true
+	}
+	for _, v := range vrfs {
+		if !hosting[strings.ToUpper(v)] {
+			fmt.Fprintf(file, "\n⚠ %s: no collected device hosts this VRF\n", v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// DISK SPACE CHECK - free space on the install filesystems of every device
+// ============================================================================
+
+// installFilesystems are the disks install operations write to
+var installFilesystems = []string{"disk0:", "disk1:", "harddisk:", "bootflash:", "flash:"}
+
+// diskCheckCommands is merged into each OS command set by -disk-check
+var diskCheckCommands = map[string][]string{
+	"IOS-XR":    {"show filesystem"},
+	"IOS-XE":    {"show file systems"},
+	"L2-SWITCH": {"show file systems"},
+	"DEFAULT":   {"show file systems"},
+}
+
+func addDiskCheckCommands(cs *CommandSet) {
+	cs.IOSXR = mergeCommands(cs.IOSXR, diskCheckCommands["IOS-XR"])
+	cs.IOSXE = mergeCommands(cs.IOSXE, diskCheckCommands["IOS-XE"])
+	cs.L2Switch = mergeCommands(cs.L2Switch, diskCheckCommands["L2-SWITCH"])
+	cs.Default = mergeCommands(cs.Default, diskCheckCommands["DEFAULT"])
+}
+
+// deviceInstallDisks returns the install filesystems found in a device's output
+func deviceInstallDisks(results []ExecutionResult) []FilesystemInfo {
+	found := make(map[string]FilesystemInfo)
+	for _, e := range results {
+		if !isFilesystemCommand(e.Command) {
+			continue
+		}
+		for _, fs := range parseFilesystems(e.Output) {
+			if _, dup := found[fs.Name]; !dup {
+				found[fs.Name] = fs
+			}
+		}
+	}
+	var disks []FilesystemInfo
+	for _, name := range installFilesystems {
+		if fs, ok := found[name]; ok && fs.SizeBytes > 0 {
+			disks = append(disks, fs)
+		}
+	}
+	return disks
+}
+
+// filesystemMetrics reports free space per install disk for the summary CSV
+func filesystemMetrics(output string) map[string]string {
+	metrics := make(map[string]string)
+	for _, fs := range parseFilesystems(output) {
+		for _, name := range installFilesystems {
+			if fs.Name == name && fs.SizeBytes > 0 {
+				key := strings.TrimSuffix(name, ":")
+				metrics[key+"_Free_MB"] = strconv.FormatInt(fs.FreeBytes/(1024*1024), 10)
+				metrics[key+"_Free_Pct"] = strconv.FormatFloat(fs.FreePct(), 'f', 1, 64)
+			}
+		}
+	}
+	return metrics
+}
+
+// DiskRow is one install filesystem of one device
+type DiskRow struct {
+	Hostname string
+	OS       string
+	FS       FilesystemInfo
+	Status   string // OK, LOW, NOT_COLLECTED
+}
+
+// checkDiskSpace flags install disks below minFreeMB or minFreePct, or
+// the limits of the device's role in the -thresholds file
+func checkDiskSpace(results []*DeviceResult, minFreeMB int64, minFreePct float64, limits *thresholdSet) []DiskRow {
+	var rows []DiskRow
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		disks := deviceInstallDisks(r.Results)
+		if len(disks) == 0 {
+			rows = append(rows, DiskRow{Hostname: r.Device.Hostname, OS: r.Device.DetectedOS, Status: "NOT_COLLECTED"})
+			continue
+		}
+		minMB, minPct := limits.disk(r.Device, minFreeMB, minFreePct)
+		for _, fs := range disks {
+			row := DiskRow{Hostname: r.Device.Hostname, OS: r.Device.DetectedOS, FS: fs, Status: "OK"}
+			if fs.FreeBytes/(1024*1024) < minMB || fs.FreePct() < minPct {
+				row.Status = "LOW"
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// WriteDiskCheck writes DISK_SPACE_<ts>.log
+func (w *OutputWriter) WriteDiskCheck(rows []DiskRow, minFreeMB int64, minFreePct float64) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("DISK_SPACE_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	low := 0
+	for _, r := range rows {
+		if r.Status != "OK" {
+			low++
+		}
+	}
+
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Disk Space Check\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, " Threshold: %d MB and %.0f%% free\n", minFreeMB, minFreePct)
+	fmt.Fprintf(file, "================================================================================\n\n")
+	fmt.Fprintf(file, " Filesystems: %d | Below threshold or not collected: %d\n\n", len(rows), low)
+
+	table := newTextTable("HOSTNAME", "OS", "DISK", "SIZE_MB", "FREE_MB", "FREE%", "STATUS").alignRight(3, 4, 5)
+	for _, r := range rows {
+		if r.Status == "NOT_COLLECTED" {
+			table.add(hostSite(r.Hostname), displayHost(r.Hostname), r.OS, "-", "-", "-", "-", r.Status)
+			continue
+		}
+		table.add(hostSite(r.Hostname), displayHost(r.Hostname), r.OS, r.FS.Name, r.FS.SizeBytes/(1024*1024),
+			r.FS.FreeBytes/(1024*1024), fmt.Sprintf("%.1f%%", r.FS.FreePct()), r.Status)
+	}
+	table.write(file)
+	return nil
+}
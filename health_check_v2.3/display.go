@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ============================================================================
+// DISPLAY NAMES AND TABLES
+// ============================================================================
+//
+// Hostnames such as PE-PACO-CORE-01 and PE-PACO-CORE-02 overflowed the fixed
+// 12-character columns of the reports and became hard to tell apart. The
+// inventory may now give a device a short display alias (Alias column, JSON
+// "alias"), which every table shows instead of the hostname; file names, logs
+// and CSV output keep the hostname so nothing that parses them changes.
+//
+// Tables are rendered by textTable, which sizes each column to its widest
+// cell. When the rows span more than one inventory site they are grouped
+// under a [SITE] heading, sites in name order, rows in their original order.
+
+// displayInventory is the loaded inventory, for renderers that only carry a hostname
+var displayInventory struct {
+	sync.RWMutex
+	byHost map[string]DeviceInfo
+}
+
+// setDisplayInventory records the inventory used for aliases and sites
+func setDisplayInventory(devices map[string]DeviceInfo) {
+	byHost := make(map[string]DeviceInfo, len(devices))
+	for k, d := range devices {
+		byHost[k] = d
+	}
+	displayInventory.Lock()
+	displayInventory.byHost = byHost
+	displayInventory.Unlock()
+}
+
+func inventoryEntry(host string) (DeviceInfo, bool) {
+	displayInventory.RLock()
+	defer displayInventory.RUnlock()
+	d, ok := displayInventory.byHost[strings.ToUpper(host)]
+	return d, ok
+}
+
+// displayName is the alias of a device, or its hostname
+func displayName(d DeviceInfo) string {
+	if d.Alias != "" {
+		return d.Alias
+	}
+	return d.Hostname
+}
+
+// displayHost is displayName for a bare hostname
+func displayHost(host string) string {
+	if d, ok := inventoryEntry(host); ok && d.Alias != "" {
+		return d.Alias
+	}
+	return host
+}
+
+// hostSite is the inventory site of a hostname ("" when unknown)
+func hostSite(host string) string {
+	d, _ := inventoryEntry(host)
+	return d.Site
+}
+
+// textTable is a report table with columns as wide as their contents
+type textTable struct {
+	header []string
+	right  map[int]bool
+	rows   []tableRow
+}
+
+type tableRow struct {
+	site  string
+	cells []string
+	notes []string // detail lines printed under the row
+}
+
+func newTextTable(header ...string) *textTable {
+	return &textTable{header: header, right: make(map[int]bool)}
+}
+
+// alignRight right-aligns the given columns (numbers)
+func (t *textTable) alignRight(cols ...int) *textTable {
+	for _, c := range cols {
+		t.right[c] = true
+	}
+	return t
+}
+
+// add appends a row under site; values are formatted with %v
+func (t *textTable) add(site string, cells ...interface{}) {
+	row := tableRow{site: site}
+	for _, c := range cells {
+		row.cells = append(row.cells, fmt.Sprint(c))
+	}
+	t.rows = append(t.rows, row)
+}
+
+// note adds a detail line under the last row
+func (t *textTable) note(format string, args ...interface{}) {
+	if n := len(t.rows); n > 0 {
+		t.rows[n-1].notes = append(t.rows[n-1].notes, fmt.Sprintf(format, args...))
+	}
+}
+
+// write renders the header, an underline and the rows
+func (t *textTable) write(w io.Writer) {
+	widths := make([]int, len(t.header))
+	measure := func(cells []string) {
+		for i, c := range cells {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(c); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	measure(t.header)
+	for _, r := range t.rows {
+		measure(r.cells)
+	}
+
+	line := func(cells []string) string {
+		var b strings.Builder
+		for i, c := range cells {
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c))
+			switch {
+			case t.right[i]:
+				b.WriteString(pad + c)
+			case i == len(cells)-1:
+				b.WriteString(c)
+			default:
+				b.WriteString(c + pad)
+			}
+			if i < len(cells)-1 {
+				b.WriteString(" ")
+			}
+		}
+		return strings.TrimRight(b.String(), " ")
+	}
+
+	total := len(widths) - 1
+	for _, n := range widths {
+		total += n
+	}
+	if total < 80 {
+		total = 80
+	}
+	fmt.Fprintln(w, line(t.header))
+	fmt.Fprintln(w, strings.Repeat("-", total))
+
+	sites := make(map[string]bool)
+	for _, r := range t.rows {
+		sites[r.site] = true
+	}
+	emit := func(r tableRow) {
+		fmt.Fprintln(w, line(r.cells))
+		for _, n := range r.notes {
+			fmt.Fprintln(w, n)
+		}
+	}
+	if len(sites) < 2 {
+		for _, r := range t.rows {
+			emit(r)
+		}
+		return
+	}
+
+	// Grouped by site; rows without a site come last
+	rows := append([]tableRow(nil), t.rows...)
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i].site, rows[j].site
+		if (a == "") != (b == "") {
+			return b == ""
+		}
+		return a < b
+	})
+	for i, r := range rows {
+		if i == 0 || r.site != rows[i-1].site {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			name := r.site
+			if name == "" {
+				name = "no site"
+			}
+			fmt.Fprintf(w, "[%s]\n", name)
+		}
+		emit(r)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// END-TO-END FIXTURE CHECK (-e2e-check)
+// ============================================================================
+//
+// -parse-check and -clean-check cover single outputs; -e2e-check runs the
+// whole pre-check / post-check / compare pipeline on recorded device logs,
+// without SSH, and compares every report it writes with golden files. A
+// scenario is a directory
+//
+//   <dir>/<scenario>/pre/*.log     device logs of the pre run (the
+//   <dir>/<scenario>/post/*.log    <host>_<ts>.log files a run writes)
+//   <dir>/<scenario>/expected/     golden reports, written by -e2e-update
+//
+// Each phase is replayed through writeRunReports with fixed timestamps and
+// the disk, redundancy, SR, route-policy and static route checks enabled,
+// then comparePhases compares the two. Wall-clock times and the temporary
+// output path are masked before comparing, and the TIMINGS report is not
+// compared. Any difference, missing or extra file fails the check (exit
+// status 1), so CI can run
+//
+//   ssh_health_check -e2e-check testdata/e2e
+//
+// After an intended report change, rerun with -e2e-update and review the
+// diff of expected/ with the change.
+
+var (
+	e2eTimestamps = map[string]string{"pre": "20260101_090000", "post": "20260101_110000"}
+	e2eClockRe    = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}(\.\d+Z)?`)
+)
+
+const e2eExpectedDir = "expected"
+
+// runE2ECheck replays every scenario below dir
+func runE2ECheck(config *Config, dir string, update bool) error {
+	var scenarios []string
+	if _, err := os.Stat(filepath.Join(dir, "pre")); err == nil {
+		scenarios = []string{dir}
+	} else {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*", "pre"))
+		for _, m := range matches {
+			scenarios = append(scenarios, filepath.Dir(m))
+		}
+	}
+	sort.Strings(scenarios)
+	if len(scenarios) == 0 {
+		return fmt.Errorf("no <scenario>/pre fixtures under %s", dir)
+	}
+
+	failed := 0
+	for _, scenario := range scenarios {
+		name := filepath.Base(scenario)
+		got, err := replayScenario(config, scenario)
+		if err != nil {
+			log.Printf("✗ %s: %v", name, err)
+			failed++
+			continue
+		}
+		expectedDir := filepath.Join(scenario, e2eExpectedDir)
+		if update {
+			if err := writeGoldenFiles(expectedDir, got); err != nil {
+				return err
+			}
+			log.Printf("✓ %s: %d golden files written to %s", name, len(got), expectedDir)
+			continue
+		}
+		if problems := compareGoldenFiles(expectedDir, got); len(problems) > 0 {
+			log.Printf("✗ %s:\n    %s", name, strings.Join(problems, "\n    "))
+			failed++
+			continue
+		}
+		log.Printf("✓ %s (%d reports)", name, len(got))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d scenarios failed", failed, len(scenarios))
+	}
+	if !update {
+		log.Printf("✓ All %d scenarios match their golden reports", len(scenarios))
+	}
+	return nil
+}
+
+// replayScenario runs the pipeline on a scenario and returns the normalized
+// outputs by relative path
+func replayScenario(config *Config, scenario string) (map[string]string, error) {
+	tmp, err := os.MkdirTemp("", "hc-e2e-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	cfg := *config
+	cfg.OutputDir = tmp
+	cfg.DiskCheck, cfg.Redundancy, cfg.SRCheck, cfg.RPLAudit, cfg.StaticAudit = true, true, true, true, true
+	if cfg.SRTILFAMin == 0 {
+		cfg.SRTILFAMin = 100
+	}
+	cfg.UpgradeAudit, cfg.PeerRegistry, cfg.OSPFIntent, cfg.OSPFIntentOut = false, "", "", ""
+	cfg.RPLIntent, cfg.StaticIntent = "", ""
+	cfg.Exports = map[string]bool{"csv": true}
+	cfg.Ping, cfg.Notify, cfg.Stores = nil, nil, nil
+
+	// Fixed sample stamps: the sequence restarts per phase, the source is
+	// not the machine's
+	sampleSource = "e2e"
+	dirs := make(map[string]string)
+	for _, phase := range []string{"pre", "post"} {
+		resetSampleClock()
+		results, err := loadFixtureRun(filepath.Join(scenario, phase))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", phase, err)
+		}
+		writer := &OutputWriter{dir: filepath.Join(tmp, phase, e2eTimestamps[phase]), phase: phase, timestamp: e2eTimestamps[phase]}
+		if err := os.MkdirAll(writer.dir, 0755); err != nil {
+			return nil, err
+		}
+		for _, r := range results {
+			writer.WriteDevice(r)
+		}
+		writeRunReports(&cfg, writer, results, nil)
+		dirs[phase] = writer.dir
+	}
+	if _, err := comparePhases(dirs["pre"], dirs["post"], filepath.Join(tmp, "COMPARISON_REPORT.txt"), nil); err != nil {
+		return nil, fmt.Errorf("compare: %v", err)
+	}
+
+	got := make(map[string]string)
+	err = filepath.WalkDir(tmp, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), "TIMINGS_") {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(tmp, path)
+		text := strings.ReplaceAll(string(data), tmp, "<output>")
+		got[filepath.ToSlash(rel)] = e2eClockRe.ReplaceAllString(text, "<time>")
+		return nil
+	})
+	return got, err
+}
+
+// loadFixtureRun reads the device logs of a recorded run back into results
+func loadFixtureRun(dir string) ([]*DeviceResult, error) {
+	logs, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	sort.Strings(logs)
+	var results []*DeviceResult
+	for _, path := range logs {
+		if isReportLog(filepath.Base(path)) {
+			continue
+		}
+		host, commands, err := parseDeviceLog(path)
+		if err != nil {
+			return nil, err
+		}
+		if host == "" {
+			continue
+		}
+		r, err := readDeviceLogHeader(path)
+		if err != nil {
+			return nil, err
+		}
+		r.Device.Hostname = host
+		for i := range commands {
+			commands[i].IPAddress = r.Device.IPAddress
+		}
+		r.Results = commands
+		results = append(results, r)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no device logs in %s", dir)
+	}
+	return results, nil
+}
+
+// readDeviceLogHeader reads the device fields WriteDevice puts above the
+// first command
+func readDeviceLogHeader(path string) (*DeviceResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := &DeviceResult{Success: true}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, " Command: ") {
+			break
+		}
+		if msg, ok := strings.CutPrefix(line, "ERROR: "); ok {
+			r.Success, r.ErrorMessage = false, msg
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Alias":
+			r.Device.Alias = value
+		case "IP Address":
+			r.Device.IPAddress = value
+		case "Standby IP":
+			r.Device.StandbyIP = value
+		case "Pair":
+			r.Device.Pair = value
+		case "Device Type":
+			r.Device.DeviceType = value
+		case "Detected OS":
+			r.Device.DetectedOS = value
+		case "Command File":
+			r.CommandFile = value
+		}
+	}
+	return r, scanner.Err()
+}
+
+// writeGoldenFiles replaces the expected directory with the given outputs
+func writeGoldenFiles(dir string, files map[string]string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	for rel, text := range files {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compareGoldenFiles lists the differences between the expected directory
+// and the outputs, with the first differing line of each file
+func compareGoldenFiles(dir string, got map[string]string) []string {
+	want := make(map[string]string)
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err == nil {
+			rel, _ := filepath.Rel(dir, path)
+			want[filepath.ToSlash(rel)] = string(data)
+		}
+		return err
+	})
+	if len(want) == 0 {
+		return []string{fmt.Sprintf("no golden files in %s (run with -e2e-update)", dir)}
+	}
+
+	names := make(map[string]bool)
+	for n := range want {
+		names[n] = true
+	}
+	for n := range got {
+		names[n] = true
+	}
+	var sorted []string
+	for n := range names {
+		sorted = append(sorted, n)
+	}
+	sort.Strings(sorted)
+
+	var problems []string
+	for _, n := range sorted {
+		w, inWant := want[n]
+		g, inGot := got[n]
+		switch {
+		case !inGot:
+			problems = append(problems, n+": not written")
+		case !inWant:
+			problems = append(problems, n+": not in the golden files")
+		case w != g:
+			wl, gl := strings.Split(w, "\n"), strings.Split(g, "\n")
+			i := 0
+			for i < len(wl) && i < len(gl) && wl[i] == gl[i] {
+				i++
+			}
+			line := func(lines []string) string {
+				if i < len(lines) {
+					return lines[i]
+				}
+				return "(end of file)"
+			}
+			problems = append(problems, fmt.Sprintf("%s line %d:\n        expected: %s\n        got:      %s", n, i+1, line(wl), line(gl)))
+		}
+	}
+	return problems
+}
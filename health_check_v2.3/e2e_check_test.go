@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Every testdata/e2e scenario against its golden reports, as -e2e-check runs
+// them with the default flags
+func TestE2E(t *testing.T) {
+	args := os.Args
+	os.Args = args[:1]
+	config := parseFlags()
+	os.Args = args
+
+	noise, err := loadNoisePatterns(config.NoiseFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Noise = noise
+	if err := runE2ECheck(config, filepath.Join("testdata", "e2e"), false); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,528 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// EEM WATCHERS (-eem-deploy / -eem-remove)
+// ============================================================================
+//
+// During a change window the NOC wants BGP and LDP sessions going down
+// reported by the devices themselves, not only at the next post-check.
+// -eem-deploy puts temporary watchers on the target devices that send those
+// events to a syslog collector:
+//
+//   ssh_health_check -eem-deploy 10.10.1.50 [-eem-vrf MGMT]   before the window
+//   ssh_health_check -phase post ...                          verifies them
+//   ssh_health_check -eem-remove                              after the window
+//
+//   IOS-XE  two EEM applets, HC-WATCH-BGP (%BGP-5-ADJCHANGE ... Down) and
+//           HC-WATCH-LDP (%LDP-5-NBRCHG ... DOWN), each logging an
+//           "HC-WATCH ..." message at critical severity, and a logging host
+//           for the collector
+//   IOS-XR  XR event manager policies are Tcl scripts that would have to be
+//           copied to the device; instead a logging host for the collector at
+//           notifications severity, which carries the
+//           ROUTING-BGP-5-ADJCHANGE and ROUTING-LDP-5-NBR_CHANGE events
+//
+// A logging host the device already has is left alone and is not removed
+// afterwards. Both actions show the commands and ask for a typed EEM
+// (-dry-run only prints them); the commands and device output go to
+// <output>/eem/HOST_<ts>.log. The deployed watchers are recorded in
+// <output>/eem_watchers.json.
+//
+// While that file lists watchers, every run collects the watcher state of
+// those devices and writes EEM_WATCH_<ts>.log:
+//
+//   OK             watchers in place, no down events logged
+//   FIRED          watchers in place, down events in the logging buffer
+//   MISSING        applets or logging host gone (reload, config replace)
+//   NOT_COLLECTED  device not collected or the commands were rejected
+//
+// -eem-remove checks the device afterwards and keeps the record of a device
+// where the watchers are still found.
+
+const (
+	eemStateFile = "eem_watchers.json"
+	eemTag       = "HC-WATCH"
+)
+
+// eemApplets are the IOS-XE applet names and the syslog patterns they watch
+var eemApplets = []struct{ name, pattern, message string }{
+	{eemTag + "-BGP", "%BGP-5-ADJCHANGE.*Down", eemTag + " BGP neighbor down: $_syslog_msg"},
+	{eemTag + "-LDP", "%LDP-5-NBRCHG.*DOWN", eemTag + " LDP neighbor down: $_syslog_msg"},
+}
+
+// eemCommands collect the watcher state
+var eemCommands = map[string][]string{
+	"IOS-XR": {
+		"show running-config logging",
+		"show logging | include ADJCHANGE|NBR_CHANGE",
+	},
+	"IOS-XE": {
+		"show running-config | include logging host",
+		"show event manager policy registered",
+		"show logging | include " + eemTag,
+	},
+}
+
+// eemWatcher is one deployment, as recorded in eem_watchers.json
+type eemWatcher struct {
+	Hostname  string    `json:"hostname"`
+	OS        string    `json:"os"`
+	Collector string    `json:"collector"`
+	VRF       string    `json:"vrf,omitempty"`
+	OwnsHost  bool      `json:"owns_logging_host"` // the logging host was added by the deployment
+	Deployed  time.Time `json:"deployed"`
+}
+
+// EEMRow is the watcher state of one device in a run
+type EEMRow struct {
+	Hostname  string
+	OS        string
+	Collector string
+	Deployed  time.Time
+	Events    int
+	Status    string // OK, FIRED, MISSING, NOT_COLLECTED
+	Reasons   []string
+	Lines     []string // down events, newest last
+}
+
+func addEEMCommands(cs *CommandSet) {
+	cs.IOSXR = mergeCommands(cs.IOSXR, eemCommands["IOS-XR"])
+	cs.IOSXE = mergeCommands(cs.IOSXE, eemCommands["IOS-XE"])
+}
+
+// loadEEMWatchers reads the deployed watchers, keyed by upper-case hostname;
+// empty when none are deployed
+func loadEEMWatchers(outputDir string) (map[string]eemWatcher, error) {
+	data, err := os.ReadFile(filepath.Join(outputDir, eemStateFile))
+	if os.IsNotExist(err) {
+		return map[string]eemWatcher{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []eemWatcher
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", eemStateFile, err)
+	}
+	watchers := make(map[string]eemWatcher)
+	for _, w := range list {
+		watchers[strings.ToUpper(w.Hostname)] = w
+	}
+	return watchers, nil
+}
+
+// saveEEMWatchers rewrites eem_watchers.json, or removes it when no watchers
+// are left
+func saveEEMWatchers(outputDir string, watchers map[string]eemWatcher) error {
+	path := filepath.Join(outputDir, eemStateFile)
+	if len(watchers) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	var list []eemWatcher
+	for _, w := range watchers {
+		list = append(list, w)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Hostname < list[j].Hostname })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	file.Write(append(data, '\n'))
+	return file.Close()
+}
+
+// hasLoggingHost reports whether the running config sends syslog to collector
+func hasLoggingHost(output, collector string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		f := strings.Fields(line)
+		if len(f) >= 2 && f[0] == "logging" && f[1] == collector {
+			return true
+		}
+		if len(f) >= 3 && f[0] == "logging" && f[1] == "host" && f[2] == collector {
+			return true
+		}
+	}
+	return false
+}
+
+// eemLoggingHost is the logging host line for the collector
+func eemLoggingHost(deviceOS, collector, vrf string) string {
+	if deviceOS == "IOS-XR" {
+		if vrf == "" {
+			vrf = "default"
+		}
+		return fmt.Sprintf("logging %s vrf %s severity notifications", collector, vrf)
+	}
+	if vrf != "" {
+		return fmt.Sprintf("logging host %s vrf %s", collector, vrf)
+	}
+	return "logging host " + collector
+}
+
+// eemDeployCommands configures the watchers; addHost adds the logging host
+func eemDeployCommands(deviceOS, collector, vrf string, addHost bool) []string {
+	if deviceOS == "IOS-XR" {
+		if !addHost {
+			return nil
+		}
+		return []string{"configure", eemLoggingHost(deviceOS, collector, vrf), "commit", "end"}
+	}
+	cmds := []string{"configure terminal"}
+	// Results are keyed by command, so the action labels differ per applet
+	for i, a := range eemApplets {
+		cmds = append(cmds,
+			"event manager applet "+a.name,
+			fmt.Sprintf("event syslog pattern \"%s\"", a.pattern),
+			fmt.Sprintf("action %d.0 syslog priority critical msg \"%s\"", i+1, a.message))
+	}
+	if addHost {
+		cmds = append(cmds, eemLoggingHost(deviceOS, collector, vrf))
+	}
+	return append(cmds, "end")
+}
+
+// eemRemoveCommands undoes eemDeployCommands
+func eemRemoveCommands(w eemWatcher) []string {
+	if w.OS == "IOS-XR" {
+		if !w.OwnsHost {
+			return nil
+		}
+		vrf := w.VRF
+		if vrf == "" {
+			vrf = "default"
+		}
+		return []string{"configure", fmt.Sprintf("no logging %s vrf %s", w.Collector, vrf), "commit", "end"}
+	}
+	cmds := []string{"configure terminal"}
+	for _, a := range eemApplets {
+		cmds = append(cmds, "no event manager applet "+a.name)
+	}
+	if w.OwnsHost {
+		cmds = append(cmds, "no "+eemLoggingHost(w.OS, w.Collector, w.VRF))
+	}
+	return append(cmds, "end")
+}
+
+// eemParts are the pieces a deployment puts on (or relies on at) a device
+func eemParts(w eemWatcher) []string {
+	parts := []string{"logging host " + w.Collector}
+	if w.OS == "IOS-XE" {
+		for _, a := range eemApplets {
+			parts = append(parts, "applet "+a.name)
+		}
+	}
+	return parts
+}
+
+// eemFound reads the collected watcher state of a device: which eemParts
+// are configured, and the down events logged
+func eemFound(results []ExecutionResult, w eemWatcher) (collected bool, found map[string]bool, events []string) {
+	found = make(map[string]bool)
+	policies := w.OS != "IOS-XE"
+	for _, e := range results {
+		cmd := strings.ToLower(e.Command)
+		if isCommandRejected(e.Output) {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(cmd, "show running-config"):
+			collected = true
+			if hasLoggingHost(e.Output, w.Collector) {
+				found["logging host "+w.Collector] = true
+			}
+		case strings.HasPrefix(cmd, "show event manager policy registered"):
+			policies = true
+			for _, a := range eemApplets {
+				if strings.Contains(e.Output, a.name) {
+					found["applet "+a.name] = true
+				}
+			}
+		case strings.HasPrefix(cmd, "show logging"):
+			for _, line := range strings.Split(e.Output, "\n") {
+				line = strings.TrimSpace(line)
+				if strings.Contains(line, eemTag) || (w.OS == "IOS-XR" && strings.Contains(strings.ToLower(line), "down")) {
+					events = append(events, line)
+				}
+			}
+		}
+	}
+	return collected && policies, found, events
+}
+
+// checkEEMWatchers verifies the deployed watchers in a run
+func checkEEMWatchers(results []*DeviceResult, watchers map[string]eemWatcher) []EEMRow {
+	byHost := make(map[string]*DeviceResult)
+	for _, r := range results {
+		byHost[strings.ToUpper(r.Device.Hostname)] = r
+	}
+	var rows []EEMRow
+	for key, w := range watchers {
+		row := EEMRow{Hostname: w.Hostname, OS: w.OS, Collector: w.Collector, Deployed: w.Deployed}
+		r, ok := byHost[key]
+		if !ok || !r.Success {
+			row.Status = "NOT_COLLECTED"
+			if ok {
+				row.Reasons = append(row.Reasons, r.ErrorMessage)
+			}
+			rows = append(rows, row)
+			continue
+		}
+		collected, found, events := eemFound(r.Results, w)
+		var missing []string
+		for _, part := range eemParts(w) {
+			if !found[part] {
+				missing = append(missing, part)
+			}
+		}
+		row.Events, row.Lines = len(events), events
+		switch {
+		case !collected:
+			row.Status = "NOT_COLLECTED"
+			row.Reasons = append(row.Reasons, "watcher state not collected (commands missing or rejected)")
+		case len(missing) > 0:
+			row.Status = "MISSING"
+			row.Reasons = append(row.Reasons, "not found: "+strings.Join(missing, ", "))
+		case len(events) > 0:
+			row.Status = "FIRED"
+			row.Reasons = append(row.Reasons, fmt.Sprintf("%d down events in the logging buffer", len(events)))
+		default:
+			row.Status = "OK"
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Hostname < rows[j].Hostname })
+	return rows
+}
+
+// WriteEEMWatch writes EEM_WATCH_<ts>.log
+func (w *OutputWriter) WriteEEMWatch(rows []EEMRow) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("EEM_WATCH_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	counts := make(map[string]int)
+	for _, r := range rows {
+		counts[r.Status]++
+	}
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO EEM Watcher Verification\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, " OK: %d | FIRED: %d | MISSING: %d | NOT_COLLECTED: %d\n",
+		counts["OK"], counts["FIRED"], counts["MISSING"], counts["NOT_COLLECTED"])
+	fmt.Fprintf(file, "================================================================================\n\n")
+
+	table := newTextTable("HOSTNAME", "OS", "COLLECTOR", "DEPLOYED", "EVENTS", "STATUS")
+	for _, r := range rows {
+		table.add(hostSite(r.Hostname), displayHost(r.Hostname), r.OS, r.Collector,
+			r.Deployed.Format("2006-01-02 15:04"), r.Events, r.Status)
+		for _, reason := range r.Reasons {
+			table.note("    - %s", reason)
+		}
+		start := 0
+		if len(r.Lines) > 5 {
+			start = len(r.Lines) - 5
+		}
+		for _, line := range r.Lines[start:] {
+			table.note("      %s", line)
+		}
+	}
+	table.write(file)
+	fmt.Fprintf(file, "\nRemove the watchers after the window with -eem-remove.\n")
+	return nil
+}
+
+// runEEMWatchers deploys (remove = false) or removes the watchers on the
+// target devices
+func runEEMWatchers(config *Config, devices []DeviceInfo, remove bool) error {
+	watchers, err := loadEEMWatchers(config.OutputDir)
+	if err != nil {
+		return err
+	}
+	action, done := "Deploy", "deployed"
+	if remove {
+		action, done = "Remove", "removed"
+	}
+
+	var todo []DeviceInfo
+	for _, d := range devices {
+		_, deployed := watchers[strings.ToUpper(d.Hostname)]
+		switch {
+		case d.DetectedOS != "IOS-XR" && d.DetectedOS != "IOS-XE":
+			log.Printf("⚠ %s: EEM watchers need IOS-XR or IOS-XE, not %s; skipped", d.Hostname, d.DetectedOS)
+		case remove && !deployed:
+			log.Printf("%s: no watchers recorded in %s; skipped", d.Hostname, eemStateFile)
+		case !remove && deployed:
+			log.Printf("%s: watchers already deployed; skipped", d.Hostname)
+		default:
+			todo = append(todo, d)
+		}
+	}
+	if len(todo) == 0 {
+		return fmt.Errorf("no devices to act on")
+	}
+
+	fmt.Fprintf(os.Stderr, "\n%s EEM watchers on %d devices:\n", action, len(todo))
+	for _, d := range todo {
+		fmt.Fprintf(os.Stderr, "  %s (%s)\n", d.Hostname, d.DetectedOS)
+	}
+	preview := map[string][]string{
+		"IOS-XE": eemDeployCommands("IOS-XE", config.EEMDeploy, config.EEMVRF, true),
+		"IOS-XR": eemDeployCommands("IOS-XR", config.EEMDeploy, config.EEMVRF, true),
+	}
+	if remove {
+		preview = map[string][]string{
+			"IOS-XE": eemRemoveCommands(eemWatcher{OS: "IOS-XE", Collector: "<collector>", OwnsHost: true}),
+			"IOS-XR": eemRemoveCommands(eemWatcher{OS: "IOS-XR", Collector: "<collector>", OwnsHost: true}),
+		}
+	}
+	for _, deviceOS := range []string{"IOS-XE", "IOS-XR"} {
+		fmt.Fprintf(os.Stderr, "%s (the logging host only where the device does not have it):\n", deviceOS)
+		for _, cmd := range preview[deviceOS] {
+			fmt.Fprintf(os.Stderr, "    %s\n", cmd)
+		}
+	}
+	if config.DryRun {
+		log.Printf("DRY-RUN EEM watchers: nothing sent")
+		return nil
+	}
+	if answer := promptLine(fmt.Sprintf("Type EEM to %s the watchers on %d devices: ", strings.ToLower(action), len(todo))); answer != "EEM" {
+		return fmt.Errorf("not confirmed")
+	}
+
+	dir := filepath.Join(config.OutputDir, "eem")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	failed := 0
+	for _, d := range todo {
+		var err error
+		if remove {
+			err = removeEEMWatcher(config, d, watchers, dir)
+		} else {
+			err = deployEEMWatcher(config, d, watchers, dir)
+		}
+		if err != nil {
+			log.Printf("✗ %s: %v", d.Hostname, err)
+			failed++
+			continue
+		}
+		log.Printf("✓ %s: watchers %s", d.Hostname, done)
+	}
+	if err := saveEEMWatchers(config.OutputDir, watchers); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d devices failed (see %s)", failed, len(todo), dir)
+	}
+	return nil
+}
+
+// eemStepLog opens the step log of one device
+func eemStepLog(dir string, d DeviceInfo, title string) (*captureLog, *atomicFile, error) {
+	file, err := createAtomic(filepath.Join(dir, fmt.Sprintf("%s_%s.log", d.Hostname, time.Now().Format("20060102_150405"))))
+	if err != nil {
+		return nil, nil, err
+	}
+	fmt.Fprintf(file, "EEM watchers %s: %s (%s)\n", title, d.Hostname, d.DetectedOS)
+	return &captureLog{file}, file, nil
+}
+
+// deployEEMWatcher configures the watchers on one device and records them
+func deployEEMWatcher(config *Config, d DeviceInfo, watchers map[string]eemWatcher, dir string) error {
+	l, file, err := eemStepLog(dir, d, "deploy")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	client := newDeviceClient(d, config)
+	client.pool = nil
+	running := eemCommands[d.DetectedOS][0]
+	outputs, err := client.ExecuteCommands([]string{running})
+	l.step("logging hosts", []string{running}, outputs, err)
+	if err != nil {
+		return err
+	}
+	if isCommandRejected(outputs[running]) {
+		return fmt.Errorf("%q rejected: %s", running, rejectionLine(outputs[running]))
+	}
+	w := eemWatcher{Hostname: d.Hostname, OS: d.DetectedOS, Collector: config.EEMDeploy, VRF: config.EEMVRF,
+		OwnsHost: !hasLoggingHost(outputs[running], config.EEMDeploy), Deployed: time.Now().Truncate(time.Second)}
+	if !w.OwnsHost {
+		log.Printf("%s: already logs to %s; the logging host is kept as is", d.Hostname, config.EEMDeploy)
+	}
+	if cmds := eemDeployCommands(d.DetectedOS, w.Collector, w.VRF, w.OwnsHost); len(cmds) > 0 {
+		if err := runCaptureStep(client, l, "deploy", cmds); err != nil {
+			if cleanup := eemRemoveCommands(w); len(cleanup) > 0 {
+				outputs, cerr := client.ExecuteConfig(cleanup)
+				l.step("cleanup", cleanup, outputs, cerr)
+			}
+			return err
+		}
+	}
+	watchers[strings.ToUpper(d.Hostname)] = w
+	return nil
+}
+
+// removeEEMWatcher removes the watchers of one device and checks they are gone
+func removeEEMWatcher(config *Config, d DeviceInfo, watchers map[string]eemWatcher, dir string) error {
+	key := strings.ToUpper(d.Hostname)
+	w := watchers[key]
+	l, file, err := eemStepLog(dir, d, "remove")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	client := newDeviceClient(d, config)
+	client.pool = nil
+	if cmds := eemRemoveCommands(w); len(cmds) > 0 {
+		if err := runCaptureStep(client, l, "remove", cmds); err != nil {
+			return err
+		}
+	}
+
+	verify := eemCommands[d.DetectedOS]
+	outputs, err := client.ExecuteCommands(verify)
+	l.step("verify", verify, outputs, err)
+	if err != nil {
+		return fmt.Errorf("removed, but the check failed: %v", err)
+	}
+	var results []ExecutionResult
+	for _, cmd := range verify {
+		results = append(results, ExecutionResult{Command: cmd, Output: outputs[cmd]})
+	}
+	_, found, _ := eemFound(results, w)
+	var left []string
+	for _, part := range eemParts(w) {
+		if found[part] && (w.OwnsHost || !strings.HasPrefix(part, "logging host")) {
+			left = append(left, part)
+		}
+	}
+	if len(left) > 0 {
+		return fmt.Errorf("still configured: %s", strings.Join(left, ", "))
+	}
+	delete(watchers, key)
+	return nil
+}
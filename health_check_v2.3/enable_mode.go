@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// ENABLE MODE (privilege escalation at the user EXEC prompt)
+// ============================================================================
+//
+// Accounts without privilege 15 land some IOS and IOS-XE devices at the user
+// EXEC prompt (R1>), where most show commands answer "% Invalid input". With
+// an enable secret the expect session escalates right after login: it sends
+// "enable", answers the Password: prompt and waits for the R1# prompt before
+// the first command.
+//
+//   -enable-secret env:ENABLE_SECRET      the same secret for every device
+//   -enable-secret login                  the login password (TACACS+/RADIUS
+//                                         enable authentication)
+//   -vault add                            also asks for a per-entry secret
+//
+// A vault entry's secret wins over -enable-secret. Devices with a secret use
+// expect sessions under -session auto, because the piped script cannot answer
+// the prompt. The secret is not recorded in session casts and is redacted
+// from the audit transcript. When the device refuses it (% Access denied,
+// % Bad secrets, a second Password: prompt) the device fails with
+// "enable denied: ..." and is not retried; devices already at # are left
+// alone.
+
+// enableLogin makes the login password the enable secret
+const enableLogin = "login"
+
+var enablePasswordRe = regexp.MustCompile(`(?i)^(enable )?(password|secret):$`)
+
+// enableSecretOf is the secret a device escalates with, "" for none
+func enableSecretOf(d DeviceInfo, config *Config, password string) string {
+	secret := resolveSecret(config.EnableSecret)
+	if cred, ok := config.vaultCredential(d); ok && cred.Enable != "" {
+		secret = cred.Enable
+	}
+	if secret == enableLogin {
+		return password
+	}
+	return secret
+}
+
+// userExec reports whether the session sits at a user EXEC prompt
+func (s *expectSession) userExec() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.HasSuffix(lastLine(s.buf), ">")
+}
+
+// enable escalates a user EXEC session to privileged EXEC
+func (s *expectSession) enable(secret string, deadline time.Duration) error {
+	prompt := s.prompt
+	defer func() { s.prompt = prompt }()
+	s.prompt = regexp.MustCompile(prompt.String() + `|` + enablePasswordRe.String())
+
+	s.mu.Lock()
+	from := len(s.buf)
+	s.mu.Unlock()
+	if _, err := io.WriteString(s.stdin, "enable\n"); err != nil {
+		return fmt.Errorf("enable: session closed")
+	}
+	if _, err := s.waitPrompt(from, deadline); err != nil {
+		return fmt.Errorf("enable: %v", err)
+	}
+	if s.atEnablePassword() {
+		s.mu.Lock()
+		sent := len(s.buf)
+		s.mu.Unlock()
+		if err := s.sendSecret(secret); err != nil {
+			return fmt.Errorf("enable: session closed")
+		}
+		if _, err := s.waitPrompt(sent, deadline); err != nil {
+			return fmt.Errorf("enable: %v", err)
+		}
+	}
+	if s.atEnablePassword() || s.userExec() {
+		return fmt.Errorf("enable denied: %s", s.enableRefusal(from))
+	}
+	return nil
+}
+
+func (s *expectSession) atEnablePassword() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return enablePasswordRe.MatchString(lastLine(s.buf))
+}
+
+// sendSecret types the secret past the cast recorder
+func (s *expectSession) sendSecret(secret string) error {
+	w := s.stdin
+	if r, ok := w.(recordedInput); ok {
+		w = r.WriteCloser
+	}
+	_, err := io.WriteString(w, secret+"\n")
+	return err
+}
+
+// enableRefusal is the device's "% ..." message after from, if it gave one
+func (s *expectSession) enableRefusal(from int) string {
+	s.mu.Lock()
+	out := strings.ReplaceAll(string(s.buf[from:]), "\r", "")
+	s.mu.Unlock()
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "%") {
+			return line
+		}
+	}
+	if s.userExec() {
+		return "still at the user EXEC prompt"
+	}
+	return "secret not accepted"
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// EXECUTION PLAN PREVIEW + RUN TIMINGS
+// ============================================================================
+
+// defaultSecondsPerCommand is used when no earlier run has timed the device or its OS
+const defaultSecondsPerCommand = 3.0
+
+// PlannedDevice is one device in the execution plan
+type PlannedDevice struct {
+	Device      DeviceInfo
+	CommandFile string
+	Commands    []string
+	Estimate    time.Duration
+	Basis       string // history, os-average, default
+}
+
+// ExecutionPlan is everything a run is about to do, for approval against the MOP
+type ExecutionPlan struct {
+	Phase     string
+	Devices   []PlannedDevice
+	Workers   int
+	WallClock time.Duration
+	Username  string
+	Password  bool
+	Proxies   []string
+	KeyFiles  []string
+	SNMP      string // snmp transport credentials, "" when no device polls
+	BundleKey string
+}
+
+// commandFileForOS returns the command file a device of osType runs
+func commandFileForOS(config *Config, osType string) string {
+	switch osType {
+	case "IOS-XR":
+		return config.CommandFileXR
+	case "IOS-XE":
+		return config.CommandFileXE
+	case "L2-SWITCH":
+		return config.CommandFileL2
+	}
+	return config.CommandFile
+}
+
+// WriteTimings records per-device wall time so later plans can estimate duration
+func (w *OutputWriter) WriteTimings(results []*DeviceResult) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("TIMINGS_%s.csv", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "Hostname,OS,Commands,Duration_s,Status\n")
+	for _, r := range results {
+		var total time.Duration
+		for _, e := range r.Results {
+			total += e.Duration
+		}
+		status := "SUCCESS"
+		if !r.Success {
+			status = "FAILED"
+		}
+		fmt.Fprintf(file, "%s,%s,%d,%.1f,%s\n", r.Device.Hostname, r.Device.DetectedOS, len(r.Results), total.Seconds(), status)
+	}
+	return nil
+}
+
+// deviceTiming is the most recent successful timing of one device
+type deviceTiming struct {
+	os       string
+	commands int
+	seconds  float64
+}
+
+// loadTimings reads every TIMINGS_*.csv under outputDir; later runs win
+func loadTimings(outputDir string) map[string]deviceTiming {
+	var files []string
+	filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasPrefix(info.Name(), "TIMINGS_") && strings.HasSuffix(info.Name(), ".csv") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	// TIMINGS_<yyyymmdd_hhmmss>.csv sorts chronologically by name
+	sort.Slice(files, func(i, j int) bool { return filepath.Base(files[i]) < filepath.Base(files[j]) })
+
+	timings := make(map[string]deviceTiming)
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		records, _ := csv.NewReader(f).ReadAll()
+		f.Close()
+		for i, rec := range records {
+			if i == 0 || len(rec) < 5 || rec[4] != "SUCCESS" {
+				continue
+			}
+			n, _ := strconv.Atoi(rec[2])
+			secs, err := strconv.ParseFloat(rec[3], 64)
+			if err != nil || n == 0 {
+				continue
+			}
+			timings[strings.ToUpper(rec[0])] = deviceTiming{os: rec[1], commands: n, seconds: secs}
+		}
+	}
+	return timings
+}
+
+// buildExecutionPlan resolves commands per device and estimates the run time
+func buildExecutionPlan(config *Config, targetDevices []DeviceInfo, commands *CommandSet) *ExecutionPlan {
+	plan := &ExecutionPlan{
+		Phase:    config.Phase,
+		Workers:  config.MaxWorkers,
+		Username: config.Username,
+		Password: config.Password != "",
+	}
+	if config.Bundle {
+		plan.BundleKey = config.BundleKey
+	}
+
+	timings := loadTimings(config.OutputDir)
+	osSecs := make(map[string]float64)
+	osCmds := make(map[string]int)
+	for _, t := range timings {
+		osSecs[t.os] += t.seconds
+		osCmds[t.os] += t.commands
+	}
+
+	proxies := make(map[string]bool)
+	keys := make(map[string]bool)
+	for _, d := range targetDevices {
+		cmds := config.Profiles.filterCommands(d, commands.GetCommandsForOS(d.DetectedOS))
+		pd := PlannedDevice{Device: d, CommandFile: commandFileForOS(config, d.DetectedOS), Commands: cmds}
+		transports := transportsOf(d, config)
+		if transports[0] == "snmp" {
+			pd.CommandFile, pd.Commands = "snmp", snmpCommands()
+		}
+		if containsString(transports, "snmp") {
+			plan.SNMP = config.SNMP.describe()
+		}
+
+		perCmd, basis := defaultSecondsPerCommand, "default"
+		if t, ok := timings[strings.ToUpper(d.Hostname)]; ok {
+			perCmd, basis = t.seconds/float64(t.commands), "history"
+		} else if osCmds[d.DetectedOS] > 0 {
+			perCmd, basis = osSecs[d.DetectedOS]/float64(osCmds[d.DetectedOS]), "os-average"
+		}
+		pd.Estimate = time.Duration(perCmd * float64(len(pd.Commands)) * float64(time.Second)).Round(time.Second)
+		pd.Basis = basis
+		plan.Devices = append(plan.Devices, pd)
+
+		proxy := config.Proxy
+		if d.Proxy != "" {
+			proxy = d.Proxy
+		}
+		if proxy != "" && !strings.EqualFold(proxy, "direct") {
+			proxies[redactProxy(proxy)] = true
+		}
+		if d.KeyFile != "" {
+			keys[d.KeyFile] = true
+		} else if config.KeyFile != "" {
+			keys[config.KeyFile] = true
+		}
+	}
+	for p := range proxies {
+		plan.Proxies = append(plan.Proxies, p)
+	}
+	sort.Strings(plan.Proxies)
+	for k := range keys {
+		plan.KeyFiles = append(plan.KeyFiles, k)
+	}
+	sort.Strings(plan.KeyFiles)
+
+	// Longest-first onto the least loaded worker approximates the pool
+	estimates := make([]time.Duration, len(plan.Devices))
+	for i, pd := range plan.Devices {
+		estimates[i] = pd.Estimate
+	}
+	sort.Slice(estimates, func(i, j int) bool { return estimates[i] > estimates[j] })
+	workers := config.MaxWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	load := make([]time.Duration, workers)
+	for _, e := range estimates {
+		min := 0
+		for i := range load {
+			if load[i] < load[min] {
+				min = i
+			}
+		}
+		load[min] += e
+	}
+	for _, l := range load {
+		if l > plan.WallClock {
+			plan.WallClock = l
+		}
+	}
+	return plan
+}
+
+// WritePlan prints the plan in the same layout as the run reports
+func (p *ExecutionPlan) WritePlan(out io.Writer) {
+	fmt.Fprintf(out, "================================================================================\n")
+	fmt.Fprintf(out, " MERALCO Health Check Execution Plan\n")
+	fmt.Fprintf(out, " Phase: %s | Generated: %s\n", p.Phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(out, "================================================================================\n\n")
+
+	total := 0
+	for _, d := range p.Devices {
+		total += len(d.Commands)
+	}
+	fmt.Fprintf(out, " Devices: %d | Commands: %d | Workers: %d | Estimated duration: %s\n\n",
+		len(p.Devices), total, p.Workers, p.WallClock)
+
+	table := newTextTable("HOSTNAME", "IP", "OS", "CMD_FILE", "CMDS", "EST", "BASIS").alignRight(4, 5)
+	for _, d := range p.Devices {
+		table.add(d.Device.Site, displayName(d.Device), d.Device.IPAddress, d.Device.DetectedOS,
+			filepath.Base(d.CommandFile), len(d.Commands), d.Estimate, d.Basis)
+	}
+	table.write(out)
+
+	// Each command file once, with the devices that run it
+	var files []string
+	byFile := make(map[string][]PlannedDevice)
+	for _, d := range p.Devices {
+		if _, ok := byFile[d.CommandFile]; !ok {
+			files = append(files, d.CommandFile)
+		}
+		byFile[d.CommandFile] = append(byFile[d.CommandFile], d)
+	}
+	for _, f := range files {
+		devs := byFile[f]
+		var names []string
+		for _, d := range devs {
+			names = append(names, displayName(d.Device))
+		}
+		fmt.Fprintf(out, "\n--- %s (%s) ---\n", filepath.Base(f), strings.Join(names, ", "))
+		for i, c := range devs[0].Commands {
+			fmt.Fprintf(out, " %2d. %s\n", i+1, c)
+		}
+	}
+
+	fmt.Fprintf(out, "\n--- Required credentials ---\n")
+	password := "provided"
+	if !p.Password {
+		password = "MISSING"
+	}
+	fmt.Fprintf(out, " SSH user:     %s (password %s)\n", orDash(p.Username), password)
+	for _, k := range p.KeyFiles {
+		fmt.Fprintf(out, " SSH key:      %s\n", k)
+	}
+	for _, proxy := range p.Proxies {
+		fmt.Fprintf(out, " SSH proxy:    %s\n", proxy)
+	}
+	if p.SNMP != "" {
+		fmt.Fprintf(out, " SNMP:         %s\n", p.SNMP)
+	}
+	if p.BundleKey != "" {
+		fmt.Fprintf(out, " Bundle key:   %s\n", p.BundleKey)
+	}
+	fmt.Fprintf(out, "================================================================================\n")
+}
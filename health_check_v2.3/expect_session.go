@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// PROMPT-DRIVEN SESSION (expect engine)
+// ============================================================================
+//
+// The script session pipes the whole command list into ssh at once and cuts
+// the output apart at echoed markers; a slow device can drop type-ahead input
+// and lose output. The expect engine instead sends one command, waits until
+// the device prompt comes back (answering pagination prompts on the way), and
+// only then sends the next, so each command returns as soon as it completes.
+//
+// The prompt is first matched with the prompt regex (-prompt-regex, default
+// below), then learned: later waits look for that hostname with any mode
+// suffix, e.g. RP/0/RSP0/CPU0:PE1# or RP/0/RSP0/CPU0:PE1(config)#.
+
+const defaultPromptRegex = `^(RP/\d+/[A-Z0-9]+/CPU\d+:)?[A-Za-z0-9_.\-]+(\([A-Za-z0-9_.\-]+\))?[#>]$`
+
+var pagerRe = regexp.MustCompile(`(?i)(-+\s*more\s*-+|<--- More --->|Press any key to continue[^\n]*)\s*$`)
+
+// useExpect decides the session style for a device OS (-session)
+func useExpect(mode, osType string) bool {
+	switch mode {
+	case "expect":
+		return true
+	case "script":
+		return false
+	default:
+		return osType == "IOS-XR"
+	}
+}
+
+// expectSession is one interactive ssh session read through a growing buffer
+type expectSession struct {
+	client *SSHClient
+	sh     *shell
+	stdin  io.WriteCloser
+	exited chan struct{}
+
+	mu     sync.Mutex
+	buf    []byte
+	last   time.Time
+	notify chan struct{}
+
+	prompt *regexp.Regexp // learned after the first prompt
+	rec    *castRecorder  // -record cast, nil when not recording
+}
+
+func (s *expectSession) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	s.buf = append(s.buf, p...)
+	s.last = time.Now()
+	s.mu.Unlock()
+	s.rec.output(p)
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	if s.client.progress != nil {
+		s.client.progress("")
+	}
+	return len(p), nil
+}
+
+// startExpectSession starts ssh with a pty and waits for the first prompt
+func startExpectSession(c *SSHClient, sshArgs []string, promptRe *regexp.Regexp, deadline time.Duration) (*expectSession, error) {
+	s := &expectSession{client: c, exited: make(chan struct{}), notify: make(chan struct{}, 1), last: time.Now()}
+	var err error
+	if c.record != "" {
+		title := fmt.Sprintf("%s (%s) %s", c.name, c.host, time.Now().Format("2006-01-02 15:04:05"))
+		if s.rec, err = newCastRecorder(c.record, c.name, title); err != nil {
+			return nil, fmt.Errorf("cannot start recording: %v", err)
+		}
+	}
+	if s.sh, err = c.startShell(sshArgs, s); err != nil {
+		s.rec.close()
+		return nil, err
+	}
+	s.stdin = s.sh.stdin
+	if s.rec != nil {
+		s.stdin = recordedInput{WriteCloser: s.stdin, rec: s.rec}
+	}
+	go func() {
+		s.sh.wait()
+		s.rec.close()
+		close(s.exited)
+	}()
+
+	c.attach(s)
+	s.prompt = promptRe
+	if _, err := s.waitPrompt(0, deadline); err != nil {
+		s.kill()
+		return nil, fmt.Errorf("no device prompt: %v", err)
+	}
+	s.learnPrompt()
+	return s, nil
+}
+
+// attach makes s the session c.abort kills, clearing the reason the last
+// session was aborted for
+func (c *SSHClient) attach(s *expectSession) {
+	s.client = c
+	c.mu.Lock()
+	c.kill = s.sh.kill
+	c.aborted = make(chan struct{})
+	c.abortMsg = ""
+	c.mu.Unlock()
+}
+
+// dead reports whether the session has ended
+func (s *expectSession) dead() bool {
+	select {
+	case <-s.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// learnPrompt narrows the prompt regex to the hostname just seen
+func (s *expectSession) learnPrompt() {
+	s.mu.Lock()
+	line := lastLine(s.buf)
+	s.mu.Unlock()
+	base := strings.TrimRight(line, "#>")
+	if i := strings.Index(base, "("); i > 0 {
+		base = base[:i]
+	}
+	if base != "" {
+		s.prompt = regexp.MustCompile(`^` + regexp.QuoteMeta(base) + `(\([^)]*\))?[#>]$`)
+	}
+}
+
+func lastLine(buf []byte) string {
+	s := strings.TrimRight(string(buf), " \r\n\t")
+	if i := strings.LastIndexAny(s, "\r\n"); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSpace(s)
+}
+
+// waitPrompt waits until the output after from ends in a prompt and returns
+// the offset where that prompt line starts.
+func (s *expectSession) waitPrompt(from int, deadline time.Duration) (int, error) {
+	timer := time.NewTimer(deadline)
+	defer timer.Stop()
+	var idleCheck <-chan time.Time
+	if s.client.idleLimit > 0 {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		idleCheck = ticker.C
+	}
+
+	for {
+		s.mu.Lock()
+		tail := s.buf[from:]
+		if loc := pagerRe.FindIndex(tail); loc != nil {
+			// Drop the pager text and page on
+			s.buf = append(s.buf[:from+loc[0]], s.buf[from+loc[1]:]...)
+			s.mu.Unlock()
+			io.WriteString(s.stdin, " ")
+			continue
+		}
+		if line := lastLine(tail); line != "" && s.prompt.MatchString(line) {
+			idx := strings.LastIndex(string(tail), line)
+			s.mu.Unlock()
+			return from + idx, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.notify:
+		case <-timer.C:
+			return -1, fmt.Errorf("%s", deadlineMsg(deadline))
+		case <-idleCheck:
+			s.mu.Lock()
+			quiet := time.Since(s.last)
+			s.mu.Unlock()
+			if quiet >= s.client.idleLimit {
+				return -1, fmt.Errorf("no output for %s (idle timeout)", quiet.Round(time.Second))
+			}
+		case <-s.exited:
+			s.client.mu.Lock()
+			msg := s.client.abortMsg
+			s.client.mu.Unlock()
+			if msg != "" {
+				return -1, fmt.Errorf("%s", msg)
+			}
+			// ssh and the device say why they closed it (permission denied, ...)
+			s.mu.Lock()
+			last := lastLine(s.buf[from:])
+			s.mu.Unlock()
+			if last != "" {
+				return -1, fmt.Errorf("session closed: %s", last)
+			}
+			return -1, fmt.Errorf("session closed")
+		}
+	}
+}
+
+// run sends one command and returns its output without the echo and prompt
+func (s *expectSession) run(command string, deadline time.Duration) (string, error) {
+	s.mu.Lock()
+	from := len(s.buf)
+	s.mu.Unlock()
+	if s.client.progress != nil {
+		s.client.progress(command)
+	}
+	if _, err := io.WriteString(s.stdin, command+"\n"); err != nil {
+		// The ssh process is gone: same as losing it while waiting
+		return "", fmt.Errorf("session closed")
+	}
+	end, err := s.waitPrompt(from, deadline)
+
+	s.mu.Lock()
+	if end < 0 {
+		end = len(s.buf)
+	}
+	out := eraseBackspaces(strings.ReplaceAll(string(s.buf[from:end]), "\r", ""))
+	s.mu.Unlock()
+	if i := strings.Index(out, "\n"); i >= 0 {
+		out = out[i+1:] // echoed command line
+	} else {
+		out = ""
+	}
+	return out, err
+}
+
+// eraseBackspaces applies the \b the device sends to wipe a pager prompt
+func eraseBackspaces(s string) string {
+	if !strings.Contains(s, "\b") {
+		return s
+	}
+	out := []rune{}
+	for _, r := range s {
+		if r == '\b' {
+			if n := len(out); n > 0 && out[n-1] != '\n' {
+				out = out[:n-1]
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+func (s *expectSession) kill() {
+	s.sh.kill()
+	<-s.exited
+}
+
+// close logs out politely and makes sure the process is gone
+func (s *expectSession) close() {
+	io.WriteString(s.stdin, "exit\n")
+	s.stdin.Close()
+	select {
+	case <-s.exited:
+	case <-time.After(5 * time.Second):
+		s.kill()
+	}
+	s.client.mu.Lock()
+	s.client.kill = nil
+	s.client.mu.Unlock()
+}
+
+// openExpect starts a session and prepares the terminal
+func (c *SSHClient) openExpect(sshArgs []string) (*expectSession, error) {
+	promptRe := regexp.MustCompile(defaultPromptRegex)
+	if c.promptRe != nil {
+		promptRe = c.promptRe
+	}
+	s, err := startExpectSession(c, sshArgs, promptRe, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if c.enable != "" && s.userExec() {
+		if err := s.enable(c.enable, 30*time.Second); err != nil {
+			s.kill()
+			return nil, err
+		}
+		s.learnPrompt()
+	}
+	for _, setup := range []string{"terminal length 0", "terminal width 512"} {
+		if _, err := s.run(setup, 30*time.Second); err != nil {
+			s.kill()
+			return nil, fmt.Errorf("%s: %v", setup, err)
+		}
+	}
+	return s, nil
+}
+
+// sessionClosedMarker ends the output of a command cut off because the
+// device or AAA closed the session
+const sessionClosedMarker = "(incomplete: session closed)"
+
+// isIncompleteOutput reports whether runExpect marked an output as cut off
+// or not run
+func isIncompleteOutput(out string) bool {
+	return strings.Contains(out, "(incomplete:") || strings.HasPrefix(out, "(not run")
+}
+
+// runExpect runs commands one by one on an open session. A command that
+// does not complete keeps its partial output and ends the session.
+func (c *SSHClient) runExpect(s *expectSession, commands []string) (map[string]string, error) {
+	c.attach(s)
+	deadline := c.deadline
+	if deadline <= 0 || deadline > c.cmdTimeout {
+		deadline = c.cmdTimeout
+	}
+
+	results := make(map[string]string)
+	for i, command := range commands {
+		out, err := s.run(command, deadline)
+		c.mu.Lock()
+		aborted := c.abortMsg
+		c.mu.Unlock()
+		if aborted != "" {
+			return nil, fmt.Errorf("%s", aborted)
+		}
+		if err != nil {
+			// Keep what arrived; the session state is unknown after this
+			results[command] = strings.TrimSpace(cleanOutput(out, c.noise) + fmt.Sprintf("\n(incomplete: %v)", err))
+			for _, rest := range commands[i+1:] {
+				results[rest] = "(not run: previous command did not complete)"
+			}
+			s.kill()
+			return results, nil
+		}
+		results[command] = cleanOutput(out, c.noise)
+	}
+	return results, nil
+}
+
+// executeInteractive is ExecuteCommands for prompt-driven sessions
+func (c *SSHClient) executeInteractive(sshArgs, commands []string) (map[string]string, error) {
+	// The overall -timeout still bounds the whole session
+	overall := time.AfterFunc(c.cmdTimeout, func() { c.abort("timeout") })
+	defer overall.Stop()
+
+	s, err := c.openExpect(sshArgs)
+	if err != nil {
+		return nil, err
+	}
+	defer s.close()
+	return c.runExpect(s, commands)
+}
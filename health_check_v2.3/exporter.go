@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// PROMETHEUS EXPORTER (-exporter)
+// ============================================================================
+//
+// Polls the targets every -exporter-every with the normal command files and
+// serves the latest values on /metrics in the Prometheus text format, so the
+// migration can be graphed in Grafana instead of watched in a terminal loop.
+// Nothing is written to the output directory. A device that fails a poll
+// keeps only meralco_device_up 0; its protocol series disappear until it
+// answers again, which Grafana shows as a gap rather than a stale value.
+//
+// The endpoint has no authentication; bind it to the management network
+// (e.g. -exporter 10.0.0.5:9108) the way other exporters on the jump box are.
+
+// promSample is one exposition line
+type promSample struct {
+	labels string
+	value  float64
+}
+
+// promFamily is one metric name with its help text and samples
+type promFamily struct {
+	help    string
+	kind    string
+	samples []promSample
+}
+
+// promSet collects the families of one poll
+type promSet map[string]*promFamily
+
+var promHelp = map[string][2]string{
+	"meralco_device_up":                   {"gauge", "1 if the last poll of the device succeeded"},
+	"meralco_device_poll_seconds":         {"gauge", "Duration of the last poll of the device"},
+	"meralco_check_pass":                  {"gauge", "1 if the device accepted the command and it completed"},
+	"meralco_bgp_neighbors":               {"gauge", "BGP neighbors in the summary"},
+	"meralco_bgp_neighbors_established":   {"gauge", "BGP neighbors in Established state"},
+	"meralco_ospf_neighbors":              {"gauge", "OSPF neighbors"},
+	"meralco_ospf_neighbors_full":         {"gauge", "OSPF neighbors in FULL state"},
+	"meralco_ldp_neighbors":               {"gauge", "LDP neighbors"},
+	"meralco_vrf_routes":                  {"gauge", "Routes in the VRF routing table"},
+	"meralco_interface_up":                {"gauge", "1 if the interface line protocol is up"},
+	"meralco_interface_input_bps":         {"gauge", "Interface input rate in bits per second"},
+	"meralco_interface_output_bps":        {"gauge", "Interface output rate in bits per second"},
+	"meralco_interface_errors":            {"gauge", "Interface input, CRC and output errors since the last clear"},
+	"meralco_ping_success_ratio":          {"gauge", "Ping success rate of the command, 0 to 1"},
+	"meralco_ping_pass":                   {"gauge", "1 if the ping met its -ping-thresholds success rate"},
+	"meralco_poll_last_timestamp_seconds": {"gauge", "Unix time the last poll cycle finished"},
+	"meralco_poll_cycle_seconds":          {"gauge", "Duration of the last poll cycle"},
+}
+
+// promLabels renders name="value" pairs in the given order
+func promLabels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	var parts []string
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], r.Replace(pairs[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func (s promSet) add(name string, value float64, labels ...string) {
+	f, ok := s[name]
+	if !ok {
+		meta := promHelp[name]
+		f = &promFamily{kind: meta[0], help: meta[1]}
+		s[name] = f
+	}
+	f.samples = append(f.samples, promSample{promLabels(labels...), value})
+}
+
+// deviceSamples turns one poll result into samples
+func (s promSet) deviceSamples(r *DeviceResult, took time.Duration, thresholds *pingThresholds) {
+	d := r.Device
+	host := []string{"device", d.Hostname, "site", d.Site, "os", d.DetectedOS}
+	up := 0.0
+	if r.Success {
+		up = 1
+	}
+	s.add("meralco_device_up", up, host...)
+	s.add("meralco_device_poll_seconds", took.Seconds(), host...)
+	if !r.Success {
+		return
+	}
+
+	for _, e := range r.Results {
+		pass := 1.0
+		if isCommandRejected(e.Output) || isIncompleteOutput(e.Output) {
+			pass = 0
+		}
+		s.add("meralco_check_pass", pass, "device", d.Hostname, "command", e.Command)
+		if pass == 0 {
+			continue
+		}
+
+		dev := []string{"device", d.Hostname}
+		switch metricCategory(e.Command) {
+		case "bgp":
+			t := parseBGPSummary(e.Output)
+			s.add("meralco_bgp_neighbors", float64(len(t.Neighbors)), append(dev, "command", e.Command)...)
+			s.add("meralco_bgp_neighbors_established", float64(t.EstablishedCount()), append(dev, "command", e.Command)...)
+		case "ospf":
+			t := parseOSPFNeighbors(e.Output)
+			s.add("meralco_ospf_neighbors", float64(len(t.Neighbors)), dev...)
+			s.add("meralco_ospf_neighbors_full", float64(t.FullCount()), dev...)
+		case "ldp":
+			s.add("meralco_ldp_neighbors", float64(len(parseLDPNeighbors(e.Output).Neighbors)), dev...)
+		case "route-summary":
+			for vrf, n := range parseRouteSummary(e.Output) {
+				s.add("meralco_vrf_routes", float64(n), append(dev, "vrf", vrf)...)
+			}
+		case "interfaces":
+			for _, i := range parseShowInterfaces(e.Output) {
+				labels := append(dev, "interface", i.Name)
+				ifUp := 0.0
+				if i.IsUp() {
+					ifUp = 1
+				}
+				s.add("meralco_interface_up", ifUp, labels...)
+				s.add("meralco_interface_input_bps", float64(i.InputRateBps), labels...)
+				s.add("meralco_interface_output_bps", float64(i.OutputRateBps), labels...)
+				s.add("meralco_interface_errors", float64(i.InputErrors+i.CRCErrors+i.OutputErrors), labels...)
+			}
+		case "ping":
+			if p, ok := parsePingOutput(e.Command, e.Output); ok {
+				labels := append(dev, "vrf", p.VRF, "target", p.Target)
+				pingPass := 0.0
+				if thresholds.status(p) == "PASS" {
+					pingPass = 1
+				}
+				s.add("meralco_ping_success_ratio", float64(p.SuccessPct)/100, labels...)
+				s.add("meralco_ping_pass", pingPass, labels...)
+			}
+		}
+	}
+}
+
+// write renders the set in the text exposition format, names sorted
+func (s promSet) write(w *strings.Builder) {
+	var names []string
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := s[name]
+		if f.help != "" {
+			fmt.Fprintf(w, "# HELP %s %s\n", name, f.help)
+		}
+		if f.kind != "" {
+			fmt.Fprintf(w, "# TYPE %s %s\n", name, f.kind)
+		}
+		sort.SliceStable(f.samples, func(i, j int) bool { return f.samples[i].labels < f.samples[j].labels })
+		for _, smp := range f.samples {
+			fmt.Fprintf(w, "%s%s %g\n", name, smp.labels, smp.value)
+		}
+	}
+}
+
+// exporter holds the rendered page of the last completed poll
+type exporter struct {
+	mu   sync.RWMutex
+	page string
+}
+
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.RLock()
+	page := e.page
+	e.mu.RUnlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprint(w, page)
+}
+
+// poll runs one cycle over the targets with -workers sessions
+func (e *exporter) poll(config *Config, targets []DeviceInfo, commands *CommandSet) {
+	start := time.Now()
+	set := make(promSet)
+	var mu sync.Mutex
+
+	devices := make(chan DeviceInfo)
+	var wg sync.WaitGroup
+	for i := 0; i < config.MaxWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range devices {
+				began := time.Now()
+				r := processDevice(d, config, commands, nil)
+				if !r.Success {
+					log.Printf("⚠ EXPORTER: %s poll failed: %s", d.Hostname, r.ErrorMessage)
+				}
+				mu.Lock()
+				set.deviceSamples(r, time.Since(began), config.Ping)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, d := range targets {
+		devices <- d
+	}
+	close(devices)
+	wg.Wait()
+
+	set.add("meralco_poll_last_timestamp_seconds", float64(time.Now().Unix()))
+	set.add("meralco_poll_cycle_seconds", time.Since(start).Seconds())
+	var page strings.Builder
+	set.write(&page)
+
+	e.mu.Lock()
+	e.page = page.String()
+	e.mu.Unlock()
+	log.Printf("EXPORTER: polled %d devices in %s", len(targets), time.Since(start).Round(time.Second))
+}
+
+// runExporter polls forever and serves /metrics until the listener fails
+func runExporter(config *Config, targets []DeviceInfo, commands *CommandSet) error {
+	e := &exporter{}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "MERALCO health check exporter v%s: %d devices every %s, see /metrics\n",
+			Version, len(targets), config.ExporterEvery)
+	})
+	server := &http.Server{Addr: config.Exporter, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		for {
+			next := time.Now().Add(config.ExporterEvery)
+			e.poll(config, targets, commands)
+			if !config.Stop.sleep(time.Until(next)) {
+				server.Close()
+				return
+			}
+		}
+	}()
+	log.Printf("EXPORTER: serving /metrics on %s, polling %d devices every %s",
+		config.Exporter, len(targets), config.ExporterEvery)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
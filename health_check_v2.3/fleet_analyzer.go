@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// FLEET ANALYZER - duplicate RD / IP and overlapping subnet detection
+// ============================================================================
+
+// FleetFinding is one cross-device problem found in collected data
+type FleetFinding struct {
+	Severity string // CRITICAL, WARN
+	Kind     string // DUPLICATE_RD, DUPLICATE_IP, OVERLAP
+	Detail   string
+}
+
+// ifAddress is an interface address seen on a device
+type ifAddress struct {
+	Hostname  string
+	Interface string
+	VRF       string
+	Prefix    netip.Prefix
+}
+
+func (a ifAddress) String() string {
+	return fmt.Sprintf("%s %s (vrf %s)", a.Hostname, a.Interface, a.VRF)
+}
+
+// fleetPolicy says which cross-VRF overlaps are findings. Address space is
+// reused across customer VRFs in an MPLS VPN, so only VRFs the operator
+// declares disjoint are compared:
+//
+//	-disjoint-vrfs "TELEPROT,SCADA,default;CORP,MGMT"
+//
+// groups separated by ";", and no two VRFs of a group may overlap.
+// -shared-ranges "10.255.0.0/16" lists ranges that may appear in any of
+// them (shared services, NAT pools).
+type fleetPolicy struct {
+	disjoint map[[2]string]bool // both orders of every declared pair
+	shared   []netip.Prefix
+}
+
+// parseFleetPolicy parses -disjoint-vrfs and -shared-ranges; nil = no
+// overlaps reported
+func parseFleetPolicy(disjoint, shared string) (*fleetPolicy, error) {
+	if strings.TrimSpace(disjoint) == "" {
+		return nil, nil
+	}
+	p := &fleetPolicy{disjoint: make(map[[2]string]bool)}
+	for _, group := range strings.Split(disjoint, ";") {
+		var vrfs []string
+		for _, v := range strings.Split(group, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				vrfs = append(vrfs, v)
+			}
+		}
+		if len(vrfs) == 1 {
+			return nil, fmt.Errorf("group %q names one VRF, at least two are needed", strings.TrimSpace(group))
+		}
+		for i, a := range vrfs {
+			for _, b := range vrfs[i+1:] {
+				p.disjoint[[2]string{a, b}], p.disjoint[[2]string{b, a}] = true, true
+			}
+		}
+	}
+	for _, r := range strings.Split(shared, ",") {
+		if r = strings.TrimSpace(r); r == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(r)
+		if err != nil {
+			return nil, fmt.Errorf("shared range %q: %v", r, err)
+		}
+		p.shared = append(p.shared, prefix.Masked())
+	}
+	return p, nil
+}
+
+// mustNotOverlap reports whether a and b are a declared disjoint pair and
+// neither lies in a shared range
+func (p *fleetPolicy) mustNotOverlap(a, b ifAddress) bool {
+	if p == nil || !p.disjoint[[2]string{a.VRF, b.VRF}] {
+		return false
+	}
+	for _, r := range p.shared {
+		if r.Overlaps(a.Prefix) && r.Bits() <= a.Prefix.Bits() || r.Overlaps(b.Prefix) && r.Bits() <= b.Prefix.Bits() {
+			return false
+		}
+	}
+	return true
+}
+
+// configInterfaceVRFs returns interface -> VRF from a running-config:
+// "vrf NAME" (IOS-XR), "vrf forwarding NAME" and "ip vrf forwarding NAME"
+// (IOS-XE) under the interface
+func configInterfaceVRFs(config string) map[string]string {
+	vrfs := make(map[string]string)
+	iface := ""
+	for _, line := range strings.Split(config, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !strings.HasPrefix(line, " ") {
+			iface = ""
+			if rest, ok := strings.CutPrefix(line, "interface "); ok {
+				iface = strings.TrimSpace(rest)
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		if iface == "" || len(fields) < 2 {
+			continue
+		}
+		switch {
+		case len(fields) == 2 && fields[0] == "vrf":
+			vrfs[iface] = fields[1]
+		case len(fields) == 3 && fields[0] == "vrf" && fields[1] == "forwarding":
+			vrfs[iface] = fields[2]
+		case len(fields) == 4 && fields[0] == "ip" && fields[1] == "vrf" && fields[2] == "forwarding":
+			vrfs[iface] = fields[3]
+		}
+	}
+	return vrfs
+}
+
+// analyzeFleet cross-checks VRF and interface data from every device in a
+// run; overlaps are reported only between the VRFs policy declares disjoint
+func analyzeFleet(results []*DeviceResult, policy *fleetPolicy) []FleetFinding {
+	var findings []FleetFinding
+
+	// RD -> VRF name -> hosts
+	rdUsers := make(map[string]map[string][]string)
+	var addrs []ifAddress
+
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		host := r.Device.Hostname
+		prefixes := make(map[string]netip.Prefix) // interface -> prefix from "show interfaces"
+		vrfs := make(map[string]string)           // interface -> VRF from "show ipv4 interface brief"
+		configVRFs := make(map[string]string)     // interface -> VRF from the running-config (IOS-XE)
+		hostIPs := make(map[string]netip.Addr)    // interface -> address from brief output
+
+		for _, e := range r.Results {
+			cmd := strings.ToLower(e.Command)
+			switch {
+			case isVRFCommand(cmd):
+				for _, v := range parseVRFTable(e.Output) {
+					if v.RD == "" {
+						continue
+					}
+					if rdUsers[v.RD] == nil {
+						rdUsers[v.RD] = make(map[string][]string)
+					}
+					rdUsers[v.RD][v.Name] = append(rdUsers[v.RD][v.Name], host)
+				}
+			case isFullRunningConfig(cmd):
+				configVRFs = configInterfaceVRFs(e.Output)
+			case isShowInterfacesDetail(cmd):
+				for _, i := range parseShowInterfaces(e.Output) {
+					if p, err := netip.ParsePrefix(i.IPAddress); err == nil {
+						prefixes[i.Name] = p
+					}
+				}
+			case strings.Contains(cmd, "interface brief") && (strings.Contains(cmd, "ipv4") || strings.Contains(cmd, " ip ")):
+				for _, line := range strings.Split(e.Output, "\n") {
+					fields := strings.Fields(line)
+					if len(fields) < 2 {
+						continue
+					}
+					ip, err := netip.ParseAddr(fields[1])
+					if err != nil {
+						continue
+					}
+					hostIPs[fields[0]] = ip
+					// IOS-XR prints the VRF as the 5th column
+					if len(fields) == 5 {
+						vrfs[fields[0]] = fields[4]
+					}
+				}
+			}
+		}
+
+		for name, ip := range hostIPs {
+			p, ok := prefixes[name]
+			if !ok || p.Addr() != ip {
+				p = netip.PrefixFrom(ip, ip.BitLen())
+			}
+			addrs = append(addrs, ifAddress{Hostname: host, Interface: name, VRF: interfaceVRF(name, vrfs, configVRFs), Prefix: p})
+		}
+		for name, p := range prefixes {
+			if _, ok := hostIPs[name]; !ok {
+				addrs = append(addrs, ifAddress{Hostname: host, Interface: name, VRF: interfaceVRF(name, vrfs, configVRFs), Prefix: p})
+			}
+		}
+	}
+
+	// Duplicate RD: one RD used by more than one VRF name
+	var rds []string
+	for rd := range rdUsers {
+		rds = append(rds, rd)
+	}
+	sort.Strings(rds)
+	for _, rd := range rds {
+		users := rdUsers[rd]
+		if len(users) < 2 {
+			continue
+		}
+		var parts []string
+		for name, hosts := range users {
+			parts = append(parts, fmt.Sprintf("%s on %s", name, strings.Join(hosts, "/")))
+		}
+		sort.Strings(parts)
+		findings = append(findings, FleetFinding{
+			Severity: "CRITICAL",
+			Kind:     "DUPLICATE_RD",
+			Detail:   fmt.Sprintf("RD %s used by different VRFs: %s", rd, strings.Join(parts, "; ")),
+		})
+	}
+
+	sort.Slice(addrs, func(i, j int) bool {
+		if addrs[i].Hostname != addrs[j].Hostname {
+			return addrs[i].Hostname < addrs[j].Hostname
+		}
+		return addrs[i].Interface < addrs[j].Interface
+	})
+
+	for i := 0; i < len(addrs); i++ {
+		for j := i + 1; j < len(addrs); j++ {
+			a, b := addrs[i], addrs[j]
+			switch {
+			case a.Prefix.Addr() == b.Prefix.Addr() && a.VRF == b.VRF:
+				sev := "WARN"
+				if isLoopback(a.Interface) || isLoopback(b.Interface) {
+					sev = "CRITICAL"
+				}
+				findings = append(findings, FleetFinding{
+					Severity: sev,
+					Kind:     "DUPLICATE_IP",
+					Detail:   fmt.Sprintf("%s configured on %s and %s", a.Prefix.Addr(), a, b),
+				})
+			case a.VRF != b.VRF && a.Prefix.Overlaps(b.Prefix) && policy.mustNotOverlap(a, b):
+				findings = append(findings, FleetFinding{
+					Severity: "WARN",
+					Kind:     "OVERLAP",
+					Detail:   fmt.Sprintf("%s on %s overlaps %s on %s", a.Prefix.Masked(), a, b.Prefix.Masked(), b),
+				})
+			}
+		}
+	}
+
+	return findings
+}
+
+// interfaceVRF is the VRF of an interface: the brief output's, the
+// running-config's, else the global table
+func interfaceVRF(name string, brief, config map[string]string) string {
+	if vrf := brief[name]; vrf != "" {
+		return vrf
+	}
+	if vrf := config[name]; vrf != "" {
+		return vrf
+	}
+	return "default"
+}
+
+func isLoopback(ifName string) bool {
+	return strings.HasPrefix(strings.ToLower(ifName), "lo")
+}
+
+// WriteFleetFindings writes the fleet analyzer report next to the run summary
+func (w *OutputWriter) WriteFleetFindings(findings []FleetFinding) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("FLEET_FINDINGS_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Fleet Findings (duplicate RD / IP, overlapping subnets)\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, "================================================================================\n\n")
+
+	if len(findings) == 0 {
+		fmt.Fprintf(file, " No duplicate RDs, duplicate IPs or overlaps between disjoint VRFs found.\n")
+		return nil
+	}
+	for _, f := range findings {
+		fmt.Fprintf(file, "%-9s %-13s %s\n", f.Severity, f.Kind, f.Detail)
+	}
+	fmt.Fprintf(file, "\n Total findings: %d\n", len(findings))
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// xePE is an IOS-XE PE with one customer VRF interface
+func xePE(host, vrf, addr string) *DeviceResult {
+	return &DeviceResult{Device: DeviceInfo{Hostname: host}, Success: true, Results: []ExecutionResult{
+		{Command: "show ip interface brief", Output: "Interface              IP-Address      OK? Method Status                Protocol\n" +
+			"GigabitEthernet0/0/1   " + addr + "       YES NVRAM  up                    up\n"},
+		{Command: "show running-config", Output: "!\ninterface GigabitEthernet0/0/1\n description CUST\n vrf forwarding " + vrf +
+			"\n ip address " + addr + " 255.255.255.252\n!\n"},
+	}}
+}
+
+func TestAnalyzeFleetVRFs(t *testing.T) {
+	policy, err := parseFleetPolicy("SCADA,CORP", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		results []*DeviceResult
+		policy  *fleetPolicy
+		want    []string // finding kinds
+	}{
+		{"same /30 in two customer VRFs", []*DeviceResult{xePE("PE1", "CUST_A", "10.9.9.1"), xePE("PE2", "CUST_B", "10.9.9.1")}, policy, nil},
+		{"same address in one VRF", []*DeviceResult{xePE("PE1", "CUST_A", "10.9.9.1"), xePE("PE2", "CUST_A", "10.9.9.1")}, policy, []string{"DUPLICATE_IP"}},
+		{"overlap between disjoint VRFs", []*DeviceResult{xePE("PE1", "SCADA", "10.9.9.1"), xePE("PE2", "CORP", "10.9.9.1")}, policy, []string{"OVERLAP"}},
+		{"overlap without a policy", []*DeviceResult{xePE("PE1", "SCADA", "10.9.9.1"), xePE("PE2", "CORP", "10.9.9.1")}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range analyzeFleet(tt.results, tt.policy) {
+				got = append(got, f.Kind)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("findings %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFleetPolicySharedRanges(t *testing.T) {
+	policy, err := parseFleetPolicy("SCADA,CORP", "10.9.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := analyzeFleet([]*DeviceResult{xePE("PE1", "SCADA", "10.9.9.1"), xePE("PE2", "CORP", "10.9.9.1")}, policy); len(f) != 0 {
+		t.Errorf("overlap inside a shared range reported: %v", f)
+	}
+	if _, err := parseFleetPolicy("SCADA", ""); err == nil {
+		t.Error("a group of one VRF was accepted")
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// FLOW CACHE (FLOWS_<ts>.csv) AND PRE/POST TRAFFIC CHECK
+// ============================================================================
+//
+// BGP sessions and routes can all come back after a cutover while the
+// traffic of a VRF still goes nowhere. With -flow-monitor NAME each run adds
+//
+//   show flow monitor NAME cache format csv
+//
+// to the IOS-XR and IOS-XE command sets and writes FLOWS_<ts>.csv: per
+// device and input VRF the cached flows, packets, bytes and destination
+// addresses. With -critical-vrfs only those VRFs are recorded. The flow
+// record of the monitor must carry the input VRF (IOS-XE "match routing vrf
+// input"); flows without it are counted under VRF "unknown".
+//
+// comparePhases then checks the traffic VRF by VRF over all devices, since
+// after a migration the flows are expected on other PEs:
+//
+//   FAIL  VRF had flows before, none after
+//   WARN  fewer than half of the destinations seen before are seen again
+//   PASS  flows present after, the reason says when they moved PEs
+//
+// The cache is a sample of the last minutes of traffic: a VRF that was
+// quiet before is not checked, and VRFs new after the cutover are ignored.
+
+const (
+	flowCommand         = "flow monitor cache"
+	flowBaselinePrefix  = "FLOWS_"
+	flowBaselineCols    = "Hostname,VRF,Flows,Packets,Bytes,Destinations"
+	flowMaxDestinations = 100 // destinations kept per device and VRF
+)
+
+var (
+	flowCmdRe     = regexp.MustCompile(`^show flow monitor (\S+) cache\b`)
+	flowVRFNameRe = regexp.MustCompile(`\(([^)\s]+)\)`)
+	flowNormRe    = regexp.MustCompile(`[^A-Z0-9]`)
+)
+
+// flowCacheCommands are the flow cache commands of -flow-monitor NAME
+func flowCacheCommands(monitor string) []string {
+	return []string{fmt.Sprintf("show flow monitor %s cache format csv", monitor)}
+}
+
+func addFlowCacheCommands(cs *CommandSet, monitor string) {
+	cs.IOSXR = mergeCommands(cs.IOSXR, flowCacheCommands(monitor))
+	cs.IOSXE = mergeCommands(cs.IOSXE, flowCacheCommands(monitor))
+}
+
+// FlowVRF is the cached traffic of one VRF on one device
+type FlowVRF struct {
+	VRF          string
+	Flows        int
+	Packets      int64
+	Bytes        int64
+	Destinations []string
+}
+
+// flowColumns are the csv columns the check reads; -1 when absent
+type flowColumns struct {
+	dst, vrf, bytes, pkts int
+}
+
+// findFlowColumns maps a csv header of either platform ("IPV4 DST ADDR",
+// "IPV4DstAddr", "IP VRF ID INPUT", "InputVRFID", "bytes long",
+// "ByteCount", ...) to the columns; ok when it names a destination
+func findFlowColumns(header []string) (flowColumns, bool) {
+	c := flowColumns{-1, -1, -1, -1}
+	vrfInput := false
+	for i, h := range header {
+		n := flowNormRe.ReplaceAllString(strings.ToUpper(h), "")
+		switch {
+		case c.dst < 0 && (strings.Contains(n, "DSTADDR") || strings.Contains(n, "DESTADDR")):
+			c.dst = i
+		case strings.Contains(n, "VRF"):
+			// the input VRF wins over the output VRF
+			if c.vrf < 0 || (!vrfInput && strings.Contains(n, "INPUT")) {
+				c.vrf, vrfInput = i, strings.Contains(n, "INPUT")
+			}
+		case c.bytes < 0 && strings.Contains(n, "BYTE"):
+			c.bytes = i
+		case c.pkts < 0 && (strings.Contains(n, "PKT") || strings.Contains(n, "PACKET")):
+			c.pkts = i
+		}
+	}
+	return c, c.dst >= 0
+}
+
+// flowVRFName reads a VRF cell: "1 (CUST)" and "CUST" are CUST, "0" and
+// "default" the global table
+func flowVRFName(cell string) string {
+	cell = strings.TrimSpace(cell)
+	if m := flowVRFNameRe.FindStringSubmatch(cell); m != nil {
+		cell = m[1]
+	}
+	switch {
+	case cell == "":
+		return "unknown"
+	case cell == "0" || strings.EqualFold(cell, "default"):
+		return "default"
+	}
+	return cell
+}
+
+// parseFlowCache sums the flow cache output of a device per VRF
+func parseFlowCache(output string) []FlowVRF {
+	var cols flowColumns
+	width := 0
+	byVRF := make(map[string]*FlowVRF)
+	dests := make(map[string]map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.Contains(line, ",") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if width == 0 {
+			if c, ok := findFlowColumns(fields); ok {
+				cols, width = c, len(fields)
+			}
+			continue
+		}
+		if len(fields) != width || !isIPAddress(strings.TrimSpace(fields[cols.dst])) {
+			continue
+		}
+		vrf := "unknown"
+		if cols.vrf >= 0 {
+			vrf = flowVRFName(fields[cols.vrf])
+		}
+		f, ok := byVRF[vrf]
+		if !ok {
+			f = &FlowVRF{VRF: vrf}
+			byVRF[vrf] = f
+			dests[vrf] = make(map[string]bool)
+		}
+		f.Flows++
+		if cols.bytes >= 0 {
+			n, _ := strconv.ParseInt(strings.TrimSpace(fields[cols.bytes]), 10, 64)
+			f.Bytes += n
+		}
+		if cols.pkts >= 0 {
+			n, _ := strconv.ParseInt(strings.TrimSpace(fields[cols.pkts]), 10, 64)
+			f.Packets += n
+		}
+		dests[vrf][strings.TrimSpace(fields[cols.dst])] = true
+	}
+
+	var out []FlowVRF
+	for vrf, f := range byVRF {
+		for d := range dests[vrf] {
+			f.Destinations = append(f.Destinations, d)
+		}
+		sort.Strings(f.Destinations)
+		if len(f.Destinations) > flowMaxDestinations {
+			f.Destinations = f.Destinations[:flowMaxDestinations]
+		}
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].VRF < out[j].VRF })
+	return out
+}
+
+// deviceFlows reads the flow cache of a device's results; ok is false when
+// the cache was not collected
+func deviceFlows(results []ExecutionResult) ([]FlowVRF, bool) {
+	for _, e := range results {
+		if flowCmdRe.MatchString(e.Command) && !isCommandRejected(e.Output) && !isIncompleteOutput(e.Output) {
+			return parseFlowCache(e.Output), true
+		}
+	}
+	return nil, false
+}
+
+// WriteFlows writes FLOWS_<ts>.csv when the run collected flow caches;
+// critical limits it to those VRFs when set. A device whose cache was
+// read empty gets a row with VRF "-", so the comparison knows it was
+// collected.
+func (w *OutputWriter) WriteFlows(results []*DeviceResult, critical string) error {
+	keep := make(map[string]bool)
+	for _, v := range strings.Split(critical, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			keep[strings.ToUpper(v)] = true
+		}
+	}
+	rows := [][]string{strings.Split(flowBaselineCols, ",")}
+	collected := false
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		flows, ok := deviceFlows(r.Results)
+		if !ok {
+			continue
+		}
+		collected = true
+		n := len(rows)
+		for _, f := range flows {
+			if len(keep) > 0 && !keep[strings.ToUpper(f.VRF)] {
+				continue
+			}
+			rows = append(rows, []string{r.Device.Hostname, f.VRF, strconv.Itoa(f.Flows),
+				strconv.FormatInt(f.Packets, 10), strconv.FormatInt(f.Bytes, 10), strings.Join(f.Destinations, " ")})
+		}
+		if len(rows) == n {
+			rows = append(rows, []string{r.Device.Hostname, "-", "0", "0", "0", ""})
+		}
+	}
+	if !collected {
+		return nil
+	}
+	return writeCSVRows(filepath.Join(w.dir, fmt.Sprintf("%s%s.csv", flowBaselinePrefix, w.timestamp)), rows)
+}
+
+// flowTotal is the traffic of one VRF over all devices of a run
+type flowTotal struct {
+	Flows        int
+	Hosts        []string
+	Destinations map[string]bool
+}
+
+// loadFlowBaseline reads the flows csv of a run into totals per VRF; nil
+// when the run has none
+func loadFlowBaseline(dir string) (map[string]*flowTotal, error) {
+	rows, _, err := latestRunCSV(dir, flowBaselinePrefix, 6)
+	if rows == nil || err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]*flowTotal)
+	for _, rec := range rows {
+		if rec[1] == "-" {
+			continue
+		}
+		flows, _ := strconv.Atoi(rec[2])
+		if flows == 0 {
+			continue
+		}
+		t, ok := totals[rec[1]]
+		if !ok {
+			t = &flowTotal{Destinations: make(map[string]bool)}
+			totals[rec[1]] = t
+		}
+		t.Flows += flows
+		t.Hosts = append(t.Hosts, rec[0])
+		for _, d := range strings.Fields(rec[5]) {
+			t.Destinations[d] = true
+		}
+	}
+	for _, t := range totals {
+		sort.Strings(t.Hosts)
+	}
+	return totals, nil
+}
+
+// describe is "N flows on HOST,HOST"
+func (t *flowTotal) describe() string {
+	if t == nil {
+		return "no flows"
+	}
+	return fmt.Sprintf("%d flows on %s", t.Flows, strings.Join(t.Hosts, ","))
+}
+
+// compareFlows returns the per-VRF traffic findings between two runs
+func compareFlows(pre, post map[string]*flowTotal) []PhaseDelta {
+	var vrfs []string
+	for v := range pre {
+		vrfs = append(vrfs, v)
+	}
+	sort.Strings(vrfs)
+
+	var deltas []PhaseDelta
+	for _, v := range vrfs {
+		before, after := pre[v], post[v]
+		d := PhaseDelta{
+			goldenKey: goldenKey{Host: "ALL", Command: flowCommand, Metric: "VRF " + v},
+			Pre:       before.describe(), Post: after.describe(), Status: "PASS",
+		}
+		if after == nil {
+			d.Status, d.Reason = "FAIL", "VRF had flows before the cutover and has none after"
+			deltas = append(deltas, d)
+			continue
+		}
+		var reasons []string
+		if strings.Join(before.Hosts, ",") != strings.Join(after.Hosts, ",") {
+			reasons = append(reasons, fmt.Sprintf("flows moved from %s to %s",
+				strings.Join(before.Hosts, ","), strings.Join(after.Hosts, ",")))
+		}
+		seen := 0
+		for dst := range before.Destinations {
+			if after.Destinations[dst] {
+				seen++
+			}
+		}
+		if n := len(before.Destinations); seen*2 < n {
+			d.Status = "WARN"
+			reasons = append(reasons, fmt.Sprintf("only %d of %d destinations seen before are seen again", seen, n))
+		}
+		d.Reason = strings.Join(reasons, "; ")
+		deltas = append(deltas, d)
+	}
+	return deltas
+}
+
+// compareFlowRuns loads and compares the flow caches of two runs; nothing
+// is compared when either run has none
+func compareFlowRuns(preDir, postDir string) []PhaseDelta {
+	pre, err1 := loadFlowBaseline(preDir)
+	post, err2 := loadFlowBaseline(postDir)
+	if runCheckSkipped("Flow cache", "", err1, err2, pre != nil, post != nil) {
+		return nil
+	}
+	return compareFlows(pre, post)
+}
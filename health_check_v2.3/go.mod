@@ -0,0 +1,7 @@
+module github.com/dyanland/network-automation-lab/health_check_v2.3
+
+go 1.24.0
+
+require golang.org/x/crypto v0.45.0
+
+require golang.org/x/sys v0.38.0 // indirect
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// GO/NO-GO DECISION (GO_NO_GO_<ts>.log)
+// ============================================================================
+//
+// The roll-up says which devices failed; the change advisory board asks
+// whether the change may go ahead, and weighs a lost teleprotection ping on
+// a core PE differently from a warning on an access switch. Every run scores
+// its validation results (those of the roll-up, see rollup.go):
+//
+//   weight = check weight x role weight x critical VRF weight
+//
+// A result earns its full weight when it passes, half when it needs a look
+// (WARN) and nothing when it fails; the readiness score is the share of the
+// total weight earned, 0-100. Checks weigh 1, except connection and
+// critical-vrf (5) and ping and profile (2); a result in a critical VRF
+// (-critical-vrfs) weighs 2 more times, roles 1. The -thresholds file sets
+// the weights per check, critical VRF priority and role, and the go_score a
+// GO needs (90 by default).
+//
+// A failure in a critical VRF, or any failure of a device whose role is
+// blocking in the -thresholds file, blocks: the verdict is NO-GO whatever
+// the score. Otherwise the run is GO when the score reaches go_score. The
+// report lists the blocking items, the score lost per check and the
+// results that cost the most.
+
+const (
+	goDefaultScore  = 90
+	goCriticalVRF   = 2 // weight of a result in a critical VRF
+	goNoGoMaxLosses = 15
+)
+
+// goCheckWeights are the built-in check weights; other checks weigh 1
+var goCheckWeights = map[string]float64{"connection": 5, "critical-vrf": 5, "ping": 2, "profile": 2}
+
+// GoNoGoItem is one scored validation result
+type GoNoGoItem struct {
+	Result   ValidationResult
+	Role     string
+	Weight   float64
+	Lost     float64 // weight not earned
+	Blocking string  // why it forces NO-GO, "" = it does not
+}
+
+// GoNoGoCheck sums the items of one check
+type GoNoGoCheck struct {
+	Check                   string
+	Items, Pass, Warn, Fail int
+	Weight, Lost            float64
+}
+
+// GoNoGo is the decision of one run
+type GoNoGo struct {
+	Verdict  string // GO, NO-GO
+	Score    float64
+	MinScore float64
+	Reasons  []string
+	Checks   []GoNoGoCheck
+	Blocking []GoNoGoItem
+	Losses   []GoNoGoItem // largest first
+}
+
+// checkWeight is the Go/No-Go weight of a check; nil-safe
+func (t *thresholdSet) checkWeight(check string) float64 {
+	if t != nil {
+		if w, ok := t.weights[check]; ok {
+			return w
+		}
+	}
+	if w, ok := goCheckWeights[check]; ok {
+		return w
+	}
+	return 1
+}
+
+// priorityWeight is the Go/No-Go weight of a critical VRF priority
+func (t *thresholdSet) priorityWeight(priority int) float64 {
+	if t != nil {
+		if p, ok := t.priorities[priority]; ok && p.weight >= 0 {
+			return p.weight
+		}
+	}
+	return goCriticalVRF
+}
+
+// roleWeight is the Go/No-Go weight of a device and whether its failures
+// block
+func (t *thresholdSet) roleWeight(d DeviceInfo) (float64, bool) {
+	r := t.role(d)
+	if r == nil {
+		return 1, false
+	}
+	if r.weight >= 0 {
+		return r.weight, r.blocking
+	}
+	return 1, r.blocking
+}
+
+// goScore is the readiness score a GO needs
+func (t *thresholdSet) goScore() float64 {
+	if t == nil {
+		return goDefaultScore
+	}
+	return t.GoScore
+}
+
+// resultVRF is the VRF a validation result is about, "" for none
+func resultVRF(res ValidationResult) string {
+	switch res.Check {
+	case "critical-vrf":
+		return res.Item
+	case "ping":
+		if vrf, _, ok := strings.Cut(res.Item, "/"); ok {
+			return vrf
+		}
+	}
+	return ""
+}
+
+// decideGoNoGo scores the validation results of a run; criticalVRFs is
+// the -critical-vrfs list, highest priority first
+func decideGoNoGo(v *validationSet, criticalVRFs string, limits *thresholdSet) GoNoGo {
+	priority := make(map[string]int)
+	for _, vrf := range strings.Split(criticalVRFs, ",") {
+		if vrf = strings.ToUpper(strings.TrimSpace(vrf)); vrf != "" {
+			priority[vrf] = len(priority) + 1
+		}
+	}
+
+	g := GoNoGo{MinScore: limits.goScore()}
+	byCheck := make(map[string]*GoNoGoCheck)
+	var total, lost float64
+	var items []GoNoGoItem
+	for _, res := range v.rows {
+		d := v.devices[res.Hostname]
+		roleWeight, blockingRole := limits.roleWeight(d)
+		it := GoNoGoItem{Result: res, Role: deviceRole(d), Weight: limits.checkWeight(res.Check) * roleWeight}
+		prio := priority[strings.ToUpper(resultVRF(res))]
+		if prio > 0 {
+			it.Weight *= limits.priorityWeight(prio)
+		}
+
+		c, ok := byCheck[res.Check]
+		if !ok {
+			c = &GoNoGoCheck{Check: res.Check}
+			byCheck[res.Check] = c
+		}
+		c.Items++
+		c.Weight += it.Weight
+		switch rollupStatus(res.Status) {
+		case "PASS":
+			c.Pass++
+		case "WARN":
+			c.Warn++
+			it.Lost = it.Weight / 2
+		default:
+			c.Fail++
+			it.Lost = it.Weight
+			switch {
+			case prio > 0:
+				it.Blocking = fmt.Sprintf("critical VRF %s (priority %d)", resultVRF(res), prio)
+			case blockingRole:
+				it.Blocking = "blocking role " + it.Role
+			}
+		}
+		c.Lost += it.Lost
+		total += it.Weight
+		lost += it.Lost
+		if it.Blocking != "" {
+			g.Blocking = append(g.Blocking, it)
+		}
+		if it.Lost > 0 {
+			items = append(items, it)
+		}
+	}
+
+	g.Score = 100
+	if total > 0 {
+		g.Score = 100 * (total - lost) / total
+		for _, c := range byCheck {
+			c.Lost = 100 * c.Lost / total
+		}
+		for i := range items {
+			items[i].Lost = 100 * items[i].Lost / total
+		}
+	}
+	for _, c := range byCheck {
+		g.Checks = append(g.Checks, *c)
+	}
+	sort.Slice(g.Checks, func(i, j int) bool {
+		if g.Checks[i].Lost != g.Checks[j].Lost {
+			return g.Checks[i].Lost > g.Checks[j].Lost
+		}
+		return g.Checks[i].Check < g.Checks[j].Check
+	})
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Lost > items[j].Lost })
+	if len(items) > goNoGoMaxLosses {
+		items = items[:goNoGoMaxLosses]
+	}
+	g.Losses = items
+
+	g.Verdict = "GO"
+	if len(g.Blocking) > 0 {
+		g.Verdict = "NO-GO"
+		g.Reasons = append(g.Reasons, fmt.Sprintf("%d blocking item(s)", len(g.Blocking)))
+	}
+	// Round as displayed, so a score shown as 90.0 passes a go_score of 90
+	if score := float64(int(g.Score*10+0.5)) / 10; score < g.MinScore {
+		g.Verdict = "NO-GO"
+		g.Reasons = append(g.Reasons, fmt.Sprintf("score %.1f below %g", g.Score, g.MinScore))
+	}
+	return g
+}
+
+// String is the one-line form,
+// "NO-GO, readiness 87.5 (GO needs 90): 1 blocking item(s)"
+func (g GoNoGo) String() string {
+	s := fmt.Sprintf("%s, readiness %.1f (GO needs %g)", g.Verdict, g.Score, g.MinScore)
+	if len(g.Reasons) > 0 {
+		s += ": " + strings.Join(g.Reasons, ", ")
+	}
+	return s
+}
+
+// WriteGoNoGo writes GO_NO_GO_<ts>.log
+func (w *OutputWriter) WriteGoNoGo(g GoNoGo) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("GO_NO_GO_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Go/No-Go Decision\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, " Verdict: %s\n", g)
+	fmt.Fprintf(file, "================================================================================\n\n")
+
+	fmt.Fprintf(file, "Blocking items:\n\n")
+	if len(g.Blocking) == 0 {
+		fmt.Fprintf(file, "  none\n")
+	} else {
+		table := newTextTable("HOSTNAME", "ROLE", "CHECK", "ITEM", "STATUS", "BLOCKS AS")
+		for _, it := range g.Blocking {
+			res := it.Result
+			table.add(hostSite(res.Hostname), displayHost(res.Hostname), it.Role, res.Check, orDash(res.Item), res.Status, it.Blocking)
+			if detail := strings.TrimSpace(strings.Join([]string{res.Value, res.Detail}, " ")); detail != "" {
+				table.note("    %s", detail)
+			}
+		}
+		table.write(file)
+	}
+	fmt.Fprintln(file)
+
+	fmt.Fprintf(file, "Score by check (LOST = readiness points lost):\n\n")
+	table := newTextTable("CHECK", "ITEMS", "PASS", "WARN", "FAIL", "WEIGHT", "LOST").alignRight(1, 2, 3, 4, 5, 6)
+	for _, c := range g.Checks {
+		table.add("", c.Check, c.Items, c.Pass, c.Warn, c.Fail, fmt.Sprintf("%.1f", c.Weight), fmt.Sprintf("%.1f", c.Lost))
+	}
+	table.write(file)
+	fmt.Fprintln(file)
+
+	fmt.Fprintf(file, "Largest deductions:\n\n")
+	if len(g.Losses) == 0 {
+		fmt.Fprintf(file, "  none\n")
+		return nil
+	}
+	table = newTextTable("HOSTNAME", "ROLE", "CHECK", "ITEM", "STATUS", "WEIGHT", "LOST").alignRight(5, 6)
+	for _, it := range g.Losses {
+		res := it.Result
+		table.add(hostSite(res.Hostname), displayHost(res.Hostname), it.Role, res.Check, orDash(res.Item), res.Status,
+			fmt.Sprintf("%.1f", it.Weight), fmt.Sprintf("%.1f", it.Lost))
+	}
+	table.write(file)
+	return nil
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// GOLDEN LAB RUN - regression check of lab rehearsals against a reference run
+// ============================================================================
+//
+//   -golden-mark <run_dir>      copy the run's SUMMARY csv to <output>/golden
+//   -golden-compare <run_dir>   compare a later rehearsal against it
+//
+// Every check of the golden run must be present in the rehearsal. Numeric
+// metrics within -golden-tolerance percent pass; outside it they count as
+// IMPROVED or DEGRADED depending on whether higher is better for the metric.
+
+const (
+	goldenDirName  = "golden"
+	goldenSummary  = "SUMMARY_golden.csv"
+	goldenInfoFile = "GOLDEN.txt"
+)
+
+// goldenIgnored metrics differ on every run by nature (uptime, traffic
+// rates), or are judged by their own pre/post check (traceroute paths and
+// flow caches, see trace_paths.go and flow_cache.go)
+var goldenIgnored = map[string]bool{"Uptime": true, "Trace_Hops": true, "Trace_Reached": true, "Flow_Entries": true,
+	"Input_Rate_bps": true, "Output_Rate_bps": true}
+
+// goldenDirection returns -1 when lower is better, +1 when higher is better
+// and 0 for informational metrics that only need to stay within tolerance.
+func goldenDirection(metric string) int {
+	// CPU and memory follow the traffic (snmp_poll.go)
+	if strings.HasPrefix(metric, "CPU_") || strings.HasPrefix(metric, "Memory_") {
+		return 0
+	}
+	for _, s := range []string{"Down", "Error", "Drops", "RTT_"} {
+		if strings.Contains(metric, s) {
+			return -1
+		}
+	}
+	switch metric {
+	case "OutputLines", "Ping_Attempts", "Ping_Sent", "Interfaces_Total", "VRF_Count":
+		return 0
+	}
+	return 1
+}
+
+// goldenKey identifies one check: the metric of a command on a host
+type goldenKey struct {
+	Host, Command, Metric string
+}
+
+// loadGoldenCSV reads a SUMMARY csv keeping command and metric apart
+func loadGoldenCSV(filename string) (map[goldenKey]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[goldenKey]string)
+	for i, record := range records {
+		if i == 0 || len(record) < 9 {
+			continue
+		}
+		data[goldenKey{record[2], record[6], record[7]}] = record[8]
+	}
+	return data, nil
+}
+
+// markGoldenRun stores a copy of the run's summary so later cleanup of the
+// run directory does not lose the reference.
+func markGoldenRun(runDir, outputDir string) error {
+	src := findCSVFile(resolveRunDir(runDir))
+	if src == "" {
+		return fmt.Errorf("no SUMMARY csv in %s", runDir)
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(outputDir, goldenDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, goldenSummary), data); err != nil {
+		return err
+	}
+	info := fmt.Sprintf("Source: %s\nMarked: %s\n", src, time.Now().Format("2006-01-02 15:04:05"))
+	if err := writeFileAtomic(filepath.Join(dir, goldenInfoFile), []byte(info)); err != nil {
+		return err
+	}
+	log.Printf("✓ Golden lab run set: %s", src)
+	return nil
+}
+
+// GoldenFinding is one check of the golden run against a rehearsal
+type GoldenFinding struct {
+	goldenKey
+	Golden, Actual string
+	Status         string // PASS, MISSING, NEW, CHANGED, IMPROVED, DEGRADED
+}
+
+// compareGolden checks every golden value against the run; tolerance is in percent
+func compareGolden(golden, run map[goldenKey]string, tolerance float64) []GoldenFinding {
+	keys := make(map[goldenKey]bool)
+	for k := range golden {
+		keys[k] = true
+	}
+	for k := range run {
+		keys[k] = true
+	}
+	var sorted []goldenKey
+	for k := range keys {
+		if !goldenIgnored[k.Metric] {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Command != b.Command {
+			return a.Command < b.Command
+		}
+		return a.Metric < b.Metric
+	})
+
+	var findings []GoldenFinding
+	for _, k := range sorted {
+		g, inGolden := golden[k]
+		a, inRun := run[k]
+		f := GoldenFinding{goldenKey: k, Golden: g, Actual: a, Status: "PASS"}
+		switch {
+		case k.Command == "CONNECTION" && inRun && !inGolden:
+			f.Status = "DEGRADED"
+		case k.Command == "CONNECTION" && inGolden && !inRun:
+			f.Status = "IMPROVED"
+		case !inRun:
+			f.Status = "MISSING"
+		case !inGolden:
+			f.Status = "NEW"
+		case g != a:
+			f.Status = goldenValueStatus(k.Metric, g, a, tolerance)
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+func goldenValueStatus(metric, golden, actual string, tolerance float64) string {
+	if metric == "Captured" {
+		if actual == "Yes" {
+			return "IMPROVED"
+		}
+		return "DEGRADED"
+	}
+	g, err1 := strconv.ParseFloat(golden, 64)
+	a, err2 := strconv.ParseFloat(actual, 64)
+	if err1 != nil || err2 != nil {
+		return "CHANGED"
+	}
+	allowed := math.Abs(g) * tolerance / 100
+	if math.Abs(a-g) <= allowed {
+		return "PASS"
+	}
+	switch dir := goldenDirection(metric); {
+	case dir == 0:
+		return "CHANGED"
+	case (a > g) == (dir > 0):
+		return "IMPROVED"
+	default:
+		return "DEGRADED"
+	}
+}
+
+// runGoldenComparison compares runDir against the golden run under outputDir
+// and writes GOLDEN_REGRESSION.txt; the verdict is returned for the console.
+func runGoldenComparison(runDir, outputDir string, tolerance float64) (string, string, error) {
+	goldenCSV := filepath.Join(outputDir, goldenDirName, goldenSummary)
+	golden, err := loadGoldenCSV(goldenCSV)
+	if err != nil {
+		return "", "", fmt.Errorf("no golden run (mark one with -golden-mark): %v", err)
+	}
+	runCSV := findCSVFile(resolveRunDir(runDir))
+	if runCSV == "" {
+		return "", "", fmt.Errorf("no SUMMARY csv in %s", runDir)
+	}
+	run, err := loadGoldenCSV(runCSV)
+	if err != nil {
+		return "", "", err
+	}
+	info, _ := os.ReadFile(filepath.Join(outputDir, goldenDirName, goldenInfoFile))
+
+	findings := compareGolden(golden, run, tolerance)
+	counts := make(map[string]int)
+	for _, f := range findings {
+		counts[f.Status]++
+	}
+	verdict := "UNCHANGED"
+	switch {
+	case counts["DEGRADED"]+counts["MISSING"] > 0 && counts["IMPROVED"] > 0:
+		verdict = "MIXED"
+	case counts["DEGRADED"]+counts["MISSING"] > 0:
+		verdict = "DEGRADED"
+	case counts["IMPROVED"] > 0:
+		verdict = "IMPROVED"
+	}
+
+	outputFile := filepath.Join(outputDir, "GOLDEN_REGRESSION.txt")
+	file, err := createAtomic(outputFile)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Lab Rehearsal vs Golden Run - Regression Report\n")
+	fmt.Fprintf(file, " Generated: %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, "================================================================================\n")
+	for _, line := range strings.Split(strings.TrimSpace(string(info)), "\n") {
+		if line != "" {
+			fmt.Fprintf(file, " Golden %s\n", line)
+		}
+	}
+	fmt.Fprintf(file, " Rehearsal: %s\n", runCSV)
+	fmt.Fprintf(file, " Tolerance: %g%%\n", tolerance)
+	fmt.Fprintf(file, " Verdict:   %s\n", verdict)
+	fmt.Fprintf(file, " PASS: %d | IMPROVED: %d | DEGRADED: %d | MISSING: %d | CHANGED: %d | NEW: %d\n",
+		counts["PASS"], counts["IMPROVED"], counts["DEGRADED"], counts["MISSING"], counts["CHANGED"], counts["NEW"])
+	fmt.Fprintf(file, "================================================================================\n")
+
+	host := ""
+	for _, f := range findings {
+		if f.Status == "PASS" {
+			continue
+		}
+		if f.Host != host {
+			host = f.Host
+			fmt.Fprintf(file, "\n=== %s ===\n", host)
+			fmt.Fprintf(file, "%-10s %-40s %-15s %-15s %s\n", "Status", "Metric", "Golden", "Rehearsal", "Command")
+			fmt.Fprintf(file, "--------------------------------------------------------------------------------\n")
+		}
+		fmt.Fprintf(file, "%-10s %-40s %-15s %-15s %s\n", f.Status, f.Metric, f.Golden, f.Actual, f.Command)
+	}
+	if counts["PASS"] == len(findings) {
+		fmt.Fprintf(file, "\nAll %d checks match the golden run.\n", len(findings))
+	}
+
+	fmt.Fprintf(file, "\n================================================================================\n")
+	fmt.Fprintf(file, " End of Regression Report\n")
+	fmt.Fprintf(file, "================================================================================\n")
+	return outputFile, verdict, nil
+}
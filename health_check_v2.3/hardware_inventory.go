@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// HARDWARE INVENTORY - slot records and chassis-swap diff
+// ============================================================================
+
+// HardwareRecord is one slot/module from show inventory + show platform
+type HardwareRecord struct {
+	Slot        string // 0/RSP0/CPU0, 0/0/CPU0, 0/FT0, R0, 0/0
+	Rack        string
+	PID         string
+	Serial      string
+	Description string
+	State       string
+}
+
+var (
+	invNameRe = regexp.MustCompile(`NAME:\s*"([^"]*)"\s*,\s*DESCR:\s*"([^"]*)"`)
+	invPIDRe  = regexp.MustCompile(`PID:\s*([^,]*?)\s*,\s*VID:\s*[^,]*?\s*,\s*SN:\s*(\S*)`)
+)
+
+// normalizeSlot maps inventory NAMEs and platform node names onto one key
+func normalizeSlot(name string) string {
+	s := strings.TrimSpace(name)
+	for _, prefix := range []string{"module ", "subslot ", "Module "} {
+		s = strings.TrimPrefix(s, prefix)
+	}
+	return s
+}
+
+func rackOf(slot string) string {
+	if i := strings.Index(slot, "/"); i > 0 {
+		return slot[:i]
+	}
+	if strings.HasPrefix(slot, "Rack ") {
+		return strings.TrimPrefix(slot, "Rack ")
+	}
+	return "0"
+}
+
+// parseShowInventory reads NAME/DESCR + PID/VID/SN pairs
+func parseShowInventory(output string) []HardwareRecord {
+	var records []HardwareRecord
+	var current *HardwareRecord
+	for _, line := range strings.Split(output, "\n") {
+		if m := invNameRe.FindStringSubmatch(line); m != nil {
+			slot := normalizeSlot(m[1])
+			records = append(records, HardwareRecord{Slot: slot, Rack: rackOf(slot), Description: m[2]})
+			current = &records[len(records)-1]
+			continue
+		}
+		if m := invPIDRe.FindStringSubmatch(line); m != nil && current != nil {
+			current.PID, current.Serial = m[1], m[2]
+			current = nil
+		}
+	}
+	return records
+}
+
+// parseShowPlatform reads the XR "Node Type State Config state" and XE
+// "Slot Type State Insert time" tables using the header column offsets.
+func parseShowPlatform(output string) map[string][2]string {
+	nodes := make(map[string][2]string)
+	typeCol, stateCol, endCol := -1, -1, -1
+	for _, line := range strings.Split(output, "\n") {
+		t := strings.TrimSpace(line)
+		if strings.HasPrefix(t, "Node") || strings.HasPrefix(t, "Slot") {
+			typeCol = strings.Index(line, "Type")
+			stateCol = strings.Index(line, "State")
+			endCol = strings.Index(line, "Config state")
+			if endCol < 0 {
+				endCol = strings.Index(line, "Insert time")
+			}
+			continue
+		}
+		if typeCol < 0 || stateCol < 0 || t == "" || strings.HasPrefix(t, "---") || len(line) <= stateCol {
+			continue
+		}
+		node := strings.TrimSpace(line[:typeCol])
+		typ := strings.TrimSpace(line[typeCol:stateCol])
+		state := line[stateCol:]
+		if endCol > stateCol && len(line) > endCol {
+			state = line[stateCol:endCol]
+		}
+		if node == "" || strings.Contains(node, " ") {
+			continue
+		}
+		nodes[normalizeSlot(node)] = [2]string{typ, strings.TrimSpace(state)}
+	}
+	return nodes
+}
+
+// collectHardware merges inventory and platform output of one device
+func collectHardware(results []ExecutionResult) []HardwareRecord {
+	var records []HardwareRecord
+	platform := make(map[string][2]string)
+	for _, e := range results {
+		cmd := strings.ToLower(e.Command)
+		switch {
+		case strings.HasPrefix(cmd, "show inventory"):
+			records = append(records, parseShowInventory(e.Output)...)
+		case strings.HasPrefix(cmd, "show platform"):
+			for k, v := range parseShowPlatform(e.Output) {
+				platform[k] = v
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i := range records {
+		if p, ok := platform[records[i].Slot]; ok {
+			records[i].State = p[1]
+		}
+		seen[records[i].Slot] = true
+	}
+	for slot, p := range platform {
+		if !seen[slot] {
+			records = append(records, HardwareRecord{Slot: slot, Rack: rackOf(slot), PID: strings.TrimSuffix(strings.Split(p[0], "(")[0], " "), State: p[1]})
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Rack != records[j].Rack {
+			return records[i].Rack < records[j].Rack
+		}
+		return records[i].Slot < records[j].Slot
+	})
+	return records
+}
+
+// WriteHardware writes HARDWARE_<ts>.csv with the slot records of every device
+func (w *OutputWriter) WriteHardware(results []*DeviceResult) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("HARDWARE_%s.csv", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "Hostname,Rack,Slot,PID,Serial,Description,State\n")
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		for _, h := range collectHardware(r.Results) {
+			fmt.Fprintf(file, "%s,%s,%s,%s,%s,%s,%s\n", r.Device.Hostname, csvField(h.Rack), csvField(h.Slot),
+				csvField(h.PID), csvField(h.Serial), csvField(h.Description), csvField(h.State))
+		}
+	}
+	return nil
+}
+
+func csvField(s string) string {
+	if strings.ContainsAny(s, ",\"\n") {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return s
+}
+
+// ----------------------------------------------------------------------------
+// Reading earlier runs back from their device logs
+// ----------------------------------------------------------------------------
+
+// resolveRunDir returns dir itself if it holds a run, else its latest run subdirectory
+func resolveRunDir(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return dir
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "SUMMARY_") {
+			return dir
+		}
+	}
+	latest := ""
+	for _, e := range entries {
+		if e.IsDir() && e.Name() > latest {
+			latest = e.Name()
+		}
+	}
+	if latest == "" {
+		return dir
+	}
+	return filepath.Join(dir, latest)
+}
+
+// loadRunLogs parses every <host>_<ts>.log in a run directory back into command results
+func loadRunLogs(dir string) (map[string][]ExecutionResult, error) {
+	dir = resolveRunDir(dir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	runs := make(map[string][]ExecutionResult)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".log") || isReportLog(name) {
+			continue
+		}
+		host, results, err := parseDeviceLog(filepath.Join(dir, name))
+		if err != nil || host == "" {
+			continue
+		}
+		runs[strings.ToUpper(host)] = results
+	}
+	return runs, nil
+}
+
+func isReportLog(name string) bool {
+	for _, prefix := range []string{"SUMMARY_", "PING_STATS_", "FLEET_FINDINGS_", "READINESS_", "RPL_AUDIT_", "RETRY_"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDeviceLog reads the layout written by WriteDevice
+func parseDeviceLog(path string) (string, []ExecutionResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	const rule = "--------------------------------------------------------------------------------"
+	host := ""
+	var results []ExecutionResult
+	var current *ExecutionResult
+	var body []string
+	// A rule only opens a section when " Command: " follows it, since
+	// command output (XR show platform) can contain the same rule
+	pendingRule, inHeader := false, false
+
+	flush := func() {
+		if current != nil {
+			out := strings.TrimRight(strings.Join(body, "\n"), "\n")
+			if out == "(no output)" {
+				out = ""
+			}
+			current.Output = out
+			results = append(results, *current)
+		}
+		current, body = nil, nil
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if pendingRule {
+			pendingRule = false
+			if strings.HasPrefix(line, " Command: ") {
+				flush()
+				current = &ExecutionResult{Hostname: host, Command: strings.TrimPrefix(line, " Command: ")}
+				inHeader = true
+				continue
+			}
+			if current != nil {
+				body = append(body, rule)
+			}
+		}
+		switch {
+		case host == "" && strings.HasPrefix(line, " Hostname:"):
+			host = strings.TrimSpace(strings.TrimPrefix(line, " Hostname:"))
+		case inHeader && line == rule:
+			inHeader = false
+		case inHeader && strings.HasPrefix(line, " Sampled: "):
+			current.Stamp, _ = parseSampleStamp(strings.TrimPrefix(line, " Sampled: "))
+		case line == rule:
+			pendingRule = true
+		case strings.HasPrefix(line, "================================================================================") && current != nil:
+			flush()
+		case current != nil:
+			body = append(body, line)
+		}
+	}
+	flush()
+	return host, results, scanner.Err()
+}
+
+// ----------------------------------------------------------------------------
+// Chassis swap diff
+// ----------------------------------------------------------------------------
+
+// loadHostPairs reads old_hostname,new_hostname migration pairs
+func loadHostPairs(filename string) ([][2]string, error) {
+	lines, err := readLines(filename)
+	if err != nil {
+		return nil, err
+	}
+	var pairs [][2]string
+	for _, l := range lines {
+		parts := strings.Split(l, ",")
+		if len(parts) < 2 || strings.EqualFold(strings.TrimSpace(parts[0]), "old_hostname") {
+			continue
+		}
+		pairs = append(pairs, [2]string{strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])})
+	}
+	return pairs, nil
+}
+
+// compareHardware writes the as-built hardware report for each migration
+// pair (pre host → post host); without pairs every host is paired with itself.
+func compareHardware(preDir, postDir, pairsFile, outputFile string) error {
+	pre, err := loadRunLogs(preDir)
+	if err != nil {
+		return fmt.Errorf("pre: %v", err)
+	}
+	post, err := loadRunLogs(postDir)
+	if err != nil {
+		return fmt.Errorf("post: %v", err)
+	}
+
+	var pairs [][2]string
+	if pairsFile != "" {
+		if pairs, err = loadHostPairs(pairsFile); err != nil {
+			return err
+		}
+	} else {
+		for h := range pre {
+			if _, ok := post[h]; ok {
+				pairs = append(pairs, [2]string{h, h})
+			}
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+	}
+
+	file, err := createAtomic(outputFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	csvFile, err := createAtomic(strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + ".csv")
+	if err != nil {
+		return err
+	}
+	defer csvFile.Close()
+
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO As-Built Hardware Report (chassis swap)\n")
+	fmt.Fprintf(file, " Generated: %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, " Pre:  %s\n Post: %s\n", resolveRunDir(preDir), resolveRunDir(postDir))
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(csvFile, "Pre_Hostname,Post_Hostname,Rack,Slot,Pre_PID,Pre_Serial,Post_PID,Post_Serial,Post_State,Status\n")
+
+	for _, pair := range pairs {
+		oldHW := collectHardware(pre[strings.ToUpper(pair[0])])
+		newHW := collectHardware(post[strings.ToUpper(pair[1])])
+		fmt.Fprintf(file, "\n=== %s → %s ===\n", pair[0], pair[1])
+		if len(oldHW) == 0 || len(newHW) == 0 {
+			fmt.Fprintf(file, " ⚠ show inventory missing (pre: %d records, post: %d records)\n", len(oldHW), len(newHW))
+		}
+
+		oldBySlot := make(map[string]HardwareRecord)
+		oldSerials := make(map[string]string)
+		for _, h := range oldHW {
+			oldBySlot[h.Slot] = h
+			if h.Serial != "" {
+				oldSerials[h.Serial] = h.Slot
+			}
+		}
+		newSlots := make(map[string]bool)
+
+		fmt.Fprintf(file, "%-4s %-16s %-20s %-13s %-20s %-13s %s\n", "RACK", "SLOT", "PRE_PID", "PRE_SN", "POST_PID", "POST_SN", "STATUS")
+		fmt.Fprintf(file, "--------------------------------------------------------------------------------\n")
+		row := func(rack, slot string, o, n HardwareRecord, status string) {
+			fmt.Fprintf(file, "%-4s %-16s %-20s %-13s %-20s %-13s %s\n", rack, slot,
+				orDash(o.PID), orDash(o.Serial), orDash(n.PID), orDash(n.Serial), status)
+			fmt.Fprintf(csvFile, "%s,%s,%s,%s,%s,%s,%s,%s,%s,%s\n", pair[0], pair[1], rack, csvField(slot),
+				csvField(o.PID), csvField(o.Serial), csvField(n.PID), csvField(n.Serial), csvField(n.State), status)
+		}
+
+		for _, n := range newHW {
+			newSlots[n.Slot] = true
+			o, had := oldBySlot[n.Slot]
+			status := "NEW"
+			switch {
+			case had && o.Serial == n.Serial && o.PID == n.PID:
+				status = "SAME"
+			case had && o.PID == n.PID:
+				status = "REPLACED"
+			case had:
+				status = "CHANGED_PID"
+			case n.Serial != "" && oldSerials[n.Serial] != "":
+				status = "MOVED from " + oldSerials[n.Serial]
+			}
+			row(n.Rack, n.Slot, o, n, status)
+		}
+		for _, o := range oldHW {
+			if !newSlots[o.Slot] {
+				row(o.Rack, o.Slot, o, HardwareRecord{}, "REMOVED")
+			}
+		}
+	}
+
+	fmt.Fprintf(file, "\n================================================================================\n")
+	log.Printf("Hardware report: %d pairs", len(pairs))
+	return nil
+}
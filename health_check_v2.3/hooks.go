@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// OPERATOR HOOKS (-hooks)
+// ============================================================================
+//
+// Opening the change ticket, lighting up the war-room dashboard or starting
+// the backup job meant someone watching the run and doing it by hand. The
+// hooks file (YAML, see yaml_subset.go) runs shell commands or HTTP calls at
+// fixed points of every collection:
+//
+//   hooks:
+//     - event: before-precheck        # see hookEvents
+//       run: /opt/noc/open-change.sh  # sh -c (cmd /C on Windows); context JSON on stdin
+//     - event: after-postcheck
+//       url: env:WARROOM_URL          # POST of the context JSON
+//       headers:
+//         Authorization: env:WARROOM_TOKEN
+//     - event: on-fail
+//       run: /opt/noc/page-oncall.sh
+//       timeout: 30s                  # default 60s
+//
+// A phase is a pre-check when one of its words (split on - and _) starts
+// with "pre", a post-check when one starts with "post"; before-run and
+// after-run fire for every phase. on-fail fires after a run with a device
+// that was not collected or failed a check (the roll-up), and when -compare
+// gives FAIL.
+//
+// The context is the same JSON for both kinds: event, time, seq, source
+// (see sample_stamp.go), phase, run_dir, timestamp, devices, status (PASS,
+// WARN, FAIL, after a run), failed devices, failing checks and the
+// comparison report. Shell hooks also get
+// HC_EVENT, HC_PHASE, HC_RUN_DIR and HC_STATUS. Hooks run one after the
+// other and do not stop the run: a hook that fails, times out or gets a
+// non-2xx answer is logged.
+
+// hookEvents are the events a hook can be bound to
+var hookEvents = []string{"before-run", "after-run", "before-precheck", "after-precheck",
+	"before-postcheck", "after-postcheck", "on-fail"}
+
+const hookDefaultTimeout = 60 * time.Second
+
+// HookContext is what a hook is told about the run
+type HookContext struct {
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	Seq       uint64    `json:"seq"` // see sample_stamp.go
+	Source    string    `json:"source"`
+	Phase     string    `json:"phase"`
+	RunDir    string    `json:"run_dir,omitempty"`
+	Timestamp string    `json:"timestamp,omitempty"`
+	Devices   []string  `json:"devices,omitempty"`
+	Status    string    `json:"status,omitempty"`  // PASS, WARN, FAIL after a run
+	Failed    []string  `json:"failed,omitempty"`  // devices not collected
+	Failing   []string  `json:"failing,omitempty"` // "HOST check item: STATUS"
+	Report    string    `json:"report,omitempty"`  // comparison report
+}
+
+type hook struct {
+	event   string
+	run     string
+	url     string
+	headers map[string]string
+	timeout time.Duration
+}
+
+func (h *hook) name() string {
+	if h.run != "" {
+		if f := strings.Fields(h.run); len(f) > 0 {
+			return f[0]
+		}
+	}
+	return webhookHost(h.url)
+}
+
+// hookSet is the loaded hooks file; a nil set has no hooks
+type hookSet struct {
+	hooks  []*hook
+	client *http.Client
+}
+
+// loadHooks reads and validates the hooks file
+func loadHooks(path string) (*hookSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseYAML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	top, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a hooks list", path)
+	}
+	known := make(map[string]bool)
+	for _, e := range hookEvents {
+		known[e] = true
+	}
+
+	s := &hookSet{client: &http.Client{}}
+	list, _ := top["hooks"].([]interface{})
+	for i, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: hook %d: expected event and run or url", path, i+1)
+		}
+		event, _ := yamlString(m, "event")
+		run, _ := yamlString(m, "run")
+		url, _ := yamlString(m, "url")
+		timeout, _ := yamlString(m, "timeout")
+		h := &hook{event: strings.ToLower(strings.TrimSpace(event)), run: run, url: resolveSecret(url),
+			headers: make(map[string]string), timeout: hookDefaultTimeout}
+		switch {
+		case !known[h.event]:
+			return nil, fmt.Errorf("%s: hook %d: event %q (expected %s)", path, i+1, event, strings.Join(hookEvents, ", "))
+		case (run == "") == (url == ""):
+			return nil, fmt.Errorf("%s: hook %d: needs either run or url", path, i+1)
+		case url != "" && h.url == "":
+			return nil, fmt.Errorf("%s: hook %d: url is empty (unset %s?)", path, i+1, url)
+		}
+		if timeout != "" {
+			if h.timeout, err = time.ParseDuration(timeout); err != nil || h.timeout <= 0 {
+				return nil, fmt.Errorf("%s: hook %d: timeout %q", path, i+1, timeout)
+			}
+		}
+		if headers, ok := m["headers"].(map[string]interface{}); ok {
+			for k := range headers {
+				v, err := yamlString(headers, k)
+				if err != nil {
+					return nil, fmt.Errorf("%s: hook %d: header %v", path, i+1, err)
+				}
+				h.headers[k] = resolveSecret(v)
+			}
+		}
+		s.hooks = append(s.hooks, h)
+	}
+	if len(s.hooks) == 0 {
+		return nil, fmt.Errorf("%s: no hooks", path)
+	}
+	return s, nil
+}
+
+// phaseKind is "pre" or "post" for a pre- or post-check phase, else ""
+func phaseKind(phase string) string {
+	for _, w := range strings.FieldsFunc(strings.ToLower(phase), func(r rune) bool { return r == '-' || r == '_' }) {
+		switch {
+		case strings.HasPrefix(w, "pre"):
+			return "pre"
+		case strings.HasPrefix(w, "post"):
+			return "post"
+		}
+	}
+	return ""
+}
+
+// beforeRun fires before-run and before-<kind>check for a collection
+func (s *hookSet) beforeRun(writer *OutputWriter, devices []DeviceInfo) {
+	if s == nil {
+		return
+	}
+	ctx := HookContext{Phase: writer.phase, RunDir: writer.dir, Timestamp: writer.timestamp}
+	for _, d := range devices {
+		ctx.Devices = append(ctx.Devices, d.Hostname)
+	}
+	s.fire("before-run", ctx)
+	if kind := phaseKind(writer.phase); kind != "" {
+		s.fire("before-"+kind+"check", ctx)
+	}
+}
+
+// afterRun fires after-run, after-<kind>check and, when the run failed,
+// on-fail
+func (s *hookSet) afterRun(writer *OutputWriter, results []*DeviceResult, rollup []RollupDevice) {
+	if s == nil {
+		return
+	}
+	ctx := HookContext{Phase: writer.phase, RunDir: writer.dir, Timestamp: writer.timestamp, Status: "PASS"}
+	for _, r := range results {
+		ctx.Devices = append(ctx.Devices, r.Device.Hostname)
+		if !r.Success {
+			ctx.Failed = append(ctx.Failed, r.Device.Hostname)
+		}
+	}
+	sort.Strings(ctx.Failed)
+	for _, d := range rollup {
+		switch d.Status {
+		case "FAIL":
+			ctx.Status = "FAIL"
+		case "WARN":
+			if ctx.Status == "PASS" {
+				ctx.Status = "WARN"
+			}
+		}
+		for _, res := range d.Issues {
+			if rollupStatus(res.Status) == "FAIL" {
+				ctx.Failing = append(ctx.Failing, strings.TrimSpace(fmt.Sprintf("%s %s %s", d.Hostname, res.Check, res.Item))+": "+res.Status)
+			}
+		}
+	}
+	if len(ctx.Failed) > 0 {
+		ctx.Status = "FAIL"
+	}
+	s.fire("after-run", ctx)
+	if kind := phaseKind(writer.phase); kind != "" {
+		s.fire("after-"+kind+"check", ctx)
+	}
+	if ctx.Status == "FAIL" {
+		s.fire("on-fail", ctx)
+	}
+}
+
+// fire runs the hooks of an event in file order
+func (s *hookSet) fire(event string, ctx HookContext) {
+	if s == nil {
+		return
+	}
+	ctx.Event = event
+	stamp := newSampleStamp()
+	if ctx.Time.IsZero() {
+		ctx.Time = stamp.At
+	}
+	ctx.Seq, ctx.Source = stamp.Seq, stamp.Source
+	payload, err := json.Marshal(ctx)
+	if err != nil {
+		log.Printf("✗ Hook %s: %v", event, err)
+		return
+	}
+	for _, h := range s.hooks {
+		if h.event != event {
+			continue
+		}
+		began := time.Now()
+		if err := s.call(h, ctx, payload); err != nil {
+			log.Printf("✗ Hook %s %s: %v", event, h.name(), err)
+			continue
+		}
+		log.Printf("✓ Hook %s %s (%s)", event, h.name(), time.Since(began).Round(time.Millisecond))
+	}
+}
+
+func (s *hookSet) call(h *hook, hc HookContext, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	if h.run != "" {
+		cmd := shellCommand(ctx, h.run)
+		cmd.Stdin = bytes.NewReader(payload)
+		cmd.WaitDelay = time.Second // children of sh may hold the output open
+		cmd.Env = append(os.Environ(), "HC_EVENT="+hc.Event, "HC_PHASE="+hc.Phase,
+			"HC_RUN_DIR="+hc.RunDir, "HC_STATUS="+hc.Status)
+		out, err := cmd.CombinedOutput()
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %s", h.timeout)
+		}
+		if err != nil {
+			if msg := strings.TrimSpace(string(out)); msg != "" {
+				return fmt.Errorf("%v: %s", err, strings.SplitN(msg, "\n", 2)[0])
+			}
+			return err
+		}
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return nil
+}
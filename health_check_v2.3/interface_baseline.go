@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// INTERFACE BASELINE (INTERFACES_<ts>.csv) AND PRE/POST INTERFACE CHECK
+// ============================================================================
+//
+// The SUMMARY metrics roll interfaces up into totals, so one link going down
+// while another comes up, or CRC errors moving from one port to the next,
+// does not show. Every run therefore also writes INTERFACES_<ts>.csv with the
+// state, MTU, error counters and rates of each interface parsed from "show
+// interfaces", and comparePhases checks them interface by interface:
+//
+//   FAIL  up/up before, down (or administratively down, or gone) after
+//   FAIL  input, CRC or output errors grew by more than -if-error-threshold
+//   WARN  input or output drops grew by more than -if-error-threshold
+//   WARN  MTU changed
+//
+// Only these findings are added to the comparison (report, CSV, regressions
+// and verdict); unchanged interfaces are not listed. Rates are recorded
+// for reference only, traffic is expected to move in a change. Counters that went down
+// were cleared or the device reloaded and are not judged. Hosts without
+// interface data in the post run (not collected) are skipped.
+
+const (
+	interfaceCommand         = "show interfaces"
+	defaultIfErrorThreshold  = 10
+	interfaceBaselinePrefix  = "INTERFACES_"
+	interfaceBaselineColumns = "Hostname,Interface,AdminState,LineProtocol,MTU,InputErrors,CRCErrors,OutputErrors,InputDrops,OutputDrops,RateInterval_s,InputBps,InputPps,OutputBps,OutputPps"
+)
+
+// interfaceKey identifies an interface across runs
+type interfaceKey struct {
+	Host, Name string
+}
+
+// collectInterfaces parses the "show interfaces" (or snmp:interfaces)
+// outputs of a device
+func collectInterfaces(results []ExecutionResult) []InterfaceDetail {
+	var ifaces []InterfaceDetail
+	for _, e := range results {
+		if isShowInterfacesDetail(e.Command) {
+			ifaces = append(ifaces, parseShowInterfaces(e.Output)...)
+		}
+		if e.Command == snmpInterfacesCommand {
+			ifaces = append(ifaces, parseSNMPInterfaces(e.Output)...)
+		}
+	}
+	return ifaces
+}
+
+// WriteInterfaces writes INTERFACES_<ts>.csv, the per-interface baseline
+func (w *OutputWriter) WriteInterfaces(results []*DeviceResult) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("%s%s.csv", interfaceBaselinePrefix, w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "%s\n", interfaceBaselineColumns)
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		for _, i := range collectInterfaces(r.Results) {
+			fmt.Fprintf(file, "%s,%s,%s,%s,%d,%d,%d,%d,%d,%d,%d,%d,%d,%d,%d\n", r.Device.Hostname, csvField(i.Name), csvField(i.AdminState),
+				csvField(i.LineProtocol), i.MTU, i.InputErrors, i.CRCErrors, i.OutputErrors, i.InputDrops, i.OutputDrops,
+				i.RateInterval, i.InputRateBps, i.InputRatePps, i.OutputRateBps, i.OutputRatePps)
+		}
+	}
+	return nil
+}
+
+// loadInterfaceBaseline reads the INTERFACES csv of a run; nil when the run
+// has none (older runs)
+func loadInterfaceBaseline(dir string) (map[interfaceKey]InterfaceDetail, error) {
+	rows, _, err := latestRunCSV(dir, interfaceBaselinePrefix, 10)
+	if rows == nil || err != nil {
+		return nil, err
+	}
+
+	ifaces := make(map[interfaceKey]InterfaceDetail)
+	for _, rec := range rows {
+		mtu, _ := strconv.Atoi(rec[4])
+		ifaces[interfaceKey{rec[0], rec[1]}] = InterfaceDetail{
+			Name:         rec[1],
+			AdminState:   rec[2],
+			LineProtocol: rec[3],
+			MTU:          mtu,
+			InputErrors:  atoi64(rec[5]),
+			CRCErrors:    atoi64(rec[6]),
+			OutputErrors: atoi64(rec[7]),
+			InputDrops:   atoi64(rec[8]),
+			OutputDrops:  atoi64(rec[9]),
+		}
+	}
+	return ifaces, nil
+}
+
+func interfaceState(i InterfaceDetail) string {
+	return i.AdminState + "/" + i.LineProtocol
+}
+
+// compareInterfaces returns the interface findings between two runs
+func compareInterfaces(pre, post map[interfaceKey]InterfaceDetail, threshold int64) []PhaseDelta {
+	collected := make(map[string]bool)
+	for k := range post {
+		collected[k.Host] = true
+	}
+	var keys []interfaceKey
+	for k := range pre {
+		if collected[k.Host] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Host != keys[j].Host {
+			return keys[i].Host < keys[j].Host
+		}
+		return keys[i].Name < keys[j].Name
+	})
+
+	var deltas []PhaseDelta
+	add := func(k interfaceKey, what, pre, post, delta, status, reason string) {
+		deltas = append(deltas, PhaseDelta{
+			goldenKey: goldenKey{Host: k.Host, Command: interfaceCommand, Metric: k.Name + " " + what},
+			Pre:       pre, Post: post, Delta: delta, Status: status, Reason: reason,
+		})
+	}
+	for _, k := range keys {
+		before := pre[k]
+		after, ok := post[k]
+		if !ok {
+			if before.IsUp() {
+				add(k, "state", interfaceState(before), "", "", "FAIL", "interface was up before and is gone after")
+			}
+			continue
+		}
+		if before.IsUp() && !after.IsUp() {
+			add(k, "state", interfaceState(before), interfaceState(after), "", "FAIL", "interface was up before and is down after")
+		}
+		if before.MTU != 0 && after.MTU != 0 && before.MTU != after.MTU {
+			add(k, "MTU", strconv.Itoa(before.MTU), strconv.Itoa(after.MTU), fmt.Sprintf("%+d", after.MTU-before.MTU), "WARN", "MTU changed")
+		}
+		counters := []struct {
+			name     string
+			pre, now int64
+			status   string
+		}{
+			{"input errors", before.InputErrors, after.InputErrors, "FAIL"},
+			{"CRC errors", before.CRCErrors, after.CRCErrors, "FAIL"},
+			{"output errors", before.OutputErrors, after.OutputErrors, "FAIL"},
+			{"input drops", before.InputDrops, after.InputDrops, "WARN"},
+			{"output drops", before.OutputDrops, after.OutputDrops, "WARN"},
+		}
+		for _, c := range counters {
+			if grew := c.now - c.pre; grew > threshold {
+				add(k, c.name, strconv.FormatInt(c.pre, 10), strconv.FormatInt(c.now, 10), fmt.Sprintf("+%d", grew),
+					c.status, fmt.Sprintf("%s grew by %d (threshold %d)", c.name, grew, threshold))
+			}
+		}
+	}
+	return deltas
+}
+
+// compareInterfaceRuns loads and compares the interface baselines of two
+// runs; nothing is compared when either run has none
+func compareInterfaceRuns(preDir, postDir string, threshold int64) []PhaseDelta {
+	pre, err1 := loadInterfaceBaseline(preDir)
+	post, err2 := loadInterfaceBaseline(postDir)
+	if runCheckSkipped("Interface", interfaceBaselinePrefix, err1, err2, pre != nil, post != nil) {
+		return nil
+	}
+	return compareInterfaces(pre, post, threshold)
+}
+
+// latestRunCSV reads the newest <prefix>*.csv of a run: its data rows with
+// at least columns fields, and the time in its name; nil rows when the run
+// has none (older runs)
+func latestRunCSV(dir, prefix string, columns int) ([][]string, time.Time, error) {
+	matches, _ := filepath.Glob(filepath.Join(resolveRunDir(dir), prefix+"*.csv"))
+	if len(matches) == 0 {
+		return nil, time.Time{}, nil
+	}
+	sort.Strings(matches)
+	path := matches[len(matches)-1]
+	ts := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), prefix), ".csv")
+	at, _ := time.ParseInLocation("20060102_150405", ts, time.Local)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, at, err
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, at, fmt.Errorf("%s: %v", path, err)
+	}
+	rows := [][]string{}
+	for i, rec := range records {
+		if i > 0 && len(rec) >= columns {
+			rows = append(rows, rec)
+		}
+	}
+	return rows, at, nil
+}
+
+// runCheckSkipped reports, and logs why, when a check cannot compare two
+// runs: either csv did not load, or a run has none (logged unless prefix
+// is "", for checks that only some runs collect)
+func runCheckSkipped(check, prefix string, err1, err2 error, pre, post bool) bool {
+	if err1 != nil || err2 != nil {
+		log.Printf("⚠ %s check skipped: %v", check, firstError(err1, err2))
+		return true
+	}
+	if !pre || !post {
+		if prefix != "" {
+			log.Printf("%s check skipped: no %s*.csv in both runs", check, prefix)
+		}
+		return true
+	}
+	return false
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
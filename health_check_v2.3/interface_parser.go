@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// SHOW INTERFACES PARSER (IOS-XR / IOS-XE)
+// ============================================================================
+
+// InterfaceDetail is the structured form of one "show interfaces" block
+type InterfaceDetail struct {
+	Name          string
+	AdminState    string // up, down, administratively down
+	LineProtocol  string
+	Description   string
+	IPAddress     string
+	MTU           int
+	BandwidthKbps int64
+	Duplex        string
+	Speed         string
+	Encapsulation string
+	LastFlap      string
+	RateInterval  int // load interval of the rates in seconds, 0 when not printed
+	InputRateBps  int64
+	InputRatePps  int64
+	OutputRateBps int64
+	OutputRatePps int64
+	InputPackets  int64
+	OutputPackets int64
+	InputBytes    int64
+	OutputBytes   int64
+	InputErrors   int64
+	CRCErrors     int64
+	OutputErrors  int64
+	InputDrops    int64
+	OutputDrops   int64
+	Resets        int64
+	CarrierTrans  int64
+}
+
+// IsUp reports whether both the interface and its line protocol are up
+func (i InterfaceDetail) IsUp() bool {
+	return i.AdminState == "up" && strings.HasPrefix(i.LineProtocol, "up")
+}
+
+// IsAdminDown reports whether the interface is shut down by configuration
+func (i InterfaceDetail) IsAdminDown() bool {
+	return strings.HasPrefix(i.AdminState, "administratively")
+}
+
+var (
+	ifHeaderRe     = regexp.MustCompile(`^(\S+) is (administratively down|up|down|deleted)[^,]*, line protocol is (administratively down|\S+)`)
+	ifDescRe       = regexp.MustCompile(`^\s+Description: (.*)$`)
+	ifAddrRe       = regexp.MustCompile(`^\s+Internet address is (\S+)`)
+	ifMTURe        = regexp.MustCompile(`MTU (\d+) bytes`)
+	ifBWRe         = regexp.MustCompile(`BW (\d+) Kbit`)
+	ifEncapRe      = regexp.MustCompile(`^\s+Encapsulation ([^,]+)`)
+	ifDuplexRe     = regexp.MustCompile(`(?i)^\s+(full|half|auto)[- ]duplex, ([^,]+)`)
+	ifFlapRe       = regexp.MustCompile(`^\s+Last link flapped (\S+)`)
+	ifInPktsRe     = regexp.MustCompile(`(\d+) packets input(?:, (\d+) bytes)?`)
+	ifOutPktsRe    = regexp.MustCompile(`(\d+) packets output(?:, (\d+) bytes)?`)
+	ifInErrRe      = regexp.MustCompile(`(\d+) input errors`)
+	ifCRCRe        = regexp.MustCompile(`(\d+) CRC`)
+	ifOutErrRe     = regexp.MustCompile(`(\d+) output errors`)
+	ifInDropsRe    = regexp.MustCompile(`(\d+) total input drops`)
+	ifOutDropsXRRe = regexp.MustCompile(`(\d+) total output drops`)
+	ifOutDropsXERe = regexp.MustCompile(`Total output drops: (\d+)`)
+	ifInQDropsRe   = regexp.MustCompile(`Input queue: \d+/\d+/(\d+)/`)
+	ifResetsRe     = regexp.MustCompile(`(\d+) (?:interface )?resets`)
+	ifCarrierRe    = regexp.MustCompile(`(\d+) carrier transitions`)
+)
+
+// parseShowInterfaces splits "show interfaces" output into per-interface records.
+// Works on both IOS-XR and IOS-XE layouts; fields a platform does not print stay zero.
+func parseShowInterfaces(output string) []InterfaceDetail {
+	var result []InterfaceDetail
+	var cur *InterfaceDetail
+	var rateSeen map[string]int // load interval of the rate kept per direction
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r ")
+		if m := ifHeaderRe.FindStringSubmatch(line); m != nil {
+			if cur != nil {
+				result = append(result, *cur)
+			}
+			cur = &InterfaceDetail{
+				Name:         m[1],
+				AdminState:   m[2],
+				LineProtocol: strings.TrimSuffix(m[3], ","),
+			}
+			rateSeen = make(map[string]int)
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+
+		if m := ifDescRe.FindStringSubmatch(line); m != nil {
+			cur.Description = strings.TrimSpace(m[1])
+		}
+		if m := ifAddrRe.FindStringSubmatch(line); m != nil {
+			cur.IPAddress = m[1]
+		}
+		if m := ifMTURe.FindStringSubmatch(line); m != nil {
+			cur.MTU, _ = strconv.Atoi(m[1])
+		}
+		if m := ifBWRe.FindStringSubmatch(line); m != nil {
+			cur.BandwidthKbps = atoi64(m[1])
+		}
+		if m := ifEncapRe.FindStringSubmatch(line); m != nil {
+			cur.Encapsulation = strings.TrimSpace(m[1])
+		}
+		if m := ifDuplexRe.FindStringSubmatch(line); m != nil {
+			cur.Duplex = strings.ToLower(m[1])
+			cur.Speed = strings.TrimSpace(m[2])
+		}
+		if m := ifFlapRe.FindStringSubmatch(line); m != nil {
+			cur.LastFlap = m[1]
+		}
+		for _, r := range parseRateLine(line) {
+			if prev, ok := rateSeen[r.Direction]; ok && (r.Interval == 0 || (prev > 0 && r.Interval >= prev)) {
+				continue
+			}
+			rateSeen[r.Direction] = r.Interval
+			cur.setRate(r)
+		}
+		if m := ifInPktsRe.FindStringSubmatch(line); m != nil {
+			cur.InputPackets = atoi64(m[1])
+			cur.InputBytes = atoi64(m[2])
+		}
+		if m := ifOutPktsRe.FindStringSubmatch(line); m != nil {
+			cur.OutputPackets = atoi64(m[1])
+			cur.OutputBytes = atoi64(m[2])
+		}
+		if m := ifInErrRe.FindStringSubmatch(line); m != nil {
+			cur.InputErrors = atoi64(m[1])
+		}
+		if m := ifCRCRe.FindStringSubmatch(line); m != nil {
+			cur.CRCErrors = atoi64(m[1])
+		}
+		if m := ifOutErrRe.FindStringSubmatch(line); m != nil {
+			cur.OutputErrors = atoi64(m[1])
+		}
+		if m := ifInDropsRe.FindStringSubmatch(line); m != nil {
+			cur.InputDrops = atoi64(m[1])
+		}
+		if m := ifInQDropsRe.FindStringSubmatch(line); m != nil {
+			cur.InputDrops = atoi64(m[1])
+		}
+		if m := ifOutDropsXRRe.FindStringSubmatch(line); m != nil {
+			cur.OutputDrops = atoi64(m[1])
+		}
+		if m := ifOutDropsXERe.FindStringSubmatch(line); m != nil {
+			cur.OutputDrops = atoi64(m[1])
+		}
+		if m := ifResetsRe.FindStringSubmatch(line); m != nil {
+			cur.Resets = atoi64(m[1])
+		}
+		if m := ifCarrierRe.FindStringSubmatch(line); m != nil {
+			cur.CarrierTrans = atoi64(m[1])
+		}
+	}
+	if cur != nil {
+		result = append(result, *cur)
+	}
+	return result
+}
+
+// isShowInterfacesDetail matches the full "show interfaces [name]" form,
+// not the brief/description/status variants that have their own parsers.
+func isShowInterfacesDetail(command string) bool {
+	fields := strings.Fields(strings.ToLower(command))
+	if len(fields) < 2 || fields[0] != "show" || !strings.HasPrefix(fields[1], "int") {
+		return false
+	}
+	for _, f := range fields[2:] {
+		switch f {
+		case "brief", "description", "status", "trunk", "summary", "counters", "|":
+			return false
+		}
+	}
+	return true
+}
+
+// interfaceMetrics rolls parsed interfaces up into summary CSV metrics
+func interfaceMetrics(ifaces []InterfaceDetail) map[string]string {
+	metrics := make(map[string]string)
+	var up, down, adminDown, withErrors int
+	var inErr, crc, outErr, drops, inBps, outBps int64
+	for _, i := range ifaces {
+		switch {
+		case i.IsUp():
+			up++
+		case i.IsAdminDown():
+			adminDown++
+		default:
+			down++
+		}
+		if i.InputErrors > 0 || i.OutputErrors > 0 || i.CRCErrors > 0 {
+			withErrors++
+		}
+		inErr += i.InputErrors
+		crc += i.CRCErrors
+		outErr += i.OutputErrors
+		drops += i.InputDrops + i.OutputDrops
+		inBps += i.InputRateBps
+		outBps += i.OutputRateBps
+	}
+	metrics["Interfaces_Total"] = strconv.Itoa(len(ifaces))
+	metrics["Interfaces_Up"] = strconv.Itoa(up)
+	metrics["Interfaces_Down"] = strconv.Itoa(down)
+	metrics["Interfaces_AdminDown"] = strconv.Itoa(adminDown)
+	metrics["Interfaces_With_Errors"] = strconv.Itoa(withErrors)
+	metrics["Input_Errors_Total"] = strconv.FormatInt(inErr, 10)
+	metrics["CRC_Errors_Total"] = strconv.FormatInt(crc, 10)
+	metrics["Output_Errors_Total"] = strconv.FormatInt(outErr, 10)
+	metrics["Drops_Total"] = strconv.FormatInt(drops, 10)
+	metrics["Input_Rate_bps"] = strconv.FormatInt(inBps, 10)
+	metrics["Output_Rate_bps"] = strconv.FormatInt(outBps, 10)
+	return metrics
+}
+
+// atoi64 reads a counter; ParseInt saturates 64-bit counters beyond the
+// int64 range at its maximum, and an empty or invalid field is 0
+func atoi64(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+// ----------------------------------------------------------------------------
+// Rate lines
+// ----------------------------------------------------------------------------
+//
+// The rate lines differ by platform, load interval and unit:
+//
+//   5 minute input rate 1000 bits/sec, 2 packets/sec        IOS-XR, IOS-XE
+//   30 second output rate 152000 bits/sec, 40 packets/sec   load-interval 30
+//   30 seconds input rate 64 bits/sec, 0 packets/sec        NX-OS
+//   input rate 1.23 Mbps, 150 pps; output rate 2.5 Gbps, 200 pps
+//   5 minute input rate 12 packets/sec                      packets only
+//
+// parseRateLine reads any of them into bits and packets per second. When an
+// interface prints several load intervals, the shortest one is kept: it is
+// the closest to the traffic right now, which is what a drain waits for.
+
+// InterfaceRate is one direction of a rate line
+type InterfaceRate struct {
+	Direction string // input or output
+	Interval  int    // seconds, 0 when the line does not say
+	Bps       int64  // -1 when the line gives no bit rate
+	Pps       int64  // -1 when the line gives no packet rate
+}
+
+var (
+	ifRateDirRe   = regexp.MustCompile(`(?i)(?:\b(\d+)\s*(second|sec|minute|min)s?\s+)?\b(input|output)\s+rate\b`)
+	ifRateValueRe = regexp.MustCompile(`(?i)\b(\d+(?:\.\d+)?)\s*(bits/sec|bits/s|[kmgt]bits/sec|[kmgt]?bps|packets/sec|pkts/sec|pps)(?:\W|$)`)
+)
+
+// ifRateUnits are the multipliers to bits/sec, and packets/sec for the
+// packet units (marked by a negative sign)
+var ifRateUnits = map[string]float64{
+	"bits/sec": 1, "bits/s": 1, "bps": 1,
+	"kbits/sec": 1e3, "kbps": 1e3, "mbits/sec": 1e6, "mbps": 1e6,
+	"gbits/sec": 1e9, "gbps": 1e9, "tbits/sec": 1e12, "tbps": 1e12,
+	"packets/sec": -1, "pkts/sec": -1, "pps": -1,
+}
+
+// parseRateLine returns the rates on one output line, one per direction
+// named on it
+func parseRateLine(line string) []InterfaceRate {
+	dirs := ifRateDirRe.FindAllStringSubmatchIndex(line, -1)
+	var rates []InterfaceRate
+	for n, d := range dirs {
+		end := len(line)
+		if n+1 < len(dirs) {
+			end = dirs[n+1][0]
+		}
+		segment, _, _ := strings.Cut(line[d[1]:end], ";")
+		r := InterfaceRate{Direction: strings.ToLower(line[d[6]:d[7]]), Bps: -1, Pps: -1}
+		if d[2] >= 0 {
+			r.Interval, _ = strconv.Atoi(line[d[2]:d[3]])
+			if unit := strings.ToLower(line[d[4]:d[5]]); strings.HasPrefix(unit, "min") {
+				r.Interval *= 60
+			}
+		}
+		for _, v := range ifRateValueRe.FindAllStringSubmatch(segment, -1) {
+			value, err := strconv.ParseFloat(v[1], 64)
+			if err != nil {
+				continue
+			}
+			switch scale := ifRateUnits[strings.ToLower(v[2])]; {
+			case scale < 0 && r.Pps < 0:
+				r.Pps = int64(value + 0.5)
+			case scale > 0 && r.Bps < 0:
+				r.Bps = int64(value*scale + 0.5)
+			}
+		}
+		if r.Bps >= 0 || r.Pps >= 0 {
+			rates = append(rates, r)
+		}
+	}
+	return rates
+}
+
+// parseRateLines returns every rate in an output, e.g. of
+// "show interfaces X | include rate"
+func parseRateLines(output string) []InterfaceRate {
+	var rates []InterfaceRate
+	for _, line := range strings.Split(output, "\n") {
+		rates = append(rates, parseRateLine(line)...)
+	}
+	return rates
+}
+
+// setRate records one direction of a rate line
+func (i *InterfaceDetail) setRate(r InterfaceRate) {
+	bps, pps := max(r.Bps, 0), max(r.Pps, 0)
+	if r.Direction == "output" {
+		i.OutputRateBps, i.OutputRatePps = bps, pps
+	} else {
+		i.InputRateBps, i.InputRatePps = bps, pps
+	}
+	i.RateInterval = r.Interval
+}
+
+// rateLimit is a threshold on every rate of an output (until_rate_below)
+type rateLimit struct {
+	Spec    string
+	Value   int64
+	Packets bool
+}
+
+// parseRateLimit reads 64000, 64kbps, 1.5Mbps or 10pps
+func parseRateLimit(spec string) (*rateLimit, error) {
+	spec = strings.TrimSpace(spec)
+	text := spec
+	if _, err := strconv.ParseFloat(text, 64); err == nil {
+		text += "bps"
+	}
+	m := ifRateValueRe.FindStringSubmatch(text)
+	if m == nil || m[0] != text {
+		return nil, fmt.Errorf("invalid rate %q (e.g. 64000, 64kbps, 1.5Mbps, 10pps)", spec)
+	}
+	value, _ := strconv.ParseFloat(m[1], 64)
+	scale := ifRateUnits[strings.ToLower(m[2])]
+	if scale < 0 {
+		return &rateLimit{Spec: spec, Value: int64(value + 0.5), Packets: true}, nil
+	}
+	return &rateLimit{Spec: spec, Value: int64(value*scale + 0.5)}, nil
+}
+
+// below reports whether the output has rate lines and every rate is below
+// the limit; a line without the limit's kind of rate does not count as below
+func (l *rateLimit) below(output string) bool {
+	rates := parseRateLines(output)
+	for _, r := range rates {
+		v := r.Bps
+		if l.Packets {
+			v = r.Pps
+		}
+		if v < 0 || v >= l.Value {
+			return false
+		}
+	}
+	return len(rates) > 0
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The rate line forms listed in interface_parser.go; the show interfaces
+// fixtures in testdata/parsers cover them inside whole outputs
+func TestParseRateLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want []InterfaceRate
+	}{
+		{"  5 minute input rate 1000 bits/sec, 2 packets/sec",
+			[]InterfaceRate{{"input", 300, 1000, 2}}},
+		{"  30 second output rate 152000 bits/sec, 40 packets/sec",
+			[]InterfaceRate{{"output", 30, 152000, 40}}},
+		{"  30 seconds input rate 64 bits/sec, 0 packets/sec",
+			[]InterfaceRate{{"input", 30, 64, 0}}},
+		{"  input rate 1.23 Mbps, 150 pps; output rate 2.5 Gbps, 200 pps",
+			[]InterfaceRate{{"input", 0, 1230000, 150}, {"output", 0, 2500000000, 200}}},
+		{"  5 minute input rate 12 packets/sec",
+			[]InterfaceRate{{"input", 300, -1, 12}}},
+		{"  1 minute output rate 64 kbits/sec",
+			[]InterfaceRate{{"output", 60, 64000, -1}}},
+		{"  Input queue: 0/375/0/0 (size/max/drops/flushes)", nil},
+		{"  5 minute input rate unknown", nil},
+	}
+	for _, tt := range tests {
+		if got := parseRateLine(tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRateLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		spec    string
+		value   int64
+		packets bool
+		invalid bool
+	}{
+		{"64000", 64000, false, false},
+		{"64kbps", 64000, false, false},
+		{"1.5Mbps", 1500000, false, false},
+		{"10pps", 10, true, false},
+		{"fast", 0, false, true},
+		{"10 mbps please", 0, false, true},
+	}
+	for _, tt := range tests {
+		l, err := parseRateLimit(tt.spec)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("parseRateLimit(%q) accepted, want an error", tt.spec)
+			}
+			continue
+		}
+		if err != nil || l.Value != tt.value || l.Packets != tt.packets {
+			t.Errorf("parseRateLimit(%q) = %+v, %v, want %d packets=%v", tt.spec, l, err, tt.value, tt.packets)
+		}
+	}
+
+	drained := "  30 second input rate 8000 bits/sec, 10 packets/sec\n  30 second output rate 0 bits/sec, 0 packets/sec\n"
+	busy := "  30 second input rate 8000 bits/sec, 10 packets/sec\n  30 second output rate 2.1 Mbps, 300 pps\n"
+	below := []struct {
+		spec, output string
+		want         bool
+	}{
+		{"64kbps", drained, true},
+		{"64kbps", busy, false},
+		{"8000", drained, false}, // not below, equal
+		{"20pps", drained, true},
+		{"20pps", busy, false},
+		{"64kbps", "GigabitEthernet1 is up, line protocol is up\n", false}, // no rate lines
+		{"20pps", "  5 minute input rate 1000 bits/sec\n", false},          // no packet rate
+	}
+	for _, tt := range below {
+		l, _ := parseRateLimit(tt.spec)
+		if got := l.below(tt.output); got != tt.want {
+			t.Errorf("%s below(%q) = %v, want %v", tt.spec, tt.output, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// DEVICE INVENTORY (loaders, OS detection, validation)
+// ============================================================================
+//
+// Every way a device enters the tool goes through this file: -hosts and
+// -sync-inventory files, NetBox (netbox_sync.go) and the API (server.go).
+// The file format follows the extension:
+//
+//   .csv   Hostname,IP_Address,Device_Type,Site,Role,Proxy,Key_File,
+//          Key_Passphrase,Alias,Standby_IP,Pair,SSH_Algorithms,Transport
+//          (header row, columns by position)
+//   .xlsx  the same columns A-M on the first sheet (falls back to the .csv
+//          of the same name when the workbook is unreadable or empty)
+//   .json  a list of inventoryRecord, the toolkit's devices.json
+//   .yaml  the same records as a list, or under a "devices:" key:
+//
+//            devices:
+//              - hostname: UPE1
+//                ip_address: 10.0.0.1
+//                device_type: ASR9906
+//
+// Rows without a hostname or address are skipped; validateInventory then
+// reports what would make a device fail later (bad addresses, no device
+// type, duplicate addresses or aliases). The lab loggers and the toolkit
+// still carry their own copies of these types; the file depends only on
+// yaml_subset.go and isIPAddress so it can move to a shared package once
+// the tools live in one module.
+
+type DeviceInfo struct {
+	Hostname   string
+	IPAddress  string
+	DeviceType string
+	Site       string
+	Role       string
+	DetectedOS string
+	Proxy      string // Optional per-device proxy spec (see ssh_proxy.go)
+	KeyFile    string // Optional private key for publickey auth
+	KeyPass    string // Key passphrase, or env:VAR to read it from the environment
+	Alias      string // Optional short display name for reports (see display.go)
+	StandbyIP  string // Optional standby RSP/RP management address (see redundancy.go)
+	Pair       string // Optional node pair the device belongs to (see node_pairs.go)
+	SSHAlgos   string // Optional ssh algorithm overrides for old devices (see ssh_algorithms.go)
+	Transport  string // Optional collection transport, e.g. snmp (see snmp_poll.go)
+}
+
+var inventoryHeader = []string{"Hostname", "IP_Address", "Device_Type", "Site", "Role", "Proxy", "Key_File", "Key_Passphrase", "Alias", "Standby_IP", "Pair", "SSH_Algorithms", "Transport"}
+
+// inventoryRecord is the canonical JSON form shared with the toolkit's devices file
+type inventoryRecord struct {
+	Hostname   string `json:"hostname"`
+	IPAddress  string `json:"ip_address"`
+	DeviceType string `json:"device_type"`
+	Site       string `json:"site,omitempty"`
+	Role       string `json:"role,omitempty"`
+	Proxy      string `json:"proxy,omitempty"`
+	KeyFile    string `json:"key_file,omitempty"`
+	KeyPass    string `json:"key_passphrase,omitempty"`
+	Alias      string `json:"alias,omitempty"`
+	StandbyIP  string `json:"standby_ip,omitempty"`
+	Pair       string `json:"pair,omitempty"`
+	SSHAlgos   string `json:"ssh_algorithms,omitempty"`
+	Transport  string `json:"transport,omitempty"`
+}
+
+// device converts a record, detecting the OS from the device type
+func (r inventoryRecord) device() DeviceInfo {
+	return DeviceInfo{
+		Hostname:   r.Hostname,
+		IPAddress:  r.IPAddress,
+		DeviceType: r.DeviceType,
+		Site:       r.Site,
+		Role:       r.Role,
+		DetectedOS: detectDeviceOS(r.DeviceType),
+		Proxy:      r.Proxy,
+		KeyFile:    r.KeyFile,
+		KeyPass:    r.KeyPass,
+		Alias:      r.Alias,
+		StandbyIP:  r.StandbyIP,
+		Pair:       r.Pair,
+		SSHAlgos:   r.SSHAlgos,
+		Transport:  r.Transport,
+	}
+}
+
+// inventoryRecordOf is the record of a device
+func inventoryRecordOf(d DeviceInfo) inventoryRecord {
+	return inventoryRecord{
+		Hostname:   d.Hostname,
+		IPAddress:  d.IPAddress,
+		DeviceType: d.DeviceType,
+		Site:       d.Site,
+		Role:       d.Role,
+		Proxy:      d.Proxy,
+		KeyFile:    d.KeyFile,
+		KeyPass:    d.KeyPass,
+		Alias:      d.Alias,
+		StandbyIP:  d.StandbyIP,
+		Pair:       d.Pair,
+		SSHAlgos:   d.SSHAlgos,
+		Transport:  d.Transport,
+	}
+}
+
+// recordFromColumns reads a row laid out as inventoryHeader
+func recordFromColumns(cols []string) inventoryRecord {
+	cell := func(i int) string {
+		if i < len(cols) {
+			return strings.TrimSpace(cols[i])
+		}
+		return ""
+	}
+	return inventoryRecord{
+		Hostname:   cell(0),
+		IPAddress:  cell(1),
+		DeviceType: cell(2),
+		Site:       cell(3),
+		Role:       cell(4),
+		Proxy:      cell(5),
+		KeyFile:    cell(6),
+		KeyPass:    cell(7),
+		Alias:      cell(8),
+		StandbyIP:  cell(9),
+		Pair:       cell(10),
+		SSHAlgos:   cell(11),
+		Transport:  cell(12),
+	}
+}
+
+// addInventoryRecords keys the usable records by upper-case hostname
+func addInventoryRecords(records []inventoryRecord) map[string]DeviceInfo {
+	devices := make(map[string]DeviceInfo)
+	for _, r := range records {
+		if r.Hostname == "" || r.IPAddress == "" {
+			continue
+		}
+		devices[strings.ToUpper(r.Hostname)] = r.device()
+	}
+	return devices
+}
+
+// ============================================================================
+// OS DETECTION - FIXED ORDER (specific patterns first!)
+// ============================================================================
+
+func detectDeviceOS(deviceType string) string {
+	dt := strings.ToUpper(strings.TrimSpace(deviceType))
+
+	// =====================================================
+	// CHECK SPECIFIC PATTERNS FIRST (before generic ones!)
+	// =====================================================
+
+	// IOS-XE: ASR903, ASR920 (must check BEFORE ASR9 pattern!)
+	if strings.Contains(dt, "ASR903") || strings.Contains(dt, "ASR-903") ||
+		strings.Contains(dt, "ASR920") || strings.Contains(dt, "ASR-920") {
+		return "IOS-XE"
+	}
+
+	// IOS-XR: ASR9000 series (ASR9K, ASR9006, ASR9010, ASR9906, etc.)
+	// Only match ASR9 followed by 0 or K (not ASR903/ASR920)
+	if strings.Contains(dt, "ASR9K") || strings.Contains(dt, "ASR-9K") ||
+		strings.Contains(dt, "ASR90") || strings.Contains(dt, "ASR91") ||
+		strings.Contains(dt, "ASR99") || // ASR9006, ASR9010, ASR9901, ASR9906, etc.
+		strings.Contains(dt, "XRV") || strings.Contains(dt, "IOS-XR") ||
+		strings.Contains(dt, "IOSXR") || strings.Contains(dt, "NCS") ||
+		strings.Contains(dt, "CRS") {
+		return "IOS-XR"
+	}
+
+	// IOS-XE: Other patterns
+	if strings.Contains(dt, "ASR1") || strings.Contains(dt, "ASR-1") ||
+		strings.Contains(dt, "ISR") || strings.Contains(dt, "CSR") ||
+		strings.Contains(dt, "IOS-XE") || strings.Contains(dt, "IOSXE") ||
+		strings.Contains(dt, "IOSV") || strings.Contains(dt, "IOS-V") ||
+		strings.Contains(dt, "VIOS") || strings.Contains(dt, "C8") ||
+		strings.Contains(dt, "C11") || strings.Contains(dt, "C12") {
+		return "IOS-XE"
+	}
+
+	// L2 Switch patterns
+	if strings.Contains(dt, "SWITCH") || strings.Contains(dt, "SW") ||
+		strings.Contains(dt, "CAT") || strings.Contains(dt, "CATALYST") ||
+		strings.Contains(dt, "C9300") || strings.Contains(dt, "C9200") ||
+		strings.Contains(dt, "C9400") || strings.Contains(dt, "C9500") ||
+		strings.Contains(dt, "C3850") || strings.Contains(dt, "C3750") ||
+		strings.Contains(dt, "C2960") || strings.Contains(dt, "9300") ||
+		strings.Contains(dt, "9200") || strings.Contains(dt, "3850") ||
+		strings.Contains(dt, "3750") || strings.Contains(dt, "2960") ||
+		strings.Contains(dt, "L2") || strings.Contains(dt, "IOL") ||
+		strings.Contains(dt, "I86BI") {
+		return "L2-SWITCH"
+	}
+
+	// Default
+	return "IOS-XE"
+}
+
+// ============================================================================
+// FILE PARSERS
+// ============================================================================
+
+func loadHostInventory(filename string) (map[string]DeviceInfo, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	switch ext {
+	case ".json":
+		return parseInventoryJSON(filename)
+	case ".yaml", ".yml":
+		return parseInventoryYAML(filename)
+	case ".xlsx":
+		devices, err := parseXLSX(filename)
+		if err != nil || len(devices) == 0 {
+			csvFile := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".csv"
+			if _, e := os.Stat(csvFile); e == nil {
+				return parseCSV(csvFile)
+			}
+		}
+		return devices, err
+	}
+	return parseCSV(filename)
+}
+
+func parseCSV(filename string) (map[string]DeviceInfo, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []inventoryRecord
+	for i, record := range records {
+		if i == 0 || len(record) < 2 {
+			continue
+		}
+		rows = append(rows, recordFromColumns(record))
+	}
+	return addInventoryRecords(rows), nil
+}
+
+type xlsxSST struct {
+	SI []struct {
+		T string `xml:"t"`
+	} `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	SheetData struct {
+		Rows []struct {
+			Cells []struct {
+				R string `xml:"r,attr"`
+				T string `xml:"t,attr"`
+				V string `xml:"v"`
+			} `xml:"c"`
+		} `xml:"row"`
+	} `xml:"sheetData"`
+}
+
+// readXLSXSheets reads the worksheets of a workbook in order, each row as
+// its cells by column letter
+func readXLSXSheets(filename string) ([][]map[string]string, error) {
+	r, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var sharedStrings []string
+	for _, f := range r.File {
+		if f.Name == "xl/sharedStrings.xml" {
+			rc, _ := f.Open()
+			content, _ := io.ReadAll(rc)
+			rc.Close()
+			var sst xlsxSST
+			xml.Unmarshal(content, &sst)
+			for _, si := range sst.SI {
+				sharedStrings = append(sharedStrings, si.T)
+			}
+			break
+		}
+	}
+
+	var sheets [][]map[string]string
+	for _, f := range r.File {
+		if strings.Contains(f.Name, "worksheets/sheet") {
+			rc, _ := f.Open()
+			content, _ := io.ReadAll(rc)
+			rc.Close()
+
+			var ws xlsxWorksheet
+			xml.Unmarshal(content, &ws)
+
+			var rows []map[string]string
+			for _, row := range ws.SheetData.Rows {
+				rowData := make(map[string]string)
+				for _, cell := range row.Cells {
+					col := ""
+					for _, c := range cell.R {
+						if c >= 'A' && c <= 'Z' {
+							col += string(c)
+						} else {
+							break
+						}
+					}
+					val := cell.V
+					if cell.T == "s" {
+						idx, _ := strconv.Atoi(val)
+						if idx < len(sharedStrings) {
+							val = sharedStrings[idx]
+						}
+					}
+					rowData[col] = strings.TrimSpace(val)
+				}
+				rows = append(rows, rowData)
+			}
+			sheets = append(sheets, rows)
+		}
+	}
+	return sheets, nil
+}
+
+func parseXLSX(filename string) (map[string]DeviceInfo, error) {
+	sheets, err := readXLSXSheets(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(sheets) == 0 {
+		return make(map[string]DeviceInfo), nil
+	}
+
+	var rows []inventoryRecord
+	for rowIdx, rowData := range sheets[0] {
+		if rowIdx == 0 {
+			continue
+		}
+		cols := make([]string, len(inventoryHeader))
+		for i := range cols {
+			cols[i] = rowData[xlsxColumn(i)]
+		}
+		rows = append(rows, recordFromColumns(cols))
+	}
+	return addInventoryRecords(rows), nil
+}
+
+func parseInventoryJSON(filename string) (map[string]DeviceInfo, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var records []inventoryRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("invalid inventory JSON %s: %v", filename, err)
+	}
+	return addInventoryRecords(records), nil
+}
+
+// parseInventoryYAML reads the records as a top-level list or a devices list
+func parseInventoryYAML(filename string) (map[string]DeviceInfo, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseYAML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid inventory YAML %s: %v", filename, err)
+	}
+	if m, ok := doc.(map[string]interface{}); ok {
+		doc = m["devices"]
+	}
+	list, ok := doc.([]interface{})
+	if !ok && doc != nil && doc != "" {
+		return nil, fmt.Errorf("invalid inventory YAML %s: expected a list of devices", filename)
+	}
+
+	var records []inventoryRecord
+	for i, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid inventory YAML %s: device %d is not a map", filename, i+1)
+		}
+		var r inventoryRecord
+		for key, field := range map[string]*string{
+			"hostname": &r.Hostname, "ip_address": &r.IPAddress, "device_type": &r.DeviceType,
+			"site": &r.Site, "role": &r.Role, "proxy": &r.Proxy, "key_file": &r.KeyFile,
+			"key_passphrase": &r.KeyPass, "alias": &r.Alias, "standby_ip": &r.StandbyIP,
+			"pair": &r.Pair, "ssh_algorithms": &r.SSHAlgos,
+			"transport": &r.Transport,
+		} {
+			v, err := yamlString(m, key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid inventory YAML %s: device %d: %v", filename, i+1, err)
+			}
+			*field = strings.TrimSpace(v)
+		}
+		records = append(records, r)
+	}
+	return addInventoryRecords(records), nil
+}
+
+// ============================================================================
+// VALIDATION
+// ============================================================================
+
+// validateDevice checks the fields a device needs to be collected
+func validateDevice(d DeviceInfo) error {
+	switch {
+	case !apiHostRe.MatchString(d.Hostname):
+		return fmt.Errorf("invalid hostname %q", d.Hostname)
+	case !isIPAddress(d.IPAddress):
+		return fmt.Errorf("invalid ip_address %q", d.IPAddress)
+	case d.DeviceType == "":
+		return fmt.Errorf("device_type is required")
+	case d.StandbyIP != "" && !isIPAddress(d.StandbyIP):
+		return fmt.Errorf("invalid standby_ip %q", d.StandbyIP)
+	}
+	if _, err := parseSSHAlgorithms(d.SSHAlgos); err != nil {
+		return err
+	}
+	if _, err := parseTransports(d.Transport); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateInventory lists the problems of an inventory, one line per
+// device, in hostname order; an empty list is a clean inventory
+func validateInventory(devices map[string]DeviceInfo) []string {
+	var problems []string
+	addresses := make(map[string]string)
+	aliases := make(map[string]string)
+	for _, d := range sortedDevices(devices) {
+		if err := validateDevice(d); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", d.Hostname, err))
+		}
+		for _, ip := range []string{d.IPAddress, d.StandbyIP} {
+			if ip == "" {
+				continue
+			}
+			if other, ok := addresses[ip]; ok {
+				problems = append(problems, fmt.Sprintf("%s: address %s also used by %s", d.Hostname, ip, other))
+				continue
+			}
+			addresses[ip] = d.Hostname
+		}
+		if d.Alias != "" {
+			key := strings.ToUpper(d.Alias)
+			if other, ok := aliases[key]; ok {
+				problems = append(problems, fmt.Sprintf("%s: alias %s also used by %s", d.Hostname, d.Alias, other))
+			} else {
+				aliases[key] = d.Hostname
+			}
+		}
+	}
+	return problems
+}
+
+// sortedDevices returns inventory entries ordered by hostname
+func sortedDevices(devices map[string]DeviceInfo) []DeviceInfo {
+	var list []DeviceInfo
+	for _, d := range devices {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return strings.ToUpper(list[i].Hostname) < strings.ToUpper(list[j].Hostname)
+	})
+	return list
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// INVENTORY EXPORT / SYNC (CSV <-> XLSX <-> JSON <-> YAML)
+// ============================================================================
+
+func inventoryRows(devices map[string]DeviceInfo) [][]string {
+	rows := [][]string{inventoryHeader}
+	for _, d := range sortedDevices(devices) {
+		rows = append(rows, []string{d.Hostname, d.IPAddress, d.DeviceType, d.Site, d.Role, d.Proxy, d.KeyFile, d.KeyPass, d.Alias, d.StandbyIP, d.Pair, d.SSHAlgos, d.Transport})
+	}
+	return rows
+}
+
+// saveHostInventory writes the inventory in the format implied by the file extension
+func saveHostInventory(filename string, devices map[string]DeviceInfo) error {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx":
+		return writeXLSX(filename, "Inventory", inventoryRows(devices))
+	case ".json":
+		data, err := inventoryJSON(devices)
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(filename, data)
+	case ".yaml", ".yml":
+		return writeFileAtomic(filename, inventoryYAML(devices))
+	default:
+		file, err := createAtomic(filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w := csv.NewWriter(file)
+		w.WriteAll(inventoryRows(devices))
+		return w.Error()
+	}
+}
+
+// inventoryJSON renders the canonical JSON inventory
+func inventoryJSON(devices map[string]DeviceInfo) ([]byte, error) {
+	var records []inventoryRecord
+	for _, d := range sortedDevices(devices) {
+		records = append(records, inventoryRecordOf(d))
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// inventoryYAML renders the records under a devices key, quoting every
+// value so parseInventoryYAML reads them back unchanged
+func inventoryYAML(devices map[string]DeviceInfo) []byte {
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	if len(devices) == 0 {
+		return []byte("devices: []\n")
+	}
+	var b strings.Builder
+	b.WriteString("devices:\n")
+	for _, d := range sortedDevices(devices) {
+		r := inventoryRecordOf(d)
+		prefix := "  - "
+		for _, f := range []struct{ key, value string }{
+			{"hostname", r.Hostname}, {"ip_address", r.IPAddress}, {"device_type", r.DeviceType},
+			{"site", r.Site}, {"role", r.Role}, {"proxy", r.Proxy}, {"key_file", r.KeyFile},
+			{"key_passphrase", r.KeyPass}, {"alias", r.Alias}, {"standby_ip", r.StandbyIP},
+			{"pair", r.Pair}, {"ssh_algorithms", r.SSHAlgos}, {"transport", r.Transport},
+		} {
+			if f.value == "" && f.key != "device_type" {
+				continue
+			}
+			fmt.Fprintf(&b, "%s%s: \"%s\"\n", prefix, f.key, quote.Replace(f.value))
+			prefix = "    "
+		}
+	}
+	return []byte(b.String())
+}
+
+// writeXLSX writes a single-sheet workbook using shared strings so that
+// parseXLSX (and Excel) can read it back.
+func writeXLSX(filename, sheetName string, rows [][]string) error {
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	add := func(name, content string) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(xml.Header + content))
+		return err
+	}
+
+	index := make(map[string]int)
+	var strs []string
+	var sheet strings.Builder
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range rows {
+		fmt.Fprintf(&sheet, `<row r="%d">`, r+1)
+		for c, val := range row {
+			idx, ok := index[val]
+			if !ok {
+				idx = len(strs)
+				index[val] = idx
+				strs = append(strs, val)
+			}
+			fmt.Fprintf(&sheet, `<c r="%s%d" t="s"><v>%d</v></c>`, xlsxColumn(c), r+1, idx)
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	var sst strings.Builder
+	fmt.Fprintf(&sst, `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="%d" uniqueCount="%d">`, len(strs), len(strs))
+	for _, s := range strs {
+		sst.WriteString(`<si><t xml:space="preserve">`)
+		xml.EscapeText(&sst, []byte(s))
+		sst.WriteString(`</t></si>`)
+	}
+	sst.WriteString(`</sst>`)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`<Override PartName="/xl/sharedStrings.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sharedStrings+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="` + xmlEscape(sheetName) + `" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>` +
+			`</Relationships>`},
+		{"xl/worksheets/sheet1.xml", sheet.String()},
+		{"xl/sharedStrings.xml", sst.String()},
+	}
+	for _, p := range parts {
+		if err := add(p.name, p.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// xlsxColumn converts a zero-based column index to a spreadsheet column (0 -> A, 26 -> AA)
+func xlsxColumn(idx int) string {
+	col := ""
+	for idx >= 0 {
+		col = string(rune('A'+idx%26)) + col
+		idx = idx/26 - 1
+	}
+	return col
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// syncInventories reconciles two inventory files interactively and writes
+// the agreed result back to both, so the toolkit and health check stop drifting.
+func syncInventories(primaryFile, otherFile string) error {
+	primary, err := loadHostInventory(primaryFile)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %v", primaryFile, err)
+	}
+	other, err := loadHostInventory(otherFile)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %v", otherFile, err)
+	}
+
+	keys := make(map[string]bool)
+	for k := range primary {
+		keys[k] = true
+	}
+	for k := range other {
+		keys[k] = true
+	}
+	var sortedKeys []string
+	for k := range keys {
+		sortedKeys = append(sortedKeys, k)
+	}
+	sort.Strings(sortedKeys)
+
+	merged := make(map[string]DeviceInfo)
+	reader := bufio.NewReader(os.Stdin)
+	diffs := 0
+
+	for _, key := range sortedKeys {
+		a, inA := primary[key]
+		b, inB := other[key]
+		if inA && inB && sameInventoryEntry(a, b) {
+			merged[key] = a
+			continue
+		}
+		diffs++
+
+		fmt.Printf("\n--- %s ---\n", key)
+		fmt.Printf("  [1] %-30s %s\n", filepath.Base(primaryFile), describeInventoryEntry(a, inA))
+		fmt.Printf("  [2] %-30s %s\n", filepath.Base(otherFile), describeInventoryEntry(b, inB))
+		fmt.Print("  Keep which? [1/2/s=skip device] (default 1): ")
+
+		choice, _ := reader.ReadString('\n')
+		switch strings.TrimSpace(strings.ToLower(choice)) {
+		case "2":
+			if inB {
+				merged[key] = b
+			}
+		case "s":
+			// device is dropped from both files
+		default:
+			if inA {
+				merged[key] = a
+			}
+		}
+	}
+
+	if diffs == 0 {
+		log.Printf("✓ Inventories already in sync (%d devices)", len(merged))
+		return nil
+	}
+
+	if err := saveHostInventory(primaryFile, merged); err != nil {
+		return err
+	}
+	if err := saveHostInventory(otherFile, merged); err != nil {
+		return err
+	}
+	log.Printf("✓ Reconciled %d differences; %d devices written to %s and %s",
+		diffs, len(merged), primaryFile, otherFile)
+	return nil
+}
+
+func sameInventoryEntry(a, b DeviceInfo) bool {
+	return a.Hostname == b.Hostname && a.IPAddress == b.IPAddress &&
+		a.DeviceType == b.DeviceType && a.Site == b.Site && a.Role == b.Role &&
+		a.Proxy == b.Proxy && a.KeyFile == b.KeyFile && a.KeyPass == b.KeyPass && a.Alias == b.Alias &&
+		a.StandbyIP == b.StandbyIP && a.Pair == b.Pair && a.SSHAlgos == b.SSHAlgos &&
+		a.Transport == b.Transport
+}
+
+func describeInventoryEntry(d DeviceInfo, present bool) string {
+	if !present {
+		return "(missing)"
+	}
+	return fmt.Sprintf("%s %s %s %s %s", d.Hostname, d.IPAddress, d.DeviceType, d.Site, d.Role)
+}
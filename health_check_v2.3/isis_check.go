@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// IS-IS NEIGHBOR CHECK (ISIS_<ts>.log)
+// ============================================================================
+//
+// Parts of the core run IS-IS instead of OSPF. Both command files collect
+// "show isis neighbors"; a device is checked when it runs IS-IS, i.e. its
+// neighbor output shows an IS-IS instance or its running config has a
+// "router isis" section. Devices running only OSPF are left out, so nothing
+// needs to be selected per device. Per device:
+//
+//   OK             every adjacency is Up
+//   DEGRADED       some adjacencies are not Up (Init, Down)
+//   DOWN           IS-IS runs but no adjacency is Up
+//   NOT_COLLECTED  IS-IS configured, but no neighbor output (command
+//                  missing or rejected, device not collected)
+//
+// The adjacency counts also go into the SUMMARY (ISIS_Adjacencies_Total,
+// ISIS_Adjacencies_Up, ISIS_L1_Up, ISIS_L2_Up), so the baseline and the
+// pre/post comparison cover IS-IS like OSPF, and window mode samples
+// ISIS_Adjacencies_Up by default.
+
+// ISISRow is the IS-IS state of one device
+type ISISRow struct {
+	Hostname  string
+	Site      string
+	OS        string
+	Instances string
+	Total     int
+	Up        int
+	L1Up      int
+	L2Up      int
+	Status    string // OK, DEGRADED, DOWN, NOT_COLLECTED
+	Reasons   []string
+}
+
+// isisConfigured reports whether a running config has a "router isis"
+// section
+func isisConfigured(config string) bool {
+	for _, line := range strings.Split(config, "\n") {
+		if strings.HasPrefix(line, "router isis") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkISIS judges the devices that run IS-IS; the second result counts
+// the collected devices that do not
+func checkISIS(results []*DeviceResult) ([]ISISRow, int) {
+	var rows []ISISRow
+	other := 0
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		configured, collected := false, false
+		var table ISISNeighborTable
+		for _, e := range r.Results {
+			cmd := strings.ToLower(e.Command)
+			if isCommandRejected(e.Output) {
+				continue
+			}
+			switch {
+			case metricCategory(cmd) == "isis":
+				// SR's "adjacency detail" and the plain table list the
+				// same adjacencies; keep the first collected
+				if t := parseISISNeighbors(e.Output); t.Running && !collected {
+					table, collected = t, true
+				}
+			case strings.HasPrefix(cmd, "show running-config"):
+				configured = configured || isisConfigured(e.Output)
+			}
+		}
+		if !collected && !configured {
+			other++
+			continue
+		}
+
+		row := ISISRow{Hostname: r.Device.Hostname, Site: r.Device.Site, OS: r.Device.DetectedOS,
+			Total: len(table.Neighbors), Up: table.UpCount(""), L1Up: table.UpCount("1"), L2Up: table.UpCount("2")}
+		tags := make(map[string]bool)
+		for _, nb := range table.Neighbors {
+			if nb.Tag != "" && !tags[nb.Tag] {
+				tags[nb.Tag] = true
+				row.Instances = strings.TrimPrefix(row.Instances+","+nb.Tag, ",")
+			}
+			if !nb.Up() {
+				row.Reasons = append(row.Reasons, fmt.Sprintf("%s on %s is %s", nb.SystemID, nb.Interface, nb.State))
+			}
+		}
+		switch {
+		case !collected:
+			row.Status = "NOT_COLLECTED"
+			row.Reasons = append(row.Reasons, "router isis configured, but no IS-IS neighbor output collected")
+		case row.Up == 0:
+			row.Status = "DOWN"
+			if row.Total == 0 {
+				row.Reasons = append(row.Reasons, "no IS-IS adjacencies")
+			}
+		case row.Up < row.Total:
+			row.Status = "DEGRADED"
+		default:
+			row.Status = "OK"
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Hostname < rows[j].Hostname })
+	return rows, other
+}
+
+// WriteISIS writes ISIS_<ts>.log
+func (w *OutputWriter) WriteISIS(rows []ISISRow, other int) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("ISIS_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	counts := make(map[string]int)
+	for _, r := range rows {
+		counts[r.Status]++
+	}
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO IS-IS Neighbor Check\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, " OK: %d | DEGRADED: %d | DOWN: %d | NOT_COLLECTED: %d | not running IS-IS: %d\n",
+		counts["OK"], counts["DEGRADED"], counts["DOWN"], counts["NOT_COLLECTED"], other)
+	fmt.Fprintf(file, "================================================================================\n\n")
+
+	table := newTextTable("HOSTNAME", "OS", "INSTANCE", "ADJACENCIES", "UP", "L1 UP", "L2 UP", "STATUS")
+	for _, r := range rows {
+		table.add(r.Site, displayHost(r.Hostname), r.OS, orDash(r.Instances), r.Total, r.Up, r.L1Up, r.L2Up, r.Status)
+		for _, reason := range r.Reasons {
+			table.note("    - %s", reason)
+		}
+	}
+	table.write(file)
+	return nil
+}
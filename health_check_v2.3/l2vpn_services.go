@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// L2VPN SERVICE BASELINE (L2VPN_<ts>.csv) AND PRE/POST SERVICE CHECK
+// ============================================================================
+//
+// The teleprotection circuits ride on xconnects, and the SUMMARY only counts
+// lines with UP and DOWN in them. Every run therefore also writes
+// L2VPN_<ts>.csv with the state of each service:
+//
+//   IOS-XR  show l2vpn xconnect detail   group/xconnect, AC and PW state and
+//                                        the PW's last status change
+//           show evpn evi                EVPN instances
+//   IOS-XE  show xconnect all            xconnect, segment states
+//           show l2vpn evpn evi          EVPN instances
+//
+// and comparePhases checks them service by service:
+//
+//   FAIL  up before, down (or gone) after
+//   FAIL  down before and still down after
+//   WARN  up before and after, but the PW status changed after the pre-check
+//         ran (it flapped during the window; XR only, XE has no change time
+//         in the table)
+//
+// Keep those commands in the command files. Services that are new in the
+// post run are not judged. Hosts without service data in the post run (not
+// collected) are skipped.
+
+const (
+	l2vpnCommand        = "l2vpn services"
+	l2vpnBaselinePrefix = "L2VPN_"
+	l2vpnBaselineCols   = "Hostname,Type,Service,State,Segment1,Segment2,LastChange"
+	l2vpnTimeLayout     = "2006-01-02 15:04:05"
+)
+
+var (
+	xrXCGroupRe  = regexp.MustCompile(`^Group (\S+), XC (\S+), state is (\w+)`)
+	xrXCACRe     = regexp.MustCompile(`^\s+AC: ([^,]+), state is (\w+)`)
+	xrXCPWRe     = regexp.MustCompile(`^\s+(?:PW|EVPN): neighbor (\S+), PW ID:? ([^,]+(?:, ac-id \d+)?), state is (\w+)`)
+	xrXCChangeRe = regexp.MustCompile(`Last time status changed: .*\((\S+) ago\)`)
+	xeXCRowRe    = regexp.MustCompile(`^\s*(UP|DN|AD|IA|SB|HS|RV|NH)\s+\S+\s+(.+?)\s+(UP|DN|AD|IA|SB|HS|RV|NH)\s+(.+?)\s+(UP|DN|AD|IA|SB|HS|RV|NH)\s*$`)
+	ciscoAgeRe   = regexp.MustCompile(`(\d+)([ywdhms])`)
+)
+
+// L2VPNService is the state of one xconnect or EVPN instance
+type L2VPNService struct {
+	Type       string // xconnect, evi
+	Name       string // GROUP/XC, EVI id
+	State      string // up, down, ...
+	Segment1   string
+	Segment2   string
+	LastChange time.Time // PW status change (XR), zero = unknown
+}
+
+// l2vpnKey identifies a service across runs
+type l2vpnKey struct {
+	Host, Type, Name string
+}
+
+// parseCiscoAge reads the ages Cisco prints: 00:05:12, 1d02h, 6w0d, 1y2w
+func parseCiscoAge(s string) (time.Duration, bool) {
+	if p := strings.Split(s, ":"); len(p) == 3 {
+		h, err1 := strconv.Atoi(p[0])
+		m, err2 := strconv.Atoi(p[1])
+		sec, err3 := strconv.Atoi(p[2])
+		if err1 != nil || err2 != nil || err3 != nil {
+			return 0, false
+		}
+		return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second, true
+	}
+	units := map[string]time.Duration{"y": 365 * 24 * time.Hour, "w": 7 * 24 * time.Hour, "d": 24 * time.Hour,
+		"h": time.Hour, "m": time.Minute, "s": time.Second}
+	matches := ciscoAgeRe.FindAllStringSubmatch(s, -1)
+	if len(matches) == 0 {
+		return 0, false
+	}
+	var d time.Duration
+	for _, m := range matches {
+		n, _ := strconv.Atoi(m[1])
+		d += time.Duration(n) * units[m[2]]
+	}
+	return d, true
+}
+
+// xeStateName spells out the XE two-letter states
+func xeStateName(s string) string {
+	switch s {
+	case "UP":
+		return "up"
+	case "DN":
+		return "down"
+	case "AD":
+		return "admin-down"
+	}
+	return strings.ToLower(s)
+}
+
+// parseL2VPNServices reads the service outputs of a device; collectedAt
+// turns the XR "(... ago)" change times into timestamps
+func parseL2VPNServices(results []ExecutionResult, collectedAt time.Time) []L2VPNService {
+	var services []L2VPNService
+	for _, e := range results {
+		cmd := strings.ToLower(e.Command)
+		if isCommandRejected(e.Output) {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(cmd, "show l2vpn xconnect detail"):
+			var cur *L2VPNService
+			for _, line := range strings.Split(e.Output, "\n") {
+				if m := xrXCGroupRe.FindStringSubmatch(line); m != nil {
+					services = append(services, L2VPNService{Type: "xconnect", Name: m[1] + "/" + m[2], State: m[3]})
+					cur = &services[len(services)-1]
+					continue
+				}
+				if cur == nil {
+					continue
+				}
+				if m := xrXCACRe.FindStringSubmatch(line); m != nil && cur.Segment1 == "" {
+					cur.Segment1 = m[1] + " " + m[2]
+				}
+				if m := xrXCPWRe.FindStringSubmatch(line); m != nil && cur.Segment2 == "" {
+					cur.Segment2 = m[1] + " " + m[2] + " " + m[3]
+				}
+				if m := xrXCChangeRe.FindStringSubmatch(line); m != nil && cur.LastChange.IsZero() {
+					if age, ok := parseCiscoAge(m[1]); ok {
+						cur.LastChange = collectedAt.Add(-age).Truncate(time.Second)
+					}
+				}
+			}
+		case strings.HasPrefix(cmd, "show xconnect all"):
+			for _, line := range strings.Split(e.Output, "\n") {
+				if m := xeXCRowRe.FindStringSubmatch(line); m != nil {
+					services = append(services, L2VPNService{Type: "xconnect", Name: m[2] + " " + m[4], State: xeStateName(m[1]),
+						Segment1: m[2] + " " + xeStateName(m[3]), Segment2: m[4] + " " + xeStateName(m[5])})
+				}
+			}
+		case strings.Contains(cmd, "evpn evi"):
+			for _, line := range strings.Split(e.Output, "\n") {
+				f := strings.Fields(line)
+				if len(f) < 2 {
+					continue
+				}
+				if _, err := strconv.Atoi(f[0]); err != nil {
+					continue
+				}
+				svc := L2VPNService{Type: "evi", Name: f[0], State: "up", Segment1: strings.Join(f[1:], " ")}
+				for _, field := range f[1:] {
+					if strings.EqualFold(field, "down") || field == "DN" {
+						svc.State = "down"
+					}
+				}
+				services = append(services, svc)
+			}
+		}
+	}
+	return services
+}
+
+// WriteL2VPN writes L2VPN_<ts>.csv, the per-service baseline
+func (w *OutputWriter) WriteL2VPN(results []*DeviceResult) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("%s%s.csv", l2vpnBaselinePrefix, w.timestamp))
+	collectedAt, _ := time.ParseInLocation("20060102_150405", w.timestamp, time.Local)
+	rows := [][]string{strings.Split(l2vpnBaselineCols, ",")}
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		services := parseL2VPNServices(r.Results, collectedAt)
+		for _, s := range services {
+			change := ""
+			if !s.LastChange.IsZero() {
+				change = s.LastChange.Format(l2vpnTimeLayout)
+			}
+			rows = append(rows, []string{r.Device.Hostname, s.Type, s.Name, s.State, s.Segment1, s.Segment2, change})
+		}
+	}
+	return writeCSVRows(filename, rows)
+}
+
+// loadL2VPNBaseline reads the L2VPN csv of a run and the time it was
+// collected; nil when the run has none (older runs)
+func loadL2VPNBaseline(dir string) (map[l2vpnKey]L2VPNService, time.Time, error) {
+	rows, collectedAt, err := latestRunCSV(dir, l2vpnBaselinePrefix, 7)
+	if rows == nil || err != nil {
+		return nil, collectedAt, err
+	}
+
+	services := make(map[l2vpnKey]L2VPNService)
+	for _, rec := range rows {
+		s := L2VPNService{Type: rec[1], Name: rec[2], State: rec[3], Segment1: rec[4], Segment2: rec[5]}
+		if rec[6] != "" {
+			s.LastChange, _ = time.ParseInLocation(l2vpnTimeLayout, rec[6], time.Local)
+		}
+		services[l2vpnKey{rec[0], rec[1], rec[2]}] = s
+	}
+	return services, collectedAt, nil
+}
+
+// compareL2VPN returns the service findings between two runs
+func compareL2VPN(pre, post map[l2vpnKey]L2VPNService, preTime time.Time) []PhaseDelta {
+	collected := make(map[string]bool)
+	for k := range post {
+		collected[k.Host] = true
+	}
+	var keys []l2vpnKey
+	for k := range pre {
+		if collected[k.Host] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Host != keys[j].Host {
+			return keys[i].Host < keys[j].Host
+		}
+		return keys[i].Type+keys[i].Name < keys[j].Type+keys[j].Name
+	})
+
+	var deltas []PhaseDelta
+	add := func(k l2vpnKey, pre, post, status, reason string) {
+		deltas = append(deltas, PhaseDelta{
+			goldenKey: goldenKey{Host: k.Host, Command: l2vpnCommand, Metric: k.Type + " " + k.Name},
+			Pre:       pre, Post: post, Status: status, Reason: reason,
+		})
+	}
+	for _, k := range keys {
+		before := pre[k]
+		after, ok := post[k]
+		wasUp := strings.EqualFold(before.State, "up")
+		switch {
+		case !ok:
+			if wasUp {
+				add(k, before.State, "", "FAIL", k.Type+" was up before and is gone after")
+			}
+		case !strings.EqualFold(after.State, "up"):
+			if wasUp {
+				add(k, before.State, after.State, "FAIL", k.Type+" was up before and is down after")
+			} else {
+				add(k, before.State, after.State, "FAIL", k.Type+" stayed down")
+			}
+		case wasUp && !preTime.IsZero() && after.LastChange.After(preTime):
+			add(k, before.State, after.State, "WARN", fmt.Sprintf("PW status changed at %s, after the pre-check: it flapped",
+				after.LastChange.Format(l2vpnTimeLayout)))
+		}
+	}
+	return deltas
+}
+
+// compareL2VPNRuns loads and compares the service baselines of two runs;
+// nothing is compared when either run has none
+func compareL2VPNRuns(preDir, postDir string) []PhaseDelta {
+	pre, preTime, err1 := loadL2VPNBaseline(preDir)
+	post, _, err2 := loadL2VPNBaseline(postDir)
+	if runCheckSkipped("L2VPN service", l2vpnBaselinePrefix, err1, err2, pre != nil, post != nil) {
+		return nil
+	}
+	return compareL2VPN(pre, post, preTime)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// LOGGING EVENTS IN THE CHANGE WINDOW (-log-window)
+// ============================================================================
+//
+// The logging buffer holds days of history, so counting every flap in it
+// says little about the change. With -log-window FROM[,TO] (local time,
+// "2006-01-02 15:04"; TO defaults to now) the run adds "show logging" to the
+// IOS-XR and IOS-XE command sets and counts only the events stamped inside
+// the window:
+//
+//   interface flap   %LINK-3-UPDOWN / %PKT_INFRA-LINK-3-UPDOWN ... down
+//   BGP reset        %BGP-5-ADJCHANGE / %ROUTING-BGP-5-ADJCHANGE ... Down
+//   OSPF down        %OSPF-5-ADJCHG / %ROUTING-OSPF-5-ADJCHG ... from FULL
+//   IS-IS down       %CLNS-5-ADJCHANGE / %ROUTING-ISIS-5-ADJCHANGE ... Down
+//   LDP down         %LDP-5-NBRCHG / %ROUTING-LDP-5-NBR_CHANGE ... DOWN
+//
+// Syslog stamps have no year; it is taken from the window end (the year
+// before for stamps that would lie in the future). A stamp marked UTC or GMT
+// is read as such, any other as local time. A device is OK without events
+// in the window and EVENTS with them; LOG_EVENTS_<ts>.log lists them per
+// object with the first and last time, and says when the buffer starts
+// after the window start, so events may have rolled out of it.
+
+const logWindowLayout = "2006-01-02 15:04"
+
+var logEventCommands = map[string][]string{
+	"IOS-XR": {"show logging"},
+	"IOS-XE": {"show logging"},
+}
+
+// logEventKinds classify a logging line; submatch 1 is the object
+var logEventKinds = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{"interface flap", regexp.MustCompile(`%(?:PKT_INFRA-)?LINK-\d-UPDOWN\s*:\s*Interface (\S+?), changed state to [Dd]own`)},
+	{"BGP reset", regexp.MustCompile(`%(?:ROUTING-)?BGP-5-ADJCHANGE\s*:\s*neighbor (\S+)(?: vpn vrf \S+)? Down`)},
+	{"OSPF down", regexp.MustCompile(`%(?:ROUTING-)?OSPF-5-ADJCHG\s*:.*?Nbr (\S+ on \S+).* from FULL to`)},
+	{"IS-IS down", regexp.MustCompile(`%(?:ROUTING-ISIS|CLNS)-5-ADJCHANGE\s*:\s*(?:ISIS: )?Adjacency to (\S+ \(\S+\)).*\bDown`)},
+	{"LDP down", regexp.MustCompile(`%(?:ROUTING-LDP-5-NBR_CHANGE|LDP-5-NBRCHG)\s*:\s*(?:LDP )?Neighbor (\S+?),? .*\bDOWN`)},
+}
+
+var logStampRe = regexp.MustCompile(`(?:^|[\s*:])(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec)\s+(\d{1,2})\s+(?:(\d{4})\s+)?(\d{1,2}:\d{2}:\d{2})(?:\.\d+)?(?:\s+([A-Z]{3,4}))?`)
+
+// logWindow is the parsed -log-window
+type logWindow struct {
+	From, To time.Time
+}
+
+// parseLogWindow reads FROM[,TO]; an empty value is no window
+func parseLogWindow(s string) (*logWindow, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	from, to, _ := strings.Cut(s, ",")
+	w := &logWindow{To: time.Now()}
+	var err error
+	if w.From, err = time.ParseInLocation(logWindowLayout, strings.TrimSpace(from), time.Local); err != nil {
+		return nil, fmt.Errorf("%q: expected FROM[,TO] as %q", s, logWindowLayout)
+	}
+	if strings.TrimSpace(to) != "" {
+		if w.To, err = time.ParseInLocation(logWindowLayout, strings.TrimSpace(to), time.Local); err != nil {
+			return nil, fmt.Errorf("%q: expected FROM[,TO] as %q", s, logWindowLayout)
+		}
+	}
+	if !w.To.After(w.From) {
+		return nil, fmt.Errorf("%q: window ends before it starts", s)
+	}
+	return w, nil
+}
+
+func (w *logWindow) String() string {
+	return w.From.Format(logWindowLayout) + " - " + w.To.Format(logWindowLayout)
+}
+
+func addLogEventCommands(cs *CommandSet) {
+	cs.IOSXR = mergeCommands(cs.IOSXR, logEventCommands["IOS-XR"])
+	cs.IOSXE = mergeCommands(cs.IOSXE, logEventCommands["IOS-XE"])
+}
+
+// parseLogStamp reads the syslog time of a line; the year comes from ref
+func parseLogStamp(line string, ref time.Time) (time.Time, bool) {
+	m := logStampRe.FindStringSubmatch(line)
+	if m == nil {
+		return time.Time{}, false
+	}
+	loc := time.Local
+	if m[5] == "UTC" || m[5] == "GMT" {
+		loc = time.UTC
+	}
+	year := m[3]
+	if year == "" {
+		year = fmt.Sprint(ref.Year())
+	}
+	t, err := time.ParseInLocation("Jan 2 2006 15:04:05", fmt.Sprintf("%s %s %s %s", m[1], m[2], year, m[4]), loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if m[3] == "" && t.After(ref.Add(48*time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, true
+}
+
+// LogEventCount is one object's events of one kind in the window
+type LogEventCount struct {
+	Kind, Object string
+	Count        int
+	First, Last  time.Time
+}
+
+// LogEventRow is the window events of one device
+type LogEventRow struct {
+	Hostname string
+	Site     string
+	OS       string
+	Events   []LogEventCount
+	Before   int       // classified events before the window
+	After    int       // classified events after the window
+	Oldest   time.Time // oldest stamped line in the buffer
+	Status   string    // OK, EVENTS, NOT_COLLECTED
+	Reasons  []string
+}
+
+// Total is the number of events in the window
+func (r LogEventRow) Total() int {
+	n := 0
+	for _, e := range r.Events {
+		n += e.Count
+	}
+	return n
+}
+
+// checkLogEvents counts the logging events of every XR/XE device in w
+func checkLogEvents(results []*DeviceResult, w *logWindow) []LogEventRow {
+	var rows []LogEventRow
+	for _, r := range results {
+		if r.Device.DetectedOS != "IOS-XR" && r.Device.DetectedOS != "IOS-XE" {
+			continue
+		}
+		rows = append(rows, parseLogEvents(r, w))
+	}
+	return rows
+}
+
+func parseLogEvents(r *DeviceResult, w *logWindow) LogEventRow {
+	row := LogEventRow{Hostname: r.Device.Hostname, Site: r.Device.Site, OS: r.Device.DetectedOS, Status: "NOT_COLLECTED"}
+	byKey := make(map[string]*LogEventCount)
+	for _, e := range r.Results {
+		if !strings.HasPrefix(strings.ToLower(e.Command), "show logging") || isCommandRejected(e.Output) {
+			continue
+		}
+		row.Status = "OK"
+		for _, line := range strings.Split(e.Output, "\n") {
+			at, ok := parseLogStamp(line, w.To)
+			if !ok {
+				continue
+			}
+			if row.Oldest.IsZero() || at.Before(row.Oldest) {
+				row.Oldest = at
+			}
+			for _, k := range logEventKinds {
+				m := k.re.FindStringSubmatch(line)
+				if m == nil {
+					continue
+				}
+				switch {
+				case at.Before(w.From):
+					row.Before++
+				case at.After(w.To):
+					row.After++
+				default:
+					key := k.kind + "\x00" + m[1]
+					c, ok := byKey[key]
+					if !ok {
+						c = &LogEventCount{Kind: k.kind, Object: m[1], First: at}
+						byKey[key] = c
+					}
+					c.Count++
+					if at.Before(c.First) {
+						c.First = at
+					}
+					if at.After(c.Last) {
+						c.Last = at
+					}
+				}
+				break
+			}
+		}
+	}
+	if row.Status == "NOT_COLLECTED" {
+		row.Reasons = append(row.Reasons, "show logging not collected or rejected")
+		return row
+	}
+
+	for _, c := range byKey {
+		row.Events = append(row.Events, *c)
+	}
+	sort.Slice(row.Events, func(i, j int) bool {
+		if row.Events[i].Kind != row.Events[j].Kind {
+			return row.Events[i].Kind < row.Events[j].Kind
+		}
+		return row.Events[i].Object < row.Events[j].Object
+	})
+	if len(row.Events) > 0 {
+		row.Status = "EVENTS"
+	}
+	if row.Oldest.After(w.From) {
+		row.Reasons = append(row.Reasons, fmt.Sprintf("buffer starts at %s, after the window start: earlier events may have rolled out",
+			row.Oldest.Format("2006-01-02 15:04:05")))
+	}
+	return row
+}
+
+// WriteLogEvents writes LOG_EVENTS_<ts>.log
+func (w *OutputWriter) WriteLogEvents(rows []LogEventRow, win *logWindow) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("LOG_EVENTS_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	counts := make(map[string]int)
+	for _, r := range rows {
+		counts[r.Status]++
+	}
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Logging Events in the Change Window\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, " Window: %s\n", win)
+	fmt.Fprintf(file, " OK: %d | EVENTS: %d | NOT_COLLECTED: %d\n", counts["OK"], counts["EVENTS"], counts["NOT_COLLECTED"])
+	fmt.Fprintf(file, "================================================================================\n\n")
+
+	table := newTextTable("HOSTNAME", "OS", "IN WINDOW", "BEFORE", "AFTER", "STATUS").alignRight(2, 3, 4)
+	for _, r := range rows {
+		table.add(r.Site, displayHost(r.Hostname), r.OS, r.Total(), r.Before, r.After, r.Status)
+		for _, e := range r.Events {
+			table.note("    - %-14s %-40s %3dx  %s .. %s", e.Kind, e.Object, e.Count,
+				e.First.Format("01-02 15:04:05"), e.Last.Format("01-02 15:04:05"))
+		}
+		for _, reason := range r.Reasons {
+			table.note("    - %s", reason)
+		}
+	}
+	table.write(file)
+	return nil
+}
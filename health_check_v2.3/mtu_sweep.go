@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// CORE LINK MTU SWEEP (-mtu-sweep)
+// ============================================================================
+//
+// A core link that cannot carry jumbo MPLS frames passes every ping of the
+// command files and still drops the labelled traffic after the cutover.
+// -mtu-sweep tests every core link of the targets and exits:
+//
+//   1. the links are read from "show ipv4 interface" (XR) / "show ip
+//      interface" (XE) of the devices whose role (inventory Role, else
+//      Device_Type) is in -mtu-roles (all targets when empty): every
+//      interface that is up/up with a /30 or /31 address, loopbacks and
+//      management ports left out. The far end is the other address of the
+//      subnet; a link between two swept devices is tested once.
+//   2. from the near end, a df-bit ping of -mtu-required bytes (9114 by
+//      default, the IP packet size as ping counts it) is sent to the far
+//      end; when it does not pass, a binary search between 1500 and
+//      -mtu-required finds the largest size that does:
+//
+//        IOS-XR   ping A size N donnotfrag count 2 timeout 1
+//        IOS-XE   ping A size N df-bit repeat 2 timeout 1
+//
+// Devices are swept -w at a time over persistent sessions, their links one
+// after the other. A link is PASS when the required size gets through, FAIL
+// when only a smaller one does and DOWN when not even 1500 bytes do. The
+// table is printed and written to <output>/mtu_sweep/MTU_SWEEP_<ts>.log and
+// .csv; the exit status is 1 when any link did not pass.
+
+const (
+	mtuSweepDirName = "mtu_sweep"
+	mtuSweepFloor   = 1500
+)
+
+var (
+	ipIfHeaderRe = regexp.MustCompile(`(?i)^(\S+) is (up|down|administratively down|shutdown), (?:line |ipv4 )?protocol is (\w+)`)
+	ipIfAddrRe   = regexp.MustCompile(`Internet address is (\d+\.\d+\.\d+\.\d+)/(\d+)`)
+	ipIfMTURe    = regexp.MustCompile(`MTU is (\d+)(?: \((\d+) is available to IP\))?`)
+	mtuSkipIfRe  = regexp.MustCompile(`(?i)^(loopback|mgmt|null|bvi|tunnel|vlan)`)
+)
+
+// MTULink is one core link and its sweep result
+type MTULink struct {
+	Hostname    string
+	Site        string
+	Interface   string
+	Address     string
+	IPMTU       int // as the interface reports it, 0 = unknown
+	Peer        string
+	PeerAddress string
+	Largest     int // largest df-bit size that passed, 0 = none
+	Status      string
+	Error       string
+	device      DeviceInfo
+}
+
+// ipInterface is an addressed interface of "show ip(v4) interface"
+type ipInterface struct {
+	Name, Address string
+	PrefixLen     int
+	IPMTU         int
+	Up            bool
+}
+
+// ipInterfaceCommand lists the addressed interfaces of a device
+func ipInterfaceCommand(d DeviceInfo) string {
+	if d.DetectedOS == "IOS-XR" {
+		return "show ipv4 interface"
+	}
+	return "show ip interface"
+}
+
+// parseIPInterfaces reads the interfaces of "show ip(v4) interface"
+func parseIPInterfaces(output string) []ipInterface {
+	var ifs []ipInterface
+	var cur *ipInterface
+	for _, line := range strings.Split(output, "\n") {
+		if m := ipIfHeaderRe.FindStringSubmatch(strings.TrimRight(line, "\r")); m != nil {
+			ifs = append(ifs, ipInterface{Name: m[1], Up: strings.EqualFold(m[2], "up") && strings.EqualFold(m[3], "up")})
+			cur = &ifs[len(ifs)-1]
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		if m := ipIfAddrRe.FindStringSubmatch(line); m != nil && cur.Address == "" {
+			cur.Address = m[1]
+			cur.PrefixLen, _ = strconv.Atoi(m[2])
+		}
+		if m := ipIfMTURe.FindStringSubmatch(line); m != nil {
+			cur.IPMTU, _ = strconv.Atoi(m[1])
+			if m[2] != "" {
+				cur.IPMTU, _ = strconv.Atoi(m[2])
+			}
+		}
+	}
+	return ifs
+}
+
+// p2pPeer is the other address of a /30 or /31 subnet
+func p2pPeer(address string, prefixLen int) (string, bool) {
+	ip := net.ParseIP(address).To4()
+	if ip == nil || (prefixLen != 30 && prefixLen != 31) {
+		return "", false
+	}
+	n := binary.BigEndian.Uint32(ip)
+	switch {
+	case prefixLen == 31:
+		n ^= 1
+	case n&3 == 1:
+		n++
+	case n&3 == 2:
+		n--
+	default:
+		return "", false
+	}
+	peer := make(net.IP, 4)
+	binary.BigEndian.PutUint32(peer, n)
+	return peer.String(), true
+}
+
+// mtuSweepDevices are the targets whose role is in -mtu-roles
+func mtuSweepDevices(config *Config, devices []DeviceInfo) []DeviceInfo {
+	roles := make(map[string]bool)
+	for _, r := range strings.Split(config.MTURoles, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			roles[strings.ToUpper(r)] = true
+		}
+	}
+	var out []DeviceInfo
+	for _, d := range devices {
+		if d.DetectedOS != "IOS-XR" && d.DetectedOS != "IOS-XE" {
+			continue
+		}
+		if len(roles) == 0 || roles[strings.ToUpper(deviceRole(d))] {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// discoverCoreLinks reads the point-to-point links of the devices; a link
+// between two of them is kept once, on the side with the lower hostname
+func discoverCoreLinks(config *Config, devices []DeviceInfo) []MTULink {
+	var mu sync.Mutex
+	var links []MTULink
+	owner := make(map[string]string) // interface address -> hostname
+	forEachDevice(config, devices, func(d DeviceInfo) {
+		command := ipInterfaceCommand(d)
+		outputs, err := newDeviceClient(d, config).ExecuteCommands([]string{command})
+		if err != nil || isCommandRejected(outputs[command]) {
+			log.Printf("✗ %s: interfaces not read: %v", d.Hostname, firstError(err, fmt.Errorf("%s rejected", command)))
+			return
+		}
+		var found []MTULink
+		for _, i := range parseIPInterfaces(outputs[command]) {
+			if !i.Up || i.Address == "" || mtuSkipIfRe.MatchString(i.Name) {
+				continue
+			}
+			peer, ok := p2pPeer(i.Address, i.PrefixLen)
+			if !ok {
+				continue
+			}
+			found = append(found, MTULink{Hostname: d.Hostname, Site: d.Site, Interface: i.Name, Address: i.Address,
+				IPMTU: i.IPMTU, PeerAddress: peer, device: d})
+		}
+		mu.Lock()
+		links = append(links, found...)
+		for _, l := range found {
+			owner[l.Address] = d.Hostname
+		}
+		mu.Unlock()
+	})
+
+	var kept []MTULink
+	for _, l := range links {
+		l.Peer = owner[l.PeerAddress]
+		if l.Peer != "" && l.Peer < l.Hostname {
+			continue
+		}
+		kept = append(kept, l)
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		if kept[i].Hostname != kept[j].Hostname {
+			return kept[i].Hostname < kept[j].Hostname
+		}
+		return kept[i].Interface < kept[j].Interface
+	})
+	return kept
+}
+
+// mtuPing is the df-bit ping of one size
+func mtuPing(d DeviceInfo, address string, size int) string {
+	return expandCommand(fmt.Sprintf("ping %s size %d {df} {count} 2 timeout 1", address, size), d.DetectedOS)
+}
+
+// sweepLink finds the largest df-bit size the link carries, up to required
+func sweepLink(client *SSHClient, l *MTULink, required int) {
+	passes := func(size int) (bool, error) {
+		command := mtuPing(l.device, l.PeerAddress, size)
+		outputs, err := client.ExecuteCommands([]string{command})
+		if err != nil {
+			return false, err
+		}
+		p, ok := parsePingOutput(command, outputs[command])
+		if !ok {
+			return false, fmt.Errorf("no ping result for %q", command)
+		}
+		return p.Received > 0, nil
+	}
+
+	ok, err := passes(required)
+	switch {
+	case err != nil:
+		l.Status, l.Error = "NO_DATA", err.Error()
+		return
+	case ok:
+		l.Status, l.Largest = "PASS", required
+		return
+	}
+	if ok, err = passes(mtuSweepFloor); err != nil {
+		l.Status, l.Error = "NO_DATA", err.Error()
+		return
+	} else if !ok {
+		l.Status, l.Error = "DOWN", fmt.Sprintf("no df-bit reply at %d bytes", mtuSweepFloor)
+		return
+	}
+	lo, hi := mtuSweepFloor, required // lo passes, hi fails
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if ok, err = passes(mid); err != nil {
+			l.Status, l.Error = "NO_DATA", err.Error()
+			return
+		} else if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	l.Status, l.Largest = "FAIL", lo
+	l.Error = fmt.Sprintf("largest df-bit packet %d bytes, %d short of %d", lo, required-lo, required)
+}
+
+// runMTUSweep discovers and tests the core links, writes the table and
+// reports the links that did not pass
+func runMTUSweep(config *Config, targets []DeviceInfo) error {
+	devices := mtuSweepDevices(config, targets)
+	if len(devices) == 0 {
+		return fmt.Errorf("no IOS-XR/IOS-XE targets with role %q", config.MTURoles)
+	}
+	if config.Pool == nil {
+		config.Pool = newSessionPool(config.Keepalive)
+		defer config.Pool.Close()
+	}
+
+	log.Printf("MTU sweep: reading the links of %d devices...", len(devices))
+	links := discoverCoreLinks(config, devices)
+	if len(links) == 0 {
+		return fmt.Errorf("no up /30 or /31 links found")
+	}
+
+	byHost := make(map[string][]int)
+	var sources []DeviceInfo
+	for i, l := range links {
+		if _, ok := byHost[l.Hostname]; !ok {
+			sources = append(sources, l.device)
+		}
+		byHost[l.Hostname] = append(byHost[l.Hostname], i)
+	}
+	log.Printf("MTU sweep: %d links, df-bit ping of %d bytes...", len(links), config.MTURequired)
+	forEachDevice(config, sources, func(d DeviceInfo) {
+		client := newDeviceClient(d, config)
+		for _, i := range byHost[d.Hostname] {
+			sweepLink(client, &links[i], config.MTURequired)
+		}
+	})
+
+	dir := filepath.Join(config.OutputDir, mtuSweepDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	ts := time.Now().Format("20060102_150405")
+	logPath := filepath.Join(dir, "MTU_SWEEP_"+ts+".log")
+	file, err := createAtomic(logPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	counts := writeMTUTable(file, links, config.MTURequired)
+	writeMTUTable(os.Stdout, links, config.MTURequired)
+
+	rows := [][]string{{"Hostname", "Interface", "Address", "IP_MTU", "Peer", "Peer_Address", "Largest_DF", "Status", "Detail"}}
+	for _, l := range links {
+		rows = append(rows, []string{l.Hostname, l.Interface, l.Address, strconv.Itoa(l.IPMTU), l.Peer, l.PeerAddress,
+			strconv.Itoa(l.Largest), l.Status, l.Error})
+	}
+	csvPath := filepath.Join(dir, "MTU_SWEEP_"+ts+".csv")
+	if err := writeCSVRows(csvPath, rows); err != nil {
+		return err
+	}
+	log.Printf("MTU sweep: PASS %d | FAIL %d | DOWN %d | no data %d", counts["PASS"], counts["FAIL"], counts["DOWN"], counts["NO_DATA"])
+	log.Printf("MTU sweep: %s, %s", logPath, csvPath)
+
+	if bad := len(links) - counts["PASS"]; bad > 0 {
+		return fmt.Errorf("%d of %d links cannot carry %d-byte packets", bad, len(links), config.MTURequired)
+	}
+	return nil
+}
+
+// writeMTUTable writes the link table and returns the status counts
+func writeMTUTable(out io.Writer, links []MTULink, required int) map[string]int {
+	counts := make(map[string]int)
+	for _, l := range links {
+		counts[l.Status]++
+	}
+	fmt.Fprintf(out, "================================================================================\n")
+	fmt.Fprintf(out, " MERALCO Core Link MTU Sweep\n")
+	fmt.Fprintf(out, " Required: %d bytes (df-bit) | Time: %s\n", required, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(out, " PASS: %d | FAIL: %d | DOWN: %d | NO_DATA: %d\n", counts["PASS"], counts["FAIL"], counts["DOWN"], counts["NO_DATA"])
+	fmt.Fprintf(out, "================================================================================\n\n")
+
+	table := newTextTable("HOSTNAME", "INTERFACE", "ADDRESS", "IP MTU", "PEER", "PEER ADDRESS", "LARGEST DF", "STATUS").alignRight(3, 6)
+	for _, l := range links {
+		mtu, largest := "-", "-"
+		if l.IPMTU > 0 {
+			mtu = strconv.Itoa(l.IPMTU)
+		}
+		switch {
+		case l.Status == "PASS":
+			largest = fmt.Sprintf(">= %d", l.Largest)
+		case l.Largest > 0:
+			largest = strconv.Itoa(l.Largest)
+		}
+		table.add(l.Site, displayHost(l.Hostname), l.Interface, l.Address, mtu, orDash(displayHost(l.Peer)), l.PeerAddress, largest, l.Status)
+		if l.Error != "" {
+			table.note("    - %s", l.Error)
+		}
+	}
+	table.write(out)
+	fmt.Fprintln(out)
+	return counts
+}
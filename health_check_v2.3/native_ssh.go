@@ -0,0 +1,403 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// ============================================================================
+// NATIVE SSH SESSIONS (golang.org/x/crypto/ssh)
+// ============================================================================
+//
+// Device sessions (script, expect and pooled) run on the Go ssh stack unless
+// -ssh-client openssh is given: nothing to install, and the password and key
+// passphrase stay inside this process. The session is the one OpenSSH gets
+// with -t -t: a pty 512 columns wide and a shell, fed the same command script
+// and cut apart at the same ===START_i=== / ===END_i=== markers, so output
+// splitting, timeouts, retries and recordings do not depend on the client.
+//
+// Authentication follows ssh_auth.go: the private key and the ssh-agent
+// identities, then the password, answered once to a password or a
+// keyboard-interactive "Password:" prompt, so a wrong password costs one
+// attempt. Host keys are not checked (StrictHostKeyChecking=no). The
+// ssh_algorithms.go overrides apply to the Go stack's algorithm lists; names
+// it does not implement (aes256-cbc) are skipped.
+//
+// socks5:// proxies are dialed directly and jump:// bastions are logged into
+// with the key or agent. A command: proxy, NETCONF and scp still run OpenSSH
+// (ssh_auth.go).
+
+const nativeConnectTimeout = 30 * time.Second
+
+// shell is an interactive device session on either ssh client
+type shell struct {
+	stdin io.WriteCloser
+	wait  func() error // returns when the session has ended
+	kill  func()
+}
+
+// startShell opens a session with a pty; everything the device and the
+// client print goes to out
+func (c *SSHClient) startShell(sshArgs []string, out io.Writer) (*shell, error) {
+	if c.native && !strings.HasPrefix(strings.TrimSpace(c.proxy), "command:") {
+		return c.startNativeShell(out)
+	}
+	cmd, err := c.sshCommand(sshArgs)
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	// A ProxyCommand child can hold the output pipe after ssh is killed;
+	// bound how long Wait waits for it so the waiter goroutine exits
+	cmd.WaitDelay = 5 * time.Second
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &shell{stdin: stdin, wait: cmd.Wait, kill: func() { cmd.Process.Kill() }}, nil
+}
+
+// syncWriter serializes the stdout and stderr copies of a native session
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+func (c *SSHClient) startNativeShell(out io.Writer) (*shell, error) {
+	client, err := c.nativeClient()
+	if err != nil {
+		return nil, err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	modes := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 38400, ssh.TTY_OP_OSPEED: 38400}
+	if err := session.RequestPty("vt100", 24, 512, modes); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("pty request: %v", err)
+	}
+	w := &syncWriter{w: out}
+	session.Stdout = w
+	session.Stderr = w
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	if err := session.Shell(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("shell request: %v", err)
+	}
+
+	var killed atomic.Bool
+	wait := func() error {
+		err := session.Wait()
+		client.Close()
+		var exit *ssh.ExitError
+		if err != nil && !errors.As(err, &exit) && !killed.Load() {
+			// What OpenSSH prints, so a lost session reads the same to
+			// executeCommands and ssh_retry.go
+			fmt.Fprintf(w, "\r\nConnection to %s closed by remote host.\r\n", c.host)
+		}
+		return err
+	}
+	kill := func() {
+		killed.Store(true)
+		client.Close()
+	}
+	return &shell{stdin: stdin, wait: wait, kill: kill}, nil
+}
+
+// nativeClient dials the device and logs in
+func (c *SSHClient) nativeClient() (*ssh.Client, error) {
+	config, closeAgent, err := c.nativeConfig(c.username, true)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAgent()
+	addr := net.JoinHostPort(c.host, strconv.Itoa(c.port))
+	conn, err := c.dialNative(addr)
+	if err != nil {
+		return nil, err
+	}
+	return nativeHandshake(conn, addr, config, c.username, c.host)
+}
+
+// nativeHandshake runs the ssh handshake and login on conn within
+// nativeConnectTimeout
+func nativeHandshake(conn net.Conn, addr string, config *ssh.ClientConfig, user, host string) (*ssh.Client, error) {
+	// Closing conn also ends a handshake on a jump channel, which has no
+	// deadlines
+	timer := time.AfterFunc(nativeConnectTimeout, func() { conn.Close() })
+	sc, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if !timer.Stop() && err != nil {
+		return nil, fmt.Errorf("ssh: connect to host %s: handshake timed out", host)
+	}
+	if err != nil {
+		conn.Close()
+		if errors.Is(err, errPasswordTried) || strings.Contains(err.Error(), "unable to authenticate") {
+			return nil, fmt.Errorf("%s@%s: Permission denied (%v)", user, host, err)
+		}
+		return nil, err
+	}
+	return ssh.NewClient(sc, chans, reqs), nil
+}
+
+// errPasswordTried ends a login after one wrong password
+var errPasswordTried = errors.New("password rejected")
+
+// nativeConfig is the login of user with the client's key, the agent and,
+// with password set, the password. closeAgent releases the agent connection
+// once the login is done.
+func (c *SSHClient) nativeConfig(user string, password bool) (config *ssh.ClientConfig, closeAgent func(), err error) {
+	closeAgent = func() {}
+	var signers []ssh.Signer
+	if c.keyFile != "" {
+		signer, err := loadPrivateKey(c.keyFile, resolveSecret(c.keyPass))
+		if err != nil {
+			return nil, nil, err
+		}
+		signers = append(signers, signer)
+	}
+	var agentSigners func() ([]ssh.Signer, error)
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			agentSigners, closeAgent = agent.NewClient(conn).Signers, func() { conn.Close() }
+		}
+	}
+	// One publickey method: the Go client skips a method name it has tried
+	auth := []ssh.AuthMethod{ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		all := signers
+		if agentSigners != nil {
+			if more, err := agentSigners(); err == nil {
+				all = append(slices.Clip(all), more...)
+			}
+		}
+		return all, nil
+	})}
+
+	if password && c.password != "" {
+		var mu sync.Mutex
+		tried := false
+		answer := func() (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if tried {
+				return "", errPasswordTried
+			}
+			tried = true
+			return c.password, nil
+		}
+		auth = append(auth,
+			ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i, q := range questions {
+					if !strings.HasSuffix(strings.ToLower(strings.TrimSpace(q)), "password:") {
+						return nil, fmt.Errorf("not answering %q", strings.TrimSpace(q))
+					}
+					a, err := answer()
+					if err != nil {
+						return nil, err
+					}
+					answers[i] = a
+				}
+				return answers, nil
+			}),
+			ssh.PasswordCallback(answer))
+	}
+
+	config = &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	if err := applyNativeAlgorithms(config, c.algos); err != nil {
+		closeAgent()
+		return nil, nil, err
+	}
+	return config, closeAgent, nil
+}
+
+// loadPrivateKey reads an OpenSSH or PEM private key, decrypted with
+// passphrase when it has one
+func loadPrivateKey(path, passphrase string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("private key: %v", err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if passphrase == "" {
+			return nil, fmt.Errorf("private key %s is encrypted: set its passphrase (-key-passphrase or Key_Passphrase)", path)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("private key %s: %v", path, err)
+	}
+	return signer, nil
+}
+
+// dialNative connects to addr directly, through a SOCKS5 proxy or through
+// a jump host, as the proxy spec says (ssh_proxy.go)
+func (c *SSHClient) dialNative(addr string) (net.Conn, error) {
+	spec := strings.TrimSpace(c.proxy)
+	if spec == "" || strings.EqualFold(spec, "direct") {
+		return net.DialTimeout("tcp", addr, nativeConnectTimeout)
+	}
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %v", spec, err)
+	}
+	host, port, _ := net.SplitHostPort(addr)
+	p, _ := strconv.Atoi(port)
+	switch u.Scheme {
+	case "socks5":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q: missing host:port", spec)
+		}
+		return dialSOCKS5(u, host, p, nativeConnectTimeout)
+	case "jump":
+		if u.Hostname() == "" {
+			return nil, fmt.Errorf("invalid proxy %q: missing host", spec)
+		}
+		return c.dialJump(u, addr)
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %q (use socks5://, jump:// or command:)", u.Scheme)
+}
+
+// jumpConn is a channel through a bastion; closing it logs out of the bastion
+type jumpConn struct {
+	net.Conn
+	bastion *ssh.Client
+}
+
+func (j *jumpConn) Close() error {
+	err := j.Conn.Close()
+	j.bastion.Close()
+	return err
+}
+
+// dialJump logs into the bastion of a jump:// spec with the key or agent,
+// as ssh -J does, and opens a channel to addr through it
+func (c *SSHClient) dialJump(u *url.URL, addr string) (net.Conn, error) {
+	user := c.username
+	if u.User != nil && u.User.Username() != "" {
+		user = u.User.Username()
+	}
+	port := u.Port()
+	if port == "" {
+		port = "22"
+	}
+	config, closeAgent, err := c.nativeConfig(user, false)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAgent()
+	config.Auth = config.Auth[:1] // key and agent only
+	bastionAddr := net.JoinHostPort(u.Hostname(), port)
+	conn, err := net.DialTimeout("tcp", bastionAddr, nativeConnectTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("jump host %s: %v", bastionAddr, err)
+	}
+	bastion, err := nativeHandshake(conn, bastionAddr, config, user, u.Hostname())
+	if err != nil {
+		return nil, fmt.Errorf("jump host %s: %v", bastionAddr, err)
+	}
+	tunnel, err := bastion.Dial("tcp", addr)
+	if err != nil {
+		bastion.Close()
+		return nil, fmt.Errorf("jump host %s: %v", bastionAddr, err)
+	}
+	return &jumpConn{Conn: tunnel, bastion: bastion}, nil
+}
+
+// applyNativeAlgorithms applies an ssh_algorithms.go spec to config, with
+// the Go stack's supported algorithms as the defaults that +, ^ and - edit
+func applyNativeAlgorithms(config *ssh.ClientConfig, spec string) error {
+	algos, err := parseSSHAlgorithms(spec)
+	if err != nil {
+		return err
+	}
+	supported, insecure := ssh.SupportedAlgorithms(), ssh.InsecureAlgorithms()
+	lists := []struct {
+		key                 string
+		defaults, available []string
+		set                 *[]string
+	}{
+		{"kex", supported.KeyExchanges, slices.Concat(supported.KeyExchanges, insecure.KeyExchanges), &config.KeyExchanges},
+		{"ciphers", supported.Ciphers, slices.Concat(supported.Ciphers, insecure.Ciphers), &config.Ciphers},
+		{"hostkeys", supported.HostKeys, slices.Concat(supported.HostKeys, insecure.HostKeys), &config.HostKeyAlgorithms},
+		{"macs", supported.MACs, slices.Concat(supported.MACs, insecure.MACs), &config.MACs},
+	}
+	for _, l := range lists {
+		spec := algos[l.key]
+		if spec == "" {
+			continue
+		}
+		var names []string
+		for _, name := range strings.Split(strings.TrimLeft(spec, "+^-"), ",") {
+			if slices.Contains(l.available, name) {
+				names = append(names, name)
+			}
+		}
+		var list []string
+		switch spec[0] {
+		case '+':
+			list = append(slices.Clone(l.defaults), names...)
+		case '^':
+			list = slices.Concat(names, l.defaults)
+		case '-':
+			for _, name := range l.defaults {
+				if !slices.Contains(names, name) {
+					list = append(list, name)
+				}
+			}
+		default:
+			list = names
+		}
+		list = dedupeNames(list)
+		if len(list) == 0 {
+			return fmt.Errorf("%s=%s leaves no algorithm the native ssh client implements (try -ssh-client openssh)", l.key, spec)
+		}
+		*l.set = list
+	}
+	return nil
+}
+
+// dedupeNames keeps the first of each name
+func dedupeNames(names []string) []string {
+	var out []string
+	for _, n := range names {
+		if !slices.Contains(out, n) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeDevice is an ssh server with a device shell: it prints what an echo
+// line echoes, answers any other line with "out <line>" and closes the
+// connection when it reads dropAt. It takes the password "secret" once per
+// login, by keyboard-interactive or password.
+type fakeDevice struct {
+	port     int
+	dropAt   string
+	logins   atomic.Int32 // password attempts
+	commands chan string
+}
+
+func startFakeDevice(t *testing.T, dropAt string) *fakeDevice {
+	t.Helper()
+	t.Setenv("SSH_AUTH_SOCK", "")
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &fakeDevice{dropAt: dropAt, commands: make(chan string, 100)}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			d.logins.Add(1)
+			if conn.User() == "hc" && string(pass) == "secret" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("denied")
+		},
+		KeyboardInteractiveCallback: func(conn ssh.ConnMetadata, ask ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := ask("", "", []string{"Password: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			d.logins.Add(1)
+			if conn.User() == "hc" && answers[0] == "secret" {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("denied")
+		},
+	}
+	config.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no tcp: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	d.port = ln.Addr().(*net.TCPAddr).Port
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn, config)
+		}
+	}()
+	return d
+}
+
+func (d *fakeDevice) serve(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			return
+		}
+		shell := make(chan struct{})
+		go func() {
+			for req := range requests {
+				ok := req.Type == "pty-req" || req.Type == "shell"
+				req.Reply(ok, nil)
+				if req.Type == "shell" {
+					close(shell)
+				}
+			}
+		}()
+		<-shell
+		in := bufio.NewScanner(ch)
+		for in.Scan() {
+			line := strings.TrimSpace(in.Text())
+			switch {
+			case line == d.dropAt:
+				return
+			case strings.HasPrefix(line, "echo "):
+				fmt.Fprintf(ch, "%s\r\n", strings.TrimPrefix(line, "echo "))
+			case line == "exit":
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				ch.Close()
+				return
+			default:
+				d.commands <- line
+				fmt.Fprintf(ch, "out %s\r\n", line)
+			}
+		}
+	}
+}
+
+func (d *fakeDevice) client(password string) *SSHClient {
+	return &SSHClient{host: "127.0.0.1", port: d.port, username: "hc", password: password,
+		cmdTimeout: 10 * time.Second, native: true}
+}
+
+// The script session on the Go ssh stack is split at the same markers as
+// with OpenSSH
+func TestNativeSession(t *testing.T) {
+	d := startFakeDevice(t, "")
+	commands := []string{"show version", "show inventory", "show clock"}
+	results, err := d.client("secret").ExecuteCommands(commands)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range commands {
+		if results[cmd] != "out "+cmd {
+			t.Errorf("output of %q = %q", cmd, results[cmd])
+		}
+	}
+}
+
+// A connection dropped in the middle of the batch reads as a lost session,
+// which -retry-on closed retries
+func TestNativeLostSession(t *testing.T) {
+	d := startFakeDevice(t, "show inventory")
+	results, err := d.client("secret").ExecuteCommands([]string{"show version", "show inventory", "show clock"})
+	if err == nil || !strings.Contains(err.Error(), "session lost after 1 of 3 commands: Connection to 127.0.0.1 closed by remote host.") {
+		t.Fatalf("err = %v", err)
+	}
+	if results["show version"] != "out show version" {
+		t.Errorf("output of show version = %q", results["show version"])
+	}
+	policy := &retryPolicy{count: 1, classes: []string{"closed"}}
+	if class := policy.transient(err); class != "closed" {
+		t.Errorf("retry class %q, want closed", class)
+	}
+}
+
+// A wrong password is sent once, over whichever method the device asks
+// first, and fails as permission denied, which is never retried
+func TestNativeWrongPassword(t *testing.T) {
+	d := startFakeDevice(t, "")
+	_, err := d.client("wrong").ExecuteCommands([]string{"show version"})
+	if err == nil || !strings.Contains(err.Error(), "hc@127.0.0.1: Permission denied") {
+		t.Fatalf("err = %v, want Permission denied", err)
+	}
+	if n := d.logins.Load(); n != 1 {
+		t.Errorf("%d password attempts, want 1", n)
+	}
+	if class := (&retryPolicy{count: 1, classes: retryClassNames}).transient(err); class != "" {
+		t.Errorf("retried as %q", class)
+	}
+	if len(d.commands) != 0 {
+		t.Errorf("commands ran without a login")
+	}
+}
+
+func TestNativeAlgorithms(t *testing.T) {
+	config := &ssh.ClientConfig{}
+	if err := applyNativeAlgorithms(config, "legacy;macs=-hmac-sha1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := config.KeyExchanges[len(config.KeyExchanges)-3:]; strings.Join(got, ",") != "diffie-hellman-group14-sha1,diffie-hellman-group1-sha1,diffie-hellman-group-exchange-sha1" {
+		t.Errorf("kex ends in %v", got)
+	}
+	if !slices.Contains(config.Ciphers, "aes128-cbc") || !slices.Contains(config.Ciphers, "3des-cbc") || slices.Contains(config.Ciphers, "aes256-cbc") {
+		t.Errorf("ciphers %v, want aes128-cbc and 3des-cbc added, aes256-cbc skipped", config.Ciphers)
+	}
+	if slices.Contains(config.MACs, "hmac-sha1") || len(config.MACs) == 0 {
+		t.Errorf("macs %v, want hmac-sha1 removed", config.MACs)
+	}
+
+	config = &ssh.ClientConfig{}
+	if err := applyNativeAlgorithms(config, "hostkeys=^ssh-rsa"); err != nil {
+		t.Fatal(err)
+	}
+	if config.HostKeyAlgorithms[0] != "ssh-rsa" || len(config.HostKeyAlgorithms) < 2 || config.KeyExchanges != nil {
+		t.Errorf("hostkeys %v, kex %v", config.HostKeyAlgorithms, config.KeyExchanges)
+	}
+	if err := applyNativeAlgorithms(&ssh.ClientConfig{}, "ciphers=aes256-cbc"); err == nil {
+		t.Error("a cipher list with nothing implemented accepted")
+	}
+}
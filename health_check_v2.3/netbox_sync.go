@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// INVENTORY FROM NETBOX (-netbox-url)
+// ============================================================================
+//
+// host_info.xlsx and the toolkit's devices.json are kept by hand and drift
+// from NetBox, which the planning team already maintains. -netbox-url reads
+// the active devices from the NetBox API
+//
+//   GET <url>/api/dcim/devices/?status=active[&tag=T...]
+//
+// and writes them to -hosts (CSV, XLSX or JSON by extension) and exits:
+//
+//   Hostname     name
+//   IP_Address   primary IPv4 address (primary IP when there is no IPv4)
+//   Device_Type  device type model; the platform (IOS-XR, IOS-XE) is added
+//                when the model alone would be detected as another OS
+//   Site, Role   site and device role names
+//
+// Proxy, key, alias, standby IP and pair are not in NetBox; they are kept
+// from the current -hosts entry of the same hostname. -netbox-tag limits
+// the pull to devices with any of the given tags (slugs), e.g. the
+// migration scope. The token comes from -netbox-token (env:VAR allowed) or
+// NETBOX_TOKEN. Add -export-inventory to write the toolkit's copy in the
+// same run:
+//
+//   -netbox-url https://netbox.example -netbox-tag wave-3 \
+//       -hosts host_info.xlsx -export-inventory ../toolkit/devices.json
+
+const netboxPageSize = 500
+
+// netboxRef is a nested NetBox object; only the names are used
+type netboxRef struct {
+	Name  string `json:"name"`
+	Slug  string `json:"slug"`
+	Model string `json:"model"`
+}
+
+type netboxIP struct {
+	Address string `json:"address"`
+}
+
+// netboxDevice is the part of a dcim/devices result the inventory uses;
+// NetBox 3.6 renamed device_role to role, both are read
+type netboxDevice struct {
+	Name       string     `json:"name"`
+	PrimaryIP4 *netboxIP  `json:"primary_ip4"`
+	PrimaryIP  *netboxIP  `json:"primary_ip"`
+	DeviceType *netboxRef `json:"device_type"`
+	Platform   *netboxRef `json:"platform"`
+	Site       *netboxRef `json:"site"`
+	Role       *netboxRef `json:"role"`
+	DeviceRole *netboxRef `json:"device_role"`
+}
+
+type netboxPage struct {
+	Count   int            `json:"count"`
+	Next    string         `json:"next"`
+	Results []netboxDevice `json:"results"`
+}
+
+// netboxPlatformOS maps a platform name or slug to the OS it runs
+func netboxPlatformOS(p *netboxRef) string {
+	if p == nil {
+		return ""
+	}
+	s := strings.ToUpper(strings.NewReplacer("-", "", "_", "", " ", "").Replace(p.Slug + " " + p.Name))
+	switch {
+	case strings.Contains(s, "IOSXR"):
+		return "IOS-XR"
+	case strings.Contains(s, "IOSXE"):
+		return "IOS-XE"
+	}
+	return ""
+}
+
+// deviceInfo converts a NetBox device; ok is false without a name or address
+func (n netboxDevice) deviceInfo() (DeviceInfo, bool) {
+	ip := n.PrimaryIP4
+	if ip == nil {
+		ip = n.PrimaryIP
+	}
+	if n.Name == "" || ip == nil || ip.Address == "" {
+		return DeviceInfo{}, false
+	}
+	address, _, _ := strings.Cut(ip.Address, "/")
+	d := DeviceInfo{Hostname: n.Name, IPAddress: address}
+	if n.DeviceType != nil {
+		d.DeviceType = n.DeviceType.Model
+	}
+	if platform := netboxPlatformOS(n.Platform); platform != "" && detectDeviceOS(d.DeviceType) != platform {
+		d.DeviceType = strings.TrimSpace(d.DeviceType + " " + platform)
+	}
+	if n.Site != nil {
+		d.Site = n.Site.Name
+	}
+	if role := n.Role; role != nil {
+		d.Role = role.Name
+	} else if n.DeviceRole != nil {
+		d.Role = n.DeviceRole.Name
+	}
+	d.DetectedOS = detectDeviceOS(d.DeviceType)
+	return d, true
+}
+
+// fetchNetBoxDevices reads every page of active devices with any of tags
+func fetchNetBoxDevices(baseURL, token string, tags []string) ([]netboxDevice, error) {
+	q := url.Values{"status": {"active"}, "limit": {fmt.Sprint(netboxPageSize)}}
+	for _, t := range tags {
+		q.Add("tag", t)
+	}
+	next := strings.TrimRight(baseURL, "/") + "/api/dcim/devices/?" + q.Encode()
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	var devices []netboxDevice
+	for next != "" {
+		req, err := http.NewRequest("GET", next, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Token "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var page netboxPage
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			err = fmt.Errorf("%s: token rejected", resp.Status)
+		case resp.StatusCode != http.StatusOK:
+			err = fmt.Errorf("%s from %s", resp.Status, req.URL.Redacted())
+		default:
+			if err = json.NewDecoder(resp.Body).Decode(&page); err != nil {
+				err = fmt.Errorf("invalid device list: %v", err)
+			}
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, page.Results...)
+		next = page.Next
+	}
+	return devices, nil
+}
+
+// syncFromNetBox replaces the -hosts inventory with the NetBox devices,
+// keeping the local-only columns, and logs what changed
+func syncFromNetBox(config *Config) error {
+	token := resolveSecret(config.NetBoxToken)
+	if token == "" {
+		token = os.Getenv("NETBOX_TOKEN")
+	}
+	var tags []string
+	for _, t := range strings.Split(config.NetBoxTag, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+
+	records, err := fetchNetBoxDevices(config.NetBoxURL, token, tags)
+	if err != nil {
+		return err
+	}
+	current := make(map[string]DeviceInfo)
+	if _, err := os.Stat(config.HostFile); err == nil {
+		if current, err = loadHostInventory(config.HostFile); err != nil {
+			return fmt.Errorf("failed to load %s: %v", config.HostFile, err)
+		}
+	}
+
+	devices := make(map[string]DeviceInfo)
+	skipped := 0
+	for _, r := range records {
+		d, ok := r.deviceInfo()
+		if !ok {
+			log.Printf("⚠ NetBox: %s has no primary IP, skipped", orDash(r.Name))
+			skipped++
+			continue
+		}
+		key := strings.ToUpper(d.Hostname)
+		old, known := current[key]
+		if known {
+			d.Proxy, d.KeyFile, d.KeyPass, d.Alias, d.StandbyIP = old.Proxy, old.KeyFile, old.KeyPass, old.Alias, old.StandbyIP
+			d.Pair, d.SSHAlgos, d.Transport = old.Pair, old.SSHAlgos, old.Transport
+		}
+		switch {
+		case !known:
+			log.Printf("  + %s", describeInventoryEntry(d, true))
+		case !sameInventoryEntry(old, d):
+			log.Printf("  ~ %s (was %s)", describeInventoryEntry(d, true), describeInventoryEntry(old, true))
+		}
+		devices[key] = d
+	}
+	for key, old := range current {
+		if _, ok := devices[key]; !ok {
+			log.Printf("  - %s", describeInventoryEntry(old, true))
+		}
+	}
+	if len(devices) == 0 {
+		return fmt.Errorf("no active devices with a primary IP (tags: %s)", orDash(strings.Join(tags, ",")))
+	}
+
+	if err := saveHostInventory(config.HostFile, devices); err != nil {
+		return err
+	}
+	log.Printf("✓ NetBox: %d devices written to %s (%d skipped, tags: %s)",
+		len(devices), config.HostFile, skipped, orDash(strings.Join(tags, ",")))
+	return nil
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// NODE PAIR CHECK (PAIRS_<ts>.log)
+// ============================================================================
+//
+// The core ASR9906s come in A/B pairs, and the per-device checks pass a
+// pair where one member lost half its VRFs while the other still carries
+// them. Devices with the same Pair in the inventory (the Pair column, any
+// name, e.g. CORE-NORTH) are checked together each run:
+//
+//   VRFs      every member has the same VRFs; FAIL for a VRF on some
+//             members only
+//   PEs       every PE of the run (a device whose Role has the word PE) has
+//             an established BGP session with a member; FAIL when with
+//             none, WARN when not with all of them (single-homed)
+//   traffic   no member carries more than -pair-skew percent of the pair's
+//             interface rate (input plus output of every interface); WARN,
+//             so all traffic landing on one member after the cutover shows.
+//             Pairs below 1 Mbps in total are not judged; 0 disables
+//
+// BGP neighbors are matched to the PEs by their inventory addresses, BGP
+// and IS-IS router IDs and interface addresses, as for the topology. A
+// pair with a member that is not collected, or not in this run, is
+// NOT_COLLECTED and not judged. Pairs are OK, WARN or FAIL otherwise.
+
+const pairTrafficFloorBps = 1000000
+
+// PairRow is the outcome for one node pair
+type PairRow struct {
+	Pair     string
+	Members  []string
+	VRFs     int   // VRFs on every member
+	PEs      int   // PEs with a session to every member
+	Traffic  []int // share of the pair's rate per member, percent
+	TotalBps int64
+	Status   string // OK, WARN, FAIL, NOT_COLLECTED
+	Reasons  []string
+}
+
+// pairMember is what the check reads from one member's outputs; the
+// collected map says which of vrf, bgp and interfaces it has
+type pairMember struct {
+	result    *DeviceResult
+	collected map[string]bool
+	vrfs      map[string]bool
+	peers     map[string]bool // established BGP neighbors, resolved to hostnames
+	bps       int64
+}
+
+func newPairMember(r *DeviceResult, resolver topologyResolver) pairMember {
+	m := pairMember{result: r, collected: make(map[string]bool), vrfs: make(map[string]bool), peers: make(map[string]bool)}
+	for _, e := range r.Results {
+		cmd := strings.ToLower(e.Command)
+		if isCommandRejected(e.Output) {
+			continue
+		}
+		category := metricCategory(cmd)
+		m.collected[category] = true
+		switch category {
+		case "vrf":
+			for _, v := range parseVRFTable(e.Output) {
+				m.vrfs[v.Name] = true
+			}
+		case "bgp":
+			for _, n := range parseBGPSummary(e.Output).Neighbors {
+				if n.Established() {
+					m.peers[strings.ToUpper(resolver.resolve(n.Address))] = true
+				}
+			}
+		case "interfaces":
+			for _, i := range parseShowInterfaces(e.Output) {
+				m.bps += i.InputRateBps + i.OutputRateBps
+			}
+		}
+	}
+	return m
+}
+
+// isPERole reports whether an inventory role names a PE
+func isPERole(role string) bool {
+	for _, w := range strings.FieldsFunc(strings.ToUpper(role), func(r rune) bool {
+		return r == ' ' || r == '-' || r == '_' || r == '/'
+	}) {
+		if w == "PE" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNodePairs judges the pairs of the run; nil when no device has a pair
+func checkNodePairs(results []*DeviceResult, skewPct int) []PairRow {
+	pairs := make(map[string][]*DeviceResult)
+	var pes []DeviceInfo
+	for _, r := range results {
+		if r.Device.Pair != "" {
+			key := strings.ToUpper(r.Device.Pair)
+			pairs[key] = append(pairs[key], r)
+		} else if isPERole(r.Device.Role) {
+			pes = append(pes, r.Device)
+		}
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+	sort.Slice(pes, func(i, j int) bool { return pes[i].Hostname < pes[j].Hostname })
+	resolver := newTopologyResolver(results)
+
+	var rows []PairRow
+	for _, group := range pairs {
+		sort.Slice(group, func(i, j int) bool { return group[i].Device.Hostname < group[j].Device.Hostname })
+		row := PairRow{Pair: group[0].Device.Pair}
+		var down []string
+		for _, r := range group {
+			row.Members = append(row.Members, r.Device.Hostname)
+			if !r.Success {
+				down = append(down, r.Device.Hostname)
+			}
+		}
+		switch {
+		case len(group) < 2:
+			row.Status = "NOT_COLLECTED"
+			row.Reasons = append(row.Reasons, fmt.Sprintf("only %s of the pair is in this run", group[0].Device.Hostname))
+		case len(down) > 0:
+			row.Status = "NOT_COLLECTED"
+			row.Reasons = append(row.Reasons, fmt.Sprintf("%s not collected", strings.Join(down, ", ")))
+		default:
+			members := make([]pairMember, len(group))
+			for i, r := range group {
+				members[i] = newPairMember(r, resolver)
+			}
+			row.judge(members, pes, skewPct)
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Pair < rows[j].Pair })
+	return rows
+}
+
+// judge runs the VRF, PE and traffic checks on the collected members; a
+// check is skipped with a warning when a member lacks its output
+func (row *PairRow) judge(members []pairMember, pes []DeviceInfo, skewPct int) {
+	fail, warn := false, false
+	have := func(category, what string) bool {
+		var missing []string
+		for _, m := range members {
+			if !m.collected[category] {
+				missing = append(missing, m.result.Device.Hostname)
+			}
+		}
+		if len(missing) > 0 {
+			warn = true
+			row.Reasons = append(row.Reasons, fmt.Sprintf("no %s output from %s, not compared", what, strings.Join(missing, ", ")))
+		}
+		return len(missing) == 0
+	}
+	vrfsOK, pesOK, trafficOK := have("vrf", "VRF"), len(pes) == 0 || have("bgp", "BGP summary"), have("interfaces", "show interfaces")
+
+	all := make(map[string]bool)
+	for _, m := range members {
+		for v := range m.vrfs {
+			all[v] = vrfsOK
+		}
+	}
+	var vrfs []string
+	for v, compare := range all {
+		if compare {
+			vrfs = append(vrfs, v)
+		}
+	}
+	sort.Strings(vrfs)
+	for _, v := range vrfs {
+		var on, missing []string
+		for _, m := range members {
+			if m.vrfs[v] {
+				on = append(on, m.result.Device.Hostname)
+			} else {
+				missing = append(missing, m.result.Device.Hostname)
+			}
+		}
+		if len(missing) > 0 {
+			fail = true
+			row.Reasons = append(row.Reasons, fmt.Sprintf("VRF %s on %s only, missing on %s", v, strings.Join(on, ", "), strings.Join(missing, ", ")))
+		} else {
+			row.VRFs++
+		}
+	}
+
+	if !pesOK {
+		pes = nil
+	}
+	for _, pe := range pes {
+		var with, without []string
+		for _, m := range members {
+			if m.peers[strings.ToUpper(pe.Hostname)] {
+				with = append(with, m.result.Device.Hostname)
+			} else {
+				without = append(without, m.result.Device.Hostname)
+			}
+		}
+		switch {
+		case len(with) == 0:
+			fail = true
+			row.Reasons = append(row.Reasons, fmt.Sprintf("PE %s has no established BGP session with the pair", pe.Hostname))
+		case len(without) > 0:
+			warn = true
+			row.Reasons = append(row.Reasons, fmt.Sprintf("PE %s has a session with %s only", pe.Hostname, strings.Join(with, ", ")))
+		default:
+			row.PEs++
+		}
+	}
+
+	for _, m := range members {
+		row.TotalBps += m.bps
+	}
+	for _, m := range members {
+		share := 0
+		if row.TotalBps > 0 {
+			share = int(m.bps * 100 / row.TotalBps)
+		}
+		row.Traffic = append(row.Traffic, share)
+		if trafficOK && skewPct > 0 && row.TotalBps >= pairTrafficFloorBps && share > skewPct {
+			warn = true
+			row.Reasons = append(row.Reasons, fmt.Sprintf("%s carries %d%% of the pair's %s (limit %d%%)",
+				m.result.Device.Hostname, share, formatBps(row.TotalBps), skewPct))
+		}
+	}
+
+	switch {
+	case fail:
+		row.Status = "FAIL"
+	case warn:
+		row.Status = "WARN"
+	default:
+		row.Status = "OK"
+	}
+}
+
+// formatBps renders a rate in the largest unit that keeps it above 1
+func formatBps(bps int64) string {
+	switch {
+	case bps >= 1e9:
+		return fmt.Sprintf("%.2f Gbps", float64(bps)/1e9)
+	case bps >= 1e6:
+		return fmt.Sprintf("%.2f Mbps", float64(bps)/1e6)
+	case bps >= 1e3:
+		return fmt.Sprintf("%.1f kbps", float64(bps)/1e3)
+	}
+	return fmt.Sprintf("%d bps", bps)
+}
+
+// WritePairs writes PAIRS_<ts>.log
+func (w *OutputWriter) WritePairs(rows []PairRow, skewPct int) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("PAIRS_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	counts := make(map[string]int)
+	for _, r := range rows {
+		counts[r.Status]++
+	}
+	skew := "off"
+	if skewPct > 0 {
+		skew = fmt.Sprintf("%d%%", skewPct)
+	}
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Node Pair Check\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s | Traffic skew limit: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"), skew)
+	fmt.Fprintf(file, " OK: %d | WARN: %d | FAIL: %d | NOT_COLLECTED: %d\n",
+		counts["OK"], counts["WARN"], counts["FAIL"], counts["NOT_COLLECTED"])
+	fmt.Fprintf(file, "================================================================================\n\n")
+
+	table := newTextTable("PAIR", "MEMBERS", "VRFS", "PES", "TRAFFIC", "SHARE", "STATUS").alignRight(2, 3, 4)
+	for _, r := range rows {
+		var names, shares []string
+		for i, m := range r.Members {
+			names = append(names, displayHost(m))
+			if i < len(r.Traffic) {
+				shares = append(shares, fmt.Sprintf("%d%%", r.Traffic[i]))
+			}
+		}
+		traffic, vrfs, pes := "-", "-", "-"
+		if r.Status != "NOT_COLLECTED" {
+			traffic, vrfs, pes = formatBps(r.TotalBps), fmt.Sprint(r.VRFs), fmt.Sprint(r.PEs)
+		}
+		table.add("", r.Pair, strings.Join(names, " / "), vrfs, pes, traffic, orDash(strings.Join(shares, " / ")), r.Status)
+		for _, reason := range r.Reasons {
+			table.note("    - %s", reason)
+		}
+	}
+	table.write(file)
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// OUTPUT NOISE PATTERNS (per-OS cleaning rules, see noise_patterns.txt)
+// ============================================================================
+
+//go:embed noise_patterns.txt
+var defaultNoisePatterns string
+
+const noiseAllOS = "ALL"
+
+// noiseRule drops a trimmed output line when it matches
+type noiseRule struct {
+	kind    string // contains, prefix, regex
+	text    string
+	re      *regexp.Regexp
+	section string
+}
+
+func (r noiseRule) match(t string) bool {
+	switch r.kind {
+	case "contains":
+		return strings.Contains(t, r.text)
+	case "prefix":
+		return strings.HasPrefix(t, r.text)
+	default:
+		return r.re.MatchString(t)
+	}
+}
+
+// NoisePatterns holds the cleaning rules per OS ("ALL" applies everywhere)
+type NoisePatterns struct {
+	Source string
+	rules  map[string][]noiseRule
+}
+
+// parseNoisePatterns reads the [OS, OS] section / kind:text rule format
+func parseNoisePatterns(source, text string) (*NoisePatterns, error) {
+	np := &NoisePatterns{Source: source, rules: make(map[string][]noiseRule)}
+	sections := []string{noiseAllOS}
+	for i, raw := range strings.Split(text, "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			sections = nil
+			for _, s := range strings.Split(line[1:len(line)-1], ",") {
+				sections = append(sections, strings.ToUpper(strings.TrimSpace(s)))
+			}
+			continue
+		}
+		kind, value, ok := strings.Cut(line, ":")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%s:%d: expected contains:, prefix: or regex:", source, i+1)
+		}
+		rule := noiseRule{kind: kind, text: value}
+		switch kind {
+		case "contains", "prefix":
+		case "regex":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", source, i+1, err)
+			}
+			rule.re = re
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown rule type %q", source, i+1, kind)
+		}
+		for _, s := range sections {
+			rule.section = s
+			np.rules[s] = append(np.rules[s], rule)
+		}
+	}
+	return np, nil
+}
+
+// loadNoisePatterns reads path if it exists, else the built-in copy
+func loadNoisePatterns(path string) (*NoisePatterns, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		return parseNoisePatterns(path, string(data))
+	}
+	return parseNoisePatterns("built-in", defaultNoisePatterns)
+}
+
+// forOS returns the rules that apply to osType ("" = DEFAULT)
+func (np *NoisePatterns) forOS(osType string) []noiseRule {
+	if np == nil {
+		return nil
+	}
+	if osType == "" {
+		osType = "DEFAULT"
+	}
+	rules := append([]noiseRule{}, np.rules[noiseAllOS]...)
+	return append(rules, np.rules[strings.ToUpper(osType)]...)
+}
+
+// cleanOutput drops blank lines and every line matching a noise rule
+func cleanOutput(s string, rules []noiseRule) string {
+	lines := strings.Split(s, "\n")
+	var clean []string
+next:
+	for _, line := range lines {
+		t := strings.TrimSpace(line)
+		if t == "" {
+			continue
+		}
+		for _, r := range rules {
+			if r.match(t) {
+				continue next
+			}
+		}
+		clean = append(clean, line)
+	}
+	return strings.TrimSpace(strings.Join(clean, "\n"))
+}
+
+// runCleaningCheck cleans every <dir>/<OS>/<name>.raw fixture and compares
+// it with <name>.clean, so a new banner rule can be validated against stored
+// device output before a change window.
+func runCleaningCheck(np *NoisePatterns, dir string) error {
+	raws, _ := filepath.Glob(filepath.Join(dir, "*", "*.raw"))
+	sort.Strings(raws)
+	if len(raws) == 0 {
+		return fmt.Errorf("no <OS>/*.raw fixtures under %s", dir)
+	}
+
+	log.Printf("Checking %d fixtures with noise patterns from %s", len(raws), np.Source)
+	failed := 0
+	for _, raw := range raws {
+		osType := filepath.Base(filepath.Dir(raw))
+		name := strings.TrimSuffix(raw, ".raw")
+		input, err := os.ReadFile(raw)
+		if err != nil {
+			return err
+		}
+		want, err := os.ReadFile(name + ".clean")
+		if err != nil {
+			log.Printf("✗ %s: missing expected %s", raw, filepath.Base(name)+".clean")
+			failed++
+			continue
+		}
+
+		got := cleanOutput(string(input), np.forOS(osType))
+		if got == strings.TrimSpace(string(want)) {
+			log.Printf("✓ %s/%s", osType, filepath.Base(name))
+			continue
+		}
+		failed++
+		gotLines := strings.Split(got, "\n")
+		wantLines := strings.Split(strings.TrimSpace(string(want)), "\n")
+		for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+			var g, w string
+			if i < len(gotLines) {
+				g = gotLines[i]
+			}
+			if i < len(wantLines) {
+				w = wantLines[i]
+			}
+			if g != w {
+				log.Printf("✗ %s/%s line %d:\n    expected: %q\n    got:      %q", osType, filepath.Base(name), i+1, w, g)
+				break
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d fixtures failed", failed, len(raws))
+	}
+	log.Printf("✓ All %d fixtures clean as expected", len(raws))
+	return nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// WEBHOOK ALERTS (-notify)
+// ============================================================================
+//
+// Structured alerts go to chat and incident webhooks when a device fails a
+// collection, a validation or runbook step fails, a rollback rule fires, a
+// runbook wait step (the drain check) completes, or -change-watch sees a
+// commit outside the MOP. The notify file is YAML (see
+// yaml_subset.go):
+//
+//   webhooks:
+//     - url: env:SLACK_WEBHOOK        # env:VAR keeps the URL out of the file
+//       format: slack                 # slack, teams or json
+//       min_severity: warning         # info, warning (default), critical
+//     - url: https://noc.example/hook
+//       format: json
+//   rate_limit: 20/10m                # at most 20 alerts per webhook per 10m
+//   quiet_hours: "22:00-06:00"        # only critical alerts in this window
+//
+// Alerts over the rate limit or inside quiet hours are dropped and counted;
+// the next alert that is sent says how many were held back. Sends are
+// synchronous with a 10 second timeout so a run that exits right after an
+// alert still delivers it.
+
+// Alert is one notification
+type Alert struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"` // fail, rollback-trigger, drain-complete, config-change
+	Severity string    `json:"severity"`
+	Device   string    `json:"device,omitempty"`
+	Check    string    `json:"check"`
+	Details  []string  `json:"details,omitempty"`
+	Phase    string    `json:"phase,omitempty"`
+	Seq      uint64    `json:"seq,omitempty"` // see sample_stamp.go
+	Source   string    `json:"source,omitempty"`
+}
+
+var severityRank = map[string]int{"info": 0, "warning": 1, "critical": 2}
+
+type webhook struct {
+	url         string
+	format      string
+	minSeverity string
+
+	sent       []time.Time // send times inside the rate window
+	suppressed int
+}
+
+// notifier fans alerts out to the configured webhooks
+type notifier struct {
+	mu         sync.Mutex
+	hooks      []*webhook
+	limit      int
+	window     time.Duration
+	quietStart int // minutes after midnight; quietStart == quietEnd = off
+	quietEnd   int
+	phase      string
+	client     *http.Client
+}
+
+// loadNotifier reads the notify file
+func loadNotifier(path, phase string) (*notifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseYAML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	top, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: expected webhooks, rate_limit and quiet_hours keys", path)
+	}
+
+	n := &notifier{phase: phase, client: &http.Client{Timeout: 10 * time.Second}}
+	list, _ := top["webhooks"].([]interface{})
+	for i, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: webhook %d: expected url and format", path, i+1)
+		}
+		url, _ := yamlString(m, "url")
+		format, _ := yamlString(m, "format")
+		minSev, _ := yamlString(m, "min_severity")
+		h := &webhook{url: resolveSecret(url), format: strings.ToLower(format), minSeverity: strings.ToLower(minSev)}
+		if h.format == "" {
+			h.format = "json"
+		}
+		if h.minSeverity == "" {
+			h.minSeverity = "warning"
+		}
+		switch {
+		case h.url == "":
+			return nil, fmt.Errorf("%s: webhook %d: url is empty (unset %s?)", path, i+1, url)
+		case h.format != "slack" && h.format != "teams" && h.format != "json":
+			return nil, fmt.Errorf("%s: webhook %d: format must be slack, teams or json", path, i+1)
+		}
+		if _, ok := severityRank[h.minSeverity]; !ok {
+			return nil, fmt.Errorf("%s: webhook %d: min_severity must be info, warning or critical", path, i+1)
+		}
+		n.hooks = append(n.hooks, h)
+	}
+	if len(n.hooks) == 0 {
+		return nil, fmt.Errorf("%s: no webhooks", path)
+	}
+
+	if spec, _ := yamlString(top, "rate_limit"); spec != "" {
+		parts := strings.SplitN(spec, "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s: rate_limit must be N/DURATION, e.g. 20/10m", path)
+		}
+		if n.limit, err = strconv.Atoi(parts[0]); err != nil || n.limit < 1 {
+			return nil, fmt.Errorf("%s: rate_limit count %q", path, parts[0])
+		}
+		if n.window, err = time.ParseDuration(parts[1]); err != nil {
+			return nil, fmt.Errorf("%s: rate_limit window: %v", path, err)
+		}
+	}
+	if spec, _ := yamlString(top, "quiet_hours"); spec != "" {
+		parts := strings.SplitN(spec, "-", 2)
+		var err1, err2 error
+		if len(parts) == 2 {
+			n.quietStart, err1 = clockMinutes(parts[0])
+			n.quietEnd, err2 = clockMinutes(parts[1])
+		}
+		if len(parts) != 2 || err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("%s: quiet_hours must be HH:MM-HH:MM", path)
+		}
+	}
+	return n, nil
+}
+
+func clockMinutes(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// quiet reports whether t falls in the quiet hours (which may span midnight)
+func (n *notifier) quiet(t time.Time) bool {
+	if n.quietStart == n.quietEnd {
+		return false
+	}
+	m := t.Hour()*60 + t.Minute()
+	if n.quietStart < n.quietEnd {
+		return m >= n.quietStart && m < n.quietEnd
+	}
+	return m >= n.quietStart || m < n.quietEnd
+}
+
+// notify sends an alert to every webhook that accepts it; nil-safe
+func (n *notifier) notify(a Alert) {
+	if n == nil {
+		return
+	}
+	stamp := newSampleStamp()
+	if a.Time.IsZero() {
+		a.Time = stamp.At
+	}
+	a.Seq, a.Source = stamp.Seq, stamp.Source
+	if a.Phase == "" {
+		a.Phase = n.phase
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, h := range n.hooks {
+		if severityRank[a.Severity] < severityRank[h.minSeverity] {
+			continue
+		}
+		if a.Severity != "critical" && n.quiet(a.Time) {
+			h.suppressed++
+			continue
+		}
+		if n.limit > 0 {
+			var recent []time.Time
+			for _, t := range h.sent {
+				if a.Time.Sub(t) < n.window {
+					recent = append(recent, t)
+				}
+			}
+			h.sent = recent
+			if len(h.sent) >= n.limit {
+				h.suppressed++
+				continue
+			}
+			h.sent = append(h.sent, a.Time)
+		}
+		if err := n.post(h, a, h.suppressed); err != nil {
+			log.Printf("✗ Webhook %s: %v", webhookHost(h.url), err)
+			continue
+		}
+		h.suppressed = 0
+	}
+}
+
+// webhookHost keeps webhook tokens out of the log
+func webhookHost(url string) string {
+	s := strings.TrimPrefix(strings.TrimPrefix(url, "https://"), "http://")
+	if i := strings.Index(s, "/"); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+func alertTitle(a Alert) string {
+	title := fmt.Sprintf("[%s] %s", strings.ToUpper(a.Severity), a.Check)
+	if a.Device != "" {
+		title += " on " + displayHost(a.Device)
+	}
+	return title
+}
+
+func (n *notifier) post(h *webhook, a Alert, suppressed int) error {
+	text := strings.Join(a.Details, "\n")
+	if suppressed > 0 {
+		text += fmt.Sprintf("\n(%d earlier alerts held back by rate limit or quiet hours)", suppressed)
+	}
+
+	var payload interface{}
+	switch h.format {
+	case "slack":
+		payload = map[string]string{
+			"text": fmt.Sprintf("*%s*\nphase %s, %s\n%s", alertTitle(a), a.Phase, a.Time.Format("2006-01-02 15:04:05"), text),
+		}
+	case "teams":
+		color := map[string]string{"info": "2E7D32", "warning": "F9A825", "critical": "C62828"}[a.Severity]
+		payload = map[string]interface{}{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    alertTitle(a),
+			"themeColor": color,
+			"title":      alertTitle(a),
+			"text":       strings.ReplaceAll(text, "\n", "<br>"),
+			"sections": []map[string]interface{}{{
+				"facts": []map[string]string{
+					{"name": "Event", "value": a.Event},
+					{"name": "Phase", "value": a.Phase},
+					{"name": "Time", "value": a.Time.Format("2006-01-02 15:04:05")},
+				},
+			}},
+		}
+	default:
+		payload = struct {
+			Alert
+			Suppressed int `json:"suppressed,omitempty"`
+		}{a, suppressed}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(h.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// OSPF ADJACENCY INTENT (-ospf-intent)
+// ============================================================================
+//
+// OSPF_Neighbors_Full counts adjacencies, so it passes when a neighbor came
+// up over the wrong link. -ospf-intent checks every adjacency against the
+// design, a CSV of
+//
+//   hostname,neighbor_id,interface,area
+//   UPE1,10.255.0.2,BE100,0
+//
+// Empty interface and area columns are not compared. Interface names match
+// in long or short form (TenGigE0/0/0/1 = Te0/0/0/1, Bundle-Ether100 =
+// BE100); areas match in either notation (0 = 0.0.0.0). The area of an
+// adjacency comes from "show [ip] ospf interface brief", so keep that command
+// in the command files. For every device in the intent:
+//
+//   OK               FULL to the neighbor on the intended interface and area
+//   WRONG_INTERFACE  the neighbor is seen, but over another interface
+//   WRONG_AREA       on the intended interface, in another area
+//   NOT_FULL         the neighbor is seen on the interface but not FULL
+//   MISSING          no adjacency with the neighbor at all
+//   UNEXPECTED       a FULL adjacency the intent does not list
+//
+// -ospf-intent-out FILE writes the live FULL adjacencies of the run in the
+// same format, as a starting point for the design file.
+
+// OSPFIntent is one intended adjacency
+type OSPFIntent struct {
+	Hostname   string
+	NeighborID string
+	Interface  string
+	Area       string
+}
+
+// OSPFAdjacency is a live adjacency with the area of its interface
+type OSPFAdjacency struct {
+	OSPFNeighbor
+	Area string
+}
+
+// OSPFIntentFinding is the outcome for one intent row or unexpected adjacency
+type OSPFIntentFinding struct {
+	Hostname string
+	Intent   *OSPFIntent
+	Live     *OSPFAdjacency
+	Status   string
+}
+
+// loadOSPFIntent reads hostname,neighbor_id,interface,area rows
+func loadOSPFIntent(filename string) ([]OSPFIntent, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var intents []OSPFIntent
+	for i, r := range records {
+		if len(r) < 2 || strings.EqualFold(r[0], "hostname") {
+			continue
+		}
+		for len(r) < 4 {
+			r = append(r, "")
+		}
+		in := OSPFIntent{
+			Hostname:   strings.TrimSpace(r[0]),
+			NeighborID: strings.TrimSpace(r[1]),
+			Interface:  strings.TrimSpace(r[2]),
+			Area:       strings.TrimSpace(r[3]),
+		}
+		if net.ParseIP(in.NeighborID).To4() == nil {
+			return nil, fmt.Errorf("%s line %d: invalid neighbor_id %q", filename, i+1, in.NeighborID)
+		}
+		intents = append(intents, in)
+	}
+	return intents, nil
+}
+
+// parseOSPFInterfaceAreas reads "show [ip] ospf interface brief" into
+// interface -> area:
+//
+//	Interface    PID   Area            IP Address/Mask    Cost  State Nbrs F/C
+//	BE100        1     0               10.0.12.1/30       10    P2P   1/1
+func parseOSPFInterfaceAreas(output string) map[string]string {
+	areas := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		f := strings.Fields(line)
+		if len(f) < 7 || !isInterfaceName(f[0]) || !strings.Contains(f[3], "/") {
+			continue
+		}
+		if _, err := strconv.Atoi(f[1]); err != nil {
+			continue
+		}
+		areas[f[0]] = f[2]
+	}
+	return areas
+}
+
+// interfaceAliases are long forms that do not start with their short form
+var interfaceAliases = map[string]string{
+	"bundle-ether":    "be",
+	"twentyfivegige":  "tf",
+	"fourhundredgige": "fh",
+	"port-channel":    "po",
+}
+
+// sameInterface compares interface names in long or short form
+func sameInterface(a, b string) bool {
+	split := func(s string) (string, string) {
+		s = strings.ToLower(s)
+		i := strings.IndexAny(s, "0123456789")
+		if i < 0 {
+			return s, ""
+		}
+		return s[:i], s[i:]
+	}
+	pa, na := split(a)
+	pb, nb := split(b)
+	if na != nb {
+		return false
+	}
+	if alias, ok := interfaceAliases[pa]; ok {
+		pa = alias
+	}
+	if alias, ok := interfaceAliases[pb]; ok {
+		pb = alias
+	}
+	if len(pa) < 2 || len(pb) < 2 {
+		return pa == pb
+	}
+	return strings.HasPrefix(pa, pb) || strings.HasPrefix(pb, pa)
+}
+
+// sameArea compares OSPF areas in decimal or dotted notation
+func sameArea(a, b string) bool {
+	norm := func(s string) string {
+		if ip := net.ParseIP(s).To4(); ip != nil {
+			return strconv.FormatUint(uint64(ip[0])<<24|uint64(ip[1])<<16|uint64(ip[2])<<8|uint64(ip[3]), 10)
+		}
+		return s
+	}
+	return norm(a) == norm(b)
+}
+
+// ospfAdjacencies returns the live adjacencies of a device with their areas
+func ospfAdjacencies(r *DeviceResult) ([]OSPFAdjacency, bool) {
+	var neighbors []OSPFNeighbor
+	areas := make(map[string]string)
+	collected := false
+	for _, e := range r.Results {
+		cmd := strings.ToLower(e.Command)
+		switch {
+		case strings.Contains(cmd, "ospf interface brief"):
+			for k, v := range parseOSPFInterfaceAreas(e.Output) {
+				areas[k] = v
+			}
+		case strings.Contains(cmd, "ospf neighbor") && !strings.Contains(cmd, "detail"):
+			collected = true
+			neighbors = append(neighbors, parseOSPFNeighbors(e.Output).Neighbors...)
+		}
+	}
+	var adj []OSPFAdjacency
+	for _, n := range neighbors {
+		a := OSPFAdjacency{OSPFNeighbor: n}
+		for iface, area := range areas {
+			if sameInterface(iface, n.Interface) {
+				a.Area = area
+				break
+			}
+		}
+		adj = append(adj, a)
+	}
+	return adj, collected
+}
+
+// auditOSPFIntent checks the devices named in the intent
+func auditOSPFIntent(results []*DeviceResult, intents []OSPFIntent) []OSPFIntentFinding {
+	byHost := make(map[string]*DeviceResult)
+	for _, r := range results {
+		byHost[strings.ToUpper(r.Device.Hostname)] = r
+	}
+
+	var findings []OSPFIntentFinding
+	hosts := make(map[string][]*OSPFIntent)
+	var order []string
+	for i := range intents {
+		h := strings.ToUpper(intents[i].Hostname)
+		if _, ok := hosts[h]; !ok {
+			order = append(order, h)
+		}
+		hosts[h] = append(hosts[h], &intents[i])
+	}
+
+	for _, h := range order {
+		r, ok := byHost[h]
+		if !ok {
+			continue
+		}
+		adj, collected := ospfAdjacencies(r)
+		if !r.Success || !collected {
+			for _, in := range hosts[h] {
+				findings = append(findings, OSPFIntentFinding{Hostname: r.Device.Hostname, Intent: in, Status: "NOT_COLLECTED"})
+			}
+			continue
+		}
+		used := make([]bool, len(adj))
+		for _, in := range hosts[h] {
+			f := OSPFIntentFinding{Hostname: r.Device.Hostname, Intent: in, Status: "MISSING"}
+			onIface := func(a OSPFAdjacency) bool { return in.Interface == "" || sameInterface(in.Interface, a.Interface) }
+			// An adjacency on the intended interface first, then any other
+			pick := func(strict bool) int {
+				for i, a := range adj {
+					if !used[i] && a.NeighborID == in.NeighborID && (!strict || onIface(a)) {
+						return i
+					}
+				}
+				return -1
+			}
+			i := pick(true)
+			if i < 0 {
+				i = pick(false)
+			}
+			if i >= 0 {
+				used[i] = true
+				a := &adj[i]
+				f.Live = a
+				switch {
+				case !onIface(*a):
+					f.Status = "WRONG_INTERFACE"
+				case !a.Full():
+					f.Status = "NOT_FULL"
+				case in.Area != "" && a.Area != "" && !sameArea(in.Area, a.Area):
+					f.Status = "WRONG_AREA"
+				default:
+					f.Status = "OK"
+				}
+			}
+			findings = append(findings, f)
+		}
+		for i := range adj {
+			if !used[i] && adj[i].Full() {
+				findings = append(findings, OSPFIntentFinding{Hostname: r.Device.Hostname, Live: &adj[i], Status: "UNEXPECTED"})
+			}
+		}
+	}
+	return findings
+}
+
+// WriteOSPFIntent writes OSPF_INTENT_<ts>.log
+func (w *OutputWriter) WriteOSPFIntent(findings []OSPFIntentFinding, intentFile string) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("OSPF_INTENT_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	counts := make(map[string]int)
+	for _, f := range findings {
+		counts[f.Status]++
+	}
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO OSPF Adjacency Intent Check\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, " Intent: %s\n", intentFile)
+	fmt.Fprintf(file, "================================================================================\n\n")
+	fmt.Fprintf(file, " OK: %d | WRONG_INTERFACE: %d | WRONG_AREA: %d | NOT_FULL: %d | MISSING: %d | UNEXPECTED: %d | NOT_COLLECTED: %d\n\n",
+		counts["OK"], counts["WRONG_INTERFACE"], counts["WRONG_AREA"], counts["NOT_FULL"], counts["MISSING"],
+		counts["UNEXPECTED"], counts["NOT_COLLECTED"])
+
+	table := newTextTable("HOSTNAME", "NEIGHBOR ID", "INTENDED IF", "AREA", "LIVE IF", "LIVE AREA", "STATE", "STATUS")
+	for _, f := range findings {
+		var id, wantIf, wantArea, liveIf, liveArea, state string
+		if f.Intent != nil {
+			id, wantIf, wantArea = f.Intent.NeighborID, f.Intent.Interface, f.Intent.Area
+		}
+		if f.Live != nil {
+			id, liveIf, liveArea, state = f.Live.NeighborID, f.Live.Interface, f.Live.Area, f.Live.State
+		}
+		table.add(hostSite(f.Hostname), displayHost(f.Hostname), id, orDash(wantIf), orDash(wantArea),
+			orDash(liveIf), orDash(liveArea), orDash(state), f.Status)
+	}
+	table.write(file)
+	return nil
+}
+
+// writeOSPFIntentFile writes the run's FULL adjacencies as an intent CSV
+func writeOSPFIntentFile(path string, results []*DeviceResult) (int, error) {
+	rows := [][]string{{"hostname", "neighbor_id", "interface", "area"}}
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		adj, _ := ospfAdjacencies(r)
+		sort.Slice(adj, func(i, j int) bool { return adj[i].Interface < adj[j].Interface })
+		for _, a := range adj {
+			if a.Full() {
+				rows = append(rows, []string{r.Device.Hostname, a.NeighborID, a.Interface, a.Area})
+			}
+		}
+	}
+	return len(rows) - 1, writeCSVRows(path, rows)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// PACKET CAPTURE (-capture HOST:INTERFACE)
+// ============================================================================
+//
+// When a post-check finds a broken service, the next question is what is on
+// the wire. -capture runs the whole capture in one go:
+//
+//   1. show the capture commands and ask for a typed CAPTURE (-dry-run only
+//      prints them)
+//   2. set up and start the capture on the interface
+//        IOS-XE  Embedded Packet Capture: monitor capture HCCAP interface
+//                ... both, with -capture-match (default any), a buffer of
+//                -capture-mb and a duration limit of -capture-for
+//        IOS-XR  SPAN to file (ASR9K): monitor-session HCCAP ethernet with a
+//                linear file destination of -capture-mb, attached to the
+//                interface; XR captures all traffic (-capture-match ignored)
+//   3. wait -capture-for (Ctrl-C stops early), stop and write the pcap to
+//      bootflash: (XE) or harddisk: (XR) and remove the capture config
+//   4. copy the pcap to <output>/captures/HOST_<ts>.pcap with scp and delete
+//      it from the device (XE; XR asks for confirmation, so the file stays
+//      and the log says how to remove it)
+//
+// The commands and device output of every step go to HOST_<ts>.log beside
+// the pcap. For a VRF, capture on the interface (or sub-interface) in that
+// VRF. XE needs "ip scp server enable" for step 4.
+
+const captureName = "HCCAP"
+
+// captureSpec is one capture request
+type captureSpec struct {
+	Device    DeviceInfo
+	Interface string
+	Duration  time.Duration
+	SizeMB    int
+	Match     string
+	File      string // pcap name on the device
+}
+
+// captureSteps are the command sets of a capture
+type captureSteps struct {
+	Start   []string
+	Stop    []string // stop, write the file, remove the capture config
+	Remote  string   // pcap path on the device, for scp
+	Delete  []string // remove the pcap from the device ("" = leave it)
+	Cleanup []string // undo Start when something failed
+}
+
+// parseCapture reads HOST:INTERFACE and resolves the host in the inventory
+func parseCapture(spec string, devices map[string]DeviceInfo, config *Config) (*captureSpec, error) {
+	host, iface, ok := strings.Cut(spec, ":")
+	host, iface = strings.TrimSpace(host), strings.TrimSpace(iface)
+	if !ok || host == "" || iface == "" {
+		return nil, fmt.Errorf("invalid capture %q (expected HOST:INTERFACE)", spec)
+	}
+	d, ok := devices[strings.ToUpper(host)]
+	if !ok {
+		return nil, fmt.Errorf("%s not in inventory", host)
+	}
+	if d.DetectedOS != "IOS-XR" && d.DetectedOS != "IOS-XE" {
+		return nil, fmt.Errorf("%s: packet capture needs IOS-XR or IOS-XE, not %s", d.Hostname, d.DetectedOS)
+	}
+	if config.CaptureFor <= 0 || config.CaptureMB < 1 {
+		return nil, fmt.Errorf("-capture-for and -capture-mb must be positive")
+	}
+	return &captureSpec{
+		Device:    d,
+		Interface: iface,
+		Duration:  config.CaptureFor,
+		SizeMB:    config.CaptureMB,
+		Match:     config.CaptureMatch,
+		File:      fmt.Sprintf("hc_%s_%s", strings.ToLower(d.Hostname), time.Now().Format("20060102_150405")),
+	}, nil
+}
+
+// steps builds the commands for the device OS
+func (c *captureSpec) steps() captureSteps {
+	if c.Device.DetectedOS == "IOS-XE" {
+		match := c.Match
+		if match == "" {
+			match = "any"
+		}
+		return captureSteps{
+			Start: []string{
+				fmt.Sprintf("monitor capture %s interface %s both", captureName, c.Interface),
+				fmt.Sprintf("monitor capture %s match %s", captureName, match),
+				fmt.Sprintf("monitor capture %s buffer size %d", captureName, c.SizeMB),
+				fmt.Sprintf("monitor capture %s limit duration %d", captureName, int(c.Duration.Seconds())),
+				fmt.Sprintf("monitor capture %s start", captureName),
+			},
+			Stop: []string{
+				fmt.Sprintf("monitor capture %s stop", captureName),
+				fmt.Sprintf("monitor capture %s export bootflash:%s.pcap", captureName, c.File),
+				fmt.Sprintf("no monitor capture %s", captureName),
+			},
+			Remote: "bootflash:" + c.File + ".pcap",
+			Delete: []string{"delete /force bootflash:" + c.File + ".pcap"},
+			Cleanup: []string{
+				fmt.Sprintf("monitor capture %s stop", captureName),
+				fmt.Sprintf("no monitor capture %s", captureName),
+			},
+		}
+	}
+	// Results are keyed by command, so each set avoids repeating a line
+	unconfigure := []string{
+		"configure",
+		"interface " + c.Interface,
+		fmt.Sprintf("no monitor-session %s ethernet", captureName),
+		"root",
+		fmt.Sprintf("no monitor-session %s", captureName),
+		"commit",
+		"end",
+	}
+	return captureSteps{
+		Start: []string{
+			"configure",
+			fmt.Sprintf("monitor-session %s ethernet", captureName),
+			fmt.Sprintf("destination file size %d buffer-type linear", c.SizeMB*1024),
+			"root",
+			"interface " + c.Interface,
+			fmt.Sprintf("monitor-session %s ethernet port-level", captureName),
+			"commit",
+			"end",
+			fmt.Sprintf("monitor-session %s packet-collection start", captureName),
+		},
+		Stop: append([]string{
+			fmt.Sprintf("monitor-session %s packet-collection stop write directory harddisk: filename %s", captureName, c.File),
+		}, unconfigure...),
+		Remote:  "harddisk:/" + c.File + ".pcap",
+		Cleanup: unconfigure,
+	}
+}
+
+// captureLog records each step's commands and output
+type captureLog struct {
+	file *atomicFile
+}
+
+func (l *captureLog) step(title string, commands []string, outputs map[string]string, err error) {
+	fmt.Fprintf(l.file, "\n=== %s (%s) ===\n", title, time.Now().Format("15:04:05"))
+	for _, c := range commands {
+		fmt.Fprintf(l.file, "> %s\n", c)
+		if out := strings.TrimSpace(outputs[c]); out != "" {
+			fmt.Fprintf(l.file, "%s\n", out)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(l.file, "ERROR: %v\n", err)
+	}
+}
+
+// runCaptureStep sends a command set as a configuration batch and fails on
+// a session error or a rejected or unfinished line
+func runCaptureStep(client *SSHClient, l *captureLog, title string, commands []string) error {
+	outputs, err := client.ExecuteConfig(commands)
+	if err == nil {
+		for _, c := range commands {
+			out := outputs[c]
+			if isCommandRejected(out) {
+				err = fmt.Errorf("%q rejected: %s", c, rejectionLine(out))
+				break
+			}
+			if isIncompleteOutput(out) {
+				err = fmt.Errorf("%q did not complete", c)
+				break
+			}
+		}
+	}
+	l.step(title, commands, outputs, err)
+	return err
+}
+
+// fetchCapture copies the pcap from the device with scp
+func fetchCapture(client *SSHClient, remote, local string) error {
+	proxyArgs, err := sshProxyArgs(client.proxy)
+	if err != nil {
+		return err
+	}
+	// -O: the device scp servers do not speak the SFTP protocol newer
+	// OpenSSH clients default to
+	args := []string{
+		"-O",
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=" + os.DevNull,
+		"-o", "ConnectTimeout=30",
+		"-o", "LogLevel=ERROR",
+		"-P", strconv.Itoa(client.port),
+	}
+	args = append(args, proxyArgs...)
+	args = append(args, fmt.Sprintf("%s@%s:%s", client.username, client.host, remote), local)
+
+	cmd, err := client.authCommand("scp", args)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	cmd.WaitDelay = 5 * time.Second
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	timer := time.AfterFunc(client.cmdTimeout, func() { cmd.Process.Kill() })
+	err = cmd.Wait()
+	if !timer.Stop() {
+		return fmt.Errorf("scp timed out after %s", client.cmdTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("scp: %v: %s", err, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
+
+// runCapture performs the capture workflow and returns the local pcap path
+func runCapture(config *Config, c *captureSpec) (string, error) {
+	steps := c.steps()
+	fmt.Fprintf(os.Stderr, "\nPacket capture on %s %s (%s, %s, %d MB):\n", c.Device.Hostname, c.Interface,
+		c.Device.DetectedOS, c.Duration, c.SizeMB)
+	for _, cmd := range append(append([]string{}, steps.Start...), steps.Stop...) {
+		fmt.Fprintf(os.Stderr, "    %s\n", cmd)
+	}
+	if c.Device.DetectedOS == "IOS-XR" && c.Match != "" {
+		log.Printf("⚠ -capture-match applies to IOS-XE only; %s captures all traffic of %s", c.Device.Hostname, c.Interface)
+	}
+	if config.DryRun {
+		log.Printf("DRY-RUN capture: nothing sent to %s", c.Device.Hostname)
+		return "", nil
+	}
+	if answer := promptLine(fmt.Sprintf("Type CAPTURE to configure it on %s: ", c.Device.Hostname)); answer != "CAPTURE" {
+		return "", fmt.Errorf("not confirmed")
+	}
+
+	dir := filepath.Join(config.OutputDir, "captures")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	base := filepath.Join(dir, fmt.Sprintf("%s_%s", c.Device.Hostname, time.Now().Format("20060102_150405")))
+	file, err := createAtomic(base + ".log")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	l := &captureLog{file}
+	fmt.Fprintf(file, "Packet capture %s %s (%s) for %s, %d MB\n", c.Device.Hostname, c.Interface, c.Device.DetectedOS, c.Duration, c.SizeMB)
+
+	client := newDeviceClient(c.Device, config)
+	client.pool = nil
+	// Ctrl-C ends the capture early; stopping, fetching and removing it
+	// must still run
+	client.stop = nil
+	config.Stop.stopIsNormal()
+	if err := runCaptureStep(client, l, "start", steps.Start); err != nil {
+		// A new session, so a timed-out start does not cut the cleanup short
+		outputs, cerr := client.ExecuteConfig(steps.Cleanup)
+		l.step("cleanup", steps.Cleanup, outputs, cerr)
+		if cerr != nil {
+			log.Printf("✗ %s: capture cleanup failed, remove by hand:\n    %s", c.Device.Hostname, strings.Join(steps.Cleanup, "\n    "))
+		}
+		return "", fmt.Errorf("start: %v", err)
+	}
+
+	log.Printf("Capturing on %s %s for %s (Ctrl-C stops early)...", c.Device.Hostname, c.Interface, c.Duration)
+	select {
+	case <-time.After(c.Duration):
+	case <-config.Stop.Done():
+		log.Printf("Stopping the capture early")
+	}
+
+	if err := runCaptureStep(client, l, "stop", steps.Stop); err != nil {
+		log.Printf("✗ %s: check and remove the capture config by hand:\n    %s", c.Device.Hostname, strings.Join(steps.Cleanup, "\n    "))
+		return "", fmt.Errorf("stop: %v", err)
+	}
+
+	local := base + ".pcap"
+	if err := fetchCapture(client, steps.Remote, local); err != nil {
+		l.step("scp "+steps.Remote, nil, nil, err)
+		return "", fmt.Errorf("%v (the capture is still on the device as %s)", err, steps.Remote)
+	}
+	l.step("scp "+steps.Remote+" -> "+local, nil, nil, nil)
+
+	if len(steps.Delete) == 0 {
+		log.Printf("The capture remains on %s as %s; remove it with: delete %s", c.Device.Hostname, steps.Remote, steps.Remote)
+	} else if err := runCaptureStep(client, l, "delete", steps.Delete); err != nil {
+		log.Printf("⚠ %s: could not delete %s: %v", c.Device.Hostname, steps.Remote, err)
+	}
+	return local, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Every testdata/parsers/<OS>/*.raw fixture against its .metrics file, as
+// -parse-check runs them
+func TestParserFixtures(t *testing.T) {
+	raws, err := filepath.Glob(filepath.Join("testdata", "parsers", "*", "*.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raws) == 0 {
+		t.Fatal("no testdata/parsers/<OS>/*.raw fixtures")
+	}
+	for _, raw := range raws {
+		name := filepath.Base(filepath.Dir(raw)) + "/" + strings.TrimSuffix(filepath.Base(raw), ".raw")
+		t.Run(name, func(t *testing.T) {
+			command, mismatches, err := checkParserFixture(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range mismatches {
+				t.Errorf("%s: %s", command, m)
+			}
+		})
+	}
+}
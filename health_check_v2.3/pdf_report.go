@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// PDF REPORT (-pdf run_dir[,baseline_dir])
+// ============================================================================
+//
+// Change tickets take attachments, not directories. -pdf renders the text
+// reports of a run into one REPORT_<ts>.pdf in the run directory:
+//
+//   1. SUMMARY         device totals and per-device status, and the
+//                      roll-up by role and site
+//   2. COMPARISON      pre/post deltas, when a baseline is given (it is
+//                      compared first, see comparePhases) or the run
+//                      already has a COMPARISON_REPORT.txt
+//   3. the check reports present in the run: ping, disk, readiness,
+//      redundancy, audits, fleet findings, monitor and rollback logs
+//
+// Each section starts on a new page. The writer below is a minimal PDF 1.4
+// generator: landscape A4, the built-in Courier fonts (so the fixed-width
+// tables keep their alignment) and no compression. Characters outside
+// Latin-1 are replaced with ASCII equivalents.
+
+// pdfSections are the run reports in the order they appear in the PDF
+var pdfSections = []struct{ prefix, title string }{
+	{"SUMMARY_", "Summary"},
+	{"GO_NO_GO_", "Go/No-Go decision"},
+	{"ROLLUP_", "Roll-up by role and site"},
+	{"COMPARISON_REPORT", "Baseline comparison"},
+	{"PING_STATS_", "Ping results"},
+	{"CRITICAL_SERVICES_", "Critical services"},
+	{"EEM_WATCH_", "EEM watchers"},
+	{"REDUNDANCY_", "RP redundancy"},
+	{"SR_CHECK_", "Segment Routing"},
+	{"ISIS_", "IS-IS neighbors"},
+	{"PAIRS_", "Node pairs"},
+	{"PROFILES_", "Check profiles"},
+	{"LOG_EVENTS_", "Logging events"},
+	{"READINESS_", "Upgrade readiness"},
+	{"DISK_SPACE_", "Disk space"},
+	{"PEER_AUDIT_", "BGP peer audit"},
+	{"OSPF_INTENT_", "OSPF adjacency intent"},
+	{"RPL_AUDIT_", "Route-policy audit"},
+	{"STATIC_ROUTES_", "Static route audit"},
+	{"FLEET_FINDINGS_", "Fleet findings"},
+	{"MONITOR_", "Window monitors"},
+	{"ROLLBACK_", "Rollback log"},
+}
+
+const (
+	pdfPageWidth  = 842 // A4 landscape, points
+	pdfPageHeight = 595
+	pdfMargin     = 36
+	pdfFontSize   = 7.5
+	pdfLeading    = 9
+	pdfMaxColumns = 170 // (842 - 2*36) / (7.5 * 0.6), Courier is 0.6 em wide
+)
+
+var pdfReplacer = strings.NewReplacer("✓", "OK", "✗", "X", "⚠", "!", "→", "->", "←", "<-", "↑", "^", "↓", "v",
+	"—", "-", "–", "-", "…", "...", "⏸", "||", "•", "*", "\t", "    ")
+
+type pdfLine struct {
+	text string
+	bold bool
+}
+
+// pdfDoc collects pages of text lines
+type pdfDoc struct {
+	pages [][]pdfLine
+}
+
+func (d *pdfDoc) linesPerPage() int {
+	return (pdfPageHeight - 2*pdfMargin) / pdfLeading
+}
+
+// newPage starts a page unless the current one is still empty
+func (d *pdfDoc) newPage() {
+	if n := len(d.pages); n == 0 || len(d.pages[n-1]) > 0 {
+		d.pages = append(d.pages, nil)
+	}
+}
+
+// add appends a line, wrapping long lines and breaking pages as needed
+func (d *pdfDoc) add(text string, bold bool) {
+	text = strings.TrimRight(pdfReplacer.Replace(text), " \r")
+	for {
+		chunk := text
+		runes := []rune(text)
+		if len(runes) > pdfMaxColumns {
+			chunk, text = string(runes[:pdfMaxColumns]), "    "+string(runes[pdfMaxColumns:])
+		} else {
+			text = ""
+		}
+		if len(d.pages) == 0 || len(d.pages[len(d.pages)-1]) >= d.linesPerPage() {
+			d.pages = append(d.pages, nil)
+		}
+		d.pages[len(d.pages)-1] = append(d.pages[len(d.pages)-1], pdfLine{chunk, bold})
+		if text == "" {
+			return
+		}
+	}
+}
+
+// pdfString encodes text as a PDF literal string in WinAnsi/Latin-1
+func pdfString(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// write renders the document
+func (d *pdfDoc) write(title string) []byte {
+	var buf bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	if len(d.pages) == 0 {
+		d.pages = append(d.pages, nil)
+	}
+
+	// 1 catalog, 2 page tree, 3-4 fonts, 5 info, then page + content pairs
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	var kids []string
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 6+2*i))
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+	obj(fmt.Sprintf("<< /Title %s /Producer %s /CreationDate (D:%s) >>",
+		pdfString(title), pdfString("MERALCO health check v"+Version), time.Now().Format("20060102150405")))
+
+	for i, page := range d.pages {
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT\n%d TL\n%d %d Td\n", pdfLeading, pdfMargin, pdfPageHeight-pdfMargin)
+		font := ""
+		for _, l := range page {
+			f := "/F1"
+			if l.bold {
+				f = "/F2"
+			}
+			if f != font {
+				fmt.Fprintf(&content, "%s %g Tf\n", f, pdfFontSize)
+				font = f
+			}
+			fmt.Fprintf(&content, "%s '\n", pdfString(l.text))
+		}
+		content.WriteString("ET\n")
+		footer := fmt.Sprintf("%s - page %d of %d", title, i+1, len(d.pages))
+		fmt.Fprintf(&content, "BT\n/F1 7 Tf\n%d %d Td\n%s Tj\nET\n", pdfMargin, pdfMargin/2, pdfString(footer))
+
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 7+2*i))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
+
+// isHeadingLine picks the report lines printed in bold
+func isHeadingLine(line string) bool {
+	t := strings.TrimSpace(line)
+	return strings.HasPrefix(t, "MERALCO") || strings.HasPrefix(t, "--- ") ||
+		(strings.HasPrefix(t, "===") && strings.HasSuffix(t, "===")) ||
+		(strings.HasPrefix(t, "[") && strings.HasSuffix(t, "]"))
+}
+
+// writePDFReport renders the reports of runDir (comparing it against
+// baseDir first when given) and returns the PDF path
+func writePDFReport(config *Config, runDir, baseDir string) (string, error) {
+	runDir = resolveRunDir(runDir)
+	entries, err := os.ReadDir(runDir)
+	if err != nil {
+		return "", err
+	}
+	if baseDir != "" {
+		report := filepath.Join(runDir, "COMPARISON_REPORT.txt")
+		verdict, err := comparePhases(baseDir, runDir, report, config.Bands)
+		if err != nil {
+			return "", fmt.Errorf("comparison against %s: %v", baseDir, err)
+		}
+		log.Printf("Comparison report: %s (verdict: %s)", report, verdict)
+		if entries, err = os.ReadDir(runDir); err != nil {
+			return "", err
+		}
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && (strings.HasSuffix(e.Name(), ".log") || strings.HasSuffix(e.Name(), ".txt")) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	title := "MERALCO Health Check Report - " + filepath.Base(filepath.Dir(runDir)) + " " + filepath.Base(runDir)
+	doc := &pdfDoc{}
+	doc.add(title, true)
+	doc.add("Run directory: "+runDir, false)
+	if baseDir != "" {
+		doc.add("Baseline:      "+baseDir, false)
+	}
+	doc.add("Generated:     "+time.Now().Format("2006-01-02 15:04:05"), false)
+	doc.add("", false)
+
+	var contents []string
+	sections := 0
+	for _, s := range pdfSections {
+		for _, name := range names {
+			if !strings.HasPrefix(name, s.prefix) {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(runDir, name))
+			if err != nil {
+				return "", err
+			}
+			sections++
+			contents = append(contents, fmt.Sprintf("%2d. %-22s %s", sections, s.title, name))
+			doc.newPage()
+			doc.add(fmt.Sprintf("%d. %s (%s)", sections, s.title, name), true)
+			doc.add("", false)
+			for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+				doc.add(line, isHeadingLine(line))
+			}
+		}
+	}
+	if sections == 0 {
+		return "", fmt.Errorf("no reports in %s", runDir)
+	}
+
+	// Table of contents on the cover page
+	cover := doc.pages[0]
+	cover = append(cover, pdfLine{"Contents", true})
+	for _, c := range contents {
+		cover = append(cover, pdfLine{c, false})
+	}
+	doc.pages[0] = cover
+
+	path := filepath.Join(runDir, fmt.Sprintf("REPORT_%s.pdf", time.Now().Format("20060102_150405")))
+	if err := writeFileAtomic(path, doc.write(title)); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// BGP PEER REGISTRY AUDIT - configured neighbors vs the expected peer list
+// ============================================================================
+//
+// Registry CSV: neighbor,vrf,remote_as,description,policy_in,policy_out
+// An empty vrf matches the neighbor in any VRF; empty columns are not checked.
+
+// PeerEntry is one expected BGP peer
+type PeerEntry struct {
+	Neighbor    string
+	VRF         string
+	RemoteAS    string
+	Description string
+	PolicyIn    string
+	PolicyOut   string
+}
+
+// PeerFinding is the audit outcome for one configured neighbor
+type PeerFinding struct {
+	Hostname string
+	Neighbor *BGPNeighborConfig
+	Expected *PeerEntry
+	Issues   []string // UNKNOWN, REMOTE_AS, DESCRIPTION, POLICY_IN, POLICY_OUT
+}
+
+// loadPeerRegistry reads the registry CSV
+func loadPeerRegistry(filename string) ([]PeerEntry, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var peers []PeerEntry
+	for _, r := range records {
+		if len(r) < 3 || strings.EqualFold(r[0], "neighbor") {
+			continue
+		}
+		for len(r) < 6 {
+			r = append(r, "")
+		}
+		peers = append(peers, PeerEntry{
+			Neighbor:    strings.TrimSpace(r[0]),
+			VRF:         strings.TrimSpace(r[1]),
+			RemoteAS:    strings.TrimSpace(r[2]),
+			Description: strings.TrimSpace(r[3]),
+			PolicyIn:    strings.TrimSpace(r[4]),
+			PolicyOut:   strings.TrimSpace(r[5]),
+		})
+	}
+	return peers, nil
+}
+
+// lookupPeer prefers an entry for the neighbor's VRF over a VRF-less one
+func lookupPeer(peers []PeerEntry, vrf, addr string) *PeerEntry {
+	var any *PeerEntry
+	for i := range peers {
+		p := &peers[i]
+		if p.Neighbor != addr {
+			continue
+		}
+		if strings.EqualFold(p.VRF, vrf) {
+			return p
+		}
+		if p.VRF == "" && any == nil {
+			any = p
+		}
+	}
+	return any
+}
+
+// auditPeers checks every configured neighbor against the registry and
+// returns the findings plus the registry peers configured nowhere.
+func auditPeers(results []*DeviceResult, peers []PeerEntry) ([]PeerFinding, []PeerEntry) {
+	var findings []PeerFinding
+	used := make(map[*PeerEntry]bool)
+	audited := 0
+
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		var rc *RunningConfig
+		for _, e := range r.Results {
+			if isRunningConfig(e.Command) {
+				rc = parseRunningConfig(e.Output)
+				break
+			}
+		}
+		if rc == nil {
+			continue
+		}
+		audited++
+
+		for _, n := range rc.Neighbors {
+			f := PeerFinding{Hostname: r.Device.Hostname, Neighbor: n}
+			p := lookupPeer(peers, n.VRF, n.Address)
+			if p == nil {
+				f.Issues = []string{"UNKNOWN"}
+				findings = append(findings, f)
+				continue
+			}
+			used[p] = true
+			f.Expected = p
+			if p.RemoteAS != "" && p.RemoteAS != n.RemoteAS {
+				f.Issues = append(f.Issues, "REMOTE_AS")
+			}
+			if p.Description != "" && !strings.EqualFold(p.Description, n.Description) {
+				f.Issues = append(f.Issues, "DESCRIPTION")
+			}
+			if p.PolicyIn != "" && p.PolicyIn != n.PolicyIn {
+				f.Issues = append(f.Issues, "POLICY_IN")
+			}
+			if p.PolicyOut != "" && p.PolicyOut != n.PolicyOut {
+				f.Issues = append(f.Issues, "POLICY_OUT")
+			}
+			findings = append(findings, f)
+		}
+	}
+
+	var unused []PeerEntry
+	if audited > 0 {
+		for i := range peers {
+			if !used[&peers[i]] {
+				unused = append(unused, peers[i])
+			}
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Hostname < findings[j].Hostname
+	})
+	return findings, unused
+}
+
+// WritePeerAudit writes PEER_AUDIT_<ts>.log
+func (w *OutputWriter) WritePeerAudit(findings []PeerFinding, unused []PeerEntry, registry string) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("PEER_AUDIT_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	problems := 0
+	for _, f := range findings {
+		if len(f.Issues) > 0 {
+			problems++
+		}
+	}
+
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO BGP Peer Registry Audit\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, " Registry: %s\n", registry)
+	fmt.Fprintf(file, "================================================================================\n\n")
+	fmt.Fprintf(file, " Neighbors: %d | Problems: %d | Registry peers not configured: %d\n\n",
+		len(findings), problems, len(unused))
+
+	table := newTextTable("HOSTNAME", "VRF", "NEIGHBOR", "AS", "DESCRIPTION", "STATUS")
+	for _, f := range findings {
+		n := f.Neighbor
+		status := "OK"
+		if len(f.Issues) > 0 {
+			status = strings.Join(f.Issues, ",")
+		}
+		table.add(hostSite(f.Hostname), displayHost(f.Hostname), n.VRF, n.Address, orDash(n.RemoteAS), orDash(n.Description), status)
+		if f.Expected == nil {
+			continue
+		}
+		for _, issue := range f.Issues {
+			switch issue {
+			case "REMOTE_AS":
+				table.note("    remote-as:   expected %s, configured %s", f.Expected.RemoteAS, orDash(n.RemoteAS))
+			case "DESCRIPTION":
+				table.note("    description: expected %q, configured %q", f.Expected.Description, n.Description)
+			case "POLICY_IN":
+				table.note("    policy in:   expected %s, configured %s", f.Expected.PolicyIn, orDash(n.PolicyIn))
+			case "POLICY_OUT":
+				table.note("    policy out:  expected %s, configured %s", f.Expected.PolicyOut, orDash(n.PolicyOut))
+			}
+		}
+	}
+	table.write(file)
+
+	if len(unused) > 0 {
+		fmt.Fprintf(file, "\nRegistry peers not configured on any audited device:\n")
+		for _, p := range unused {
+			fmt.Fprintf(file, "  %-16s vrf %-12s AS %-8s %s\n", p.Neighbor, orDash(p.VRF), orDash(p.RemoteAS), p.Description)
+		}
+	}
+	return nil
+}
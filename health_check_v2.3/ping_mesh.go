@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// FULL-MESH PING MATRIX (-ping-mesh)
+// ============================================================================
+//
+// The ping lines of the command files test one destination from one device.
+// For the end-to-end connectivity sign-off, -ping-mesh pings from every
+// target device to every other one and exits:
+//
+//   1. each device's -ping-mesh-source address (Loopback0) is read from
+//      "show running-config interface Loopback0"
+//   2. every device pings every other device's address, sourced from that
+//      interface ("ping A source Loopback0"), -w devices at a time
+//
+// With -ping-mesh-targets FILE the targets come from a per-VRF list instead,
+// one "VRF NAME ADDRESS" per line ("default" = global table, # comments),
+// and every device pings every target of every VRF ("ping vrf V A"); a
+// target named like the device itself is skipped. Each VRF gives an
+// N x M matrix of success rates, judged with -ping-thresholds like the
+// command-file pings (PASS, PARTIAL, FAIL, or "no data" when the device was
+// not reached). The matrix is printed and written to <output>/ping_mesh/:
+//
+//   PING_MESH_<ts>.json   every cell with sent/received, RTT and status
+//   PING_MESH_<ts>.html   heat map, one table per VRF (hover for details)
+//
+// The exit status is 1 when any pair did not pass.
+
+const pingMeshDirName = "ping_mesh"
+
+var meshAddressRe = regexp.MustCompile(`^\s*ip(?:v4)? address (\d+\.\d+\.\d+\.\d+)`)
+
+// MeshTarget is one column of the matrix
+type MeshTarget struct {
+	VRF     string `json:"vrf"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// MeshCell is one source/target pair
+type MeshCell struct {
+	Source     string  `json:"source"`
+	Target     string  `json:"target"`
+	Address    string  `json:"address"`
+	Command    string  `json:"command,omitempty"`
+	Sent       int     `json:"sent"`
+	Received   int     `json:"received"`
+	SuccessPct int     `json:"success_pct"`
+	AvgMs      float64 `json:"avg_ms,omitempty"`
+	MaxMs      float64 `json:"max_ms,omitempty"`
+	Status     string  `json:"status"` // PASS, PARTIAL, FAIL, NO_DATA
+	Error      string  `json:"error,omitempty"`
+}
+
+// MeshMatrix is the matrix of one VRF
+type MeshMatrix struct {
+	VRF     string       `json:"vrf"`
+	Sources []string     `json:"sources"`
+	Targets []MeshTarget `json:"targets"`
+	Cells   []MeshCell   `json:"cells"`
+}
+
+func (m *MeshMatrix) cell(source, target string) (MeshCell, bool) {
+	for _, c := range m.Cells {
+		if c.Source == source && c.Target == target {
+			return c, true
+		}
+	}
+	return MeshCell{}, false
+}
+
+// loadMeshTargets reads the VRF NAME ADDRESS list of -ping-mesh-targets
+func loadMeshTargets(path string) ([]MeshTarget, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var targets []MeshTarget
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) != 3 || !apiVRFRe.MatchString(f[0]) || !isIPAddress(f[2]) {
+			return nil, fmt.Errorf("%s:%d: expected VRF NAME ADDRESS", path, n)
+		}
+		targets = append(targets, MeshTarget{VRF: f[0], Name: f[1], Address: f[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s: no targets", path)
+	}
+	return targets, nil
+}
+
+// forEachDevice runs fn for every device, -w at a time
+func forEachDevice(config *Config, devices []DeviceInfo, fn func(DeviceInfo)) {
+	queue := make(chan DeviceInfo)
+	var wg sync.WaitGroup
+	for i := 0; i < config.MaxWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range queue {
+				fn(d)
+			}
+		}()
+	}
+	for _, d := range devices {
+		queue <- d
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// meshLoopbacks reads the source interface address of every device
+func meshLoopbacks(config *Config, devices []DeviceInfo) []MeshTarget {
+	command := "show running-config interface " + config.PingMeshSrc
+	var mu sync.Mutex
+	byHost := make(map[string]string)
+	forEachDevice(config, devices, func(d DeviceInfo) {
+		outputs, err := newDeviceClient(d, config).ExecuteCommands([]string{command})
+		address := ""
+		if err == nil && !isCommandRejected(outputs[command]) {
+			for _, line := range strings.Split(outputs[command], "\n") {
+				if m := meshAddressRe.FindStringSubmatch(line); m != nil {
+					address = m[1]
+					break
+				}
+			}
+		}
+		switch {
+		case err != nil:
+			log.Printf("✗ %s: %v", d.Hostname, err)
+		case address == "":
+			log.Printf("⚠ %s: no address on %s; not a target", d.Hostname, config.PingMeshSrc)
+		}
+		mu.Lock()
+		byHost[d.Hostname] = address
+		mu.Unlock()
+	})
+
+	var targets []MeshTarget
+	for _, d := range devices {
+		if a := byHost[d.Hostname]; a != "" {
+			targets = append(targets, MeshTarget{VRF: "default", Name: d.Hostname, Address: a})
+		}
+	}
+	return targets
+}
+
+// meshCommand is the ping a source runs for a target
+func meshCommand(config *Config, t MeshTarget, fromFile bool) string {
+	switch {
+	case t.VRF != "default":
+		return fmt.Sprintf("ping vrf %s %s", t.VRF, t.Address)
+	case fromFile:
+		return "ping " + t.Address
+	}
+	return fmt.Sprintf("ping %s source %s", t.Address, config.PingMeshSrc)
+}
+
+// runPingMesh pings the full mesh, writes the matrix and reports failures
+func runPingMesh(config *Config, devices []DeviceInfo) error {
+	var targets []MeshTarget
+	fromFile := config.PingMeshFile != ""
+	if fromFile {
+		var err error
+		if targets, err = loadMeshTargets(config.PingMeshFile); err != nil {
+			return err
+		}
+	} else {
+		log.Printf("Ping mesh: reading %s of %d devices...", config.PingMeshSrc, len(devices))
+		targets = meshLoopbacks(config, devices)
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("no targets to ping")
+	}
+
+	matrices := make(map[string]*MeshMatrix)
+	var vrfs []string
+	for _, t := range targets {
+		m, ok := matrices[t.VRF]
+		if !ok {
+			m = &MeshMatrix{VRF: t.VRF}
+			matrices[t.VRF] = m
+			vrfs = append(vrfs, t.VRF)
+			for _, d := range devices {
+				m.Sources = append(m.Sources, d.Hostname)
+			}
+		}
+		m.Targets = append(m.Targets, t)
+	}
+	sort.Strings(vrfs)
+
+	log.Printf("Ping mesh: %d devices x %d targets...", len(devices), len(targets))
+	var mu sync.Mutex
+	forEachDevice(config, devices, func(d DeviceInfo) {
+		var todo []MeshTarget
+		var commands []string
+		for _, t := range targets {
+			if !strings.EqualFold(t.Name, d.Hostname) {
+				todo = append(todo, t)
+				commands = append(commands, meshCommand(config, t, fromFile))
+			}
+		}
+		outputs, err := newDeviceClient(d, config).ExecuteCommands(commands)
+		cells := make([]MeshCell, len(todo))
+		for i, t := range todo {
+			c := MeshCell{Source: d.Hostname, Target: t.Name, Address: t.Address, Command: commands[i], Status: "NO_DATA"}
+			if err != nil {
+				c.Error = err.Error()
+			} else if p, ok := parsePingOutput(commands[i], outputs[commands[i]]); ok {
+				p.Hostname = d.Hostname
+				c.Sent, c.Received, c.SuccessPct, c.AvgMs, c.MaxMs = p.Sent, p.Received, p.SuccessPct, p.AvgMs, p.MaxMs
+				c.Status = config.Ping.status(p)
+			} else {
+				c.Error = "no ping result in device output"
+			}
+			cells[i] = c
+		}
+		mu.Lock()
+		for i, t := range todo {
+			matrices[t.VRF].Cells = append(matrices[t.VRF].Cells, cells[i])
+		}
+		mu.Unlock()
+		if err != nil {
+			log.Printf("✗ %s: %v", d.Hostname, err)
+		}
+	})
+
+	var ordered []*MeshMatrix
+	counts := make(map[string]int)
+	for _, v := range vrfs {
+		m := matrices[v]
+		sort.Slice(m.Cells, func(i, j int) bool {
+			if m.Cells[i].Source != m.Cells[j].Source {
+				return m.Cells[i].Source < m.Cells[j].Source
+			}
+			return m.Cells[i].Target < m.Cells[j].Target
+		})
+		for _, c := range m.Cells {
+			counts[c.Status]++
+		}
+		ordered = append(ordered, m)
+		writeMeshText(os.Stdout, m)
+	}
+
+	dir := filepath.Join(config.OutputDir, pingMeshDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	ts := time.Now().Format("20060102_150405")
+	source := config.PingMeshSrc
+	if fromFile {
+		source = ""
+	}
+	jsonPath, err := writeMeshJSON(filepath.Join(dir, "PING_MESH_"+ts+".json"), ordered, source)
+	if err != nil {
+		return err
+	}
+	htmlPath, err := writeMeshHTML(filepath.Join(dir, "PING_MESH_"+ts+".html"), ordered)
+	if err != nil {
+		return err
+	}
+	log.Printf("Ping mesh: PASS %d | PARTIAL %d | FAIL %d | no data %d", counts["PASS"], counts["PARTIAL"], counts["FAIL"], counts["NO_DATA"])
+	log.Printf("Ping mesh matrix: %s, %s", jsonPath, htmlPath)
+
+	if bad := counts["PARTIAL"] + counts["FAIL"] + counts["NO_DATA"]; bad > 0 {
+		return fmt.Errorf("%d of %d pairs did not pass", bad, bad+counts["PASS"])
+	}
+	return nil
+}
+
+// meshMark is the text matrix symbol of a cell
+func meshMark(c MeshCell, ok bool) string {
+	switch {
+	case !ok:
+		return "-"
+	case c.Status == "NO_DATA":
+		return "?"
+	case c.Status == "PASS":
+		return "ok"
+	}
+	return fmt.Sprintf("%d%%", c.SuccessPct)
+}
+
+// writeMeshText prints the pass/fail matrix of one VRF; targets are numbered
+// so the columns stay narrow
+func writeMeshText(out *os.File, m *MeshMatrix) {
+	fmt.Fprintf(out, "\nPing mesh, VRF %s (ok = passed, N%% = success rate, ? = no data, - = self):\n\n", m.VRF)
+	header := []string{"SOURCE"}
+	for i := range m.Targets {
+		header = append(header, fmt.Sprintf("%d", i+1))
+	}
+	table := newTextTable(header...)
+	for _, s := range m.Sources {
+		cells := []interface{}{displayHost(s)}
+		for _, t := range m.Targets {
+			c, ok := m.cell(s, t.Name)
+			cells = append(cells, meshMark(c, ok))
+		}
+		table.add("", cells...)
+	}
+	table.write(out)
+	fmt.Fprintln(out)
+	for i, t := range m.Targets {
+		fmt.Fprintf(out, "  %d = %s %s\n", i+1, displayHost(t.Name), t.Address)
+	}
+}
+
+func writeMeshJSON(path string, matrices []*MeshMatrix, source string) (string, error) {
+	doc := struct {
+		Generated string        `json:"generated"`
+		Source    string        `json:"source_interface,omitempty"`
+		Matrices  []*MeshMatrix `json:"matrices"`
+	}{time.Now().Format(time.RFC3339), source, matrices}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	file, err := createAtomic(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return path, err
+}
+
+// meshColor is the heat map colour of a cell
+func meshColor(c MeshCell, ok bool) string {
+	switch {
+	case !ok:
+		return "#e0e0e0"
+	case c.Status == "PASS":
+		return "#8fd18f"
+	case c.Status == "PARTIAL":
+		return "#f5c96a"
+	case c.Status == "FAIL":
+		return "#ef7f7f"
+	}
+	return "#b8b8b8"
+}
+
+func writeMeshHTML(path string, matrices []*MeshMatrix) (string, error) {
+	file, err := createAtomic(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>MERALCO Ping Mesh</title>\n")
+	fmt.Fprintf(file, "<style>body{font-family:sans-serif;font-size:13px} table{border-collapse:collapse;margin-bottom:24px}"+
+		" td,th{border:1px solid #999;padding:4px 8px;text-align:center} th.src{text-align:left}</style></head><body>\n")
+	fmt.Fprintf(file, "<h1>MERALCO Ping Mesh</h1>\n<p>Generated %s. Green: passed, amber: partial, red: failed, grey: no data.</p>\n",
+		html.EscapeString(time.Now().Format("2006-01-02 15:04:05")))
+	for _, m := range matrices {
+		fmt.Fprintf(file, "<h2>VRF %s</h2>\n<table>\n<tr><th>source \\ target</th>", html.EscapeString(m.VRF))
+		for _, t := range m.Targets {
+			fmt.Fprintf(file, "<th title=\"%s\">%s</th>", html.EscapeString(t.Address), html.EscapeString(displayHost(t.Name)))
+		}
+		fmt.Fprintf(file, "</tr>\n")
+		for _, s := range m.Sources {
+			fmt.Fprintf(file, "<tr><th class=\"src\">%s</th>", html.EscapeString(displayHost(s)))
+			for _, t := range m.Targets {
+				c, ok := m.cell(s, t.Name)
+				title := c.Command
+				switch {
+				case c.Error != "":
+					title += ": " + c.Error
+				case ok:
+					title += fmt.Sprintf(": %d/%d, avg %g ms, max %g ms", c.Received, c.Sent, c.AvgMs, c.MaxMs)
+				}
+				text := ""
+				if ok && c.Status != "NO_DATA" {
+					text = fmt.Sprintf("%d%%", c.SuccessPct)
+				}
+				fmt.Fprintf(file, "<td style=\"background:%s\" title=\"%s\">%s</td>", meshColor(c, ok), html.EscapeString(title), text)
+			}
+			fmt.Fprintf(file, "</tr>\n")
+		}
+		fmt.Fprintf(file, "</table>\n")
+	}
+	fmt.Fprintf(file, "</body></html>\n")
+	return path, nil
+}
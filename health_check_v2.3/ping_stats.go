@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// PING RESULT PARSING & ERROR BUDGET SUMMARY
+// ============================================================================
+
+// PingResult is the parsed outcome of one Cisco ping command
+type PingResult struct {
+	Hostname   string
+	Command    string
+	VRF        string
+	Target     string
+	Sent       int
+	Received   int
+	SuccessPct int
+	MinMs      float64
+	AvgMs      float64
+	MaxMs      float64
+	Attempts   string // per-attempt marks as printed by the device, e.g. "!!.!!"
+	HasRTT     bool
+}
+
+// LossPct returns the packet loss percentage of the test
+func (p PingResult) LossPct() float64 {
+	if p.Sent == 0 {
+		return 100
+	}
+	return float64(p.Sent-p.Received) / float64(p.Sent) * 100
+}
+
+var (
+	pingSuccessRe  = regexp.MustCompile(`Success rate is (\d+) percent \((\d+)/(\d+)\)`)
+	pingRTTRe      = regexp.MustCompile(`min/avg/max = ([\d.]+)/([\d.]+)/([\d.]+)`)
+	pingAttemptsRe = regexp.MustCompile(`^[!.UQMA?&]+$`)
+	pingVRFRe      = regexp.MustCompile(`(?i)\bvrf\s+(\S+)`)
+)
+
+// isPingCommand matches "ping ..." lines from the command files
+func isPingCommand(command string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(command)), "ping ")
+}
+
+// parsePingOutput extracts success rate, RTT and per-attempt marks
+func parsePingOutput(command, output string) (PingResult, bool) {
+	p := PingResult{Command: command, VRF: "default"}
+	if m := pingVRFRe.FindStringSubmatch(command); m != nil {
+		p.VRF = m[1]
+	}
+	p.Target = pingTarget(command)
+
+	found := false
+	var attempts strings.Builder
+	for _, line := range strings.Split(output, "\n") {
+		t := strings.TrimSpace(line)
+		if m := pingSuccessRe.FindStringSubmatch(t); m != nil {
+			p.SuccessPct, _ = strconv.Atoi(m[1])
+			p.Received, _ = strconv.Atoi(m[2])
+			p.Sent, _ = strconv.Atoi(m[3])
+			found = true
+		}
+		if m := pingRTTRe.FindStringSubmatch(t); m != nil {
+			p.MinMs, _ = strconv.ParseFloat(m[1], 64)
+			p.AvgMs, _ = strconv.ParseFloat(m[2], 64)
+			p.MaxMs, _ = strconv.ParseFloat(m[3], 64)
+			p.HasRTT = true
+		}
+		if pingAttemptsRe.MatchString(t) {
+			attempts.WriteString(t)
+		}
+	}
+	p.Attempts = attempts.String()
+	return p, found
+}
+
+// pingTarget returns the first argument after "ping [vrf X]" that is not a keyword
+func pingTarget(command string) string {
+	fields := strings.Fields(command)
+	for i := 1; i < len(fields); i++ {
+		f := strings.ToLower(fields[i])
+		if f == "vrf" || f == "ipv4" || f == "ip" {
+			if f == "vrf" {
+				i++
+			}
+			continue
+		}
+		return fields[i]
+	}
+	return ""
+}
+
+func pingMetrics(p PingResult) map[string]string {
+	metrics := map[string]string{
+		"Ping_Success_Pct": strconv.Itoa(p.SuccessPct),
+		"Ping_Sent":        strconv.Itoa(p.Sent),
+		"Ping_Received":    strconv.Itoa(p.Received),
+	}
+	if p.Attempts != "" {
+		metrics["Ping_Attempts"] = p.Attempts
+	}
+	if p.HasRTT {
+		metrics["RTT_Min_ms"] = strconv.FormatFloat(p.MinMs, 'f', -1, 64)
+		metrics["RTT_Avg_ms"] = strconv.FormatFloat(p.AvgMs, 'f', -1, 64)
+		metrics["RTT_Max_ms"] = strconv.FormatFloat(p.MaxMs, 'f', -1, 64)
+	}
+	return metrics
+}
+
+// collectPingResults gathers every parsed ping test from a run
+func collectPingResults(results []*DeviceResult) []PingResult {
+	var pings []PingResult
+	for _, r := range results {
+		for _, e := range r.Results {
+			if !isPingCommand(e.Command) {
+				continue
+			}
+			if p, ok := parsePingOutput(e.Command, e.Output); ok {
+				p.Hostname = r.Device.Hostname
+				pings = append(pings, p)
+			}
+		}
+	}
+	return pings
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []float64, pct float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(pct/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// WritePingStats writes the per-VRF error budget: loss distribution, RTT
+// percentiles and the tests that met their success threshold
+func (w *OutputWriter) WritePingStats(pings []PingResult, thresholds *pingThresholds) error {
+	if len(pings) == 0 {
+		return nil
+	}
+	if thresholds == nil {
+		thresholds, _ = parsePingThresholds("")
+	}
+	filename := filepath.Join(w.dir, fmt.Sprintf("PING_STATS_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Ping Error Budget Summary\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, " Success thresholds: %s\n", thresholds.spec)
+	fmt.Fprintf(file, "================================================================================\n\n")
+
+	byVRF := make(map[string][]PingResult)
+	var vrfs []string
+	for _, p := range pings {
+		if _, ok := byVRF[p.VRF]; !ok {
+			vrfs = append(vrfs, p.VRF)
+		}
+		byVRF[p.VRF] = append(byVRF[p.VRF], p)
+	}
+	sort.Strings(vrfs)
+
+	fmt.Fprintf(file, "%-20s %5s %5s %6s %6s %6s %6s %9s %9s %9s %9s\n",
+		"VRF", "TESTS", "PASS", "0%", "1-20%", "21-99%", "100%", "RTT_P50", "RTT_P95", "RTT_P99", "RTT_MAX")
+	fmt.Fprintf(file, "--------------------------------------------------------------------------------\n")
+	for _, vrf := range vrfs {
+		var none, low, high, total, pass int
+		var rtts []float64
+		maxRTT := 0.0
+		for _, p := range byVRF[vrf] {
+			if thresholds.status(p) == "PASS" {
+				pass++
+			}
+			loss := p.LossPct()
+			switch {
+			case loss == 0:
+				none++
+			case loss <= 20:
+				low++
+			case loss < 100:
+				high++
+			default:
+				total++
+			}
+			if p.HasRTT {
+				rtts = append(rtts, p.AvgMs)
+				if p.MaxMs > maxRTT {
+					maxRTT = p.MaxMs
+				}
+			}
+		}
+		sort.Float64s(rtts)
+		fmt.Fprintf(file, "%-20s %5d %5d %6d %6d %6d %6d %9.1f %9.1f %9.1f %9.1f\n",
+			vrf, len(byVRF[vrf]), pass, none, low, high, total,
+			percentile(rtts, 50), percentile(rtts, 95), percentile(rtts, 99), maxRTT)
+	}
+
+	fmt.Fprintf(file, "\n--- Per-test results ---\n")
+	table := newTextTable("HOSTNAME", "VRF", "TARGET", "SUCCESS", "NEED", "STATUS", "ATTEMPTS", "RTT min/avg/max (ms)").alignRight(3, 4)
+	for _, p := range pings {
+		rtt := "-"
+		if p.HasRTT {
+			rtt = fmt.Sprintf("%g/%g/%g", p.MinMs, p.AvgMs, p.MaxMs)
+		}
+		table.add(hostSite(p.Hostname), displayHost(p.Hostname), p.VRF, p.Target,
+			fmt.Sprintf("%d%%", p.SuccessPct), fmt.Sprintf("%d%%", thresholds.threshold(p)), thresholds.status(p), p.Attempts, rtt)
+	}
+	table.write(file)
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// PING SUCCESS THRESHOLDS (-ping-thresholds)
+// ============================================================================
+//
+// A ping test passes when its success rate reaches the threshold of its VRF
+// or of the test itself; below it, it is PARTIAL while some replies came
+// back and FAIL when none did. Best-effort VRFs can tolerate loss that
+// teleprotection cannot:
+//
+//   -ping-thresholds "100,INTERNET=80,MGMT=90,TELEPROT/10.20.0.1=100"
+//
+// The bare number is the default (100 when omitted), VRF=PCT applies to every
+// test in the VRF and VRF/TARGET=PCT to one target. VRF names match without
+// regard to case; the global table is "default". The same thresholds judge
+// the per-test table of PING_STATS, /api/ping and the exporter. A
+// -thresholds file may add limits per critical VRF priority and per device
+// role, which apply below the target and VRF ones (see thresholds.go).
+
+// pingThresholds is a parsed -ping-thresholds spec
+type pingThresholds struct {
+	spec     string
+	def      int
+	byVRF    map[string]int
+	byTarget map[string]int // "VRF/TARGET"
+
+	// From -thresholds: critical VRF priority and device role limits
+	byPriority map[string]int
+	byRole     func(host string) (int, bool)
+}
+
+func parsePingPct(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(s), "%"))
+	if err != nil || n < 0 || n > 100 {
+		return 0, fmt.Errorf("%q: expected a success percentage 0-100", s)
+	}
+	return n, nil
+}
+
+// parsePingThresholds reads "[PCT][,VRF=PCT][,VRF/TARGET=PCT]..."
+func parsePingThresholds(spec string) (*pingThresholds, error) {
+	t := &pingThresholds{spec: spec, def: 100, byVRF: make(map[string]int), byTarget: make(map[string]int),
+		byPriority: make(map[string]int)}
+	if strings.TrimSpace(spec) == "" {
+		t.spec = "100"
+		return t, nil
+	}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		name, value, named := strings.Cut(item, "=")
+		if !named {
+			value = item
+		}
+		pct, err := parsePingPct(value)
+		if err != nil {
+			return nil, err
+		}
+		name = strings.ToUpper(strings.TrimSpace(name))
+		switch {
+		case !named:
+			t.def = pct
+		case name == "":
+			return nil, fmt.Errorf("%q: missing VRF name", item)
+		case strings.Contains(name, "/"):
+			t.byTarget[name] = pct
+		default:
+			t.byVRF[name] = pct
+		}
+	}
+	return t, nil
+}
+
+// threshold returns the success percentage a test needs to pass; nil-safe
+func (t *pingThresholds) threshold(p PingResult) int {
+	if t == nil {
+		return 100
+	}
+	vrf := strings.ToUpper(p.VRF)
+	if n, ok := t.byTarget[vrf+"/"+strings.ToUpper(p.Target)]; ok {
+		return n
+	}
+	if n, ok := t.byVRF[vrf]; ok {
+		return n
+	}
+	if n, ok := t.byPriority[vrf]; ok {
+		return n
+	}
+	if t.byRole != nil {
+		if n, ok := t.byRole(p.Hostname); ok {
+			return n
+		}
+	}
+	return t.def
+}
+
+// status judges a test: PASS, PARTIAL or FAIL
+func (t *pingThresholds) status(p PingResult) string {
+	switch {
+	case p.SuccessPct >= t.threshold(p):
+		return "PASS"
+	case p.Received > 0:
+		return "PARTIAL"
+	}
+	return "FAIL"
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// CONTINUOUS PING MONITOR (-ping-watch PE)
+// ============================================================================
+//
+// To prove how long each service was really down during the cutover,
+// -ping-watch PE pings the -ping-watch-targets (the "VRF NAME ADDRESS" list
+// of -ping-mesh-targets, typically the critical VRF endpoints) from that PE
+// once a second, until -ping-watch-for expires or Ctrl-C:
+//
+//   IOS-XR   ping vrf V A count 1 timeout 1
+//   IOS-XE   ping vrf V A repeat 1 timeout 1
+//
+// All targets go out in one batch per second over one persistent session.
+// A batch with lost probes takes up to a second per lost target, so the
+// samples carry the time they were taken and the outages are measured on
+// those times, not counted in probes. A batch the session could not run
+// (session lost, device not answering) is a gap, not a loss. Written to
+// <output>/ping_watch/:
+//
+//   PING_WATCH_<ts>.csv    every sample as taken (seq, UTC time in ms,
+//                          source, vrf, target, ok, rtt; see
+//                          sample_stamp.go), appended live so a crash keeps
+//                          the data
+//   PING_WATCH_<ts>.html   per target: loss, outages (longest, total) and a
+//                          timeline of the RTT with the lost seconds in red
+//
+// Loss starts and recoveries are logged as they happen.
+
+const pingWatchDirName = "ping_watch"
+
+// watchSample is one probe of one target
+type watchSample struct {
+	At    time.Time // start of the batch
+	OK    bool
+	RTTMs float64
+	Gap   bool // batch not run, nothing known
+	Stamp sampleStamp
+}
+
+// watchSeries is the timeline of one target
+type watchSeries struct {
+	Target  MeshTarget
+	Command string
+	Samples []watchSample
+	down    time.Time // start of the current outage
+}
+
+// watchOutage is a run of lost probes, until the first answered one
+type watchOutage struct {
+	From, To time.Time
+}
+
+func (o watchOutage) Duration() time.Duration {
+	return o.To.Sub(o.From)
+}
+
+// pingWatchCommand is the single-probe ping of a target
+func pingWatchCommand(deviceOS string, t MeshTarget) string {
+	if t.VRF == "default" {
+		return expandCommand(fmt.Sprintf("ping %s {count} 1 timeout 1", t.Address), deviceOS)
+	}
+	return expandCommand(fmt.Sprintf("ping vrf %s %s {count} 1 timeout 1", t.VRF, t.Address), deviceOS)
+}
+
+// outages returns the runs of lost probes; a gap ends a run at the last
+// lost probe, and a run still open at the end ends a second after it
+func (s *watchSeries) outages() []watchOutage {
+	var out []watchOutage
+	var cur *watchOutage
+	var last time.Time
+	for _, x := range s.Samples {
+		switch {
+		case x.Gap:
+			if cur != nil {
+				cur.To = last.Add(time.Second)
+				out, cur = append(out, *cur), nil
+			}
+		case !x.OK:
+			if cur == nil {
+				cur = &watchOutage{From: x.At}
+			}
+			last = x.At
+		case cur != nil:
+			cur.To = x.At
+			out, cur = append(out, *cur), nil
+		}
+	}
+	if cur != nil {
+		cur.To = last.Add(time.Second)
+		out = append(out, *cur)
+	}
+	return out
+}
+
+// counts returns probes sent and lost (gaps excluded)
+func (s *watchSeries) counts() (sent, lost int) {
+	for _, x := range s.Samples {
+		if x.Gap {
+			continue
+		}
+		sent++
+		if !x.OK {
+			lost++
+		}
+	}
+	return sent, lost
+}
+
+// downtime returns the longest and the total outage
+func (s *watchSeries) downtime(outages []watchOutage) (longest, total time.Duration) {
+	for _, o := range outages {
+		total += o.Duration()
+		if o.Duration() > longest {
+			longest = o.Duration()
+		}
+	}
+	return longest, total
+}
+
+func (s *watchSeries) name() string {
+	return s.Target.VRF + "/" + s.Target.Name
+}
+
+// runPingWatch pings the targets from the PE every second and writes the
+// timeline
+func runPingWatch(config *Config, pe DeviceInfo) error {
+	targets, err := loadMeshTargets(config.PingWatchFile)
+	if err != nil {
+		return err
+	}
+	if config.Pool == nil {
+		config.Pool = newSessionPool(config.Keepalive)
+		defer config.Pool.Close()
+	}
+
+	dir := filepath.Join(config.OutputDir, pingWatchDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	ts := time.Now().Format("20060102_150405")
+	csvPath := filepath.Join(dir, "PING_WATCH_"+ts+".csv")
+	csvFile, err := os.Create(csvPath)
+	if err != nil {
+		return err
+	}
+	defer csvFile.Close()
+	fmt.Fprintln(csvFile, "Seq,Time_UTC,Source,VRF,Target,Address,OK,RTT_ms")
+
+	series := make([]*watchSeries, len(targets))
+	commands := make([]string, len(targets))
+	for i, t := range targets {
+		commands[i] = pingWatchCommand(pe.DetectedOS, t)
+		series[i] = &watchSeries{Target: t, Command: commands[i]}
+	}
+
+	// One client for every sample: each batch attaches a new session, which
+	// drops the abort of a timed-out one, so the watch sees the PE answer again
+	client := newDeviceClient(pe, config)
+	config.Stop.stopIsNormal()
+	var deadline <-chan time.Time
+	if config.PingWatchFor > 0 {
+		deadline = time.After(config.PingWatchFor)
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	start := time.Now()
+	log.Printf("PING WATCH: %d targets from %s every second (Ctrl-C stops; samples: %s)", len(targets), pe.Hostname, csvPath)
+	sessionDown := false
+	for running := true; running; {
+		at := time.Now()
+		outputs, err := client.ExecuteCommands(commands)
+		if config.Stop.stopping() {
+			// The sample cut short by Ctrl-C is not a gap
+			log.Printf("Stopping the ping watch")
+			break
+		}
+		switch {
+		case err != nil && !sessionDown:
+			log.Printf("⚠ PING WATCH: %s: %v; samples recorded as gaps until it answers", pe.Hostname, err)
+			sessionDown = true
+		case err == nil && sessionDown:
+			log.Printf("PING WATCH: %s answers again", pe.Hostname)
+			sessionDown = false
+		}
+		for _, s := range series {
+			x := watchSample{At: at, Gap: err != nil, Stamp: newSampleStamp()}
+			if err == nil {
+				out := outputs[s.Command]
+				if p, ok := parsePingOutput(s.Command, out); ok && !isIncompleteOutput(out) {
+					x.OK, x.RTTMs = p.Received > 0, p.AvgMs
+				} else {
+					x.Gap = true
+				}
+			}
+			s.Samples = append(s.Samples, x)
+			if !x.Gap {
+				fmt.Fprintf(csvFile, "%d,%s,%s,%s,%s,%s,%v,%g\n", x.Stamp.Seq, x.Stamp.UTC(), x.Stamp.Source,
+					s.Target.VRF, s.Target.Name, s.Target.Address, x.OK, x.RTTMs)
+			}
+			switch {
+			case x.Gap:
+			case !x.OK && s.down.IsZero():
+				s.down = at
+				log.Printf("⚠ PING WATCH: %s (%s) lost at %s", s.name(), s.Target.Address, at.Format("15:04:05"))
+			case x.OK && !s.down.IsZero():
+				log.Printf("✓ PING WATCH: %s (%s) back after %s", s.name(), s.Target.Address, at.Sub(s.down).Round(time.Second))
+				s.down = time.Time{}
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			running = false
+		case <-config.Stop.Done():
+			log.Printf("Stopping the ping watch")
+			running = false
+		}
+	}
+
+	fmt.Printf("\nPing watch from %s, %s:\n\n", displayHost(pe.Hostname), time.Since(start).Round(time.Second))
+	table := newTextTable("TARGET", "ADDRESS", "SENT", "LOST", "LOSS", "OUTAGES", "LONGEST", "TOTAL DOWN").alignRight(2, 3, 4, 5)
+	for _, s := range series {
+		sent, lost := s.counts()
+		outages := s.outages()
+		longest, total := s.downtime(outages)
+		table.add("", s.name(), s.Target.Address, sent, lost, fmt.Sprintf("%.1f%%", pct(lost, sent)), len(outages),
+			longest.Round(time.Second), total.Round(time.Second))
+	}
+	table.write(os.Stdout)
+
+	htmlPath := filepath.Join(dir, "PING_WATCH_"+ts+".html")
+	if err := writePingWatchHTML(htmlPath, pe, series, start, time.Now()); err != nil {
+		return err
+	}
+	log.Printf("Ping watch timeline: %s", htmlPath)
+	return nil
+}
+
+// pct is part of whole in percent, 0 for an empty whole
+func pct(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole) * 100
+}
+
+// writePingWatchHTML writes the summary table and one SVG timeline per
+// target, all on the same time axis
+func writePingWatchHTML(path string, pe DeviceInfo, series []*watchSeries, start, end time.Time) error {
+	file, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	const width, height, left = 900.0, 90.0, 50.0
+	span := end.Sub(start).Seconds()
+	if span < 1 {
+		span = 1
+	}
+	x := func(t time.Time) float64 { return left + t.Sub(start).Seconds()/span*(width-left) }
+
+	fmt.Fprintf(file, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>MERALCO Ping Watch</title>\n")
+	fmt.Fprintf(file, "<style>body{font-family:sans-serif;font-size:13px} table{border-collapse:collapse;margin-bottom:24px}"+
+		" td,th{border:1px solid #999;padding:4px 8px} td.n{text-align:right} svg{background:#fafafa;border:1px solid #ccc}</style></head><body>\n")
+	fmt.Fprintf(file, "<h1>MERALCO Ping Watch from %s</h1>\n<p>%s to %s. Blue: RTT, red: lost, grey: no data.</p>\n",
+		html.EscapeString(displayHost(pe.Hostname)), start.Format("2006-01-02 15:04:05"), end.Format("15:04:05"))
+
+	fmt.Fprintf(file, "<table>\n<tr><th>Target</th><th>Address</th><th>Sent</th><th>Lost</th><th>Loss</th><th>Outages</th><th>Longest</th><th>Total down</th></tr>\n")
+	for _, s := range series {
+		sent, lost := s.counts()
+		outages := s.outages()
+		longest, total := s.downtime(outages)
+		var spans []string
+		for _, o := range outages {
+			spans = append(spans, fmt.Sprintf("%s-%s", o.From.Format("15:04:05"), o.To.Format("15:04:05")))
+		}
+		fmt.Fprintf(file, "<tr><td>%s</td><td>%s</td><td class=\"n\">%d</td><td class=\"n\">%d</td><td class=\"n\">%.1f%%</td>"+
+			"<td class=\"n\" title=\"%s\">%d</td><td class=\"n\">%s</td><td class=\"n\">%s</td></tr>\n",
+			html.EscapeString(s.name()), html.EscapeString(s.Target.Address), sent, lost, pct(lost, sent),
+			html.EscapeString(strings.Join(spans, ", ")), len(spans), longest.Round(time.Second), total.Round(time.Second))
+	}
+	fmt.Fprintf(file, "</table>\n")
+
+	for _, s := range series {
+		maxRTT := 1.0
+		for _, p := range s.Samples {
+			if p.OK && p.RTTMs > maxRTT {
+				maxRTT = p.RTTMs
+			}
+		}
+		fmt.Fprintf(file, "<h3>%s (%s)</h3>\n<svg width=\"%g\" height=\"%g\">\n", html.EscapeString(s.name()), html.EscapeString(s.Target.Address), width, height+16)
+		var points []string
+		for i, p := range s.Samples {
+			next := end
+			if i+1 < len(s.Samples) {
+				next = s.Samples[i+1].At
+			}
+			switch {
+			case p.Gap:
+				fmt.Fprintf(file, "<rect x=\"%.1f\" y=\"0\" width=\"%.1f\" height=\"%g\" fill=\"#ccc\"/>\n", x(p.At), x(next)-x(p.At), height)
+			case !p.OK:
+				fmt.Fprintf(file, "<rect x=\"%.1f\" y=\"0\" width=\"%.1f\" height=\"%g\" fill=\"#e55\"><title>lost %s</title></rect>\n",
+					x(p.At), x(next)-x(p.At), height, p.At.Format("15:04:05"))
+			default:
+				points = append(points, fmt.Sprintf("%.1f,%.1f", x(p.At), height-p.RTTMs/maxRTT*(height-4)))
+			}
+		}
+		if len(points) > 0 {
+			fmt.Fprintf(file, "<polyline fill=\"none\" stroke=\"#36c\" stroke-width=\"1\" points=\"%s\"/>\n", strings.Join(points, " "))
+		}
+		fmt.Fprintf(file, "<text x=\"2\" y=\"10\" font-size=\"10\">%g ms</text><text x=\"2\" y=\"%g\" font-size=\"10\">0</text>\n", maxRTT, height)
+		fmt.Fprintf(file, "<text x=\"%g\" y=\"%g\" font-size=\"10\">%s</text><text x=\"%g\" y=\"%g\" font-size=\"10\" text-anchor=\"end\">%s</text>\n",
+			left, height+13, start.Format("15:04:05"), width-2, height+13, end.Format("15:04:05"))
+		fmt.Fprintf(file, "</svg>\n")
+	}
+	fmt.Fprintf(file, "</body></html>\n")
+	return nil
+}
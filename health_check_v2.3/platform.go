@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// ============================================================================
+// PLATFORM DIFFERENCES (Linux, macOS, Windows)
+// ============================================================================
+//
+// One source, no build tags: the same code builds for engineers' Windows
+// laptops and the Linux jump hosts. The few places that depend on the OS
+// ask here:
+//
+//   - hook and -alert-cmd commands run through sh -c, or cmd /C on Windows
+//   - the SOCKS5 ProxyCommand quotes this binary's path for that shell
+//   - ssh, scp and the askpass prompts (ssh_auth.go) come from OpenSSH,
+//     which Windows 10 and later ship as an optional feature
+//   - paths are joined with filepath and the null device is os.DevNull
+//
+// Secret prompts turn the terminal echo off with stty; Windows has none, so
+// set HC_VAULT_PASSPHRASE there to avoid typing the vault passphrase in the
+// clear.
+
+const onWindows = runtime.GOOS == "windows"
+
+// shellCommand runs a command line through the platform shell
+func shellCommand(ctx context.Context, line string) *exec.Cmd {
+	if onWindows {
+		return exec.CommandContext(ctx, "cmd", "/C", line)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", line)
+}
+
+// shellQuote quotes one argument for the shell that runs an ssh
+// ProxyCommand
+func shellQuote(s string) string {
+	if onWindows {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// ROUTING PROTOCOL TABLE PARSERS (IOS-XR / IOS-XE)
+// ============================================================================
+//
+// Typed forms of the BGP summary, OSPF and IS-IS neighbor and LDP neighbor
+// tables. The table parsers locate columns from the header line instead of
+// counting lines that happen to contain an address, so banners, timestamps
+// and detail lines do not turn into neighbors. Interfaces and VRFs have
+// their own parsers in interface_parser.go and vrf_parser.go.
+//
+// -parse-check DIR runs extractMetrics over captured outputs, the same way
+// -clean-check validates the cleaning rules:
+//
+//   DIR/<OS>/<name>.raw      first line "<prompt>#<command>", then the output
+//   DIR/<OS>/<name>.metrics  expected Metric=Value lines
+
+var (
+	ipv4Re        = regexp.MustCompile(`^\d+\.\d+\.\d+\.\d+$`)
+	ipv6Re        = regexp.MustCompile(`^[0-9a-fA-F]{0,4}(:[0-9a-fA-F]{0,4}){2,}$`)
+	bgpRouterRe   = regexp.MustCompile(`(?i)BGP router identifier (\S+?),? local AS number (\S+)`)
+	ldpPeerRe     = regexp.MustCompile(`^\s*Peer LDP Ident(?:ifier)?:\s*(\S+?)[;,]?(\s|$)`)
+	ldpStateRe    = regexp.MustCompile(`^\s*State:\s*(\w+)`)
+	ldpUpTimeRe   = regexp.MustCompile(`(?i)Up ?time:\s*(\S+)`)
+	ldpBriefRowRe = regexp.MustCompile(`^(\d+\.\d+\.\d+\.\d+:\d+)\s+(.*)$`)
+)
+
+func isIPAddress(s string) bool {
+	return ipv4Re.MatchString(s) || (strings.Count(s, ":") >= 2 && ipv6Re.MatchString(s))
+}
+
+// ----------------------------------------------------------------------------
+// BGP summary
+// ----------------------------------------------------------------------------
+
+// BGPNeighbor is one row of a BGP summary table
+type BGPNeighbor struct {
+	Address  string
+	RemoteAS string // asplain or asdot, as printed
+	UpDown   string
+	State    string // Established, or Idle/Active/Connect/... (with "(Admin)" etc.)
+	PfxRcd   int    // -1 when the session is not established
+}
+
+// Established reports whether the session is up (the St/PfxRcd column is a count)
+func (n BGPNeighbor) Established() bool {
+	return n.PfxRcd >= 0
+}
+
+// BGPSummary is "show bgp [vrf X] [afi safi] summary" / "show ip bgp summary"
+type BGPSummary struct {
+	RouterID  string
+	LocalAS   string
+	Neighbors []BGPNeighbor
+}
+
+// EstablishedCount returns the number of established sessions
+func (s BGPSummary) EstablishedCount() int {
+	n := 0
+	for _, nb := range s.Neighbors {
+		if nb.Established() {
+			n++
+		}
+	}
+	return n
+}
+
+// parseBGPSummary reads both layouts:
+//
+//	XR: Neighbor  Spk  AS  MsgRcvd MsgSent TblVer InQ OutQ Up/Down  St/PfxRcd
+//	XE: Neighbor  V    AS  MsgRcvd MsgSent TblVer InQ OutQ Up/Down  State/PfxRcd
+//
+// IOS-XE wraps long (IPv6) neighbor addresses onto a line of their own.
+func parseBGPSummary(output string) BGPSummary {
+	var s BGPSummary
+	inTable := false
+	pending := ""
+	for _, line := range strings.Split(output, "\n") {
+		if m := bgpRouterRe.FindStringSubmatch(line); m != nil {
+			s.RouterID, s.LocalAS = m[1], m[2]
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == "Neighbor" && strings.Contains(line, "AS") {
+			inTable = true
+			continue
+		}
+		if !inTable || len(fields) == 0 {
+			continue
+		}
+		if len(fields) == 1 && isIPAddress(fields[0]) {
+			pending = fields[0]
+			continue
+		}
+		if pending != "" {
+			fields = append([]string{pending}, fields...)
+			pending = ""
+		}
+		if len(fields) < 9 || !isIPAddress(fields[0]) {
+			continue
+		}
+		nb := BGPNeighbor{Address: fields[0], RemoteAS: fields[2], PfxRcd: -1}
+		// State may be two words, e.g. "Idle (Admin)"; Up/Down precedes it
+		last := fields[len(fields)-1]
+		if n, err := strconv.Atoi(last); err == nil {
+			nb.PfxRcd, nb.State, nb.UpDown = n, "Established", fields[len(fields)-2]
+		} else {
+			stateAt := 9
+			if stateAt > len(fields)-1 {
+				stateAt = len(fields) - 1
+			}
+			nb.UpDown = fields[stateAt-1]
+			nb.State = strings.Join(fields[stateAt:], " ")
+		}
+		s.Neighbors = append(s.Neighbors, nb)
+	}
+	return s
+}
+
+// ----------------------------------------------------------------------------
+// OSPF neighbors
+// ----------------------------------------------------------------------------
+
+// OSPFNeighbor is one row of "show [ip] ospf neighbor"
+type OSPFNeighbor struct {
+	NeighborID string
+	Priority   int
+	State      string // FULL/DR, 2WAY/DROTHER, INIT/  -, ...
+	DeadTime   string
+	Address    string
+	Interface  string
+	UpTime     string // IOS-XR "Neighbor is up for ..."
+}
+
+// Full reports whether the adjacency is fully formed
+func (n OSPFNeighbor) Full() bool {
+	return strings.HasPrefix(strings.ToUpper(n.State), "FULL")
+}
+
+// OSPFNeighborTable is every neighbor of every OSPF process in the output
+type OSPFNeighborTable struct {
+	Neighbors []OSPFNeighbor
+}
+
+// FullCount returns the number of FULL adjacencies
+func (t OSPFNeighborTable) FullCount() int {
+	n := 0
+	for _, nb := range t.Neighbors {
+		if nb.Full() {
+			n++
+		}
+	}
+	return n
+}
+
+// parseOSPFNeighbors reads the table shared by XR and XE:
+//
+//	Neighbor ID     Pri   State           Dead Time   Address         Interface
+//	10.0.0.2        1     FULL/DR         00:00:35    10.1.1.2        Gi0/0/0/0
+//	    Neighbor is up for 1d02h                                         (XR only)
+//
+// The state may carry a space ("INIT/  -") so columns are taken from the ends.
+func parseOSPFNeighbors(output string) OSPFNeighborTable {
+	var t OSPFNeighborTable
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "Neighbor is up for") && len(t.Neighbors) > 0 {
+			t.Neighbors[len(t.Neighbors)-1].UpTime = strings.TrimSpace(strings.TrimPrefix(trimmed, "Neighbor is up for"))
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 6 || !ipv4Re.MatchString(fields[0]) {
+			continue
+		}
+		pri, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		n := len(fields)
+		t.Neighbors = append(t.Neighbors, OSPFNeighbor{
+			NeighborID: fields[0],
+			Priority:   pri,
+			State:      strings.Join(fields[2:n-3], " "),
+			DeadTime:   fields[n-3],
+			Address:    fields[n-2],
+			Interface:  fields[n-1],
+		})
+	}
+	return t
+}
+
+// ----------------------------------------------------------------------------
+// IS-IS neighbors
+// ----------------------------------------------------------------------------
+
+// ISISNeighbor is one row of "show isis neighbors" / "show isis adjacency"
+type ISISNeighbor struct {
+	Tag       string // IS-IS instance
+	SystemID  string
+	Interface string
+	Level     string // L1, L2, L1L2
+	State     string // Up, Init, Down
+}
+
+// Up reports whether the adjacency is up
+func (n ISISNeighbor) Up() bool {
+	return strings.EqualFold(n.State, "up")
+}
+
+// ISISNeighborTable is every adjacency of every IS-IS instance in the
+// output; Running is set when the output shows IS-IS at all (a header or
+// an adjacency), so an empty table still tells "running, no neighbors"
+// apart from "not running"
+type ISISNeighborTable struct {
+	Neighbors []ISISNeighbor
+	Running   bool
+}
+
+// UpCount returns the number of adjacencies in state Up at level "1" or
+// "2" ("" = any); an L1L2 adjacency counts at both levels
+func (t ISISNeighborTable) UpCount(level string) int {
+	n := 0
+	for _, nb := range t.Neighbors {
+		if nb.Up() && (level == "" || strings.Contains(nb.Level, level)) {
+			n++
+		}
+	}
+	return n
+}
+
+var (
+	isisTagRe   = regexp.MustCompile(`^(?:IS-IS (\S+)(?: Level-(\d))?.*(?:neighbors|adjacencies):|Tag (\S+):)`)
+	isisLevelRe = regexp.MustCompile(`^L(?:1|2|1L2)$`)
+)
+
+// parseISISNeighbors reads the XR and XE tables:
+//
+//	IS-IS CORE neighbors:                                          (XR)
+//	System Id      Interface        SNPA           State Holdtime Type IETF-NSF
+//	PE2            Te0/0/0/0        *PtoP*         Up    27       L2   Capable
+//
+//	Tag CORE:                                                      (XE)
+//	System Id       Type Interface     IP Address      State Holdtime Circuit Id
+//	PE1             L2   Gi0/0/0       10.0.0.1        UP    27       00
+//
+// The columns differ, so the interface, level and state are recognized by
+// their values. "show isis adjacency" has no level column; the level comes
+// from the "IS-IS 1 Level-2 adjacencies:" header. Indented detail lines are
+// skipped.
+func parseISISNeighbors(output string) ISISNeighborTable {
+	var t ISISNeighborTable
+	tag, level := "", ""
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if m := isisTagRe.FindStringSubmatch(line); m != nil {
+			t.Running = true
+			tag, level = m[1]+m[3], ""
+			if m[2] != "" {
+				level = "L" + m[2]
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "System Id") {
+			t.Running = true
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 || strings.HasPrefix(line, " ") {
+			continue
+		}
+		nb := ISISNeighbor{Tag: tag, SystemID: fields[0], Level: level}
+		for _, f := range fields[1:] {
+			switch {
+			case isisLevelRe.MatchString(f):
+				nb.Level = f
+			case nb.Interface == "" && isInterfaceName(f):
+				nb.Interface = f
+			case nb.State == "" && (strings.EqualFold(f, "up") || strings.EqualFold(f, "init") || strings.EqualFold(f, "down")):
+				nb.State = f
+			}
+		}
+		if nb.Interface == "" || nb.State == "" {
+			continue
+		}
+		t.Running = true
+		t.Neighbors = append(t.Neighbors, nb)
+	}
+	return t
+}
+
+// ----------------------------------------------------------------------------
+// LDP neighbors
+// ----------------------------------------------------------------------------
+
+// LDPNeighbor is one LDP session
+type LDPNeighbor struct {
+	LDPID  string // peer LDP identifier, a.b.c.d:0
+	State  string // Oper, ... ("" in the brief table, which lists only sessions)
+	UpTime string
+}
+
+// LDPNeighborTable is "show mpls ldp neighbor [brief]"
+type LDPNeighborTable struct {
+	Neighbors []LDPNeighbor
+}
+
+// parseLDPNeighbors reads the detail blocks of XR and XE
+//
+//	Peer LDP Identifier: 10.0.0.2:0        (XR)
+//	Peer LDP Ident: 10.0.0.2:0; Local ...  (XE)
+//	  State: Oper; Msgs sent/rcvd: ...
+//	  Up time: 1d02h
+//
+// and the XR brief table (Peer  GR  NSR  Up Time  Discovery  Addresses ...).
+func parseLDPNeighbors(output string) LDPNeighborTable {
+	var t LDPNeighborTable
+	var cur *LDPNeighbor
+	for _, line := range strings.Split(output, "\n") {
+		if m := ldpPeerRe.FindStringSubmatch(line); m != nil {
+			t.Neighbors = append(t.Neighbors, LDPNeighbor{LDPID: m[1]})
+			cur = &t.Neighbors[len(t.Neighbors)-1]
+			continue
+		}
+		if cur != nil {
+			if m := ldpStateRe.FindStringSubmatch(line); m != nil {
+				cur.State = m[1]
+			}
+			if m := ldpUpTimeRe.FindStringSubmatch(line); m != nil {
+				cur.UpTime = m[1]
+			}
+			continue
+		}
+		if m := ldpBriefRowRe.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			nb := LDPNeighbor{LDPID: m[1]}
+			// Up Time is the first column that looks like a duration
+			for _, f := range strings.Fields(m[2]) {
+				if strings.ContainsAny(f, ":dhwmy") && f != "-" {
+					nb.UpTime = f
+					break
+				}
+			}
+			t.Neighbors = append(t.Neighbors, nb)
+		}
+	}
+	return t
+}
+
+// OperCount returns the sessions in Oper state (brief rows count as up)
+func (t LDPNeighborTable) OperCount() int {
+	n := 0
+	for _, nb := range t.Neighbors {
+		if nb.State == "" || strings.EqualFold(nb.State, "Oper") {
+			n++
+		}
+	}
+	return n
+}
+
+// ----------------------------------------------------------------------------
+// Route summary
+// ----------------------------------------------------------------------------
+
+var (
+	routeVRFXRRe = regexp.MustCompile(`^\s*VRF: (\S+)`)
+	routeVRFXERe = regexp.MustCompile(`^\s*IP routing table name is (\S+)`)
+)
+
+// parseRouteSummary returns the route total per VRF of "show route [vrf all]
+// summary" (XR: Routes column) or "show ip route [vrf *] summary" (XE:
+// Networks + Subnets). Output without VRF headers is the default table.
+func parseRouteSummary(output string) map[string]int {
+	totals := make(map[string]int)
+	vrf := "default"
+	xe := false
+	for _, line := range strings.Split(output, "\n") {
+		if m := routeVRFXRRe.FindStringSubmatch(line); m != nil {
+			vrf = m[1]
+			continue
+		}
+		if m := routeVRFXERe.FindStringSubmatch(line); m != nil {
+			vrf = m[1]
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "Route" && fields[1] == "Source" {
+			xe = strings.Contains(line, "Networks")
+			continue
+		}
+		if len(fields) < 3 || fields[0] != "Total" {
+			continue
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		if xe {
+			subnets, _ := strconv.Atoi(fields[2])
+			n += subnets
+		}
+		totals[vrf] = n
+	}
+	return totals
+}
+
+// ----------------------------------------------------------------------------
+// MPLS forwarding
+// ----------------------------------------------------------------------------
+
+var mplsLabelTotalRe = regexp.MustCompile(`(?i)^\s*(?:Label switching|Total number of (?:labels|prefixes))\s*:\s*(\d+)`)
+
+// parseMPLSLabels returns the number of label switching entries of "show mpls
+// forwarding summary" (XR) or "show mpls forwarding-table summary" (XE). A full
+// forwarding table is counted by its distinct local labels; -1 = not found.
+func parseMPLSLabels(output string) int {
+	labels := make(map[string]bool)
+	inTable := false
+	for _, line := range strings.Split(output, "\n") {
+		if m := mplsLabelTotalRe.FindStringSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			return n
+		}
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "Local" && strings.Contains(line, "Outgoing") {
+			inTable = true
+			continue
+		}
+		// Further paths of a label are indented under it
+		if inTable && len(fields) > 0 && !strings.HasPrefix(line, " ") {
+			if _, err := strconv.Atoi(fields[0]); err == nil {
+				labels[fields[0]] = true
+			}
+		}
+	}
+	if !inTable {
+		return -1
+	}
+	return len(labels)
+}
+
+// ----------------------------------------------------------------------------
+// Fixture check (-parse-check)
+// ----------------------------------------------------------------------------
+
+// runParserCheck compares extractMetrics against every <OS>/*.raw fixture
+func runParserCheck(dir string) error {
+	raws, _ := filepath.Glob(filepath.Join(dir, "*", "*.raw"))
+	sort.Strings(raws)
+	if len(raws) == 0 {
+		return fmt.Errorf("no <OS>/*.raw fixtures under %s", dir)
+	}
+
+	log.Printf("Checking parsers against %d fixtures", len(raws))
+	failed := 0
+	for _, raw := range raws {
+		osType := filepath.Base(filepath.Dir(raw))
+		name := strings.TrimSuffix(raw, ".raw")
+		if _, err := os.Stat(name + ".metrics"); err != nil {
+			log.Printf("✗ %s: missing expected %s", raw, filepath.Base(name)+".metrics")
+			failed++
+			continue
+		}
+		command, mismatches, err := checkParserFixture(raw)
+		if err != nil {
+			return err
+		}
+		if len(mismatches) == 0 {
+			log.Printf("✓ %s/%s (%s)", osType, filepath.Base(name), command)
+			continue
+		}
+		failed++
+		log.Printf("✗ %s/%s (%s):\n    %s", osType, filepath.Base(name), command, strings.Join(mismatches, "\n    "))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d fixtures failed", failed, len(raws))
+	}
+	log.Printf("✓ All %d fixtures parse as expected", len(raws))
+	return nil
+}
+
+// checkParserFixture runs extractMetrics over one .raw fixture and returns
+// its command and the sorted differences from the .metrics file next to it
+func checkParserFixture(raw string) (string, []string, error) {
+	data, err := os.ReadFile(raw)
+	if err != nil {
+		return "", nil, err
+	}
+	want, err := os.ReadFile(strings.TrimSuffix(raw, ".raw") + ".metrics")
+	if err != nil {
+		return "", nil, err
+	}
+
+	first, output, _ := strings.Cut(strings.ReplaceAll(string(data), "\r", ""), "\n")
+	command := strings.TrimSpace(first[strings.LastIndexAny(first, "#>")+1:])
+	metrics := extractMetrics(command, output)
+
+	var mismatches []string
+	expected := make(map[string]bool)
+	for _, line := range strings.Split(string(want), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		expected[key] = true
+		if got, present := metrics[key]; !present {
+			mismatches = append(mismatches, fmt.Sprintf("%s: expected %q, missing", key, value))
+		} else if got != value {
+			mismatches = append(mismatches, fmt.Sprintf("%s: expected %q, got %q", key, value, got))
+		}
+	}
+	for key, value := range metrics {
+		if !expected[key] {
+			mismatches = append(mismatches, fmt.Sprintf("%s: unexpected %q", key, value))
+		}
+	}
+	sort.Strings(mismatches)
+	return command, mismatches, nil
+}
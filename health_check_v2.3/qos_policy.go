@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// QOS POLICY BASELINE (QOS_<ts>.csv) AND PRE/POST QOS CHECK
+// ============================================================================
+//
+// After a migration the service policies have to classify and shape the same
+// way they did before. Every run writes QOS_<ts>.csv with one row per
+// interface, direction and class:
+//
+//   IOS-XR  show policy-map interface all   matched / transmitted / dropped
+//                                           bytes and rates per class
+//   IOS-XE  show policy-map interface       offered and output bytes, the
+//                                           30 second offered and drop rates
+//
+// plus the shape and police settings of the class, from the policy-map
+// sections of "show running-config". comparePhases checks them class by
+// class:
+//
+//   FAIL  class (or the whole service policy) gone from the interface
+//   FAIL  another policy attached in that direction
+//   FAIL  shape or police settings of the class changed
+//   WARN  class carried traffic before and matches none after, while the
+//         interface still carries traffic (classification changed)
+//   WARN  class drops more than 1% of its offered rate, and 1 point more
+//         than before
+//   WARN  class new on the interface
+//
+// Byte counters run from the last clear (or reload) and are only recorded;
+// the rates are compared. -qos-interfaces limits the check to the critical
+// interfaces, as NAME or HOST:NAME (abbreviations like Te0/0/0/1 match);
+// without it every interface with a service policy is checked. Hosts
+// without QoS data in the post run (not collected) are skipped.
+
+const (
+	qosCommand        = "show policy-map interface"
+	qosBaselinePrefix = "QOS_"
+	qosBaselineCols   = "Hostname,Interface,Direction,Policy,Class,OfferedBytes,TransmittedBytes,DroppedBytes,OfferedBps,DropBps,Settings"
+	qosDropPctWarn    = 1.0
+)
+
+var (
+	xrQoSPolicyRe    = regexp.MustCompile(`^(\S+) (input|output): (\S+)`)
+	xrQoSClassRe     = regexp.MustCompile(`^\s*Class (\S+)`)
+	xrQoSCounterRe   = regexp.MustCompile(`^\s*(Matched|Transmitted|Total Dropped)\s*:\s*(\d+)/(\d+)\s+(\d+)`)
+	xeQoSInterfaceRe = regexp.MustCompile(`^ ?([A-Za-z][\w\-/.:]*\d)\s*$`)
+	xeQoSPolicyRe    = regexp.MustCompile(`^\s*Service-policy\s*(input|output)?\s*: (\S+)`)
+	xeQoSClassRe     = regexp.MustCompile(`^\s*Class-map: (\S+)`)
+	xeQoSOfferedRe   = regexp.MustCompile(`^\s*\d+ packets, (\d+) bytes`)
+	xeQoSRateRe      = regexp.MustCompile(`offered rate (\d+) bps, drop rate (\d+) bps`)
+	xeQoSOutputRe    = regexp.MustCompile(`\(pkts output/bytes output\) \d+/(\d+)`)
+)
+
+// QoSClass is the counters of one class of a service policy on an interface
+type QoSClass struct {
+	Interface   string
+	Direction   string // input, output
+	Policy      string
+	Class       string
+	Offered     int64 // bytes
+	Transmitted int64
+	Dropped     int64
+	OfferedBps  int64
+	DropBps     int64
+	Settings    string // shape/police lines of the class, "; " separated
+}
+
+// qosKey identifies a class across runs
+type qosKey struct {
+	Host, Interface, Direction, Class string
+}
+
+// parsePolicyMapInterface reads "show policy-map interface [all]"
+func parsePolicyMapInterface(output string) []QoSClass {
+	var classes []QoSClass
+	var cur *QoSClass
+	iface, direction, policy := "", "", ""
+	newClass := func(name string) {
+		classes = append(classes, QoSClass{Interface: iface, Direction: direction, Policy: policy, Class: name})
+		cur = &classes[len(classes)-1]
+	}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r ")
+		// IOS-XR
+		if m := xrQoSPolicyRe.FindStringSubmatch(line); m != nil {
+			iface, direction, policy, cur = m[1], m[2], m[3], nil
+			continue
+		}
+		if m := xrQoSClassRe.FindStringSubmatch(line); m != nil && iface != "" {
+			newClass(m[1])
+			continue
+		}
+		if m := xrQoSCounterRe.FindStringSubmatch(line); m != nil && cur != nil {
+			bytes, _ := strconv.ParseInt(m[3], 10, 64)
+			kbps, _ := strconv.ParseInt(m[4], 10, 64)
+			switch m[1] {
+			case "Matched":
+				cur.Offered, cur.OfferedBps = bytes, kbps*1000
+			case "Transmitted":
+				cur.Transmitted = bytes
+			case "Total Dropped":
+				cur.Dropped, cur.DropBps = bytes, kbps*1000
+			}
+			continue
+		}
+		// IOS-XE
+		if m := xeQoSInterfaceRe.FindStringSubmatch(line); m != nil {
+			iface, direction, policy, cur = m[1], "", "", nil
+			continue
+		}
+		if m := xeQoSPolicyRe.FindStringSubmatch(line); m != nil && iface != "" {
+			if m[1] != "" {
+				direction = m[1]
+			}
+			policy, cur = m[2], nil
+			continue
+		}
+		if m := xeQoSClassRe.FindStringSubmatch(line); m != nil && policy != "" {
+			newClass(m[1])
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		if m := xeQoSOfferedRe.FindStringSubmatch(line); m != nil && cur.Offered == 0 {
+			cur.Offered, _ = strconv.ParseInt(m[1], 10, 64)
+		}
+		if m := xeQoSRateRe.FindStringSubmatch(line); m != nil {
+			cur.OfferedBps, _ = strconv.ParseInt(m[1], 10, 64)
+			cur.DropBps, _ = strconv.ParseInt(m[2], 10, 64)
+		}
+		if m := xeQoSOutputRe.FindStringSubmatch(line); m != nil {
+			cur.Transmitted, _ = strconv.ParseInt(m[1], 10, 64)
+			if cur.Offered > cur.Transmitted {
+				cur.Dropped = cur.Offered - cur.Transmitted
+			}
+		}
+	}
+	return classes
+}
+
+// parsePolicyMapSettings reads the shape and police lines of each policy
+// class from the running config, keyed by "POLICY CLASS"
+func parsePolicyMapSettings(config string) map[string]string {
+	settings := make(map[string]string)
+	policy, class := "", ""
+	for _, line := range strings.Split(config, "\n") {
+		line = strings.TrimRight(line, "\r ")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "policy-map "):
+			policy, class = strings.Fields(line)[1], ""
+		case line == "" || (line[0] != ' ' && trimmed != "!"):
+			policy, class = "", ""
+		case policy != "" && strings.HasPrefix(trimmed, "class ") && !strings.HasPrefix(trimmed, "class-map"):
+			class = strings.TrimSpace(strings.TrimPrefix(trimmed, "class "))
+			class = strings.TrimPrefix(class, "type qos ")
+		case class != "" && (strings.HasPrefix(trimmed, "shape ") || strings.HasPrefix(trimmed, "police ")):
+			key := policy + " " + class
+			if settings[key] != "" {
+				settings[key] += "; "
+			}
+			settings[key] += trimmed
+		}
+	}
+	return settings
+}
+
+// collectQoS parses the policy-map outputs of a device and adds the class
+// settings from its running config
+func collectQoS(results []ExecutionResult) []QoSClass {
+	var classes []QoSClass
+	settings := make(map[string]string)
+	for _, e := range results {
+		cmd := strings.ToLower(e.Command)
+		if isCommandRejected(e.Output) {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(cmd, "show policy-map interface"):
+			classes = append(classes, parsePolicyMapInterface(e.Output)...)
+		case strings.HasPrefix(cmd, "show running-config"):
+			for k, v := range parsePolicyMapSettings(e.Output) {
+				settings[k] = v
+			}
+		}
+	}
+	for i := range classes {
+		classes[i].Settings = settings[classes[i].Policy+" "+classes[i].Class]
+	}
+	return classes
+}
+
+// WriteQoS writes QOS_<ts>.csv, the per-class baseline
+func (w *OutputWriter) WriteQoS(results []*DeviceResult) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("%s%s.csv", qosBaselinePrefix, w.timestamp))
+	rows := [][]string{strings.Split(qosBaselineCols, ",")}
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		for _, c := range collectQoS(r.Results) {
+			rows = append(rows, []string{r.Device.Hostname, c.Interface, c.Direction, c.Policy, c.Class,
+				strconv.FormatInt(c.Offered, 10), strconv.FormatInt(c.Transmitted, 10), strconv.FormatInt(c.Dropped, 10),
+				strconv.FormatInt(c.OfferedBps, 10), strconv.FormatInt(c.DropBps, 10), c.Settings})
+		}
+	}
+	return writeCSVRows(filename, rows)
+}
+
+// loadQoSBaseline reads the QOS csv of a run; nil when the run has none
+// (older runs)
+func loadQoSBaseline(dir string) (map[qosKey]QoSClass, error) {
+	rows, _, err := latestRunCSV(dir, qosBaselinePrefix, 11)
+	if rows == nil || err != nil {
+		return nil, err
+	}
+
+	classes := make(map[qosKey]QoSClass)
+	for _, rec := range rows {
+		classes[qosKey{rec[0], rec[1], rec[2], rec[4]}] = QoSClass{
+			Interface:   rec[1],
+			Direction:   rec[2],
+			Policy:      rec[3],
+			Class:       rec[4],
+			Offered:     atoi64(rec[5]),
+			Transmitted: atoi64(rec[6]),
+			Dropped:     atoi64(rec[7]),
+			OfferedBps:  atoi64(rec[8]),
+			DropBps:     atoi64(rec[9]),
+			Settings:    rec[10],
+		}
+	}
+	return classes, nil
+}
+
+// qosInterfaceMatch reports whether an interface name matches a
+// -qos-interfaces entry, allowing the usual abbreviations
+func qosInterfaceMatch(pattern, name string) bool {
+	if strings.EqualFold(pattern, name) {
+		return true
+	}
+	pi := strings.IndexAny(pattern, "0123456789")
+	ni := strings.IndexAny(name, "0123456789")
+	if pi <= 0 || ni <= 0 || pattern[pi:] != name[ni:] {
+		return false
+	}
+	return strings.HasPrefix(strings.ToLower(name[:ni]), strings.ToLower(pattern[:pi]))
+}
+
+// qosSelected reports whether a class is on one of the critical interfaces
+func qosSelected(k qosKey, interfaces []string) bool {
+	if len(interfaces) == 0 {
+		return true
+	}
+	for _, spec := range interfaces {
+		host, iface, ok := strings.Cut(spec, ":")
+		if !ok {
+			iface, host = host, ""
+		}
+		if (host == "" || strings.EqualFold(host, k.Host)) && qosInterfaceMatch(iface, k.Interface) {
+			return true
+		}
+	}
+	return false
+}
+
+func qosDropPct(c QoSClass) float64 {
+	if c.OfferedBps == 0 {
+		return 0
+	}
+	return float64(c.DropBps) * 100 / float64(c.OfferedBps)
+}
+
+// compareQoS returns the class findings between two runs
+func compareQoS(pre, post map[qosKey]QoSClass, interfaces []string) []PhaseDelta {
+	collected := make(map[string]bool)
+	ifaceBps := make(map[qosKey]int64) // post traffic per interface and direction
+	for k, c := range post {
+		collected[k.Host] = true
+		ifaceBps[qosKey{k.Host, k.Interface, k.Direction, ""}] += c.OfferedBps
+	}
+	keys := make(map[qosKey]bool)
+	for k := range pre {
+		if collected[k.Host] && qosSelected(k, interfaces) {
+			keys[k] = true
+		}
+	}
+	for k := range post {
+		if qosSelected(k, interfaces) {
+			keys[k] = true
+		}
+	}
+	var sorted []qosKey
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Interface != b.Interface {
+			return a.Interface < b.Interface
+		}
+		if a.Direction != b.Direction {
+			return a.Direction < b.Direction
+		}
+		return a.Class < b.Class
+	})
+
+	// Interfaces with a service policy before; classes new on other
+	// interfaces are not judged
+	hadPolicy := make(map[qosKey]bool)
+	for k := range pre {
+		hadPolicy[qosKey{k.Host, k.Interface, k.Direction, ""}] = true
+	}
+
+	var deltas []PhaseDelta
+	add := func(k qosKey, what, pre, post, status, reason string) {
+		deltas = append(deltas, PhaseDelta{
+			goldenKey: goldenKey{Host: k.Host, Command: qosCommand, Metric: fmt.Sprintf("%s %s %s %s", k.Interface, k.Direction, k.Class, what)},
+			Pre:       pre, Post: post, Status: status, Reason: reason,
+		})
+	}
+	for _, k := range sorted {
+		before, inPre := pre[k]
+		after, inPost := post[k]
+		switch {
+		case !inPost:
+			add(k, "policy", before.Policy, "", "FAIL", "class no longer on the interface (service policy removed or changed)")
+			continue
+		case !inPre:
+			if hadPolicy[qosKey{k.Host, k.Interface, k.Direction, ""}] {
+				add(k, "policy", "", after.Policy, "WARN", "class new on the interface")
+			}
+			continue
+		}
+		if before.Policy != after.Policy {
+			add(k, "policy", before.Policy, after.Policy, "FAIL", "another service policy is attached")
+		}
+		if before.Settings != after.Settings {
+			add(k, "shape/police", before.Settings, after.Settings, "FAIL", "shape or police settings changed")
+		}
+		if before.OfferedBps > 0 && after.OfferedBps == 0 && ifaceBps[qosKey{k.Host, k.Interface, k.Direction, ""}] > 0 {
+			add(k, "offered bps", strconv.FormatInt(before.OfferedBps, 10), "0", "WARN",
+				"class carried traffic before and matches none after: classification changed?")
+		}
+		if p, q := qosDropPct(before), qosDropPct(after); q > qosDropPctWarn && q > p+1 {
+			add(k, "drop %", fmt.Sprintf("%.1f", p), fmt.Sprintf("%.1f", q), "WARN",
+				fmt.Sprintf("class drops %.1f%% of its offered rate (%d of %d bps)", q, after.DropBps, after.OfferedBps))
+		}
+	}
+	return deltas
+}
+
+// compareQoSRuns loads and compares the QoS baselines of two runs; nothing
+// is compared when either run has none
+func compareQoSRuns(preDir, postDir string, interfaces []string) []PhaseDelta {
+	pre, err1 := loadQoSBaseline(preDir)
+	post, err2 := loadQoSBaseline(postDir)
+	if runCheckSkipped("QoS", qosBaselinePrefix, err1, err2, pre != nil, post != nil) {
+		return nil
+	}
+	return compareQoS(pre, post, interfaces)
+}
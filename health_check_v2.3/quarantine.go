@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// PARSER-MISS QUARANTINE
+// ============================================================================
+//
+// A parsed command whose parser extracted nothing, or only zero counts while
+// the output clearly holds data rows, is most likely an output format the
+// parser does not know (new software train, different platform). Instead of
+// letting the zero flow silently into the summary, the raw output is stored
+// under <run>/quarantine with its metadata and a WARN is logged, so parsing
+// gaps surface during lab rehearsals.
+
+// dataRowRe matches a line that starts like a table row: an IPv4/IPv6 address or an interface name
+var dataRowRe = regexp.MustCompile(`^(\d+\.\d+\.\d+\.\d+|[0-9a-fA-F]{1,4}(:[0-9a-fA-F]{0,4}){3,}|(Gi|Te|Tw|Fo|Hu|Fa|Et|BE|Bundle|Po|Lo|Vl|Tu|Mg|PW)[A-Za-z-]*\d)`)
+
+// ParserMiss is one quarantined command output
+type ParserMiss struct {
+	Device   DeviceInfo
+	Command  string
+	Category string
+	Reason   string
+	Output   string
+}
+
+// unparsedOutput reports why output looks like a parser miss ("" = fine)
+func unparsedOutput(command, output string, metrics map[string]string) string {
+	category := metricCategory(command)
+	t := strings.TrimSpace(output)
+	if category == "" || category == "netconf" || category == "snmp" || t == "" || t == "(no output)" ||
+		isCommandRejected(t) || strings.HasPrefix(t, "ERROR:") || strings.HasPrefix(t, "(not run") {
+		return ""
+	}
+
+	if _, fallback := metrics["Captured"]; fallback {
+		return fmt.Sprintf("%s parser extracted no fields", category)
+	}
+	if category == "version" {
+		if _, ok := metrics["Version"]; !ok {
+			return "no software version line recognised"
+		}
+		return ""
+	}
+
+	for _, v := range metrics {
+		if v != "0" {
+			return ""
+		}
+	}
+	rows := 0
+	for _, line := range strings.Split(output, "\n") {
+		if dataRowRe.MatchString(strings.TrimSpace(line)) {
+			rows++
+		}
+	}
+	if rows > 0 {
+		return fmt.Sprintf("all %s counts are zero but %d data rows are present", category, rows)
+	}
+	return ""
+}
+
+// findParserMisses checks every command output of a run
+func findParserMisses(results []*DeviceResult) []ParserMiss {
+	var misses []ParserMiss
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		for _, e := range r.Results {
+			if reason := unparsedOutput(e.Command, e.Output, extractMetrics(e.Command, e.Output)); reason != "" {
+				misses = append(misses, ParserMiss{
+					Device: r.Device, Command: e.Command, Category: metricCategory(e.Command),
+					Reason: reason, Output: e.Output,
+				})
+			}
+		}
+	}
+	return misses
+}
+
+// WriteQuarantine stores each miss as <run>/quarantine/<host>__<command>.txt
+func (w *OutputWriter) WriteQuarantine(misses []ParserMiss) error {
+	if len(misses) == 0 {
+		return nil
+	}
+	dir := filepath.Join(w.dir, "quarantine")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	slug := regexp.MustCompile(`[^A-Za-z0-9]+`)
+	for _, m := range misses {
+		name := fmt.Sprintf("%s__%s.txt", m.Device.Hostname, strings.Trim(slug.ReplaceAllString(m.Command, "_"), "_"))
+		file, err := createAtomic(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(file, "================================================================================\n")
+		fmt.Fprintf(file, " MERALCO Parser Quarantine\n")
+		fmt.Fprintf(file, "================================================================================\n")
+		fmt.Fprintf(file, " Hostname:     %s\n", m.Device.Hostname)
+		fmt.Fprintf(file, " IP Address:   %s\n", m.Device.IPAddress)
+		fmt.Fprintf(file, " Device Type:  %s\n", m.Device.DeviceType)
+		fmt.Fprintf(file, " Detected OS:  %s\n", m.Device.DetectedOS)
+		fmt.Fprintf(file, " Command:      %s\n", m.Command)
+		fmt.Fprintf(file, " Parser:       %s\n", m.Category)
+		fmt.Fprintf(file, " Reason:       %s\n", m.Reason)
+		fmt.Fprintf(file, " Phase:        %s\n", w.phase)
+		fmt.Fprintf(file, " Timestamp:    %s\n", time.Now().Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(file, "================================================================================\n")
+		fmt.Fprintf(file, "%s\n", m.Output)
+		file.Close()
+		log.Printf("⚠ WARN parser miss: %s %q: %s (quarantine/%s)", m.Device.Hostname, m.Command, m.Reason, name)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// RP REDUNDANCY CHECK (-redundancy)
+// ============================================================================
+//
+// Adds the redundancy commands to the XR/XE command sets and judges both
+// route processors of every device:
+//
+//   IOS-XR  show redundancy summary, show redundancy, admin show platform
+//   IOS-XE  show redundancy states, show redundancy
+//
+// When the inventory has a Standby_IP for a device (CSV column 10, JSON
+// "standby_ip") the tool also logs in to the standby RSP's management
+// address and runs show version and show redundancy there. Those results
+// are recorded in the device log as "standby: <command>". Without a standby
+// address the standby software comes from the active RP's own output where
+// the platform prints it (XE Peer Processor section).
+//
+// A device is OK when a standby RP exists, is ready (XR Node Ready / XE
+// STANDBY HOT, which implies the running config is synchronised), NSR is
+// ready when XR reports it, and both RPs run the same software.
+
+const standbyPrefix = "standby: "
+
+var redundancyCommands = map[string][]string{
+	"IOS-XR": {"show redundancy summary", "show redundancy", "admin show platform"},
+	"IOS-XE": {"show redundancy states", "show redundancy"},
+}
+
+var standbyCommands = []string{"show version", "show redundancy"}
+
+var (
+	xrRedSummaryRe  = regexp.MustCompile(`^\s*(\d+/\S+/CPU\d+)\s+(\d+/\S+/CPU\d+|N/A)\s*(?:\((.*)\))?`)
+	xrStandbyReady  = regexp.MustCompile(`Standby node in (\S+) is (ready|not ready)`)
+	xrStandbyNSR    = regexp.MustCompile(`Standby node in \S+ is (NSR-ready|NSR-not-ready|NSR-not-configured)`)
+	xePeerStateRe   = regexp.MustCompile(`peer state\s*=\s*\d+\s*-\s*(.+?)\s*$`)
+	xeRedModeRe     = regexp.MustCompile(`Redundancy Mode \(Operational\)\s*=\s*(\S+)`)
+	xeImageRe       = regexp.MustCompile(`Image Version\s*=\s*(.*)$`)
+	xePeerSectionRe = regexp.MustCompile(`(?i)^\s*Peer Processor Information`)
+	xeLocationRe    = regexp.MustCompile(`^\s*(Active|Standby) Location\s*=\s*(.+?)\s*$`)
+)
+
+func addRedundancyCommands(cs *CommandSet) {
+	cs.IOSXR = mergeCommands(cs.IOSXR, redundancyCommands["IOS-XR"])
+	cs.IOSXE = mergeCommands(cs.IOSXE, redundancyCommands["IOS-XE"])
+}
+
+// collectStandby runs the standby commands on the device's standby address;
+// a failed login is recorded as the output so the report can say why
+func collectStandby(device DeviceInfo, config *Config) []ExecutionResult {
+	standby := device
+	standby.IPAddress = device.StandbyIP
+	client := newDeviceClient(standby, config)
+	client.name = device.Hostname + "-standby"
+
+	start := time.Now()
+	used, outputs, err := executeWithFallback(client, standbyCommands)
+	var results []ExecutionResult
+	if err != nil {
+		log.Printf("⚠ %s: standby RP %s: %v", device.Hostname, device.StandbyIP, err)
+		return []ExecutionResult{{
+			Hostname:  device.Hostname,
+			IPAddress: device.StandbyIP,
+			Command:   standbyPrefix + "login",
+			Output:    "(standby unreachable: " + err.Error() + ")",
+			Error:     err,
+			Duration:  time.Since(start),
+			Stamp:     newSampleStamp(),
+		}}
+	}
+	for _, cmd := range used {
+		results = append(results, ExecutionResult{
+			Hostname:  device.Hostname,
+			IPAddress: device.StandbyIP,
+			Command:   standbyPrefix + cmd,
+			Output:    outputs[cmd],
+			Duration:  time.Since(start) / time.Duration(len(used)),
+			Stamp:     newSampleStamp(),
+		})
+	}
+	return results
+}
+
+// RedundancyRow is the redundancy state of one device
+type RedundancyRow struct {
+	Hostname       string
+	Site           string
+	OS             string
+	ActiveRP       string
+	StandbyRP      string
+	StandbyState   string // Node Ready, STANDBY HOT, ...
+	NSR            string
+	Mode           string // XE operational mode (sso, rpr, ...)
+	ActiveVersion  string
+	StandbyVersion string
+	StandbyLogin   string // OK, FAILED, "" = no standby address
+	Status         string // OK, DEGRADED, NO_STANDBY, NOT_COLLECTED
+	Reasons        []string
+}
+
+// parseRedundancy fills a row from the active and standby outputs
+func parseRedundancy(r *DeviceResult) RedundancyRow {
+	row := RedundancyRow{Hostname: r.Device.Hostname, Site: r.Device.Site, OS: r.Device.DetectedOS}
+	for _, e := range r.Results {
+		standby := strings.HasPrefix(e.Command, standbyPrefix)
+		cmd := strings.ToLower(strings.TrimPrefix(e.Command, standbyPrefix))
+		switch {
+		case standby && cmd == "login":
+			row.StandbyLogin = "FAILED"
+		case standby && strings.HasPrefix(cmd, "show version"):
+			row.StandbyLogin = "OK"
+			row.StandbyVersion = parseSoftwareVersion(e.Output)
+		case standby:
+		case strings.HasPrefix(cmd, "show version"):
+			row.ActiveVersion = parseSoftwareVersion(e.Output)
+		case strings.HasPrefix(cmd, "show redundancy summary"):
+			for _, line := range strings.Split(e.Output, "\n") {
+				if m := xrRedSummaryRe.FindStringSubmatch(line); m != nil {
+					row.ActiveRP, row.StandbyRP = m[1], m[2]
+					for _, part := range strings.Split(m[3], ",") {
+						part = strings.TrimSpace(part)
+						if strings.HasPrefix(part, "NSR:") {
+							row.NSR = strings.TrimPrefix(part, "NSR:")
+						} else if part != "" {
+							row.StandbyState = part
+						}
+					}
+				}
+			}
+		case strings.HasPrefix(cmd, "show redundancy states"):
+			for _, line := range strings.Split(e.Output, "\n") {
+				if m := xePeerStateRe.FindStringSubmatch(line); m != nil {
+					row.StandbyState = m[1]
+				}
+				if m := xeRedModeRe.FindStringSubmatch(line); m != nil {
+					row.Mode = m[1]
+				}
+			}
+		case strings.HasPrefix(cmd, "show redundancy"):
+			peer := false
+			for _, line := range strings.Split(e.Output, "\n") {
+				if m := xrStandbyReady.FindStringSubmatch(line); m != nil {
+					row.StandbyRP = m[1]
+					if row.StandbyState == "" {
+						row.StandbyState = m[2]
+					}
+				}
+				if m := xrStandbyNSR.FindStringSubmatch(line); m != nil && row.NSR == "" {
+					row.NSR = strings.TrimPrefix(m[1], "NSR-")
+				}
+				if xePeerSectionRe.MatchString(line) {
+					peer = true
+				}
+				if m := xeLocationRe.FindStringSubmatch(line); m != nil {
+					if m[1] == "Active" {
+						row.ActiveRP = m[2]
+					} else {
+						row.StandbyRP = m[2]
+					}
+				}
+				if m := xeImageRe.FindStringSubmatch(line); m != nil {
+					v := parseSoftwareVersion(m[1])
+					if peer && row.StandbyVersion == "" {
+						row.StandbyVersion = v
+					} else if !peer && row.ActiveVersion == "" {
+						row.ActiveVersion = v
+					}
+				}
+			}
+		}
+	}
+
+	collected := row.ActiveRP != "" || row.StandbyRP != "" || row.StandbyState != "" || row.Mode != ""
+	switch {
+	case !r.Success || !collected:
+		row.Status = "NOT_COLLECTED"
+		return row
+	case row.StandbyRP == "N/A" || (row.StandbyRP == "" && row.StandbyState == "") ||
+		strings.Contains(strings.ToUpper(row.StandbyState), "DISABLED"):
+		row.Status = "NO_STANDBY"
+		row.Reasons = append(row.Reasons, "no standby route processor")
+		return row
+	}
+
+	state := strings.ToUpper(row.StandbyState)
+	if !(state == "NODE READY" || state == "READY" || state == "STANDBY HOT") {
+		row.Reasons = append(row.Reasons, fmt.Sprintf("standby %s, config not in sync", orDash(row.StandbyState)))
+	}
+	if n := strings.ToUpper(row.NSR); n != "" && n != "READY" {
+		row.Reasons = append(row.Reasons, "NSR "+row.NSR)
+	}
+	if row.Mode != "" && !strings.EqualFold(row.Mode, "sso") {
+		row.Reasons = append(row.Reasons, "redundancy mode "+row.Mode)
+	}
+	if row.StandbyLogin == "FAILED" {
+		row.Reasons = append(row.Reasons, "standby address did not answer")
+	}
+	if row.ActiveVersion != "" && row.StandbyVersion != "" && row.ActiveVersion != row.StandbyVersion {
+		row.Reasons = append(row.Reasons, fmt.Sprintf("software %s on active, %s on standby", row.ActiveVersion, row.StandbyVersion))
+	}
+	row.Status = "OK"
+	if len(row.Reasons) > 0 {
+		row.Status = "DEGRADED"
+	}
+	return row
+}
+
+// checkRedundancy evaluates the XR/XE devices of a run
+func checkRedundancy(results []*DeviceResult) []RedundancyRow {
+	var rows []RedundancyRow
+	for _, r := range results {
+		if r.Device.DetectedOS != "IOS-XR" && r.Device.DetectedOS != "IOS-XE" {
+			continue
+		}
+		rows = append(rows, parseRedundancy(r))
+	}
+	return rows
+}
+
+// WriteRedundancy writes REDUNDANCY_<ts>.log
+func (w *OutputWriter) WriteRedundancy(rows []RedundancyRow) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("REDUNDANCY_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	counts := make(map[string]int)
+	for _, r := range rows {
+		counts[r.Status]++
+	}
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO RP Redundancy Check\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, " OK: %d | DEGRADED: %d | NO_STANDBY: %d | NOT_COLLECTED: %d\n",
+		counts["OK"], counts["DEGRADED"], counts["NO_STANDBY"], counts["NOT_COLLECTED"])
+	fmt.Fprintf(file, "================================================================================\n\n")
+
+	table := newTextTable("HOSTNAME", "OS", "ACTIVE", "STANDBY", "STANDBY STATE", "NSR/MODE", "ACTIVE SW", "STANDBY SW", "STATUS")
+	for _, r := range rows {
+		nsr := r.NSR
+		if r.Mode != "" {
+			nsr = r.Mode
+		}
+		table.add(r.Site, displayHost(r.Hostname), r.OS, orDash(r.ActiveRP), orDash(r.StandbyRP), orDash(r.StandbyState),
+			orDash(nsr), orDash(r.ActiveVersion), orDash(r.StandbyVersion), r.Status)
+		for _, reason := range r.Reasons {
+			table.note("    - %s", reason)
+		}
+	}
+	table.write(file)
+	return nil
+}
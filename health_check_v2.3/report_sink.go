@@ -0,0 +1,121 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ============================================================================
+// REPORT FILE SAFETY
+// ============================================================================
+//
+// Report files are written to a hidden temp file in the same directory and
+// renamed into place on Close, so a reader (the NOC share, a later -compare)
+// never sees a half-written report and an interrupted run leaves either the
+// previous file or none. Device logs are written by one goroutine that owns
+// the run's result sink, however many workers produce results.
+
+// atomicFile is a report being written; Close publishes it under its name
+type atomicFile struct {
+	*os.File
+	path string
+	once sync.Once
+	err  error
+}
+
+// createAtomic is os.Create for report files
+func createAtomic(path string) (*atomicFile, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return &atomicFile{File: tmp, path: path}, nil
+}
+
+// Close flushes the temp file and renames it over path; later calls are no-ops
+func (f *atomicFile) Close() error {
+	f.once.Do(func() {
+		tmp := f.File.Name()
+		if err := f.File.Sync(); err != nil {
+			f.err = err
+		}
+		if err := f.File.Close(); err != nil && f.err == nil {
+			f.err = err
+		}
+		if f.err == nil {
+			f.err = os.Rename(tmp, f.path)
+		}
+		if f.err != nil {
+			os.Remove(tmp)
+		}
+	})
+	return f.err
+}
+
+// Name is the final path, not the temp file
+func (f *atomicFile) Name() string {
+	return f.path
+}
+
+// writeFileAtomic is os.WriteFile through a temp file and rename
+func writeFileAtomic(path string, data []byte) error {
+	f, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.File.Close()
+		os.Remove(f.File.Name())
+		return err
+	}
+	return f.Close()
+}
+
+// resultSink receives device results from the workers and writes each
+// device log from a single goroutine
+type resultSink struct {
+	writer  *OutputWriter
+	in      chan *DeviceResult
+	done    chan struct{}
+	results []*DeviceResult
+}
+
+func newResultSink(writer *OutputWriter, buffer int) *resultSink {
+	s := &resultSink{writer: writer, in: make(chan *DeviceResult, buffer), done: make(chan struct{})}
+	go s.run()
+	return s
+}
+
+func (s *resultSink) run() {
+	defer close(s.done)
+	for r := range s.in {
+		s.results = append(s.results, r)
+		if err := s.writer.WriteDevice(r); err != nil {
+			log.Printf("✗ %s: cannot write device log: %v", r.Device.Hostname, err)
+		}
+		status := "✓ SUCCESS"
+		if !r.Success {
+			status = "✗ FAILED"
+		}
+		log.Printf("%s: %s [%s] using %s", status, r.Device.Hostname, r.Device.DetectedOS, filepath.Base(r.CommandFile))
+	}
+}
+
+// put hands a result to the sink; safe from any goroutine until close
+func (s *resultSink) put(r *DeviceResult) {
+	s.in <- r
+}
+
+// close waits until every result is written and returns them in arrival order
+func (s *resultSink) close() []*DeviceResult {
+	close(s.in)
+	<-s.done
+	return s.results
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// VALIDATION RESULTS DIFF (-compare-results OLD,NEW)
+// ============================================================================
+//
+// -compare compares the numbers of two runs; it does not say which checks
+// changed their verdict between last week's dry-run and tonight's
+// pre-check. -compare-results OLD,NEW diffs two exported result sets
+// (-export json, see validation_export.go) check by check. Each side is a
+// VALIDATION_<ts>.json file, or a run directory or PHASE@N whose
+// VALIDATION_<ts>.json, else VALIDATION_<ts>.csv, is read.
+//
+// Results are matched by hostname, check and item, and their statuses are
+// sorted into PASS, WARN and FAIL as for the roll-up:
+//
+//   NEW_FAIL   FAIL now, PASS or WARN before (or not checked before)
+//   NEW_WARN   WARN now, PASS before (or not checked before)
+//   RESOLVED   PASS now, FAIL or WARN before
+//   IMPROVED   WARN now, FAIL before
+//   REMOVED    checked before, not now
+//   ADDED      PASS now, not checked before
+//
+// RESULTS_DIFF.txt under -o lists them per class, RESULTS_DIFF.csv has one
+// row each. The verdict is REGRESSED with a new failure, WARN with a new
+// warning only, IMPROVED when only resolved or improved, UNCHANGED
+// otherwise; REGRESSED sends a notification.
+
+// resultsDiffOrder is the report order of the classes
+var resultsDiffOrder = []string{"NEW_FAIL", "NEW_WARN", "RESOLVED", "IMPROVED", "REMOVED", "ADDED"}
+
+var resultsDiffTitles = map[string]string{
+	"NEW_FAIL": "New failures",
+	"NEW_WARN": "New warnings",
+	"RESOLVED": "Resolved",
+	"IMPROVED": "Improved (FAIL to WARN)",
+	"REMOVED":  "No longer checked",
+	"ADDED":    "Newly checked, passing",
+}
+
+// ResultsDiff is one result whose verdict differs between the two sets
+type ResultsDiff struct {
+	Class    string
+	Hostname string
+	Check    string
+	Item     string
+	Old, New *ValidationResult
+}
+
+// resultSet is one side of the diff
+type resultSet struct {
+	Source  string
+	Phase   string
+	Time    string
+	Results []ValidationResult
+}
+
+// loadResultSet reads a VALIDATION json or csv, or the one of a run
+func loadResultSet(sel, outputDir string) (*resultSet, error) {
+	path, err := resolveRunSelector(outputDir, sel)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		dir := resolveRunDir(path)
+		found := ""
+		for _, ext := range []string{".json", ".csv"} {
+			if matches, _ := filepath.Glob(filepath.Join(dir, "VALIDATION_*"+ext)); len(matches) > 0 {
+				sort.Strings(matches)
+				found = matches[len(matches)-1]
+				break
+			}
+		}
+		if found == "" {
+			return nil, fmt.Errorf("%s: no VALIDATION_<ts>.json or .csv (run with -export json)", dir)
+		}
+		path = found
+	}
+
+	set := &resultSet{Source: path}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		if set.Results, err = readValidationCSV(path); err != nil {
+			return nil, err
+		}
+		set.Time = strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "VALIDATION_"), ".csv")
+		if run := filepath.Dir(path); filepath.Base(run) == set.Time {
+			// OUTPUT/PHASE/<ts>/VALIDATION_<ts>.csv
+			set.Phase = filepath.Base(filepath.Dir(run))
+		}
+		return set, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var export validationExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	set.Phase, set.Time, set.Results = export.Phase, export.Timestamp, export.Results
+	return set, nil
+}
+
+// readValidationCSV reads the rows of a VALIDATION csv by its header
+func readValidationCSV(path string) ([]ValidationResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s: empty", path)
+	}
+	cols := make(map[string]int)
+	for i, h := range rows[0] {
+		cols[strings.TrimSpace(h)] = i
+	}
+	for _, h := range []string{"Hostname", "Check", "Status"} {
+		if _, ok := cols[h]; !ok {
+			return nil, fmt.Errorf("%s: no %s column", path, h)
+		}
+	}
+	cell := func(row []string, h string) string {
+		if i, ok := cols[h]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	var results []ValidationResult
+	for _, row := range rows[1:] {
+		seq, _ := strconv.ParseUint(cell(row, "Seq"), 10, 64)
+		results = append(results, ValidationResult{Site: cell(row, "Site"), Hostname: cell(row, "Hostname"), OS: cell(row, "OS"),
+			Check: cell(row, "Check"), Item: cell(row, "Item"), Value: cell(row, "Value"), Status: cell(row, "Status"), Detail: cell(row, "Detail"),
+			Seq: seq, Time: cell(row, "Time_UTC"), Source: cell(row, "Source")})
+	}
+	return results, nil
+}
+
+// indexResults keys the results by hostname, check and item; a repeated
+// key (the same ping twice) gets its occurrence number
+func indexResults(results []ValidationResult) (map[string]*ValidationResult, []string) {
+	index := make(map[string]*ValidationResult)
+	var keys []string
+	for i := range results {
+		r := &results[i]
+		base := strings.ToUpper(r.Hostname) + "\x00" + r.Check + "\x00" + r.Item
+		key := base
+		for n := 2; index[key] != nil; n++ {
+			key = fmt.Sprintf("%s\x00%d", base, n)
+		}
+		index[key] = r
+		keys = append(keys, key)
+	}
+	return index, keys
+}
+
+// diffResults classifies the results whose verdict changed
+func diffResults(old, cur []ValidationResult) []ResultsDiff {
+	oldIndex, oldKeys := indexResults(old)
+	newIndex, newKeys := indexResults(cur)
+	var diffs []ResultsDiff
+	for _, key := range newKeys {
+		n, o := newIndex[key], oldIndex[key]
+		class := ""
+		now := rollupStatus(n.Status)
+		switch {
+		case o == nil && now == "FAIL":
+			class = "NEW_FAIL"
+		case o == nil && now == "WARN":
+			class = "NEW_WARN"
+		case o == nil:
+			class = "ADDED"
+		default:
+			switch was := rollupStatus(o.Status); {
+			case now == was:
+			case now == "FAIL":
+				class = "NEW_FAIL"
+			case now == "WARN" && was == "PASS":
+				class = "NEW_WARN"
+			case now == "PASS":
+				class = "RESOLVED"
+			default:
+				class = "IMPROVED"
+			}
+		}
+		if class != "" {
+			diffs = append(diffs, ResultsDiff{Class: class, Hostname: n.Hostname, Check: n.Check, Item: n.Item, Old: o, New: n})
+		}
+	}
+	for _, key := range oldKeys {
+		if o := oldIndex[key]; newIndex[key] == nil {
+			diffs = append(diffs, ResultsDiff{Class: "REMOVED", Hostname: o.Hostname, Check: o.Check, Item: o.Item, Old: o})
+		}
+	}
+	rank := make(map[string]int)
+	for i, c := range resultsDiffOrder {
+		rank[c] = i
+	}
+	sort.SliceStable(diffs, func(i, j int) bool {
+		a, b := diffs[i], diffs[j]
+		if a.Class != b.Class {
+			return rank[a.Class] < rank[b.Class]
+		}
+		if a.Hostname != b.Hostname {
+			return a.Hostname < b.Hostname
+		}
+		return a.Check < b.Check
+	})
+	return diffs
+}
+
+// resultsDiffVerdict sums up the diff
+func resultsDiffVerdict(counts map[string]int) string {
+	switch {
+	case counts["NEW_FAIL"] > 0:
+		return "REGRESSED"
+	case counts["NEW_WARN"] > 0:
+		return "WARN"
+	case counts["RESOLVED"]+counts["IMPROVED"] > 0:
+		return "IMPROVED"
+	}
+	return "UNCHANGED"
+}
+
+// describeResult is a status with its value, "-" for a missing result
+func describeResult(r *ValidationResult) string {
+	if r == nil {
+		return "-"
+	}
+	if r.Value == "" {
+		return r.Status
+	}
+	return r.Status + " (" + r.Value + ")"
+}
+
+// runResultsComparison diffs two result sets and writes RESULTS_DIFF.txt
+// and .csv under outputDir; it returns the report and the verdict
+func runResultsComparison(spec, outputDir string) (string, string, error) {
+	parts := strings.Split(spec, ",")
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("-compare-results requires OLD,NEW (VALIDATION json/csv, run dir or PHASE@N)")
+	}
+	old, err := loadResultSet(strings.TrimSpace(parts[0]), outputDir)
+	if err != nil {
+		return "", "", err
+	}
+	cur, err := loadResultSet(strings.TrimSpace(parts[1]), outputDir)
+	if err != nil {
+		return "", "", err
+	}
+	diffs := diffResults(old.Results, cur.Results)
+	counts := make(map[string]int)
+	for _, d := range diffs {
+		counts[d.Class]++
+	}
+	verdict := resultsDiffVerdict(counts)
+
+	rows := [][]string{{"Class", "Site", "Hostname", "Check", "Item", "Old Status", "Old Value", "New Status", "New Value", "Detail"}}
+	for _, d := range diffs {
+		r := d.New
+		if r == nil {
+			r = d.Old
+		}
+		row := []string{d.Class, r.Site, d.Hostname, d.Check, d.Item, "", "", "", "", r.Detail}
+		if d.Old != nil {
+			row[5], row[6] = d.Old.Status, d.Old.Value
+		}
+		if d.New != nil {
+			row[7], row[8] = d.New.Status, d.New.Value
+		}
+		rows = append(rows, row)
+	}
+	if err := writeCSVRows(filepath.Join(outputDir, "RESULTS_DIFF.csv"), rows); err != nil {
+		return "", "", err
+	}
+
+	outputFile := filepath.Join(outputDir, "RESULTS_DIFF.txt")
+	file, err := createAtomic(outputFile)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Validation Results Diff\n")
+	fmt.Fprintf(file, " Generated: %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, " Old: %s (%s %s, %d results)\n", old.Source, orDash(old.Phase), orDash(old.Time), len(old.Results))
+	fmt.Fprintf(file, " New: %s (%s %s, %d results)\n", cur.Source, orDash(cur.Phase), orDash(cur.Time), len(cur.Results))
+	fmt.Fprintf(file, " Verdict: %s\n", verdict)
+	var line []string
+	for _, c := range resultsDiffOrder {
+		line = append(line, fmt.Sprintf("%s: %d", c, counts[c]))
+	}
+	fmt.Fprintf(file, " %s\n", strings.Join(line, " | "))
+	fmt.Fprintf(file, "================================================================================\n")
+
+	for _, class := range resultsDiffOrder {
+		if counts[class] == 0 {
+			continue
+		}
+		fmt.Fprintf(file, "\n=== %s (%d) ===\n", resultsDiffTitles[class], counts[class])
+		table := newTextTable("HOSTNAME", "CHECK", "ITEM", "OLD", "NEW")
+		for _, d := range diffs {
+			if d.Class != class {
+				continue
+			}
+			site := ""
+			if d.New != nil {
+				site = d.New.Site
+			} else if d.Old != nil {
+				site = d.Old.Site
+			}
+			table.add(site, displayHost(d.Hostname), d.Check, orDash(d.Item), describeResult(d.Old), describeResult(d.New))
+			if d.New != nil && d.New.Detail != "" && rollupStatus(d.New.Status) != "PASS" {
+				table.note("    - %s", d.New.Detail)
+			}
+		}
+		table.write(file)
+	}
+	if len(diffs) == 0 {
+		fmt.Fprintf(file, "\nNo check changed its verdict (%d results compared).\n", len(cur.Results))
+	}
+
+	fmt.Fprintf(file, "\n================================================================================\n")
+	fmt.Fprintf(file, " End of Results Diff\n")
+	fmt.Fprintf(file, "================================================================================\n")
+	return outputFile, verdict, nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// RE-RUN OF FAILED DEVICES (-retry-failed)
+// ============================================================================
+//
+// When six devices of a sixty-device run time out, running all sixty again
+// costs the window, and a second run leaves two half-complete baselines.
+// -retry-failed RUN (a run directory or PHASE@N) collects again only the
+// devices whose log in that run starts with an ERROR, with the current
+// inventory, credentials and command files, and merges them into the run:
+//
+//   - their <host>_<ts>.log files are replaced
+//   - SUMMARY, TIMINGS and the check reports are written again from all
+//     device logs under the run's own timestamp; the other devices keep
+//     their outputs and timings
+//   - every COMPARISON_REPORT.txt under -o that compared this run, as pre
+//     or post, is regenerated against the same other run
+//
+// RETRY_<ts>.log in the run records each attempt. Devices that fail again
+// stay failed in the run and can be retried later. Comparison reports
+// written before the report header named its runs are not found; run
+// -compare again for those.
+
+// retryFailedRun collects the failed devices of a run again and merges
+// them into its reports and comparisons
+func retryFailedRun(config *Config, devices map[string]DeviceInfo, commands *CommandSet) error {
+	sel, err := resolveRunSelector(config.OutputDir, config.RetryFailed)
+	if err != nil {
+		return err
+	}
+	runDir := resolveRunDir(sel)
+	summary := findCSVFile(runDir)
+	if summary == "" || filepath.Dir(summary) != runDir {
+		return fmt.Errorf("%s is not a run directory (no SUMMARY_<ts>.csv)", runDir)
+	}
+	ts := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(summary), "SUMMARY_"), ".csv")
+	writer := &OutputWriter{dir: runDir, phase: filepath.Base(filepath.Dir(runDir)), timestamp: ts}
+
+	results, err := loadFixtureRun(runDir)
+	if err != nil {
+		return err
+	}
+	var targets []DeviceInfo
+	var names []string
+	for _, r := range results {
+		d, ok := devices[strings.ToUpper(r.Device.Hostname)]
+		if ok {
+			// The device log does not record site and role
+			r.Device.Site, r.Device.Role, r.Device.Pair = d.Site, d.Role, d.Pair
+		}
+		if r.Success {
+			continue
+		}
+		if !ok {
+			log.Printf("WARNING: %s not in inventory, not retried", r.Device.Hostname)
+			continue
+		}
+		if !hasSSHCredentials(config, d) {
+			return fmt.Errorf("%s: no password (-p), private key (-key or inventory) or ssh-agent available", d.Hostname)
+		}
+		targets = append(targets, d)
+		names = append(names, d.Hostname)
+	}
+	if len(targets) == 0 {
+		log.Printf("✓ %s: no failed devices to retry", runDir)
+		return nil
+	}
+	log.Printf("Retrying %d of %d devices of %s: %s", len(targets), len(results), runDir, strings.Join(names, ", "))
+
+	timingsPath := filepath.Join(runDir, fmt.Sprintf("TIMINGS_%s.csv", ts))
+	oldTimings := readTimingRows(timingsPath)
+	gate := newCriticalGate(config, writer.phase)
+	fresh := make(map[string]*DeviceResult)
+	for _, r := range collectDevices(config, writer, targets, commands, gate) {
+		fresh[strings.ToUpper(r.Device.Hostname)] = r
+	}
+	var attempts []string
+	for i, r := range results {
+		n, ok := fresh[strings.ToUpper(r.Device.Hostname)]
+		if !ok {
+			gate.recall(r)
+			continue
+		}
+		status := "SUCCESS"
+		if !n.Success {
+			status = "FAILED: " + n.ErrorMessage
+		}
+		attempts = append(attempts, fmt.Sprintf("%s  %s  was FAILED (%s), now %s",
+			time.Now().Format("2006-01-02 15:04:05"), r.Device.Hostname, r.ErrorMessage, status))
+		results[i] = n
+	}
+
+	writeRunReports(config, writer, results, gate)
+	if err := keepTimingRows(timingsPath, oldTimings, fresh); err != nil {
+		log.Printf("⚠ Timings: %v", err)
+	}
+	if err := appendRetryLog(filepath.Join(runDir, fmt.Sprintf("RETRY_%s.log", ts)), attempts); err != nil {
+		log.Printf("⚠ Retry log: %v", err)
+	}
+	storeRun(config, writer)
+	printRunFooter(writer, results)
+	redoComparisons(config, runDir)
+	return nil
+}
+
+// readTimingRows reads the rows of a TIMINGS csv by upper-case hostname
+func readTimingRows(path string) map[string]string {
+	rows := make(map[string]string)
+	lines, err := os.ReadFile(path)
+	if err != nil {
+		return rows
+	}
+	for i, line := range strings.Split(strings.TrimRight(string(lines), "\n"), "\n") {
+		if host, _, ok := strings.Cut(line, ","); ok && i > 0 {
+			rows[strings.ToUpper(host)] = line
+		}
+	}
+	return rows
+}
+
+// keepTimingRows puts the recorded timings of the devices not retried back
+// into the rewritten TIMINGS csv; the replayed logs carry no durations
+func keepTimingRows(path string, old map[string]string, retried map[string]*DeviceResult) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	for i := 1; i < len(lines); i++ {
+		host, _, _ := strings.Cut(lines[i], ",")
+		key := strings.ToUpper(host)
+		if row, ok := old[key]; ok && retried[key] == nil {
+			lines[i] = row
+		}
+	}
+	return writeFileAtomic(path, []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// appendRetryLog adds the attempts of this retry to the run's retry log
+func appendRetryLog(path string, attempts []string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for _, a := range attempts {
+		if _, err := fmt.Fprintln(file, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// comparedRunDir is the absolute run directory a comparison report names
+// for a compared run (dir or the run below it)
+func comparedRunDir(dir string) string {
+	run := dir
+	if summary := findCSVFile(dir); summary != "" {
+		run = filepath.Dir(summary)
+	}
+	if abs, err := filepath.Abs(run); err == nil {
+		return abs
+	}
+	return run
+}
+
+// readComparedRuns reads the Pre and Post runs from a comparison report header
+func readComparedRuns(path string) (pre, post string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 0; n < 10 && scanner.Scan(); n++ {
+		line := scanner.Text()
+		if v, ok := strings.CutPrefix(line, " Pre: "); ok {
+			pre = strings.TrimSpace(v)
+		} else if v, ok := strings.CutPrefix(line, " Post: "); ok {
+			post = strings.TrimSpace(v)
+		}
+	}
+	return pre, post
+}
+
+// redoComparisons regenerates the comparison reports under -o that
+// compared runDir
+func redoComparisons(config *Config, runDir string) {
+	run := comparedRunDir(runDir)
+	redone := 0
+	filepath.WalkDir(config.OutputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() != "COMPARISON_REPORT.txt" {
+			return nil
+		}
+		pre, post := readComparedRuns(path)
+		if pre != run && post != run {
+			return nil
+		}
+		verdict, err := comparePhases(pre, post, path, config.Bands)
+		if err != nil {
+			log.Printf("✗ Comparison %s: %v", path, err)
+			return nil
+		}
+		log.Printf("Comparison report regenerated: %s (verdict: %s)", path, verdict)
+		redone++
+		return nil
+	})
+	if redone == 0 {
+		log.Printf("No comparison of this run under %s; run -compare to compare it", config.OutputDir)
+	}
+}
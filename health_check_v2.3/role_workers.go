@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ============================================================================
+// PER-ROLE CONCURRENCY - cap parallel sessions per device role
+// ============================================================================
+//
+// -role-workers "IOS-XR=4,L2-SWITCH=10" limits how many devices of a role are
+// collected at once, on top of the global -w worker pool. A role matches the
+// inventory Device_Type first, then the inventory Role, then the detected OS.
+// A role ending in "*" is a prefix, so "ASR9906=5,ASR92*=1" lets the big
+// routers run five at a time while ASR920/ASR9201 access devices are
+// collected one by one; exact names win over prefixes and longer prefixes
+// over shorter ones. Devices of a role that is at its limit are held back
+// while devices of other roles are dispatched.
+
+// roleLimiter hands out devices in inventory order while respecting role limits
+type roleLimiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limits map[string]int
+	active map[string]int
+}
+
+// parseRoleWorkers reads ROLE=N[,ROLE=N...]; an empty spec disables limits
+func parseRoleWorkers(spec string) (*roleLimiter, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	l := &roleLimiter{limits: make(map[string]int), active: make(map[string]int)}
+	l.cond = sync.NewCond(&l.mu)
+	for _, part := range strings.Split(spec, ",") {
+		role, n, ok := strings.Cut(strings.TrimSpace(part), "=")
+		limit, err := strconv.Atoi(strings.TrimSpace(n))
+		if !ok || err != nil || limit < 1 || strings.TrimSpace(role) == "" {
+			return nil, fmt.Errorf("invalid role limit %q (expected ROLE=N)", part)
+		}
+		role = strings.ToUpper(strings.TrimSpace(role))
+		if strings.TrimSuffix(role, "*") == "" {
+			return nil, fmt.Errorf("invalid role limit %q (prefix is empty; use -w for a global limit)", part)
+		}
+		l.limits[role] = limit
+	}
+	return l, nil
+}
+
+// roleOf returns the limited role a device belongs to, or "" if unlimited
+func (l *roleLimiter) roleOf(d DeviceInfo) string {
+	names := []string{strings.ToUpper(d.DeviceType), strings.ToUpper(d.Role), strings.ToUpper(d.DetectedOS)}
+	for _, n := range names {
+		if _, ok := l.limits[n]; ok && n != "" {
+			return n
+		}
+	}
+	best := ""
+	for _, n := range names {
+		for role := range l.limits {
+			prefix := strings.TrimSuffix(role, "*")
+			if prefix != role && strings.HasPrefix(n, prefix) && len(role) > len(best) {
+				best = role
+			}
+		}
+		if best != "" {
+			return best
+		}
+	}
+	return ""
+}
+
+// next blocks until a pending device may start and returns it with the rest
+func (l *roleLimiter) next(pending []DeviceInfo) (DeviceInfo, []DeviceInfo) {
+	if l == nil {
+		return pending[0], pending[1:]
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for {
+		for i, d := range pending {
+			role := l.roleOf(d)
+			if role != "" && l.active[role] >= l.limits[role] {
+				continue
+			}
+			if role != "" {
+				l.active[role]++
+			}
+			rest := append(append([]DeviceInfo{}, pending[:i]...), pending[i+1:]...)
+			return d, rest
+		}
+		l.cond.Wait()
+	}
+}
+
+// done frees the device's role slot
+func (l *roleLimiter) done(d DeviceInfo) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	if role := l.roleOf(d); role != "" {
+		l.active[role]--
+	}
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// ROLLBACK TRIGGERS & ACTIONS (window mode)
+// ============================================================================
+//
+// -rollback-rules binds triggers, checked after every window snapshot
+// against the window-start baseline, to actions:
+//
+//   # trigger                    threshold  actions
+//   bgp-below-baseline            0          alert,halt
+//   vrf-route-loss CUST-A         20         alert,rollback:rollback/cust-a.txt@UPE1,UPE9
+//   ping-loss                     10         alert
+//
+//   bgp-below-baseline N      established BGP sessions fell more than N below baseline
+//   vrf-route-loss VRF PCT    routes of VRF ("*" = any VRF) dropped more than PCT percent
+//   ping-loss PCT             a ping test lost more than PCT percent
+//
+//   alert                     log, record in ROLLBACK_<ts>.log and run -alert-cmd
+//   rollback:FILE@HOSTS       send the stored command set FILE to HOSTS
+//                             (comma-separated, "*" or "hit" = the triggering hosts)
+//   halt                      stop the window, take the final snapshot, exit non-zero
+//
+// Each rule fires once per run. A rollback always asks for a typed ROLLBACK
+// confirmation on the terminal; with -rollback-dry-run (or -dry-run) it only
+// records what it would send.
+
+// RollbackRule is one trigger with its actions
+type RollbackRule struct {
+	Line      int
+	Trigger   string
+	VRF       string // vrf-route-loss only
+	Threshold float64
+	Actions   []string
+}
+
+func (r RollbackRule) String() string {
+	if r.VRF != "" {
+		return fmt.Sprintf("%s %s %g", r.Trigger, r.VRF, r.Threshold)
+	}
+	return fmt.Sprintf("%s %g", r.Trigger, r.Threshold)
+}
+
+// parseRollbackRules reads the -rollback-rules file
+func parseRollbackRules(path string) ([]RollbackRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []RollbackRule
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		rule := RollbackRule{Line: n, Trigger: f[0]}
+		want := 3
+		if rule.Trigger == "vrf-route-loss" {
+			want = 4
+		}
+		if len(f) != want {
+			return nil, fmt.Errorf("%s:%d: expected <trigger> [vrf] <threshold> <actions>", path, n)
+		}
+		switch rule.Trigger {
+		case "bgp-below-baseline", "ping-loss":
+		case "vrf-route-loss":
+			rule.VRF = f[1]
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown trigger %q", path, n, rule.Trigger)
+		}
+		if rule.Threshold, err = strconv.ParseFloat(f[want-2], 64); err != nil {
+			return nil, fmt.Errorf("%s:%d: bad threshold %q", path, n, f[want-2])
+		}
+		for _, a := range splitRollbackActions(f[want-1]) {
+			switch {
+			case a == "alert" || a == "halt":
+			case strings.HasPrefix(a, "rollback:") && strings.Contains(a, "@"):
+				file := strings.SplitN(strings.TrimPrefix(a, "rollback:"), "@", 2)[0]
+				if _, err := readRollbackCommands(file); err != nil {
+					return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+				}
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown action %q (alert, halt, rollback:FILE@HOSTS)", path, n, a)
+			}
+			rule.Actions = append(rule.Actions, a)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// splitRollbackActions splits "alert,rollback:f.txt@A,B,halt": commas after
+// an @ separate hosts until the next known action name.
+func splitRollbackActions(s string) []string {
+	var actions []string
+	for _, part := range strings.Split(s, ",") {
+		n := len(actions)
+		if n > 0 && strings.Contains(actions[n-1], "@") && part != "alert" && part != "halt" && !strings.HasPrefix(part, "rollback:") {
+			actions[n-1] += "," + part
+			continue
+		}
+		actions = append(actions, part)
+	}
+	return actions
+}
+
+// readRollbackCommands loads a stored rollback command set (one line per command)
+func readRollbackCommands(path string) ([]string, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, fmt.Errorf("rollback command set: %v", err)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("rollback command set %s is empty", path)
+	}
+	return lines, nil
+}
+
+// TriggerHit is one host meeting a rule's trigger
+type TriggerHit struct {
+	Host   string
+	Detail string
+}
+
+// snapshotValues sums each host's numeric metrics per metric name
+func snapshotValues(results []*DeviceResult) map[string]map[string]float64 {
+	values := make(map[string]map[string]float64)
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		host := r.Device.Hostname
+		if values[host] == nil {
+			values[host] = make(map[string]float64)
+		}
+		for _, e := range r.Results {
+			// A cut-off output would read as zero neighbors
+			if isIncompleteOutput(e.Output) {
+				continue
+			}
+			for metric, value := range extractMetrics(e.Command, e.Output) {
+				if v, err := strconv.ParseFloat(value, 64); err == nil {
+					values[host][metric] += v
+				}
+			}
+		}
+	}
+	return values
+}
+
+// checkTrigger returns the hosts of the current snapshot that meet rule
+func checkTrigger(rule RollbackRule, baseline map[string]map[string]float64, current []*DeviceResult) []TriggerHit {
+	var hits []TriggerHit
+	now := snapshotValues(current)
+	hosts := make([]string, 0, len(now))
+	for h := range now {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		cur, base := now[host], baseline[host]
+		switch rule.Trigger {
+		case "bgp-below-baseline":
+			b, ok := base["BGP_Neighbors_Established"]
+			c, seen := cur["BGP_Neighbors_Established"]
+			if ok && seen && c < b-rule.Threshold {
+				hits = append(hits, TriggerHit{host, fmt.Sprintf("BGP established %g, baseline %g", c, b)})
+			}
+		case "vrf-route-loss":
+			for metric, b := range base {
+				vrf, isRoutes := strings.CutPrefix(metric, "VRF_Routes_")
+				if !isRoutes || b <= 0 || (rule.VRF != "*" && vrf != rule.VRF) {
+					continue
+				}
+				c, seen := cur[metric]
+				if !seen {
+					continue
+				}
+				if loss := (b - c) / b * 100; loss > rule.Threshold {
+					hits = append(hits, TriggerHit{host, fmt.Sprintf("VRF %s routes %g, baseline %g (-%.0f%%)", vrf, c, b, loss)})
+				}
+			}
+		case "ping-loss":
+			for _, r := range current {
+				if r.Device.Hostname != host {
+					continue
+				}
+				for _, e := range r.Results {
+					if p, ok := parsePingOutput(e.Command, e.Output); ok && p.Sent > 0 {
+						if loss := float64(100 - p.SuccessPct); loss > rule.Threshold {
+							hits = append(hits, TriggerHit{host, fmt.Sprintf("%q lost %.0f%%", e.Command, loss)})
+						}
+					}
+				}
+			}
+		}
+	}
+	return hits
+}
+
+// rollbackEngine evaluates the rules of one window-mode run
+type rollbackEngine struct {
+	config   *Config
+	rules    []RollbackRule
+	fired    map[int]bool
+	baseline map[string]map[string]float64
+	devices  map[string]DeviceInfo
+	logFile  string
+	halted   bool
+}
+
+func newRollbackEngine(config *Config, rules []RollbackRule, targets []DeviceInfo) *rollbackEngine {
+	e := &rollbackEngine{config: config, rules: rules, fired: make(map[int]bool), devices: make(map[string]DeviceInfo)}
+	for _, d := range targets {
+		e.devices[strings.ToUpper(d.Hostname)] = d
+	}
+	e.logFile = filepath.Join(config.OutputDir, fmt.Sprintf("ROLLBACK_%s.log", time.Now().Format("20060102_150405")))
+	return e
+}
+
+// record appends one event to ROLLBACK_<ts>.log
+func (e *rollbackEngine) record(format string, args ...interface{}) {
+	os.MkdirAll(e.config.OutputDir, 0755)
+	f, err := os.OpenFile(e.logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("✗ Rollback log: %v", err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%s  %s\n", time.Now().Format("2006-01-02 15:04:05"), fmt.Sprintf(format, args...))
+}
+
+func (e *rollbackEngine) setBaseline(results []*DeviceResult) {
+	e.baseline = snapshotValues(results)
+	e.record("baseline taken, %d rules armed", len(e.rules))
+}
+
+// evaluate checks every armed rule against a snapshot and runs the actions
+// of those that fire. It returns true once a halt action has run.
+func (e *rollbackEngine) evaluate(results []*DeviceResult) bool {
+	for _, rule := range e.rules {
+		if e.fired[rule.Line] {
+			continue
+		}
+		hits := checkTrigger(rule, e.baseline, results)
+		if len(hits) == 0 {
+			continue
+		}
+		e.fired[rule.Line] = true
+		var hosts, details []string
+		for _, h := range hits {
+			hosts = append(hosts, h.Host)
+			details = append(details, h.Host+": "+h.Detail)
+		}
+		log.Printf("🚨 TRIGGER %s: %s", rule, strings.Join(details, "; "))
+		e.record("TRIGGER %s: %s", rule, strings.Join(details, "; "))
+		e.config.Notify.notify(Alert{Event: "rollback-trigger", Severity: "critical", Check: rule.String(), Details: details})
+
+		for _, action := range rule.Actions {
+			switch {
+			case action == "alert":
+				e.alert(rule, details)
+			case action == "halt":
+				log.Printf("⛔ HALT: %s fired, stopping the window", rule)
+				e.record("HALT")
+				e.halted = true
+			case strings.HasPrefix(action, "rollback:"):
+				e.rollback(rule, action, hosts)
+			}
+		}
+	}
+	return e.halted
+}
+
+// alert runs -alert-cmd with the trigger details on stdin
+func (e *rollbackEngine) alert(rule RollbackRule, details []string) {
+	e.record("ALERT %s", rule)
+	if e.config.AlertCmd == "" {
+		return
+	}
+	cmd := shellCommand(context.Background(), e.config.AlertCmd)
+	cmd.Env = append(os.Environ(), "ROLLBACK_TRIGGER="+rule.String())
+	cmd.Stdin = strings.NewReader(strings.Join(details, "\n") + "\n")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		log.Printf("✗ -alert-cmd failed: %v %s", err, strings.TrimSpace(string(out)))
+		e.record("ALERT command failed: %v", err)
+	}
+}
+
+// rollback sends a stored command set after a typed confirmation
+func (e *rollbackEngine) rollback(rule RollbackRule, action string, hit []string) {
+	spec := strings.SplitN(strings.TrimPrefix(action, "rollback:"), "@", 2)
+	file, hostSpec := spec[0], spec[1]
+	commands, err := readRollbackCommands(file)
+	if err != nil {
+		log.Printf("✗ %v", err)
+		e.record("ROLLBACK %s failed: %v", file, err)
+		return
+	}
+
+	var targets []DeviceInfo
+	names := strings.Split(hostSpec, ",")
+	if hostSpec == "*" || hostSpec == "hit" {
+		names = hit
+	}
+	for _, name := range names {
+		if d, ok := e.devices[strings.ToUpper(strings.TrimSpace(name))]; ok {
+			targets = append(targets, d)
+		} else {
+			log.Printf("⚠ Rollback target %s is not a window target, skipped", name)
+		}
+	}
+	if len(targets) == 0 {
+		e.record("ROLLBACK %s: no targets", file)
+		return
+	}
+	var list []string
+	for _, d := range targets {
+		list = append(list, d.Hostname)
+	}
+
+	if e.config.RollbackDry || e.config.DryRun {
+		log.Printf("DRY-RUN rollback: would send %s (%d lines) to %s", file, len(commands), strings.Join(list, ", "))
+		e.record("DRY-RUN ROLLBACK %s (%d lines) to %s:\n    %s", file, len(commands), strings.Join(list, ", "), strings.Join(commands, "\n    "))
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "\n🚨 %s fired. Rollback set %s:\n", rule, file)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "    %s\n", c)
+	}
+	answer := promptLine(fmt.Sprintf("Type ROLLBACK to send it to %s: ", strings.Join(list, ", ")))
+	if answer != "ROLLBACK" {
+		log.Printf("Rollback %s not confirmed, skipped", file)
+		e.record("ROLLBACK %s to %s NOT CONFIRMED", file, strings.Join(list, ", "))
+		return
+	}
+
+	e.config.Changes.allow("rollback "+file, targets)
+	defer e.config.Changes.settle(targets)
+	for _, d := range targets {
+		client := newDeviceClient(d, e.config)
+		outputs, err := client.ExecuteConfig(commands)
+		if err != nil {
+			log.Printf("✗ Rollback %s on %s: %v", file, d.Hostname, err)
+			e.record("ROLLBACK %s on %s FAILED: %v", file, d.Hostname, err)
+			continue
+		}
+		// Outputs are keyed by line text, so a repeated line (exit, !) is
+		// counted and reported once, with every line number it is on
+		lineNumbers := make(map[string][]string)
+		var distinct []string
+		for i, c := range commands {
+			if lineNumbers[c] == nil {
+				distinct = append(distinct, c)
+			}
+			lineNumbers[c] = append(lineNumbers[c], strconv.Itoa(i+1))
+		}
+		rejected := 0
+		for _, c := range distinct {
+			if isCommandRejected(outputs[c]) {
+				rejected++
+				e.record("ROLLBACK %s on %s: line %s %q rejected: %s", file, d.Hostname,
+					strings.Join(lineNumbers[c], ", "), c, rejectionLine(outputs[c]))
+			}
+		}
+		log.Printf("✓ Rollback %s sent to %s (%d rejected lines)", file, d.Hostname, rejected)
+		e.record("ROLLBACK %s sent to %s, %d of %d distinct lines rejected", file, d.Hostname, rejected, len(distinct))
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// ROLE AND SITE ROLL-UP (ROLLUP_<ts>.log)
+// ============================================================================
+//
+// Status calls want one line per device role, not the per-device tables.
+// Every run rolls the validation results (connection, pings and the checks
+// that ran, see validation_export.go) up per device and then per role and
+// per site:
+//
+//   Core: 2/2 PASS | Aggregation: 5/6 PASS (1 WARN) | Access: 37/40 PASS (3 FAIL)
+//
+// A device is FAIL when any of its results failed, WARN when one needs a
+// look (partial ping, not collected, EEM fired, permissive policy, ...) and
+// PASS otherwise. The role is the inventory Role, else the Device_Type.
+// ROLLUP_<ts>.log has both tables and, below them, every device that did not
+// pass with the failing items and the report that has the details, so the
+// drill-down is one file away. The role line is also printed at the end of
+// the run.
+
+// rollupPass and rollupWarn sort the check statuses; anything else fails
+var (
+	rollupPass = map[string]bool{"OK": true, "PASS": true, "READY": true}
+	rollupWarn = map[string]bool{"WARN": true, "PARTIAL": true, "NOT_COLLECTED": true, "FIRED": true,
+		"PERMISSIVE": true, "UNEXPECTED": true, "LDP_ONLY": true, "EVENTS": true}
+)
+
+// rollupReports is the report with the details of each check (see
+// check_registry.go)
+var rollupReports = func() map[string]string {
+	reports := make(map[string]string)
+	for _, c := range checkRegistry {
+		if c.Report != "" {
+			reports[c.Name] = c.Report
+		}
+	}
+	return reports
+}()
+
+// RollupDevice is the overall status of one device
+type RollupDevice struct {
+	Hostname string
+	Role     string
+	Site     string
+	Status   string // PASS, WARN, FAIL
+	Issues   []ValidationResult
+}
+
+// RollupGroup counts the devices of one role or site
+type RollupGroup struct {
+	Name                      string
+	Devices, Pass, Warn, Fail int
+}
+
+func rollupStatus(status string) string {
+	switch {
+	case rollupPass[status]:
+		return "PASS"
+	case rollupWarn[status]:
+		return "WARN"
+	}
+	return "FAIL"
+}
+
+// deviceRole is the inventory role of a device, else its device type
+func deviceRole(d DeviceInfo) string {
+	switch {
+	case d.Role != "":
+		return d.Role
+	case d.DeviceType != "":
+		return d.DeviceType
+	}
+	return "no role"
+}
+
+// buildRollup judges every device of the validation set
+func buildRollup(v *validationSet) []RollupDevice {
+	byHost := make(map[string]*RollupDevice)
+	var hosts []string
+	for _, res := range v.rows {
+		rd, ok := byHost[res.Hostname]
+		if !ok {
+			d := v.devices[res.Hostname]
+			rd = &RollupDevice{Hostname: res.Hostname, Role: deviceRole(d), Site: d.Site, Status: "PASS"}
+			byHost[res.Hostname] = rd
+			hosts = append(hosts, res.Hostname)
+		}
+		s := rollupStatus(res.Status)
+		if s == "PASS" {
+			continue
+		}
+		rd.Issues = append(rd.Issues, res)
+		if s == "FAIL" || rd.Status == "PASS" {
+			rd.Status = s
+		}
+	}
+	sort.Strings(hosts)
+	devices := make([]RollupDevice, 0, len(hosts))
+	for _, h := range hosts {
+		devices = append(devices, *byHost[h])
+	}
+	return devices
+}
+
+// groupRollup counts the devices per key, groups in name order
+func groupRollup(devices []RollupDevice, key func(RollupDevice) string) []RollupGroup {
+	byName := make(map[string]*RollupGroup)
+	var names []string
+	for _, d := range devices {
+		name := key(d)
+		g, ok := byName[name]
+		if !ok {
+			g = &RollupGroup{Name: name}
+			byName[name] = g
+			names = append(names, name)
+		}
+		g.Devices++
+		switch d.Status {
+		case "PASS":
+			g.Pass++
+		case "WARN":
+			g.Warn++
+		default:
+			g.Fail++
+		}
+	}
+	sort.Strings(names)
+	groups := make([]RollupGroup, 0, len(names))
+	for _, n := range names {
+		groups = append(groups, *byName[n])
+	}
+	return groups
+}
+
+func rollupByRole(devices []RollupDevice) []RollupGroup {
+	return groupRollup(devices, func(d RollupDevice) string { return d.Role })
+}
+
+func rollupBySite(devices []RollupDevice) []RollupGroup {
+	return groupRollup(devices, func(d RollupDevice) string {
+		if d.Site == "" {
+			return "no site"
+		}
+		return d.Site
+	})
+}
+
+// String is the one-line form, "Core: 2/2 PASS (1 WARN)"
+func (g RollupGroup) String() string {
+	s := fmt.Sprintf("%s: %d/%d PASS", g.Name, g.Pass, g.Devices)
+	var extra []string
+	if g.Warn > 0 {
+		extra = append(extra, fmt.Sprintf("%d WARN", g.Warn))
+	}
+	if g.Fail > 0 {
+		extra = append(extra, fmt.Sprintf("%d FAIL", g.Fail))
+	}
+	if len(extra) > 0 {
+		s += " (" + strings.Join(extra, ", ") + ")"
+	}
+	return s
+}
+
+// rollupLine joins the groups into the status-call line
+func rollupLine(groups []RollupGroup) string {
+	parts := make([]string, len(groups))
+	for i, g := range groups {
+		parts[i] = g.String()
+	}
+	return strings.Join(parts, " | ")
+}
+
+// WriteRollup writes ROLLUP_<ts>.log
+func (w *OutputWriter) WriteRollup(devices []RollupDevice) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("ROLLUP_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	roles, sites := rollupByRole(devices), rollupBySite(devices)
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Role and Site Roll-up\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, " %s\n", rollupLine(roles))
+	fmt.Fprintf(file, "================================================================================\n\n")
+
+	for _, part := range []struct {
+		title  string
+		groups []RollupGroup
+	}{{"ROLE", roles}, {"SITE", sites}} {
+		table := newTextTable(part.title, "DEVICES", "PASS", "WARN", "FAIL", "STATUS").alignRight(1, 2, 3, 4)
+		for _, g := range part.groups {
+			status := "PASS"
+			switch {
+			case g.Fail > 0:
+				status = "FAIL"
+			case g.Warn > 0:
+				status = "WARN"
+			}
+			table.add("", g.Name, g.Devices, g.Pass, g.Warn, g.Fail, status)
+		}
+		table.write(file)
+		fmt.Fprintln(file)
+	}
+
+	fmt.Fprintf(file, "Devices not passing:\n\n")
+	table := newTextTable("HOSTNAME", "ROLE", "STATUS", "DEVICE LOG")
+	for _, d := range devices {
+		if d.Status == "PASS" {
+			continue
+		}
+		table.add(d.Site, displayHost(d.Hostname), d.Role, d.Status, fmt.Sprintf("%s_%s.log", d.Hostname, w.timestamp))
+		for _, res := range d.Issues {
+			item := strings.TrimSpace(res.Check + " " + res.Item)
+			detail := strings.TrimSpace(strings.Join([]string{res.Value, res.Detail}, " "))
+			if detail != "" {
+				item += ": " + detail
+			}
+			report := "device log"
+			if prefix, ok := rollupReports[res.Check]; ok {
+				report = prefix + w.timestamp + ".log"
+			}
+			table.note("    - %s %s -> %s", res.Status, item, report)
+		}
+	}
+	table.write(file)
+	return nil
+}
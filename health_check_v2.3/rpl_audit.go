@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// ROUTE-POLICY AUDIT - BGP neighbor and VRF import/export attach points
+// ============================================================================
+
+// PolicyIntent is one expected policy attachment from the design
+type PolicyIntent struct {
+	Hostname  string // "*" applies to every device
+	VRF       string
+	Attach    string // neighbor address, or "import"/"export" for VRF attach points
+	Direction string // in, out (neighbors); empty for VRF attach points
+	Policy    string
+}
+
+// PolicyFinding is the audit outcome for one attach point
+type PolicyFinding struct {
+	Hostname  string
+	VRF       string
+	Attach    string
+	Direction string
+	Actual    string
+	Expected  string
+	Status    string // OK, MISSING, PERMISSIVE, MISMATCH, NOT_CONFIGURED
+}
+
+// loadPolicyIntent reads hostname,vrf,attach,direction,policy rows
+func loadPolicyIntent(filename string) ([]PolicyIntent, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var intents []PolicyIntent
+	for _, r := range records {
+		if len(r) < 5 || strings.EqualFold(r[0], "hostname") {
+			continue
+		}
+		vrf := strings.TrimSpace(r[1])
+		if vrf == "" {
+			vrf = "default"
+		}
+		intents = append(intents, PolicyIntent{
+			Hostname:  strings.TrimSpace(r[0]),
+			VRF:       vrf,
+			Attach:    strings.TrimSpace(r[2]),
+			Direction: strings.ToLower(strings.TrimSpace(r[3])),
+			Policy:    strings.TrimSpace(r[4]),
+		})
+	}
+	return intents, nil
+}
+
+// auditRoutePolicies checks every attach point in each device's running
+// config against the intent and flags missing or pass-all policies.
+func auditRoutePolicies(results []*DeviceResult, intents []PolicyIntent) []PolicyFinding {
+	var findings []PolicyFinding
+
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		var rc *RunningConfig
+		for _, e := range r.Results {
+			if isRunningConfig(e.Command) {
+				rc = parseRunningConfig(e.Output)
+				break
+			}
+		}
+		if rc == nil {
+			continue
+		}
+		host := r.Device.Hostname
+
+		// Host-specific rows override "*" rows; only host-specific rows
+		// are reported as NOT_CONFIGURED when the attach point is absent.
+		expected := make(map[string]string)
+		var explicit []string
+		for _, in := range intents {
+			if in.Hostname == "*" {
+				expected[in.VRF+"|"+in.Attach+"|"+in.Direction] = in.Policy
+			}
+		}
+		for _, in := range intents {
+			if strings.EqualFold(in.Hostname, host) {
+				key := in.VRF + "|" + in.Attach + "|" + in.Direction
+				expected[key] = in.Policy
+				explicit = append(explicit, key)
+			}
+		}
+		seen := make(map[string]bool)
+
+		check := func(vrf, attach, dir, actual string, requirePolicy bool) {
+			key := vrf + "|" + attach + "|" + dir
+			seen[key] = true
+			want := expected[key]
+			f := PolicyFinding{Hostname: host, VRF: vrf, Attach: attach, Direction: dir, Actual: actual, Expected: want, Status: "OK"}
+			switch {
+			case actual == "" && (want != "" || requirePolicy):
+				f.Status = "MISSING"
+			case actual == "":
+				return
+			case want != "" && actual != want:
+				f.Status = "MISMATCH"
+			case rc.isPermissivePolicy(actual) && want == "":
+				f.Status = "PERMISSIVE"
+			}
+			findings = append(findings, f)
+		}
+
+		for _, n := range rc.Neighbors {
+			ebgp := n.RemoteAS != "" && n.RemoteAS != rc.LocalAS
+			check(n.VRF, n.Address, "in", n.PolicyIn, ebgp)
+			check(n.VRF, n.Address, "out", n.PolicyOut, ebgp)
+		}
+		var vrfs []string
+		for v := range rc.VRFPolicies {
+			vrfs = append(vrfs, v)
+		}
+		sort.Strings(vrfs)
+		for _, v := range vrfs {
+			p := rc.VRFPolicies[v]
+			check(v, "import", "", p.Import, false)
+			check(v, "export", "", p.Export, false)
+		}
+
+		for _, key := range explicit {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			parts := strings.SplitN(key, "|", 3)
+			findings = append(findings, PolicyFinding{
+				Hostname: host, VRF: parts[0], Attach: parts[1], Direction: parts[2],
+				Expected: expected[key], Status: "NOT_CONFIGURED",
+			})
+		}
+	}
+	return findings
+}
+
+// WritePolicyAudit writes RPL_AUDIT_<ts>.log
+func (w *OutputWriter) WritePolicyAudit(findings []PolicyFinding) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("RPL_AUDIT_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	problems := 0
+	for _, f := range findings {
+		if f.Status != "OK" {
+			problems++
+		}
+	}
+
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Route-Policy Audit\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, "================================================================================\n\n")
+	fmt.Fprintf(file, " Attach points: %d | Problems: %d\n\n", len(findings), problems)
+
+	table := newTextTable("HOSTNAME", "VRF", "ATTACH", "DIR", "POLICY", "EXPECTED", "STATUS")
+	for _, f := range findings {
+		table.add(hostSite(f.Hostname), displayHost(f.Hostname), f.VRF, f.Attach, orDash(f.Direction),
+			orDash(f.Actual), orDash(f.Expected), f.Status)
+	}
+	table.write(file)
+	return nil
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// REPRODUCIBILITY BUNDLE - signed tar.gz of everything behind a run
+// ============================================================================
+
+const (
+	bundleManifest  = "MANIFEST.sha256"
+	bundleSignature = "MANIFEST.sig"
+	bundlePublicKey = "SIGNER.pub"
+)
+
+// createRunBundle packages inventory (without secrets), command files,
+// tool version, raw device logs and summaries into <run>.tar.gz, with a
+// SHA-256 manifest signed by the ed25519 key at config.BundleKey. Logs are
+// redacted like the audit transcript.
+func createRunBundle(config *Config, writer *OutputWriter, devices map[string]DeviceInfo) (string, error) {
+	priv, err := loadOrCreateBundleKey(config.BundleKey)
+	if err != nil {
+		return "", err
+	}
+
+	files := make(map[string][]byte)
+
+	// Inventory snapshot with proxy credentials and key passphrases stripped
+	redacted := make(map[string]DeviceInfo)
+	for k, d := range devices {
+		d.Proxy = redactProxy(d.Proxy)
+		if d.KeyPass != "" && !strings.HasPrefix(d.KeyPass, "env:") {
+			d.KeyPass = "REDACTED"
+		}
+		redacted[k] = d
+	}
+	data, err := inventoryJSON(redacted)
+	if err != nil {
+		return "", err
+	}
+	files["inventory.json"] = data
+
+	inputs := []string{config.TargetFile, config.NoiseFile}
+	for _, f := range []string{config.CommandFile, config.CommandFileXR, config.CommandFileXE, config.CommandFileL2} {
+		inputs = append(inputs, commandFileSources(f)...)
+	}
+	for _, f := range inputs {
+		name := filepath.ToSlash(filepath.Clean(f))
+		if filepath.IsAbs(f) || strings.HasPrefix(name, "../") {
+			name = filepath.Base(f)
+		}
+		if data, err := os.ReadFile(f); err == nil {
+			files["inputs/"+name] = data
+		}
+	}
+
+	var ver strings.Builder
+	fmt.Fprintf(&ver, "tool:       MERALCO Network Health Check Logger\n")
+	fmt.Fprintf(&ver, "version:    %s\n", Version)
+	fmt.Fprintf(&ver, "go:         %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&ver, "phase:      %s\n", writer.phase)
+	fmt.Fprintf(&ver, "run:        %s\n", writer.timestamp)
+	fmt.Fprintf(&ver, "created:    %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&ver, "args:       %s\n", strings.Join(redactArgs(os.Args[1:]), " "))
+	files["VERSION.txt"] = []byte(ver.String())
+
+	secrets := auditSecrets(config, devices)
+	entries, err := os.ReadDir(writer.dir)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(writer.dir, e.Name()))
+		if err != nil {
+			return "", err
+		}
+		// Device logs hold running-config output: communities, type 7
+		// passwords, key strings
+		if strings.HasSuffix(e.Name(), ".log") {
+			data = []byte(redactCredentials(string(data), secrets))
+		}
+		files["run/"+e.Name()] = data
+	}
+
+	bundlePath := filepath.Join(filepath.Dir(writer.dir), fmt.Sprintf("BUNDLE_%s_%s.tar.gz", writer.phase, writer.timestamp))
+	if err := writeSignedBundle(bundlePath, fmt.Sprintf("run_%s/", writer.timestamp), files, priv); err != nil {
+		return "", err
+	}
+	return bundlePath, nil
+}
+
+// writeSignedBundle writes files under prefix into a tar.gz with their
+// SHA-256 manifest, its ed25519 signature and the public key, in the layout
+// verifyRunBundle checks
+func writeSignedBundle(bundlePath, prefix string, files map[string][]byte, priv ed25519.PrivateKey) error {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var manifest strings.Builder
+	for _, name := range names {
+		sum := sha256.Sum256(files[name])
+		fmt.Fprintf(&manifest, "%s  %s\n", hex.EncodeToString(sum[:]), name)
+	}
+	files[bundleManifest] = []byte(manifest.String())
+	files[bundleSignature] = []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, files[bundleManifest])) + "\n")
+	files[bundlePublicKey] = []byte(base64.StdEncoding.EncodeToString(priv.Public().(ed25519.PublicKey)) + "\n")
+	names = append(names, bundleManifest, bundleSignature, bundlePublicKey)
+
+	out, err := os.Create(bundlePath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		hdr := &tar.Header{Name: prefix + name, Mode: 0644, Size: int64(len(files[name])), ModTime: time.Now()}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// verifyRunBundle checks every file hash against the manifest and the
+// manifest against its signature; it prints the signer fingerprint so an
+// auditor can compare it with the one published by the migration team.
+func verifyRunBundle(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	files := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		name := hdr.Name
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[i+1:]
+		}
+		files[name] = data
+	}
+
+	pub, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(files[bundlePublicKey])))
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("bundle has no valid %s", bundlePublicKey)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(files[bundleSignature])))
+	if err != nil {
+		return fmt.Errorf("bundle has no valid %s", bundleSignature)
+	}
+	if !ed25519.Verify(pub, files[bundleManifest], sig) {
+		return fmt.Errorf("manifest signature INVALID")
+	}
+
+	checked := 0
+	for _, line := range strings.Split(strings.TrimSpace(string(files[bundleManifest])), "\n") {
+		parts := strings.SplitN(line, "  ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		data, ok := files[parts[1]]
+		if !ok {
+			return fmt.Errorf("%s listed in manifest but missing", parts[1])
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != parts[0] {
+			return fmt.Errorf("%s hash mismatch", parts[1])
+		}
+		checked++
+	}
+
+	fp := sha256.Sum256(pub)
+	log.Printf("✓ Bundle verified: %d files, signer fingerprint SHA256:%s", checked, base64.RawStdEncoding.EncodeToString(fp[:]))
+	return nil
+}
+
+// loadOrCreateBundleKey reads a base64 ed25519 seed, generating one (0600)
+// plus a .pub file on first use.
+func loadOrCreateBundleKey(path string) (ed25519.PrivateKey, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid bundle signing key %s", path)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(priv.Seed())+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("cannot save bundle signing key: %v", err)
+	}
+	os.WriteFile(path+".pub", []byte(base64.StdEncoding.EncodeToString(pub)+"\n"), 0644)
+	log.Printf("Generated bundle signing key %s (public key: %s.pub)", path, path)
+	return priv, nil
+}
+
+func redactProxy(spec string) string {
+	u, err := url.Parse(spec)
+	if err != nil || u.User == nil {
+		return spec
+	}
+	if _, hasPass := u.User.Password(); hasPass {
+		u.User = url.UserPassword(u.User.Username(), "REDACTED")
+	}
+	return u.String()
+}
+
+// redactArgs hides the value of password-carrying flags in the recorded command line
+func redactArgs(args []string) []string {
+	var out []string
+	pending := ""
+	for _, a := range args {
+		if pending != "" {
+			out = append(out, redactFlagValue(pending, a))
+			pending = ""
+			continue
+		}
+		if !strings.HasPrefix(a, "-") {
+			out = append(out, a)
+			continue
+		}
+		name := strings.TrimLeft(a, "-")
+		if i := strings.Index(name, "="); i >= 0 {
+			prefix := a[:strings.Index(a, "=")+1]
+			out = append(out, prefix+redactFlagValue(name[:i], name[i+1:]))
+			continue
+		}
+		if isSecretFlag(name) || name == "proxy" {
+			pending = name
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+func redactFlagValue(name, value string) string {
+	if name == "proxy" {
+		return redactProxy(value)
+	}
+	if !isSecretFlag(name) {
+		return value
+	}
+	// -snmp-auth sha:PASS keeps the protocol
+	if strings.HasPrefix(name, "snmp-") {
+		if proto, _, ok := strings.Cut(value, ":"); ok {
+			return proto + ":REDACTED"
+		}
+	}
+	return "REDACTED"
+}
+
+// isSecretFlag matches flags whose value is a password, community, token or
+// SNMPv3 key
+func isSecretFlag(name string) bool {
+	if name == "p" || name == "snmp-auth" || name == "snmp-priv" {
+		return true
+	}
+	for _, word := range []string{"password", "passphrase", "secret", "community", "token"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// RUN STORAGE BACKENDS (-store)
+// ============================================================================
+//
+// Every run is written to <output>/<phase>/<timestamp> on the machine that
+// ran it. With several field laptops in a migration, -store sends each
+// finished run to a central place as well:
+//
+//   -store /mnt/noc-share/health-check        copy the run directory there
+//   -store dir:/mnt/noc-share/health-check    (same, explicit)
+//   -store https://jumpbox:8443/api/runs      POST the run as a tar.gz to a
+//                                             health check started with -serve
+//
+// Several backends may be given, comma-separated. Copies keep the
+// <phase>/<timestamp> layout, so -compare, -baselines and PHASE@N selectors
+// work on the central directory as on the local one. The HTTP backend sends
+// -store-token (env:VAR accepted) as the bearer token; the receiving server
+// unpacks the run under its own -o and records the sender in SOURCE.txt.
+//
+// A failing backend is logged and does not fail the run; the local copy is
+// always kept. There is no SQLite backend: the tool is built from the Go
+// standard library alone, which has no SQLite driver, and the central
+// directory already serves -compare and the API.
+
+// runStore persists a finished run outside the local output directory
+type runStore interface {
+	String() string
+	store(runDir, phase, timestamp string) error
+}
+
+// dirStore copies runs below a (shared) directory
+type dirStore struct {
+	root string
+}
+
+func (s dirStore) String() string { return s.root }
+
+func (s dirStore) store(runDir, phase, timestamp string) error {
+	dest := filepath.Join(s.root, phase, timestamp)
+	return filepath.WalkDir(runDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(runDir, path)
+		target := filepath.Join(dest, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(target, data)
+	})
+}
+
+// httpStore pushes runs to another instance's POST /api/runs
+type httpStore struct {
+	url   string
+	token string
+}
+
+func (s httpStore) String() string { return s.url }
+
+func (s httpStore) store(runDir, phase, timestamp string) error {
+	var body bytes.Buffer
+	if err := tarRunDir(&body, runDir); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, &body)
+	if err != nil {
+		return err
+	}
+	source, _ := os.Hostname()
+	req.Header.Set("Content-Type", "application/gzip")
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("X-Run-Phase", phase)
+	req.Header.Set("X-Run-Timestamp", timestamp)
+	req.Header.Set("X-Run-Source", source)
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// parseRunStores reads the -store list
+func parseRunStores(spec, token string) ([]runStore, error) {
+	var stores []runStore
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		switch {
+		case item == "":
+		case strings.HasPrefix(item, "http://") || strings.HasPrefix(item, "https://"):
+			if resolveSecret(token) == "" {
+				return nil, fmt.Errorf("%s: -store-token is required for HTTP storage", item)
+			}
+			stores = append(stores, httpStore{item, resolveSecret(token)})
+		case strings.HasPrefix(item, "sqlite:"):
+			return nil, fmt.Errorf("%s: SQLite storage is not available in this build, use a directory or the HTTP API", item)
+		default:
+			root := strings.TrimPrefix(item, "dir:")
+			if err := os.MkdirAll(root, 0755); err != nil {
+				return nil, fmt.Errorf("%s: %v", item, err)
+			}
+			stores = append(stores, dirStore{root})
+		}
+	}
+	return stores, nil
+}
+
+// storeRun hands a finished run to every configured backend
+func storeRun(config *Config, writer *OutputWriter) {
+	for _, s := range config.Stores {
+		start := time.Now()
+		if err := s.store(writer.dir, writer.phase, writer.timestamp); err != nil {
+			log.Printf("✗ Store %s: %v (the run is kept locally in %s)", s, err, writer.dir)
+			continue
+		}
+		log.Printf("✓ Run stored to %s (%s)", s, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// tarRunDir writes the regular files of a run directory as a tar.gz
+func tarRunDir(w io.Writer, runDir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := filepath.WalkDir(runDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".") {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(runDir, path)
+		hdr := &tar.Header{Name: filepath.ToSlash(rel), Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ----------------------------------------------------------------------------
+// Receiving side: POST /api/runs
+// ----------------------------------------------------------------------------
+
+const maxPushedRun = 512 << 20
+
+var runTimestampRe = regexp.MustCompile(`^\d{8}_\d{6}$`)
+
+// handleRuns unpacks a run pushed by another instance's -store
+func (s *apiServer) handleRuns(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	phase, ts := r.Header.Get("X-Run-Phase"), r.Header.Get("X-Run-Timestamp")
+	source := r.Header.Get("X-Run-Source")
+	if !apiHostRe.MatchString(phase) || !runTimestampRe.MatchString(ts) {
+		apiError(w, http.StatusBadRequest, "X-Run-Phase and X-Run-Timestamp (YYYYMMDD_HHMMSS) headers required")
+		return
+	}
+	dest := filepath.Join(s.config.OutputDir, phase, ts)
+	if _, err := os.Stat(dest); err == nil {
+		apiError(w, http.StatusConflict, fmt.Sprintf("run %s/%s already exists", phase, ts))
+		return
+	}
+
+	tmp := filepath.Join(s.config.OutputDir, phase, "."+ts+".upload")
+	os.RemoveAll(tmp)
+	if err := untarRun(http.MaxBytesReader(w, r.Body, maxPushedRun), tmp); err != nil {
+		os.RemoveAll(tmp)
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	note := fmt.Sprintf("source:   %s\nremote:   %s\nreceived: %s\n", source, r.RemoteAddr, time.Now().Format(time.RFC3339))
+	err := os.WriteFile(filepath.Join(tmp, "SOURCE.txt"), []byte(note), 0644)
+	if err == nil {
+		err = os.Rename(tmp, dest)
+	}
+	if err != nil {
+		os.RemoveAll(tmp)
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("API: stored run %s/%s from %s", phase, ts, orDash(source))
+	writeJSON(w, http.StatusCreated, apiRun{Phase: phase, Timestamp: ts, Path: phase + "/" + ts + "/"})
+}
+
+// untarRun extracts regular files of a pushed run below dir
+func untarRun(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("invalid tar.gz: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	files := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar.gz: %v", err)
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if hdr.Typeflag != tar.TypeReg || filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			continue
+		}
+		target := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		files++
+	}
+	if files == 0 {
+		return fmt.Errorf("the archive has no files")
+	}
+	return nil
+}
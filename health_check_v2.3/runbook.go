@@ -0,0 +1,516 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// MIGRATION RUNBOOK (-runbook)
+// ============================================================================
+//
+// A runbook is an ordered list of steps in YAML (see yaml_subset.go):
+//
+//   name: UPE1 to UPE21 cutover
+//   abort_on_fail: true
+//   steps:
+//     - name: pre
+//       type: collect               # health check run; phase defaults to the name
+//     - name: drain
+//       type: config                # send commands to devices
+//       device: UPE1
+//       commands: [interface TenGigE0/0/0/1, shutdown, commit, end]
+//     - name: drained
+//       type: wait                  # poll a command until its output matches
+//       device: UPE1
+//       command: show interfaces TenGigE0/0/0/1 | include rate
+//       until_rate_below: 100kbps   # every input/output rate in the output
+//       interval: 30s
+//       timeout: 10m
+//     - name: cabling
+//       type: pause                 # operator types "continue"
+//       message: Move the uplinks to UPE21
+//     - name: post
+//       type: collect
+//     - name: verdict
+//       type: compare               # fail on DEGRADED or MISSING metrics
+//       baseline: pre
+//       against: post
+//       tolerance: 10
+//
+// A wait step polls until its output matches the until regex, or until
+// every rate line in it (any platform, unit or load interval, see
+// interface_parser.go) is below until_rate_below: bits (64000, 64kbps,
+// 1.5Mbps) or packets (10pps) per second. Given both, both must hold. A
+// wait step with neither uses the drain_rate of the -thresholds file.
+//
+// Commands may use the platform placeholders of command_template.go
+// ({count}, {commit}) so one step serves IOS-XR and IOS-XE devices alike.
+// Every step may set timeout and continue_on_fail. Progress is written after
+// each step to <runbook>.state; running the same runbook again resumes at the
+// first step that has not completed (-runbook-reset starts over).
+
+// RunbookStep is one step of a runbook
+type RunbookStep struct {
+	Name           string
+	Type           string // collect, config, wait, pause, compare
+	Devices        []string
+	Commands       []string
+	Command        string
+	Until          *regexp.Regexp
+	RateBelow      *rateLimit
+	Interval       time.Duration
+	Timeout        time.Duration
+	Phase          string
+	Baseline       string
+	Against        string
+	Tolerance      float64
+	Message        string
+	ContinueOnFail bool
+}
+
+// Runbook is a parsed runbook file
+type Runbook struct {
+	Name        string
+	Path        string
+	Hash        string
+	AbortOnFail bool
+	Steps       []RunbookStep
+}
+
+// runbookStepState is the recorded outcome of one step
+type runbookStepState struct {
+	Status   string    `json:"status"` // done, failed
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Detail   string    `json:"detail,omitempty"`
+	RunDir   string    `json:"run_dir,omitempty"`
+}
+
+// runbookState is the resumable state file
+type runbookState struct {
+	Runbook string                       `json:"runbook"`
+	Hash    string                       `json:"hash"`
+	Steps   map[string]*runbookStepState `json:"steps"`
+}
+
+// loadRunbook parses and validates a runbook file
+func loadRunbook(path string, config *Config) (*Runbook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseYAML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	top, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: expected name, abort_on_fail and steps at the top level", path)
+	}
+	sum := sha256.Sum256(data)
+	rb := &Runbook{Path: path, Hash: hex.EncodeToString(sum[:])}
+	if rb.Name, err = yamlString(top, "name"); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if rb.AbortOnFail, err = yamlBool(top, "abort_on_fail", true); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	steps, ok := top["steps"].([]interface{})
+	if !ok || len(steps) == 0 {
+		return nil, fmt.Errorf("%s: no steps", path)
+	}
+
+	seen := make(map[string]bool)
+	for i, raw := range steps {
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: step %d is not a map", path, i+1)
+		}
+		step, err := parseRunbookStep(m, config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: step %d: %v", path, i+1, err)
+		}
+		if seen[step.Name] {
+			return nil, fmt.Errorf("%s: step name %q used twice", path, step.Name)
+		}
+		if (step.Baseline != "" && !seen[step.Baseline]) || (step.Against != "" && !seen[step.Against]) {
+			return nil, fmt.Errorf("%s: step %q compares steps that do not run before it", path, step.Name)
+		}
+		seen[step.Name] = true
+		rb.Steps = append(rb.Steps, step)
+	}
+	return rb, nil
+}
+
+func parseRunbookStep(m map[string]interface{}, config *Config) (RunbookStep, error) {
+	var s RunbookStep
+	var err error
+	str := func(key string) string {
+		if err != nil {
+			return ""
+		}
+		var v string
+		v, err = yamlString(m, key)
+		return v
+	}
+	dur := func(key string, def time.Duration) time.Duration {
+		v := str(key)
+		if v == "" || err != nil {
+			return def
+		}
+		d, perr := time.ParseDuration(v)
+		if perr != nil {
+			err = fmt.Errorf("%s: %v", key, perr)
+		}
+		return d
+	}
+
+	s.Name, s.Type = str("name"), str("type")
+	s.Command, s.Phase, s.Message = str("command"), str("phase"), str("message")
+	s.Baseline, s.Against = str("baseline"), str("against")
+	until, rateBelow := str("until"), str("until_rate_below")
+	tolerance := str("tolerance")
+	s.Interval = dur("interval", 30*time.Second)
+	s.Timeout = dur("timeout", 0)
+	if err != nil {
+		return s, err
+	}
+	if s.Devices, err = yamlStrings(m, "devices"); err != nil {
+		return s, err
+	}
+	if d := str("device"); d != "" {
+		s.Devices = append(s.Devices, d)
+	}
+	if s.Commands, err = yamlStrings(m, "commands"); err != nil {
+		return s, err
+	}
+	if s.ContinueOnFail, err = yamlBool(m, "continue_on_fail", false); err != nil {
+		return s, err
+	}
+	for _, c := range append([]string{s.Command}, s.Commands...) {
+		if err := checkCommandTemplate(c); err != nil {
+			return s, err
+		}
+	}
+
+	if s.Name == "" {
+		return s, fmt.Errorf("missing name")
+	}
+	switch s.Type {
+	case "collect":
+		if s.Phase == "" {
+			s.Phase = s.Name
+		}
+	case "config":
+		if len(s.Devices) == 0 || len(s.Commands) == 0 {
+			return s, fmt.Errorf("config step %q needs device(s) and commands", s.Name)
+		}
+	case "wait":
+		if until == "" && rateBelow == "" && config.Limits != nil && config.Limits.Drain != nil {
+			s.RateBelow = config.Limits.Drain
+		}
+		if len(s.Devices) == 0 || s.Command == "" || (until == "" && rateBelow == "" && s.RateBelow == nil) {
+			return s, fmt.Errorf("wait step %q needs device(s), command and until or until_rate_below", s.Name)
+		}
+		if until != "" {
+			if s.Until, err = regexp.Compile(until); err != nil {
+				return s, fmt.Errorf("until: %v", err)
+			}
+		}
+		if rateBelow != "" {
+			if s.RateBelow, err = parseRateLimit(rateBelow); err != nil {
+				return s, fmt.Errorf("until_rate_below: %v", err)
+			}
+		}
+		if s.Timeout == 0 {
+			s.Timeout = 15 * time.Minute
+		}
+	case "pause":
+		if s.Message == "" {
+			s.Message = "Continue with the runbook?"
+		}
+	case "compare":
+		if s.Baseline == "" || s.Against == "" {
+			return s, fmt.Errorf("compare step %q needs baseline and against", s.Name)
+		}
+		s.Tolerance = config.GoldenTol
+		if tolerance != "" {
+			if s.Tolerance, err = strconv.ParseFloat(strings.TrimSuffix(tolerance, "%"), 64); err != nil {
+				return s, fmt.Errorf("tolerance: %v", err)
+			}
+		}
+	default:
+		return s, fmt.Errorf("step %q: unknown type %q (collect, config, wait, pause, compare)", s.Name, s.Type)
+	}
+	return s, nil
+}
+
+// waitMet reports whether a wait step's output meets its condition
+func (s RunbookStep) waitMet(output string) bool {
+	if s.Until != nil && !s.Until.MatchString(output) {
+		return false
+	}
+	return s.RateBelow == nil || s.RateBelow.below(output)
+}
+
+// waitCondition describes what a wait step waits for
+func (s RunbookStep) waitCondition() string {
+	var parts []string
+	if s.Until != nil {
+		parts = append(parts, fmt.Sprintf("%q", s.Until))
+	}
+	if s.RateBelow != nil {
+		parts = append(parts, "rates below "+s.RateBelow.Spec)
+	}
+	return strings.Join(parts, " and ")
+}
+
+func runbookStatePath(path string) string {
+	return path + ".state"
+}
+
+// loadRunbookState returns the saved progress, or a fresh state
+func loadRunbookState(rb *Runbook, reset bool) (*runbookState, error) {
+	fresh := &runbookState{Runbook: rb.Path, Hash: rb.Hash, Steps: make(map[string]*runbookStepState)}
+	data, err := os.ReadFile(runbookStatePath(rb.Path))
+	if err != nil || reset {
+		return fresh, nil
+	}
+	var st runbookState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("%s: %v", runbookStatePath(rb.Path), err)
+	}
+	if st.Hash != rb.Hash {
+		return nil, fmt.Errorf("%s changed since %s was written; use -runbook-reset to start over",
+			rb.Path, runbookStatePath(rb.Path))
+	}
+	if st.Steps == nil {
+		st.Steps = make(map[string]*runbookStepState)
+	}
+	return &st, nil
+}
+
+// save writes the state file; an interrupted run never leaves half of it
+func (st *runbookState) save(rb *Runbook) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(runbookStatePath(rb.Path), data)
+}
+
+// runRunbook executes the runbook from the first step not yet done
+func runRunbook(config *Config, devices map[string]DeviceInfo, targets []DeviceInfo, commands *CommandSet) error {
+	rb, err := loadRunbook(config.Runbook, config)
+	if err != nil {
+		return err
+	}
+	st, err := loadRunbookState(rb, config.RunbookReset)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("RUNBOOK: %s (%d steps, abort on fail: %v)", orDash(rb.Name), len(rb.Steps), rb.AbortOnFail)
+	config.Changes = newChangeWatcher(config, targets)
+	config.Changes.start()
+	defer config.Changes.close()
+	failed := 0
+	for i, step := range rb.Steps {
+		prefix := fmt.Sprintf("[%d/%d] %s (%s)", i+1, len(rb.Steps), step.Name, step.Type)
+		if config.Stop.stopping() {
+			return fmt.Errorf("runbook stopped before step %q (run again to resume there)", step.Name)
+		}
+		if prev := st.Steps[step.Name]; prev != nil && prev.Status == "done" {
+			log.Printf("%s: done at %s, skipped", prefix, prev.Finished.Format("15:04:05"))
+			continue
+		}
+
+		log.Printf("▶ %s", prefix)
+		state := &runbookStepState{Started: time.Now()}
+		detail, runDir, err := runRunbookStep(config, step, devices, targets, commands, st)
+		state.Finished, state.Detail, state.RunDir = time.Now(), detail, runDir
+		state.Status = "done"
+		if err != nil {
+			state.Status = "failed"
+			state.Detail = err.Error()
+		}
+		st.Steps[step.Name] = state
+		if serr := st.save(rb); serr != nil {
+			log.Printf("✗ Runbook state: %v", serr)
+		}
+
+		if err == nil {
+			log.Printf("✓ %s: %s", prefix, orDash(detail))
+			if step.Type == "wait" {
+				config.Notify.notify(Alert{Event: "drain-complete", Severity: "info", Check: "runbook step " + step.Name,
+					Details: []string{fmt.Sprintf("%s on %s: %s", step.waitCondition(), strings.Join(step.Devices, ", "), detail)}})
+			}
+			continue
+		}
+		failed++
+		log.Printf("✗ %s: %v", prefix, err)
+		config.Notify.notify(Alert{Event: "fail", Severity: "critical", Check: "runbook step " + step.Name, Details: []string{err.Error()}})
+		if rb.AbortOnFail && !step.ContinueOnFail {
+			return fmt.Errorf("runbook stopped at step %q (fix and run again to resume there)", step.Name)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("runbook finished with %d failed steps (see %s)", failed, runbookStatePath(rb.Path))
+	}
+	log.Printf("✓ RUNBOOK COMPLETE: %s", orDash(rb.Name))
+	return nil
+}
+
+// runbookDevices resolves step device names against the inventory
+func runbookDevices(names []string, devices map[string]DeviceInfo) ([]DeviceInfo, error) {
+	var out []DeviceInfo
+	for _, n := range names {
+		d, ok := devices[strings.ToUpper(n)]
+		if !ok {
+			return nil, fmt.Errorf("%s not in inventory", n)
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// runRunbookStep executes one step and returns a detail line and run directory
+func runRunbookStep(config *Config, step RunbookStep, devices map[string]DeviceInfo, targets []DeviceInfo,
+	commands *CommandSet, st *runbookState) (string, string, error) {
+
+	devs, err := runbookDevices(step.Devices, devices)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch step.Type {
+	case "collect":
+		if len(devs) == 0 {
+			devs = targets
+		}
+		stepConfig := *config
+		if step.Timeout > 0 {
+			stepConfig.CmdTimeout = step.Timeout
+		}
+		writer, results := runCollection(&stepConfig, devs, commands, config.Phase+"-"+step.Phase)
+		failed := 0
+		for _, r := range results {
+			if !r.Success {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return "", writer.dir, fmt.Errorf("%d of %d devices failed (%s)", failed, len(results), writer.dir)
+		}
+		return fmt.Sprintf("%d devices collected in %s", len(results), writer.dir), writer.dir, nil
+
+	case "config":
+		if config.DryRun {
+			return fmt.Sprintf("DRY-RUN: would send %d lines to %d devices", len(step.Commands), len(devs)), "", nil
+		}
+		config.Changes.allow("runbook step "+step.Name, devs)
+		defer config.Changes.settle(devs)
+		for _, d := range devs {
+			client := newDeviceClient(d, config)
+			if step.Timeout > 0 {
+				client.cmdTimeout = step.Timeout
+			}
+			cmds := expandCommands(step.Commands, d)
+			outputs, err := client.ExecuteConfig(cmds)
+			if err != nil {
+				return "", "", fmt.Errorf("%s: %v", d.Hostname, err)
+			}
+			for _, c := range cmds {
+				if isCommandRejected(outputs[c]) {
+					return "", "", fmt.Errorf("%s rejected %q: %s", d.Hostname, c, rejectionLine(outputs[c]))
+				}
+			}
+		}
+		return fmt.Sprintf("%d lines sent to %d devices", len(step.Commands), len(devs)), "", nil
+
+	case "wait":
+		deadline := time.Now().Add(step.Timeout)
+		// A poll of a hung device must not outlast the step
+		ctx, cancel := context.WithDeadline(config.Stop.context(), deadline)
+		defer cancel()
+		for attempt := 1; ; attempt++ {
+			pending := 0
+			for _, d := range devs {
+				command := expandCommand(step.Command, d.DetectedOS)
+				outputs, err := newDeviceClient(d, config).ExecuteContext(ctx, []string{command})
+				if err != nil || !step.waitMet(outputs[command]) {
+					pending++
+				}
+			}
+			if pending == 0 {
+				return fmt.Sprintf("condition met after %d polls", attempt), "", nil
+			}
+			if time.Now().Add(step.Interval).After(deadline) {
+				return "", "", fmt.Errorf("%d of %d devices not meeting %s after %s", pending, len(devs), step.waitCondition(), step.Timeout)
+			}
+			log.Printf("   waiting for %s on %d devices (poll %d)", step.waitCondition(), pending, attempt)
+			if !config.Stop.sleep(step.Interval) {
+				return "", "", fmt.Errorf("%s after %d polls", interruptedMsg, attempt)
+			}
+		}
+
+	case "pause":
+		answers := make(chan string, 1)
+		go func() {
+			answers <- promptLine(fmt.Sprintf("\n⏸  %s\n   Type \"continue\" to proceed or \"abort\" to stop: ", step.Message))
+		}()
+		var timeout <-chan time.Time
+		if step.Timeout > 0 {
+			timeout = time.After(step.Timeout)
+		}
+		select {
+		case answer := <-answers:
+			if strings.TrimSpace(strings.ToLower(answer)) == "continue" {
+				return "operator confirmed", "", nil
+			}
+			return "", "", fmt.Errorf("operator answered %q", answer)
+		case <-timeout:
+			return "", "", fmt.Errorf("no operator confirmation within %s", step.Timeout)
+		}
+
+	case "compare":
+		base, against := st.Steps[step.Baseline], st.Steps[step.Against]
+		if base == nil || base.RunDir == "" || against == nil || against.RunDir == "" {
+			return "", "", fmt.Errorf("steps %q and %q must both have collected", step.Baseline, step.Against)
+		}
+		report := filepath.Join(against.RunDir, "COMPARISON_REPORT.txt")
+		if _, err := comparePhases(base.RunDir, against.RunDir, report, config.Bands); err != nil {
+			return "", "", err
+		}
+		before, err1 := loadGoldenCSV(findCSVFile(base.RunDir))
+		after, err2 := loadGoldenCSV(findCSVFile(against.RunDir))
+		if err1 != nil || err2 != nil {
+			return "", "", fmt.Errorf("cannot read the SUMMARY csv of %q or %q", step.Baseline, step.Against)
+		}
+		var bad []string
+		for _, f := range compareGolden(before, after, step.Tolerance) {
+			if f.Status == "DEGRADED" || f.Status == "MISSING" {
+				bad = append(bad, fmt.Sprintf("%s %s %s: %s -> %s", f.Host, f.Command, f.Metric, orDash(f.Golden), orDash(f.Actual)))
+			}
+		}
+		if len(bad) > 0 {
+			for _, b := range bad {
+				log.Printf("   ⚠ %s", b)
+			}
+			return "", "", fmt.Errorf("%d metrics degraded or missing (%s)", len(bad), report)
+		}
+		return "no degraded metrics, report " + report, "", nil
+	}
+	return "", "", fmt.Errorf("unknown step type %q", step.Type)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// SAMPLE SEQUENCE NUMBERS AND UTC TIMESTAMPS
+// ============================================================================
+//
+// During an incident review the ping-watch samples, monitor alerts and
+// validation results of several operators' laptops are merged into one
+// timeline. Local times to the second from machines in different zones do
+// not sort, and two samples in the same second tie. Every sample and result
+// therefore carries a stamp:
+//
+//   Seq       1, 2, 3, ... in the order this process took them
+//   Time_UTC  2026-01-23T01:03:42.123Z, never earlier than the previous one
+//   Source    the machine and process that took it, "noc-laptop-3/41877"
+//
+// Sorting merged records by Time_UTC, then Source, then Seq gives the same
+// order on every machine. The stamps are in PING_WATCH_<ts>.csv, the
+// VALIDATION exports, the command headers of the device logs ("Sampled:")
+// and the alert logs of MONITOR_<ts>.log, and in the webhook and hook
+// payloads (seq, time, source).
+
+const stampLayout = "2006-01-02T15:04:05.000Z"
+
+// sampleStamp orders one sample or result
+type sampleStamp struct {
+	Seq    uint64
+	At     time.Time
+	Source string
+}
+
+// sampleSource names this process in merged timelines
+var sampleSource = func() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s/%d", host, os.Getpid())
+}()
+
+var sampleClock struct {
+	sync.Mutex
+	seq  uint64
+	last time.Time
+}
+
+// newSampleStamp takes the next stamp; times never go backwards within the
+// process, even when the wall clock is stepped
+func newSampleStamp() sampleStamp {
+	sampleClock.Lock()
+	defer sampleClock.Unlock()
+	at := time.Now().UTC().Truncate(time.Millisecond)
+	if at.Before(sampleClock.last) {
+		at = sampleClock.last
+	}
+	sampleClock.seq++
+	sampleClock.last = at
+	return sampleStamp{Seq: sampleClock.seq, At: at, Source: sampleSource}
+}
+
+// resetSampleClock restarts the sequence (replays with fixed output)
+func resetSampleClock() {
+	sampleClock.Lock()
+	defer sampleClock.Unlock()
+	sampleClock.seq, sampleClock.last = 0, time.Time{}
+}
+
+func (s sampleStamp) IsZero() bool {
+	return s.Seq == 0
+}
+
+// UTC is the millisecond UTC time, "" for no stamp
+func (s sampleStamp) UTC() string {
+	if s.IsZero() {
+		return ""
+	}
+	return s.At.UTC().Format(stampLayout)
+}
+
+// SeqString is the sequence number, "" for no stamp
+func (s sampleStamp) SeqString() string {
+	if s.IsZero() {
+		return ""
+	}
+	return fmt.Sprint(s.Seq)
+}
+
+// String is the log form, "2026-01-23T01:03:42.123Z #42 noc-laptop-3/41877"
+func (s sampleStamp) String() string {
+	if s.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%s #%d %s", s.UTC(), s.Seq, s.Source)
+}
+
+// parseSampleStamp reads the String form back
+func parseSampleStamp(text string) (sampleStamp, bool) {
+	var utc string
+	var s sampleStamp
+	if n, _ := fmt.Sscanf(text, "%s #%d %s", &utc, &s.Seq, &s.Source); n < 2 || s.Seq == 0 {
+		return sampleStamp{}, false
+	}
+	at, err := time.Parse(stampLayout, utc)
+	if err != nil {
+		return sampleStamp{}, false
+	}
+	s.At = at
+	return s, true
+}
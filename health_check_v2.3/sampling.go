@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// WINDOW-MODE SAMPLING - ring buffers of snapshot metrics with evaluators
+// ============================================================================
+//
+// Every window-mode snapshot feeds its numeric metrics into per-series ring
+// buffers (host + command + metric). Monitors are declared, one per line, in
+// the -monitors file (the built-ins below apply when it is absent):
+//
+//   <name> <metric> <evaluator> <threshold> [samples]
+//
+//   stable  max-min over the samples must not exceed threshold
+//   rate    change per minute over the samples must not exceed threshold
+//   min     latest value must be at least threshold
+//   max     latest value must be at most threshold
+//
+// <metric> is a metric name (BGP_Neighbors_Established) or command_metric
+// ("show mpls ldp neighbor brief_LDP_Neighbors") from the summary CSV, so a
+// new monitor needs only a command in the command file and a line here.
+
+const defaultMonitorSamples = 10
+
+var defaultMonitors = []string{
+	"bgp-established BGP_Neighbors_Established stable 0",
+	"ospf-full OSPF_Neighbors_FULL stable 0",
+	"isis-up ISIS_Adjacencies_Up stable 0",
+	"ldp-neighbors LDP_Neighbors stable 0",
+	"bfd-down BFD_Sessions_Down max 0",
+	"crc-errors CRC_Errors_Total rate 10",
+	"input-errors Input_Errors_Total rate 100",
+}
+
+// MonitorSpec is one declared monitor
+type MonitorSpec struct {
+	Name      string
+	Metric    string
+	Eval      string // stable, rate, min, max
+	Threshold float64
+	Samples   int
+}
+
+// sample is one observation of a series; a gap marks a snapshot without
+// data (device not collected, session lost), never read as a zero
+type sample struct {
+	at    time.Time
+	value float64
+	gap   bool
+	stamp sampleStamp
+}
+
+// ringBuffer keeps the newest cap samples of a series
+type ringBuffer struct {
+	buf  []sample
+	next int
+	full bool
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	return &ringBuffer{buf: make([]sample, capacity)}
+}
+
+func (r *ringBuffer) add(s sample) {
+	r.buf[r.next] = s
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// samples returns the buffered samples, oldest first
+func (r *ringBuffer) samples() []sample {
+	if !r.full {
+		return append([]sample{}, r.buf[:r.next]...)
+	}
+	return append(append([]sample{}, r.buf[r.next:]...), r.buf[:r.next]...)
+}
+
+// parseMonitorSpecs reads the monitor declaration format
+func parseMonitorSpecs(source string, lines []string) ([]MonitorSpec, error) {
+	var specs []MonitorSpec
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		// the metric may contain spaces (command_metric); name, evaluator
+		// and threshold are single words at the ends
+		samples := defaultMonitorSamples
+		if len(f) >= 5 {
+			if n, err := strconv.Atoi(f[len(f)-1]); err == nil && isMonitorEval(f[len(f)-3]) {
+				samples, f = n, f[:len(f)-1]
+			}
+		}
+		if len(f) < 4 || !isMonitorEval(f[len(f)-2]) {
+			return nil, fmt.Errorf("%s:%d: expected <name> <metric> <stable|rate|min|max> <threshold> [samples]", source, i+1)
+		}
+		threshold, err := strconv.ParseFloat(f[len(f)-1], 64)
+		if err != nil || samples < 2 {
+			return nil, fmt.Errorf("%s:%d: bad threshold or sample count", source, i+1)
+		}
+		specs = append(specs, MonitorSpec{
+			Name:      f[0],
+			Metric:    strings.Join(f[1:len(f)-2], " "),
+			Eval:      f[len(f)-2],
+			Threshold: threshold,
+			Samples:   samples,
+		})
+	}
+	return specs, nil
+}
+
+func isMonitorEval(s string) bool {
+	return s == "stable" || s == "rate" || s == "min" || s == "max"
+}
+
+// loadMonitorSpecs reads path if it exists, else the built-in monitors
+func loadMonitorSpecs(path string) ([]MonitorSpec, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return parseMonitorSpecs("built-in", defaultMonitors)
+	}
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return parseMonitorSpecs(path, lines)
+}
+
+// matches reports whether a series (command, metric) belongs to the spec
+func (m MonitorSpec) matches(command, metric string) bool {
+	return m.Metric == metric || m.Metric == command+"_"+metric
+}
+
+// MonitorAlert is one monitor failing on one series
+type MonitorAlert struct {
+	Monitor string
+	Series  string
+	Detail  string
+	Stamp   sampleStamp
+}
+
+type monitorSeries struct {
+	spec    MonitorSpec
+	host    string
+	command string
+	key     string
+	ring    *ringBuffer
+	alerts  int
+	gaps    int
+}
+
+// sampler owns every series of a window-mode run
+type sampler struct {
+	specs   []MonitorSpec
+	series  map[string]*monitorSeries
+	order   []string
+	active  map[string]bool // series currently alerting, to log changes only
+	history []MonitorAlert
+}
+
+func newSampler(specs []MonitorSpec) *sampler {
+	return &sampler{specs: specs, series: make(map[string]*monitorSeries), active: make(map[string]bool)}
+}
+
+// add records one snapshot's numeric metrics. A device that was not
+// collected, or an output cut off by a lost session, adds a gap to the
+// series it feeds instead of the zeros its metrics would read as.
+func (s *sampler) add(at time.Time, results []*DeviceResult) {
+	for _, r := range results {
+		if !r.Success {
+			if n := s.gap(at, r.Device.Hostname, ""); n > 0 {
+				log.Printf("⚠ MONITOR: %s: not collected (%s), gap recorded in %d series", r.Device.Hostname, r.ErrorMessage, n)
+			}
+			continue
+		}
+		gaps := 0
+		for _, e := range r.Results {
+			if isIncompleteOutput(e.Output) {
+				gaps += s.gap(at, r.Device.Hostname, e.Command)
+				continue
+			}
+			for metric, value := range extractMetrics(e.Command, e.Output) {
+				v, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					continue
+				}
+				for _, spec := range s.specs {
+					if !spec.matches(e.Command, metric) {
+						continue
+					}
+					key := fmt.Sprintf("%s|%s|%s_%s", spec.Name, r.Device.Hostname, e.Command, metric)
+					ms, ok := s.series[key]
+					if !ok {
+						ms = &monitorSeries{spec: spec, host: r.Device.Hostname, command: e.Command, key: key, ring: newRingBuffer(spec.Samples)}
+						s.series[key] = ms
+						s.order = append(s.order, key)
+					}
+					stamp := e.Stamp
+					if stamp.IsZero() {
+						stamp = newSampleStamp()
+					}
+					ms.ring.add(sample{at: at, value: v, stamp: stamp})
+				}
+			}
+		}
+		if gaps > 0 {
+			log.Printf("⚠ MONITOR: %s: outputs incomplete (session lost), gap recorded in %d series", r.Device.Hostname, gaps)
+		}
+	}
+}
+
+// gap marks the series of host (and command, "" = all) as having no data
+// in the snapshot taken at at, and returns how many it marked
+func (s *sampler) gap(at time.Time, host, command string) int {
+	n := 0
+	for _, key := range s.order {
+		ms := s.series[key]
+		if ms.host != host || (command != "" && ms.command != command) {
+			continue
+		}
+		ms.ring.add(sample{at: at, gap: true, stamp: newSampleStamp()})
+		ms.gaps++
+		n++
+	}
+	return n
+}
+
+// evaluate runs every monitor, logs newly failing and recovered series, and
+// returns the current alerts.
+func (s *sampler) evaluate() []MonitorAlert {
+	var alerts []MonitorAlert
+	for _, key := range s.order {
+		ms := s.series[key]
+		samples := ms.ring.samples()
+		detail := evaluateSeries(ms.spec, samples)
+		series := strings.SplitN(key, "|", 2)[1]
+		if detail == "" {
+			if s.active[key] {
+				log.Printf("✓ MONITOR %s recovered: %s", ms.spec.Name, series)
+				delete(s.active, key)
+			}
+			continue
+		}
+		// The alert carries the stamp of the sample that raised it
+		a := MonitorAlert{Monitor: ms.spec.Name, Series: series, Detail: detail, Stamp: samples[len(samples)-1].stamp}
+		alerts = append(alerts, a)
+		ms.alerts++
+		if !s.active[key] {
+			log.Printf("⚠ MONITOR %s: %s: %s", ms.spec.Name, series, detail)
+			s.active[key] = true
+			s.history = append(s.history, a)
+		}
+	}
+	return alerts
+}
+
+// evaluateSeries returns why the samples fail the spec ("" = pass); gaps
+// are skipped
+func evaluateSeries(spec MonitorSpec, all []sample) string {
+	var samples []sample
+	for _, x := range all {
+		if !x.gap {
+			samples = append(samples, x)
+		}
+	}
+	if len(samples) == 0 {
+		return ""
+	}
+	last := samples[len(samples)-1].value
+	switch spec.Eval {
+	case "min":
+		if last < spec.Threshold {
+			return fmt.Sprintf("%g below minimum %g", last, spec.Threshold)
+		}
+	case "max":
+		if last > spec.Threshold {
+			return fmt.Sprintf("%g above maximum %g", last, spec.Threshold)
+		}
+	case "stable":
+		lo, hi := last, last
+		for _, x := range samples {
+			if x.value < lo {
+				lo = x.value
+			}
+			if x.value > hi {
+				hi = x.value
+			}
+		}
+		if hi-lo > spec.Threshold {
+			return fmt.Sprintf("varied %g..%g over %d samples", lo, hi, len(samples))
+		}
+	case "rate":
+		first := samples[0]
+		minutes := samples[len(samples)-1].at.Sub(first.at).Minutes()
+		if len(samples) < 2 || minutes <= 0 {
+			return ""
+		}
+		if rate := (last - first.value) / minutes; rate > spec.Threshold {
+			return fmt.Sprintf("rising %.1f/min (limit %g)", rate, spec.Threshold)
+		}
+	}
+	return ""
+}
+
+// WriteMonitorReport writes MONITOR_<ts>.log with every series and its samples
+func (w *OutputWriter) WriteMonitorReport(s *sampler) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("MONITOR_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Window Monitor Report\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, "================================================================================\n\n")
+	fmt.Fprintf(file, " Series: %d | Alerts raised: %d | Still alerting: %d\n\n", len(s.order), len(s.history), len(s.active))
+
+	keys := append([]string{}, s.order...)
+	sort.Strings(keys)
+	for _, key := range keys {
+		ms := s.series[key]
+		status := "OK"
+		if s.active[key] {
+			status = "ALERT"
+		} else if ms.alerts > 0 {
+			status = "RECOVERED"
+		}
+		var values []string
+		for _, x := range ms.ring.samples() {
+			if x.gap {
+				values = append(values, "gap")
+				continue
+			}
+			values = append(values, strconv.FormatFloat(x.value, 'f', -1, 64))
+		}
+		fmt.Fprintf(file, "%-10s %-18s %s\n", status, ms.spec.Name, strings.SplitN(key, "|", 2)[1])
+		gaps := ""
+		if ms.gaps > 0 {
+			gaps = fmt.Sprintf(" | without data: %d", ms.gaps)
+		}
+		fmt.Fprintf(file, "           %s %g | samples: %s%s\n", ms.spec.Eval, ms.spec.Threshold, strings.Join(values, " "), gaps)
+	}
+
+	if len(s.history) > 0 {
+		fmt.Fprintf(file, "\nAlert log:\n")
+		for _, a := range s.history {
+			fmt.Fprintf(file, "  %s  %-18s %s: %s\n", a.Stamp, a.Monitor, a.Series, a.Detail)
+		}
+	}
+	return nil
+}
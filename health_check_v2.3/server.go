@@ -0,0 +1,697 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// HTTP API (-serve)
+// ============================================================================
+//
+// Lets the NOC dashboard drive the toolkit without a shell on the jump box:
+//
+//   GET    /api/health                   liveness
+//   GET    /api/devices                  inventory
+//   POST   /api/devices                  add a device      {"hostname", "ip_address", "device_type", ...}
+//   GET    /api/devices/HOST             one device
+//   PUT    /api/devices/HOST             replace a device
+//   DELETE /api/devices/HOST             remove a device
+//   POST   /api/collect                  start a collection {"devices": [...], "phase": "PRE"}
+//   POST   /api/validate                 start a command validation {"devices": [...]}
+//   GET    /api/jobs, /api/jobs/ID       job status and results
+//   POST   /api/ping                     ping from a device {"device", "target", "vrf"}
+//   GET    /api/reports                  run directories under -o
+//   GET    /api/reports/PHASE/TS/FILE    a report file of a listed run
+//   POST   /api/runs                     receive a run pushed by -store (see run_store.go)
+//
+// Every request needs "Authorization: Bearer <token>" (-api-token, env:VAR
+// accepted). Inventory changes are written back to -hosts in its own format.
+// Collections and validations are queued and run one at a time, since they
+// share the session pool and output directory; a ping is refused with 409
+// while one is running rather than waiting behind it.
+
+// apiJob is a queued or finished collection or validation
+type apiJob struct {
+	ID       string            `json:"id"`
+	Kind     string            `json:"kind"`
+	Status   string            `json:"status"` // queued, running, done, failed
+	Phase    string            `json:"phase,omitempty"`
+	Devices  []string          `json:"devices"`
+	Queued   time.Time         `json:"queued"`
+	Started  *time.Time        `json:"started,omitempty"`
+	Finished *time.Time        `json:"finished,omitempty"`
+	RunDir   string            `json:"run_dir,omitempty"`
+	Report   string            `json:"report,omitempty"`
+	Error    string            `json:"error,omitempty"`
+	Results  []apiDeviceResult `json:"results,omitempty"`
+	Checks   []apiCheck        `json:"checks,omitempty"`
+}
+
+type apiDeviceResult struct {
+	Hostname string `json:"hostname"`
+	OS       string `json:"os"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+	Commands int    `json:"commands"`
+}
+
+type apiCheck struct {
+	OS       string            `json:"os"`
+	Device   string            `json:"device"`
+	Line     string            `json:"line"`
+	Status   string            `json:"status"`
+	Accepted []string          `json:"accepted,omitempty"`
+	Rejected map[string]string `json:"rejected,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+type apiServer struct {
+	config   *Config
+	commands *CommandSet
+	token    string
+
+	mu      sync.Mutex // guards devices and the inventory file
+	devices map[string]DeviceInfo
+
+	jobMu  sync.Mutex // guards jobs and nextID
+	jobs   map[string]*apiJob
+	nextID int
+
+	runMu sync.Mutex // held while a job talks to devices
+}
+
+var (
+	apiHostRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	apiVRFRe  = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+)
+
+// runServer serves the API until the listener fails
+func runServer(config *Config, devices map[string]DeviceInfo, commands *CommandSet) error {
+	token := resolveSecret(config.APIToken)
+	if token == "" {
+		return fmt.Errorf("-serve requires an API token (-api-token TOKEN or env:VAR)")
+	}
+	if _, err := parseRoleWorkers(config.RoleWorkers); err != nil {
+		return fmt.Errorf("-role-workers: %v", err)
+	}
+	s := &apiServer{config: config, commands: commands, token: token, devices: devices, jobs: make(map[string]*apiJob)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/health", s.handleHealth)
+	mux.HandleFunc("/api/devices", s.handleDevices)
+	mux.HandleFunc("/api/devices/", s.handleDevice)
+	mux.HandleFunc("/api/collect", s.handleCollect)
+	mux.HandleFunc("/api/validate", s.handleValidate)
+	mux.HandleFunc("/api/jobs", s.handleJobs)
+	mux.HandleFunc("/api/jobs/", s.handleJobs)
+	mux.HandleFunc("/api/ping", s.handlePing)
+	mux.HandleFunc("/api/reports", s.handleReports)
+	mux.HandleFunc("/api/runs", s.handleRuns)
+	mux.HandleFunc("/api/reports/", s.handleReportFile)
+
+	server := &http.Server{
+		Addr:              config.Serve,
+		Handler:           s.authenticate(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-config.Stop.Done()
+		server.Close()
+	}()
+	log.Printf("API listening on %s (inventory %s, output %s)", config.Serve, config.HostFile, config.OutputDir)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// authenticate checks the bearer token and logs each request
+func (s *apiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+			log.Printf("API %s %s from %s: unauthorized", r.Method, r.URL.Path, r.RemoteAddr)
+			apiError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		log.Printf("API %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func apiError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// readJSON decodes a request body, rejecting unknown fields
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON body: %v", err)
+	}
+	return nil
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	apiError(w, http.StatusMethodNotAllowed, r.Method+" not allowed")
+	return false
+}
+
+func (s *apiServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	s.mu.Lock()
+	n := len(s.devices)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "version": Version, "devices": n, "busy": s.busy()})
+}
+
+// busy reports whether a job currently holds the devices
+func (s *apiServer) busy() bool {
+	if s.runMu.TryLock() {
+		s.runMu.Unlock()
+		return false
+	}
+	return true
+}
+
+// ----------------------------------------------------------------------------
+// Devices
+// ----------------------------------------------------------------------------
+
+// apiDevice is the inventory record as served; the key passphrase is never returned
+func apiDevice(d DeviceInfo) map[string]string {
+	out := map[string]string{
+		"hostname":    d.Hostname,
+		"ip_address":  d.IPAddress,
+		"device_type": d.DeviceType,
+		"detected_os": d.DetectedOS,
+	}
+	for k, v := range map[string]string{"site": d.Site, "role": d.Role, "proxy": d.Proxy, "key_file": d.KeyFile, "alias": d.Alias,
+		"standby_ip": d.StandbyIP, "pair": d.Pair, "ssh_algorithms": d.SSHAlgos,
+		"transport": d.Transport} {
+		if v != "" {
+			out[k] = v
+		}
+	}
+	if d.KeyPass != "" {
+		out["key_passphrase"] = "(set)"
+	}
+	return out
+}
+
+func deviceFromRecord(rec inventoryRecord) (DeviceInfo, error) {
+	d := rec.device()
+	if err := validateDevice(d); err != nil {
+		return DeviceInfo{}, err
+	}
+	return d, nil
+}
+
+// saveDevices writes the inventory back; s.mu must be held
+func (s *apiServer) saveDevices() error {
+	if err := saveHostInventory(s.config.HostFile, s.devices); err != nil {
+		return fmt.Errorf("cannot save inventory %s: %v", s.config.HostFile, err)
+	}
+	setDisplayInventory(s.devices)
+	return nil
+}
+
+func (s *apiServer) handleDevices(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method == http.MethodGet {
+		list := []map[string]string{}
+		for _, d := range sortedDevices(s.devices) {
+			list = append(list, apiDevice(d))
+		}
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+
+	var rec inventoryRecord
+	if err := readJSON(w, r, &rec); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	d, err := deviceFromRecord(rec)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	key := strings.ToUpper(d.Hostname)
+	if _, exists := s.devices[key]; exists {
+		apiError(w, http.StatusConflict, d.Hostname+" already in inventory")
+		return
+	}
+	s.devices[key] = d
+	if err := s.saveDevices(); err != nil {
+		delete(s.devices, key)
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("API: added %s (%s) to %s", d.Hostname, d.IPAddress, s.config.HostFile)
+	writeJSON(w, http.StatusCreated, apiDevice(d))
+}
+
+func (s *apiServer) handleDevice(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+		return
+	}
+	host := strings.TrimPrefix(r.URL.Path, "/api/devices/")
+	key := strings.ToUpper(host)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, exists := s.devices[key]
+	if !exists {
+		apiError(w, http.StatusNotFound, host+" not in inventory")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, apiDevice(old))
+	case http.MethodPut:
+		var rec inventoryRecord
+		if err := readJSON(w, r, &rec); err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if rec.Hostname == "" {
+			rec.Hostname = old.Hostname
+		}
+		if !strings.EqualFold(rec.Hostname, old.Hostname) {
+			apiError(w, http.StatusBadRequest, "hostname cannot be changed; delete and add the device instead")
+			return
+		}
+		d, err := deviceFromRecord(rec)
+		if err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.devices[key] = d
+		if err := s.saveDevices(); err != nil {
+			s.devices[key] = old
+			apiError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		log.Printf("API: updated %s in %s", d.Hostname, s.config.HostFile)
+		writeJSON(w, http.StatusOK, apiDevice(d))
+	case http.MethodDelete:
+		delete(s.devices, key)
+		if err := s.saveDevices(); err != nil {
+			s.devices[key] = old
+			apiError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		log.Printf("API: removed %s from %s", old.Hostname, s.config.HostFile)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// lookupTargets resolves hostnames to inventory entries that can log in
+func (s *apiServer) lookupTargets(hosts []string) ([]DeviceInfo, error) {
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("devices is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var targets []DeviceInfo
+	for _, h := range hosts {
+		d, ok := s.devices[strings.ToUpper(h)]
+		if !ok {
+			return nil, fmt.Errorf("%s not in inventory", h)
+		}
+		if !hasSSHCredentials(s.config, d) {
+			return nil, fmt.Errorf("%s: no credentials available", d.Hostname)
+		}
+		targets = append(targets, d)
+	}
+	return targets, nil
+}
+
+// ----------------------------------------------------------------------------
+// Jobs
+// ----------------------------------------------------------------------------
+
+// startJob queues work that runs once no other job holds the devices and
+// returns the job as queued, for the 202 reply
+func (s *apiServer) startJob(kind, phase string, targets []DeviceInfo, work func(job *apiJob) error) apiJob {
+	s.jobMu.Lock()
+	s.nextID++
+	job := &apiJob{
+		ID:     fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), s.nextID),
+		Kind:   kind,
+		Status: "queued",
+		Phase:  phase,
+		Queued: time.Now(),
+	}
+	for _, d := range targets {
+		job.Devices = append(job.Devices, d.Hostname)
+	}
+	s.jobs[job.ID] = job
+	queued := *job // the goroutine below updates job under jobMu
+	s.jobMu.Unlock()
+
+	go func() {
+		s.runMu.Lock()
+		defer s.runMu.Unlock()
+		s.updateJob(job, func() {
+			now := time.Now()
+			job.Status, job.Started = "running", &now
+		})
+		log.Printf("API job %s: %s of %d devices started", job.ID, kind, len(targets))
+
+		// work fills the job's result fields on a private copy
+		result := *job
+		err := work(&result)
+		s.updateJob(job, func() {
+			now := time.Now()
+			job.RunDir, job.Report, job.Results, job.Checks = result.RunDir, result.Report, result.Results, result.Checks
+			job.Status, job.Finished = "done", &now
+			if err != nil {
+				job.Status, job.Error = "failed", err.Error()
+			}
+		})
+		log.Printf("API job %s: %s", job.ID, job.Status)
+	}()
+	return queued
+}
+
+func (s *apiServer) updateJob(job *apiJob, f func()) {
+	s.jobMu.Lock()
+	defer s.jobMu.Unlock()
+	f()
+}
+
+func (s *apiServer) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	s.jobMu.Lock()
+	defer s.jobMu.Unlock()
+
+	if id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/jobs"), "/"); id != "" {
+		job, ok := s.jobs[id]
+		if !ok {
+			apiError(w, http.StatusNotFound, "no job "+id)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+		return
+	}
+
+	list := []*apiJob{}
+	for _, job := range s.jobs {
+		list = append(list, job)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Queued.After(list[j].Queued) })
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *apiServer) handleCollect(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	var req struct {
+		Devices []string `json:"devices"`
+		Phase   string   `json:"phase"`
+	}
+	if err := readJSON(w, r, &req); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Phase == "" {
+		req.Phase = s.config.Phase
+	}
+	if !apiHostRe.MatchString(req.Phase) {
+		apiError(w, http.StatusBadRequest, fmt.Sprintf("invalid phase %q", req.Phase))
+		return
+	}
+	targets, err := s.lookupTargets(req.Devices)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job := s.startJob("collect", req.Phase, targets, func(job *apiJob) error {
+		writer, results := runCollection(s.config, targets, s.commands, job.Phase)
+		job.RunDir = writer.dir
+		failed := 0
+		for _, res := range results {
+			job.Results = append(job.Results, apiDeviceResult{
+				Hostname: res.Device.Hostname,
+				OS:       res.Device.DetectedOS,
+				Success:  res.Success,
+				Error:    res.ErrorMessage,
+				Commands: len(res.Results),
+			})
+			if !res.Success {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d devices failed", failed, len(results))
+		}
+		return nil
+	})
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *apiServer) handleValidate(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	var req struct {
+		Devices []string `json:"devices"`
+	}
+	if err := readJSON(w, r, &req); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	targets, err := s.lookupTargets(req.Devices)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job := s.startJob("validate", "", targets, func(job *apiJob) error {
+		results := validateCommands(s.config, targets, s.commands)
+		for _, v := range results {
+			for _, c := range v.Checks {
+				job.Checks = append(job.Checks, apiCheck{
+					OS:       v.OS,
+					Device:   v.Device.Hostname,
+					Line:     c.Line,
+					Status:   c.Status(),
+					Accepted: c.Accepted,
+					Rejected: c.Rejected,
+					Error:    c.Error,
+				})
+			}
+		}
+		report, bad, err := writeValidationReport(results, targets, s.config.OutputDir)
+		if err != nil {
+			return err
+		}
+		job.Report = report
+		if bad > 0 {
+			return fmt.Errorf("%d command lines unsupported or not checked", bad)
+		}
+		return nil
+	})
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// ----------------------------------------------------------------------------
+// Ping
+// ----------------------------------------------------------------------------
+
+func (s *apiServer) handlePing(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	var req struct {
+		Device string `json:"device"`
+		Target string `json:"target"`
+		VRF    string `json:"vrf"`
+	}
+	if err := readJSON(w, r, &req); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Only an address and a VRF name reach the device command line
+	if !isIPAddress(req.Target) {
+		apiError(w, http.StatusBadRequest, fmt.Sprintf("target must be an IP address, got %q", req.Target))
+		return
+	}
+	if req.VRF != "" && !apiVRFRe.MatchString(req.VRF) {
+		apiError(w, http.StatusBadRequest, fmt.Sprintf("invalid vrf %q", req.VRF))
+		return
+	}
+	targets, err := s.lookupTargets([]string{req.Device})
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	d := targets[0]
+
+	if !s.runMu.TryLock() {
+		apiError(w, http.StatusConflict, "a job is using the devices; retry when it has finished")
+		return
+	}
+	defer s.runMu.Unlock()
+
+	command := "ping " + req.Target
+	if req.VRF != "" {
+		command = fmt.Sprintf("ping vrf %s %s", req.VRF, req.Target)
+	}
+	outputs, err := newDeviceClient(d, s.config).ExecuteCommands([]string{command})
+	if err != nil {
+		apiError(w, http.StatusBadGateway, fmt.Sprintf("%s: %v", d.Hostname, err))
+		return
+	}
+	output := outputs[command]
+	p, ok := parsePingOutput(command, output)
+	if !ok {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": "no ping result in device output", "output": output})
+		return
+	}
+	p.Hostname = d.Hostname
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"device":      d.Hostname,
+		"command":     command,
+		"vrf":         p.VRF,
+		"target":      p.Target,
+		"sent":        p.Sent,
+		"received":    p.Received,
+		"success_pct": p.SuccessPct,
+		"loss_pct":    p.LossPct(),
+		"need_pct":    s.config.Ping.threshold(p),
+		"status":      s.config.Ping.status(p),
+		"rtt_ms":      map[string]float64{"min": p.MinMs, "avg": p.AvgMs, "max": p.MaxMs},
+		"attempts":    p.Attempts,
+		"output":      output,
+	})
+}
+
+// ----------------------------------------------------------------------------
+// Reports
+// ----------------------------------------------------------------------------
+
+type apiRun struct {
+	Phase     string   `json:"phase"`
+	Timestamp string   `json:"timestamp"`
+	Path      string   `json:"path"` // relative to /api/reports/
+	Files     []string `json:"files"`
+}
+
+// handleReports lists <output>/<phase>/<ts> run directories, newest first
+func (s *apiServer) handleReports(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	runs := []apiRun{}
+	phases, _ := os.ReadDir(s.config.OutputDir)
+	for _, p := range phases {
+		if !p.IsDir() {
+			continue
+		}
+		stamps, _ := os.ReadDir(filepath.Join(s.config.OutputDir, p.Name()))
+		for _, ts := range stamps {
+			if !ts.IsDir() || !isRunDir(p.Name(), ts.Name()) {
+				continue
+			}
+			files, _ := os.ReadDir(filepath.Join(s.config.OutputDir, p.Name(), ts.Name()))
+			run := apiRun{Phase: p.Name(), Timestamp: ts.Name(), Path: p.Name() + "/" + ts.Name() + "/"}
+			for _, f := range files {
+				if isReportFile(f) {
+					run.Files = append(run.Files, f.Name())
+				}
+			}
+			if len(run.Files) > 0 {
+				runs = append(runs, run)
+			}
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Timestamp > runs[j].Timestamp })
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// isRunDir reports whether PHASE/TS under -o is a collection run. Config
+// snapshots and audit transcripts share -o but are not reports.
+func isRunDir(phase, ts string) bool {
+	return apiHostRe.MatchString(phase) && phase != configDirName && phase != auditDirName &&
+		runTimestampRe.MatchString(ts)
+}
+
+// isReportFile reports whether a run directory entry is listed
+func isReportFile(f os.DirEntry) bool {
+	return f.Type().IsRegular() && !strings.HasPrefix(f.Name(), ".")
+}
+
+// handleReportFile serves one file that handleReports lists; anything else
+// under -o, and directory listings, are not found
+func (s *apiServer) handleReportFile(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/reports/"), "/")
+	if len(parts) != 3 || !isRunDir(parts[0], parts[1]) {
+		apiError(w, http.StatusNotFound, "no such report")
+		return
+	}
+	dir := filepath.Join(s.config.OutputDir, parts[0], parts[1])
+	files, _ := os.ReadDir(dir)
+	for _, f := range files {
+		if f.Name() != parts[2] || !isReportFile(f) {
+			continue
+		}
+		file, err := os.Open(filepath.Join(dir, f.Name()))
+		if err != nil {
+			apiError(w, http.StatusNotFound, "no such report")
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			apiError(w, http.StatusNotFound, "no such report")
+			return
+		}
+		http.ServeContent(w, r, f.Name(), info.ModTime(), file)
+		return
+	}
+	apiError(w, http.StatusNotFound, "no such report")
+}
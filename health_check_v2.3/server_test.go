@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Only the files of PHASE/TS run directories are served: not config
+// snapshots, audit transcripts, hidden uploads or directory listings
+func TestReportFiles(t *testing.T) {
+	dir := t.TempDir()
+	for path, data := range map[string]string{
+		"PRE/20260101_120000/PE1_20260101_120000.log":   "report",
+		"PRE/20260101_120000/.partial":                  "hidden",
+		"PRE/.20260101_130000.upload/PE1.log":           "upload",
+		"configs/PE1/PE1_20260101_120000.cfg":           "enable secret 5 x",
+		"configs/20260101_120000/PE1.cfg":               "enable secret 5 x",
+		"audit/20260101_120000/window.jsonl":            "transcript",
+		"audit/window.jsonl":                            "transcript",
+		"PRE/20260101_120000/sub/PE1_20260101_120000.x": "nested",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &apiServer{config: &Config{OutputDir: dir}}
+
+	rec := httptest.NewRecorder()
+	s.handleReports(rec, httptest.NewRequest(http.MethodGet, "/api/reports", nil))
+	var runs []apiRun
+	if err := json.Unmarshal(rec.Body.Bytes(), &runs); err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Path != "PRE/20260101_120000/" || len(runs[0].Files) != 1 || runs[0].Files[0] != "PE1_20260101_120000.log" {
+		t.Fatalf("listed %+v", runs)
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"PRE/20260101_120000/PE1_20260101_120000.log", http.StatusOK},
+		{"PRE/20260101_120000/", http.StatusNotFound},
+		{"PRE/", http.StatusNotFound},
+		{"PRE/20260101_120000/.partial", http.StatusNotFound},
+		{"PRE/20260101_120000/sub", http.StatusNotFound},
+		{"PRE/.20260101_130000.upload/PE1.log", http.StatusNotFound},
+		{"configs/PE1/PE1_20260101_120000.cfg", http.StatusNotFound},
+		{"configs/20260101_120000/PE1.cfg", http.StatusNotFound},
+		{"audit/20260101_120000/window.jsonl", http.StatusNotFound},
+		{"audit/window.jsonl", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		s.handleReportFile(rec, httptest.NewRequest(http.MethodGet, "/api/reports/"+tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.want)
+		}
+	}
+	rec = httptest.NewRecorder()
+	s.handleReportFile(rec, httptest.NewRequest(http.MethodGet, "/api/reports/PRE/20260101_120000/PE1_20260101_120000.log", nil))
+	if rec.Body.String() != "report" {
+		t.Errorf("served %q", rec.Body.String())
+	}
+}
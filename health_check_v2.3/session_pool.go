@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// PERSISTENT SESSION POOL (-persist)
+// ============================================================================
+//
+// Without -persist every command batch opens its own ssh login: the fallback
+// retries of a device and every window-mode snapshot log in again, which
+// floods the device AAA logs. With -persist each device keeps one
+// prompt-driven shell for the whole run:
+//
+//   - batches for a device queue on its session and run one at a time
+//   - ssh keepalives (ServerAliveInterval) end a session on a dead path
+//   - idle sessions get an empty line every -keepalive, which also keeps
+//     the device exec-timeout from logging them out between snapshots
+//   - a dead session is re-opened with exponential backoff before use
+//   - a session the device or AAA closes in the middle of a batch (idle or
+//     absolute timeout) is re-opened once and the commands that did not
+//     complete are run again; what still did not complete stays marked
+//     incomplete, and window mode records a gap for it instead of a sample
+
+const (
+	poolReconnectTries = 4
+	poolBackoffStart   = 2 * time.Second
+)
+
+// pooledSession is one device's long-lived shell; mu is its command queue
+type pooledSession struct {
+	mu       sync.Mutex
+	key      string
+	s        *expectSession
+	lastUsed time.Time
+}
+
+type sessionPool struct {
+	mu        sync.Mutex
+	sessions  map[string]*pooledSession
+	keepalive time.Duration
+	stop      chan struct{}
+}
+
+// newSessionPool starts the keepalive loop (keepalive <= 0 disables it)
+func newSessionPool(keepalive time.Duration) *sessionPool {
+	p := &sessionPool{sessions: make(map[string]*pooledSession), keepalive: keepalive, stop: make(chan struct{})}
+	if keepalive > 0 {
+		go p.keepaliveLoop()
+	}
+	return p
+}
+
+func (p *sessionPool) entry(key string) *pooledSession {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ps, ok := p.sessions[key]
+	if !ok {
+		ps = &pooledSession{key: key}
+		p.sessions[key] = ps
+	}
+	return ps
+}
+
+// execute runs a batch on the device's pooled session, (re)connecting as needed
+func (p *sessionPool) execute(c *SSHClient, sshArgs, commands []string) (map[string]string, error) {
+	ps := p.entry(fmt.Sprintf("%s@%s:%d", c.username, c.host, c.port))
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	overall := time.AfterFunc(c.cmdTimeout, func() { c.abort("timeout") })
+	defer overall.Stop()
+
+	// An idle session may have died since the last keepalive; probe it
+	if ps.s != nil && !ps.s.dead() {
+		c.attach(ps.s)
+		if _, err := ps.s.run("", 15*time.Second); err != nil {
+			log.Printf("↻ %s: pooled session lost (%v)", c.host, err)
+			ps.s.kill()
+			ps.s = nil
+		}
+	}
+	if ps.s == nil || ps.s.dead() {
+		s, err := p.connect(c, sshArgs)
+		if err != nil {
+			return nil, err
+		}
+		ps.s = s
+	}
+
+	ps.lastUsed = time.Now()
+	results, err := c.runExpect(ps.s, commands)
+	ps.lastUsed = time.Now()
+	if rest := sessionLostAt(commands, results); err == nil && len(rest) > 0 {
+		log.Printf("↻ %s: session closed by the device during the batch, logging in again for %d commands", c.host, len(rest))
+		ps.s = nil
+		s, cerr := p.connect(c, sshArgs)
+		if cerr != nil {
+			log.Printf("✗ %s: reconnect failed (%v); %d commands stay incomplete", c.host, cerr, len(rest))
+			return results, nil
+		}
+		ps.s = s
+		more, rerr := c.runExpect(s, rest)
+		ps.lastUsed = time.Now()
+		if rerr != nil {
+			return results, nil
+		}
+		for cmd, out := range more {
+			results[cmd] = out
+		}
+	}
+	return results, err
+}
+
+// sessionLostAt returns the commands of a batch from the one the session
+// closed under, nil when the batch was not cut off that way
+func sessionLostAt(commands []string, results map[string]string) []string {
+	for i, cmd := range commands {
+		if strings.HasSuffix(results[cmd], sessionClosedMarker) {
+			return commands[i:]
+		}
+	}
+	return nil
+}
+
+// connect opens a session, retrying with exponential backoff
+func (p *sessionPool) connect(c *SSHClient, sshArgs []string) (*expectSession, error) {
+	args := append([]string{"-o", "ServerAliveInterval=15", "-o", "ServerAliveCountMax=3"}, sshArgs...)
+	backoff := poolBackoffStart
+	var err error
+	for attempt := 1; attempt <= poolReconnectTries; attempt++ {
+		var s *expectSession
+		if s, err = c.openExpect(args); err == nil {
+			return s, nil
+		}
+		c.mu.Lock()
+		aborted := c.abortMsg
+		c.mu.Unlock()
+		if aborted != "" || attempt == poolReconnectTries {
+			break
+		}
+		log.Printf("↻ %s: connect attempt %d failed (%v), retrying in %s", c.host, attempt, err, backoff)
+		if !c.stop.sleep(backoff) {
+			return nil, fmt.Errorf("%s", interruptedMsg)
+		}
+		backoff *= 2
+	}
+	return nil, err
+}
+
+func (p *sessionPool) keepaliveLoop() {
+	ticker := time.NewTicker(p.keepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		p.mu.Lock()
+		var all []*pooledSession
+		for _, ps := range p.sessions {
+			all = append(all, ps)
+		}
+		p.mu.Unlock()
+
+		for _, ps := range all {
+			// Busy sessions are alive by definition
+			if !ps.mu.TryLock() {
+				continue
+			}
+			if ps.s != nil && !ps.s.dead() && time.Since(ps.lastUsed) >= p.keepalive {
+				ps.s.client = &SSHClient{}
+				if _, err := ps.s.run("", 15*time.Second); err != nil {
+					log.Printf("↻ %s: keepalive failed (%v), will reconnect on next use", ps.key, err)
+					ps.s.kill()
+					ps.s = nil
+				} else {
+					ps.lastUsed = time.Now()
+				}
+			}
+			ps.mu.Unlock()
+		}
+	}
+}
+
+// Close logs out of every pooled session
+func (p *sessionPool) Close() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ps := range p.sessions {
+		ps.mu.Lock()
+		if ps.s != nil {
+			ps.s.close()
+			ps.s = nil
+		}
+		ps.mu.Unlock()
+	}
+	log.Printf("Closed %d pooled sessions", len(p.sessions))
+}
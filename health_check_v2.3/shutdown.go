@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ============================================================================
+// GRACEFUL SHUTDOWN (Ctrl-C, SIGTERM)
+// ============================================================================
+//
+// Without a handler, Ctrl-C during a 20-snapshot window or a scheduled
+// collection killed the process mid-session: devices kept the vty lines
+// until their exec-timeout, the snapshot in flight was lost and no summary
+// was written. Once the run starts, the first SIGINT or SIGTERM instead:
+//
+//   - cancels the run context: window, schedule, exporter, runbook and
+//     ping-watch loops stop at their next wait, and workers start no new
+//     device
+//   - aborts every ssh session in flight (the devices fail as "interrupted")
+//   - lets the collection finish as usual, so the device logs, summaries,
+//     reports and the window comparison cover what was collected
+//   - logs out of the pooled sessions (-persist) and exits with status 130
+//
+// A second Ctrl-C exits at once. Ctrl-C is the normal end of a ping watch
+// and stops a packet capture early; both still write their reports, the
+// capture removes its config from the device, and both exit with status 0.
+
+const (
+	interruptedMsg  = "interrupted"
+	interruptedExit = 130 // 128 + SIGINT, as the shell reports it
+)
+
+// shutdown is the run context cancelled by the first SIGINT or SIGTERM;
+// every ssh session runs under it (SSHClient.ExecuteContext)
+type shutdown struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	signal os.Signal
+	normal bool // Ctrl-C is how the mode ends (ping watch, capture)
+}
+
+// newShutdown starts handling SIGINT and SIGTERM
+func newShutdown() *shutdown {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	s := &shutdown{ctx: ctx, cancel: cancel}
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s.stop(<-signals)
+		sig := <-signals
+		log.Printf("✗ %s again: exiting without waiting for the sessions", sig)
+		os.Exit(interruptedExit)
+	}()
+	return s
+}
+
+// stop cancels the run, which aborts the sessions in flight
+func (s *shutdown) stop(sig os.Signal) {
+	s.signal = sig
+	log.Printf("⚠ %s: stopping, aborting the ssh sessions and writing partial results (again to quit at once)", sig)
+	s.cancel(errors.New(interruptedMsg))
+}
+
+// context is the run context; never done without a handler
+func (s *shutdown) context() context.Context {
+	if s == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// Done is closed when the run is stopped; nil (never) without a handler
+func (s *shutdown) Done() <-chan struct{} {
+	if s == nil {
+		return nil
+	}
+	return s.ctx.Done()
+}
+
+// stopping reports whether the run was stopped
+func (s *shutdown) stopping() bool {
+	return s != nil && s.ctx.Err() != nil
+}
+
+// sleep waits d and returns false when the run was stopped meanwhile
+func (s *shutdown) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return !s.stopping()
+	}
+	return sleepContext(s.context(), d)
+}
+
+// stopIsNormal makes a stop end the run with status 0
+func (s *shutdown) stopIsNormal() {
+	if s != nil {
+		s.normal = true
+	}
+}
+
+// exit ends a stopped run with status 130 once its reports are written;
+// deferred in main before the pool, so the pooled sessions are closed first
+func (s *shutdown) exit() {
+	if !s.stopping() || s.normal {
+		return
+	}
+	log.Printf("Stopped by %s: partial results written", s.signal)
+	os.Exit(interruptedExit)
+}
@@ -0,0 +1,859 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// SNMP CLIENT (v2c and v3 USM over UDP, standard library only)
+// ============================================================================
+//
+// The minimum of SNMP that snmp_poll.go needs: GET and GETBULK table walks
+// over v2c (community) or v3 with the user-based security model (RFC 3414):
+//
+//   auth   md5 (HMAC-MD5-96), sha (HMAC-SHA-96), sha256 (HMAC-SHA-256-192)
+//   priv   des (CBC-DES, RFC 3414), aes (CFB-AES-128, RFC 3826)
+//
+// A v3 session first discovers the agent's engine ID, boots and time with
+// an unauthenticated request, then localizes the keys to that engine. From
+// then on a reply without a valid digest, or a response without encryption
+// when priv is configured, is dropped like a malformed datagram: it changes
+// no engine state and the request waits for the real reply. The agent sends
+// its USM reports (unknown user, wrong digest, decryption error)
+// unauthenticated, so one is only believed as the reason the request got no
+// answer: "authentication failed: ...", which is not retried. BER encoding
+// covers the types the polled MIBs use; a value of any other type is kept
+// as its raw bytes.
+
+const (
+	berInteger  = 0x02
+	berOctets   = 0x04
+	berNull     = 0x05
+	berOID      = 0x06
+	berSequence = 0x30
+
+	snmpIPAddress      = 0x40
+	snmpCounter32      = 0x41
+	snmpGauge32        = 0x42
+	snmpTimeTicks      = 0x43
+	snmpCounter64      = 0x46
+	snmpNoSuchObject   = 0x80
+	snmpNoSuchInstance = 0x81
+	snmpEndOfMibView   = 0x82
+
+	pduGet      = 0xa0
+	pduResponse = 0xa2
+	pduGetBulk  = 0xa5
+	pduReport   = 0xa8
+
+	snmpMaxMessage = 65507
+	snmpRetries    = 2
+)
+
+// snmpErrorStatus names the PDU error-status codes
+var snmpErrorStatus = []string{"noError", "tooBig", "noSuchName", "badValue", "readOnly", "genErr",
+	"noAccess", "wrongType", "wrongLength", "wrongEncoding", "wrongValue", "noCreation",
+	"inconsistentValue", "resourceUnavailable", "commitFailed", "undoFailed", "authorizationError",
+	"notWritable", "inconsistentName"}
+
+// usmReports are the usmStats counters an agent reports a refused v3
+// request with
+var usmReports = map[string]string{
+	"1.3.6.1.6.3.15.1.1.1.0": "unsupported security level",
+	"1.3.6.1.6.3.15.1.1.2.0": "not in time window",
+	"1.3.6.1.6.3.15.1.1.3.0": "authentication failed: unknown user name",
+	"1.3.6.1.6.3.15.1.1.4.0": "unknown engine ID",
+	"1.3.6.1.6.3.15.1.1.5.0": "authentication failed: wrong digest (auth password)",
+	"1.3.6.1.6.3.15.1.1.6.0": "authentication failed: decryption error (priv password)",
+}
+
+// snmpVarbind is one OID and its value as received
+type snmpVarbind struct {
+	OID   string
+	Type  byte
+	Value []byte
+}
+
+// missing reports a noSuchObject, noSuchInstance or endOfMibView value
+func (v snmpVarbind) missing() bool {
+	return v.Type == snmpNoSuchObject || v.Type == snmpNoSuchInstance || v.Type == snmpEndOfMibView
+}
+
+// uint reads an INTEGER, counter, gauge or timeticks value
+func (v snmpVarbind) uint() uint64 {
+	if v.Type == berInteger {
+		if n := berParseInt(v.Value); n > 0 {
+			return uint64(n)
+		}
+		return 0
+	}
+	var n uint64
+	for _, b := range v.Value {
+		n = n<<8 | uint64(b)
+	}
+	return n
+}
+
+// String is the value as text
+func (v snmpVarbind) String() string {
+	switch v.Type {
+	case berOctets:
+		return strings.TrimRight(string(v.Value), "\x00")
+	case berOID:
+		return berParseOID(v.Value)
+	case snmpIPAddress:
+		return net.IP(v.Value).String()
+	case berInteger:
+		return strconv.FormatInt(berParseInt(v.Value), 10)
+	case snmpCounter32, snmpGauge32, snmpTimeTicks, snmpCounter64:
+		return strconv.FormatUint(v.uint(), 10)
+	}
+	return fmt.Sprintf("%x", v.Value)
+}
+
+// snmpSession is one agent's UDP socket and, for v3, its engine state
+type snmpSession struct {
+	conf    *snmpConfig
+	conn    net.Conn
+	ctx     context.Context
+	timeout time.Duration
+	id      int32
+
+	engineID         []byte
+	boots, engTime   int64
+	discovered       time.Time
+	authKey, privKey []byte
+	salt             uint64
+}
+
+// dialSNMP opens the socket and, for v3, discovers the engine
+func dialSNMP(ctx context.Context, conf *snmpConfig, host string, timeout time.Duration) (*snmpSession, error) {
+	conn, err := net.Dial("udp", net.JoinHostPort(host, strconv.Itoa(conf.port)))
+	if err != nil {
+		return nil, err
+	}
+	var seed [4]byte
+	rand.Read(seed[:])
+	s := &snmpSession{conf: conf, conn: conn, ctx: ctx, timeout: timeout,
+		id: int32(binary.BigEndian.Uint32(seed[:]) & 0x3fffffff)}
+	if conf.version == "3" {
+		if err := s.discover(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *snmpSession) close() {
+	s.conn.Close()
+}
+
+// get reads single instances; absent ones come back as missing()
+func (s *snmpSession) get(oids ...string) ([]snmpVarbind, error) {
+	return s.request(pduGet, oids, 0, 0)
+}
+
+// walk reads the columns of a table, by column and row index; GETBULK
+// fetches all of them side by side
+func (s *snmpSession) walk(columns ...string) (map[string]map[string]snmpVarbind, error) {
+	table := make(map[string]map[string]snmpVarbind)
+	next := make(map[string]string)
+	for _, col := range columns {
+		table[col], next[col] = make(map[string]snmpVarbind), col
+	}
+	active := append([]string{}, columns...)
+	for round := 0; len(active) > 0; round++ {
+		if round > 10000 {
+			return table, fmt.Errorf("walk of %s does not end", active[0])
+		}
+		oids := make([]string, len(active))
+		for i, col := range active {
+			oids[i] = next[col]
+		}
+		reps := max(1, 24/len(active))
+		vbs, err := s.request(pduGetBulk, oids, 0, reps)
+		if err != nil {
+			return table, err
+		}
+		moved := make(map[string]bool)
+		done := make(map[string]bool)
+		for i, vb := range vbs {
+			col := active[i%len(active)]
+			if done[col] {
+				continue
+			}
+			if vb.Type == snmpEndOfMibView || !strings.HasPrefix(vb.OID, col+".") || !oidLess(next[col], vb.OID) {
+				done[col] = true
+				continue
+			}
+			table[col][strings.TrimPrefix(vb.OID, col+".")] = vb
+			next[col], moved[col] = vb.OID, true
+		}
+		var still []string
+		for _, col := range active {
+			if moved[col] && !done[col] {
+				still = append(still, col)
+			}
+		}
+		active = still
+	}
+	return table, nil
+}
+
+// request sends one PDU and waits for its response, resending on silence
+func (s *snmpSession) request(pduType byte, oids []string, nonRepeaters, maxRepetitions int) ([]snmpVarbind, error) {
+	var binds []byte
+	for _, oid := range oids {
+		enc, err := berEncodeOID(oid)
+		if err != nil {
+			return nil, err
+		}
+		binds = append(binds, berTLV(berSequence, enc, berTLV(berNull))...)
+	}
+	for attempt := 0; ; attempt++ {
+		s.id = (s.id + 1) & 0x7fffffff
+		pdu := berTLV(pduType, berInt(int64(s.id)), berInt(int64(nonRepeaters)), berInt(int64(maxRepetitions)),
+			berTLV(berSequence, binds))
+		vbs, err := s.exchange(pdu)
+		if err != nil && strings.Contains(err.Error(), "not in time window") && attempt == 0 {
+			continue // the report carried the agent's clock; exchange adopted it
+		}
+		if err == nil || !errors.Is(err, errSNMPTimeout) || attempt >= snmpRetries {
+			return vbs, err
+		}
+	}
+}
+
+var errSNMPTimeout = errors.New("no response (timeout)")
+
+// errSNMPUnauthenticated marks a v3 message without the auth flag once the
+// session authenticates
+var errSNMPUnauthenticated = errors.New("unauthenticated message")
+
+// exchange sends a PDU and reads the reply with the same request ID
+func (s *snmpSession) exchange(pdu []byte) ([]snmpVarbind, error) {
+	msg, err := s.message(pdu)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s", ctxReason(s.ctx))
+	}
+	stop := context.AfterFunc(s.ctx, func() { s.conn.SetReadDeadline(time.Now()) })
+	defer stop()
+	if _, err := s.conn.Write(msg); err != nil {
+		return nil, err
+	}
+	s.conn.SetReadDeadline(time.Now().Add(s.timeout))
+	buf := make([]byte, snmpMaxMessage)
+	var refused, dropped error // unauthenticated report, last datagram dropped
+	for {
+		n, err := s.conn.Read(buf)
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return nil, fmt.Errorf("%s", ctxReason(s.ctx))
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				if refused != nil {
+					return nil, refused
+				}
+				if dropped != nil {
+					return nil, fmt.Errorf("%w, dropped a reply: %v", errSNMPTimeout, dropped)
+				}
+				return nil, errSNMPTimeout
+			}
+			return nil, err
+		}
+		reqID, pduType, vbs, err := s.parse(append([]byte{}, buf[:n]...))
+		if errors.Is(err, errSNMPUnauthenticated) && pduType == pduReport {
+			refused = usmReportError(vbs)
+			continue
+		}
+		if err != nil {
+			dropped = err
+			continue // malformed or forged; keep waiting for the reply
+		}
+		if pduType == pduReport {
+			return nil, usmReportError(vbs)
+		}
+		if reqID != s.id {
+			continue // a late reply to an earlier attempt
+		}
+		return vbs, nil
+	}
+}
+
+// message wraps a PDU for the configured version
+func (s *snmpSession) message(pdu []byte) ([]byte, error) {
+	if s.conf.version != "3" {
+		return berTLV(berSequence, berInt(1), berTLV(berOctets, []byte(s.conf.community)), pdu), nil
+	}
+	discovery := s.engineID == nil
+	flags := byte(0x04) // reportable
+	if !discovery && s.conf.authProto != "" {
+		flags |= 0x01
+		if s.conf.privProto != "" {
+			flags |= 0x02
+		}
+	}
+	boots, engTime := s.boots, s.engTime
+	if !discovery {
+		engTime += int64(time.Since(s.discovered) / time.Second)
+	}
+
+	scoped := berTLV(berSequence, berTLV(berOctets, s.engineID), berTLV(berOctets), pdu)
+	var privParams []byte
+	if flags&0x02 != 0 {
+		var err error
+		if scoped, privParams, err = s.encrypt(scoped, boots, engTime); err != nil {
+			return nil, err
+		}
+		scoped = berTLV(berOctets, scoped)
+	}
+	var authParams []byte
+	if flags&0x01 != 0 {
+		authParams = make([]byte, usmAuthLen(s.conf.authProto))
+	}
+	user := []byte(s.conf.user)
+	if discovery {
+		user = nil
+	}
+	pre := bytes.Join([][]byte{berTLV(berOctets, s.engineID), berInt(boots), berInt(engTime), berTLV(berOctets, user)}, nil)
+	content := bytes.Join([][]byte{pre, berTLV(berOctets, authParams), berTLV(berOctets, privParams)}, nil)
+	secParams := berTLV(berSequence, content)
+	header := berTLV(berSequence, berInt(int64(s.id)), berInt(snmpMaxMessage), berTLV(berOctets, []byte{flags}), berInt(3))
+	msg := berTLV(berSequence, berInt(3), header, berTLV(berOctets, secParams), scoped)
+
+	if flags&0x01 != 0 {
+		at := bytes.Index(msg, secParams) + len(secParams) - len(content) + len(pre) + 2
+		copy(msg[at:at+len(authParams)], s.digest(msg, len(authParams)))
+	}
+	return msg, nil
+}
+
+// parse reads a response message: its request ID, PDU type and varbinds
+func (s *snmpSession) parse(msg []byte) (int32, byte, []snmpVarbind, error) {
+	top, err := berReadOne(msg, berSequence)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	r := &berReader{data: top.content, base: top.start}
+	version, err := r.int()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if version != 3 {
+		if _, err := r.expect(berOctets); err != nil { // community
+			return 0, 0, nil, err
+		}
+		return parsePDU(r)
+	}
+
+	header, err := r.expect(berSequence)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	hr := &berReader{data: header.content, base: header.start}
+	if _, err := hr.int(); err != nil { // msgID
+		return 0, 0, nil, fmt.Errorf("malformed v3 header: %v", err)
+	}
+	if _, err := hr.int(); err != nil { // maxSize
+		return 0, 0, nil, fmt.Errorf("malformed v3 header: %v", err)
+	}
+	flagsTLV, err := hr.expect(berOctets)
+	if err != nil || len(flagsTLV.content) != 1 {
+		return 0, 0, nil, fmt.Errorf("malformed v3 header")
+	}
+	flags := flagsTLV.content[0]
+
+	secOctets, err := r.expect(berOctets)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	sec, err := berReadOne(secOctets.content, berSequence)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	sr := &berReader{data: sec.content, base: secOctets.start + sec.start}
+	engineID, err := sr.expect(berOctets)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("malformed security parameters: %v", err)
+	}
+	boots, err := sr.int()
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("malformed security parameters: %v", err)
+	}
+	engTime, err := sr.int()
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("malformed security parameters: %v", err)
+	}
+	if _, err := sr.expect(berOctets); err != nil { // user name
+		return 0, 0, nil, fmt.Errorf("malformed security parameters: %v", err)
+	}
+	authParams, err := sr.expect(berOctets)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("malformed security parameters: %v", err)
+	}
+	privParams, err := sr.expect(berOctets)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("malformed security parameters: %v", err)
+	}
+
+	if s.authKey != nil && flags&0x01 == 0 {
+		// Read it for exchange, which only takes a report as the reason the
+		// request goes unanswered; it changes no engine state
+		reqID, pduType, vbs, err := parseScoped(r)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		return reqID, pduType, vbs, errSNMPUnauthenticated
+	}
+	if s.authKey != nil {
+		got := append([]byte{}, authParams.content...)
+		zeroed := append([]byte{}, msg...)
+		clear(zeroed[authParams.start : authParams.start+len(got)])
+		if !hmac.Equal(got, s.digest(zeroed, len(got))) {
+			return 0, 0, nil, fmt.Errorf("authentication failed: response digest does not match")
+		}
+	}
+	if s.engineID == nil {
+		// Discovery: adopt the agent's engine
+		s.engineID = append([]byte{}, engineID.content...)
+	}
+	if boots != s.boots || engTime > s.engTime {
+		s.boots, s.engTime, s.discovered = boots, engTime, time.Now()
+	}
+
+	data := r
+	if s.privKey != nil && flags&0x02 == 0 {
+		// Authenticated reports (not in time window) are sent unencrypted;
+		// a response never is
+		reqID, pduType, vbs, err := parseScoped(r)
+		if err == nil && pduType != pduReport {
+			err = fmt.Errorf("unencrypted response to an encrypted request")
+		}
+		return reqID, pduType, vbs, err
+	}
+	if flags&0x02 != 0 {
+		enc, err := r.expect(berOctets)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		plain, err := s.decrypt(enc.content, privParams.content, boots, engTime)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		data = &berReader{data: plain}
+	}
+	reqID, pduType, vbs, err := parseScoped(data)
+	if err != nil && flags&0x02 != 0 {
+		return 0, 0, nil, fmt.Errorf("cannot read response (wrong priv password?): %v", err)
+	}
+	return reqID, pduType, vbs, err
+}
+
+// parseScoped reads a v3 scoped PDU
+func parseScoped(r *berReader) (int32, byte, []snmpVarbind, error) {
+	scoped, err := r.expect(berSequence)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	pr := &berReader{data: scoped.content}
+	if _, err := pr.expect(berOctets); err != nil { // contextEngineID
+		return 0, 0, nil, err
+	}
+	if _, err := pr.expect(berOctets); err != nil { // contextName
+		return 0, 0, nil, err
+	}
+	return parsePDU(pr)
+}
+
+func parsePDU(r *berReader) (int32, byte, []snmpVarbind, error) {
+	pdu, err := r.next()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if pdu.tag != pduResponse && pdu.tag != pduReport {
+		return 0, 0, nil, fmt.Errorf("unexpected PDU type %#x", pdu.tag)
+	}
+	pr := &berReader{data: pdu.content}
+	reqID, _ := pr.int()
+	status, _ := pr.int()
+	index, _ := pr.int()
+	list, err := pr.expect(berSequence)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	var vbs []snmpVarbind
+	lr := &berReader{data: list.content}
+	for lr.more() {
+		item, err := lr.expect(berSequence)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		ir := &berReader{data: item.content}
+		oid, err := ir.expect(berOID)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		val, err := ir.next()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		vbs = append(vbs, snmpVarbind{OID: berParseOID(oid.content), Type: val.tag, Value: val.content})
+	}
+	if status != 0 && pdu.tag == pduResponse {
+		name := strconv.FormatInt(status, 10)
+		if status > 0 && int(status) < len(snmpErrorStatus) {
+			name = snmpErrorStatus[status]
+		}
+		return 0, 0, nil, fmt.Errorf("agent error %s at varbind %d", name, index)
+	}
+	return int32(reqID), pdu.tag, vbs, nil
+}
+
+func usmReportError(vbs []snmpVarbind) error {
+	for _, vb := range vbs {
+		if msg, ok := usmReports[vb.OID]; ok {
+			return fmt.Errorf("%s", msg)
+		}
+	}
+	if len(vbs) > 0 {
+		return fmt.Errorf("agent report %s", vbs[0].OID)
+	}
+	return fmt.Errorf("agent report")
+}
+
+// discover learns the engine ID, boots and time, then localizes the keys
+func (s *snmpSession) discover() error {
+	if _, err := s.request(pduGet, nil, 0, 0); err != nil && s.engineID == nil {
+		return fmt.Errorf("engine discovery: %v", err)
+	}
+	if len(s.engineID) == 0 {
+		return fmt.Errorf("engine discovery: agent sent no engine ID")
+	}
+	if s.conf.authProto == "" {
+		return nil
+	}
+	newHash := usmHash(s.conf.authProto)
+	s.authKey = usmLocalizedKey(newHash, s.conf.authPass, s.engineID)
+	if s.conf.privProto != "" {
+		s.privKey = usmLocalizedKey(newHash, s.conf.privPass, s.engineID)
+	}
+	var salt [8]byte
+	rand.Read(salt[:])
+	s.salt = binary.BigEndian.Uint64(salt[:])
+	return nil
+}
+
+func usmHash(proto string) func() hash.Hash {
+	switch proto {
+	case "md5":
+		return md5.New
+	case "sha256":
+		return sha256.New
+	}
+	return sha1.New
+}
+
+func usmAuthLen(proto string) int {
+	if proto == "sha256" {
+		return 24
+	}
+	return 12
+}
+
+// usmLocalizedKey is the RFC 3414 password-to-key algorithm localized to
+// an engine
+func usmLocalizedKey(newHash func() hash.Hash, password string, engineID []byte) []byte {
+	h := newHash()
+	pw := []byte(password)
+	buf := make([]byte, 64)
+	for i, n := 0, 0; n < 1<<20; n += 64 {
+		for j := range buf {
+			buf[j] = pw[i%len(pw)]
+			i++
+		}
+		h.Write(buf)
+	}
+	ku := h.Sum(nil)
+	h.Reset()
+	h.Write(ku)
+	h.Write(engineID)
+	h.Write(ku)
+	return h.Sum(nil)
+}
+
+// digest is the truncated HMAC of a whole message
+func (s *snmpSession) digest(msg []byte, n int) []byte {
+	m := hmac.New(usmHash(s.conf.authProto), s.authKey)
+	m.Write(msg)
+	return m.Sum(nil)[:n]
+}
+
+// encrypt returns the encrypted scoped PDU and its privacy parameters
+func (s *snmpSession) encrypt(plain []byte, boots, engTime int64) ([]byte, []byte, error) {
+	s.salt++
+	params := make([]byte, 8)
+	if s.conf.privProto == "aes" {
+		binary.BigEndian.PutUint64(params, s.salt)
+		block, err := aes.NewCipher(s.privKey[:16])
+		if err != nil {
+			return nil, nil, err
+		}
+		return aesCFB(block, usmAESIV(boots, engTime, params), plain, false), params, nil
+	}
+	binary.BigEndian.PutUint32(params, uint32(boots))
+	binary.BigEndian.PutUint32(params[4:], uint32(s.salt))
+	block, err := des.NewCipher(s.privKey[:8])
+	if err != nil {
+		return nil, nil, err
+	}
+	if pad := len(plain) % 8; pad != 0 {
+		plain = append(plain, make([]byte, 8-pad)...)
+	}
+	out := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, usmDESIV(s.privKey, params)).CryptBlocks(out, plain)
+	return out, params, nil
+}
+
+func (s *snmpSession) decrypt(data, params []byte, boots, engTime int64) ([]byte, error) {
+	if len(params) != 8 {
+		return nil, fmt.Errorf("authentication failed: decryption error (bad privacy parameters)")
+	}
+	if s.conf.privProto == "aes" {
+		block, err := aes.NewCipher(s.privKey[:16])
+		if err != nil {
+			return nil, err
+		}
+		return aesCFB(block, usmAESIV(boots, engTime, params), data, true), nil
+	}
+	if len(data)%8 != 0 {
+		return nil, fmt.Errorf("authentication failed: decryption error (bad length)")
+	}
+	block, err := des.NewCipher(s.privKey[:8])
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, usmDESIV(s.privKey, params)).CryptBlocks(out, data)
+	return out, nil
+}
+
+func usmDESIV(key, salt []byte) []byte {
+	iv := make([]byte, 8)
+	for i := range iv {
+		iv[i] = key[8+i] ^ salt[i]
+	}
+	return iv
+}
+
+func usmAESIV(boots, engTime int64, salt []byte) []byte {
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint32(iv, uint32(boots))
+	binary.BigEndian.PutUint32(iv[4:], uint32(engTime))
+	copy(iv[8:], salt)
+	return iv
+}
+
+// aesCFB is CFB-128, the mode RFC 3826 specifies
+func aesCFB(block cipher.Block, iv, in []byte, decrypt bool) []byte {
+	out := make([]byte, len(in))
+	reg := append([]byte{}, iv...)
+	stream := make([]byte, aes.BlockSize)
+	for i := 0; i < len(in); i += aes.BlockSize {
+		block.Encrypt(stream, reg)
+		end := min(i+aes.BlockSize, len(in))
+		for j := i; j < end; j++ {
+			out[j] = in[j] ^ stream[j-i]
+		}
+		if decrypt {
+			copy(reg, in[i:end])
+		} else {
+			copy(reg, out[i:end])
+		}
+	}
+	return out
+}
+
+// ---------------------------------------------------------------------------
+// BER
+// ---------------------------------------------------------------------------
+
+// berTLV encodes a tag with the concatenated contents
+func berTLV(tag byte, contents ...[]byte) []byte {
+	body := bytes.Join(contents, nil)
+	out := []byte{tag}
+	switch n := len(body); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n < 0x100:
+		out = append(out, 0x81, byte(n))
+	default:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	}
+	return append(out, body...)
+}
+
+func berInt(v int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		v >>= 8
+		if (v == 0 && b[0]&0x80 == 0) || (v == -1 && b[0]&0x80 != 0) {
+			break
+		}
+	}
+	return berTLV(berInteger, b)
+}
+
+func berParseInt(b []byte) int64 {
+	if len(b) == 0 {
+		return 0
+	}
+	n := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		n = n<<8 | int64(c)
+	}
+	return n
+}
+
+func berEncodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+	nums := make([]uint64, len(parts))
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", oid)
+		}
+		nums[i] = n
+	}
+	body := berBase128(nums[0]*40 + nums[1])
+	for _, n := range nums[2:] {
+		body = append(body, berBase128(n)...)
+	}
+	return berTLV(berOID, body), nil
+}
+
+func berBase128(n uint64) []byte {
+	b := []byte{byte(n & 0x7f)}
+	for n >>= 7; n > 0; n >>= 7 {
+		b = append([]byte{byte(n&0x7f) | 0x80}, b...)
+	}
+	return b
+}
+
+func berParseOID(b []byte) string {
+	var parts []string
+	var n uint64
+	for _, c := range b {
+		n = n<<7 | uint64(c&0x7f)
+		if c&0x80 != 0 {
+			continue
+		}
+		if len(parts) == 0 {
+			first := min(n/40, 2)
+			parts = append(parts, strconv.FormatUint(first, 10), strconv.FormatUint(n-first*40, 10))
+		} else {
+			parts = append(parts, strconv.FormatUint(n, 10))
+		}
+		n = 0
+	}
+	return strings.Join(parts, ".")
+}
+
+// oidLess orders OIDs numerically, component by component
+func oidLess(a, b string) bool {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		x, _ := strconv.ParseUint(pa[i], 10, 64)
+		y, _ := strconv.ParseUint(pb[i], 10, 64)
+		if x != y {
+			return x < y
+		}
+	}
+	return len(pa) < len(pb)
+}
+
+// berTLVRead is one decoded element; start is the offset of its content in
+// the whole message
+type berTLVRead struct {
+	tag     byte
+	content []byte
+	start   int
+}
+
+type berReader struct {
+	data []byte
+	off  int
+	base int
+}
+
+func (r *berReader) more() bool {
+	return r.off < len(r.data)
+}
+
+func (r *berReader) next() (berTLVRead, error) {
+	d := r.data[r.off:]
+	if len(d) < 2 {
+		return berTLVRead{}, fmt.Errorf("truncated message")
+	}
+	tag, n, hdr := d[0], int(d[1]), 2
+	if n&0x80 != 0 {
+		octets := n & 0x7f
+		if octets == 0 || octets > 3 || len(d) < 2+octets {
+			return berTLVRead{}, fmt.Errorf("malformed length")
+		}
+		n = 0
+		for _, c := range d[2 : 2+octets] {
+			n = n<<8 | int(c)
+		}
+		hdr += octets
+	}
+	if len(d) < hdr+n {
+		return berTLVRead{}, fmt.Errorf("truncated message")
+	}
+	t := berTLVRead{tag: tag, content: d[hdr : hdr+n], start: r.base + r.off + hdr}
+	r.off += hdr + n
+	return t, nil
+}
+
+func (r *berReader) expect(tag byte) (berTLVRead, error) {
+	t, err := r.next()
+	if err == nil && t.tag != tag {
+		err = fmt.Errorf("expected tag %#x, got %#x", tag, t.tag)
+	}
+	return t, err
+}
+
+func (r *berReader) int() (int64, error) {
+	t, err := r.expect(berInteger)
+	return berParseInt(t.content), err
+}
+
+// berReadOne reads the single element at the start of data
+func berReadOne(data []byte, tag byte) (berTLVRead, error) {
+	return (&berReader{data: data}).expect(tag)
+}
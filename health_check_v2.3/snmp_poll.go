@@ -0,0 +1,568 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// SNMP POLLING TRANSPORT (devices without ssh access)
+// ============================================================================
+//
+// A few legacy aggregation switches accept SNMP only. For them the inventory
+// column Transport (JSON/YAML transport), or -transport for devices without
+// one, selects SNMP polling instead of the CLI:
+//
+//   snmp        SNMP only
+//   cli,snmp    the CLI, SNMP when the ssh session fails
+//   netconf     NETCONF on IOS-XR, the CLI otherwise or when it fails
+//
+//   -snmp-version 2c -snmp-community env:SNMP_COMMUNITY
+//   -snmp-version 3 -snmp-user nms -snmp-auth sha:env:SNMP_AUTH -snmp-priv aes:env:SNMP_PRIV
+//
+// Like NETCONF results, the polls are logged as "snmp:<group>" commands
+// carrying a text rendering, and extractMetrics reads the same metric names
+// as the CLI parsers from it:
+//
+//   snmp:system      sysName, sysDescr, sysUpTime        Version, Uptime
+//   snmp:interfaces  IF-MIB ifTable/ifXTable, FCS errors  Interfaces_*, *_Errors_Total, Drops_Total
+//   snmp:cpu         CISCO-PROCESS-MIB, else HOST-RESOURCES-MIB   CPU_1min_Pct, CPU_5min_Pct
+//   snmp:memory      CISCO-MEMORY-POOL-MIB, else HOST-RESOURCES-MIB   Memory_Used_Pct
+//
+// snmp:interfaces also feeds INTERFACES_<ts>.csv, so the pre/post interface
+// check covers these devices (without rates: SNMP counters are one sample).
+// CPU and memory are informational in the comparison, they only warn. SNMP
+// goes straight to the device: Proxy settings apply to ssh only, and modes
+// that run commands (runbooks, ping tests, backups) still need the CLI.
+
+const (
+	snmpSystemCommand     = "snmp:system"
+	snmpInterfacesCommand = "snmp:interfaces"
+	snmpRequestTimeout    = 5 * time.Second
+)
+
+// transportNames are the valid Transport values, in -transport order
+var transportNames = []string{"cli", "netconf", "snmp"}
+
+// snmpConfig is the parsed -snmp-* credentials
+type snmpConfig struct {
+	version   string // "2c" or "3"
+	community string
+	user      string
+	authProto string // md5, sha, sha256; "" = noAuth
+	authPass  string
+	privProto string // des, aes; "" = noPriv
+	privPass  string
+	port      int
+}
+
+// parseSNMPConfig reads the -snmp-* flags; check reports what a poll
+// still lacks
+func parseSNMPConfig(version, community, user, auth, priv string, port int) (*snmpConfig, error) {
+	c := &snmpConfig{user: user, port: port}
+	switch strings.TrimPrefix(strings.ToLower(version), "v") {
+	case "2c", "2":
+		c.version, c.community = "2c", resolveSecret(community)
+	case "3":
+		c.version = "3"
+	default:
+		return nil, fmt.Errorf("-snmp-version %q: expected 2c or 3", version)
+	}
+	if c.version == "3" && auth != "" {
+		proto, pass, _ := strings.Cut(auth, ":")
+		c.authProto, c.authPass = strings.ToLower(proto), resolveSecret(pass)
+		if c.authProto == "sha1" {
+			c.authProto = "sha"
+		}
+		if c.authProto != "md5" && c.authProto != "sha" && c.authProto != "sha256" {
+			return nil, fmt.Errorf("-snmp-auth %q: expected md5, sha or sha256 then :password", proto)
+		}
+	}
+	if c.version == "3" && priv != "" {
+		proto, pass, _ := strings.Cut(priv, ":")
+		c.privProto, c.privPass = strings.ToLower(proto), resolveSecret(pass)
+		if c.privProto == "aes128" {
+			c.privProto = "aes"
+		}
+		if c.privProto != "des" && c.privProto != "aes" {
+			return nil, fmt.Errorf("-snmp-priv %q: expected des or aes then :password", proto)
+		}
+		if c.authProto == "" {
+			return nil, fmt.Errorf("-snmp-priv needs -snmp-auth")
+		}
+	}
+	return c, nil
+}
+
+func (c *snmpConfig) check() error {
+	switch {
+	case c == nil:
+		return fmt.Errorf("SNMP is not configured")
+	case c.version == "2c" && c.community == "":
+		return fmt.Errorf("no SNMP community (-snmp-community, or set the variable it names)")
+	case c.version == "3" && c.user == "":
+		return fmt.Errorf("no SNMPv3 user (-snmp-user)")
+	case c.authProto != "" && len(c.authPass) < 8, c.privProto != "" && len(c.privPass) < 8:
+		return fmt.Errorf("SNMPv3 passwords need at least 8 characters")
+	}
+	return nil
+}
+
+// describe names the credentials for the execution plan
+func (c *snmpConfig) describe() string {
+	if c.version == "2c" {
+		if c.community == "" {
+			return "v2c (community MISSING)"
+		}
+		return "v2c (community provided)"
+	}
+	level := "noAuthNoPriv"
+	if c.authProto != "" {
+		level = c.authProto
+		if c.privProto != "" {
+			level += ", " + c.privProto
+		}
+	}
+	return fmt.Sprintf("v3 user %s (%s)", orDash(c.user), level)
+}
+
+// parseTransports reads a Transport value: names in the order they are
+// tried; netconf alone keeps its CLI fallback
+func parseTransports(spec string) ([]string, error) {
+	var list []string
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(spec, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		switch {
+		case t == "":
+			continue
+		case !containsString(transportNames, t):
+			return nil, fmt.Errorf("invalid transport %q (%s, or a comma-separated order)", t, strings.Join(transportNames, ", "))
+		case !seen[t]:
+			seen[t] = true
+			list = append(list, t)
+		}
+	}
+	if len(list) == 1 && list[0] == "netconf" {
+		list = append(list, "cli")
+	}
+	return list, nil
+}
+
+// transportsOf are the transports a device is collected with, in order
+func transportsOf(d DeviceInfo, config *Config) []string {
+	spec := config.Transport
+	if d.Transport != "" {
+		spec = d.Transport
+	}
+	list, _ := parseTransports(spec) // validated with the inventory and flags
+	var usable []string
+	for _, t := range list {
+		if t != "netconf" || d.DetectedOS == "IOS-XR" {
+			usable = append(usable, t)
+		}
+	}
+	if len(usable) == 0 {
+		return []string{"cli"}
+	}
+	return usable
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// snmpGroup is one poll and its rendering
+type snmpGroup struct {
+	Name string
+	Poll func(s *snmpSession) (string, error)
+}
+
+var snmpGroups = []snmpGroup{
+	{"system", pollSNMPSystem},
+	{"interfaces", pollSNMPInterfaces},
+	{"cpu", pollSNMPCPU},
+	{"memory", pollSNMPMemory},
+}
+
+// snmpCommands are the commands an SNMP collection logs
+func snmpCommands() []string {
+	var cmds []string
+	for _, g := range snmpGroups {
+		cmds = append(cmds, "snmp:"+g.Name)
+	}
+	return cmds
+}
+
+// collectSNMP polls a device; like collectNetconf it fails as a whole when
+// a poll gets no answer
+func collectSNMP(c *SSHClient, conf *snmpConfig, device DeviceInfo) (results []ExecutionResult, err error) {
+	if err := conf.check(); err != nil {
+		return nil, err
+	}
+	if err := c.breaker.allow(c); err != nil {
+		return nil, err
+	}
+	defer func() { c.breaker.observe(c, nil, err) }()
+
+	ctx, cancel := context.WithTimeout(c.stop.context(), c.cmdTimeout)
+	defer cancel()
+	if c.progress != nil {
+		c.progress(snmpSystemCommand)
+	}
+	s, err := dialSNMP(ctx, conf, c.host, snmpRequestTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("snmp: %v", err)
+	}
+	defer s.close()
+
+	for _, g := range snmpGroups {
+		command := "snmp:" + g.Name
+		if c.progress != nil {
+			c.progress(command)
+		}
+		start := time.Now()
+		out, err := g.Poll(s)
+		c.audit.snmp(c, conf, command, out, err)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", command, err)
+		}
+		results = append(results, ExecutionResult{
+			Hostname:  device.Hostname,
+			IPAddress: device.IPAddress,
+			Command:   command,
+			Output:    strings.TrimRight(out, "\n"),
+			Duration:  time.Since(start),
+			Stamp:     newSampleStamp(),
+		})
+	}
+	return results, nil
+}
+
+// ---------------------------------------------------------------------------
+// Polls
+// ---------------------------------------------------------------------------
+
+func pollSNMPSystem(s *snmpSession) (string, error) {
+	vbs, err := s.get("1.3.6.1.2.1.1.5.0", "1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.3.0")
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i, label := range []string{"sysName:", "sysDescr:", "sysUpTime:"} {
+		if i >= len(vbs) || vbs[i].missing() {
+			continue
+		}
+		value := vbs[i].String()
+		if label == "sysUpTime:" {
+			value = fmt.Sprintf("%s (%d ticks)", snmpUptime(vbs[i].uint()), vbs[i].uint())
+		}
+		lines := strings.Split(strings.ReplaceAll(strings.TrimSpace(value), "\r", ""), "\n")
+		fmt.Fprintf(&b, "%-11s %s\n", label, lines[0])
+		for _, l := range lines[1:] {
+			fmt.Fprintf(&b, "%-11s %s\n", "", l)
+		}
+	}
+	return b.String(), nil
+}
+
+// snmpUptime formats timeticks the way "show version" prints uptime
+func snmpUptime(ticks uint64) string {
+	minutes := ticks / 6000
+	var parts []string
+	for _, u := range []struct {
+		name string
+		mins uint64
+	}{{"year", 525600}, {"week", 10080}, {"day", 1440}, {"hour", 60}, {"minute", 1}} {
+		if n := minutes / u.mins; n > 0 || (u.mins == 1 && len(parts) == 0) {
+			minutes -= n * u.mins
+			name := u.name
+			if n != 1 {
+				name += "s"
+			}
+			parts = append(parts, fmt.Sprintf("%d %s", n, name))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// IF-MIB, IF-MIB ifXTable and EtherLike-MIB columns, by row index
+const (
+	oidIfDescr       = "1.3.6.1.2.1.2.2.1.2"
+	oidIfMtu         = "1.3.6.1.2.1.2.2.1.4"
+	oidIfSpeed       = "1.3.6.1.2.1.2.2.1.5"
+	oidIfAdminStatus = "1.3.6.1.2.1.2.2.1.7"
+	oidIfOperStatus  = "1.3.6.1.2.1.2.2.1.8"
+	oidIfInOctets    = "1.3.6.1.2.1.2.2.1.10"
+	oidIfInDiscards  = "1.3.6.1.2.1.2.2.1.13"
+	oidIfInErrors    = "1.3.6.1.2.1.2.2.1.14"
+	oidIfOutOctets   = "1.3.6.1.2.1.2.2.1.16"
+	oidIfOutDiscards = "1.3.6.1.2.1.2.2.1.19"
+	oidIfOutErrors   = "1.3.6.1.2.1.2.2.1.20"
+	oidIfName        = "1.3.6.1.2.1.31.1.1.1.1"
+	oidIfHCInOctets  = "1.3.6.1.2.1.31.1.1.1.6"
+	oidIfHCOutOctets = "1.3.6.1.2.1.31.1.1.1.10"
+	oidIfHighSpeed   = "1.3.6.1.2.1.31.1.1.1.15"
+	oidIfAlias       = "1.3.6.1.2.1.31.1.1.1.18"
+	oidDot3FCSErrors = "1.3.6.1.2.1.10.7.2.1.3"
+)
+
+var snmpOperStatus = []string{"", "up", "down", "testing", "unknown", "dormant", "notPresent", "lowerLayerDown"}
+
+// snmpInterfacesRow lays out one row of the snmp:interfaces table
+const snmpInterfacesRow = "%-25s %-6s %-14s %4v %11v %16v %16v %11v %11v %11v %12v %12v  %s\n"
+
+func pollSNMPInterfaces(s *snmpSession) (string, error) {
+	t, err := s.walk(oidIfDescr, oidIfMtu, oidIfSpeed, oidIfAdminStatus, oidIfOperStatus, oidIfInOctets,
+		oidIfInDiscards, oidIfInErrors, oidIfOutOctets, oidIfOutDiscards, oidIfOutErrors, oidIfName,
+		oidIfHCInOctets, oidIfHCOutOctets, oidIfHighSpeed, oidIfAlias, oidDot3FCSErrors)
+	if err != nil {
+		return "", err
+	}
+	var rows []string
+	for index := range t[oidIfAdminStatus] {
+		rows = append(rows, index)
+	}
+	sort.Slice(rows, func(i, j int) bool { return oidLess(rows[i], rows[j]) })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, snmpInterfacesRow, "Interface", "Admin", "Oper", "MTU", "Speed_Mbps", "In_Octets", "Out_Octets",
+		"In_Errors", "CRC", "Out_Errors", "In_Discards", "Out_Discards", "Description")
+	for _, i := range rows {
+		name := t[oidIfName][i].String()
+		if name == "" {
+			name = t[oidIfDescr][i].String()
+		}
+		if name == "" {
+			name = "ifIndex." + i
+		}
+		admin := "down"
+		if t[oidIfAdminStatus][i].uint() == 1 {
+			admin = "up"
+		}
+		oper := "unknown"
+		if n := t[oidIfOperStatus][i].uint(); n > 0 && n < uint64(len(snmpOperStatus)) {
+			oper = snmpOperStatus[n]
+		}
+		speed := t[oidIfHighSpeed][i].uint()
+		if speed == 0 {
+			speed = t[oidIfSpeed][i].uint() / 1000000
+		}
+		in, out := t[oidIfInOctets][i].uint(), t[oidIfOutOctets][i].uint()
+		if vb, ok := t[oidIfHCInOctets][i]; ok {
+			in, out = vb.uint(), t[oidIfHCOutOctets][i].uint()
+		}
+		desc := strings.TrimSpace(t[oidIfAlias][i].String())
+		if desc == "" {
+			desc = "-"
+		}
+		fmt.Fprintf(&b, snmpInterfacesRow,
+			strings.ReplaceAll(name, " ", "_"), admin, oper, t[oidIfMtu][i].uint(), speed, in, out,
+			t[oidIfInErrors][i].uint(), t[oidDot3FCSErrors][i].uint(), t[oidIfOutErrors][i].uint(),
+			t[oidIfInDiscards][i].uint(), t[oidIfOutDiscards][i].uint(), desc)
+	}
+	return b.String(), nil
+}
+
+// parseSNMPInterfaces reads the snmp:interfaces table back into interface
+// records
+func parseSNMPInterfaces(output string) []InterfaceDetail {
+	var ifaces []InterfaceDetail
+	for _, line := range strings.Split(output, "\n") {
+		f := strings.Fields(line)
+		if len(f) < 13 || f[0] == "Interface" {
+			continue
+		}
+		d := InterfaceDetail{Name: f[0], AdminState: f[1], LineProtocol: f[2]}
+		if d.AdminState == "down" {
+			d.AdminState = "administratively down"
+		}
+		if d.LineProtocol != "up" {
+			d.LineProtocol = "down"
+		}
+		d.MTU, _ = strconv.Atoi(f[3])
+		d.BandwidthKbps = atoi64(f[4]) * 1000
+		d.InputBytes, d.OutputBytes = atoi64(f[5]), atoi64(f[6])
+		d.InputErrors, d.CRCErrors, d.OutputErrors = atoi64(f[7]), atoi64(f[8]), atoi64(f[9])
+		d.InputDrops, d.OutputDrops = atoi64(f[10]), atoi64(f[11])
+		if desc := strings.Join(f[12:], " "); desc != "-" {
+			d.Description = desc
+		}
+		ifaces = append(ifaces, d)
+	}
+	return ifaces
+}
+
+// CPU and memory MIBs: Cisco's first, HOST-RESOURCES-MIB on other agents
+const (
+	oidCpmCPU5sec     = "1.3.6.1.4.1.9.9.109.1.1.1.1.6"
+	oidCpmCPU1min     = "1.3.6.1.4.1.9.9.109.1.1.1.1.7"
+	oidCpmCPU5min     = "1.3.6.1.4.1.9.9.109.1.1.1.1.8"
+	oidHrProcessor    = "1.3.6.1.2.1.25.3.3.1.2"
+	oidMemPoolName    = "1.3.6.1.4.1.9.9.48.1.1.1.2"
+	oidMemPoolUsed    = "1.3.6.1.4.1.9.9.48.1.1.1.5"
+	oidMemPoolFree    = "1.3.6.1.4.1.9.9.48.1.1.1.6"
+	oidHrStorageType  = "1.3.6.1.2.1.25.2.3.1.2"
+	oidHrStorageDescr = "1.3.6.1.2.1.25.2.3.1.3"
+	oidHrStorageUnits = "1.3.6.1.2.1.25.2.3.1.4"
+	oidHrStorageSize  = "1.3.6.1.2.1.25.2.3.1.5"
+	oidHrStorageUsed  = "1.3.6.1.2.1.25.2.3.1.6"
+	hrStorageRAM      = "1.3.6.1.2.1.25.2.1.2"
+)
+
+const snmpNoMIB = "(no CPU or memory MIB answered)"
+
+func pollSNMPCPU(s *snmpSession) (string, error) {
+	t, err := s.walk(oidCpmCPU5sec, oidCpmCPU1min, oidCpmCPU5min)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if len(t[oidCpmCPU5min]) > 0 {
+		b.WriteString("Source: CISCO-PROCESS-MIB\nCPU        5sec_%  1min_%  5min_%\n")
+		for _, i := range sortedIndexes(t[oidCpmCPU5min]) {
+			fmt.Fprintf(&b, "%-10s %6d  %6d  %6d\n", i, t[oidCpmCPU5sec][i].uint(), t[oidCpmCPU1min][i].uint(), t[oidCpmCPU5min][i].uint())
+		}
+		return b.String(), nil
+	}
+	hr, err := s.walk(oidHrProcessor)
+	if err != nil {
+		return "", err
+	}
+	if len(hr[oidHrProcessor]) == 0 {
+		return snmpNoMIB + "\n", nil
+	}
+	b.WriteString("Source: HOST-RESOURCES-MIB\nCPU        5sec_%  1min_%  5min_%\n")
+	for _, i := range sortedIndexes(hr[oidHrProcessor]) {
+		fmt.Fprintf(&b, "%-10s %6s  %6d  %6s\n", i, "-", hr[oidHrProcessor][i].uint(), "-")
+	}
+	return b.String(), nil
+}
+
+func pollSNMPMemory(s *snmpSession) (string, error) {
+	t, err := s.walk(oidMemPoolName, oidMemPoolUsed, oidMemPoolFree)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	header := "Pool                  Used_Bytes        Free_Bytes  Used_%\n"
+	row := func(name string, used, free uint64) {
+		pct := 0.0
+		if used+free > 0 {
+			pct = float64(used) / float64(used+free) * 100
+		}
+		fmt.Fprintf(&b, "%-20s %11d %17d  %6.1f\n", strings.ReplaceAll(name, " ", "_"), used, free, pct)
+	}
+	if len(t[oidMemPoolName]) > 0 {
+		b.WriteString("Source: CISCO-MEMORY-POOL-MIB\n" + header)
+		for _, i := range sortedIndexes(t[oidMemPoolName]) {
+			row(t[oidMemPoolName][i].String(), t[oidMemPoolUsed][i].uint(), t[oidMemPoolFree][i].uint())
+		}
+		return b.String(), nil
+	}
+	hr, err := s.walk(oidHrStorageType, oidHrStorageDescr, oidHrStorageUnits, oidHrStorageSize, oidHrStorageUsed)
+	if err != nil {
+		return "", err
+	}
+	rows := 0
+	for _, i := range sortedIndexes(hr[oidHrStorageType]) {
+		if hr[oidHrStorageType][i].String() != hrStorageRAM {
+			continue
+		}
+		if rows == 0 {
+			b.WriteString("Source: HOST-RESOURCES-MIB\n" + header)
+		}
+		unit := hr[oidHrStorageUnits][i].uint()
+		size, used := hr[oidHrStorageSize][i].uint()*unit, hr[oidHrStorageUsed][i].uint()*unit
+		row(hr[oidHrStorageDescr][i].String(), used, size-min(used, size))
+		rows++
+	}
+	if rows == 0 {
+		return snmpNoMIB + "\n", nil
+	}
+	return b.String(), nil
+}
+
+func sortedIndexes(column map[string]snmpVarbind) []string {
+	var idx []string
+	for i := range column {
+		idx = append(idx, i)
+	}
+	sort.Slice(idx, func(a, b int) bool { return oidLess(idx[a], idx[b]) })
+	return idx
+}
+
+// ---------------------------------------------------------------------------
+// Metrics
+// ---------------------------------------------------------------------------
+
+// snmpMetrics derives the summary metrics of an snmp:<group> output
+func snmpMetrics(command, output string) map[string]string {
+	metrics := make(map[string]string)
+	switch strings.TrimPrefix(command, "snmp:") {
+	case "system":
+		descr := false
+		for _, line := range strings.Split(output, "\n") {
+			label, value := strings.TrimSpace(line[:min(11, len(line))]), strings.TrimSpace(line[min(12, len(line)):])
+			if label != "" {
+				descr = label == "sysDescr:"
+			}
+			switch {
+			case label == "sysUpTime:":
+				metrics["Uptime"], _, _ = strings.Cut(value, " (")
+			case descr && metrics["Version"] == "" && strings.Contains(strings.ToLower(value), "version"):
+				metrics["Version"] = value
+			}
+		}
+	case "interfaces":
+		return interfaceMetrics(parseSNMPInterfaces(output))
+	case "cpu":
+		var max1, max5 int64 = -1, -1
+		for _, f := range snmpRows(output, 4) {
+			if f[2] != "-" {
+				max1 = max(max1, atoi64(f[2]))
+			}
+			if f[3] != "-" {
+				max5 = max(max5, atoi64(f[3]))
+			}
+		}
+		if max1 >= 0 {
+			metrics["CPU_1min_Pct"] = strconv.FormatInt(max1, 10)
+		}
+		if max5 >= 0 {
+			metrics["CPU_5min_Pct"] = strconv.FormatInt(max5, 10)
+		}
+	case "memory":
+		// The processor pool (Cisco) or the first RAM entry
+		rows := snmpRows(output, 4)
+		for i, f := range rows {
+			if i == 0 || strings.EqualFold(f[0], "Processor") {
+				metrics["Memory_Used_Pct"] = f[3]
+			}
+		}
+	}
+	return metrics
+}
+
+// snmpRows are the data rows of a rendered table: at least n fields, not
+// the Source or header line
+func snmpRows(output string, n int) [][]string {
+	var rows [][]string
+	for _, line := range strings.Split(output, "\n") {
+		f := strings.Fields(line)
+		if len(f) < n || f[0] == "Source:" || f[0] == "CPU" || f[0] == "Pool" {
+			continue
+		}
+		rows = append(rows, f)
+	}
+	return rows
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 3414 appendix A.3: "maplesyrup" localized to engine ID
+// 00 00 00 00 00 00 00 00 00 00 00 02
+func TestUSMLocalizedKey(t *testing.T) {
+	engineID, _ := hex.DecodeString("000000000000000000000002")
+	tests := []struct {
+		proto string
+		want  string
+	}{
+		{"md5", "526f5eed9fcce26f8964c2930787d82b"},
+		{"sha", "6695febc9288e36282235fc7151f128497b38f3f"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(usmLocalizedKey(usmHash(tt.proto), "maplesyrup", engineID))
+		if got != tt.want {
+			t.Errorf("%s key = %s, want %s", tt.proto, got, tt.want)
+		}
+	}
+}
+
+func TestBERRoundTrip(t *testing.T) {
+	for _, v := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, 1<<31 - 1, -1 << 31} {
+		tlv, err := berReadOne(berInt(v), berInteger)
+		if err != nil {
+			t.Fatalf("berInt(%d): %v", v, err)
+		}
+		if got := berParseInt(tlv.content); got != v {
+			t.Errorf("berInt(%d) reads back %d", v, got)
+		}
+	}
+	for _, oid := range []string{"1.3.6.1.2.1.1.5.0", "1.3.6.1.4.1.9.9.109.1.1.1.1.8.7", "2.999.3", "1.3.6.1.2.1.31.1.1.1.6.4294967295"} {
+		enc, err := berEncodeOID(oid)
+		if err != nil {
+			t.Fatalf("berEncodeOID(%s): %v", oid, err)
+		}
+		tlv, err := berReadOne(enc, berOID)
+		if err != nil {
+			t.Fatalf("%s: %v", oid, err)
+		}
+		if got := berParseOID(tlv.content); got != oid {
+			t.Errorf("OID %s reads back %s", oid, got)
+		}
+	}
+	// Short, one- and two-octet lengths
+	for _, n := range []int{0, 127, 128, 255, 256, 1500} {
+		body := bytes.Repeat([]byte{0xab}, n)
+		tlv, err := berReadOne(berTLV(berOctets, body), berOctets)
+		if err != nil || !bytes.Equal(tlv.content, body) {
+			t.Errorf("%d-byte string: %v", n, err)
+		}
+	}
+	if _, err := berReadOne([]byte{berSequence, 0x05, 0x02}, berSequence); err == nil {
+		t.Error("truncated message accepted")
+	}
+}
+
+var testEngineID = []byte{0x80, 0x00, 0x00, 0x09, 0x03, 0x00, 0x00, 0x1b, 0x54, 0x9a, 0x3c, 0x01}
+
+// v3Session is a session that has discovered testEngineID
+func v3Session(auth, priv string) *snmpSession {
+	conf := &snmpConfig{version: "3", user: "hc", authProto: auth, authPass: "authpass1", privProto: priv, privPass: "privpass1"}
+	s := &snmpSession{conf: conf, id: 42, engineID: testEngineID, boots: 5, engTime: 1000, discovered: time.Now()}
+	if auth != "" {
+		s.authKey = usmLocalizedKey(usmHash(auth), conf.authPass, testEngineID)
+		if priv != "" {
+			s.privKey = usmLocalizedKey(usmHash(auth), conf.privPass, testEngineID)
+		}
+	}
+	return s
+}
+
+// testPDU is a PDU with one sysName varbind
+func testPDU(t *testing.T, pduType byte, reqID int32, oid, value string) []byte {
+	t.Helper()
+	enc, err := berEncodeOID(oid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return berTLV(pduType, berInt(int64(reqID)), berInt(0), berInt(0),
+		berTLV(berSequence, berTLV(berSequence, enc, berTLV(berOctets, []byte(value)))))
+}
+
+// An agent reply built with the session's own keys parses; a forged
+// unauthenticated report, an unencrypted response and a tampered message
+// do not
+func TestSNMPv3Parse(t *testing.T) {
+	for _, priv := range []string{"des", "aes"} {
+		t.Run(priv, func(t *testing.T) {
+			s := v3Session("sha", priv)
+			msg, err := s.message(testPDU(t, pduResponse, 42, "1.3.6.1.2.1.1.5.0", "PE1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			reqID, pduType, vbs, err := s.parse(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reqID != 42 || pduType != pduResponse || len(vbs) != 1 || vbs[0].String() != "PE1" {
+				t.Errorf("parsed %d %#x %v", reqID, pduType, vbs)
+			}
+
+			tampered := append([]byte{}, msg...)
+			tampered[len(tampered)-1] ^= 0x01
+			if _, _, _, err := s.parse(tampered); err == nil || !strings.Contains(err.Error(), "digest does not match") {
+				t.Errorf("tampered message: err = %v", err)
+			}
+		})
+	}
+
+	t.Run("forged report", func(t *testing.T) {
+		s := v3Session("sha", "aes")
+		forger := v3Session("", "")
+		forger.boots, forger.engTime = 99, 99999
+		msg, err := forger.message(testPDU(t, pduReport, 42, "1.3.6.1.6.3.15.1.1.5.0", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, pduType, vbs, err := s.parse(msg)
+		if !errors.Is(err, errSNMPUnauthenticated) || pduType != pduReport {
+			t.Fatalf("err = %v, type %#x, want an unauthenticated report", err, pduType)
+		}
+		if got := usmReportError(vbs); !strings.Contains(got.Error(), "wrong digest") {
+			t.Errorf("report reads %v", got)
+		}
+		if s.boots != 5 || s.engTime != 1000 {
+			t.Errorf("forged report moved the engine clock to %d/%d", s.boots, s.engTime)
+		}
+	})
+
+	t.Run("unencrypted response", func(t *testing.T) {
+		s := v3Session("sha", "aes")
+		authOnly := v3Session("sha", "")
+		msg, err := authOnly.message(testPDU(t, pduResponse, 42, "1.3.6.1.2.1.1.5.0", "PE1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, _, err := s.parse(msg); err == nil || !strings.Contains(err.Error(), "unencrypted response") {
+			t.Errorf("err = %v, want unencrypted response", err)
+		}
+	})
+}
+
+// fakeSNMPAgent answers v2c GETBULK requests from a table of OID -> value
+func fakeSNMPAgent(t *testing.T, table map[string]string) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no udp: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	var oids []string
+	for oid := range table {
+		oids = append(oids, oid)
+	}
+	sort.Slice(oids, func(i, j int) bool { return oidLess(oids[i], oids[j]) })
+
+	go func() {
+		buf := make([]byte, snmpMaxMessage)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			top, err := berReadOne(buf[:n], berSequence)
+			if err != nil {
+				continue
+			}
+			r := &berReader{data: top.content}
+			r.int()
+			community, _ := r.expect(berOctets)
+			pdu, err := r.next()
+			if err != nil || pdu.tag != pduGetBulk || string(community.content) != "public" {
+				continue
+			}
+			pr := &berReader{data: pdu.content}
+			reqID, _ := pr.int()
+			pr.int()
+			reps, _ := pr.int()
+			list, _ := pr.expect(berSequence)
+			var asked []string
+			lr := &berReader{data: list.content}
+			for lr.more() {
+				item, _ := lr.expect(berSequence)
+				oid, _ := (&berReader{data: item.content}).expect(berOID)
+				asked = append(asked, berParseOID(oid.content))
+			}
+
+			var binds []byte
+			cursor := append([]string{}, asked...)
+			for rep := 0; rep < int(reps); rep++ {
+				for i, from := range cursor {
+					k := sort.Search(len(oids), func(k int) bool { return oidLess(from, oids[k]) })
+					enc, _ := berEncodeOID(from)
+					value := berTLV(snmpEndOfMibView)
+					if k < len(oids) {
+						cursor[i] = oids[k]
+						enc, _ = berEncodeOID(oids[k])
+						value = berTLV(berOctets, []byte(table[oids[k]]))
+					}
+					binds = append(binds, berTLV(berSequence, enc, value)...)
+				}
+			}
+			resp := berTLV(berSequence, berInt(1), berTLV(berOctets, []byte("public")),
+				berTLV(pduResponse, berInt(reqID), berInt(0), berInt(0), berTLV(berSequence, binds)))
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestSNMPWalk(t *testing.T) {
+	const descr, alias = "1.3.6.1.2.1.2.2.1.2", "1.3.6.1.2.1.31.1.1.1.18"
+	table := map[string]string{"1.3.6.1.2.1.1.5.0": "PE1"}
+	want := map[string]string{}
+	for i, name := range []string{"Gi0/0/0", "Gi0/0/1", "Te0/1/0", "Lo0", "Lo100", "BE1", "BE2", "Tu1", "Tu2", "Nu0",
+		"Gi0/0/2", "Gi0/0/3", "Gi0/0/4", "Gi0/0/5", "Gi0/0/6", "Gi0/0/7", "Gi0/0/8", "Gi0/0/9", "Gi0/0/10", "Gi0/0/11"} {
+		index := []string{"1", "2", "3", "10", "11", "12", "13", "20", "21", "99", "100", "101", "102", "103", "104",
+			"105", "106", "107", "108", "1000"}[i]
+		table[descr+"."+index] = name
+		table[alias+"."+index] = "to " + name
+		want[index] = name
+	}
+	port := fakeSNMPAgent(t, table)
+
+	s, err := dialSNMP(context.Background(), &snmpConfig{version: "2c", community: "public", port: port}, "127.0.0.1", 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	got, err := s.walk(descr, alias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got[descr]) != len(want) || len(got[alias]) != len(want) {
+		t.Fatalf("walked %d and %d rows, want %d", len(got[descr]), len(got[alias]), len(want))
+	}
+	for index, name := range want {
+		if got[descr][index].String() != name || got[alias][index].String() != "to "+name {
+			t.Errorf("row %s = %q / %q", index, got[descr][index], got[alias][index])
+		}
+	}
+}
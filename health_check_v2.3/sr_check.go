@@ -0,0 +1,422 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// SEGMENT ROUTING CHECK (-sr-check)
+// ============================================================================
+//
+// The migration moves the core from LDP to SR-MPLS, so the post-check has to
+// show that every node is on SR and protected, not just that LDP sessions
+// went away. -sr-check adds the IS-IS SR commands to the XR/XE command sets:
+//
+//   show isis database verbose        SRGB and prefix SIDs of every node
+//   show isis adjacency detail (XR)   adjacency SIDs per IS-IS adjacency
+//   show isis neighbors detail (XE)
+//   show isis fast-reroute summary    TI-LFA protection coverage
+//   show mpls ldp neighbor [brief]    LDP sessions still up
+//
+// and judges each device:
+//
+//   SRGB         the SRGB its own LSP advertises is the one most of the
+//                fleet uses (prefix SID labels differ between nodes otherwise)
+//   prefix SID   its loopback (the Router Cap address) has a prefix SID, and
+//                the index is not used by another prefix anywhere in the
+//                databases collected
+//   adjacency    every IS-IS adjacency that is up has an adjacency SID
+//   TI-LFA       protection coverage is at least -sr-tilfa-min percent
+//
+// Status is OK, DEGRADED (a reason above), LDP_ONLY (its own LSP carries no
+// SR capability: it still forwards on LDP labels alone) or NOT_COLLECTED.
+// The report also lists every node, in or out of the inventory, whose LSP
+// lacks the SR capability in any collected database, and the SRGBs in use.
+
+var srCommands = map[string][]string{
+	"IOS-XR": {"show isis database verbose", "show isis adjacency detail", "show isis fast-reroute summary", "show mpls ldp neighbor brief"},
+	"IOS-XE": {"show isis database verbose", "show isis neighbors detail", "show isis fast-reroute summary", "show mpls ldp neighbor"},
+}
+
+var (
+	isisLSPRe       = regexp.MustCompile(`^(\S+)\.([0-9a-fA-F]{2})-[0-9a-fA-F]{2}\s+(\*?)\s*0x[0-9a-fA-F]+`)
+	isisRouterCapRe = regexp.MustCompile(`(?i)^\s*Router CAP:\s+(\d+\.\d+\.\d+\.\d+)`)
+	isisSRGBRe      = regexp.MustCompile(`(?i)Segment Routing:.*SRGB Base:\s*(\d+)\s+Range:\s*(\d+)`)
+	isisIPPrefixRe  = regexp.MustCompile(`(?i)^\s*Metric:\s*\d+\s+IP(?:v4)?-Extended\s+(\d+\.\d+\.\d+\.\d+/\d+)`)
+	isisPrefixSIDRe = regexp.MustCompile(`(?i)^\s*Prefix-SID Index:\s*(\d+)`)
+	isisAdjSIDRe    = regexp.MustCompile(`(?i)^\s*Adjacency SID:\s*(\d+)`)
+	tilfaCoverageRe = regexp.MustCompile(`(?i)^\s*Protection coverage\s.*?(\d+(?:\.\d+)?)%\s*$`)
+)
+
+// isisNode is what the LSPs of one node advertise
+type isisNode struct {
+	Name       string
+	RouterID   string
+	SRGB       string // base-end, "" = no SR capability
+	PrefixSIDs map[string]int
+	Local      bool // the device's own LSP ("*")
+}
+
+// parseISISDatabase reads "show isis database verbose"; fragments and
+// levels of a node are merged, pseudonode LSPs are skipped
+func parseISISDatabase(output string) map[string]*isisNode {
+	nodes := make(map[string]*isisNode)
+	var cur *isisNode
+	prefix := ""
+	for _, line := range strings.Split(output, "\n") {
+		if m := isisLSPRe.FindStringSubmatch(line); m != nil {
+			cur, prefix = nil, ""
+			if m[2] != "00" {
+				continue
+			}
+			if cur = nodes[m[1]]; cur == nil {
+				cur = &isisNode{Name: m[1], PrefixSIDs: make(map[string]int)}
+				nodes[m[1]] = cur
+			}
+			cur.Local = cur.Local || m[3] == "*"
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		if m := isisRouterCapRe.FindStringSubmatch(line); m != nil {
+			cur.RouterID = m[1]
+		}
+		if m := isisSRGBRe.FindStringSubmatch(line); m != nil {
+			base, _ := strconv.Atoi(m[1])
+			size, _ := strconv.Atoi(m[2])
+			cur.SRGB = fmt.Sprintf("%d-%d", base, base+size-1)
+		}
+		if m := isisIPPrefixRe.FindStringSubmatch(line); m != nil {
+			prefix = m[1]
+			continue
+		}
+		if m := isisPrefixSIDRe.FindStringSubmatch(line); m != nil && prefix != "" {
+			cur.PrefixSIDs[prefix], _ = strconv.Atoi(m[1])
+		}
+	}
+	return nodes
+}
+
+// isisAdjacency is one IS-IS adjacency and its adjacency SID
+type isisAdjacency struct {
+	SystemID  string
+	Interface string
+	SID       string
+}
+
+// parseISISAdjacencies reads the adjacency rows (System Id, Interface, ...,
+// State Up) of "show isis adjacency detail" / "show isis neighbors detail"
+// with the first "Adjacency SID:" of the lines below each row
+func parseISISAdjacencies(output string) []isisAdjacency {
+	var adj []isisAdjacency
+	for _, line := range strings.Split(output, "\n") {
+		f := strings.Fields(line)
+		if len(f) >= 4 && !strings.HasPrefix(line, " ") {
+			iface, up := "", false
+			for _, field := range f[1:] {
+				if iface == "" && isInterfaceName(field) {
+					iface = field
+				}
+				up = up || strings.EqualFold(field, "up")
+			}
+			if iface != "" && up {
+				adj = append(adj, isisAdjacency{SystemID: f[0], Interface: iface})
+				continue
+			}
+		}
+		if m := isisAdjSIDRe.FindStringSubmatch(line); m != nil && len(adj) > 0 && adj[len(adj)-1].SID == "" {
+			adj[len(adj)-1].SID = m[1]
+		}
+	}
+	return adj
+}
+
+// parseTILFACoverage returns the lowest "Protection coverage" total of
+// "show isis fast-reroute summary", -1 when there is none
+func parseTILFACoverage(output string) float64 {
+	coverage := -1.0
+	for _, line := range strings.Split(output, "\n") {
+		if m := tilfaCoverageRe.FindStringSubmatch(line); m != nil {
+			if v, err := strconv.ParseFloat(m[1], 64); err == nil && (coverage < 0 || v < coverage) {
+				coverage = v
+			}
+		}
+	}
+	return coverage
+}
+
+// SRRow is the SR state of one device
+type SRRow struct {
+	Hostname    string
+	Site        string
+	OS          string
+	SRGB        string
+	Loopback    string
+	PrefixSID   string
+	Adjacencies int
+	AdjSIDs     int
+	TILFA       string // lowest protection coverage, "" = not collected
+	LDPSessions int
+	Status      string // OK, DEGRADED, LDP_ONLY, NOT_COLLECTED
+	Reasons     []string
+}
+
+// SRReport is the outcome of -sr-check
+type SRReport struct {
+	Rows      []SRRow
+	FleetSRGB string
+	SRGBs     map[string][]string // SRGB -> nodes advertising it
+	LDPOnly   []string            // nodes without SR capability in any database
+	Conflicts []string            // prefix SID index conflicts
+}
+
+// srDevice is the parsed SR output of one device
+type srDevice struct {
+	result    *DeviceResult
+	nodes     map[string]*isisNode
+	self      *isisNode
+	adj       []isisAdjacency
+	coverage  float64
+	ldp       int
+	collected bool
+	rejected  string
+}
+
+func addSRCommands(cs *CommandSet) {
+	cs.IOSXR = mergeCommands(cs.IOSXR, srCommands["IOS-XR"])
+	cs.IOSXE = mergeCommands(cs.IOSXE, srCommands["IOS-XE"])
+}
+
+func parseSRDevice(r *DeviceResult) *srDevice {
+	d := &srDevice{result: r, coverage: -1}
+	for _, e := range r.Results {
+		cmd := strings.ToLower(e.Command)
+		if strings.Contains(cmd, "isis") && isCommandRejected(e.Output) {
+			d.rejected = fmt.Sprintf("%q rejected: %s", e.Command, rejectionLine(e.Output))
+			continue
+		}
+		switch {
+		case strings.Contains(cmd, "isis database"):
+			d.collected = true
+			d.nodes = parseISISDatabase(e.Output)
+		case strings.Contains(cmd, "isis adjacency") || strings.Contains(cmd, "isis neighbors"):
+			d.adj = parseISISAdjacencies(e.Output)
+		case strings.Contains(cmd, "isis fast-reroute summary"):
+			d.coverage = parseTILFACoverage(e.Output)
+		case strings.Contains(cmd, "mpls ldp neighbor"):
+			d.ldp = len(parseLDPNeighbors(e.Output).Neighbors)
+		}
+	}
+	for _, n := range d.nodes {
+		if n.Local || strings.EqualFold(n.Name, r.Device.Hostname) {
+			d.self = n
+			break
+		}
+	}
+	return d
+}
+
+// checkSR evaluates the XR/XE devices of a run
+func checkSR(results []*DeviceResult, tilfaMin float64) SRReport {
+	var devices []*srDevice
+	for _, r := range results {
+		if r.Device.DetectedOS == "IOS-XR" || r.Device.DetectedOS == "IOS-XE" {
+			devices = append(devices, parseSRDevice(r))
+		}
+	}
+
+	// Merge what every database says about every node
+	srgbs := make(map[string]map[string]bool)
+	noSR := make(map[string]bool)
+	sids := make(map[int]map[string]string) // index -> prefix -> advertising node
+	for _, d := range devices {
+		for _, n := range d.nodes {
+			if n.SRGB == "" {
+				noSR[n.Name] = true
+				continue
+			}
+			if srgbs[n.SRGB] == nil {
+				srgbs[n.SRGB] = make(map[string]bool)
+			}
+			srgbs[n.SRGB][n.Name] = true
+			for prefix, index := range n.PrefixSIDs {
+				if sids[index] == nil {
+					sids[index] = make(map[string]string)
+				}
+				sids[index][prefix] = n.Name
+			}
+		}
+	}
+
+	report := SRReport{SRGBs: make(map[string][]string)}
+	best := 0
+	for srgb, nodes := range srgbs {
+		for n := range nodes {
+			report.SRGBs[srgb] = append(report.SRGBs[srgb], n)
+		}
+		sort.Strings(report.SRGBs[srgb])
+		if len(nodes) > best || (len(nodes) == best && srgb < report.FleetSRGB) {
+			report.FleetSRGB, best = srgb, len(nodes)
+		}
+	}
+	for n := range noSR {
+		report.LDPOnly = append(report.LDPOnly, n)
+	}
+	sort.Strings(report.LDPOnly)
+	conflict := make(map[string]string) // prefix -> conflict text
+	var indexes []int
+	for index := range sids {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		if len(sids[index]) < 2 {
+			continue
+		}
+		var users []string
+		for prefix, node := range sids[index] {
+			users = append(users, prefix+" ("+node+")")
+		}
+		sort.Strings(users)
+		text := fmt.Sprintf("index %d used by %s", index, strings.Join(users, ", "))
+		report.Conflicts = append(report.Conflicts, text)
+		for prefix := range sids[index] {
+			conflict[prefix] = text
+		}
+	}
+
+	for _, d := range devices {
+		r := d.result
+		row := SRRow{Hostname: r.Device.Hostname, Site: r.Device.Site, OS: r.Device.DetectedOS,
+			Adjacencies: len(d.adj), LDPSessions: d.ldp}
+		if d.coverage >= 0 {
+			row.TILFA = fmt.Sprintf("%.1f%%", d.coverage)
+		}
+		switch {
+		case !r.Success || !d.collected:
+			row.Status = "NOT_COLLECTED"
+			if d.rejected != "" {
+				row.Reasons = append(row.Reasons, d.rejected)
+			}
+			report.Rows = append(report.Rows, row)
+			continue
+		case d.self == nil:
+			row.Status = "NOT_COLLECTED"
+			row.Reasons = append(row.Reasons, "own LSP not found in the IS-IS database")
+			report.Rows = append(report.Rows, row)
+			continue
+		case d.self.SRGB == "":
+			row.Status = "LDP_ONLY"
+			row.Reasons = append(row.Reasons, fmt.Sprintf("no SR capability advertised (%d LDP sessions)", d.ldp))
+			report.Rows = append(report.Rows, row)
+			continue
+		}
+
+		row.SRGB = d.self.SRGB
+		if row.SRGB != report.FleetSRGB {
+			row.Reasons = append(row.Reasons, fmt.Sprintf("SRGB %s differs from the fleet's %s", row.SRGB, report.FleetSRGB))
+		}
+		if row.Loopback = d.self.RouterID; row.Loopback != "" {
+			if index, ok := d.self.PrefixSIDs[row.Loopback+"/32"]; ok {
+				row.PrefixSID = strconv.Itoa(index)
+			} else {
+				row.Reasons = append(row.Reasons, fmt.Sprintf("no prefix SID on %s/32", row.Loopback))
+			}
+		}
+		var prefixes []string
+		for prefix := range d.self.PrefixSIDs {
+			prefixes = append(prefixes, prefix)
+		}
+		sort.Strings(prefixes)
+		for _, prefix := range prefixes {
+			if text, ok := conflict[prefix]; ok {
+				row.Reasons = append(row.Reasons, "prefix SID "+text)
+			}
+		}
+		for _, a := range d.adj {
+			if a.SID != "" {
+				row.AdjSIDs++
+			} else {
+				row.Reasons = append(row.Reasons, fmt.Sprintf("no adjacency SID to %s on %s", a.SystemID, a.Interface))
+			}
+		}
+		switch {
+		case d.coverage < 0:
+			row.Reasons = append(row.Reasons, "no TI-LFA coverage reported (fast-reroute not enabled?)")
+		case d.coverage < tilfaMin:
+			row.Reasons = append(row.Reasons, fmt.Sprintf("TI-LFA coverage %.1f%% below %.1f%%", d.coverage, tilfaMin))
+		}
+		row.Status = "OK"
+		if len(row.Reasons) > 0 {
+			row.Status = "DEGRADED"
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	return report
+}
+
+// WriteSR writes SR_CHECK_<ts>.log
+func (w *OutputWriter) WriteSR(report SRReport, tilfaMin float64) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("SR_CHECK_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	counts := make(map[string]int)
+	for _, r := range report.Rows {
+		counts[r.Status]++
+	}
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Segment Routing Check\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, " Fleet SRGB: %s | TI-LFA minimum: %.1f%%\n", orDash(report.FleetSRGB), tilfaMin)
+	fmt.Fprintf(file, " OK: %d | DEGRADED: %d | LDP_ONLY: %d | NOT_COLLECTED: %d\n",
+		counts["OK"], counts["DEGRADED"], counts["LDP_ONLY"], counts["NOT_COLLECTED"])
+	fmt.Fprintf(file, "================================================================================\n\n")
+
+	table := newTextTable("HOSTNAME", "OS", "SRGB", "LOOPBACK", "PREFIX SID", "ADJ SIDS", "TI-LFA", "LDP", "STATUS")
+	for _, r := range report.Rows {
+		adj := "-"
+		if r.Adjacencies > 0 {
+			adj = fmt.Sprintf("%d/%d", r.AdjSIDs, r.Adjacencies)
+		}
+		table.add(r.Site, displayHost(r.Hostname), r.OS, orDash(r.SRGB), orDash(r.Loopback), orDash(r.PrefixSID),
+			adj, orDash(r.TILFA), r.LDPSessions, r.Status)
+		for _, reason := range r.Reasons {
+			table.note("    - %s", reason)
+		}
+	}
+	table.write(file)
+
+	var srgbs []string
+	for srgb := range report.SRGBs {
+		srgbs = append(srgbs, srgb)
+	}
+	sort.Strings(srgbs)
+	fmt.Fprintf(file, "\nSRGBs advertised in the IS-IS databases:\n")
+	for _, srgb := range srgbs {
+		fmt.Fprintf(file, "  %-14s %s\n", srgb, strings.Join(report.SRGBs[srgb], ", "))
+	}
+	if len(report.Conflicts) > 0 {
+		fmt.Fprintf(file, "\nPrefix SID conflicts:\n")
+		for _, c := range report.Conflicts {
+			fmt.Fprintf(file, "  %s\n", c)
+		}
+	}
+	if len(report.LDPOnly) > 0 {
+		fmt.Fprintf(file, "\nNodes advertising no SR capability (LDP labels only):\n")
+		for _, n := range report.LDPOnly {
+			fmt.Fprintf(file, "  %s\n", n)
+		}
+	}
+	return nil
+}
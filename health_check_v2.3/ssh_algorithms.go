@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ============================================================================
+// SSH ALGORITHM OVERRIDES FOR OLD DEVICES
+// ============================================================================
+//
+// Old access routers and switches (IOS 12.2, early XE) offer only
+// diffie-hellman-group1 key exchange, CBC ciphers and ssh-rsa host keys,
+// which current OpenSSH clients no longer propose, so the login fails with
+// "no matching key exchange method found". The inventory column
+// SSH_Algorithms (JSON/YAML ssh_algorithms), or -ssh-algorithms for devices
+// without one, re-enables them per device:
+//
+//   legacy                                     the set below, all appended
+//   kex=+diffie-hellman-group1-sha1;ciphers=+aes128-cbc,3des-cbc
+//   legacy;hostkeys=ssh-rsa                    combine, later keys win
+//
+// Keys: kex (KexAlgorithms), ciphers (Ciphers), hostkeys (HostKeyAlgorithms,
+// also PubkeyAcceptedAlgorithms for the client key) and macs (MACs). A list
+// starting with + is appended to OpenSSH's defaults, with ^ put before
+// them and with - removed from them; otherwise it replaces them. The options
+// reach ssh, scp and the NETCONF sessions alike; native sessions edit the Go
+// stack's defaults the same way (native_ssh.go).
+
+// sshLegacyAlgorithms is the "legacy" preset
+var sshLegacyAlgorithms = map[string]string{
+	"kex":      "+diffie-hellman-group14-sha1,diffie-hellman-group1-sha1,diffie-hellman-group-exchange-sha1",
+	"ciphers":  "+aes128-cbc,aes256-cbc,3des-cbc",
+	"hostkeys": "+ssh-rsa",
+	"macs":     "+hmac-sha1",
+}
+
+// sshAlgorithmOptions maps the spec keys to OpenSSH options, in argument order
+var sshAlgorithmOptions = []struct{ key, option string }{
+	{"kex", "KexAlgorithms"},
+	{"ciphers", "Ciphers"},
+	{"hostkeys", "HostKeyAlgorithms"},
+	{"hostkeys", "PubkeyAcceptedAlgorithms"},
+	{"macs", "MACs"},
+}
+
+var sshAlgorithmListRe = regexp.MustCompile(`^[+^-]?[a-z0-9@._-]+(,[a-z0-9@._-]+)*$`)
+
+// parseSSHAlgorithms reads a spec into key -> algorithm list
+func parseSSHAlgorithms(spec string) (map[string]string, error) {
+	algos := make(map[string]string)
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if strings.EqualFold(part, "legacy") {
+			for k, v := range sshLegacyAlgorithms {
+				algos[k] = v
+			}
+			continue
+		}
+		key, list, ok := strings.Cut(part, "=")
+		key, list = strings.ToLower(strings.TrimSpace(key)), strings.ReplaceAll(strings.TrimSpace(list), " ", "")
+		if _, known := sshLegacyAlgorithms[key]; !ok || !known {
+			return nil, fmt.Errorf("invalid ssh algorithms %q (legacy, or kex=, ciphers=, hostkeys=, macs= separated by ;)", part)
+		}
+		if !sshAlgorithmListRe.MatchString(list) {
+			return nil, fmt.Errorf("invalid %s list %q", key, list)
+		}
+		algos[key] = list
+	}
+	return algos, nil
+}
+
+// sshAlgorithmArgs are the ssh/scp options of a spec, nil for none
+func sshAlgorithmArgs(spec string) ([]string, error) {
+	algos, err := parseSSHAlgorithms(spec)
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	for _, o := range sshAlgorithmOptions {
+		if list := algos[o.key]; list != "" {
+			args = append(args, "-o", o.option+"="+list)
+		}
+	}
+	return args, nil
+}
+
+// sshAlgorithmsOf is the spec a device connects with
+func sshAlgorithmsOf(d DeviceInfo, config *Config) string {
+	if d.SSHAlgos != "" {
+		return d.SSHAlgos
+	}
+	return config.SSHAlgos
+}
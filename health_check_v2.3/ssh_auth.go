@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// SSH AUTHENTICATION (publickey / ssh-agent / password)
+// ============================================================================
+//
+// Order of preference per device:
+//   1. private key (inventory Key_File column, else -key)
+//   2. any identity in the running ssh-agent (SSH_AUTH_SOCK)
+//   3. password (-p or the credential vault)
+//
+// The password and the key passphrase are answered by this program itself
+// as ssh's askpass helper (SSH_ASKPASS_REQUIRE=force, OpenSSH 8.4 or
+// later), not by sshpass: nothing to install, and the secrets travel in the
+// environment of the ssh process, which only the same user can read, instead
+// of its command line, which every user on the host sees in ps. ProxyCommand
+// children do not inherit them (ssh_proxy.go). ssh runs the helper with the
+// prompt as its only argument; "Enter passphrase for key ...:" gets the
+// passphrase and a prompt ending in "password:" the password. Any other
+// prompt (host key confirmation, one-time codes) fails, which ends the login
+// instead of sending the password where it was not asked for. One password
+// prompt is answered per login, so a wrong password fails at once instead of
+// counting three attempts against the account.
+//
+// Device sessions use this only with -ssh-client openssh or a command:
+// proxy; by default they run on the Go ssh stack (native_ssh.go). NETCONF
+// and scp always do. There, password and passphrase logins need OpenSSH 8.4
+// or later; an older ssh fails them with a clear error instead of hanging on
+// a prompt. Key and agent logins work with any OpenSSH.
+
+const (
+	askpassEnv        = "HC_ASKPASS" // set for ssh: this program answers its prompts
+	askpassPassword   = "HC_ASKPASS_PASSWORD"
+	askpassPassphrase = "HC_ASKPASS_PASSPHRASE"
+)
+
+// isAskpass reports whether ssh started this process as its askpass helper
+func isAskpass() bool {
+	return os.Getenv(askpassEnv) != "" && len(os.Args) == 2 && !strings.HasPrefix(os.Args[1], "-")
+}
+
+// runAskpass answers the prompt in os.Args[1] on stdout; an empty answer
+// fails the prompt
+func runAskpass() int {
+	prompt := strings.ToLower(strings.TrimSpace(os.Args[1]))
+	var secret string
+	switch {
+	case strings.HasPrefix(prompt, "enter passphrase for"):
+		secret = os.Getenv(askpassPassphrase)
+	case strings.HasSuffix(prompt, "password:"):
+		secret = os.Getenv(askpassPassword)
+	default:
+		fmt.Fprintf(os.Stderr, "askpass: not answering %q\n", strings.TrimSpace(os.Args[1]))
+		return 1
+	}
+	if secret == "" {
+		return 1
+	}
+	fmt.Println(secret)
+	return 0
+}
+
+// withoutAskpassSecrets is env without the secrets the askpass helper and
+// the SOCKS5 dialer read
+func withoutAskpassSecrets(env []string) []string {
+	var kept []string
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, askpassPassword+"=") && !strings.HasPrefix(kv, askpassPassphrase+"=") &&
+			!strings.HasPrefix(kv, proxyPasswordEnv+"=") {
+			kept = append(kept, kv)
+		}
+	}
+	return kept
+}
+
+// resolveSecret expands env:VAR so secrets need not be stored in the inventory
+func resolveSecret(v string) string {
+	if strings.HasPrefix(v, "env:") {
+		return os.Getenv(strings.TrimPrefix(v, "env:"))
+	}
+	return v
+}
+
+// hasSSHCredentials reports whether the device can authenticate at all
+func hasSSHCredentials(config *Config, d DeviceInfo) bool {
+	if _, ok := config.vaultCredential(d); ok {
+		return true
+	}
+	return config.Password != "" || d.KeyFile != "" || config.KeyFile != "" || os.Getenv("SSH_AUTH_SOCK") != ""
+}
+
+// sshCommand wraps the ssh invocation for the client's auth methods
+func (c *SSHClient) sshCommand(sshArgs []string) (*exec.Cmd, error) {
+	return c.authCommand("ssh", sshArgs)
+}
+
+// authCommand runs an OpenSSH program (ssh, scp) with the client's auth methods
+func (c *SSHClient) authCommand(program string, sshArgs []string) (*exec.Cmd, error) {
+	var auth []string
+	if c.keyFile != "" {
+		if _, err := os.Stat(c.keyFile); err != nil {
+			return nil, fmt.Errorf("private key: %v", err)
+		}
+		auth = append(auth, "-i", c.keyFile)
+	}
+
+	passphrase := resolveSecret(c.keyPass)
+	if c.keyFile == "" {
+		passphrase = ""
+	}
+	methods := "publickey"
+	if c.password != "" {
+		methods += ",keyboard-interactive,password"
+	}
+	auth = append(auth, "-o", "PreferredAuthentications="+methods)
+	algoArgs, err := sshAlgorithmArgs(c.algos)
+	if err != nil {
+		return nil, err
+	}
+	auth = append(auth, algoArgs...)
+	sshArgs = append(auth, sshArgs...)
+
+	if c.password == "" && passphrase == "" {
+		// Key or agent only: fail instead of waiting on a prompt nobody answers
+		cmd := exec.Command(program, append([]string{"-o", "BatchMode=yes"}, sshArgs...)...)
+		if env := proxyEnv(c.proxy); env != nil {
+			cmd.Env = append(os.Environ(), env...)
+		}
+		return cmd, nil
+	}
+	if err := checkAskpassSupport(); err != nil {
+		return nil, err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("askpass helper: %v", err)
+	}
+	cmd := exec.Command(program, append([]string{"-o", "NumberOfPasswordPrompts=1"}, sshArgs...)...)
+	cmd.Env = append(os.Environ(), askpassEnv+"=1", "SSH_ASKPASS="+self, "SSH_ASKPASS_REQUIRE=force",
+		askpassPassword+"="+c.password, askpassPassphrase+"="+passphrase)
+	cmd.Env = append(cmd.Env, proxyEnv(c.proxy)...)
+	if os.Getenv("DISPLAY") == "" {
+		cmd.Env = append(cmd.Env, "DISPLAY=none")
+	}
+	return cmd, nil
+}
+
+var (
+	opensshVersionRe = regexp.MustCompile(`OpenSSH_(?:for_Windows_)?(\d+)\.(\d+)`)
+	opensshOnce      sync.Once
+	opensshVersion   string // "9.2", "" when ssh -V says nothing we know
+	opensshTooOld    bool
+)
+
+// checkAskpassSupport fails password logins on an OpenSSH older than 8.4,
+// which ignores SSH_ASKPASS_REQUIRE; an unknown version is let through. scp
+// has no -V, so ssh -V stands for the installed OpenSSH.
+func checkAskpassSupport() error {
+	opensshOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		out, _ := exec.CommandContext(ctx, "ssh", "-V").CombinedOutput()
+		m := opensshVersionRe.FindStringSubmatch(string(out))
+		if m == nil {
+			return
+		}
+		major, _ := strconv.Atoi(m[1])
+		minor, _ := strconv.Atoi(m[2])
+		opensshVersion = m[1] + "." + m[2]
+		opensshTooOld = major < 8 || major == 8 && minor < 4
+	})
+	if opensshTooOld {
+		return fmt.Errorf("password login needs OpenSSH 8.4 or later (SSH_ASKPASS_REQUIRE), found %s; use a key (-key), -ssh-client native or upgrade ssh", opensshVersion)
+	}
+	return nil
+}
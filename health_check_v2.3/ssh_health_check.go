@@ -8,22 +8,20 @@ Fixed: ASR903/920 detection, Added comparison summary
 package main
 
 import (
-	"archive/zip"
 	"bufio"
-	"encoding/csv"
-	"encoding/xml"
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -41,15 +39,6 @@ const (
 // DATA STRUCTURES
 // ============================================================================
 
-type DeviceInfo struct {
-	Hostname   string
-	IPAddress  string
-	DeviceType string
-	Site       string
-	Role       string
-	DetectedOS string
-}
-
 type ExecutionResult struct {
 	Hostname  string
 	IPAddress string
@@ -57,6 +46,7 @@ type ExecutionResult struct {
 	Output    string
 	Error     error
 	Duration  time.Duration
+	Stamp     sampleStamp // when the output was taken (see sample_stamp.go)
 }
 
 type Config struct {
@@ -75,241 +65,195 @@ type Config struct {
 	Verbose       bool
 	DryRun        bool
 	Phase         string
-	CompareDir    string // For pre/post comparison
-}
-
-// ============================================================================
-// OS DETECTION - FIXED ORDER (specific patterns first!)
-// ============================================================================
-
-func detectDeviceOS(deviceType string) string {
-	dt := strings.ToUpper(strings.TrimSpace(deviceType))
-	
-	// =====================================================
-	// CHECK SPECIFIC PATTERNS FIRST (before generic ones!)
-	// =====================================================
-	
-	// IOS-XE: ASR903, ASR920 (must check BEFORE ASR9 pattern!)
-	if strings.Contains(dt, "ASR903") || strings.Contains(dt, "ASR-903") ||
-		strings.Contains(dt, "ASR920") || strings.Contains(dt, "ASR-920") {
-		return "IOS-XE"
-	}
-	
-	// IOS-XR: ASR9000 series (ASR9K, ASR9006, ASR9010, ASR9906, etc.)
-	// Only match ASR9 followed by 0 or K (not ASR903/ASR920)
-	if strings.Contains(dt, "ASR9K") || strings.Contains(dt, "ASR-9K") ||
-		strings.Contains(dt, "ASR90") || strings.Contains(dt, "ASR91") || 
-		strings.Contains(dt, "ASR99") || // ASR9006, ASR9010, ASR9901, ASR9906, etc.
-		strings.Contains(dt, "XRV") || strings.Contains(dt, "IOS-XR") ||
-		strings.Contains(dt, "IOSXR") || strings.Contains(dt, "NCS") ||
-		strings.Contains(dt, "CRS") {
-		return "IOS-XR"
-	}
-	
-	// IOS-XE: Other patterns
-	if strings.Contains(dt, "ASR1") || strings.Contains(dt, "ASR-1") ||
-		strings.Contains(dt, "ISR") || strings.Contains(dt, "CSR") ||
-		strings.Contains(dt, "IOS-XE") || strings.Contains(dt, "IOSXE") ||
-		strings.Contains(dt, "IOSV") || strings.Contains(dt, "IOS-V") ||
-		strings.Contains(dt, "VIOS") || strings.Contains(dt, "C8") ||
-		strings.Contains(dt, "C11") || strings.Contains(dt, "C12") {
-		return "IOS-XE"
-	}
-	
-	// L2 Switch patterns
-	if strings.Contains(dt, "SWITCH") || strings.Contains(dt, "SW") ||
-		strings.Contains(dt, "CAT") || strings.Contains(dt, "CATALYST") ||
-		strings.Contains(dt, "C9300") || strings.Contains(dt, "C9200") ||
-		strings.Contains(dt, "C9400") || strings.Contains(dt, "C9500") ||
-		strings.Contains(dt, "C3850") || strings.Contains(dt, "C3750") ||
-		strings.Contains(dt, "C2960") || strings.Contains(dt, "9300") ||
-		strings.Contains(dt, "9200") || strings.Contains(dt, "3850") ||
-		strings.Contains(dt, "3750") || strings.Contains(dt, "2960") ||
-		strings.Contains(dt, "L2") || strings.Contains(dt, "IOL") ||
-		strings.Contains(dt, "I86BI") {
-		return "L2-SWITCH"
-	}
-	
-	// Default
-	return "IOS-XE"
+	CompareDir    string        // For pre/post comparison
+	ExportInv     string        // Write -hosts inventory to another format
+	SyncInv       string        // Reconcile -hosts with another inventory file
+	NetBoxURL     string        // Pull -hosts from this NetBox (see netbox_sync.go)
+	NetBoxToken   string        // NetBox API token (env:VAR allowed, default NETBOX_TOKEN)
+	NetBoxTag     string        // Only NetBox devices with any of these tags
+	VRFCatalogue  string        // CSV/XLSX VRF design catalogue (see vrf_catalogue.go)
+	Window        time.Duration // Maintenance window length (0 = single run)
+	WindowEvery   time.Duration // Snapshot interval inside the window
+	Proxy         string        // Global SSH proxy spec (socks5://, jump://, command:)
+	SSHAlgos      string        // SSH algorithm overrides for devices without their own (see ssh_algorithms.go)
+	ProxyConnect  string        // Internal: act as SOCKS5 ProxyCommand for ssh
+	ProxyExec     string        // Internal: run a ProxyCommand without the askpass secrets
+	Bundle        bool          // Package the run as a signed tar.gz
+	BundleKey     string        // ed25519 signing key for bundles
+	VerifyBundle  string        // Verify a bundle and exit
+	AuditWindow   string        // Maintenance window whose audit transcript records every command (see audit_transcript.go)
+	AuditVerify   string        // Verify an audit transcript and exit
+	AuditExport   string        // Export an audit transcript as signed evidence and exit
+	UpgradeAudit  bool          // Run the upgrade readiness check group
+	UpgradeTarget string        // Expected software version for the audit
+	MinDiskFreeMB int64         // Minimum free space on the install disk
+	RPLAudit      bool          // Audit route-policy attach points
+	RPLIntent     string        // CSV of expected policies per attach point
+	StallAfter    time.Duration // Report a worker with no output for this long
+	StallSkip     time.Duration // Kill a stalled session after this extra grace
+	Plan          bool          // Print the execution plan and exit
+	PlanOut       string        // Also export the plan to this file
+	HWDiff        string        // pre_dir,post_dir for the hardware diff
+	HWPairs       string        // old_hostname,new_hostname migration pairs
+	KeyFile       string        // Default private key for publickey auth
+	KeyPass       string        // Default key passphrase (or env:VAR)
+	EnableSecret  string        // Enable secret for user EXEC logins (env:VAR, or login; see enable_mode.go)
+	VaultFile     string        // Encrypted credential store
+	VaultAction   string        // init, add, rotate, list
+	VaultEntry    string        // Entry for -vault add ("default" or hostname)
+	IdleTimeout   time.Duration // Kill a session with no output for this long
+	NoiseFile     string        // Per-OS output cleaning rules
+	CleanCheck    string        // Validate cleaning against <dir>/<OS>/*.raw fixtures
+	Transport     string        // cli, netconf, snmp or an order such as cli,snmp, for devices without their own
+	NetconfPort   int           // NETCONF ssh subsystem port
+	SNMPVersion   string        // 2c or 3 (see snmp_poll.go)
+	SNMPCommunity string        // SNMPv2c community (or env:VAR)
+	SNMPUser      string        // SNMPv3 user
+	SNMPAuth      string        // SNMPv3 auth PROTO:PASSWORD (md5, sha, sha256; env:VAR allowed)
+	SNMPPriv      string        // SNMPv3 privacy PROTO:PASSWORD (des, aes; env:VAR allowed)
+	SNMPPort      int           // SNMP agent UDP port
+	GoldenMark    string        // Run directory to store as the golden lab run
+	GoldenCompare string        // Run directory to check against the golden run
+	GoldenTol     float64       // Allowed deviation from golden values, percent
+	PeerRegistry  string        // CSV of expected BGP peers to audit against
+	RoleWorkers   string        // Per-role session limits, ROLE=N,...
+	Session       string        // auto, expect or script (see expect_session.go)
+	SSHImpl       string        // native or openssh (see native_ssh.go)
+	PromptRegex   string        // Device prompt for expect sessions
+	CmdDeadline   time.Duration // Per-command deadline (see circuit_breaker.go)
+	BreakerAfter  int           // Consecutive timeouts that mark a device unreachable (0 = off)
+	BreakerCool   time.Duration // How long an unreachable device fails fast before one retry
+	Retries       int           // Retries of a session failing on a transient error (see ssh_retry.go)
+	RetryBackoff  time.Duration // Wait before the first retry, doubled for each further one
+	RetryJitter   float64       // Randomize retry waits by up to this fraction
+	RetryOn       string        // Error classes to retry: reset,closed,refused,timeout,unreachable or any
+	DiskCheck     bool          // Check free space on the install filesystems
+	DiskMinPct    float64       // Minimum free percentage for the disk check
+	Persist       bool          // Keep one session per device for the whole run
+	Keepalive     time.Duration // Idle keepalive interval for persistent sessions
+	ConfigBackup  bool          // Collect only the running-config of every target
+	ConfigDiff    string        // HOST, a.cfg,b.cfg or pre_dir,post_dir
+	Monitors      string        // Window-mode monitor declarations (see sampling.go)
+	ParseCheck    string        // Validate parsers against <dir>/<OS>/*.raw fixtures
+	ValidateCmds  bool          // Probe the command files on one device per OS and exit
+	RollbackRules string        // Window-mode trigger/action rules (see rollback.go)
+	RollbackDry   bool          // Record rollback actions without sending them
+	AlertCmd      string        // Shell command run for "alert" rollback actions
+	Runbook       string        // YAML runbook to execute (see runbook.go)
+	RunbookReset  bool          // Ignore the runbook state file and start over
+	Serve         string        // Listen address for the HTTP API (see server.go)
+	APIToken      string        // Bearer token for the API (or env:VAR)
+	RecordDir     string        // Record expect sessions as asciinema casts here
+	Exporter      string        // Listen address for Prometheus /metrics (see exporter.go)
+	ExporterEvery time.Duration // Poll interval for the exporter
+	StaticAudit   bool          // Audit static routes per VRF (see static_routes.go)
+	StaticIntent  string        // CSV of expected static routes
+	NotifyFile    string        // Webhook alert settings (see notifier.go)
+	HooksFile     string        // Shell/HTTP hooks around runs (see hooks.go)
+	CompareTol    string        // Pre/post WARN/FAIL bands (see compare_tolerance.go)
+	PingThresh    string        // Ping success thresholds per VRF/test (see ping_threshold.go)
+	DisjointVRFs  string        // VRF groups that must not overlap (see fleet_analyzer.go)
+	SharedRanges  string        // Ranges allowed in every disjoint VRF
+	Autoscale     string        // MIN-MAX worker bounds (see autoscale.go)
+	Schedule      time.Duration // Collect every interval (see baseline_schedule.go)
+	ScheduleFor   time.Duration // Stop the schedule after this long (0 = never)
+	Retain        string        // Runs to keep per phase: N, DURATION or N,DURATION
+	Baselines     bool          // List the runs of -phase and exit
+	Redundancy    bool          // Check both RPs (see redundancy.go)
+	PDF           string        // run_dir[,baseline_dir] to render as a PDF report
+	Export        string        // Validation export formats: csv, xlsx or csv,xlsx
+	Capture       string        // HOST:INTERFACE to packet-capture (see packet_capture.go)
+	CaptureFor    time.Duration // Capture duration
+	CaptureMB     int           // Capture buffer / file size
+	CaptureMatch  string        // IOS-XE capture filter (default any)
+	IfErrThresh   int64         // Interface error/drop counter growth allowed pre/post
+	Store         string        // Extra run storage: directories and/or API URLs (see run_store.go)
+	StoreToken    string        // Bearer token for HTTP storage (or env:VAR)
+	OSPFIntent    string        // CSV of intended OSPF adjacencies (see ospf_intent.go)
+	OSPFIntentOut string        // Write the live adjacencies as an intent CSV
+	SRCheck       bool          // Segment Routing checks (see sr_check.go)
+	SRTILFAMin    float64       // Minimum TI-LFA protection coverage (percent)
+	E2ECheck      string        // Replay <dir>/<scenario> fixtures against golden reports
+	E2EUpdate     bool          // Rewrite the golden reports of -e2e-check
+	CriticalVRFs  string        // Critical VRFs, highest priority first (see critical_services.go)
+	CriticalAbort bool          // Stop the collection when a critical VRF fails
+	EEMDeploy     string        // Syslog collector to deploy EEM watchers for (see eem_watcher.go)
+	EEMVRF        string        // VRF the collector is reached in
+	EEMRemove     bool          // Remove the deployed EEM watchers
+	QoSIfaces     string        // Critical interfaces of the QoS check (see qos_policy.go)
+	PingMesh      bool          // Full-mesh ping matrix between the targets (see ping_mesh.go)
+	PingMeshFile  string        // Per-VRF target list of the ping mesh
+	PingMeshSrc   string        // Source interface whose address is each device's target
+	ChangeWatch   time.Duration // Config change poll interval in -window/-runbook (see change_watch.go)
+	ChangeAllow   string        // Devices the MOP changes during the window
+	PingWatch     string        // PE to ping the watch targets from every second (see ping_watch.go)
+	PingWatchFile string        // Targets of the ping watch, VRF NAME ADDRESS per line
+	PingWatchFor  time.Duration // Ping watch duration (0 = until Ctrl-C)
+	WriteDefaults string        // Write the built-in command files and rules here and exit
+	LogWindow     string        // FROM[,TO] of the change window for logging events
+	TraceTargets  string        // HOST VRF DESTINATION paths to traceroute (see trace_paths.go)
+	MTUSweep      bool          // df-bit MTU test of every core link (see mtu_sweep.go)
+	MTURequired   int           // Packet size every core link must carry
+	MTURoles      string        // Roles whose links are swept (empty = all targets)
+	FlowMonitor   string        // Flow monitor whose cache is recorded per VRF (see flow_cache.go)
+	Warmup        bool          // Log in to every target before the run (see warmup.go)
+	WarmupSlow    time.Duration // Warm-up logins slower than this are reported SLOW
+	RetryFailed   string        // Run directory whose failed devices are collected again and merged
+	PairSkew      int           // Node pairs: max percent of the pair's traffic on one member (0 = off)
+	CompareResult string        // OLD,NEW validation result sets to diff
+	ProfilesFile  string        // Check profiles per role/platform (see check_profiles.go)
+	ThresholdFile string        // Named validation limits per check, VRF priority and role (see thresholds.go)
+
+	// Unlocked vault entries, keyed by "default" or upper-case hostname
+	Vault map[string]VaultCredential
+	// Output cleaning rules loaded from NoiseFile (or the built-in copy)
+	Noise *NoisePatterns
+	// Compiled PromptRegex (nil = built-in default)
+	Prompt *regexp.Regexp
+	// Persistent sessions shared by all collections of this run (-persist)
+	Pool *sessionPool
+	// Webhook alerts loaded from NotifyFile (nil = off)
+	Notify *notifier
+	// Operator hooks loaded from HooksFile (nil = off)
+	Hooks *hookSet
+	// Audit transcript of AuditWindow (nil = off)
+	Audit *auditLog
+	// Ctrl-C and SIGTERM handling of the run (nil = not installed)
+	Stop *shutdown
+	// Unreachable-device breaker of BreakerAfter (nil = off)
+	Breaker *circuitBreaker
+	// Parsed Retries, RetryBackoff, RetryJitter and RetryOn (nil = off)
+	Retry *retryPolicy
+	// Parsed SNMPVersion, SNMPCommunity, SNMPUser, SNMPAuth and SNMPPriv
+	SNMP *snmpConfig
+	// Check profiles loaded from ProfilesFile (nil = same checks for all)
+	Profiles *checkProfiles
+	// Validation limits loaded from ThresholdFile (nil = flags only)
+	Limits *thresholdSet
+	// Parsed CompareTol
+	Bands *toleranceBands
+	// Parsed PingThresh
+	Ping *pingThresholds
+	// Parsed DisjointVRFs and SharedRanges (nil = no overlap findings)
+	Fleet *fleetPolicy
+	// Parsed Export
+	Exports map[string]bool
+	// Parsed Store
+	Stores []runStore
+	// Config change watch of a window or runbook (nil = off)
+	Changes *changeWatcher
+	// Parsed LogWindow (nil = off)
+	Logs *logWindow
+	// Loaded VRFCatalogue, nil without one
+	VRFs *vrfCatalogue
+	// Parsed TraceTargets, per upper-case hostname
+	Traces map[string][]TraceTarget
 }
 
 // ============================================================================
-// FILE PARSERS
+// FILE PARSERS (inventory loaders are in inventory.go)
 // ============================================================================
 
-func parseCSV(filename string) (map[string]DeviceInfo, error) {
-	devices := make(map[string]DeviceInfo)
-
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	reader.TrimLeadingSpace = true
-	reader.FieldsPerRecord = -1
-
-	records, err := reader.ReadAll()
-	if err != nil {
-		return nil, err
-	}
-
-	for i, record := range records {
-		if i == 0 {
-			continue
-		}
-		if len(record) < 2 {
-			continue
-		}
-
-		hostname := strings.TrimSpace(record[0])
-		ipAddress := strings.TrimSpace(record[1])
-		var deviceType, site, role string
-		if len(record) > 2 {
-			deviceType = strings.TrimSpace(record[2])
-		}
-		if len(record) > 3 {
-			site = strings.TrimSpace(record[3])
-		}
-		if len(record) > 4 {
-			role = strings.TrimSpace(record[4])
-		}
-
-		if hostname != "" && ipAddress != "" {
-			detectedOS := detectDeviceOS(deviceType)
-			devices[strings.ToUpper(hostname)] = DeviceInfo{
-				Hostname:   hostname,
-				IPAddress:  ipAddress,
-				DeviceType: deviceType,
-				Site:       site,
-				Role:       role,
-				DetectedOS: detectedOS,
-			}
-		}
-	}
-
-	return devices, nil
-}
-
-type xlsxSST struct {
-	SI []struct {
-		T string `xml:"t"`
-	} `xml:"si"`
-}
-
-type xlsxWorksheet struct {
-	SheetData struct {
-		Rows []struct {
-			Cells []struct {
-				R string `xml:"r,attr"`
-				T string `xml:"t,attr"`
-				V string `xml:"v"`
-			} `xml:"c"`
-		} `xml:"row"`
-	} `xml:"sheetData"`
-}
-
-func parseXLSX(filename string) (map[string]DeviceInfo, error) {
-	devices := make(map[string]DeviceInfo)
-
-	r, err := zip.OpenReader(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer r.Close()
-
-	var sharedStrings []string
-	for _, f := range r.File {
-		if f.Name == "xl/sharedStrings.xml" {
-			rc, _ := f.Open()
-			content, _ := io.ReadAll(rc)
-			rc.Close()
-			var sst xlsxSST
-			xml.Unmarshal(content, &sst)
-			for _, si := range sst.SI {
-				sharedStrings = append(sharedStrings, si.T)
-			}
-			break
-		}
-	}
-
-	for _, f := range r.File {
-		if strings.Contains(f.Name, "worksheets/sheet") {
-			rc, _ := f.Open()
-			content, _ := io.ReadAll(rc)
-			rc.Close()
-
-			var ws xlsxWorksheet
-			xml.Unmarshal(content, &ws)
-
-			for rowIdx, row := range ws.SheetData.Rows {
-				if rowIdx == 0 {
-					continue
-				}
-
-				rowData := make(map[string]string)
-				for _, cell := range row.Cells {
-					col := ""
-					for _, c := range cell.R {
-						if c >= 'A' && c <= 'Z' {
-							col += string(c)
-						} else {
-							break
-						}
-					}
-					val := cell.V
-					if cell.T == "s" {
-						idx, _ := strconv.Atoi(val)
-						if idx < len(sharedStrings) {
-							val = sharedStrings[idx]
-						}
-					}
-					rowData[col] = strings.TrimSpace(val)
-				}
-
-				hostname := rowData["A"]
-				ipAddress := rowData["B"]
-				deviceType := rowData["C"]
-
-				if hostname != "" && ipAddress != "" {
-					detectedOS := detectDeviceOS(deviceType)
-					devices[strings.ToUpper(hostname)] = DeviceInfo{
-						Hostname:   hostname,
-						IPAddress:  ipAddress,
-						DeviceType: deviceType,
-						Site:       rowData["D"],
-						Role:       rowData["E"],
-						DetectedOS: detectedOS,
-					}
-				}
-			}
-			break
-		}
-	}
-
-	return devices, nil
-}
-
-func loadHostInventory(filename string) (map[string]DeviceInfo, error) {
-	ext := strings.ToLower(filepath.Ext(filename))
-	if ext == ".csv" {
-		return parseCSV(filename)
-	}
-	if ext == ".xlsx" {
-		devices, err := parseXLSX(filename)
-		if err != nil || len(devices) == 0 {
-			csvFile := strings.TrimSuffix(filename, ext) + ".csv"
-			if _, e := os.Stat(csvFile); e == nil {
-				return parseCSV(csvFile)
-			}
-		}
-		return devices, err
-	}
-	return parseCSV(filename)
-}
-
 func readLines(filename string) ([]string, error) {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -338,9 +282,118 @@ type SSHClient struct {
 	username   string
 	password   string
 	cmdTimeout time.Duration
+	idleLimit  time.Duration // kill the session after this long without output (0 = off)
+	noise      []noiseRule   // output cleaning rules for the device OS
+	proxy      string
+	algos      string // ssh algorithm overrides (see ssh_algorithms.go)
+	keyFile    string
+	keyPass    string
+	progress   func(command string) // heartbeat for the stall monitor
+	expect     bool                 // prompt-driven session instead of the piped script
+	promptRe   *regexp.Regexp       // nil = defaultPromptRegex
+	deadline   time.Duration        // per-command prompt wait in expect sessions
+	pool       *sessionPool         // run batches on a persistent session
+	name       string               // inventory hostname, for recordings
+	record     string               // directory for session casts ("" = off)
+	audit      *auditLog            // -audit transcript, nil = off
+	stop       *shutdown            // aborts the session on Ctrl-C, nil = never
+	breaker    *circuitBreaker      // fails fast on unreachable devices, nil = off
+	retry      *retryPolicy         // retries transient failures, nil = off
+	enable     string               // enable secret for a user EXEC login (see enable_mode.go)
+	native     bool                 // Go ssh stack instead of OpenSSH (see native_ssh.go)
+
+	mu       sync.Mutex
+	kill     func() // ends the running session, nil when there is none
+	aborted  chan struct{}
+	abortMsg string
+}
+
+// abort kills the running ssh session; ExecuteCommands then fails with reason
+func (c *SSHClient) abort(reason string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.kill == nil || c.abortMsg != "" {
+		return false
+	}
+	c.abortMsg = reason
+	c.kill()
+	close(c.aborted)
+	return true
 }
 
+// ExecuteCommands runs commands in one session under the run context
 func (c *SSHClient) ExecuteCommands(commands []string) (map[string]string, error) {
+	return c.ExecuteContext(c.stop.context(), commands)
+}
+
+// ExecuteContext runs commands in one session, aborting it when ctx is done,
+// and retries transient failures (ssh_retry.go); it starts no session once
+// ctx is done or while the device is marked unreachable (circuit_breaker.go)
+func (c *SSHClient) ExecuteContext(ctx context.Context, commands []string) (map[string]string, error) {
+	return c.execute(ctx, commands, true)
+}
+
+// ExecuteConfig runs a configuration batch under the run context. A lost
+// session is retried only when no command of the batch ran: resuming in the
+// middle would send the rest outside configure mode.
+func (c *SSHClient) ExecuteConfig(commands []string) (map[string]string, error) {
+	return c.execute(c.stop.context(), commands, false)
+}
+
+// execute runs commands with retries; resume picks a lost batch up at the
+// first command without output, otherwise only a batch that did not start
+// is tried again. When commands are left unrun, the output received is
+// returned with an *incompleteBatchError.
+func (c *SSHClient) execute(ctx context.Context, commands []string, resume bool) (map[string]string, error) {
+	results := make(map[string]string)
+	pending := commands
+	for retry := 0; ; retry++ {
+		outputs, err := c.executeSession(ctx, pending)
+		for cmd, out := range outputs {
+			results[cmd] = out
+		}
+		if err == nil {
+			return results, nil
+		}
+		class := c.retry.transient(err)
+		if class != "" && retry < c.retry.count && (resume || len(results) == 0) {
+			wait := c.retry.wait(retry + 1)
+			log.Printf("↻ %s: %v (%s), retry %d/%d in %s", breakerName(c), err, class, retry+1, c.retry.count, wait)
+			if sleepContext(ctx, wait) {
+				pending = pendingCommands(commands, results)
+				continue
+			}
+		}
+		if len(results) == 0 {
+			return nil, err
+		}
+		// Keep the output of a lost session
+		notRun := pendingCommands(commands, results)
+		for _, cmd := range notRun {
+			results[cmd] = fmt.Sprintf("(not run: %v)", err)
+		}
+		return results, &incompleteBatchError{notRun: len(notRun), total: len(commands), err: err}
+	}
+}
+
+// executeSession runs one session under ctx and records it in the audit
+// transcript
+func (c *SSHClient) executeSession(ctx context.Context, commands []string) (map[string]string, error) {
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("%s", ctxReason(ctx))
+	}
+	if err := c.breaker.allow(c); err != nil {
+		return nil, err
+	}
+	cancel := context.AfterFunc(ctx, func() { c.abort(ctxReason(ctx)) })
+	outputs, err := c.executeCommands(commands)
+	cancel()
+	c.breaker.observe(c, outputs, err)
+	c.audit.commands(c, commands, outputs, err)
+	return outputs, err
+}
+
+func (c *SSHClient) executeCommands(commands []string) (map[string]string, error) {
 	results := make(map[string]string)
 
 	var script strings.Builder
@@ -354,39 +407,132 @@ func (c *SSHClient) ExecuteCommands(commands []string) (map[string]string, error
 	}
 	script.WriteString("exit\n")
 
+	proxyArgs, err := sshProxyArgs(c.proxy)
+	if err != nil {
+		return nil, err
+	}
+
 	sshArgs := []string{
 		"-o", "StrictHostKeyChecking=no",
-		"-o", "UserKnownHostsFile=/dev/null",
+		"-o", "UserKnownHostsFile=" + os.DevNull,
 		"-o", "ConnectTimeout=30",
 		"-o", "LogLevel=ERROR",
 		"-p", strconv.Itoa(c.port),
 		"-t", "-t",
-		fmt.Sprintf("%s@%s", c.username, c.host),
 	}
+	sshArgs = append(sshArgs, proxyArgs...)
+	sshArgs = append(sshArgs, fmt.Sprintf("%s@%s", c.username, c.host))
 
-	cmd := exec.Command("sshpass", append([]string{"-p", c.password, "ssh"}, sshArgs...)...)
-
-	stdin, _ := cmd.StdinPipe()
-	var output strings.Builder
-	cmd.Stdout = &output
-	cmd.Stderr = &output
+	if c.pool != nil {
+		return c.pool.execute(c, sshArgs, commands)
+	}
+	if c.expect {
+		return c.executeInteractive(sshArgs, commands)
+	}
 
-	cmd.Start()
-	io.WriteString(stdin, script.String())
-	stdin.Close()
+	output := &heartbeatWriter{commands: commands, beat: c.progress}
+	sh, err := c.startShell(sshArgs, output)
+	if err != nil {
+		return nil, err
+	}
+	output.touch()
+	c.mu.Lock()
+	c.kill = sh.kill
+	c.aborted = make(chan struct{})
+	c.abortMsg = "" // a new session, so a retry is not failed by the last abort
+	aborted := c.aborted
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.kill = nil
+		c.mu.Unlock()
+	}()
 
-	done := make(chan error)
-	go func() { done <- cmd.Wait() }()
+	// Written in the background so a session that never reads stdin is
+	// still bounded by the timeout
+	go func() {
+		io.WriteString(sh.stdin, script.String())
+		sh.stdin.Close()
+	}()
 
-	select {
-	case <-done:
-	case <-time.After(c.cmdTimeout):
-		cmd.Process.Kill()
-		return nil, fmt.Errorf("timeout")
+	// Buffered so the waiter can always deliver and exit, even when we
+	// stopped listening after a timeout
+	done := make(chan error, 1)
+	go func() { done <- sh.wait() }()
+
+	timeout := time.NewTimer(c.cmdTimeout)
+	defer timeout.Stop()
+	// -cmd-deadline bounds each command when it is shorter than -timeout
+	deadline := c.deadline
+	if deadline >= c.cmdTimeout {
+		deadline = 0
+	}
+	var idleCheck <-chan time.Time
+	if c.idleLimit > 0 || deadline > 0 {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		idleCheck = ticker.C
+	}
+
+	stuck := -1 // command cut off by the deadline
+	var waitErr error
+wait:
+	for {
+		select {
+		case waitErr = <-done:
+			break wait
+		case <-timeout.C:
+			sh.kill()
+			return nil, fmt.Errorf("timeout")
+		case <-idleCheck:
+			if quiet := output.quietFor(); c.idleLimit > 0 && quiet >= c.idleLimit {
+				sh.kill()
+				return nil, fmt.Errorf("no output for %s (idle timeout)", quiet.Round(time.Second))
+			}
+			if i, running := output.running(); deadline > 0 && i >= 0 && running >= deadline {
+				// Keep what the earlier commands returned, as expect
+				// sessions do; the output is complete once Wait returns
+				sh.kill()
+				<-done
+				stuck = i
+				break wait
+			}
+		case <-aborted:
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return nil, fmt.Errorf("%s", c.abortMsg)
+		}
 	}
 
 	fullOutput := output.String()
+	// ssh failed: before the first command nothing ran, ssh says why it
+	// could not log in; later the session was lost with the rest of the
+	// batch (see ssh_retry.go)
+	lost := -1
+	if waitErr != nil && stuck < 0 {
+		why := lastLine([]byte(fullOutput))
+		if why == "" {
+			why = waitErr.Error()
+		}
+		if !strings.Contains(fullOutput, "===START_0===") {
+			return nil, fmt.Errorf("%s", why)
+		}
+		for i := range commands {
+			if !strings.Contains(fullOutput, fmt.Sprintf("===END_%d===", i)) {
+				lost = i
+				waitErr = fmt.Errorf("session lost after %d of %d commands: %s", i, len(commands), why)
+				break
+			}
+		}
+	}
 	for i, cmdStr := range commands {
+		if lost >= 0 && i >= lost {
+			break
+		}
+		if stuck >= 0 && i > stuck {
+			results[cmdStr] = "(not run: previous command did not complete)"
+			continue
+		}
 		start := fmt.Sprintf("===START_%d===", i)
 		end := fmt.Sprintf("===END_%d===", i)
 
@@ -398,53 +544,19 @@ func (c *SSHClient) ExecuteCommands(commands []string) (map[string]string, error
 		startIdx += len(start)
 
 		endIdx := strings.Index(fullOutput[startIdx:], end)
-		if endIdx == -1 {
+		if i == stuck && endIdx == -1 {
+			results[cmdStr] = strings.TrimSpace(cleanOutput(fullOutput[startIdx:], c.noise) +
+				fmt.Sprintf("\n(incomplete: %s)", deadlineMsg(deadline)))
+		} else if endIdx == -1 {
 			results[cmdStr] = strings.TrimSpace(fullOutput[startIdx:])
 		} else {
-			results[cmdStr] = cleanOutput(fullOutput[startIdx : startIdx+endIdx])
+			results[cmdStr] = cleanOutput(fullOutput[startIdx:startIdx+endIdx], c.noise)
 		}
 	}
-
-	return results, nil
-}
-
-func cleanOutput(s string) string {
-	lines := strings.Split(s, "\n")
-	var clean []string
-	for _, line := range lines {
-		t := strings.TrimSpace(line)
-		if t == "" || strings.HasPrefix(t, "terminal ") || strings.Contains(t, "===") {
-			continue
-		}
-		if strings.Contains(t, "Pseudo-terminal") {
-			continue
-		}
-		// Skip IOS.sh shell warning messages
-		if strings.Contains(t, "IOS.sh") || 
-		   strings.Contains(t, "shell is currently disabled") ||
-		   strings.Contains(t, "term shell") ||
-		   strings.Contains(t, "shell processing full") ||
-		   strings.Contains(t, "man command") ||
-		   strings.Contains(t, "man IOS.sh") ||
-		   strings.Contains(t, "The command you have entered") ||
-		   strings.Contains(t, "You can enable") ||
-		   strings.Contains(t, "You can also enable") ||
-		   strings.Contains(t, "For more information") ||
-		   strings.Contains(t, "However, the shell") ||
-		   strings.Contains(t, "There is additional information") {
-			continue
-		}
-		// Skip prompts with commands echoed (e.g., "Switch1#show ip interface brief")
-		if regexp.MustCompile(`^[A-Za-z0-9_-]+[#>]`).MatchString(t) && strings.Contains(t, "show ") {
-			continue
-		}
-		// Skip standalone prompts
-		if regexp.MustCompile(`^[A-Za-z0-9_-]+[#>]$`).MatchString(t) {
-			continue
-		}
-		clean = append(clean, line)
+	if lost >= 0 {
+		return results, waitErr
 	}
-	return strings.TrimSpace(strings.Join(clean, "\n"))
+	return results, nil
 }
 
 // ============================================================================
@@ -461,30 +573,30 @@ type CommandSet struct {
 func loadAllCommands(config *Config) (*CommandSet, error) {
 	cs := &CommandSet{}
 
-	if cmds, err := readLines(config.CommandFileXR); err == nil {
+	if cmds, source, err := loadCommandFile(config.CommandFileXR); err == nil {
 		cs.IOSXR = cmds
-		log.Printf("✓ Loaded %d IOS-XR commands from %s", len(cmds), config.CommandFileXR)
+		log.Printf("✓ Loaded %d IOS-XR commands from %s", len(cmds), source)
 	} else {
 		log.Printf("✗ IOS-XR commands not found: %s", config.CommandFileXR)
 	}
 
-	if cmds, err := readLines(config.CommandFileXE); err == nil {
+	if cmds, source, err := loadCommandFile(config.CommandFileXE); err == nil {
 		cs.IOSXE = cmds
-		log.Printf("✓ Loaded %d IOS-XE commands from %s", len(cmds), config.CommandFileXE)
+		log.Printf("✓ Loaded %d IOS-XE commands from %s", len(cmds), source)
 	} else {
 		log.Printf("✗ IOS-XE commands not found: %s", config.CommandFileXE)
 	}
 
-	if cmds, err := readLines(config.CommandFileL2); err == nil {
+	if cmds, source, err := loadCommandFile(config.CommandFileL2); err == nil {
 		cs.L2Switch = cmds
-		log.Printf("✓ Loaded %d L2-Switch commands from %s", len(cmds), config.CommandFileL2)
+		log.Printf("✓ Loaded %d L2-Switch commands from %s", len(cmds), source)
 	} else {
 		log.Printf("✗ L2-Switch commands not found: %s", config.CommandFileL2)
 	}
 
-	if cmds, err := readLines(config.CommandFile); err == nil {
+	if cmds, source, err := loadCommandFile(config.CommandFile); err == nil {
 		cs.Default = cmds
-		log.Printf("✓ Loaded %d default commands from %s", len(cmds), config.CommandFile)
+		log.Printf("✓ Loaded %d default commands from %s", len(cmds), source)
 	} else {
 		return nil, fmt.Errorf("default commands required: %s", config.CommandFile)
 	}
@@ -522,7 +634,43 @@ type DeviceResult struct {
 	CommandFile  string
 }
 
-func processDevice(device DeviceInfo, config *Config, commands *CommandSet) *DeviceResult {
+// newDeviceClient builds the ssh client for a device from the run config
+func newDeviceClient(device DeviceInfo, config *Config) *SSHClient {
+	client := &SSHClient{
+		host:       device.IPAddress,
+		port:       config.SSHPort,
+		username:   config.Username,
+		password:   config.Password,
+		cmdTimeout: config.CmdTimeout,
+		idleLimit:  config.IdleTimeout,
+		proxy:      config.Proxy,
+		keyFile:    config.KeyFile,
+		keyPass:    config.KeyPass,
+	}
+	if device.Proxy != "" {
+		client.proxy = device.Proxy
+	}
+	client.algos = sshAlgorithmsOf(device, config)
+	if device.KeyFile != "" {
+		client.keyFile, client.keyPass = device.KeyFile, device.KeyPass
+	}
+	client.noise = config.Noise.forOS(device.DetectedOS)
+	if cred, ok := config.vaultCredential(device); ok {
+		client.username, client.password = cred.Username, cred.Password
+	}
+	client.enable = enableSecretOf(device, config, client.password)
+	// Only a prompt-driven session can answer the enable prompt
+	client.expect = useExpect(config.Session, device.DetectedOS) || (client.enable != "" && config.Session == "auto")
+	client.promptRe, client.deadline = config.Prompt, config.CmdDeadline
+	client.pool = config.Pool
+	client.name, client.record = device.Hostname, config.RecordDir
+	client.audit, client.stop, client.breaker = config.Audit, config.Stop, config.Breaker
+	client.retry = config.Retry
+	client.native = config.SSHImpl == "native"
+	return client
+}
+
+func processDevice(device DeviceInfo, config *Config, commands *CommandSet, hb *workerHeartbeat) *DeviceResult {
 	result := &DeviceResult{
 		Device:  device,
 		Results: []ExecutionResult{},
@@ -531,17 +679,11 @@ func processDevice(device DeviceInfo, config *Config, commands *CommandSet) *Dev
 
 	osType := device.DetectedOS
 	cmds := commands.GetCommandsForOS(osType)
-
-	switch osType {
-	case "IOS-XR":
-		result.CommandFile = config.CommandFileXR
-	case "IOS-XE":
-		result.CommandFile = config.CommandFileXE
-	case "L2-SWITCH":
-		result.CommandFile = config.CommandFileL2
-	default:
-		result.CommandFile = config.CommandFile
+	result.CommandFile = commandFileForOS(config, osType)
+	if extra := append(traceCommands(config.Traces, device), config.VRFs.pingCommands(device)...); len(extra) > 0 {
+		cmds = mergeCommands(append([]string{}, cmds...), extra)
 	}
+	cmds = config.Profiles.filterCommands(device, cmds)
 
 	if config.Verbose {
 		log.Printf("  → %s (%s) | Type: %s | OS: %s | Cmds: %d",
@@ -552,35 +694,63 @@ func processDevice(device DeviceInfo, config *Config, commands *CommandSet) *Dev
 		return result
 	}
 
-	client := &SSHClient{
-		host:       device.IPAddress,
-		port:       config.SSHPort,
-		username:   config.Username,
-		password:   config.Password,
-		cmdTimeout: config.CmdTimeout,
+	client := newDeviceClient(device, config)
+	hb.attach(client)
+
+	transports := transportsOf(device, config)
+	for i, transport := range transports {
+		var results []ExecutionResult
+		var err error
+		switch transport {
+		case "netconf":
+			results, err = collectNetconf(client, config.NetconfPort, device)
+			result.CommandFile = "netconf"
+		case "snmp":
+			results, err = collectSNMP(client, config.SNMP, device)
+			result.CommandFile = "snmp"
+		default:
+			results, err = collectCLI(client, device, config, cmds)
+			result.CommandFile = commandFileForOS(config, osType)
+		}
+		if err == nil {
+			result.Results = results
+			return result
+		}
+		if i == len(transports)-1 {
+			result.Success = false
+			result.ErrorMessage = err.Error()
+			return result
+		}
+		log.Printf("⚠ %s: %s failed (%v), falling back to %s", device.Hostname, strings.ToUpper(transport), err, strings.ToUpper(transports[i+1]))
 	}
+	return result
+}
 
+// collectCLI runs the device's commands over ssh
+func collectCLI(client *SSHClient, device DeviceInfo, config *Config, cmds []string) ([]ExecutionResult, error) {
 	startTime := time.Now()
-	outputs, err := client.ExecuteCommands(cmds)
+	used, outputs, err := executeWithFallback(client, cmds)
 	duration := time.Since(startTime)
-
 	if err != nil {
-		result.Success = false
-		result.ErrorMessage = err.Error()
-		return result
+		return nil, err
 	}
 
-	for _, cmd := range cmds {
-		result.Results = append(result.Results, ExecutionResult{
+	results := []ExecutionResult{}
+	for _, cmd := range used {
+		results = append(results, ExecutionResult{
 			Hostname:  device.Hostname,
 			IPAddress: device.IPAddress,
 			Command:   cmd,
 			Output:    outputs[cmd],
 			Duration:  duration / time.Duration(len(cmds)),
+			Stamp:     newSampleStamp(),
 		})
 	}
 
-	return result
+	if config.Redundancy && device.StandbyIP != "" {
+		results = append(results, collectStandby(device, config)...)
+	}
+	return results, nil
 }
 
 // ============================================================================
@@ -602,7 +772,7 @@ func NewOutputWriter(outputDir, phase string) *OutputWriter {
 
 func (w *OutputWriter) WriteDevice(result *DeviceResult) error {
 	filename := filepath.Join(w.dir, fmt.Sprintf("%s_%s.log", result.Device.Hostname, w.timestamp))
-	file, err := os.Create(filename)
+	file, err := createAtomic(filename)
 	if err != nil {
 		return err
 	}
@@ -613,7 +783,16 @@ func (w *OutputWriter) WriteDevice(result *DeviceResult) error {
 	fmt.Fprintf(file, " Phase: %s\n", w.phase)
 	fmt.Fprintf(file, "================================================================================\n")
 	fmt.Fprintf(file, " Hostname:     %s\n", result.Device.Hostname)
+	if result.Device.Alias != "" {
+		fmt.Fprintf(file, " Alias:        %s\n", result.Device.Alias)
+	}
 	fmt.Fprintf(file, " IP Address:   %s\n", result.Device.IPAddress)
+	if result.Device.StandbyIP != "" {
+		fmt.Fprintf(file, " Standby IP:   %s\n", result.Device.StandbyIP)
+	}
+	if result.Device.Pair != "" {
+		fmt.Fprintf(file, " Pair:         %s\n", result.Device.Pair)
+	}
 	fmt.Fprintf(file, " Device Type:  %s\n", result.Device.DeviceType)
 	fmt.Fprintf(file, " Detected OS:  %s\n", result.Device.DetectedOS)
 	fmt.Fprintf(file, " Command File: %s\n", result.CommandFile)
@@ -627,6 +806,9 @@ func (w *OutputWriter) WriteDevice(result *DeviceResult) error {
 	for _, r := range result.Results {
 		fmt.Fprintf(file, "--------------------------------------------------------------------------------\n")
 		fmt.Fprintf(file, " Command: %s\n", r.Command)
+		if !r.Stamp.IsZero() {
+			fmt.Fprintf(file, " Sampled: %s\n", r.Stamp)
+		}
 		fmt.Fprintf(file, "--------------------------------------------------------------------------------\n")
 		if r.Output == "" {
 			fmt.Fprintf(file, "(no output)\n")
@@ -643,7 +825,7 @@ func (w *OutputWriter) WriteDevice(result *DeviceResult) error {
 // WriteSummaryCSV creates a CSV summary of key metrics per device/command
 func (w *OutputWriter) WriteSummaryCSV(results []*DeviceResult) error {
 	filename := filepath.Join(w.dir, fmt.Sprintf("SUMMARY_%s.csv", w.timestamp))
-	file, err := os.Create(filename)
+	file, err := createAtomic(filename)
 	if err != nil {
 		return err
 	}
@@ -662,11 +844,16 @@ func (w *OutputWriter) WriteSummaryCSV(results []*DeviceResult) error {
 
 		for _, exec := range r.Results {
 			metrics := extractMetrics(exec.Command, exec.Output)
-			for metricName, metricValue := range metrics {
+			names := make([]string, 0, len(metrics))
+			for metricName := range metrics {
+				names = append(names, metricName)
+			}
+			sort.Strings(names)
+			for _, metricName := range names {
 				fmt.Fprintf(file, "%s,%s,%s,%s,%s,%s,%s,%s,%s\n",
 					w.phase, w.timestamp, r.Device.Hostname, r.Device.IPAddress,
 					r.Device.DeviceType, r.Device.DetectedOS,
-					exec.Command, metricName, metricValue)
+					exec.Command, metricName, metrics[metricName])
 			}
 		}
 	}
@@ -674,13 +861,83 @@ func (w *OutputWriter) WriteSummaryCSV(results []*DeviceResult) error {
 	return nil
 }
 
+// metricCategory names the parser extractMetrics uses for a command ("" = none)
+func metricCategory(command string) string {
+	switch {
+	case strings.HasPrefix(command, "netconf:"):
+		return "netconf"
+	case strings.HasPrefix(command, "snmp:"):
+		return "snmp"
+	case isPingCommand(command):
+		return "ping"
+	case isFilesystemCommand(command):
+		return "filesystem"
+	case traceCmdRe.MatchString(command):
+		return "traceroute"
+	case flowCmdRe.MatchString(command):
+		return "flow-cache"
+	case strings.Contains(command, "show version"):
+		return "version"
+	case strings.Contains(command, "ospf neighbor"):
+		return "ospf"
+	case strings.Contains(command, "isis neighbors") || strings.Contains(command, "isis adjacency"):
+		return "isis"
+	case strings.Contains(command, "bgp summary") || strings.Contains(command, "bgp vpnv4"):
+		return "bgp"
+	case strings.Contains(command, "mpls ldp neighbor"):
+		return "ldp"
+	case strings.Contains(command, "mpls forwarding"):
+		return "mpls-forwarding"
+	case strings.Contains(command, "route") && strings.Contains(command, "summary"):
+		return "route-summary"
+	case isShowInterfacesDetail(command):
+		return "interfaces"
+	case strings.Contains(command, "interface") && strings.Contains(command, "brief"):
+		return "interface-brief"
+	case isVRFCommand(command):
+		return "vrf"
+	case strings.Contains(command, "bfd"):
+		return "bfd"
+	case strings.Contains(command, "xconnect") || strings.Contains(command, "l2vpn"):
+		return "l2vpn"
+	}
+	return ""
+}
+
 // extractMetrics parses command output and extracts key metrics
 func extractMetrics(command, output string) map[string]string {
 	metrics := make(map[string]string)
 	lines := strings.Split(output, "\n")
 
-	switch {
-	case strings.Contains(command, "show version"):
+	switch metricCategory(command) {
+	case "netconf":
+		return netconfMetrics(command, output)
+
+	case "snmp":
+		return snmpMetrics(command, output)
+
+	case "ping":
+		if p, ok := parsePingOutput(command, output); ok {
+			metrics = pingMetrics(p)
+		}
+
+	case "filesystem":
+		metrics = filesystemMetrics(output)
+
+	case "traceroute":
+		if paths := parseTracePaths([]ExecutionResult{{Command: command, Output: output}}, nil); len(paths) == 1 {
+			metrics["Trace_Hops"] = strconv.Itoa(len(paths[0].Hops))
+			metrics["Trace_Reached"] = map[bool]string{true: "Yes", false: "No"}[paths[0].Reached]
+		}
+
+	case "flow-cache":
+		flows := 0
+		for _, f := range parseFlowCache(output) {
+			flows += f.Flows
+		}
+		metrics["Flow_Entries"] = strconv.Itoa(flows)
+
+	case "version":
 		for _, line := range lines {
 			if strings.Contains(line, "uptime is") {
 				metrics["Uptime"] = extractAfter(line, "uptime is")
@@ -692,48 +949,55 @@ func extractMetrics(command, output string) map[string]string {
 			}
 		}
 
-	case strings.Contains(command, "ospf neighbor"):
-		count := 0
-		fullCount := 0
-		for _, line := range lines {
-			if strings.Contains(line, "FULL") {
-				fullCount++
-			}
-			// Count lines with IP addresses (neighbor entries)
-			if regexp.MustCompile(`\d+\.\d+\.\d+\.\d+`).MatchString(line) {
-				count++
+	case "ospf":
+		t := parseOSPFNeighbors(output)
+		metrics["OSPF_Neighbors_Total"] = strconv.Itoa(len(t.Neighbors))
+		metrics["OSPF_Neighbors_FULL"] = strconv.Itoa(t.FullCount())
+
+	case "isis":
+		// No metrics on devices that do not run IS-IS, so OSPF-only
+		// devices do not show up in the comparison
+		if t := parseISISNeighbors(output); t.Running {
+			metrics["ISIS_Adjacencies_Total"] = strconv.Itoa(len(t.Neighbors))
+			metrics["ISIS_Adjacencies_Up"] = strconv.Itoa(t.UpCount(""))
+			metrics["ISIS_L1_Up"] = strconv.Itoa(t.UpCount("1"))
+			metrics["ISIS_L2_Up"] = strconv.Itoa(t.UpCount("2"))
+		}
+
+	case "bgp":
+		s := parseBGPSummary(output)
+		metrics["BGP_Neighbors_Total"] = strconv.Itoa(len(s.Neighbors))
+		metrics["BGP_Neighbors_Established"] = strconv.Itoa(s.EstablishedCount())
+		prefixes := 0
+		for _, nb := range s.Neighbors {
+			if nb.Established() {
+				prefixes += nb.PfxRcd
 			}
 		}
-		metrics["OSPF_Neighbors_Total"] = strconv.Itoa(count)
-		metrics["OSPF_Neighbors_FULL"] = strconv.Itoa(fullCount)
+		metrics["BGP_Prefixes_Received"] = strconv.Itoa(prefixes)
 
-	case strings.Contains(command, "bgp summary") || strings.Contains(command, "bgp vpnv4"):
-		established := 0
+	case "ldp":
+		metrics["LDP_Neighbors"] = strconv.Itoa(len(parseLDPNeighbors(output).Neighbors))
+
+	case "mpls-forwarding":
+		if n := parseMPLSLabels(output); n >= 0 {
+			metrics["MPLS_Labels"] = strconv.Itoa(n)
+		}
+
+	case "route-summary":
 		total := 0
-		for _, line := range lines {
-			fields := strings.Fields(line)
-			if len(fields) >= 3 && regexp.MustCompile(`^\d+\.\d+\.\d+\.\d+$`).MatchString(fields[0]) {
-				total++
-				// Check if state/pfxrcd is a number (established) not a state string
-				lastField := fields[len(fields)-1]
-				if _, err := strconv.Atoi(lastField); err == nil {
-					established++
-				}
-			}
+		for vrf, n := range parseRouteSummary(output) {
+			metrics["VRF_Routes_"+vrf] = strconv.Itoa(n)
+			total += n
 		}
-		metrics["BGP_Neighbors_Total"] = strconv.Itoa(total)
-		metrics["BGP_Neighbors_Established"] = strconv.Itoa(established)
+		metrics["Routes_Total"] = strconv.Itoa(total)
 
-	case strings.Contains(command, "mpls ldp neighbor"):
-		count := 0
-		for _, line := range lines {
-			if regexp.MustCompile(`\d+\.\d+\.\d+\.\d+`).MatchString(line) {
-				count++
-			}
+	case "interfaces":
+		if ifaces := parseShowInterfaces(output); len(ifaces) > 0 {
+			metrics = interfaceMetrics(ifaces)
 		}
-		metrics["LDP_Neighbors"] = strconv.Itoa(count)
 
-	case strings.Contains(command, "interface") && strings.Contains(command, "brief"):
+	case "interface-brief":
 		up := 0
 		down := 0
 		admin_down := 0
@@ -751,19 +1015,10 @@ func extractMetrics(command, output string) map[string]string {
 		metrics["Interfaces_Down"] = strconv.Itoa(down)
 		metrics["Interfaces_AdminDown"] = strconv.Itoa(admin_down)
 
-	case strings.Contains(command, "show vrf"):
-		count := 0
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line != "" && !strings.HasPrefix(line, "Name") && !strings.HasPrefix(line, "VRF") {
-				if !strings.Contains(line, "-----") {
-					count++
-				}
-			}
-		}
-		metrics["VRF_Count"] = strconv.Itoa(count)
+	case "vrf":
+		metrics["VRF_Count"] = strconv.Itoa(len(parseVRFTable(output)))
 
-	case strings.Contains(command, "bfd"):
+	case "bfd":
 		up := 0
 		down := 0
 		for _, line := range lines {
@@ -777,7 +1032,7 @@ func extractMetrics(command, output string) map[string]string {
 		metrics["BFD_Sessions_Up"] = strconv.Itoa(up)
 		metrics["BFD_Sessions_Down"] = strconv.Itoa(down)
 
-	case strings.Contains(command, "xconnect") || strings.Contains(command, "l2vpn"):
+	case "l2vpn":
 		up := 0
 		down := 0
 		for _, line := range lines {
@@ -811,7 +1066,7 @@ func extractAfter(line, marker string) string {
 
 func (w *OutputWriter) WriteSummary(results []*DeviceResult) error {
 	filename := filepath.Join(w.dir, fmt.Sprintf("SUMMARY_%s.log", w.timestamp))
-	file, err := os.Create(filename)
+	file, err := createAtomic(filename)
 	if err != nil {
 		return err
 	}
@@ -833,19 +1088,16 @@ func (w *OutputWriter) WriteSummary(results []*DeviceResult) error {
 	fmt.Fprintf(file, " Total: %d | Success: %d | Failed: %d | Rate: %.1f%%\n\n",
 		len(results), success, fail, float64(success)/float64(len(results))*100)
 
-	fmt.Fprintf(file, "%-12s %-15s %-10s %-10s %-10s %s\n",
-		"HOSTNAME", "IP", "TYPE", "OS", "STATUS", "CMD_FILE")
-	fmt.Fprintf(file, "--------------------------------------------------------------------------------\n")
-
+	table := newTextTable("HOSTNAME", "IP", "TYPE", "OS", "STATUS", "CMD_FILE")
 	for _, r := range results {
 		status := "SUCCESS"
 		if !r.Success {
 			status = "FAILED"
 		}
-		fmt.Fprintf(file, "%-12s %-15s %-10s %-10s %-10s %s\n",
-			r.Device.Hostname, r.Device.IPAddress, r.Device.DeviceType,
+		table.add(r.Device.Site, displayName(r.Device), r.Device.IPAddress, r.Device.DeviceType,
 			r.Device.DetectedOS, status, filepath.Base(r.CommandFile))
 	}
+	table.write(file)
 
 	fmt.Fprintf(file, "--------------------------------------------------------------------------------\n")
 	fmt.Fprintf(file, "\nOutput: %s\n", w.dir)
@@ -857,119 +1109,132 @@ func (w *OutputWriter) WriteSummary(results []*DeviceResult) error {
 // COMPARISON FUNCTION - Pre vs Post Migration
 // ============================================================================
 
-func comparePhases(preDir, postDir, outputFile string) error {
-	// Find CSV files
-	preCSV := findCSVFile(preDir)
-	postCSV := findCSVFile(postDir)
-
-	if preCSV == "" || postCSV == "" {
-		return fmt.Errorf("could not find CSV summary files in pre/post directories")
+// comparePhases writes the pre/post report and its CSV and returns the
+// verdict: FAIL, WARN or PASS (see compare_tolerance.go)
+func comparePhases(preDir, postDir, outputFile string, bands *toleranceBands) (string, error) {
+	if bands == nil {
+		bands, _ = parseToleranceBands(defaultCompareTolerance)
 	}
-
-	log.Printf("Comparing:\n  Pre:  %s\n  Post: %s", preCSV, postCSV)
-
-	// Load data
-	preData, err := loadCSVData(preCSV)
+	preData, postData, err := loadSummaryPair(preDir, postDir)
 	if err != nil {
-		return fmt.Errorf("failed to load pre-migration data: %v", err)
+		return "", err
 	}
 
-	postData, err := loadCSVData(postCSV)
-	if err != nil {
-		return fmt.Errorf("failed to load post-migration data: %v", err)
+	keys := make(map[goldenKey]bool)
+	for k := range preData {
+		keys[k] = true
+	}
+	for k := range postData {
+		keys[k] = true
+	}
+	var sorted []goldenKey
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Metric != b.Metric {
+			return a.Metric < b.Metric
+		}
+		return a.Command < b.Command
+	})
+
+	var deltas []PhaseDelta
+	counts := make(map[string]int)
+	for _, k := range sorted {
+		pre, inPre := preData[k]
+		post, inPost := postData[k]
+		d := bands.classifyDelta(k, pre, post, inPre, inPost)
+		deltas = append(deltas, d)
+		counts[d.Status]++
+	}
+	for _, d := range compareInterfaceRuns(preDir, postDir, bands.ifErrors) {
+		deltas = append(deltas, d)
+		counts[d.Status]++
+	}
+	for _, d := range compareL2VPNRuns(preDir, postDir) {
+		deltas = append(deltas, d)
+		counts[d.Status]++
+	}
+	for _, d := range compareQoSRuns(preDir, postDir, bands.qosIfaces) {
+		deltas = append(deltas, d)
+		counts[d.Status]++
+	}
+	for _, d := range compareTERuns(preDir, postDir) {
+		deltas = append(deltas, d)
+		counts[d.Status]++
+	}
+	for _, d := range compareTraceRuns(preDir, postDir) {
+		deltas = append(deltas, d)
+		counts[d.Status]++
+	}
+	for _, d := range compareFlowRuns(preDir, postDir) {
+		deltas = append(deltas, d)
+		counts[d.Status]++
+	}
+	collected := make(map[string]bool)
+	for k := range postData {
+		if k.Command != "CONNECTION" {
+			collected[strings.ToUpper(k.Host)] = true
+		}
+	}
+	for _, d := range compareTopologyRuns(preDir, postDir, filepath.Dir(outputFile), collected) {
+		deltas = append(deltas, d)
+		counts[d.Status]++
+	}
+	sort.SliceStable(deltas, func(i, j int) bool { return deltas[i].Host < deltas[j].Host })
+	verdict := "PASS"
+	switch {
+	case counts["FAIL"] > 0:
+		verdict = "FAIL"
+	case counts["WARN"] > 0:
+		verdict = "WARN"
 	}
 
 	// Create comparison report
-	file, err := os.Create(outputFile)
+	file, err := createAtomic(outputFile)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer file.Close()
 
 	fmt.Fprintf(file, "================================================================================\n")
 	fmt.Fprintf(file, " MERALCO Pre/Post Migration Comparison Report\n")
 	fmt.Fprintf(file, " Generated: %s\n", time.Now().Format("2006-01-02 15:04:05"))
-	fmt.Fprintf(file, "================================================================================\n\n")
-
-	// Get all unique hostnames
-	hostnames := make(map[string]bool)
-	for key := range preData {
-		parts := strings.Split(key, "|")
-		if len(parts) > 0 {
-			hostnames[parts[0]] = true
-		}
-	}
-	for key := range postData {
-		parts := strings.Split(key, "|")
-		if len(parts) > 0 {
-			hostnames[parts[0]] = true
-		}
-	}
-
-	// Sort hostnames
-	var sortedHosts []string
-	for h := range hostnames {
-		sortedHosts = append(sortedHosts, h)
-	}
-	sort.Strings(sortedHosts)
-
-	// Compare each host
-	for _, hostname := range sortedHosts {
-		fmt.Fprintf(file, "\n=== %s ===\n", hostname)
-		fmt.Fprintf(file, "%-40s %-15s %-15s %-10s\n", "Metric", "Pre-Migration", "Post-Migration", "Status")
-		fmt.Fprintf(file, "--------------------------------------------------------------------------------\n")
-
-		// Get all metrics for this host
-		metrics := make(map[string]bool)
-		for key := range preData {
-			if strings.HasPrefix(key, hostname+"|") {
-				parts := strings.Split(key, "|")
-				if len(parts) >= 2 {
-					metrics[parts[1]] = true
-				}
-			}
-		}
-		for key := range postData {
-			if strings.HasPrefix(key, hostname+"|") {
-				parts := strings.Split(key, "|")
-				if len(parts) >= 2 {
-					metrics[parts[1]] = true
-				}
-			}
-		}
+	fmt.Fprintf(file, " Tolerance: %s (warn/fail %%)\n", bands.spec)
+	fmt.Fprintf(file, " Pre:       %s\n", comparedRunDir(preDir))
+	fmt.Fprintf(file, " Post:      %s\n", comparedRunDir(postDir))
+	fmt.Fprintf(file, " Verdict:   %s | PASS: %d | WARN: %d | FAIL: %d\n", verdict, counts["PASS"], counts["WARN"], counts["FAIL"])
+	fmt.Fprintf(file, "================================================================================\n")
 
-		for metric := range metrics {
-			key := hostname + "|" + metric
-			preVal := preData[key]
-			postVal := postData[key]
-
-			status := "OK"
-			if preVal != postVal {
-				// Check if it's a numeric comparison
-				preNum, preErr := strconv.Atoi(preVal)
-				postNum, postErr := strconv.Atoi(postVal)
-				if preErr == nil && postErr == nil {
-					if postNum < preNum {
-						status = "⚠ DECREASED"
-					} else if postNum > preNum {
-						status = "↑ INCREASED"
-					} else {
-						status = "OK"
-					}
-				} else {
-					status = "CHANGED"
-				}
+	for i := 0; i < len(deltas); {
+		host := deltas[i].Host
+		fmt.Fprintf(file, "\n=== %s ===\n", displayHost(host))
+		table := newTextTable("Metric", "Pre-Migration", "Post-Migration", "Delta", "Status", "Command")
+		for ; i < len(deltas) && deltas[i].Host == host; i++ {
+			d := deltas[i]
+			table.add("", d.Metric, orDash(d.Pre), orDash(d.Post), orDash(d.Delta), d.Status, d.Command)
+			if d.Reason != "" && d.Status != "PASS" {
+				table.note("    %s", d.Reason)
 			}
-
-			fmt.Fprintf(file, "%-40s %-15s %-15s %-10s\n", metric, preVal, postVal, status)
 		}
+		table.write(file)
 	}
 
 	fmt.Fprintf(file, "\n================================================================================\n")
 	fmt.Fprintf(file, " End of Comparison Report\n")
 	fmt.Fprintf(file, "================================================================================\n")
 
-	return nil
+	if err := writeComparisonCSV(comparisonCSVPath(outputFile), deltas); err != nil {
+		return verdict, err
+	}
+	if err := writeRegressionsCSV(filepath.Join(filepath.Dir(outputFile), "regressions.csv"), deltas); err != nil {
+		return verdict, err
+	}
+	return verdict, nil
 }
 
 func findCSVFile(dir string) string {
@@ -996,46 +1261,219 @@ func findCSVFile(dir string) string {
 	return ""
 }
 
-func loadCSVData(filename string) (map[string]string, error) {
-	data := make(map[string]string)
+// ============================================================================
+// MAIN
+// ============================================================================
 
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
+func main() {
+	// Askpass helper mode: stdout is read by ssh, so no banner
+	if isAskpass() {
+		os.Exit(runAskpass())
 	}
-	defer file.Close()
+	config := parseFlags()
+
+	// ProxyCommand helper mode: stdout is the SSH stream, so no banner
+	if config.ProxyConnect != "" {
+		if flag.NArg() != 2 {
+			log.Fatal("-proxy-connect requires: host port")
+		}
+		if err := runProxyConnect(config.ProxyConnect, flag.Arg(0), flag.Arg(1)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if config.ProxyExec != "" {
+		os.Exit(runProxyExec(config.ProxyExec))
+	}
+
+	fmt.Printf(Banner, Version)
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	if config.VerifyBundle != "" {
+		if err := verifyRunBundle(config.VerifyBundle); err != nil {
+			log.Fatalf("✗ Bundle verification failed: %v", err)
+		}
+		return
+	}
+
+	if config.AuditVerify != "" {
+		if err := verifyAuditTranscript(config.AuditVerify); err != nil {
+			log.Fatalf("✗ Audit transcript verification failed: %v", err)
+		}
+		return
+	}
+	if config.AuditExport != "" {
+		path, err := exportAuditTranscript(config.AuditExport, config.BundleKey)
+		if err != nil {
+			log.Fatalf("✗ Audit export: %v", err)
+		}
+		log.Printf("✓ Audit evidence: %s (check with -verify-bundle)", path)
+		return
+	}
+
+	if config.VaultAction != "" {
+		if err := runVaultCommand(config); err != nil {
+			log.Fatalf("✗ Vault: %v", err)
+		}
+		return
+	}
+
+	if config.WriteDefaults != "" {
+		if err := writeDefaults(config.WriteDefaults); err != nil {
+			log.Fatalf("✗ Write defaults: %v", err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "describe" {
+		commands, err := loadAllCommands(config)
+		if err != nil {
+			log.Fatalf("Failed to load commands: %v", err)
+		}
+		if err := runDescribe(os.Stdout, commands, flag.Args()[1:]); err != nil {
+			log.Fatalf("✗ %v", err)
+		}
+		return
+	}
+
+	noise, err := loadNoisePatterns(config.NoiseFile)
 	if err != nil {
-		return nil, err
+		log.Fatalf("✗ Noise patterns: %v", err)
+	}
+	config.Noise = noise
+	if config.PromptRegex != "" {
+		if config.Prompt, err = regexp.Compile(config.PromptRegex); err != nil {
+			log.Fatalf("✗ -prompt-regex: %v", err)
+		}
+	}
+	if config.CleanCheck != "" {
+		if err := runCleaningCheck(noise, config.CleanCheck); err != nil {
+			log.Fatalf("✗ Cleaning check: %v", err)
+		}
+		return
 	}
 
-	for i, record := range records {
-		if i == 0 {
-			continue // Skip header
+	if config.ParseCheck != "" {
+		if err := runParserCheck(config.ParseCheck); err != nil {
+			log.Fatalf("✗ Parser check: %v", err)
 		}
-		if len(record) >= 9 {
-			// Key: Hostname|Command|MetricName
-			hostname := record[2]
-			command := record[6]
-			metricName := record[7]
-			metricValue := record[8]
-			key := fmt.Sprintf("%s|%s_%s", hostname, command, metricName)
-			data[key] = metricValue
+		return
+	}
+
+	if config.E2ECheck != "" {
+		if err := runE2ECheck(config, config.E2ECheck, config.E2EUpdate); err != nil {
+			log.Fatalf("✗ End-to-end check: %v", err)
 		}
+		return
 	}
 
-	return data, nil
-}
+	if config.NotifyFile != "" {
+		if config.Notify, err = loadNotifier(config.NotifyFile, config.Phase); err != nil {
+			log.Fatalf("✗ Notify: %v", err)
+		}
+		log.Printf("✓ Webhook alerts enabled (%d webhooks)", len(config.Notify.hooks))
+	}
+	if config.HooksFile != "" {
+		if config.Hooks, err = loadHooks(config.HooksFile); err != nil {
+			log.Fatalf("✗ Hooks: %v", err)
+		}
+		log.Printf("✓ Operator hooks enabled (%d hooks)", len(config.Hooks.hooks))
+	}
+	if config.ProfilesFile != "" {
+		if config.Profiles, err = loadCheckProfiles(config.ProfilesFile); err != nil {
+			log.Fatalf("✗ Check profiles: %v", err)
+		}
+	}
+	if config.ThresholdFile != "" {
+		if config.Limits, err = loadThresholds(config.ThresholdFile); err != nil {
+			log.Fatalf("✗ Thresholds: %v", err)
+		}
+		if err := config.Limits.applyFlags(); err != nil {
+			log.Fatalf("✗ Thresholds: %v", err)
+		}
+	}
+	if config.IfErrThresh < 0 {
+		log.Fatal("✗ -if-error-threshold must not be negative")
+	}
+	if config.Bands, err = parseToleranceBands(config.CompareTol); err != nil {
+		log.Fatalf("✗ -compare-tolerance %v", err)
+	}
+	config.Bands.ifErrors = config.IfErrThresh
+	for _, i := range strings.Split(config.QoSIfaces, ",") {
+		if i = strings.TrimSpace(i); i != "" {
+			config.Bands.qosIfaces = append(config.Bands.qosIfaces, i)
+		}
+	}
+	if config.Ping, err = parsePingThresholds(config.PingThresh); err != nil {
+		log.Fatalf("✗ -ping-thresholds %v", err)
+	}
+	if config.Fleet, err = parseFleetPolicy(config.DisjointVRFs, config.SharedRanges); err != nil {
+		log.Fatalf("✗ -disjoint-vrfs %v", err)
+	}
+	if config.Logs, err = parseLogWindow(config.LogWindow); err != nil {
+		log.Fatalf("✗ -log-window %v", err)
+	}
+	if config.TraceTargets != "" {
+		if config.Traces, err = loadTraceTargets(config.TraceTargets); err != nil {
+			log.Fatalf("✗ -trace-targets: %v", err)
+		}
+	}
+	if f := strings.Fields(config.FlowMonitor); len(f) > 1 {
+		log.Fatalf("✗ -flow-monitor %q: expected one monitor name", config.FlowMonitor)
+	}
+	if config.Exports, err = parseExportFormats(config.Export); err != nil {
+		log.Fatalf("✗ -export: %v", err)
+	}
+	if config.Stores, err = parseRunStores(config.Store, config.StoreToken); err != nil {
+		log.Fatalf("✗ -store: %v", err)
+	}
+	if _, _, err := parseRetention(config.Retain); err != nil {
+		log.Fatalf("✗ -retain: %v", err)
+	}
 
-// ============================================================================
-// MAIN
-// ============================================================================
+	if config.Baselines {
+		if err := listBaselines(config.OutputDir, config.Phase); err != nil {
+			log.Fatalf("✗ %v", err)
+		}
+		return
+	}
+	for _, sel := range []*string{&config.GoldenMark, &config.GoldenCompare} {
+		if *sel, err = resolveRunSelector(config.OutputDir, *sel); err != nil {
+			log.Fatalf("✗ %v", err)
+		}
+	}
 
-func main() {
-	config := parseFlags()
-	fmt.Printf(Banner, Version)
+	// Golden lab run
+	if config.GoldenMark != "" {
+		if err := markGoldenRun(config.GoldenMark, config.OutputDir); err != nil {
+			log.Fatalf("Golden mark failed: %v", err)
+		}
+		return
+	}
+	if config.GoldenCompare != "" {
+		report, verdict, err := runGoldenComparison(config.GoldenCompare, config.OutputDir, config.GoldenTol)
+		if err != nil {
+			log.Fatalf("Golden comparison failed: %v", err)
+		}
+		log.Printf("Golden regression report: %s (verdict: %s)", report, verdict)
+		if verdict == "DEGRADED" || verdict == "MIXED" {
+			config.Notify.notify(Alert{Event: "fail", Severity: "warning", Check: "golden comparison",
+				Details: []string{"verdict " + verdict, report}})
+		}
+		return
+	}
+
+	if config.CompareResult != "" {
+		report, verdict, err := runResultsComparison(config.CompareResult, config.OutputDir)
+		if err != nil {
+			log.Fatalf("Results comparison failed: %v", err)
+		}
+		log.Printf("Results diff: %s (verdict: %s)", report, verdict)
+		if verdict == "REGRESSED" {
+			config.Notify.notify(Alert{Event: "fail", Severity: "warning", Check: "results diff",
+				Details: []string{"verdict " + verdict, report}})
+		}
+		return
+	}
 
 	// Handle comparison mode
 	if config.CompareDir != "" {
@@ -1043,16 +1481,115 @@ func main() {
 		if len(parts) != 2 {
 			log.Fatal("Compare requires: -compare pre_dir,post_dir")
 		}
+		for i := range parts {
+			if parts[i], err = resolveRunSelector(config.OutputDir, parts[i]); err != nil {
+				log.Fatalf("✗ %v", err)
+			}
+		}
 		outputFile := filepath.Join(config.OutputDir, "COMPARISON_REPORT.txt")
-		if err := comparePhases(parts[0], parts[1], outputFile); err != nil {
+		verdict, err := comparePhases(parts[0], parts[1], outputFile, config.Bands)
+		if err != nil {
 			log.Fatalf("Comparison failed: %v", err)
 		}
-		log.Printf("Comparison report: %s", outputFile)
+		log.Printf("Comparison report: %s (verdict: %s)", outputFile, verdict)
+		if config.Exports["xlsx"] {
+			for _, f := range []string{comparisonCSVPath(outputFile), filepath.Join(config.OutputDir, "regressions.csv")} {
+				if path, err := csvToXLSX(f, strings.TrimSuffix(filepath.Base(f), ".csv")); err != nil {
+					log.Printf("✗ XLSX export: %v", err)
+				} else {
+					log.Printf("XLSX export: %s", path)
+				}
+			}
+		}
+		if verdict == "FAIL" {
+			config.Notify.notify(Alert{Event: "fail", Severity: "warning", Check: "pre/post comparison",
+				Details: []string{"verdict FAIL", outputFile}})
+			config.Hooks.fire("on-fail", HookContext{Phase: config.Phase, Status: "FAIL", Report: outputFile})
+		}
 		return
 	}
 
-	if config.Username == "" || config.Password == "" {
-		log.Fatal("Username (-u) and password (-p) required")
+	if config.PDF != "" {
+		parts := strings.Split(config.PDF, ",")
+		if len(parts) > 2 {
+			log.Fatal("PDF report requires: -pdf run_dir[,baseline_dir]")
+		}
+		for i := range parts {
+			if parts[i], err = resolveRunSelector(config.OutputDir, parts[i]); err != nil {
+				log.Fatalf("✗ %v", err)
+			}
+		}
+		base := ""
+		if len(parts) == 2 {
+			base = parts[1]
+		}
+		path, err := writePDFReport(config, parts[0], base)
+		if err != nil {
+			log.Fatalf("✗ PDF report: %v", err)
+		}
+		log.Printf("PDF report: %s", path)
+		return
+	}
+
+	// Configuration diff
+	if config.ConfigDiff != "" {
+		report, err := runConfigDiff(config.ConfigDiff, config.OutputDir)
+		if err != nil {
+			log.Fatalf("Config diff failed: %v", err)
+		}
+		log.Printf("Config diff: %s", report)
+		return
+	}
+
+	// Chassis swap hardware diff
+	if config.HWDiff != "" {
+		parts := strings.Split(config.HWDiff, ",")
+		if len(parts) != 2 {
+			log.Fatal("Hardware diff requires: -hw-diff pre_dir,post_dir")
+		}
+		outputFile := filepath.Join(config.OutputDir, "AS_BUILT_HARDWARE.txt")
+		os.MkdirAll(config.OutputDir, 0755)
+		if err := compareHardware(parts[0], parts[1], config.HWPairs, outputFile); err != nil {
+			log.Fatalf("Hardware diff failed: %v", err)
+		}
+		log.Printf("As-built hardware report: %s (+ .csv)", outputFile)
+		return
+	}
+
+	// Handle inventory conversion / sync modes
+	if config.NetBoxURL != "" {
+		if err := syncFromNetBox(config); err != nil {
+			log.Fatalf("✗ NetBox: %v", err)
+		}
+		if config.ExportInv == "" {
+			return
+		}
+	}
+	if config.ExportInv != "" {
+		devices, err := loadHostInventory(config.HostFile)
+		if err != nil {
+			log.Fatalf("Failed to load inventory: %v", err)
+		}
+		if err := saveHostInventory(config.ExportInv, devices); err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		log.Printf("Exported %d devices to %s", len(devices), config.ExportInv)
+		return
+	}
+	if config.SyncInv != "" {
+		if err := syncInventories(config.HostFile, config.SyncInv); err != nil {
+			log.Fatalf("Inventory sync failed: %v", err)
+		}
+		return
+	}
+
+	if _, err := os.Stat(config.VaultFile); err == nil && !config.Plan && (config.Username == "" || config.Password == "") {
+		if err := unlockVaultCredentials(config); err != nil {
+			log.Fatalf("✗ Vault: %v", err)
+		}
+	}
+	if !config.Plan && config.Username == "" && len(config.Vault) == 0 {
+		log.Fatal("Username (-u) required (or store credentials with -vault add)")
 	}
 
 	log.Printf("Loading inventory from %s...", config.HostFile)
@@ -1061,26 +1598,152 @@ func main() {
 		log.Fatalf("Failed to load inventory: %v", err)
 	}
 	log.Printf("Loaded %d devices\n", len(devices))
+	for _, problem := range validateInventory(devices) {
+		log.Printf("⚠ Inventory: %s", problem)
+	}
+	setDisplayInventory(devices)
 
 	fmt.Println("\n--- Device OS Detection ---")
-	fmt.Printf("%-12s %-15s %-10s → %-10s\n", "HOSTNAME", "IP", "TYPE", "DETECTED_OS")
-	fmt.Println(strings.Repeat("-", 55))
-	for _, d := range devices {
-		fmt.Printf("%-12s %-15s %-10s → %-10s\n", d.Hostname, d.IPAddress, d.DeviceType, d.DetectedOS)
+	table := newTextTable("HOSTNAME", "IP", "TYPE", "", "DETECTED_OS")
+	for _, d := range sortedDevices(devices) {
+		table.add(d.Site, displayName(d), d.IPAddress, d.DeviceType, "→", d.DetectedOS)
 	}
+	table.write(os.Stdout)
 	fmt.Println()
 
-	targets, err := readLines(config.TargetFile)
-	if err != nil {
-		log.Fatalf("Failed to read targets: %v", err)
-	}
-
 	commands, err := loadAllCommands(config)
 	if err != nil {
 		log.Fatalf("Failed to load commands: %v", err)
 	}
+	if config.ConfigBackup {
+		commands = configBackupCommands()
+	}
+	if config.DiskCheck {
+		addDiskCheckCommands(commands)
+	}
+	if config.UpgradeAudit {
+		addUpgradeAuditCommands(commands)
+		log.Printf("✓ Upgrade readiness check group enabled (target version: %s)", orDash(config.UpgradeTarget))
+	}
+	if config.Redundancy {
+		addRedundancyCommands(commands)
+		log.Printf("✓ RP redundancy check enabled")
+	}
+	if config.SRCheck {
+		addSRCommands(commands)
+		log.Printf("✓ Segment Routing check enabled (TI-LFA minimum %.1f%%)", config.SRTILFAMin)
+	}
+	if config.Logs != nil {
+		addLogEventCommands(commands)
+		log.Printf("✓ Logging events check enabled (window %s)", config.Logs)
+	}
+	if config.VRFCatalogue != "" {
+		if config.VRFs, err = loadVRFCatalogue(config.VRFCatalogue); err != nil {
+			log.Fatalf("✗ -vrf-catalogue %v", err)
+		}
+		if err := config.VRFs.checkPEs(devices); err != nil {
+			log.Fatalf("✗ -vrf-catalogue %v", err)
+		}
+		if config.CriticalVRFs == "" {
+			config.CriticalVRFs = strings.Join(config.VRFs.criticalVRFs(), ",")
+		}
+		log.Printf("✓ VRF catalogue: %d VRFs from %s (critical: %s)", len(config.VRFs.VRFs), config.VRFCatalogue, orDash(config.CriticalVRFs))
+	}
+	if config.Limits != nil {
+		config.Limits.rankPings(config.Ping, config.CriticalVRFs)
+		config.Limits.logSummary(config)
+	}
+	if config.FlowMonitor != "" {
+		addFlowCacheCommands(commands, config.FlowMonitor)
+		log.Printf("✓ Flow cache check enabled (monitor %s)", config.FlowMonitor)
+	}
+	if watchers, err := loadEEMWatchers(config.OutputDir); err != nil {
+		log.Printf("⚠ EEM watchers: %v", err)
+	} else if len(watchers) > 0 && config.EEMDeploy == "" && !config.EEMRemove {
+		addEEMCommands(commands)
+		log.Printf("✓ EEM watcher verification enabled (%d devices in %s)", len(watchers), eemStateFile)
+	}
+	if config.RecordDir != "" {
+		log.Printf("✓ Recording expect sessions to %s (script sessions are not recorded)", config.RecordDir)
+	}
+	if config.AuditWindow != "" && !config.Plan && !config.DryRun {
+		if config.Audit, err = openAuditLog(config.OutputDir, config.AuditWindow, auditSecrets(config, devices)); err != nil {
+			log.Fatalf("✗ Audit transcript: %v", err)
+		}
+		log.Printf("✓ Audit transcript: every command and response appended to %s", config.Audit.path)
+	}
+	config.Stop = newShutdown()
+	defer config.Stop.exit()
+	config.Breaker = newCircuitBreaker(config.BreakerAfter, config.BreakerCool)
+	if _, err := parseSSHAlgorithms(config.SSHAlgos); err != nil {
+		log.Fatalf("✗ -ssh-algorithms: %v", err)
+	}
+	if _, err := parseTransports(config.Transport); err != nil {
+		log.Fatalf("✗ -transport: %v", err)
+	}
+	if config.SNMP, err = parseSNMPConfig(config.SNMPVersion, config.SNMPCommunity, config.SNMPUser, config.SNMPAuth, config.SNMPPriv, config.SNMPPort); err != nil {
+		log.Fatalf("✗ %v", err)
+	}
+	for _, d := range devices {
+		if containsString(transportsOf(d, config), "snmp") {
+			if err := config.SNMP.check(); err != nil {
+				log.Fatalf("✗ %s uses the snmp transport: %v", d.Hostname, err)
+			}
+		}
+	}
+	if config.SSHImpl != "native" && config.SSHImpl != "openssh" {
+		log.Fatalf("✗ -ssh-client %q: native or openssh", config.SSHImpl)
+	}
+	if config.EnableSecret != "" && config.Session == "script" {
+		log.Fatalf("✗ -enable-secret needs expect sessions (-session auto or expect)")
+	}
+	if config.Retry, err = parseRetryPolicy(config.Retries, config.RetryBackoff, config.RetryJitter, config.RetryOn); err != nil {
+		log.Fatalf("✗ %v", err)
+	}
 	fmt.Println()
 
+	if config.Serve != "" {
+		if config.Persist {
+			config.Pool = newSessionPool(config.Keepalive)
+			defer config.Pool.Close()
+		}
+		if err := runServer(config, devices, commands); err != nil {
+			config.Pool.Close()
+			log.Fatalf("✗ API server: %v", err)
+		}
+		return
+	}
+
+	if config.Capture != "" {
+		spec, err := parseCapture(config.Capture, devices, config)
+		if err != nil {
+			log.Fatalf("✗ -capture: %v", err)
+		}
+		if !hasSSHCredentials(config, spec.Device) {
+			log.Fatalf("%s: no password (-p), private key (-key or inventory) or ssh-agent available", spec.Device.Hostname)
+		}
+		path, err := runCapture(config, spec)
+		if err != nil {
+			log.Fatalf("✗ Packet capture on %s: %v", spec.Device.Hostname, err)
+		}
+		if path != "" {
+			log.Printf("✓ Packet capture: %s", path)
+		}
+		return
+	}
+
+	if config.RetryFailed != "" {
+		if err := retryFailedRun(config, devices, commands); err != nil {
+			log.Fatalf("✗ Retry: %v", err)
+		}
+		return
+	}
+
+	targets, err := readLines(config.TargetFile)
+	if err != nil {
+		log.Fatalf("Failed to read targets: %v", err)
+	}
+
 	var targetDevices []DeviceInfo
 	for _, t := range targets {
 		if d, ok := devices[strings.ToUpper(t)]; ok {
@@ -1093,51 +1756,468 @@ func main() {
 	if len(targetDevices) == 0 {
 		log.Fatal("No valid devices")
 	}
+	if config.Profiles != nil {
+		logProfiles(config.Profiles, targetDevices)
+	}
 
-	log.Printf("Processing %d devices with %d workers...\n", len(targetDevices), config.MaxWorkers)
+	if !config.Plan {
+		for _, d := range targetDevices {
+			if !hasSSHCredentials(config, d) {
+				log.Fatalf("%s: no password (-p), private key (-key or inventory) or ssh-agent available", d.Hostname)
+			}
+		}
+	}
+
+	if config.EEMDeploy != "" || config.EEMRemove {
+		if config.EEMDeploy != "" && config.EEMRemove {
+			log.Fatal("✗ -eem-deploy and -eem-remove are exclusive")
+		}
+		if err := runEEMWatchers(config, targetDevices, config.EEMRemove); err != nil {
+			log.Fatalf("✗ EEM watchers: %v", err)
+		}
+		return
+	}
+
+	if config.PingMesh {
+		if err := runPingMesh(config, targetDevices); err != nil {
+			log.Fatalf("✗ Ping mesh: %v", err)
+		}
+		return
+	}
 
-	writer := NewOutputWriter(config.OutputDir, config.Phase)
+	if config.MTUSweep {
+		if err := runMTUSweep(config, targetDevices); err != nil {
+			log.Fatalf("✗ MTU sweep: %v", err)
+		}
+		return
+	}
 
+	if config.ValidateCmds {
+		report, bad, err := writeValidationReport(validateCommands(config, targetDevices, commands), targetDevices, config.OutputDir)
+		if err != nil {
+			log.Fatalf("✗ Command validation: %v", err)
+		}
+		log.Printf("Command validation report: %s", report)
+		if bad > 0 {
+			config.Notify.notify(Alert{Event: "fail", Severity: "warning", Check: "command validation",
+				Details: []string{fmt.Sprintf("%d command lines unsupported or not checked", bad), report}})
+			log.Fatalf("✗ %d command lines unsupported or not checked", bad)
+		}
+		log.Printf("✓ All command lines accepted")
+		return
+	}
+
+	if config.Plan || config.PlanOut != "" {
+		plan := buildExecutionPlan(config, targetDevices, commands)
+		plan.WritePlan(os.Stdout)
+		if config.PlanOut != "" {
+			f, err := createAtomic(config.PlanOut)
+			if err != nil {
+				log.Fatalf("Failed to export plan: %v", err)
+			}
+			plan.WritePlan(f)
+			f.Close()
+			log.Printf("Execution plan exported to %s", config.PlanOut)
+		}
+		if config.Plan {
+			return
+		}
+	}
+
+	if config.Persist {
+		config.Pool = newSessionPool(config.Keepalive)
+		defer config.Pool.Close()
+	}
+
+	if config.Warmup && !config.DryRun {
+		runWarmup(config, targetDevices)
+	}
+
+	if config.PingWatch != "" {
+		pe, ok := devices[strings.ToUpper(config.PingWatch)]
+		if !ok || config.PingWatchFile == "" {
+			log.Fatalf("✗ Ping watch: needs a PE from the inventory and -ping-watch-targets")
+		}
+		if err := runPingWatch(config, pe); err != nil {
+			log.Fatalf("✗ Ping watch: %v", err)
+		}
+		return
+	}
+
+	if config.Exporter != "" {
+		if err := runExporter(config, targetDevices, commands); err != nil {
+			config.Pool.Close()
+			log.Fatalf("✗ Exporter: %v", err)
+		}
+		return
+	}
+
+	if config.Runbook != "" {
+		if err := runRunbook(config, devices, targetDevices, commands); err != nil {
+			config.Pool.Close()
+			log.Fatalf("✗ %v", err)
+		}
+		return
+	}
+
+	if config.Schedule > 0 {
+		runSchedule(config, targetDevices, commands)
+		return
+	}
+
+	if config.Window > 0 {
+		if halted := runWindowMode(config, targetDevices, commands); halted {
+			config.Pool.Close()
+			log.Fatalf("✗ Window halted by a rollback trigger")
+		}
+		return
+	}
+
+	writer, allResults := runCollection(config, targetDevices, commands, config.Phase)
+	printRunFooter(writer, allResults)
+	if removed, err := pruneRuns(config.OutputDir, config.Phase, config.Retain); err == nil && removed > 0 {
+		log.Printf("Retention: removed %d old %s runs", removed, config.Phase)
+	}
+
+	if config.Bundle {
+		path, err := createRunBundle(config, writer, devices)
+		if err != nil {
+			log.Fatalf("Failed to create bundle: %v", err)
+		}
+		fmt.Printf(" Bundle:   %s\n", path)
+	}
+}
+
+// runCollection processes all target devices through the worker pool and
+// writes per-device logs plus the summary files for one phase run.
+func runCollection(config *Config, targetDevices []DeviceInfo, commands *CommandSet, phase string) (*OutputWriter, []*DeviceResult) {
+	gate := newCriticalGate(config, phase)
+	targetDevices = gate.order(targetDevices, config.OutputDir)
+	writer := NewOutputWriter(config.OutputDir, phase)
+	config.Hooks.beforeRun(writer, targetDevices)
+	allResults := collectDevices(config, writer, targetDevices, commands, gate)
+
+	rollup := writeRunReports(config, writer, allResults, gate)
+	storeRun(config, writer)
+	config.Hooks.afterRun(writer, allResults, rollup)
+	return writer, allResults
+}
+
+// collectDevices runs the devices through the worker pool, writing each
+// device log to writer as it finishes, and returns the results in arrival
+// order
+func collectDevices(config *Config, writer *OutputWriter, targetDevices []DeviceInfo, commands *CommandSet, gate *criticalGate) []*DeviceResult {
 	deviceChan := make(chan DeviceInfo, len(targetDevices))
-	resultChan := make(chan *DeviceResult, len(targetDevices))
+	scaler, err := parseAutoscale(config.Autoscale, config.MaxWorkers, func() int { return len(deviceChan) })
+	if err != nil {
+		log.Fatalf("✗ -autoscale: %v", err)
+	}
+	if scaler != nil {
+		log.Printf("Processing %d devices with %s...\n", len(targetDevices), scaler)
+	} else {
+		log.Printf("Processing %d devices with %d workers...\n", len(targetDevices), config.MaxWorkers)
+	}
+
+	sink := newResultSink(writer, len(targetDevices))
+
+	workers := scaler.workers(config.MaxWorkers)
+	monitor := newStallMonitor(workers, config.StallAfter, config.StallSkip)
+	defer monitor.Stop()
+
+	limiter, err := parseRoleWorkers(config.RoleWorkers)
+	if err != nil {
+		log.Fatalf("✗ -role-workers: %v", err)
+	}
 
 	var wg sync.WaitGroup
-	for i := 0; i < config.MaxWorkers; i++ {
+	var notStarted int32
+	for i := 0; i < workers; i++ {
 		wg.Add(1)
+		hb := monitor.worker(i)
 		go func() {
 			defer wg.Done()
-			for d := range deviceChan {
-				resultChan <- processDevice(d, config, commands)
+			for {
+				scaler.acquire()
+				d, ok := <-deviceChan
+				if !ok {
+					scaler.cancel()
+					return
+				}
+				if gate.stopped(d) {
+					scaler.cancel()
+					limiter.done(d)
+					continue
+				}
+				if config.Stop.stopping() {
+					atomic.AddInt32(&notStarted, 1)
+					scaler.cancel()
+					limiter.done(d)
+					continue
+				}
+				hb.begin(d.Hostname)
+				began := time.Now()
+				r := processDevice(d, config, commands, hb)
+				scaler.release(r, time.Since(began))
+				sink.put(r)
+				gate.observe(r)
+				hb.idle()
+				limiter.done(d)
 			}
 		}()
 	}
 
 	go func() {
-		for _, d := range targetDevices {
+		pending := targetDevices
+		for len(pending) > 0 {
+			var d DeviceInfo
+			d, pending = limiter.next(pending)
 			deviceChan <- d
 		}
 		close(deviceChan)
 	}()
 
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
-
-	var allResults []*DeviceResult
-	for r := range resultChan {
-		allResults = append(allResults, r)
-		writer.WriteDevice(r)
-		status := "✓ SUCCESS"
-		if !r.Success {
-			status = "✗ FAILED"
+	wg.Wait()
+	if scaler != nil {
+		log.Printf("AUTOSCALE: peak %d workers", scaler.peak)
+	}
+	allResults := sink.close()
+	if config.Stop.stopping() {
+		log.Printf("⚠ Stopped: %d devices collected, %d not started; writing the reports of this run", len(allResults), notStarted)
+	}
+	for _, r := range allResults {
+		if !r.Success && r.ErrorMessage != interruptedMsg {
+			config.Notify.notify(Alert{Event: "fail", Severity: "critical", Device: r.Device.Hostname,
+				Check: "collection", Phase: writer.phase, Details: []string{r.ErrorMessage}})
 		}
-		log.Printf("%s: %s [%s] using %s", status, r.Device.Hostname, r.Device.DetectedOS, filepath.Base(r.CommandFile))
 	}
+	return allResults
+}
 
+// writeRunReports writes the summaries and check reports of a collected run
+// and returns its roll-up
+func writeRunReports(config *Config, writer *OutputWriter, allResults []*DeviceResult, gate *criticalGate) []RollupDevice {
 	writer.WriteSummary(allResults)
 	writer.WriteSummaryCSV(allResults)
+	writer.WriteTimings(allResults)
+	writer.WriteHardware(allResults)
+	writer.WriteInterfaces(allResults)
+	writer.WriteL2VPN(allResults)
+	writer.WriteQoS(allResults)
+	writer.WriteTE(allResults)
+	writer.WritePaths(allResults, config.Traces)
+	writer.WriteFlows(allResults, config.CriticalVRFs)
+	writer.WriteTopology(allResults)
+
+	if saved := writer.SaveConfigSnapshots(allResults, config.OutputDir); saved > 0 {
+		log.Printf("Config backup: %d running-configs saved under %s", saved, filepath.Join(config.OutputDir, configDirName))
+	}
+
+	if misses := findParserMisses(allResults); len(misses) > 0 {
+		writer.WriteQuarantine(misses)
+		log.Printf("⚠ %d command outputs quarantined for parser review: %s", len(misses), filepath.Join(writer.dir, "quarantine"))
+	}
+
+	validation := newValidationSet(allResults)
+	pings := collectPingResults(allResults)
+	writer.WritePingStats(pings, config.Ping)
+	validation.addPings(pings, config.Ping)
+
+	if gate != nil {
+		findings, trigger, skipped := gate.report()
+		writer.WriteCriticalServices(gate.vrfs, findings, trigger, skipped)
+		validation.addCritical(findings)
+		log.Printf("Critical service check: CRITICAL_SERVICES_%s.log", writer.timestamp)
+	}
+
+	if watchers, err := loadEEMWatchers(config.OutputDir); err == nil && len(watchers) > 0 {
+		rows := checkEEMWatchers(allResults, watchers)
+		writer.WriteEEMWatch(rows)
+		validation.addEEM(rows)
+		for _, r := range rows {
+			if r.Status == "FIRED" || r.Status == "MISSING" {
+				log.Printf("⚠ EEM: %s %s: %s", r.Hostname, r.Status, strings.Join(r.Reasons, "; "))
+			}
+		}
+		log.Printf("EEM watcher verification: EEM_WATCH_%s.log", writer.timestamp)
+	}
+
+	if config.DiskCheck {
+		rows := checkDiskSpace(allResults, config.MinDiskFreeMB, config.DiskMinPct, config.Limits)
+		writer.WriteDiskCheck(rows, config.MinDiskFreeMB, config.DiskMinPct)
+		validation.addDisk(rows)
+		for _, r := range rows {
+			if r.Status == "LOW" {
+				log.Printf("⚠ DISK: %s %s has %d MB (%.1f%%) free", r.Hostname, r.FS.Name, r.FS.FreeBytes/(1024*1024), r.FS.FreePct())
+			}
+		}
+		log.Printf("Disk space check: DISK_SPACE_%s.log", writer.timestamp)
+	}
+
+	if config.UpgradeAudit {
+		rows := buildReadiness(allResults, config.UpgradeTarget, config.MinDiskFreeMB)
+		writer.WriteReadiness(rows, config.UpgradeTarget, config.MinDiskFreeMB)
+		validation.addReadiness(rows)
+		log.Printf("Upgrade readiness: READINESS_%s.log", writer.timestamp)
+	}
+
+	if config.Redundancy {
+		rows := checkRedundancy(allResults)
+		writer.WriteRedundancy(rows)
+		validation.addRedundancy(rows)
+		for _, r := range rows {
+			if r.Status == "DEGRADED" || r.Status == "NO_STANDBY" {
+				log.Printf("⚠ REDUNDANCY: %s %s: %s", r.Hostname, r.Status, strings.Join(r.Reasons, "; "))
+			}
+		}
+		log.Printf("RP redundancy check: REDUNDANCY_%s.log", writer.timestamp)
+	}
+
+	if config.SRCheck {
+		report := checkSR(allResults, config.SRTILFAMin)
+		writer.WriteSR(report, config.SRTILFAMin)
+		validation.addSR(report.Rows)
+		for _, r := range report.Rows {
+			if r.Status == "DEGRADED" || r.Status == "LDP_ONLY" {
+				log.Printf("⚠ SR: %s %s: %s", r.Hostname, r.Status, strings.Join(r.Reasons, "; "))
+			}
+		}
+		if len(report.LDPOnly) > 0 {
+			log.Printf("⚠ SR: nodes without SR capability: %s", strings.Join(report.LDPOnly, ", "))
+		}
+		log.Printf("Segment Routing check: SR_CHECK_%s.log", writer.timestamp)
+	}
+
+	if isisRows, other := checkISIS(allResults); len(isisRows) > 0 {
+		writer.WriteISIS(isisRows, other)
+		validation.addISIS(isisRows)
+		for _, r := range isisRows {
+			if r.Status == "DEGRADED" || r.Status == "DOWN" {
+				log.Printf("⚠ IS-IS: %s %s: %s", r.Hostname, r.Status, strings.Join(r.Reasons, "; "))
+			}
+		}
+		log.Printf("IS-IS neighbor check: ISIS_%s.log", writer.timestamp)
+	}
+
+	if pairRows := checkNodePairs(allResults, config.PairSkew); len(pairRows) > 0 {
+		writer.WritePairs(pairRows, config.PairSkew)
+		validation.addPairs(pairRows)
+		for _, r := range pairRows {
+			if r.Status == "FAIL" || r.Status == "WARN" {
+				log.Printf("⚠ PAIR: %s %s: %s", r.Pair, r.Status, strings.Join(r.Reasons, "; "))
+			}
+		}
+		log.Printf("Node pair check: PAIRS_%s.log", writer.timestamp)
+	}
+
+	if config.Logs != nil {
+		rows := checkLogEvents(allResults, config.Logs)
+		writer.WriteLogEvents(rows, config.Logs)
+		validation.addLogEvents(rows)
+		for _, r := range rows {
+			if r.Status == "EVENTS" {
+				log.Printf("⚠ LOG EVENTS: %s: %d events in the window", r.Hostname, r.Total())
+			}
+		}
+		log.Printf("Logging events check: LOG_EVENTS_%s.log", writer.timestamp)
+	}
+
+	if config.RPLAudit {
+		var intents []PolicyIntent
+		if config.RPLIntent != "" {
+			var err error
+			if intents, err = loadPolicyIntent(config.RPLIntent); err != nil {
+				log.Printf("✗ Cannot load policy intent %s: %v", config.RPLIntent, err)
+			}
+		}
+		policyFindings := auditRoutePolicies(allResults, intents)
+		writer.WritePolicyAudit(policyFindings)
+		validation.addPolicies(policyFindings)
+		log.Printf("Route-policy audit: RPL_AUDIT_%s.log", writer.timestamp)
+	}
+
+	if config.StaticAudit || config.StaticIntent != "" {
+		var intents []StaticIntent
+		if config.StaticIntent != "" {
+			var err error
+			if intents, err = loadStaticIntent(config.StaticIntent); err != nil {
+				log.Printf("✗ Cannot load static route intent %s: %v", config.StaticIntent, err)
+			}
+		}
+		writer.WriteStaticAudit(auditStaticRoutes(allResults, intents), config.StaticIntent)
+		log.Printf("Static route audit: STATIC_ROUTES_%s.log", writer.timestamp)
+	}
+
+	if config.PeerRegistry != "" {
+		peers, err := loadPeerRegistry(config.PeerRegistry)
+		if err != nil {
+			log.Printf("✗ Cannot load peer registry %s: %v", config.PeerRegistry, err)
+		} else {
+			peerFindings, unused := auditPeers(allResults, peers)
+			writer.WritePeerAudit(peerFindings, unused, config.PeerRegistry)
+			log.Printf("BGP peer audit: PEER_AUDIT_%s.log", writer.timestamp)
+		}
+	}
+
+	if config.OSPFIntent != "" {
+		intents, err := loadOSPFIntent(config.OSPFIntent)
+		if err != nil {
+			log.Printf("✗ Cannot load OSPF intent %s: %v", config.OSPFIntent, err)
+		} else {
+			ospfFindings := auditOSPFIntent(allResults, intents)
+			writer.WriteOSPFIntent(ospfFindings, config.OSPFIntent)
+			validation.addOSPFIntent(ospfFindings)
+			log.Printf("OSPF adjacency intent: OSPF_INTENT_%s.log", writer.timestamp)
+		}
+	}
+	if config.OSPFIntentOut != "" {
+		if n, err := writeOSPFIntentFile(config.OSPFIntentOut, allResults); err != nil {
+			log.Printf("✗ Cannot write OSPF intent %s: %v", config.OSPFIntentOut, err)
+		} else {
+			log.Printf("OSPF intent: %d live adjacencies written to %s", n, config.OSPFIntentOut)
+		}
+	}
+
+	findings := analyzeFleet(allResults, config.Fleet)
+	writer.WriteFleetFindings(findings)
+	if len(findings) > 0 {
+		log.Printf("⚠ Fleet analyzer: %d findings (see FLEET_FINDINGS_%s.log)", len(findings), writer.timestamp)
+	}
+
+	if config.Profiles != nil {
+		profileRows := checkProfileRequirements(allResults, config.Profiles)
+		writer.WriteProfiles(allResults, config.Profiles, profileRows)
+		validation.addProfiles(profileRows)
+		for _, r := range profileRows {
+			if r.Status == "FAIL" {
+				log.Printf("⚠ PROFILE: %s (%s): %s is %s", r.Hostname, r.Profile, r.Requirement.Metric, r.Value)
+			}
+		}
+		config.Profiles.dropSkipped(validation)
+		log.Printf("Check profiles: PROFILES_%s.log", writer.timestamp)
+	}
+
+	rollup := buildRollup(validation)
+	writer.WriteRollup(rollup)
+	log.Printf("Roll-up by role: %s", rollupLine(rollupByRole(rollup)))
+	log.Printf("Roll-up by site: %s (details: ROLLUP_%s.log)", rollupLine(rollupBySite(rollup)), writer.timestamp)
+
+	decision := decideGoNoGo(validation, config.CriticalVRFs, config.Limits)
+	writer.WriteGoNoGo(decision)
+	log.Printf("Go/No-Go: %s (details: GO_NO_GO_%s.log)", decision, writer.timestamp)
+
+	if len(config.Exports) > 0 {
+		paths, err := writer.WriteValidation(validation.rows, config.Exports)
+		if err != nil {
+			log.Printf("✗ Validation export: %v", err)
+		}
+		for _, p := range paths {
+			log.Printf("Validation export: %s", filepath.Base(p))
+		}
+	}
+	return rollup
+}
 
+func printRunFooter(writer *OutputWriter, allResults []*DeviceResult) {
 	success := 0
 	for _, r := range allResults {
 		if r.Success {
@@ -1156,13 +2236,13 @@ func main() {
 func parseFlags() *Config {
 	config := &Config{}
 	flag.StringVar(&config.Username, "u", "", "SSH username")
-	flag.StringVar(&config.Password, "p", "", "SSH password")
+	flag.StringVar(&config.Password, "p", "", "SSH password (with -ssh-client openssh answered as ssh's askpass helper: needs OpenSSH 8.4 or later)")
 	flag.StringVar(&config.CommandFile, "c", "command.txt", "Default commands")
 	flag.StringVar(&config.CommandFileXR, "cmd-xr", "command_iosxr.txt", "IOS-XR commands")
 	flag.StringVar(&config.CommandFileXE, "cmd-xe", "command_iosxe.txt", "IOS-XE commands")
 	flag.StringVar(&config.CommandFileL2, "cmd-l2", "command_l2switch.txt", "L2 Switch commands")
 	flag.StringVar(&config.TargetFile, "t", "target.txt", "Target file")
-	flag.StringVar(&config.HostFile, "hosts", "host_info.csv", "Host inventory")
+	flag.StringVar(&config.HostFile, "hosts", "host_info.csv", "Host inventory (.csv/.xlsx/.json/.yaml)")
 	flag.StringVar(&config.OutputDir, "o", "output", "Output directory")
 	flag.IntVar(&config.MaxWorkers, "w", 5, "Workers")
 	flag.IntVar(&config.SSHPort, "port", 22, "SSH port")
@@ -1170,6 +2250,143 @@ func parseFlags() *Config {
 	flag.BoolVar(&config.DryRun, "dry-run", false, "Dry run")
 	flag.StringVar(&config.Phase, "phase", "health-check", "Phase (pre-migration/post-migration)")
 	flag.StringVar(&config.CompareDir, "compare", "", "Compare pre,post directories")
+	flag.StringVar(&config.ExportInv, "export-inventory", "", "Export -hosts inventory to file (.csv/.xlsx/.json/.yaml)")
+	flag.StringVar(&config.SyncInv, "sync-inventory", "", "Interactively reconcile -hosts with another inventory file")
+	flag.StringVar(&config.NetBoxURL, "netbox-url", "", "Write the active devices of this NetBox to -hosts and exit (with -export-inventory: also to that file)")
+	flag.StringVar(&config.NetBoxToken, "netbox-token", "", "NetBox API token, or env:VAR (default $NETBOX_TOKEN)")
+	flag.StringVar(&config.NetBoxTag, "netbox-tag", "", "Only NetBox devices with any of these tags (comma-separated slugs), e.g. the migration scope")
+	flag.DurationVar(&config.Window, "window", 0, "Window mode: monitor for this long (e.g. 4h), then take a final snapshot and compare")
+	flag.DurationVar(&config.WindowEvery, "window-interval", 15*time.Minute, "Snapshot interval during window mode")
+	flag.StringVar(&config.Proxy, "proxy", "", "SSH proxy for all devices: socks5://host:port, jump://user@host, command:<ProxyCommand>")
+	flag.StringVar(&config.SSHAlgos, "ssh-algorithms", "", "SSH algorithms for devices without an SSH_Algorithms column: legacy, or kex=+...;ciphers=+...;hostkeys=+...;macs=+...")
+	flag.StringVar(&config.ProxyConnect, "proxy-connect", "", "Internal: SOCKS5 ProxyCommand helper (used by ssh)")
+	flag.StringVar(&config.ProxyExec, "proxy-exec", "", "Internal: ProxyCommand wrapper that drops the askpass secrets (used by ssh)")
+	flag.BoolVar(&config.Bundle, "bundle", false, "Package inventory, commands, raw outputs and results into a signed tar.gz")
+	flag.StringVar(&config.BundleKey, "bundle-key", "bundle_signing.key", "ed25519 key used to sign bundles (created if missing)")
+	flag.StringVar(&config.VerifyBundle, "verify-bundle", "", "Verify a bundle's hashes and signature")
+	flag.StringVar(&config.AuditWindow, "audit", "", "Maintenance window name: append every ssh command and response (secrets redacted) to the hash-chained <output>/audit/<name>.jsonl")
+	flag.StringVar(&config.AuditVerify, "audit-verify", "", "Verify the hash chain of an audit transcript and exit")
+	flag.StringVar(&config.AuditExport, "audit-export", "", "Verify an audit transcript and write it as a signed evidence bundle (-bundle-key) and exit")
+	flag.BoolVar(&config.UpgradeAudit, "upgrade-audit", false, "Run the upgrade readiness check group (version, disk, install state)")
+	flag.StringVar(&config.UpgradeTarget, "upgrade-target", "", "Expected software version for -upgrade-audit (e.g. 7.9.2)")
+	flag.Int64Var(&config.MinDiskFreeMB, "min-disk-free", 2048, "Minimum free MB on the install disk")
+	flag.BoolVar(&config.RPLAudit, "rpl-audit", false, "Audit route-policies on BGP neighbors and VRF import/export")
+	flag.StringVar(&config.RPLIntent, "rpl-intent", "", "CSV of expected policies: hostname,vrf,neighbor|import|export,direction,policy")
+	flag.DurationVar(&config.StallAfter, "stall-after", 5*time.Minute, "Report a worker with no device output for this long (0 = off)")
+	flag.DurationVar(&config.StallSkip, "stall-skip", 0, "Skip a stalled device after this extra grace period (0 = report only)")
+	flag.BoolVar(&config.Plan, "plan", false, "Show the execution plan (devices, commands, estimated duration, credentials) and exit")
+	flag.StringVar(&config.PlanOut, "plan-out", "", "Export the execution plan to this file (runs the checks unless -plan is set)")
+	flag.StringVar(&config.HWDiff, "hw-diff", "", "As-built hardware diff: pre_dir,post_dir (show inventory + show platform)")
+	flag.StringVar(&config.HWPairs, "hw-pairs", "", "CSV of migration pairs old_hostname,new_hostname for -hw-diff")
+	flag.StringVar(&config.KeyFile, "key", "", "Private key for publickey auth (tried before password; ssh-agent is also used)")
+	flag.StringVar(&config.KeyPass, "key-passphrase", "", "Passphrase for -key, or env:VAR to read it from the environment")
+	flag.StringVar(&config.EnableSecret, "enable-secret", "", "Enable secret for devices that log in at the user EXEC prompt (>), env:VAR, or login for the login password")
+	flag.StringVar(&config.VaultFile, "vault-file", "credentials.vault", "Encrypted credential vault (passphrase from $HC_VAULT_PASSPHRASE or prompt)")
+	flag.StringVar(&config.VaultAction, "vault", "", "Vault management: init, add, rotate, list")
+	flag.StringVar(&config.VaultEntry, "vault-entry", vaultDefaultEntry, "Vault entry for -vault add: default or a hostname")
+	flag.DurationVar(&config.IdleTimeout, "idle-timeout", 0, "Kill a device session that sends no output for this long (0 = -timeout only)")
+	flag.StringVar(&config.NoiseFile, "noise-patterns", "noise_patterns.txt", "Per-OS output cleaning rules (built-in copy used if the file is absent)")
+	flag.StringVar(&config.CleanCheck, "clean-check", "", "Validate cleaning rules against <dir>/<OS>/*.raw + *.clean fixtures and exit")
+	flag.StringVar(&config.ParseCheck, "parse-check", "", "Validate parsers against <dir>/<OS>/*.raw + *.metrics fixtures and exit")
+	flag.StringVar(&config.Transport, "transport", "cli", "Collection transport for devices without a Transport column: cli, netconf (IOS-XR via NETCONF, CLI for others/fallback), snmp, or an order such as cli,snmp")
+	flag.IntVar(&config.NetconfPort, "netconf-port", 830, "NETCONF ssh port")
+	flag.StringVar(&config.SNMPVersion, "snmp-version", "2c", "SNMP version for the snmp transport: 2c or 3")
+	flag.StringVar(&config.SNMPCommunity, "snmp-community", "env:SNMP_COMMUNITY", "SNMPv2c community, or env:VAR to read it from the environment")
+	flag.StringVar(&config.SNMPUser, "snmp-user", "", "SNMPv3 user")
+	flag.StringVar(&config.SNMPAuth, "snmp-auth", "", "SNMPv3 authentication: md5, sha or sha256, then :password or :env:VAR (empty = noAuthNoPriv)")
+	flag.StringVar(&config.SNMPPriv, "snmp-priv", "", "SNMPv3 privacy: des or aes, then :password or :env:VAR (empty = authNoPriv)")
+	flag.IntVar(&config.SNMPPort, "snmp-port", 161, "SNMP agent UDP port")
+	flag.StringVar(&config.GoldenMark, "golden-mark", "", "Mark a lab run directory as the golden run")
+	flag.StringVar(&config.GoldenCompare, "golden-compare", "", "Compare a lab run directory against the golden run")
+	flag.Float64Var(&config.GoldenTol, "golden-tolerance", 10, "Allowed deviation from golden metric values (percent)")
+	flag.StringVar(&config.PeerRegistry, "peer-registry", "", "Audit BGP neighbors against this peer registry CSV (neighbor,vrf,remote_as,description,policy_in,policy_out)")
+	flag.StringVar(&config.RoleWorkers, "role-workers", "", "Max concurrent devices per role (Device_Type, Role or OS; PREFIX* allowed), e.g. ASR9906=5,ASR92*=1,IOS-XR=4")
+	flag.StringVar(&config.Session, "session", "auto", "Session style: auto (expect for IOS-XR, script otherwise), expect, script")
+	flag.StringVar(&config.SSHImpl, "ssh-client", "native", "SSH client for device sessions: native (built in) or openssh (the ssh binary)")
+	flag.StringVar(&config.PromptRegex, "prompt-regex", "", "Device prompt regex for expect sessions (default matches RP/0/RSP0/CPU0:host# and host#)")
+	flag.DurationVar(&config.CmdDeadline, "cmd-deadline", 3*time.Minute, "Max time per command; a command still running is cut off and the rest of the batch skipped")
+	flag.IntVar(&config.BreakerAfter, "breaker", 3, "Mark a device unreachable after this many consecutive timeouts (0 = off)")
+	flag.DurationVar(&config.BreakerCool, "breaker-cooldown", 5*time.Minute, "How long an unreachable device fails at once before it is tried again")
+	flag.IntVar(&config.Retries, "retries", 2, "Retry a session that fails on a transient error (-retry-on) this many times (0 = off)")
+	flag.DurationVar(&config.RetryBackoff, "retry-backoff", 2*time.Second, "Wait before the first retry; doubled for each further retry")
+	flag.Float64Var(&config.RetryJitter, "retry-jitter", 0.2, "Randomize each retry wait by up to this fraction (0-1)")
+	flag.StringVar(&config.RetryOn, "retry-on", "reset,closed,refused", "Error classes to retry: reset, closed, refused, timeout, unreachable or any (never auth failures)")
+	flag.BoolVar(&config.DiskCheck, "disk-check", false, "Check free space on disk0:/harddisk:/bootflash: (threshold -min-disk-free and -disk-min-pct)")
+	flag.Float64Var(&config.DiskMinPct, "disk-min-pct", 10, "Minimum free percentage on install disks for -disk-check")
+	flag.BoolVar(&config.Persist, "persist", false, "Keep one prompt-driven session per device for the whole run (fallback retries, window snapshots)")
+	flag.DurationVar(&config.Keepalive, "keepalive", time.Minute, "Keepalive interval for idle -persist sessions (0 = off)")
+	flag.BoolVar(&config.ConfigBackup, "config-backup", false, "Collect only show running-config and store snapshots under <output>/configs/<hostname>/")
+	flag.StringVar(&config.ConfigDiff, "config-diff", "", "Unified config diff: HOST (two newest snapshots), a.cfg,b.cfg, or pre_dir,post_dir")
+	flag.StringVar(&config.Monitors, "monitors", "monitors.txt", "Window-mode monitor declarations (built-in monitors if the file is absent)")
+	flag.BoolVar(&config.ValidateCmds, "validate-commands", false, "Check every command file line on one target per OS and exit")
+	flag.StringVar(&config.RollbackRules, "rollback-rules", "", "Window mode: trigger/action rules (alert, rollback:FILE@HOSTS, halt)")
+	flag.BoolVar(&config.RollbackDry, "rollback-dry-run", false, "Record rollback actions without sending any commands")
+	flag.StringVar(&config.AlertCmd, "alert-cmd", "", "Shell command run for alert actions (trigger details on stdin)")
+	flag.StringVar(&config.Runbook, "runbook", "", "Execute a YAML migration runbook (resumes from <file>.state)")
+	flag.BoolVar(&config.RunbookReset, "runbook-reset", false, "Start the runbook from the first step, ignoring saved progress")
+	flag.StringVar(&config.Serve, "serve", "", "Serve the HTTP API on this address (e.g. :8080) instead of running checks")
+	flag.StringVar(&config.APIToken, "api-token", "env:MERALCO_API_TOKEN", "Bearer token required by the HTTP API (or env:VAR)")
+	flag.StringVar(&config.RecordDir, "record", "", "Record prompt-driven (expect) sessions as asciinema casts in this directory")
+	flag.StringVar(&config.Exporter, "exporter", "", "Poll targets continuously and serve Prometheus metrics on this address (e.g. :9108)")
+	flag.DurationVar(&config.ExporterEvery, "exporter-every", time.Minute, "Exporter poll interval")
+	flag.BoolVar(&config.StaticAudit, "static-audit", false, "List static routes per VRF and flag dead exit interfaces and next hops")
+	flag.StringVar(&config.StaticIntent, "static-intent", "", "CSV of expected statics: hostname,vrf,prefix,next_hop,interface,distance (implies -static-audit)")
+	flag.StringVar(&config.NotifyFile, "notify", "", "YAML file of webhooks (Slack, Teams, JSON) to alert on failures and rollback triggers")
+	flag.StringVar(&config.ProfilesFile, "profiles", "", "YAML file of check profiles: per role/platform, the command categories and checks to skip and metric minimums")
+	flag.StringVar(&config.ThresholdFile, "thresholds", "", "YAML file of named validation limits (ping, disk, routes, drain rate...) per check, critical VRF priority and device role; flags given override it")
+	flag.StringVar(&config.HooksFile, "hooks", "", "YAML file of shell commands or HTTP calls to run before/after pre- and post-checks and on failure")
+	flag.StringVar(&config.CompareTol, "compare-tolerance", defaultCompareTolerance, "Pre/post WARN/FAIL percent bands, e.g. 2/10,VRF_Routes_=0.5/2")
+	flag.StringVar(&config.PingThresh, "ping-thresholds", "", "Ping success % needed to pass: DEFAULT,VRF=PCT,VRF/TARGET=PCT (default 100)")
+	flag.StringVar(&config.DisjointVRFs, "disjoint-vrfs", "", "Report address overlaps between these VRFs: VRF,VRF[;VRF,VRF...] (default: none, VPNs may reuse space)")
+	flag.StringVar(&config.SharedRanges, "shared-ranges", "", "Prefixes allowed in every -disjoint-vrfs VRF, comma-separated")
+	flag.StringVar(&config.Autoscale, "autoscale", "", "Scale workers between MIN-MAX (e.g. 4-32) on response time and overload errors; -w is the start")
+	flag.DurationVar(&config.Schedule, "schedule", 0, "Collect -phase every interval (e.g. 1h) until -schedule-for has passed or interrupted")
+	flag.DurationVar(&config.ScheduleFor, "schedule-for", 0, "Stop the -schedule after this long (e.g. 48h)")
+	flag.StringVar(&config.Retain, "retain", "", "Keep only the newest N runs of the phase and/or those younger than DURATION (N, 72h or N,72h)")
+	flag.BoolVar(&config.Baselines, "baselines", false, "List the runs of -phase for PHASE@N selection and exit")
+	flag.BoolVar(&config.Redundancy, "redundancy", false, "Check both RPs: standby state, NSR, config sync and software (logs in to the inventory Standby_IP when set)")
+	flag.StringVar(&config.PDF, "pdf", "", "Render a run's reports as a PDF: run_dir[,baseline_dir] (PHASE@N selectors allowed)")
+	flag.StringVar(&config.Export, "export", "", "Also write the run's validation results as VALIDATION_<ts>.csv/.xlsx/.json: any of csv,xlsx,json (with -compare: .xlsx copies of the comparison CSVs)")
+	flag.StringVar(&config.Capture, "capture", "", "Packet-capture HOST:INTERFACE, fetch the pcap to <output>/captures and remove the capture config")
+	flag.DurationVar(&config.CaptureFor, "capture-for", time.Minute, "Packet capture duration")
+	flag.IntVar(&config.CaptureMB, "capture-mb", 10, "Packet capture buffer/file size (MB)")
+	flag.StringVar(&config.CaptureMatch, "capture-match", "", "IOS-XE capture filter, e.g. \"ipv4 host 10.0.0.1 any\" (default any)")
+	flag.Int64Var(&config.IfErrThresh, "if-error-threshold", defaultIfErrorThreshold, "Pre/post: per-interface growth of input/CRC/output errors (FAIL) or drops (WARN) allowed")
+	flag.StringVar(&config.Store, "store", "", "Also store each run in these directories and/or POST it to these -serve URLs (.../api/runs), comma-separated")
+	flag.StringVar(&config.StoreToken, "store-token", "env:MERALCO_STORE_TOKEN", "Bearer token for -store URLs (or env:VAR)")
+	flag.StringVar(&config.OSPFIntent, "ospf-intent", "", "Check OSPF adjacencies against this CSV: hostname,neighbor_id,interface,area")
+	flag.StringVar(&config.OSPFIntentOut, "ospf-intent-out", "", "Write the run's FULL OSPF adjacencies to this CSV (intent file template)")
+	flag.BoolVar(&config.SRCheck, "sr-check", false, "Check Segment Routing: SRGB consistency, prefix and adjacency SIDs, TI-LFA coverage, LDP-only nodes")
+	flag.Float64Var(&config.SRTILFAMin, "sr-tilfa-min", 100, "Minimum TI-LFA protection coverage for -sr-check (percent)")
+	flag.StringVar(&config.E2ECheck, "e2e-check", "", "Replay <dir>/<scenario>/{pre,post} device logs through the reports and compare, check against expected/ and exit")
+	flag.BoolVar(&config.E2EUpdate, "e2e-update", false, "Rewrite the expected/ golden reports of -e2e-check")
+	flag.StringVar(&config.VRFCatalogue, "vrf-catalogue", "", "CSV/XLSX VRF catalogue (VRF, RD, RTs, Priority, PEs, Destinations): critical VRFs by priority and pings from the hosting PEs")
+	flag.StringVar(&config.CriticalVRFs, "critical-vrfs", "", "Critical VRFs, highest priority first: checked on every hosting PE as results arrive, failures alert at once")
+	flag.BoolVar(&config.CriticalAbort, "critical-abort", false, "Stop the collection at the first critical VRF failure (with -critical-vrfs)")
+	flag.StringVar(&config.EEMDeploy, "eem-deploy", "", "Deploy EEM watchers on the targets that send BGP/LDP down events to this syslog collector, and exit")
+	flag.StringVar(&config.EEMVRF, "eem-vrf", "", "VRF the -eem-deploy collector is reached in")
+	flag.BoolVar(&config.EEMRemove, "eem-remove", false, "Remove the deployed EEM watchers from the targets and exit")
+	flag.StringVar(&config.QoSIfaces, "qos-interfaces", "", "Pre/post QoS check: critical interfaces, NAME or HOST:NAME comma separated (default all with a service policy)")
+	flag.BoolVar(&config.PingMesh, "ping-mesh", false, "Ping every target's loopback from every other target, write the matrix as JSON and HTML, and exit")
+	flag.StringVar(&config.PingMeshFile, "ping-mesh-targets", "", "Ping mesh targets per VRF instead of the loopbacks, one \"VRF NAME ADDRESS\" per line")
+	flag.StringVar(&config.PingMeshSrc, "ping-mesh-source", "Loopback0", "Ping mesh source interface, whose address is each device's target")
+	flag.DurationVar(&config.ChangeWatch, "change-watch", 0, "Poll the targets' commit list / running-config hash this often during -window and -runbook and alert on changes outside the MOP")
+	flag.StringVar(&config.ChangeAllow, "change-allow", "", "Devices the MOP changes during -window (comma separated), for -change-watch")
+	flag.StringVar(&config.PingWatch, "ping-watch", "", "Ping the -ping-watch-targets from this PE every second, plot loss and RTT to HTML, and exit")
+	flag.StringVar(&config.PingWatchFile, "ping-watch-targets", "", "Ping watch targets, one \"VRF NAME ADDRESS\" per line")
+	flag.DurationVar(&config.PingWatchFor, "ping-watch-for", 0, "Ping watch duration (default until Ctrl-C)")
+	flag.StringVar(&config.LogWindow, "log-window", "", "Count interface flaps and BGP/OSPF/IS-IS/LDP downs in the logging buffer between FROM[,TO] (\"2006-01-02 15:04\", TO defaults to now)")
+	flag.StringVar(&config.TraceTargets, "trace-targets", "", "File of HOST VRF DESTINATION [mpls] [expect-change] paths to traceroute each run and compare pre/post")
+	flag.BoolVar(&config.MTUSweep, "mtu-sweep", false, "Find the /30 and /31 core links of the targets, binary-search the largest df-bit ping over each and exit")
+	flag.IntVar(&config.MTURequired, "mtu-required", 9114, "MTU sweep: packet size (bytes, df-bit) every core link must carry")
+	flag.StringVar(&config.MTURoles, "mtu-roles", "", "MTU sweep: only devices with these roles or device types, comma-separated (default all targets)")
+	flag.StringVar(&config.FlowMonitor, "flow-monitor", "", "Record the cache of this flow monitor per VRF each run and check the flows re-appear after the cutover")
+	flag.BoolVar(&config.Warmup, "warmup", false, "Log in to every target before the run starts and report AAA failures and slow devices (with -persist the sessions stay open)")
+	flag.DurationVar(&config.WarmupSlow, "warmup-slow", 10*time.Second, "Warm-up logins slower than this are reported SLOW")
+	flag.StringVar(&config.RetryFailed, "retry-failed", "", "Collect the failed devices of this run (dir or PHASE@N) again, merge them into its reports and redo its comparisons")
+	flag.IntVar(&config.PairSkew, "pair-skew", 90, "Node pairs (inventory Pair column): warn when one member carries more than this percent of the pair's traffic (0 = off)")
+	flag.StringVar(&config.CompareResult, "compare-results", "", "Diff two validation result sets (-export json) check by check: OLD,NEW as VALIDATION json/csv, run dir or PHASE@N")
+	flag.StringVar(&config.WriteDefaults, "write-defaults", "", "Write the built-in command files, noise patterns and monitors to this directory for editing and exit")
 	var timeout int
 	flag.IntVar(&timeout, "timeout", 180, "Timeout (seconds)")
 	flag.Parse()
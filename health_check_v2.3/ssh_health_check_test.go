@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSSH puts an ssh script first on PATH for the test
+func fakeSSH(t *testing.T, script string) {
+	t.Helper()
+	if onWindows {
+		t.Skip("fake ssh is a shell script")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ssh"), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// waitGoroutines waits for the goroutine count to fall back to baseline
+func waitGoroutines(t *testing.T, baseline int, within time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(within)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("%d goroutines left, baseline %d:\n%s", runtime.NumGoroutine(), baseline, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// A device that logs in and then never answers nor closes the session: the
+// script session must give up within -timeout or -idle-timeout and leave no
+// goroutine behind, even though a child of ssh keeps the output pipe open
+func TestHungDeviceCleanup(t *testing.T) {
+	fakeSSH(t, "printf 'R1#'\nsleep 20\n")
+
+	tests := []struct {
+		name      string
+		timeout   time.Duration
+		idleLimit time.Duration
+		want      string
+		within    time.Duration
+	}{
+		{"timeout", time.Second, 0, "timeout", 3 * time.Second},
+		{"idle timeout", time.Minute, time.Second, "idle timeout", 4 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseline := runtime.NumGoroutine()
+			c := &SSHClient{host: "192.0.2.1", port: 22, username: "hc", cmdTimeout: tt.timeout, idleLimit: tt.idleLimit}
+
+			start := time.Now()
+			_, err := c.ExecuteContext(context.Background(), []string{"show version"})
+			took := time.Since(start)
+
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+			if took > tt.within {
+				t.Errorf("returned after %s, want within %s", took.Round(time.Millisecond), tt.within)
+			}
+			// Wait gives up on the pipe after cmd.WaitDelay
+			waitGoroutines(t, baseline, 10*time.Second)
+		})
+	}
+}
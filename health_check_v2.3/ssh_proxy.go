@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// SSH PROXY SUPPORT (jump host / ProxyCommand / SOCKS5)
+// ============================================================================
+//
+// Proxy specs are accepted globally (-proxy) or per device (inventory
+// column F / "proxy" in JSON):
+//
+//   socks5://[user:pass@]host:port   SOCKS5 proxy (built-in dialer)
+//   jump://[user@]host[:port]        ssh -W through a bastion (key or agent auth)
+//   command:<proxy command>          raw OpenSSH ProxyCommand (%h/%p expanded by ssh)
+//   direct                           ignore the global proxy for this device
+//
+// Native sessions (native_ssh.go) dial socks5:// and jump:// themselves;
+// the rest of this file is for OpenSSH. ssh carries the askpass secrets in
+// its environment (ssh_auth.go), and a ProxyCommand inherits it. So jump://
+// and command: run through this program (-proxy-exec), which drops the
+// secrets before it starts the real command; the SOCKS5 dialer is this
+// program itself. The SOCKS5 password travels the same way, in
+// HC_PROXY_PASSWORD, so that it never shows in ps or ssh -v: the
+// ProxyCommand line names the proxy without it.
+
+// proxyPasswordEnv carries the SOCKS5 password to -proxy-connect
+const proxyPasswordEnv = "HC_PROXY_PASSWORD"
+
+// proxyEnv is the environment -proxy-connect needs for spec, nil for none
+func proxyEnv(spec string) []string {
+	u, err := url.Parse(strings.TrimSpace(spec))
+	if err != nil || u.Scheme != "socks5" || u.User == nil {
+		return nil
+	}
+	if pass, ok := u.User.Password(); ok {
+		return []string{proxyPasswordEnv + "=" + pass}
+	}
+	return nil
+}
+
+// sshProxyArgs returns the extra ssh arguments needed to reach a device through spec
+func sshProxyArgs(spec string) ([]string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || strings.EqualFold(spec, "direct") {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(spec, "command:") {
+		return proxyExecArgs(strings.TrimPrefix(spec, "command:"))
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %v", spec, err)
+	}
+	switch u.Scheme {
+	case "jump":
+		if u.Hostname() == "" {
+			return nil, fmt.Errorf("invalid proxy %q: missing host", spec)
+		}
+		// What -J runs, minus the secrets
+		line := "ssh -W " + shellQuote("[%h]:%p")
+		if u.Port() != "" {
+			line += " -p " + shellQuote(u.Port())
+		}
+		if u.User != nil {
+			line += " -l " + shellQuote(u.User.Username())
+		}
+		return proxyExecArgs(line + " " + shellQuote(u.Hostname()))
+	case "socks5":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q: missing host:port", spec)
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("cannot locate own binary for SOCKS5 proxy: %v", err)
+		}
+		// The password goes in the environment (proxyEnv)
+		if u.User != nil {
+			u.User = url.User(u.User.Username())
+		}
+		proxyCmd := fmt.Sprintf("%s -proxy-connect %s %%h %%p", shellQuote(exe), shellQuote(u.String()))
+		return []string{"-o", "ProxyCommand=" + proxyCmd}, nil
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %q (use socks5://, jump:// or command:)", u.Scheme)
+}
+
+// proxyExecArgs makes line the ProxyCommand, run through -proxy-exec
+func proxyExecArgs(line string) ([]string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("cannot locate own binary for the ProxyCommand: %v", err)
+	}
+	return []string{"-o", "ProxyCommand=" + shellQuote(exe) + " -proxy-exec " + shellQuote(line)}, nil
+}
+
+// runProxyExec is invoked by ssh as a ProxyCommand: it runs line through the
+// platform shell on the same stdin/stdout, without the askpass secrets, and
+// returns its exit status
+func runProxyExec(line string) int {
+	cmd := shellCommand(context.Background(), line)
+	cmd.Env = withoutAskpassSecrets(os.Environ())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			return exit.ExitCode()
+		}
+		fmt.Fprintf(os.Stderr, "proxy command: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// runProxyConnect is invoked by ssh as a ProxyCommand: it dials host:port
+// through the SOCKS5 proxy in spec, with the password from
+// HC_PROXY_PASSWORD, and relays stdin/stdout over the tunnel.
+func runProxyConnect(spec, host, port string) error {
+	u, err := url.Parse(spec)
+	if err != nil || u.Scheme != "socks5" {
+		return fmt.Errorf("invalid SOCKS5 proxy %q", spec)
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); !ok && os.Getenv(proxyPasswordEnv) != "" {
+			u.User = url.UserPassword(u.User.Username(), os.Getenv(proxyPasswordEnv))
+		}
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", port)
+	}
+
+	conn, err := dialSOCKS5(u, host, p, 30*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(conn, os.Stdin)
+		if tc, ok := conn.(*net.TCPConn); ok {
+			tc.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(os.Stdout, conn)
+		done <- struct{}{}
+	}()
+	<-done
+	return nil
+}
+
+// dialSOCKS5 performs a SOCKS5 CONNECT (RFC 1928) with optional
+// username/password authentication (RFC 1929).
+func dialSOCKS5(proxy *url.URL, host string, port int, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", proxy.Host, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("SOCKS5 proxy %s unreachable: %v", proxy.Host, err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	fail := func(format string, args ...interface{}) (net.Conn, error) {
+		conn.Close()
+		return nil, fmt.Errorf("SOCKS5 %s: "+format, append([]interface{}{proxy.Host}, args...)...)
+	}
+
+	methods := []byte{0x00}
+	if proxy.User != nil {
+		methods = []byte{0x00, 0x02}
+	}
+	if _, err := conn.Write(append([]byte{0x05, byte(len(methods))}, methods...)); err != nil {
+		return fail("%v", err)
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fail("%v", err)
+	}
+	if reply[0] != 0x05 {
+		return fail("not a SOCKS5 server")
+	}
+
+	switch reply[1] {
+	case 0x00:
+	case 0x02:
+		if proxy.User == nil {
+			return fail("proxy requires username/password")
+		}
+		user := proxy.User.Username()
+		pass, _ := proxy.User.Password()
+		msg := []byte{0x01, byte(len(user))}
+		msg = append(msg, user...)
+		msg = append(msg, byte(len(pass)))
+		msg = append(msg, pass...)
+		if _, err := conn.Write(msg); err != nil {
+			return fail("%v", err)
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return fail("%v", err)
+		}
+		if reply[1] != 0x00 {
+			return fail("authentication failed")
+		}
+	default:
+		return fail("no acceptable authentication method")
+	}
+
+	req := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		req = append(req, 0x01)
+		req = append(req, ip.To4()...)
+	} else if ip != nil {
+		req = append(req, 0x04)
+		req = append(req, ip.To16()...)
+	} else {
+		req = append(req, 0x03, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return fail("%v", err)
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return fail("%v", err)
+	}
+	if head[1] != 0x00 {
+		return fail("CONNECT to %s:%d refused (code %d)", host, port, head[1])
+	}
+	var skip int
+	switch head[3] {
+	case 0x01:
+		skip = 4
+	case 0x04:
+		skip = 16
+	case 0x03:
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return fail("%v", err)
+		}
+		skip = int(l[0])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, skip+2)); err != nil {
+		return fail("%v", err)
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
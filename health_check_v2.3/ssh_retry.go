@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// RETRIES OF TRANSIENT SSH FAILURES
+// ============================================================================
+//
+// During a chassis swap or a line card reload a device may reset one TCP
+// connection and answer the next one. A session that fails on such a
+// transient error is tried again with exponential backoff instead of
+// marking the device FAILED:
+//
+//   -retries 2 -retry-backoff 2s -retry-jitter 0.2 -retry-on reset,closed,refused
+//
+// waits 2s then 4s, each randomized by up to 20% so that devices behind the
+// same reset do not come back in lockstep. When the session is lost mid
+// batch, only the commands whose output did not arrive complete are run
+// again. Configuration batches (ExecuteConfig) are never resumed in the
+// middle, as the rest would run outside configure mode; they are retried
+// only when no command ran. When the retries run out, the device fails as
+// before when nothing ran; output received before a lost session is kept,
+// the commands it did not finish are marked "(not run: ...)" and the batch
+// fails with an *incompleteBatchError.
+//
+// Error classes (-retry-on, comma-separated, or "any" for all of them):
+//
+//   reset        connection reset by peer, broken pipe
+//   closed       connection closed by the remote host, session lost
+//   refused      connection refused (vty lines busy, ssh restarting)
+//   timeout      connect or session timeout (each costs up to -timeout)
+//   unreachable  no route to host, network unreachable
+//
+// Authentication failures are never retried, so that a wrong password does
+// not lock the account, and neither are a refused enable secret
+// (enable_mode.go), Ctrl-C or a device the breaker marked unreachable
+// (circuit_breaker.go).
+
+// retryClassNames are the classes of -retry-on any, in match order
+var retryClassNames = []string{"reset", "closed", "refused", "timeout", "unreachable"}
+
+var retryClasses = map[string][]string{
+	"reset":       {"connection reset", "reset by peer", "broken pipe"},
+	"closed":      {"closed by remote host", "connection closed", "session lost", "unexpected eof"},
+	"refused":     {"connection refused"},
+	"timeout":     {"timeout", "timed out"},
+	"unreachable": {"no route to host", "network is unreachable", "host is unreachable"},
+}
+
+// retryNever are errors a retry cannot fix
+var retryNever = []string{"permission denied", "authentication", "access denied", "host key", "(-breaker)", "enable denied", interruptedMsg}
+
+// retryPolicy is the parsed -retries, -retry-backoff, -retry-jitter and
+// -retry-on
+type retryPolicy struct {
+	count   int
+	backoff time.Duration
+	jitter  float64
+	classes []string
+}
+
+// parseRetryPolicy returns nil (no retries) for count <= 0
+func parseRetryPolicy(count int, backoff time.Duration, jitter float64, on string) (*retryPolicy, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+	if backoff <= 0 {
+		return nil, fmt.Errorf("-retry-backoff must be positive")
+	}
+	if jitter < 0 || jitter >= 1 {
+		return nil, fmt.Errorf("-retry-jitter %g is not between 0 and 1", jitter)
+	}
+	p := &retryPolicy{count: count, backoff: backoff, jitter: jitter}
+	for _, class := range strings.Split(on, ",") {
+		class = strings.ToLower(strings.TrimSpace(class))
+		switch {
+		case class == "":
+		case class == "any":
+			p.classes = append(p.classes, retryClassNames...)
+		case retryClasses[class] != nil:
+			p.classes = append(p.classes, class)
+		default:
+			return nil, fmt.Errorf("-retry-on: unknown class %q (%s, any)", class, strings.Join(retryClassNames, ", "))
+		}
+	}
+	if len(p.classes) == 0 {
+		return nil, fmt.Errorf("-retry-on names no error class")
+	}
+	return p, nil
+}
+
+// transient returns the class of a retryable error, "" when it is not
+func (p *retryPolicy) transient(err error) string {
+	if p == nil || err == nil {
+		return ""
+	}
+	msg := strings.ToLower(err.Error())
+	for _, never := range retryNever {
+		if strings.Contains(msg, never) {
+			return ""
+		}
+	}
+	for _, class := range p.classes {
+		for _, hint := range retryClasses[class] {
+			if strings.Contains(msg, hint) {
+				return class
+			}
+		}
+	}
+	return ""
+}
+
+// wait is the pause before retry n (1-based): backoff doubled per retry,
+// randomized by the jitter
+func (p *retryPolicy) wait(n int) time.Duration {
+	d := float64(p.backoff) * float64(int64(1)<<(n-1))
+	if p.jitter > 0 {
+		d *= 1 + p.jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d).Round(time.Millisecond)
+}
+
+// sleepContext waits d and returns false when ctx is done meanwhile
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// pendingCommands are the commands of a batch without output yet
+func pendingCommands(commands []string, results map[string]string) []string {
+	var rest []string
+	for _, cmd := range commands {
+		if _, ok := results[cmd]; !ok {
+			rest = append(rest, cmd)
+		}
+	}
+	return rest
+}
+
+// incompleteBatchError is a batch whose session was lost after some of its
+// commands ran
+type incompleteBatchError struct {
+	notRun, total int
+	err           error
+}
+
+func (e *incompleteBatchError) Error() string {
+	return fmt.Sprintf("%d of %d commands not run: %v", e.notRun, e.total, e.err)
+}
+
+func (e *incompleteBatchError) Unwrap() error { return e.err }
+
+// isIncompleteBatch reports whether err left output of a partly run batch
+func isIncompleteBatch(err error) bool {
+	var incomplete *incompleteBatchError
+	return errors.As(err, &incomplete)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryTransient(t *testing.T) {
+	p, err := parseRetryPolicy(2, time.Second, 0, "reset,closed,refused")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		err  string
+		want string
+	}{
+		{"read: connection reset by peer", "reset"},
+		{"session lost after 1 of 3 commands: Connection to 192.0.2.1 closed by remote host.", "closed"},
+		{"ssh: connect to host 192.0.2.1 port 22: Connection refused", "refused"},
+		{"timeout", ""}, // not in -retry-on
+		{"hc@192.0.2.1: Permission denied (publickey,password).", ""},
+		{"Received disconnect: Too many authentication failures, connection closed", ""},
+		{"enable denied: % Bad secrets", ""},
+		{"192.0.2.1 unreachable, skipped (-breaker)", ""},
+	}
+	for _, tt := range tests {
+		if got := p.transient(errors.New(tt.err)); got != tt.want {
+			t.Errorf("transient(%q) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+	var off *retryPolicy
+	if got := off.transient(errors.New("connection reset")); got != "" {
+		t.Errorf("nil policy retries %q", got)
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	p := &retryPolicy{count: 3, backoff: 100 * time.Millisecond}
+	for n, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		if got := p.wait(n + 1); got != want {
+			t.Errorf("wait(%d) = %s, want %s", n+1, got, want)
+		}
+	}
+	p.jitter = 0.2
+	for i := 0; i < 100; i++ {
+		if got := p.wait(2); got < 160*time.Millisecond || got > 240*time.Millisecond {
+			t.Fatalf("wait(2) with 20%% jitter = %s, want 160ms..240ms", got)
+		}
+	}
+}
+
+// fakeDroppingSSH is a device that answers every command. Its first session
+// is closed when the second command starts, the next ones up to drops
+// before the first. Each session's stdin is kept in dir/session<n>.
+func fakeDroppingSSH(t *testing.T, drops int) string {
+	dir := t.TempDir()
+	fakeSSH(t, fmt.Sprintf(`n=$(cat %[1]s/sessions 2>/dev/null || echo 0); n=$((n+1)); echo $n > %[1]s/sessions
+drop() { cat >> %[1]s/session$n; echo "Connection to 192.0.2.1 closed by remote host." >&2; exit 255; }
+while IFS= read -r line; do
+  echo "$line" >> %[1]s/session$n
+  case "$line" in
+    "echo ===START_0===")
+      if [ $n -gt 1 ] && [ $n -le %[2]d ]; then drop; fi
+      echo "===START_0===";;
+    "echo ===START_1===")
+      if [ $n -eq 1 ] && [ $n -le %[2]d ]; then drop; fi
+      echo "===START_1===";;
+    echo\ *) echo "${line#echo }";;
+    exit) exit 0;;
+    *) echo "out $line";;
+  esac
+done
+`, dir, drops))
+	return dir
+}
+
+// sessionCommands are the device commands a fake session received
+func sessionCommands(t *testing.T, dir string, n int) []string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("session%d", n)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cmds []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if !strings.HasPrefix(line, "echo ") && !strings.HasPrefix(line, "terminal ") && line != "exit" {
+			cmds = append(cmds, line)
+		}
+	}
+	return cmds
+}
+
+func sessionCount(t *testing.T, dir string) int {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "sessions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	fmt.Sscan(string(data), &n)
+	return n
+}
+
+// A session lost after command 1 of 3 is resumed at command 2 for show
+// commands, but a configuration batch is not resumed in the middle; a batch
+// left unfinished fails with the commands marked "(not run: ...)"
+func TestRetryLostSession(t *testing.T) {
+	commands := []string{"show version", "show inventory", "show clock"}
+	config := []string{"configure terminal", "interface Gi0/0/0", "shutdown"}
+	policy := &retryPolicy{count: 2, backoff: 10 * time.Millisecond, classes: []string{"closed"}}
+
+	tests := []struct {
+		name     string
+		drops    int
+		config   bool
+		sessions int
+		replayed []string // commands of the last session
+		wantErr  bool
+	}{
+		{"resumed", 1, false, 2, []string{"show inventory", "show clock"}, false},
+		{"retries run out", 9, false, 3, []string{"show inventory", "show clock"}, true},
+		{"config not resumed", 1, true, 1, config, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := fakeDroppingSSH(t, tt.drops)
+			c := &SSHClient{host: "192.0.2.1", port: 22, username: "hc", cmdTimeout: 10 * time.Second, retry: policy}
+
+			batch := commands
+			var results map[string]string
+			var err error
+			if tt.config {
+				batch = config
+				results, err = c.ExecuteConfig(batch)
+			} else {
+				results, err = c.ExecuteContext(context.Background(), batch)
+			}
+
+			if got := sessionCount(t, dir); got != tt.sessions {
+				t.Errorf("%d sessions, want %d", got, tt.sessions)
+			}
+			if got := sessionCommands(t, dir, tt.sessions); strings.Join(got, "|") != strings.Join(tt.replayed, "|") {
+				t.Errorf("last session ran %q, want %q", got, tt.replayed)
+			}
+			if results[batch[0]] != "out "+batch[0] {
+				t.Errorf("output of %q = %q", batch[0], results[batch[0]])
+			}
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("err = %v", err)
+				}
+				if results[batch[2]] != "out "+batch[2] {
+					t.Errorf("output of %q = %q", batch[2], results[batch[2]])
+				}
+				return
+			}
+			if !isIncompleteBatch(err) || !strings.Contains(err.Error(), "2 of 3 commands not run") {
+				t.Fatalf("err = %v, want 2 of 3 commands not run", err)
+			}
+			if !strings.HasPrefix(results[batch[2]], "(not run: ") {
+				t.Errorf("output of %q = %q, want (not run: ...)", batch[2], results[batch[2]])
+			}
+		})
+	}
+}
+
+// A failed login is never tried again, so a wrong password cannot lock the
+// account
+func TestRetryNotOnAuthFailure(t *testing.T) {
+	dir := t.TempDir()
+	fakeSSH(t, fmt.Sprintf("echo x >> %s/sessions\necho 'hc@192.0.2.1: Permission denied (publickey,password).' >&2\nexit 255\n", dir))
+	c := &SSHClient{host: "192.0.2.1", port: 22, username: "hc", cmdTimeout: 10 * time.Second,
+		retry: &retryPolicy{count: 2, backoff: 10 * time.Millisecond, classes: retryClassNames}}
+
+	_, err := c.ExecuteContext(context.Background(), []string{"show version"})
+	if err == nil || !strings.Contains(err.Error(), "Permission denied") {
+		t.Fatalf("err = %v, want Permission denied", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "sessions"))
+	if n := strings.Count(string(data), "x"); n != 1 {
+		t.Errorf("%d logins, want 1", n)
+	}
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// STATIC ROUTE AUDIT - per-VRF statics vs interfaces and the design intent
+// ============================================================================
+//
+// Every static route in the running-config (XR "router static", XE "ip route"
+// and "ipv6 route") is listed per device and VRF, and checked against the
+// device's own interface addressing, so that statics left behind by the
+// migration re-addressing show up:
+//
+//   INTERFACE_GONE     the exit interface is not configured any more
+//   INTERFACE_SHUT     the exit interface is shut down
+//   NEXTHOP_SELF       the next hop is one of the device's own addresses
+//   NEXTHOP_UNRESOLVED the next hop is on no connected subnet of the VRF and
+//                      no other static covers it; fine if an IGP or BGP
+//                      route resolves it, otherwise the route is dead
+//
+// Routes with an administrative distance above 1 are marked floating.
+//
+// With -static-intent, the CSV hostname,vrf,prefix,next_hop,interface,distance
+// lists the statics the design expects. "*" as hostname applies to every
+// audited device; empty next_hop, interface or distance columns are not
+// compared. Configured statics not in the intent are UNEXPECTED and intent
+// rows with no matching static are MISSING.
+
+// StaticRoute is one configured static route
+type StaticRoute struct {
+	VRF        string
+	Prefix     *net.IPNet
+	NextHop    string // "" for interface-only routes
+	NextHopVRF string // XR "vrf X" / XE "vrf X" inter-VRF next hop
+	Interface  string
+	Distance   int
+	Name       string // XE name / XR description
+}
+
+// Floating reports whether the route only backs up a better one
+func (s *StaticRoute) Floating() bool {
+	return s.Distance > 1
+}
+
+// InterfaceAddressing is the VRF, state and subnets of one configured interface
+type InterfaceAddressing struct {
+	Name     string
+	VRF      string
+	Shutdown bool
+	Subnets  []*net.IPNet // address with its mask, e.g. 10.0.0.1/30
+}
+
+// StaticConfig is what the static route audit reads from a running-config
+type StaticConfig struct {
+	Interfaces map[string]*InterfaceAddressing // keyed by lower-case name
+	Statics    []*StaticRoute
+}
+
+// StaticIntent is one expected static route from the design
+type StaticIntent struct {
+	Hostname  string // "*" applies to every device
+	VRF       string
+	Prefix    *net.IPNet
+	NextHop   string
+	Interface string
+	Distance  int // 0 = not compared
+}
+
+// StaticFinding is the audit outcome for one static route or intent row
+type StaticFinding struct {
+	Hostname string
+	Route    *StaticRoute  // nil for MISSING
+	Intent   *StaticIntent // matching intent row, if any
+	Issues   []string
+	Details  []string
+}
+
+// parseStaticConfig reads interface addressing and static routes from a
+// running-config in either XR or XE layout
+func parseStaticConfig(output string) *StaticConfig {
+	sc := &StaticConfig{Interfaces: make(map[string]*InterfaceAddressing)}
+
+	section := "" // interface, static
+	var iface *InterfaceAddressing
+	staticVRF, staticVRFIndent := "default", -1
+
+	for _, raw := range strings.Split(output, "\n") {
+		line := strings.TrimRight(raw, "\r ")
+		t := strings.TrimSpace(line)
+		if t == "" || t == "!" {
+			continue
+		}
+		ind := indentOf(line)
+		f := strings.Fields(t)
+
+		if ind == 0 {
+			section, iface = "", nil
+			staticVRF, staticVRFIndent = "default", -1
+			switch {
+			case len(f) == 2 && f[0] == "interface":
+				iface = &InterfaceAddressing{Name: f[1], VRF: "default"}
+				sc.Interfaces[strings.ToLower(f[1])] = iface
+				section = "interface"
+			case len(f) == 2 && f[0] == "router" && f[1] == "static":
+				section = "static"
+			case len(f) >= 4 && (f[0] == "ip" || f[0] == "ipv6") && f[1] == "route":
+				if r := parseXEStatic(f[2:]); r != nil {
+					sc.Statics = append(sc.Statics, r)
+				}
+			}
+			continue
+		}
+
+		switch section {
+		case "interface":
+			switch {
+			case t == "shutdown":
+				iface.Shutdown = true
+			case len(f) == 2 && f[0] == "vrf":
+				iface.VRF = f[1]
+			case len(f) == 3 && f[0] == "vrf" && f[1] == "forwarding":
+				iface.VRF = f[2]
+			case len(f) == 4 && f[0] == "ip" && f[1] == "vrf" && f[2] == "forwarding":
+				iface.VRF = f[3]
+			case len(f) >= 4 && (f[0] == "ipv4" || f[0] == "ip") && f[1] == "address":
+				if n := maskedSubnet(f[2], f[3]); n != nil {
+					iface.Subnets = append(iface.Subnets, n)
+				}
+			case len(f) >= 3 && f[0] == "ipv6" && f[1] == "address":
+				if ip, n, err := net.ParseCIDR(f[2]); err == nil {
+					iface.Subnets = append(iface.Subnets, &net.IPNet{IP: ip, Mask: n.Mask})
+				}
+			}
+
+		case "static":
+			if staticVRFIndent >= 0 && ind <= staticVRFIndent && !(len(f) == 2 && f[0] == "vrf") {
+				staticVRF, staticVRFIndent = "default", -1
+			}
+			switch {
+			case len(f) == 2 && f[0] == "vrf":
+				staticVRF, staticVRFIndent = f[1], ind
+			case f[0] == "address-family":
+			default:
+				if _, prefix, err := net.ParseCIDR(f[0]); err == nil {
+					r := &StaticRoute{VRF: staticVRF, Prefix: prefix, Distance: 1}
+					parseStaticTarget(r, f[1:])
+					sc.Statics = append(sc.Statics, r)
+				}
+			}
+		}
+	}
+	return sc
+}
+
+// parseXEStatic reads the words after "ip route" / "ipv6 route"
+func parseXEStatic(f []string) *StaticRoute {
+	r := &StaticRoute{VRF: "default", Distance: 1}
+	if len(f) >= 2 && f[0] == "vrf" {
+		r.VRF, f = f[1], f[2:]
+	}
+	if len(f) == 0 {
+		return nil
+	}
+	if _, prefix, err := net.ParseCIDR(f[0]); err == nil {
+		r.Prefix, f = prefix, f[1:]
+	} else if len(f) >= 2 {
+		if r.Prefix = maskedSubnet(f[0], f[1]); r.Prefix == nil {
+			return nil
+		}
+		r.Prefix = &net.IPNet{IP: r.Prefix.IP.Mask(r.Prefix.Mask), Mask: r.Prefix.Mask}
+		f = f[2:]
+	} else {
+		return nil
+	}
+	parseStaticTarget(r, f)
+	return r
+}
+
+// parseStaticTarget reads "[vrf X] [interface] [next-hop] [distance] [options]"
+func parseStaticTarget(r *StaticRoute, f []string) {
+	for i := 0; i < len(f); i++ {
+		w := f[i]
+		switch {
+		case (w == "vrf" || w == "global") && r.NextHop == "" && r.Interface == "":
+			if w == "vrf" && i+1 < len(f) {
+				r.NextHopVRF = f[i+1]
+				i++
+			} else {
+				r.NextHopVRF = "default"
+			}
+		case (w == "name" || w == "description") && i+1 < len(f):
+			r.Name = strings.Join(f[i+1:], " ")
+			return
+		case w == "tag" || w == "track" || w == "metric" || w == "bfd":
+			i++
+		case isIPAddress(w) && r.NextHop == "":
+			r.NextHop = w
+		case isStaticNumber(w):
+			r.Distance, _ = strconv.Atoi(w)
+		case r.Interface == "" && r.NextHop == "" && isInterfaceName(w):
+			r.Interface = w
+		}
+	}
+}
+
+func isStaticNumber(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n >= 1 && n <= 255
+}
+
+// isInterfaceName matches names like GigabitEthernet0/0/0/1, BE100.20, Null0
+func isInterfaceName(s string) bool {
+	if s == "" || !(s[0] >= 'A' && s[0] <= 'Z' || s[0] >= 'a' && s[0] <= 'z') {
+		return false
+	}
+	return strings.IndexAny(s, "0123456789") > 0
+}
+
+// maskedSubnet turns "10.0.0.1 255.255.255.252" into 10.0.0.1/30
+func maskedSubnet(addr, mask string) *net.IPNet {
+	ip := net.ParseIP(addr).To4()
+	m := net.ParseIP(mask).To4()
+	if ip == nil || m == nil {
+		return nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.IPMask(m)}
+}
+
+// loadStaticIntent reads hostname,vrf,prefix,next_hop,interface,distance rows
+func loadStaticIntent(filename string) ([]StaticIntent, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var intents []StaticIntent
+	for n, r := range records {
+		if len(r) < 3 || strings.EqualFold(r[0], "hostname") {
+			continue
+		}
+		for len(r) < 6 {
+			r = append(r, "")
+		}
+		_, prefix, err := net.ParseCIDR(strings.TrimSpace(r[2]))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: prefix %q is not in a.b.c.d/len form", n+1, r[2])
+		}
+		vrf := strings.TrimSpace(r[1])
+		if vrf == "" {
+			vrf = "default"
+		}
+		in := StaticIntent{
+			Hostname:  strings.TrimSpace(r[0]),
+			VRF:       vrf,
+			Prefix:    prefix,
+			NextHop:   strings.TrimSpace(r[3]),
+			Interface: strings.TrimSpace(r[4]),
+		}
+		if d := strings.TrimSpace(r[5]); d != "" {
+			if in.Distance, err = strconv.Atoi(d); err != nil {
+				return nil, fmt.Errorf("row %d: distance %q is not a number", n+1, d)
+			}
+		}
+		intents = append(intents, in)
+	}
+	return intents, nil
+}
+
+func (in *StaticIntent) appliesTo(host, vrf string, prefix *net.IPNet) bool {
+	return (in.Hostname == "*" || strings.EqualFold(in.Hostname, host)) &&
+		strings.EqualFold(in.VRF, vrf) && in.Prefix.String() == prefix.String()
+}
+
+func (in *StaticIntent) matches(r *StaticRoute) bool {
+	return (in.NextHop == "" || in.NextHop == r.NextHop) &&
+		(in.Interface == "" || strings.EqualFold(in.Interface, r.Interface))
+}
+
+// checkNextHop applies the interface and next-hop checks to one route
+func (sc *StaticConfig) checkNextHop(r *StaticRoute, f *StaticFinding) {
+	if r.Interface != "" && !strings.HasPrefix(strings.ToLower(r.Interface), "null") {
+		iface, ok := sc.Interfaces[strings.ToLower(r.Interface)]
+		switch {
+		case !ok:
+			f.Issues = append(f.Issues, "INTERFACE_GONE")
+			f.Details = append(f.Details, fmt.Sprintf("interface %s is not configured", r.Interface))
+		case iface.Shutdown:
+			f.Issues = append(f.Issues, "INTERFACE_SHUT")
+			f.Details = append(f.Details, fmt.Sprintf("interface %s is shut down", r.Interface))
+		}
+	}
+	if r.NextHop == "" || len(f.Issues) > 0 {
+		return
+	}
+	nh := net.ParseIP(r.NextHop)
+	vrf := r.VRF
+	if r.NextHopVRF != "" {
+		vrf = r.NextHopVRF
+	}
+
+	for _, iface := range sc.Interfaces {
+		for _, n := range iface.Subnets {
+			if n.IP.Equal(nh) {
+				f.Issues = append(f.Issues, "NEXTHOP_SELF")
+				f.Details = append(f.Details, fmt.Sprintf("next hop %s is the address of %s", r.NextHop, iface.Name))
+				return
+			}
+		}
+	}
+	for _, iface := range sc.Interfaces {
+		if iface.Shutdown || !strings.EqualFold(iface.VRF, vrf) {
+			continue
+		}
+		for _, n := range iface.Subnets {
+			if n.Contains(nh) {
+				return
+			}
+		}
+	}
+	// A more specific static can resolve the next hop recursively; a default
+	// route would cover everything and proves nothing
+	for _, other := range sc.Statics {
+		if other == r || !strings.EqualFold(other.VRF, vrf) {
+			continue
+		}
+		if ones, _ := other.Prefix.Mask.Size(); ones > 0 && other.Prefix.Contains(nh) {
+			return
+		}
+	}
+	f.Issues = append(f.Issues, "NEXTHOP_UNRESOLVED")
+	f.Details = append(f.Details, fmt.Sprintf("next hop %s is on no connected subnet of VRF %s", r.NextHop, vrf))
+}
+
+// auditStaticRoutes lists and checks the statics of every device with a
+// running-config, against the intent when one is given
+func auditStaticRoutes(results []*DeviceResult, intents []StaticIntent) []StaticFinding {
+	var findings []StaticFinding
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		var sc *StaticConfig
+		for _, e := range r.Results {
+			if isRunningConfig(e.Command) {
+				sc = parseStaticConfig(e.Output)
+				break
+			}
+		}
+		if sc == nil {
+			continue
+		}
+		host := r.Device.Hostname
+		used := make(map[*StaticIntent]bool)
+
+		for _, route := range sc.Statics {
+			f := StaticFinding{Hostname: host, Route: route}
+			sc.checkNextHop(route, &f)
+
+			if len(intents) > 0 {
+				var candidates []*StaticIntent
+				for i := range intents {
+					if in := &intents[i]; in.appliesTo(host, route.VRF, route.Prefix) {
+						candidates = append(candidates, in)
+						if f.Intent == nil && in.matches(route) {
+							f.Intent = in
+						}
+					}
+				}
+				switch {
+				case len(candidates) == 0:
+					f.Issues = append(f.Issues, "UNEXPECTED")
+				case f.Intent == nil:
+					f.Issues = append(f.Issues, "NEXTHOP")
+					for _, in := range candidates {
+						f.Details = append(f.Details, fmt.Sprintf("design: via %s", intentTarget(in)))
+					}
+				default:
+					used[f.Intent] = true
+					if f.Intent.Distance != 0 && f.Intent.Distance != route.Distance {
+						f.Issues = append(f.Issues, "DISTANCE")
+						f.Details = append(f.Details, fmt.Sprintf("design distance %d, configured %d", f.Intent.Distance, route.Distance))
+					}
+				}
+			}
+			findings = append(findings, f)
+		}
+
+		for i := range intents {
+			in := &intents[i]
+			if used[in] || !(in.Hostname == "*" || strings.EqualFold(in.Hostname, host)) {
+				continue
+			}
+			findings = append(findings, StaticFinding{Hostname: host, Intent: in, Issues: []string{"MISSING"}})
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Hostname < findings[j].Hostname
+	})
+	return findings
+}
+
+func intentTarget(in *StaticIntent) string {
+	parts := []string{}
+	if in.Interface != "" {
+		parts = append(parts, in.Interface)
+	}
+	if in.NextHop != "" {
+		parts = append(parts, in.NextHop)
+	}
+	if len(parts) == 0 {
+		return "any"
+	}
+	return strings.Join(parts, " ")
+}
+
+// WriteStaticAudit writes STATIC_ROUTES_<ts>.log
+func (w *OutputWriter) WriteStaticAudit(findings []StaticFinding, intentFile string) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("STATIC_ROUTES_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	configured, floating, problems := 0, 0, 0
+	for _, f := range findings {
+		if len(f.Issues) > 0 {
+			problems++
+		}
+		if f.Route != nil {
+			configured++
+			if f.Route.Floating() {
+				floating++
+			}
+		}
+	}
+
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Static Route Audit\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, " Design intent: %s\n", orDash(intentFile))
+	fmt.Fprintf(file, "================================================================================\n\n")
+	fmt.Fprintf(file, " Static routes: %d | Floating: %d | Problems: %d\n\n", configured, floating, problems)
+
+	table := newTextTable("HOSTNAME", "VRF", "PREFIX", "NEXT_HOP", "INTERFACE", "DIST", "STATUS")
+	for _, f := range findings {
+		status := "OK"
+		if len(f.Issues) > 0 {
+			status = strings.Join(f.Issues, ",")
+		}
+		if f.Route == nil {
+			in := f.Intent
+			dist := "-"
+			if in.Distance != 0 {
+				dist = strconv.Itoa(in.Distance)
+			}
+			table.add(hostSite(f.Hostname), displayHost(f.Hostname), in.VRF, in.Prefix, orDash(in.NextHop), orDash(in.Interface), dist, status)
+			continue
+		}
+		r := f.Route
+		nh := orDash(r.NextHop)
+		if r.NextHopVRF != "" {
+			nh += " (vrf " + r.NextHopVRF + ")"
+		}
+		dist := strconv.Itoa(r.Distance)
+		if r.Floating() {
+			dist += " floating"
+		}
+		table.add(hostSite(f.Hostname), displayHost(f.Hostname), r.VRF, r.Prefix, nh, orDash(r.Interface), dist, status)
+		for _, d := range f.Details {
+			table.note("    %s", d)
+		}
+	}
+	table.write(file)
+	return nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// TE TUNNEL BASELINE (TE_<ts>.csv) AND PRE/POST TUNNEL CHECK
+// ============================================================================
+//
+// The RSVP-TE tunnels and SR-TE policies of the head ends have to come back
+// after the core swap, on the paths they used before. Every run writes
+// TE_<ts>.csv with one row per tunnel the device is head end of:
+//
+//   show mpls traffic-eng tunnels               RSVP-TE: admin and oper
+//                                               state, bandwidth, the path
+//                                               option in use
+//   show segment-routing traffic-eng policy     SR-TE (XE: "... policy all"):
+//                                               admin and oper state, the
+//                                               active candidate path
+//
+// and comparePhases checks them tunnel by tunnel:
+//
+//   FAIL  up before, down (or gone) after: it did not re-signal
+//   FAIL  down before and still down after
+//   WARN  up on another path option / candidate path than before (fell back
+//         to a secondary path)
+//   WARN  bandwidth changed
+//
+// RSVP-TE tunnels are named by their interface (tunnel-te100, Tunnel100),
+// SR-TE policies by color and end-point, as the auto-generated policy names
+// may differ between runs. Tunnels that are admin down in both runs, and
+// tunnels new in the post run, are not judged. Hosts without tunnel data in
+// the post run (not collected) are skipped.
+
+const (
+	teCommand        = "traffic-eng tunnels"
+	teBaselinePrefix = "TE_"
+	teBaselineCols   = "Hostname,Type,Tunnel,Destination,Admin,Oper,BandwidthKbps,Path"
+)
+
+var (
+	teRSVPNameRe  = regexp.MustCompile(`^Name: (\S+)\s+(?:\((\S+)\)\s+)?Destination: (\S+)`)
+	teStateRe     = regexp.MustCompile(`Admin:\s*(\w+),?\s+Oper(?:ational)?:\s*(\w+)`)
+	teBandwidthRe = regexp.MustCompile(`^\s*Bandwidth(?: Requested)?:\s*(\d+)\s*kbps`)
+	tePathRe      = regexp.MustCompile(`path option (\d+),\s+type ([^(]+?)\s*\(Basis for Setup`)
+	teSRPolicyRe  = regexp.MustCompile(`Color:? (\d+),? End-?point:? ([^\s)]+)`)
+	tePrefRe      = regexp.MustCompile(`^\s*Preference:? (\d+)`)
+)
+
+// TETunnel is the state of one RSVP-TE tunnel or SR-TE policy
+type TETunnel struct {
+	Type        string // rsvp-te, sr-te
+	Name        string // tunnel interface, "color C end-point E"
+	Destination string
+	Admin       string
+	Oper        string
+	Bandwidth   string // kbps, RSVP-TE only
+	Path        string // path option / candidate path in use
+}
+
+// teKey identifies a tunnel across runs
+type teKey struct {
+	Host, Type, Name string
+}
+
+func (t TETunnel) up() bool {
+	return strings.EqualFold(t.Oper, "up")
+}
+
+// parseTETunnels reads the tunnel outputs of a device
+func parseTETunnels(results []ExecutionResult) []TETunnel {
+	var tunnels []TETunnel
+	for _, e := range results {
+		cmd := strings.ToLower(e.Command)
+		if isCommandRejected(e.Output) || strings.Contains(cmd, "brief") || strings.Contains(cmd, "summary") {
+			continue
+		}
+		switch {
+		case strings.Contains(cmd, "mpls traffic-eng tunnels"):
+			var cur *TETunnel
+			for _, line := range strings.Split(e.Output, "\n") {
+				if m := teRSVPNameRe.FindStringSubmatch(line); m != nil {
+					name := m[1]
+					if m[2] != "" {
+						name = m[2] // XE: "Name: <signalled name> (Tunnel100)"
+					}
+					tunnels = append(tunnels, TETunnel{Type: "rsvp-te", Name: name, Destination: m[3]})
+					cur = &tunnels[len(tunnels)-1]
+					continue
+				}
+				if cur == nil {
+					continue
+				}
+				if m := teStateRe.FindStringSubmatch(line); m != nil && cur.Oper == "" {
+					cur.Admin, cur.Oper = strings.ToLower(m[1]), strings.ToLower(m[2])
+				}
+				if m := teBandwidthRe.FindStringSubmatch(line); m != nil && cur.Bandwidth == "" {
+					cur.Bandwidth = m[1]
+				}
+				if m := tePathRe.FindStringSubmatch(line); m != nil && cur.Path == "" {
+					cur.Path = "option " + m[1] + " " + strings.Join(strings.Fields(m[2]), " ")
+				}
+			}
+		case strings.Contains(cmd, "segment-routing traffic-eng policy"):
+			var cur *TETunnel
+			pref := ""
+			for _, line := range strings.Split(e.Output, "\n") {
+				if m := teSRPolicyRe.FindStringSubmatch(line); m != nil {
+					tunnels = append(tunnels, TETunnel{Type: "sr-te", Name: "color " + m[1] + " end-point " + m[2], Destination: m[2]})
+					cur, pref = &tunnels[len(tunnels)-1], ""
+					continue
+				}
+				if cur == nil {
+					continue
+				}
+				if m := teStateRe.FindStringSubmatch(line); m != nil && cur.Oper == "" {
+					cur.Admin, cur.Oper = strings.ToLower(m[1]), strings.ToLower(m[2])
+				}
+				// XR prints "(active)" on the preference line, XE on the
+				// line below it
+				if m := tePrefRe.FindStringSubmatch(line); m != nil {
+					pref = m[1]
+				}
+				if strings.Contains(line, "(active)") && pref != "" && cur.Path == "" {
+					cur.Path = "preference " + pref
+				}
+			}
+		}
+	}
+	return tunnels
+}
+
+// WriteTE writes TE_<ts>.csv, the per-tunnel baseline
+func (w *OutputWriter) WriteTE(results []*DeviceResult) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("%s%s.csv", teBaselinePrefix, w.timestamp))
+	rows := [][]string{strings.Split(teBaselineCols, ",")}
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		for _, t := range parseTETunnels(r.Results) {
+			rows = append(rows, []string{r.Device.Hostname, t.Type, t.Name, t.Destination, t.Admin, t.Oper, t.Bandwidth, t.Path})
+		}
+	}
+	return writeCSVRows(filename, rows)
+}
+
+// loadTEBaseline reads the TE csv of a run; nil when the run has none
+// (older runs)
+func loadTEBaseline(dir string) (map[teKey]TETunnel, error) {
+	rows, _, err := latestRunCSV(dir, teBaselinePrefix, 8)
+	if rows == nil || err != nil {
+		return nil, err
+	}
+
+	tunnels := make(map[teKey]TETunnel)
+	for _, rec := range rows {
+		tunnels[teKey{rec[0], rec[1], rec[2]}] = TETunnel{Type: rec[1], Name: rec[2], Destination: rec[3],
+			Admin: rec[4], Oper: rec[5], Bandwidth: rec[6], Path: rec[7]}
+	}
+	return tunnels, nil
+}
+
+// compareTE returns the tunnel findings between two runs
+func compareTE(pre, post map[teKey]TETunnel) []PhaseDelta {
+	collected := make(map[string]bool)
+	for k := range post {
+		collected[k.Host] = true
+	}
+	var keys []teKey
+	for k := range pre {
+		if collected[k.Host] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Host != keys[j].Host {
+			return keys[i].Host < keys[j].Host
+		}
+		return keys[i].Type+keys[i].Name < keys[j].Type+keys[j].Name
+	})
+
+	var deltas []PhaseDelta
+	add := func(k teKey, pre, post, status, reason string) {
+		deltas = append(deltas, PhaseDelta{
+			goldenKey: goldenKey{Host: k.Host, Command: teCommand, Metric: k.Type + " " + k.Name},
+			Pre:       pre, Post: post, Status: status, Reason: reason,
+		})
+	}
+	for _, k := range keys {
+		before := pre[k]
+		after, ok := post[k]
+		switch {
+		case !ok:
+			if before.up() {
+				add(k, before.Oper, "", "FAIL", "tunnel was up before and is gone after")
+			}
+		case !after.up():
+			switch {
+			case before.up():
+				add(k, before.Oper, after.Oper, "FAIL", "tunnel was up before and did not re-signal")
+			case before.Admin != "down" || after.Admin != "down":
+				add(k, before.Oper, after.Oper, "FAIL", "tunnel stayed down")
+			}
+		default:
+			if before.up() && before.Path != "" && after.Path != before.Path {
+				add(k, before.Path, after.Path, "WARN", "tunnel re-signalled on another path than before")
+			}
+			if before.Bandwidth != after.Bandwidth {
+				add(k, before.Bandwidth+" kbps", after.Bandwidth+" kbps", "WARN", "tunnel bandwidth changed")
+			}
+		}
+	}
+	return deltas
+}
+
+// compareTERuns loads and compares the tunnel baselines of two runs;
+// nothing is compared when either run has none
+func compareTERuns(preDir, postDir string) []PhaseDelta {
+	pre, err1 := loadTEBaseline(preDir)
+	post, err2 := loadTEBaseline(postDir)
+	if runCheckSkipped("TE tunnel", teBaselinePrefix, err1, err2, pre != nil, post != nil) {
+		return nil
+	}
+	return compareTE(pre, post)
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// VALIDATION THRESHOLDS FILE (-thresholds)
+// ============================================================================
+//
+// The go/no-go limits were flags with built-in defaults, and "routes > 0"
+// for a critical VRF and the drain rate of a runbook were not settable at
+// all. The thresholds file (YAML, see yaml_subset.go) names them in one
+// place, so operations can tune them per change without a rebuild:
+//
+//   defaults:
+//     ping: 100                  # -ping-thresholds default percentage
+//     disk_min_mb: 2048          # -min-disk-free
+//     disk_min_pct: 10           # -disk-min-pct
+//     sr_tilfa_min: 100          # -sr-tilfa-min
+//     pair_skew: 90              # -pair-skew
+//     golden_tolerance: 10       # -golden-tolerance
+//     if_error_threshold: 0      # -if-error-threshold
+//     mtu_required: 9114         # -mtu-required
+//     critical_min_routes: 1     # routes a critical VRF needs on a hosting PE
+//     drain_rate: 100kbps        # wait steps without until/until_rate_below
+//     go_score: 90               # readiness score a GO needs (go_no_go.go)
+//   weights:                     # Go/No-Go weight per check
+//     ping: 3
+//   vrfs:                        # as -ping-thresholds VRF=PCT
+//     INTERNET:
+//       ping: 80
+//   vrf_priority:                # critical VRFs, 1 = first of -critical-vrfs
+//     1:
+//       ping: 100
+//       min_routes: 50
+//       weight: 4
+//     2:
+//       ping: 95
+//   roles:                       # hostname, Device_Type, Role or OS; X* prefix
+//     ASR92*:
+//       ping: 90
+//       disk_min_mb: 1024
+//       disk_min_pct: 5
+//     P-CORE:
+//       weight: 3
+//       blocking: true           # any failure of the device is NO-GO
+//
+// A flag given on the command line wins over the file (a -ping-thresholds
+// flag over all of defaults.ping and vrfs). A ping test needs the
+// threshold of its target or VRF (flag or vrfs), else of its VRF's
+// priority, else of its device's role, else the default. The first role
+// entry that matches a device applies; disk limits of a role replace the
+// flags for its devices.
+
+// thresholdFlags maps the defaults keys to the flags they set
+var thresholdFlags = map[string]string{
+	"disk_min_mb":        "min-disk-free",
+	"disk_min_pct":       "disk-min-pct",
+	"sr_tilfa_min":       "sr-tilfa-min",
+	"pair_skew":          "pair-skew",
+	"golden_tolerance":   "golden-tolerance",
+	"if_error_threshold": "if-error-threshold",
+	"mtu_required":       "mtu-required",
+}
+
+// roleThresholds are the limits of the devices a role entry matches; -1 =
+// not set
+type roleThresholds struct {
+	match      []string
+	ping       int
+	diskMinMB  int64
+	diskMinPct float64
+	weight     float64
+	blocking   bool
+}
+
+// priorityThresholds are the limits of a critical VRF priority; -1 = not set
+type priorityThresholds struct {
+	ping      int
+	minRoutes int
+	weight    float64
+}
+
+// thresholdSet is the loaded -thresholds file; nil-safe
+type thresholdSet struct {
+	Source     string
+	MinRoutes  int        // critical_min_routes
+	Drain      *rateLimit // drain_rate, nil = none
+	GoScore    float64    // go_score
+	ping       int        // defaults.ping, -1 = not set
+	flags      map[string]string
+	vrfPing    map[string]int
+	priorities map[int]priorityThresholds
+	weights    map[string]float64 // check -> Go/No-Go weight
+	roles      []roleThresholds
+}
+
+// loadThresholds reads and validates the thresholds file
+func loadThresholds(path string) (*thresholdSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseYAML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	top, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: expected defaults, vrfs, vrf_priority and roles", path)
+	}
+	t := &thresholdSet{Source: path, MinRoutes: 1, GoScore: goDefaultScore, ping: -1, vrfPing: make(map[string]int),
+		priorities: make(map[int]priorityThresholds), weights: make(map[string]float64), flags: make(map[string]string)}
+	fail := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+	}
+	section := func(key string) (map[string]interface{}, error) {
+		switch v := top[key].(type) {
+		case nil:
+			return nil, nil
+		case map[string]interface{}:
+			return v, nil
+		}
+		return nil, fail("%s: expected a map", key)
+	}
+	// number reads a non-negative number of a map; -1 when absent
+	number := func(m map[string]interface{}, where, key string) (float64, error) {
+		s, err := yamlString(m, key)
+		if err != nil {
+			return 0, fail("%s: %v", where, err)
+		}
+		if s == "" {
+			return -1, nil
+		}
+		v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || v < 0 {
+			return 0, fail("%s: %s %q is not a number", where, key, s)
+		}
+		return v, nil
+	}
+	pingPct := func(m map[string]interface{}, where string) (int, error) {
+		v, err := number(m, where, "ping")
+		if err == nil && v > 100 {
+			err = fail("%s: ping %g is above 100", where, v)
+		}
+		return int(v), err
+	}
+	for key := range top {
+		switch key {
+		case "defaults", "weights", "vrfs", "vrf_priority", "roles":
+		default:
+			return nil, fail("unknown section %q", key)
+		}
+	}
+
+	defaults, err := section("defaults")
+	if err != nil {
+		return nil, err
+	}
+	for key := range defaults {
+		switch key {
+		case "ping":
+			if t.ping, err = pingPct(defaults, "defaults"); err != nil {
+				return nil, err
+			}
+		case "critical_min_routes":
+			v, err := number(defaults, "defaults", key)
+			if err != nil {
+				return nil, err
+			}
+			t.MinRoutes = int(v)
+		case "go_score":
+			if t.GoScore, err = number(defaults, "defaults", key); err != nil {
+				return nil, err
+			}
+			if t.GoScore > 100 {
+				return nil, fail("defaults: go_score %g is above 100", t.GoScore)
+			}
+		case "drain_rate":
+			s, _ := yamlString(defaults, key)
+			if t.Drain, err = parseRateLimit(s); err != nil {
+				return nil, fail("defaults: drain_rate: %v", err)
+			}
+		default:
+			if thresholdFlags[key] == "" {
+				return nil, fail("defaults: unknown threshold %q", key)
+			}
+			if _, err := number(defaults, "defaults", key); err != nil {
+				return nil, err
+			}
+			t.flags[key], _ = yamlString(defaults, key)
+		}
+	}
+
+	weights, err := section("weights")
+	if err != nil {
+		return nil, err
+	}
+	for check := range weights {
+		if t.weights[check], err = number(weights, "weights", check); err != nil {
+			return nil, err
+		}
+	}
+
+	vrfs, err := section("vrfs")
+	if err != nil {
+		return nil, err
+	}
+	for name, v := range vrfs {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fail("vrfs: %s: expected a map with ping", name)
+		}
+		pct, err := pingPct(m, "vrfs: "+name)
+		if err != nil {
+			return nil, err
+		}
+		if pct >= 0 {
+			t.vrfPing[strings.ToUpper(name)] = pct
+		}
+	}
+
+	priorities, err := section("vrf_priority")
+	if err != nil {
+		return nil, err
+	}
+	for key, v := range priorities {
+		prio, err := strconv.Atoi(key)
+		m, ok := v.(map[string]interface{})
+		if err != nil || prio < 1 || !ok {
+			return nil, fail("vrf_priority: %q: expected a priority 1, 2, ... with ping, min_routes and weight", key)
+		}
+		where := "vrf_priority: " + key
+		pct, err := pingPct(m, where)
+		if err != nil {
+			return nil, err
+		}
+		routes, err := number(m, where, "min_routes")
+		if err != nil {
+			return nil, err
+		}
+		weight, err := number(m, where, "weight")
+		if err != nil {
+			return nil, err
+		}
+		t.priorities[prio] = priorityThresholds{ping: pct, minRoutes: int(routes), weight: weight}
+	}
+
+	roles, err := section("roles")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range roles {
+		names = append(names, name)
+	}
+	// Exact names before prefixes, longer prefixes first, as for -role-workers
+	sort.Slice(names, func(i, j int) bool {
+		pi, pj := strings.HasSuffix(names[i], "*"), strings.HasSuffix(names[j], "*")
+		if pi != pj {
+			return !pi
+		}
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		m, ok := roles[name].(map[string]interface{})
+		if !ok {
+			return nil, fail("roles: %s: expected a map with ping, disk_min_mb, disk_min_pct, weight and blocking", name)
+		}
+		where := "roles: " + name
+		r := roleThresholds{match: []string{strings.ToUpper(name)}}
+		if r.ping, err = pingPct(m, where); err != nil {
+			return nil, err
+		}
+		mb, err := number(m, where, "disk_min_mb")
+		if err != nil {
+			return nil, err
+		}
+		if r.diskMinPct, err = number(m, where, "disk_min_pct"); err != nil {
+			return nil, err
+		}
+		r.diskMinMB = int64(mb)
+		if r.weight, err = number(m, where, "weight"); err != nil {
+			return nil, err
+		}
+		if r.blocking, err = yamlBool(m, "blocking", false); err != nil {
+			return nil, fail("%s: %v", where, err)
+		}
+		for key := range m {
+			switch key {
+			case "ping", "disk_min_mb", "disk_min_pct", "weight", "blocking":
+			default:
+				return nil, fail("%s: unknown threshold %q", where, key)
+			}
+		}
+		t.roles = append(t.roles, r)
+	}
+	return t, nil
+}
+
+// applyFlags sets the flags of the defaults section that were not given on
+// the command line; called before the flags are used
+func (t *thresholdSet) applyFlags() error {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for key, name := range thresholdFlags {
+		v, ok := t.flags[key]
+		if !ok || given[name] {
+			continue
+		}
+		if err := flag.Set(name, v); err != nil {
+			return fmt.Errorf("%s: defaults: %s: %v", t.Source, key, err)
+		}
+	}
+	if given["ping-thresholds"] {
+		return nil
+	}
+	var spec []string
+	if t.ping >= 0 {
+		spec = append(spec, strconv.Itoa(t.ping))
+	}
+	var vrfs []string
+	for vrf := range t.vrfPing {
+		vrfs = append(vrfs, vrf)
+	}
+	sort.Strings(vrfs)
+	for _, vrf := range vrfs {
+		spec = append(spec, fmt.Sprintf("%s=%d", vrf, t.vrfPing[vrf]))
+	}
+	if len(spec) == 0 {
+		return nil
+	}
+	return flag.Set("ping-thresholds", strings.Join(spec, ","))
+}
+
+// role is the role entry of a device, nil when none matches
+func (t *thresholdSet) role(d DeviceInfo) *roleThresholds {
+	if t == nil {
+		return nil
+	}
+	for i := range t.roles {
+		if deviceMatches(t.roles[i].match, d) {
+			return &t.roles[i]
+		}
+	}
+	return nil
+}
+
+// disk returns the disk limits of a device: its role's, else the flags'
+func (t *thresholdSet) disk(d DeviceInfo, minMB int64, minPct float64) (int64, float64) {
+	if r := t.role(d); r != nil {
+		if r.diskMinMB >= 0 {
+			minMB = r.diskMinMB
+		}
+		if r.diskMinPct >= 0 {
+			minPct = r.diskMinPct
+		}
+	}
+	return minMB, minPct
+}
+
+// minRoutes is the number of routes a critical VRF of this priority needs
+func (t *thresholdSet) minRoutes(priority int) int {
+	if t == nil {
+		return 1
+	}
+	if p, ok := t.priorities[priority]; ok && p.minRoutes >= 0 {
+		return p.minRoutes
+	}
+	return t.MinRoutes
+}
+
+// rolePing is the ping threshold of a device's role
+func (t *thresholdSet) rolePing(host string) (int, bool) {
+	d, ok := inventoryEntry(host)
+	if !ok {
+		d = DeviceInfo{Hostname: host}
+	}
+	if r := t.role(d); r != nil && r.ping >= 0 {
+		return r.ping, true
+	}
+	return 0, false
+}
+
+// rankPings adds the priority and role limits to the ping thresholds;
+// vrfs are the critical VRFs, highest priority first
+func (t *thresholdSet) rankPings(p *pingThresholds, vrfs string) {
+	if t == nil || p == nil {
+		return
+	}
+	prio := 0
+	for _, vrf := range strings.Split(vrfs, ",") {
+		if vrf = strings.ToUpper(strings.TrimSpace(vrf)); vrf == "" {
+			continue
+		}
+		prio++
+		if limit, ok := t.priorities[prio]; ok && limit.ping >= 0 {
+			p.byPriority[vrf] = limit.ping
+		}
+	}
+	if len(t.roles) > 0 {
+		p.byRole = t.rolePing
+	}
+}
+
+// logSummary prints the limits in effect
+func (t *thresholdSet) logSummary(config *Config) {
+	log.Printf("✓ Thresholds from %s: ping %s, disk %d MB / %g%%, critical VRF routes %d, %d priority and %d role override(s)",
+		t.Source, config.Ping.spec, config.MinDiskFreeMB, config.DiskMinPct, t.MinRoutes, len(t.priorities), len(t.roles))
+}
@@ -0,0 +1,660 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// TOPOLOGY GRAPH (TOPOLOGY_<ts>.csv/.dot/.html)
+// ============================================================================
+//
+// The SUMMARY counts adjacencies per device; after a re-cabling nobody can
+// tell from it which link moved. Every run therefore also writes the
+// adjacencies it saw, one row per device, protocol, interface and neighbor:
+//
+//   ISIS        show isis neighbors / show isis adjacency
+//   OSPF        show [ip] ospf neighbor
+//   CDP, LLDP   show cdp neighbors detail, show lldp neighbors detail
+//
+// Neighbors are resolved to the devices of the run by hostname (without
+// domain), by the router IDs in the IS-IS database and BGP summaries, and
+// by interface and management addresses; the rest are drawn as external
+// nodes under the name or router ID the device shows. The run is drawn as
+//
+//   TOPOLOGY_<ts>.dot   GraphViz (dot -Tsvg TOPOLOGY_<ts>.dot > topo.svg)
+//   TOPOLOGY_<ts>.html  self-contained interactive view: drag the nodes,
+//                       click one for its adjacencies
+//
+// No D3 or vis.js: the jump hosts have no internet access, so the page
+// carries its own small force layout. comparePhases compares the
+// adjacencies of the devices collected in both runs:
+//
+//   FAIL  an adjacency that was up before is down or gone after
+//   WARN  an adjacency that is up after was not up before (a link moved)
+//
+// and writes TOPOLOGY_COMPARISON.dot/.html beside the comparison report,
+// the two runs in one graph with the changed devices and links
+// highlighted. Keep the neighbor commands in the command files.
+
+const (
+	topologyCommand  = "topology"
+	topologyPrefix   = "TOPOLOGY_"
+	topologyCols     = "Hostname,Protocol,Interface,Neighbor,Neighbor_Interface,State"
+	topologyCompared = "TOPOLOGY_COMPARISON"
+)
+
+var (
+	discoveryNameRe  = regexp.MustCompile(`^\s*(?:Device ID|System Name):\s*(\S+)`)
+	discoveryLocalRe = regexp.MustCompile(`^\s*(?:Interface:\s*([^,\s]+)|Local Int(?:erface|f):\s*(\S+))`)
+	discoveryPortRe  = regexp.MustCompile(`(?i)^\s*(?:.*Port ID \(outgoing port\)|Port id):\s*(\S+)`)
+	discoveryAddrRe  = regexp.MustCompile(`^\s*(?:IPv4 address|IP address|IP):\s*(\d+\.\d+\.\d+\.\d+)`)
+)
+
+// TopologyAdjacency is one neighbor a device sees over one interface
+type TopologyAdjacency struct {
+	Hostname  string
+	Protocol  string // ISIS, OSPF, CDP, LLDP
+	Interface string
+	Neighbor  string // run hostname when resolved, else as the device shows it
+	Remote    string // neighbor's interface (CDP, LLDP)
+	State     string
+}
+
+// Up reports whether the adjacency is formed; CDP and LLDP list only
+// neighbors they hear
+func (a TopologyAdjacency) Up() bool {
+	switch a.Protocol {
+	case "OSPF":
+		return strings.HasPrefix(strings.ToUpper(a.State), "FULL")
+	case "ISIS":
+		return strings.EqualFold(a.State, "up")
+	}
+	return true
+}
+
+// topologyKey identifies an adjacency across runs
+type topologyKey struct {
+	Host, Protocol, Interface, Neighbor string
+}
+
+func (a TopologyAdjacency) key() topologyKey {
+	return topologyKey{strings.ToUpper(a.Hostname), a.Protocol, a.Interface, strings.ToUpper(a.Neighbor)}
+}
+
+// discoveryNeighbor is one entry of "show cdp/lldp neighbors detail"
+type discoveryNeighbor struct {
+	Name, Local, Port, Address string
+}
+
+// parseDiscoveryNeighbors reads the detail entries of CDP and LLDP on XR
+// and XE; entries are separated by lines of dashes:
+//
+//	Device ID: UPE2.lab.local                        (CDP)
+//	  IPv4 address: 10.255.0.2
+//	Interface: TenGigE0/0/0/0, Port ID (outgoing port): TenGigE0/0/0/0
+//
+//	Local Interface: TenGigE0/0/0/0                  (LLDP; XE: Local Intf)
+//	Port id: Te0/0/0/0
+//	System Name: UPE2
+//	    IPv4 address: 10.255.0.2                     (XE: IP: 10.255.0.2)
+func parseDiscoveryNeighbors(output string) []discoveryNeighbor {
+	var list []discoveryNeighbor
+	var cur discoveryNeighbor
+	flush := func() {
+		if cur.Name != "" && cur.Local != "" {
+			list = append(list, cur)
+		}
+		cur = discoveryNeighbor{}
+	}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if t := strings.TrimSpace(line); len(t) >= 10 && strings.Trim(t, "-") == "" {
+			flush()
+			continue
+		}
+		if m := discoveryNameRe.FindStringSubmatch(line); m != nil {
+			cur.Name = m[1]
+		}
+		if m := discoveryLocalRe.FindStringSubmatch(line); m != nil {
+			cur.Local = strings.TrimSpace(m[1] + m[2])
+		}
+		if m := discoveryPortRe.FindStringSubmatch(line); m != nil {
+			cur.Port = m[1]
+		}
+		if m := discoveryAddrRe.FindStringSubmatch(line); m != nil && cur.Address == "" {
+			cur.Address = m[1]
+		}
+	}
+	flush()
+	return list
+}
+
+// shortDeviceName drops the domain and the serial number a CDP device ID
+// may carry (SW1.lab.local, N9K(FDO1234))
+func shortDeviceName(name string) string {
+	if i := strings.Index(name, "("); i > 0 {
+		name = name[:i]
+	}
+	if isIPAddress(name) {
+		return name
+	}
+	if i := strings.Index(name, "."); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// topologyResolver maps names and addresses seen by the devices to the
+// hostnames of the run
+type topologyResolver map[string]string
+
+func (t topologyResolver) add(id, host string) {
+	if id = strings.ToUpper(strings.TrimSpace(id)); id != "" {
+		if _, ok := t[id]; !ok {
+			t[id] = host
+		}
+	}
+}
+
+// resolve returns the run hostname of a neighbor, or the neighbor as seen
+func (t topologyResolver) resolve(ids ...string) string {
+	for _, id := range ids {
+		if host, ok := t[strings.ToUpper(id)]; ok {
+			return host
+		}
+		if host, ok := t[strings.ToUpper(shortDeviceName(id))]; ok {
+			return host
+		}
+	}
+	for _, id := range ids {
+		if id != "" {
+			return shortDeviceName(id)
+		}
+	}
+	return "?"
+}
+
+// newTopologyResolver collects the hostnames, addresses and router IDs of
+// the devices of the run, reachable or not, so a neighbor keeps its name
+// when it fails in one run
+func newTopologyResolver(results []*DeviceResult) topologyResolver {
+	t := make(topologyResolver)
+	hosts := make(map[string]string)
+	for _, r := range results {
+		hosts[strings.ToUpper(r.Device.Hostname)] = r.Device.Hostname
+		t.add(r.Device.Hostname, r.Device.Hostname)
+		t.add(r.Device.Alias, r.Device.Hostname)
+		t.add(r.Device.IPAddress, r.Device.Hostname)
+	}
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		for _, e := range r.Results {
+			cmd := strings.ToLower(e.Command)
+			switch {
+			case isShowInterfacesDetail(cmd):
+				for _, i := range parseShowInterfaces(e.Output) {
+					address, _, _ := strings.Cut(i.IPAddress, "/")
+					t.add(address, r.Device.Hostname)
+				}
+			case metricCategory(cmd) == "bgp":
+				t.add(parseBGPSummary(e.Output).RouterID, r.Device.Hostname)
+			case strings.Contains(cmd, "isis database"):
+				// every node's LSP names its router ID, in the run or not
+				for name, n := range parseISISDatabase(e.Output) {
+					host, ok := hosts[strings.ToUpper(name)]
+					if !ok {
+						host = name
+					}
+					t.add(n.RouterID, host)
+				}
+			}
+		}
+	}
+	return t
+}
+
+// buildTopology returns the adjacencies of the collected devices
+func buildTopology(results []*DeviceResult) []TopologyAdjacency {
+	resolver := newTopologyResolver(results)
+	var adj []TopologyAdjacency
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		host := r.Device.Hostname
+		seen := make(map[topologyKey]bool)
+		add := func(a TopologyAdjacency) {
+			// SR's "adjacency detail" repeats the IS-IS neighbor table
+			if !seen[a.key()] {
+				seen[a.key()] = true
+				adj = append(adj, a)
+			}
+		}
+		for _, e := range r.Results {
+			cmd := strings.ToLower(e.Command)
+			if isCommandRejected(e.Output) {
+				continue
+			}
+			switch {
+			case metricCategory(cmd) == "isis":
+				for _, n := range parseISISNeighbors(e.Output).Neighbors {
+					add(TopologyAdjacency{Hostname: host, Protocol: "ISIS", Interface: n.Interface,
+						Neighbor: resolver.resolve(n.SystemID), State: n.State})
+				}
+			case metricCategory(cmd) == "ospf":
+				for _, n := range parseOSPFNeighbors(e.Output).Neighbors {
+					add(TopologyAdjacency{Hostname: host, Protocol: "OSPF", Interface: n.Interface,
+						Neighbor: resolver.resolve(n.NeighborID, n.Address), State: strings.TrimSuffix(strings.Fields(n.State)[0], "/")})
+				}
+			case strings.Contains(cmd, "cdp neighbors") || strings.Contains(cmd, "lldp neighbors"):
+				protocol := "CDP"
+				if strings.Contains(cmd, "lldp") {
+					protocol = "LLDP"
+				}
+				for _, n := range parseDiscoveryNeighbors(e.Output) {
+					add(TopologyAdjacency{Hostname: host, Protocol: protocol, Interface: n.Local,
+						Neighbor: resolver.resolve(n.Name, n.Address), Remote: n.Port, State: "Up"})
+				}
+			}
+		}
+	}
+	sortTopology(adj)
+	return adj
+}
+
+func sortTopology(adj []TopologyAdjacency) {
+	sort.SliceStable(adj, func(i, j int) bool {
+		a, b := adj[i].key(), adj[j].key()
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		if a.Interface != b.Interface {
+			return a.Interface < b.Interface
+		}
+		return a.Neighbor < b.Neighbor
+	})
+}
+
+// WriteTopology writes TOPOLOGY_<ts>.csv and its DOT and HTML views
+func (w *OutputWriter) WriteTopology(results []*DeviceResult) error {
+	adj := buildTopology(results)
+	base := filepath.Join(w.dir, fmt.Sprintf("%s%s", topologyPrefix, w.timestamp))
+	rows := [][]string{strings.Split(topologyCols, ",")}
+	var hosts []string
+	for _, r := range results {
+		if r.Success {
+			hosts = append(hosts, r.Device.Hostname)
+		}
+	}
+	for _, a := range adj {
+		rows = append(rows, []string{a.Hostname, a.Protocol, a.Interface, a.Neighbor, a.Remote, a.State})
+	}
+	if err := writeCSVRows(base+".csv", rows); err != nil {
+		return err
+	}
+	g := newTopologyGraph(fmt.Sprintf("%s run %s", w.phase, w.timestamp), hosts, nil, adj, nil)
+	return g.writeFiles(base)
+}
+
+// loadTopology reads the TOPOLOGY csv of a run; nil when the run has none
+// (older runs)
+func loadTopology(dir string) ([]TopologyAdjacency, error) {
+	rows, _, err := latestRunCSV(dir, topologyPrefix, 6)
+	if rows == nil || err != nil {
+		return nil, err
+	}
+	adj := []TopologyAdjacency{}
+	for _, rec := range rows {
+		adj = append(adj, TopologyAdjacency{Hostname: rec[0], Protocol: rec[1], Interface: rec[2],
+			Neighbor: rec[3], Remote: rec[4], State: rec[5]})
+	}
+	return adj, nil
+}
+
+// topologyChanges returns the adjacencies of the collected devices that
+// were up before and not after (lost), and the reverse (added)
+func topologyChanges(pre, post []TopologyAdjacency, collected map[string]bool) (lost, added []TopologyAdjacency) {
+	upBefore, after := make(map[topologyKey]bool), make(map[topologyKey]TopologyAdjacency)
+	for _, a := range pre {
+		if a.Up() {
+			upBefore[a.key()] = true
+		}
+	}
+	for _, a := range post {
+		after[a.key()] = a
+	}
+	for _, a := range pre {
+		if !a.Up() || !collected[strings.ToUpper(a.Hostname)] {
+			continue
+		}
+		if now, ok := after[a.key()]; !ok || !now.Up() {
+			lost = append(lost, a)
+		}
+	}
+	for _, a := range post {
+		if a.Up() && !upBefore[a.key()] {
+			added = append(added, a)
+		}
+	}
+	return lost, added
+}
+
+// describe is an adjacency in words, for reasons and notes
+func (a TopologyAdjacency) describe() string {
+	s := fmt.Sprintf("%s %s on %s", a.Protocol, a.Neighbor, a.Interface)
+	if a.Remote != "" {
+		s += " (its " + a.Remote + ")"
+	}
+	return s
+}
+
+// compareTopologyRuns compares the adjacencies of two runs for the devices
+// collected after, and draws both runs into outDir; nothing is compared
+// when either run has no topology
+func compareTopologyRuns(preDir, postDir, outDir string, collected map[string]bool) []PhaseDelta {
+	pre, err1 := loadTopology(preDir)
+	post, err2 := loadTopology(postDir)
+	if runCheckSkipped("Topology", topologyPrefix, err1, err2, pre != nil, post != nil) {
+		return nil
+	}
+	lost, added := topologyChanges(pre, post, collected)
+	var deltas []PhaseDelta
+	for _, a := range lost {
+		state := ""
+		for _, p := range post {
+			if p.key() == a.key() {
+				state = p.State
+			}
+		}
+		deltas = append(deltas, PhaseDelta{
+			goldenKey: goldenKey{Host: a.Hostname, Command: topologyCommand, Metric: a.Protocol + " " + a.Neighbor + " " + a.Interface},
+			Pre:       a.State, Post: state, Status: "FAIL", Reason: "adjacency lost: " + a.describe(),
+		})
+	}
+	for _, a := range added {
+		deltas = append(deltas, PhaseDelta{
+			goldenKey: goldenKey{Host: a.Hostname, Command: topologyCommand, Metric: a.Protocol + " " + a.Neighbor + " " + a.Interface},
+			Post:      a.State, Status: "WARN", Reason: "new adjacency: " + a.describe(),
+		})
+	}
+
+	g := newTopologyGraph("pre/post comparison", nil, pre, post, collected)
+	if err := g.writeFiles(filepath.Join(outDir, topologyCompared)); err != nil {
+		log.Printf("⚠ Topology comparison: %v", err)
+	}
+	return deltas
+}
+
+// ----------------------------------------------------------------------------
+// Graph views
+// ----------------------------------------------------------------------------
+
+// topologyNode is a device of the run or a neighbor outside it
+type topologyNode struct {
+	Name    string   `json:"name"`
+	Device  bool     `json:"device"`
+	Changed bool     `json:"changed"`
+	Notes   []string `json:"notes"`
+}
+
+// topologyLink joins two nodes over all their adjacencies; Status is ""
+// (up), down (none up), lost, new or changed (some lost or new)
+type topologyLink struct {
+	A      string   `json:"a"`
+	B      string   `json:"b"`
+	Labels []string `json:"labels"`
+	Status string   `json:"status"`
+}
+
+type topologyGraph struct {
+	Title string         `json:"title"`
+	Nodes []topologyNode `json:"nodes"`
+	Links []topologyLink `json:"links"`
+}
+
+// newTopologyGraph draws the post adjacencies, and with pre given the
+// changes since pre for the collected devices
+func newTopologyGraph(title string, hosts []string, pre, post []TopologyAdjacency, collected map[string]bool) topologyGraph {
+	g := topologyGraph{Title: title}
+	nodes := make(map[string]*topologyNode)
+	node := func(name string) *topologyNode {
+		key := strings.ToUpper(name)
+		if nodes[key] == nil {
+			nodes[key] = &topologyNode{Name: name}
+		}
+		return nodes[key]
+	}
+	for _, h := range hosts {
+		node(h).Device = true
+	}
+
+	type linkState struct {
+		labels           map[string]bool
+		up, lost, gained int
+	}
+	links := make(map[[2]string]*linkState)
+	link := func(a TopologyAdjacency) *linkState {
+		p := [2]string{strings.ToUpper(a.Hostname), strings.ToUpper(a.Neighbor)}
+		if p[0] > p[1] {
+			p[0], p[1] = p[1], p[0]
+		}
+		if links[p] == nil {
+			links[p] = &linkState{labels: make(map[string]bool)}
+		}
+		node(a.Hostname).Device = true
+		node(a.Neighbor)
+		return links[p]
+	}
+	for _, a := range post {
+		l := link(a)
+		label := a.Hostname + " " + a.Interface + " " + a.Protocol
+		if !a.Up() {
+			label += " " + a.State
+		} else {
+			l.up++
+		}
+		l.labels[label] = true
+	}
+	if pre != nil {
+		lost, added := topologyChanges(pre, post, collected)
+		for _, a := range lost {
+			l := link(a)
+			l.lost++
+			l.labels[a.Hostname+" "+a.Interface+" "+a.Protocol+" lost"] = true
+			node(a.Hostname).Changed = true
+			node(a.Hostname).Notes = append(node(a.Hostname).Notes, "lost "+a.describe())
+		}
+		for _, a := range added {
+			l := link(a)
+			l.gained++
+			node(a.Hostname).Changed = true
+			node(a.Hostname).Notes = append(node(a.Hostname).Notes, "new "+a.describe())
+		}
+	}
+	for _, a := range post {
+		if !a.Up() {
+			n := node(a.Hostname)
+			n.Notes = append(n.Notes, fmt.Sprintf("%s is %s", a.describe(), a.State))
+		}
+	}
+
+	for _, n := range nodes {
+		g.Nodes = append(g.Nodes, *n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return strings.ToUpper(g.Nodes[i].Name) < strings.ToUpper(g.Nodes[j].Name) })
+	for p, l := range links {
+		tl := topologyLink{A: nodes[p[0]].Name, B: nodes[p[1]].Name}
+		for label := range l.labels {
+			tl.Labels = append(tl.Labels, label)
+		}
+		sort.Strings(tl.Labels)
+		switch {
+		case l.up == l.gained && l.gained > 0 && l.lost == 0:
+			tl.Status = "new"
+		case l.up == 0 && l.lost > 0:
+			tl.Status = "lost"
+		case l.lost > 0 || l.gained > 0:
+			tl.Status = "changed"
+		case l.up == 0:
+			tl.Status = "down"
+		}
+		g.Links = append(g.Links, tl)
+	}
+	sort.Slice(g.Links, func(i, j int) bool {
+		if g.Links[i].A != g.Links[j].A {
+			return g.Links[i].A < g.Links[j].A
+		}
+		return g.Links[i].B < g.Links[j].B
+	})
+	return g
+}
+
+// topologyLinkColors are the DOT and HTML colors of the link states
+var topologyLinkColors = map[string]string{"": "#2a7", "down": "#999", "lost": "#d33", "new": "#36c", "changed": "#e90"}
+
+// writeFiles writes base.dot and base.html
+func (g topologyGraph) writeFiles(base string) error {
+	for _, f := range []struct {
+		ext   string
+		write func(io.Writer) error
+	}{{".dot", g.writeDOT}, {".html", g.writeHTML}} {
+		file, err := createAtomic(base + f.ext)
+		if err != nil {
+			return err
+		}
+		err = f.write(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// writeDOT writes the graph for GraphViz
+func (g topologyGraph) writeDOT(out io.Writer) error {
+	fmt.Fprintf(out, "// MERALCO topology, %s\ngraph topology {\n", g.Title)
+	fmt.Fprintf(out, "  graph [overlap=false, splines=true, fontname=\"Helvetica\"];\n")
+	fmt.Fprintf(out, "  node [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\", fillcolor=\"#e8f0fe\"];\n")
+	fmt.Fprintf(out, "  edge [fontname=\"Helvetica\", fontsize=9];\n")
+	for _, n := range g.Nodes {
+		attrs := ""
+		switch {
+		case n.Changed:
+			attrs = `, fillcolor="#fde2c4", color="#e90", penwidth=2`
+		case !n.Device:
+			attrs = `, style="rounded,dashed", fillcolor="white"`
+		}
+		fmt.Fprintf(out, "  %s [label=%s%s];\n", dotQuote(n.Name), dotQuote(n.Name), attrs)
+	}
+	for _, l := range g.Links {
+		style := ""
+		if l.Status == "lost" || l.Status == "down" {
+			style = `, style="dashed"`
+		}
+		fmt.Fprintf(out, "  %s -- %s [label=%s, color=%s%s];\n", dotQuote(l.A), dotQuote(l.B),
+			dotQuote(strings.Join(l.Labels, "\n")), dotQuote(topologyLinkColors[l.Status]), style)
+	}
+	_, err := fmt.Fprintf(out, "}\n")
+	return err
+}
+
+// writeHTML writes the interactive view; the graph is embedded as JSON
+// (json escapes < and >, so it cannot end the script)
+func (g topologyGraph) writeHTML(out io.Writer) error {
+	data, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	colors, _ := json.Marshal(topologyLinkColors)
+	fmt.Fprintf(out, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>MERALCO Topology</title>\n")
+	fmt.Fprintf(out, "<style>body{font-family:sans-serif;font-size:13px} svg{background:#fafafa;border:1px solid #ccc}"+
+		" text{font-size:11px;pointer-events:none} g.n{cursor:move} #info{white-space:pre;font-family:monospace}</style></head><body>\n")
+	fmt.Fprintf(out, "<h1>MERALCO Topology, %s</h1>\n", html.EscapeString(g.Title))
+	fmt.Fprintf(out, "<p>Generated %s. Links: <b style=\"color:#2a7\">up</b>, <b style=\"color:#999\">down</b>,"+
+		" <b style=\"color:#d33\">lost</b>, <b style=\"color:#36c\">new</b>, <b style=\"color:#e90\">changed</b>;"+
+		" orange devices changed their adjacencies, dashed nodes are not in the run. Drag the nodes, click one for details.</p>\n",
+		time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(out, "<svg id=\"g\" width=\"1100\" height=\"700\"></svg>\n<div id=\"info\"></div>\n")
+	fmt.Fprintf(out, "<script>\nconst G = %s, C = %s;\n%s</script>\n", data, colors, topologyScript)
+
+	var changed []topologyNode
+	for _, n := range g.Nodes {
+		if len(n.Notes) > 0 {
+			changed = append(changed, n)
+		}
+	}
+	if len(changed) > 0 {
+		fmt.Fprintf(out, "<h2>Devices with changed or down adjacencies</h2>\n<ul>\n")
+		for _, n := range changed {
+			fmt.Fprintf(out, "<li><b>%s</b><ul>\n", html.EscapeString(n.Name))
+			for _, note := range n.Notes {
+				fmt.Fprintf(out, "<li>%s</li>\n", html.EscapeString(note))
+			}
+			fmt.Fprintf(out, "</ul></li>\n")
+		}
+		fmt.Fprintf(out, "</ul>\n")
+	}
+	_, err = fmt.Fprintf(out, "</body></html>\n")
+	return err
+}
+
+// topologyScript lays the graph out with a spring model and draws it
+const topologyScript = `const svg = document.getElementById("g"), W = 1100, H = 700, NS = "http://www.w3.org/2000/svg";
+const idx = {};
+G.nodes.forEach((n, i) => { idx[n.name] = i; n.x = W / 2 + 250 * Math.cos(2 * Math.PI * i / G.nodes.length); n.y = H / 2 + 250 * Math.sin(2 * Math.PI * i / G.nodes.length); });
+const k = Math.sqrt(W * H / Math.max(G.nodes.length, 1)) * 0.6;
+for (let it = 0, t = 60; it < 300; it++, t *= 0.985) {
+  G.nodes.forEach(n => { n.dx = (W / 2 - n.x) * 0.01; n.dy = (H / 2 - n.y) * 0.01; });
+  G.nodes.forEach((a, i) => G.nodes.forEach((b, j) => { if (i >= j) return;
+    let dx = a.x - b.x, dy = a.y - b.y, d = Math.max(Math.hypot(dx, dy), 1), f = k * k / d / d;
+    a.dx += dx * f; a.dy += dy * f; b.dx -= dx * f; b.dy -= dy * f; }));
+  G.links.forEach(l => { const a = G.nodes[idx[l.a]], b = G.nodes[idx[l.b]];
+    let dx = a.x - b.x, dy = a.y - b.y, d = Math.max(Math.hypot(dx, dy), 1), f = d / k;
+    a.dx -= dx * f; a.dy -= dy * f; b.dx += dx * f; b.dy += dy * f; });
+  G.nodes.forEach(n => { const d = Math.max(Math.hypot(n.dx, n.dy), 1), s = Math.min(d, t) / d;
+    n.x = Math.min(W - 60, Math.max(60, n.x + n.dx * s)); n.y = Math.min(H - 20, Math.max(20, n.y + n.dy * s)); });
+}
+function el(tag, attrs, parent) { const e = document.createElementNS(NS, tag); for (const a in attrs) e.setAttribute(a, attrs[a]); parent.appendChild(e); return e; }
+G.links.forEach(l => { l.line = el("line", {stroke: C[l.status], "stroke-width": l.status ? 3 : 2, "stroke-dasharray": l.status == "lost" || l.status == "down" ? "6,4" : ""}, svg);
+  el("title", {}, l.line).textContent = l.labels.join("\n"); });
+G.nodes.forEach(n => { n.g = el("g", {class: "n"}, svg);
+  const w = 12 + 7 * n.name.length;
+  el("rect", {x: -w / 2, y: -11, width: w, height: 22, rx: 6, fill: n.changed ? "#fde2c4" : n.device ? "#e8f0fe" : "#fff",
+    stroke: n.changed ? "#e90" : "#557", "stroke-width": n.changed ? 2 : 1, "stroke-dasharray": n.device ? "" : "4,3"}, n.g);
+  el("text", {"text-anchor": "middle", y: 4}, n.g).textContent = n.name;
+  n.g.addEventListener("mousedown", e => { drag = n; e.preventDefault(); });
+  n.g.addEventListener("click", () => show(n)); });
+function draw() {
+  G.links.forEach(l => { const a = G.nodes[idx[l.a]], b = G.nodes[idx[l.b]];
+    l.line.setAttribute("x1", a.x); l.line.setAttribute("y1", a.y); l.line.setAttribute("x2", b.x); l.line.setAttribute("y2", b.y); });
+  G.nodes.forEach(n => n.g.setAttribute("transform", "translate(" + n.x + "," + n.y + ")"));
+}
+function show(n) {
+  const lines = G.links.filter(l => l.a == n.name || l.b == n.name).map(l => "  " + (l.a == n.name ? l.b : l.a) + " [" + (l.status || "up") + "]: " + l.labels.join(", "));
+  G.links.forEach(l => l.line.setAttribute("opacity", l.a == n.name || l.b == n.name ? 1 : 0.2));
+  document.getElementById("info").textContent = n.name + "\n" + lines.join("\n") + (n.notes ? "\n" + n.notes.map(s => "  - " + s).join("\n") : "");
+}
+let drag = null;
+svg.addEventListener("mousemove", e => { if (!drag) return; const r = svg.getBoundingClientRect(); drag.x = e.clientX - r.left; drag.y = e.clientY - r.top; draw(); });
+window.addEventListener("mouseup", () => { drag = null; });
+draw();
+`
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ============================================================================
+// TRACEROUTE PATHS (PATHS_<ts>.csv) AND PRE/POST PATH CHECK
+// ============================================================================
+//
+// A service can stay reachable after a migration and still take another
+// way through the core. -trace-targets lists the paths to record, one per
+// line:
+//
+//   # HOST  VRF       DESTINATION  [mpls] [expect-change]
+//   UPE1    TELEPROT  10.20.0.1
+//   UPE1    default   10.255.0.21  mpls
+//   UPE9    SCADA     10.30.0.1    expect-change
+//
+// Each run adds the traceroutes to the commands of their source device:
+//
+//   traceroute [vrf V] A numeric timeout 1 probe 1   hop addresses and the
+//                                                    MPLS labels they show
+//   traceroute mpls ipv4 A/32                        LSP hops and label
+//                                                    stacks (global table)
+//
+// and writes PATHS_<ts>.csv with the hop list of every trace, a hop written
+// as ADDRESS or ADDRESS[LABEL/LABEL]. comparePhases then checks them path by
+// path:
+//
+//   FAIL  destination reached before, not after
+//   FAIL  hop sequence changed, and the path is not marked expect-change
+//   PASS  hop sequence changed as expected (expect-change)
+//   WARN  marked expect-change, but the hop sequence is the same
+//   WARN  same hops, other label stacks
+//
+// A hop that did not answer ("*") matches any hop. Hosts without traces in
+// the post run (not collected) are skipped.
+
+const (
+	traceCommand        = "traceroute"
+	traceBaselinePrefix = "PATHS_"
+	traceBaselineCols   = "Hostname,Type,VRF,Destination,Reached,Hops,Expect"
+	traceExpectChange   = "expect-change"
+)
+
+var (
+	traceCmdRe     = regexp.MustCompile(`^traceroute (?:(mpls) ipv4 (\S+)/32|(?:vrf (\S+) )?(\S+) numeric)`)
+	traceHopRe     = regexp.MustCompile(`^\s*(\d+)\s+(.*)$`)
+	traceMPLSHopRe = regexp.MustCompile(`^\s*([!LQ.DRIUXMPdBfF?lx])?\s*(\d+)\s+(\d{1,3}(?:\.\d{1,3}){3})\b(.*)$`)
+	traceAddrRe    = regexp.MustCompile(`\b(\d{1,3}(?:\.\d{1,3}){3})\b`)
+	traceLabelsRe  = regexp.MustCompile(`\[MPLS: Labels? ([\d/]+)`)
+	traceLSPLabels = regexp.MustCompile(`Labels: (\S+)`)
+)
+
+// TraceTarget is one path of -trace-targets
+type TraceTarget struct {
+	Host, VRF, Destination string
+	MPLS, ExpectChange     bool
+}
+
+// Type is "mpls" or "ip"
+func (t TraceTarget) Type() string {
+	if t.MPLS {
+		return "mpls"
+	}
+	return "ip"
+}
+
+// command is the traceroute sent for the target
+func (t TraceTarget) command() string {
+	switch {
+	case t.MPLS:
+		return fmt.Sprintf("traceroute mpls ipv4 %s/32", t.Destination)
+	case t.VRF == "default":
+		return fmt.Sprintf("traceroute %s numeric timeout 1 probe 1", t.Destination)
+	}
+	return fmt.Sprintf("traceroute vrf %s %s numeric timeout 1 probe 1", t.VRF, t.Destination)
+}
+
+// loadTraceTargets reads -trace-targets into the targets per host
+func loadTraceTargets(path string) (map[string][]TraceTarget, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	targets := make(map[string][]TraceTarget)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) < 3 || !apiVRFRe.MatchString(f[1]) || !isIPAddress(f[2]) {
+			return nil, fmt.Errorf("%s:%d: expected HOST VRF DESTINATION [mpls] [%s]", path, n, traceExpectChange)
+		}
+		t := TraceTarget{Host: f[0], VRF: f[1], Destination: f[2]}
+		for _, opt := range f[3:] {
+			switch opt {
+			case "mpls":
+				t.MPLS = true
+			case traceExpectChange:
+				t.ExpectChange = true
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown option %q (mpls, %s)", path, n, opt, traceExpectChange)
+			}
+		}
+		if t.MPLS && t.VRF != "default" {
+			return nil, fmt.Errorf("%s:%d: traceroute mpls runs in the default VRF only", path, n)
+		}
+		host := strings.ToUpper(t.Host)
+		targets[host] = append(targets[host], t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s: no targets", path)
+	}
+	return targets, nil
+}
+
+// traceCommands are the traceroutes of a device
+func traceCommands(targets map[string][]TraceTarget, d DeviceInfo) []string {
+	var cmds []string
+	for _, t := range targets[strings.ToUpper(d.Hostname)] {
+		cmds = append(cmds, t.command())
+	}
+	return cmds
+}
+
+// TracePath is the recorded path of one traceroute
+type TracePath struct {
+	Type, VRF, Destination string
+	Reached                bool
+	Hops                   []string // ADDRESS or ADDRESS[LABELS], "*" = no answer
+	Expect                 string   // expect-change or ""
+}
+
+// parseTracePaths reads the traceroutes of a device's results; expect
+// marks the paths -trace-targets expects to change
+func parseTracePaths(results []ExecutionResult, expect []TraceTarget) []TracePath {
+	var paths []TracePath
+	for _, e := range results {
+		m := traceCmdRe.FindStringSubmatch(e.Command)
+		if m == nil || isCommandRejected(e.Output) || isIncompleteOutput(e.Output) {
+			continue
+		}
+		p := TracePath{Type: "ip", VRF: m[3], Destination: m[4]}
+		if m[1] != "" {
+			p.Type, p.Destination = "mpls", m[2]
+		}
+		if p.VRF == "" {
+			p.VRF = "default"
+		}
+		for _, t := range expect {
+			if t.ExpectChange && t.Type() == p.Type && t.VRF == p.VRF && t.Destination == p.Destination {
+				p.Expect = traceExpectChange
+			}
+		}
+		if p.Type == "mpls" {
+			p.Hops, p.Reached = parseLSPHops(e.Output)
+		} else {
+			p.Hops = parseTraceHops(e.Output)
+			p.Reached = len(p.Hops) > 0 && hopAddress(p.Hops[len(p.Hops)-1]) == p.Destination
+		}
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// parseTraceHops reads the numbered hop lines of an IP traceroute
+func parseTraceHops(output string) []string {
+	var hops []string
+	for _, line := range strings.Split(output, "\n") {
+		m := traceHopRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		hop := "*"
+		if a := traceAddrRe.FindStringSubmatch(m[2]); a != nil {
+			hop = a[1]
+			if l := traceLabelsRe.FindStringSubmatch(m[2]); l != nil {
+				hop += "[" + l[1] + "]"
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// parseLSPHops reads the hops of traceroute mpls; reached when the egress
+// answered (return code "!")
+func parseLSPHops(output string) ([]string, bool) {
+	var hops []string
+	reached := false
+	for _, line := range strings.Split(output, "\n") {
+		m := traceMPLSHopRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		hop := m[3]
+		if l := traceLSPLabels.FindStringSubmatch(m[4]); l != nil {
+			hop += "[" + l[1] + "]"
+		}
+		hops = append(hops, hop)
+		if m[1] == "!" {
+			reached = true
+		}
+	}
+	return hops, reached
+}
+
+// WritePaths writes PATHS_<ts>.csv when the run has traceroutes
+func (w *OutputWriter) WritePaths(results []*DeviceResult, targets map[string][]TraceTarget) error {
+	rows := [][]string{strings.Split(traceBaselineCols, ",")}
+	for _, r := range results {
+		if !r.Success {
+			continue
+		}
+		for _, p := range parseTracePaths(r.Results, targets[strings.ToUpper(r.Device.Hostname)]) {
+			rows = append(rows, []string{r.Device.Hostname, p.Type, p.VRF, p.Destination, fmt.Sprint(p.Reached),
+				strings.Join(p.Hops, " "), p.Expect})
+		}
+	}
+	if len(rows) == 1 {
+		return nil
+	}
+	return writeCSVRows(filepath.Join(w.dir, fmt.Sprintf("%s%s.csv", traceBaselinePrefix, w.timestamp)), rows)
+}
+
+// traceKey identifies a path across runs
+type traceKey struct {
+	Host, Type, VRF, Destination string
+}
+
+// loadTraceBaseline reads the paths csv of a run; nil when the run has none
+func loadTraceBaseline(dir string) (map[traceKey]TracePath, error) {
+	rows, _, err := latestRunCSV(dir, traceBaselinePrefix, 7)
+	if rows == nil || err != nil {
+		return nil, err
+	}
+
+	paths := make(map[traceKey]TracePath)
+	for _, rec := range rows {
+		paths[traceKey{rec[0], rec[1], rec[2], rec[3]}] = TracePath{Type: rec[1], VRF: rec[2], Destination: rec[3],
+			Reached: rec[4] == "true", Hops: strings.Fields(rec[5]), Expect: rec[6]}
+	}
+	return paths, nil
+}
+
+// hopAddress strips the labels of a hop
+func hopAddress(hop string) string {
+	if i := strings.Index(hop, "["); i >= 0 {
+		return hop[:i]
+	}
+	return hop
+}
+
+// sameHops compares the hop addresses, "*" matching any hop
+func sameHops(a, b []string, labels bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, y := a[i], b[i]
+		if !labels {
+			x, y = hopAddress(x), hopAddress(y)
+		}
+		if x != y && x != "*" && y != "*" {
+			return false
+		}
+	}
+	return true
+}
+
+// compareTraces returns the path findings between two runs
+func compareTraces(pre, post map[traceKey]TracePath) []PhaseDelta {
+	collected := make(map[string]bool)
+	for k := range post {
+		collected[k.Host] = true
+	}
+	var keys []traceKey
+	for k := range pre {
+		if collected[k.Host] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		return a.Type+" "+a.VRF+" "+a.Destination < b.Type+" "+b.VRF+" "+b.Destination
+	})
+
+	var deltas []PhaseDelta
+	add := func(k traceKey, pre, post, status, reason string) {
+		deltas = append(deltas, PhaseDelta{
+			goldenKey: goldenKey{Host: k.Host, Command: traceCommand, Metric: k.Type + " " + k.VRF + " " + k.Destination},
+			Pre:       pre, Post: post, Status: status, Reason: reason,
+		})
+	}
+	for _, k := range keys {
+		before := pre[k]
+		after, ok := post[k]
+		expected := before.Expect != "" || (ok && after.Expect != "")
+		beforeHops := strings.Join(before.Hops, " > ")
+		switch {
+		case !ok:
+			add(k, beforeHops, "", "WARN", "path not traced in the post run")
+		case before.Reached && !after.Reached:
+			add(k, beforeHops, strings.Join(after.Hops, " > "), "FAIL", "destination reached before, not after")
+		case !sameHops(before.Hops, after.Hops, false):
+			if expected {
+				add(k, beforeHops, strings.Join(after.Hops, " > "), "PASS", "path changed as expected")
+			} else {
+				add(k, beforeHops, strings.Join(after.Hops, " > "), "FAIL", "path changed: hop sequence differs")
+			}
+		case expected:
+			add(k, beforeHops, strings.Join(after.Hops, " > "), "WARN", "path expected to change but the hops are the same")
+		case !sameHops(before.Hops, after.Hops, true):
+			add(k, beforeHops, strings.Join(after.Hops, " > "), "WARN", "same hops, other label stacks")
+		}
+	}
+	return deltas
+}
+
+// compareTraceRuns loads and compares the paths of two runs; nothing is
+// compared when either run has none
+func compareTraceRuns(preDir, postDir string) []PhaseDelta {
+	pre, err1 := loadTraceBaseline(preDir)
+	post, err2 := loadTraceBaseline(postDir)
+	if runCheckSkipped("Traceroute path", "", err1, err2, pre != nil, post != nil) {
+		return nil
+	}
+	return compareTraces(pre, post)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// UPGRADE READINESS AUDIT (version, disk, install state)
+// ============================================================================
+
+// FilesystemInfo is one device filesystem with its size and free space
+type FilesystemInfo struct {
+	Name      string // disk0:, harddisk:, bootflash:
+	SizeBytes int64
+	FreeBytes int64
+}
+
+// FreePct returns free space as a percentage of the filesystem size
+func (f FilesystemInfo) FreePct() float64 {
+	if f.SizeBytes == 0 {
+		return 0
+	}
+	return float64(f.FreeBytes) / float64(f.SizeBytes) * 100
+}
+
+// ReadinessRow is the per-device outcome of the upgrade readiness audit
+type ReadinessRow struct {
+	Hostname   string
+	OS         string
+	Version    string
+	VersionOK  bool
+	DiskName   string
+	DiskFreeMB int64
+	DiskOK     bool
+	Committed  string // YES, NO, or "-" when not collected
+	Inactive   int    // -1 when not collected
+	Ready      bool
+	Reasons    []string
+}
+
+var (
+	xrVersionRe  = regexp.MustCompile(`Cisco IOS XR Software.*Version\s+([\w.()-]+)`)
+	xeVersionRe  = regexp.MustCompile(`Cisco IOS[ -]XE Software.*Version\s+([\w.()-]+)`)
+	iosVersionRe = regexp.MustCompile(`Cisco IOS Software.*Version\s+([\w.()-]+)`)
+	fsTableRe    = regexp.MustCompile(`^\*?\s*(\d+)\s+(\d+)\s+\S+\s+\S+\s+(\S+:)`)
+	dirSummaryRe = regexp.MustCompile(`(\d+) bytes total \((\d+) bytes free\)`)
+	dirHeaderRe  = regexp.MustCompile(`^Directory of (\S+:)`)
+	installHdrRe = regexp.MustCompile(`:(\s|$)`)
+)
+
+// parseSoftwareVersion extracts the running software version from "show version"
+func parseSoftwareVersion(output string) string {
+	for _, re := range []*regexp.Regexp{xrVersionRe, xeVersionRe, iosVersionRe} {
+		if m := re.FindStringSubmatch(output); m != nil {
+			return strings.TrimSuffix(m[1], ",")
+		}
+	}
+	return ""
+}
+
+// parseFilesystems reads "show filesystem" / "show file systems" tables and
+// "dir" summaries into per-filesystem free-space records.
+func parseFilesystems(output string) []FilesystemInfo {
+	var result []FilesystemInfo
+	currentDir := ""
+	for _, line := range strings.Split(output, "\n") {
+		if m := fsTableRe.FindStringSubmatch(line); m != nil {
+			for _, name := range strings.Fields(line[strings.Index(line, m[3]):]) {
+				if !strings.HasSuffix(name, ":") {
+					continue
+				}
+				result = append(result, FilesystemInfo{Name: name, SizeBytes: atoi64(m[1]), FreeBytes: atoi64(m[2])})
+				break
+			}
+			continue
+		}
+		if m := dirHeaderRe.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			currentDir = m[1]
+			continue
+		}
+		if m := dirSummaryRe.FindStringSubmatch(line); m != nil {
+			name := currentDir
+			if name == "" {
+				name = "dir:"
+			}
+			result = append(result, FilesystemInfo{Name: name, SizeBytes: atoi64(m[1]), FreeBytes: atoi64(m[2])})
+		}
+	}
+	return result
+}
+
+// primaryFilesystem picks the install target disk: disk0:/harddisk:/bootflash:
+func primaryFilesystem(fss []FilesystemInfo) (FilesystemInfo, bool) {
+	for _, want := range []string{"disk0:", "harddisk:", "bootflash:", "flash:"} {
+		for _, fs := range fss {
+			if fs.Name == want {
+				return fs, true
+			}
+		}
+	}
+	if len(fss) > 0 {
+		return fss[0], true
+	}
+	return FilesystemInfo{}, false
+}
+
+// parseInstallPackages lists the package lines of "show install ... summary"
+func parseInstallPackages(output string) []string {
+	var pkgs []string
+	for _, line := range strings.Split(output, "\n") {
+		t := strings.TrimSpace(line)
+		if t == "" || installHdrRe.MatchString(t) || strings.HasPrefix(t, "No ") || strings.HasPrefix(t, "Node") {
+			continue
+		}
+		pkgs = append(pkgs, strings.Fields(t)[0])
+	}
+	return pkgs
+}
+
+// upgradeAuditCommands is the readiness check group merged into each OS command set
+var upgradeAuditCommands = map[string][]string{
+	"IOS-XR": {
+		"show version",
+		"show filesystem",
+		"show install active summary",
+		"show install committed summary",
+		"show install inactive summary",
+	},
+	"IOS-XE": {
+		"show version",
+		"show file systems",
+	},
+}
+
+// mergeCommands appends the extra commands not already in cmds
+func mergeCommands(cmds []string, extra []string) []string {
+	have := make(map[string]bool)
+	for _, c := range cmds {
+		have[c] = true
+	}
+	for _, c := range extra {
+		if !have[c] {
+			cmds = append(cmds, c)
+		}
+	}
+	return cmds
+}
+
+// addUpgradeAuditCommands appends any readiness commands missing from the loaded sets
+func addUpgradeAuditCommands(cs *CommandSet) {
+	cs.IOSXR = mergeCommands(cs.IOSXR, upgradeAuditCommands["IOS-XR"])
+	cs.IOSXE = mergeCommands(cs.IOSXE, upgradeAuditCommands["IOS-XE"])
+}
+
+// isFilesystemCommand matches the free-space listings parseFilesystems reads
+func isFilesystemCommand(command string) bool {
+	cmd := strings.ToLower(strings.TrimSpace(command))
+	return strings.Contains(cmd, "show filesystem") || strings.Contains(cmd, "show file systems") || strings.HasPrefix(cmd, "dir")
+}
+
+// buildReadiness evaluates every XR/XE device from a run against the target version and disk threshold
+func buildReadiness(results []*DeviceResult, targetVersion string, minFreeMB int64) []ReadinessRow {
+	var rows []ReadinessRow
+	for _, r := range results {
+		if !r.Success || r.Device.DetectedOS == "L2-SWITCH" {
+			continue
+		}
+		row := ReadinessRow{Hostname: r.Device.Hostname, OS: r.Device.DetectedOS, Committed: "-", Inactive: -1}
+		var active, committed []string
+		haveActive, haveCommitted := false, false
+
+		for _, e := range r.Results {
+			cmd := strings.ToLower(e.Command)
+			switch {
+			case strings.HasPrefix(cmd, "show version"):
+				row.Version = parseSoftwareVersion(e.Output)
+			case isFilesystemCommand(cmd):
+				if fs, ok := primaryFilesystem(parseFilesystems(e.Output)); ok && row.DiskName == "" {
+					row.DiskName = fs.Name
+					row.DiskFreeMB = fs.FreeBytes / (1024 * 1024)
+				}
+			case strings.Contains(cmd, "install active"):
+				active, haveActive = parseInstallPackages(e.Output), true
+			case strings.Contains(cmd, "install committed"):
+				committed, haveCommitted = parseInstallPackages(e.Output), true
+			case strings.Contains(cmd, "install inactive"):
+				row.Inactive = len(parseInstallPackages(e.Output))
+			}
+		}
+
+		row.VersionOK = targetVersion == "" || strings.HasPrefix(row.Version, targetVersion)
+		if !row.VersionOK {
+			row.Reasons = append(row.Reasons, fmt.Sprintf("version %s != target %s", orDash(row.Version), targetVersion))
+		}
+		row.DiskOK = row.DiskName != "" && row.DiskFreeMB >= minFreeMB
+		if row.DiskName == "" {
+			row.Reasons = append(row.Reasons, "disk space not collected")
+		} else if !row.DiskOK {
+			row.Reasons = append(row.Reasons, fmt.Sprintf("%s free %d MB < %d MB", row.DiskName, row.DiskFreeMB, minFreeMB))
+		}
+		if haveActive && haveCommitted {
+			row.Committed = "YES"
+			if strings.Join(active, ",") != strings.Join(committed, ",") {
+				row.Committed = "NO"
+				row.Reasons = append(row.Reasons, "active software not committed")
+			}
+		} else if row.OS == "IOS-XR" {
+			row.Reasons = append(row.Reasons, "install state not collected")
+		}
+		if row.Inactive > 0 {
+			row.Reasons = append(row.Reasons, fmt.Sprintf("%d inactive packages to remove", row.Inactive))
+		}
+		row.Ready = len(row.Reasons) == 0
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// WriteReadiness writes the per-device upgrade readiness table
+func (w *OutputWriter) WriteReadiness(rows []ReadinessRow, targetVersion string, minFreeMB int64) error {
+	filename := filepath.Join(w.dir, fmt.Sprintf("READINESS_%s.log", w.timestamp))
+	file, err := createAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	ready := 0
+	for _, r := range rows {
+		if r.Ready {
+			ready++
+		}
+	}
+
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Upgrade Readiness Audit\n")
+	fmt.Fprintf(file, " Phase: %s | Time: %s\n", w.phase, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, " Target version: %s | Min free disk: %d MB\n", orDash(targetVersion), minFreeMB)
+	fmt.Fprintf(file, "================================================================================\n\n")
+	fmt.Fprintf(file, " Ready: %d/%d\n\n", ready, len(rows))
+
+	table := newTextTable("HOSTNAME", "OS", "VERSION", "DISK", "FREE_MB", "COMMITTED", "INACTIVE", "READY").alignRight(4)
+	for _, r := range rows {
+		inactive := "-"
+		if r.Inactive >= 0 {
+			inactive = strconv.Itoa(r.Inactive)
+		}
+		status := "YES"
+		if !r.Ready {
+			status = "NO: " + strings.Join(r.Reasons, "; ")
+		}
+		table.add(hostSite(r.Hostname), displayHost(r.Hostname), r.OS, orDash(r.Version), orDash(r.DiskName),
+			r.DiskFreeMB, r.Committed, inactive, status)
+	}
+	table.write(file)
+	return nil
+}
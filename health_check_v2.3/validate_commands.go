@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// COMMAND VALIDATION (-validate-commands)
+// ============================================================================
+//
+// Before a maintenance window, every line of the command files is sent to one
+// representative device per OS so commands the software train does not know
+// show up in the lab instead of as "% Invalid input" in the real run. Each
+// alternative of a fallback chain is probed. Show commands get a filter that
+// matches nothing appended, so the device parses and runs them but returns
+// no output; commands that already pipe, and ping/traceroute, go as written.
+
+const validateNoMatch = "| include VALIDATE_NO_MATCH_7c1e"
+
+// CommandCheck is the validation result of one command file line
+type CommandCheck struct {
+	Line     string
+	Accepted []string // alternatives the device accepted
+	Rejected map[string]string
+	Error    string // session failure; nothing is known about the line
+}
+
+// Status summarises the line: OK, FALLBACK, UNSUPPORTED or ERROR
+func (c CommandCheck) Status() string {
+	chain := splitAlternatives(c.Line)
+	switch {
+	case c.Error != "":
+		return "ERROR"
+	case len(c.Accepted) == 0:
+		return "UNSUPPORTED"
+	case c.Accepted[0] != chain[0]:
+		return "FALLBACK"
+	}
+	return "OK"
+}
+
+// OSValidation is the result for one OS and its representative device
+type OSValidation struct {
+	OS          string
+	CommandFile string
+	Device      DeviceInfo
+	Checks      []CommandCheck
+}
+
+// probeCommand is what is sent to check command (see the header comment)
+func probeCommand(command string) string {
+	c := strings.ToLower(strings.TrimSpace(command))
+	if strings.Contains(c, "|") || !strings.HasPrefix(c, "show ") {
+		return command
+	}
+	return command + " " + validateNoMatch
+}
+
+// representativeDevices picks the first target with credentials for each OS
+func representativeDevices(config *Config, targets []DeviceInfo) []DeviceInfo {
+	seen := make(map[string]bool)
+	var reps []DeviceInfo
+	for _, d := range targets {
+		if seen[d.DetectedOS] || !hasSSHCredentials(config, d) {
+			continue
+		}
+		seen[d.DetectedOS] = true
+		reps = append(reps, d)
+	}
+	sort.Slice(reps, func(i, j int) bool { return reps[i].DetectedOS < reps[j].DetectedOS })
+	return reps
+}
+
+// validateCommands probes every command line on one device per OS
+func validateCommands(config *Config, targets []DeviceInfo, commands *CommandSet) []OSValidation {
+	var results []OSValidation
+	for _, d := range representativeDevices(config, targets) {
+		lines := commands.GetCommandsForOS(d.DetectedOS)
+		v := OSValidation{OS: d.DetectedOS, CommandFile: commandFileForOS(config, d.DetectedOS), Device: d}
+		log.Printf("Validating %d command lines for %s on %s (%s)", len(lines), d.DetectedOS, d.Hostname, d.IPAddress)
+
+		var probes []string
+		sent := make(map[string]bool)
+		for _, line := range lines {
+			for _, alt := range splitAlternatives(line) {
+				if p := probeCommand(alt); !sent[p] {
+					sent[p] = true
+					probes = append(probes, p)
+				}
+			}
+		}
+
+		outputs, err := newDeviceClient(d, config).ExecuteCommands(probes)
+		for _, line := range lines {
+			check := CommandCheck{Line: line, Rejected: make(map[string]string)}
+			if err != nil {
+				check.Error = err.Error()
+				v.Checks = append(v.Checks, check)
+				continue
+			}
+			for _, alt := range splitAlternatives(line) {
+				out := outputs[probeCommand(alt)]
+				if isCommandRejected(out) {
+					check.Rejected[alt] = rejectionLine(out)
+				} else {
+					check.Accepted = append(check.Accepted, alt)
+				}
+			}
+			v.Checks = append(v.Checks, check)
+		}
+		if err != nil {
+			log.Printf("✗ %s: %v", d.Hostname, err)
+		}
+		results = append(results, v)
+	}
+	return results
+}
+
+// rejectionLine returns the device's error line from rejected output
+func rejectionLine(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		for _, m := range rejectedMarkers {
+			if strings.Contains(line, m) {
+				return strings.TrimSpace(line)
+			}
+		}
+	}
+	return "rejected"
+}
+
+// writeValidationReport writes VALIDATE_<ts>.log and returns its path and the
+// number of lines with no usable alternative.
+func writeValidationReport(results []OSValidation, targets []DeviceInfo, outputDir string) (string, int, error) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", 0, err
+	}
+	outputFile := filepath.Join(outputDir, fmt.Sprintf("VALIDATE_%s.log", time.Now().Format("20060102_150405")))
+	file, err := createAtomic(outputFile)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "================================================================================\n")
+	fmt.Fprintf(file, " MERALCO Command Validation\n")
+	fmt.Fprintf(file, " Generated: %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(file, "================================================================================\n")
+
+	bad := 0
+	covered := make(map[string]bool)
+	for _, v := range results {
+		covered[v.OS] = true
+		fmt.Fprintf(file, "\n=== %s: %s on %s (%s) ===\n", v.OS, v.CommandFile, v.Device.Hostname, v.Device.IPAddress)
+		for _, c := range v.Checks {
+			status := c.Status()
+			fmt.Fprintf(file, "%-12s %s\n", status, c.Line)
+			switch status {
+			case "ERROR":
+				fmt.Fprintf(file, "             session: %s\n", c.Error)
+				bad++
+			case "UNSUPPORTED", "FALLBACK":
+				for _, alt := range splitAlternatives(c.Line) {
+					if why, ok := c.Rejected[alt]; ok {
+						fmt.Fprintf(file, "             ✗ %s: %s\n", alt, why)
+					}
+				}
+				if status == "FALLBACK" {
+					fmt.Fprintf(file, "             ✓ uses: %s\n", c.Accepted[0])
+				} else {
+					bad++
+				}
+			}
+		}
+	}
+
+	var missing []string
+	for _, d := range targets {
+		if !covered[d.DetectedOS] {
+			covered[d.DetectedOS] = true
+			missing = append(missing, d.DetectedOS)
+		}
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(file, "\nNot validated (no target with credentials): %s\n", strings.Join(missing, ", "))
+	}
+
+	fmt.Fprintf(file, "\n================================================================================\n")
+	fmt.Fprintf(file, " %d command lines unsupported or not checked\n", bad)
+	fmt.Fprintf(file, "================================================================================\n")
+	return outputFile, bad, nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ============================================================================
+// VALIDATION RESULTS EXPORT (-export csv,xlsx,json)
+// ============================================================================
+//
+// The check reports are laid out for reading, not for pivoting. With -export
+// every collection also writes VALIDATION_<ts>.csv, .xlsx and/or .json: one row per
+// device, check and item with the site and OS alongside, so the planning
+// team can filter and pivot by site, check or status in Excel:
+//
+//   Site, Hostname, OS, Check, Item, Value, Status, Detail, Seq, Time_UTC, Source
+//
+// Seq, Time_UTC and Source stamp when the result was judged, so the results
+// of several operators merge in a fixed order (see sample_stamp.go).
+//
+// The checks are the ones the run performed: connection, ping, and, when
+// enabled, critical-vrf, disk, readiness, redundancy, segment-routing,
+// route-policy and ospf-intent. The XLSX is a native workbook written by
+// writeXLSX (no Excel or converter needed). The JSON has the phase and
+// timestamp of the run and the results; -compare-results diffs two of them
+// (results_diff.go). With -compare the comparison and regressions CSVs get
+// an .xlsx copy as well.
+
+var exportFormats = []string{"csv", "xlsx", "json"}
+
+var validationHeader = []string{"Site", "Hostname", "OS", "Check", "Item", "Value", "Status", "Detail", "Seq", "Time_UTC", "Source"}
+
+// ValidationResult is one judged item of a run
+type ValidationResult struct {
+	Site     string `json:"site"`
+	Hostname string `json:"hostname"`
+	OS       string `json:"os"`
+	Check    string `json:"check"` // connection, ping, critical-vrf, disk, readiness, redundancy, segment-routing, route-policy, ospf-intent
+	Item     string `json:"item"`  // the target, filesystem, policy attach point, ...
+	Value    string `json:"value"`
+	Status   string `json:"status"`
+	Detail   string `json:"detail"`
+	Seq      uint64 `json:"seq,omitempty"`
+	Time     string `json:"time,omitempty"` // UTC, milliseconds
+	Source   string `json:"source,omitempty"`
+}
+
+// validationExport is the layout of VALIDATION_<ts>.json
+type validationExport struct {
+	Phase     string             `json:"phase"`
+	Timestamp string             `json:"timestamp"`
+	Results   []ValidationResult `json:"results"`
+}
+
+func (v ValidationResult) row() []string {
+	seq := ""
+	if v.Seq > 0 {
+		seq = fmt.Sprint(v.Seq)
+	}
+	return []string{v.Site, v.Hostname, v.OS, v.Check, v.Item, v.Value, v.Status, v.Detail, seq, v.Time, v.Source}
+}
+
+// parseExportFormats reads a comma-separated subset of csv,xlsx,json
+func parseExportFormats(spec string) (map[string]bool, error) {
+	formats := make(map[string]bool)
+	for _, f := range strings.Split(spec, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" {
+			continue
+		}
+		if f != "csv" && f != "xlsx" && f != "json" {
+			return nil, fmt.Errorf("unknown export format %q (expected %s)", f, strings.Join(exportFormats, ","))
+		}
+		formats[f] = true
+	}
+	return formats, nil
+}
+
+// validationSet accumulates the results of a run's checks
+type validationSet struct {
+	devices map[string]DeviceInfo
+	rows    []ValidationResult
+}
+
+func newValidationSet(results []*DeviceResult) *validationSet {
+	v := &validationSet{devices: make(map[string]DeviceInfo)}
+	for _, r := range results {
+		v.devices[r.Device.Hostname] = r.Device
+		res := ValidationResult{Check: "connection", Item: r.Device.IPAddress, Status: "OK"}
+		if !r.Success {
+			res.Status, res.Detail = "FAILED", r.ErrorMessage
+		}
+		v.add(r.Device.Hostname, res)
+	}
+	return v
+}
+
+// add fills in the device columns and appends the result
+func (v *validationSet) add(hostname string, res ValidationResult) {
+	d := v.devices[hostname]
+	res.Hostname, res.Site, res.OS = hostname, d.Site, d.DetectedOS
+	stamp := newSampleStamp()
+	res.Seq, res.Time, res.Source = stamp.Seq, stamp.UTC(), stamp.Source
+	v.rows = append(v.rows, res)
+}
+
+func (v *validationSet) addPings(pings []PingResult, thresholds *pingThresholds) {
+	for _, p := range pings {
+		item := p.Target
+		if p.VRF != "" {
+			item = p.VRF + "/" + p.Target
+		}
+		v.add(p.Hostname, ValidationResult{Check: "ping", Item: item, Value: fmt.Sprintf("%d%%", p.SuccessPct),
+			Status: thresholds.status(p), Detail: fmt.Sprintf("%d/%d received, need %d%%", p.Received, p.Sent, thresholds.threshold(p))})
+	}
+}
+
+func (v *validationSet) addDisk(rows []DiskRow) {
+	for _, r := range rows {
+		res := ValidationResult{Check: "disk", Item: r.FS.Name, Status: r.Status}
+		if r.Status != "NOT_COLLECTED" {
+			res.Value = fmt.Sprintf("%d MB", r.FS.FreeBytes/(1024*1024))
+			res.Detail = fmt.Sprintf("%.1f%% free", r.FS.FreePct())
+		}
+		v.add(r.Hostname, res)
+	}
+}
+
+func (v *validationSet) addReadiness(rows []ReadinessRow) {
+	for _, r := range rows {
+		status := "NOT_READY"
+		if r.Ready {
+			status = "READY"
+		}
+		v.add(r.Hostname, ValidationResult{Check: "readiness", Item: r.DiskName, Value: r.Version,
+			Status: status, Detail: strings.Join(r.Reasons, "; ")})
+	}
+}
+
+func (v *validationSet) addRedundancy(rows []RedundancyRow) {
+	for _, r := range rows {
+		v.add(r.Hostname, ValidationResult{Check: "redundancy", Item: r.StandbyRP, Value: r.StandbyState,
+			Status: r.Status, Detail: strings.Join(r.Reasons, "; ")})
+	}
+}
+
+func (v *validationSet) addCritical(findings []CriticalFinding) {
+	for _, f := range findings {
+		v.add(f.Hostname, ValidationResult{Check: "critical-vrf", Item: f.VRF, Value: f.Pings,
+			Status: f.Status, Detail: strings.Join(f.Reasons, "; ")})
+	}
+}
+
+func (v *validationSet) addEEM(rows []EEMRow) {
+	for _, r := range rows {
+		v.add(r.Hostname, ValidationResult{Check: "eem-watcher", Item: r.Collector, Value: fmt.Sprint(r.Events),
+			Status: r.Status, Detail: strings.Join(r.Reasons, "; ")})
+	}
+}
+
+func (v *validationSet) addSR(rows []SRRow) {
+	for _, r := range rows {
+		v.add(r.Hostname, ValidationResult{Check: "segment-routing", Item: r.Loopback, Value: r.SRGB,
+			Status: r.Status, Detail: strings.Join(r.Reasons, "; ")})
+	}
+}
+
+func (v *validationSet) addISIS(rows []ISISRow) {
+	for _, r := range rows {
+		v.add(r.Hostname, ValidationResult{Check: "isis", Item: r.Instances, Value: fmt.Sprintf("%d/%d", r.Up, r.Total),
+			Status: r.Status, Detail: strings.Join(r.Reasons, "; ")})
+	}
+}
+
+func (v *validationSet) addPairs(rows []PairRow) {
+	for _, r := range rows {
+		for i, m := range r.Members {
+			share := ""
+			if i < len(r.Traffic) {
+				share = fmt.Sprintf("%d%%", r.Traffic[i])
+			}
+			v.add(m, ValidationResult{Check: "node-pair", Item: r.Pair, Value: share,
+				Status: r.Status, Detail: strings.Join(r.Reasons, "; ")})
+		}
+	}
+}
+
+func (v *validationSet) addLogEvents(rows []LogEventRow) {
+	for _, r := range rows {
+		if len(r.Events) == 0 {
+			v.add(r.Hostname, ValidationResult{Check: "log-events", Value: "0", Status: r.Status, Detail: strings.Join(r.Reasons, "; ")})
+			continue
+		}
+		for _, e := range r.Events {
+			v.add(r.Hostname, ValidationResult{Check: "log-events", Item: e.Kind + " " + e.Object, Value: fmt.Sprint(e.Count),
+				Status: r.Status, Detail: fmt.Sprintf("%s .. %s", e.First.Format("2006-01-02 15:04:05"), e.Last.Format("15:04:05"))})
+		}
+	}
+}
+
+func (v *validationSet) addPolicies(findings []PolicyFinding) {
+	for _, f := range findings {
+		item := strings.TrimSpace(strings.Join([]string{f.VRF, f.Attach, f.Direction}, " "))
+		detail := ""
+		if f.Expected != "" {
+			detail = "expected " + f.Expected
+		}
+		v.add(f.Hostname, ValidationResult{Check: "route-policy", Item: item, Value: f.Actual,
+			Status: f.Status, Detail: detail})
+	}
+}
+
+func (v *validationSet) addOSPFIntent(findings []OSPFIntentFinding) {
+	for _, f := range findings {
+		res := ValidationResult{Check: "ospf-intent", Status: f.Status}
+		if f.Intent != nil {
+			res.Item = f.Intent.NeighborID
+			res.Detail = strings.TrimSpace("intended " + f.Intent.Interface + " area " + orDash(f.Intent.Area))
+		}
+		if f.Live != nil {
+			res.Item, res.Value = f.Live.NeighborID, f.Live.Interface+" "+f.Live.State
+		}
+		v.add(f.Hostname, res)
+	}
+}
+
+// WriteValidation writes VALIDATION_<ts>.csv / .xlsx / .json and returns the paths
+func (w *OutputWriter) WriteValidation(results []ValidationResult, formats map[string]bool) ([]string, error) {
+	base := filepath.Join(w.dir, fmt.Sprintf("VALIDATION_%s", w.timestamp))
+	rows := [][]string{validationHeader}
+	for _, r := range results {
+		rows = append(rows, r.row())
+	}
+	var written []string
+	if formats["csv"] {
+		if err := writeCSVRows(base+".csv", rows); err != nil {
+			return written, err
+		}
+		written = append(written, base+".csv")
+	}
+	if formats["xlsx"] {
+		if err := writeXLSX(base+".xlsx", "Validation", rows); err != nil {
+			return written, err
+		}
+		written = append(written, base+".xlsx")
+	}
+	if formats["json"] {
+		data, err := json.MarshalIndent(validationExport{Phase: w.phase, Timestamp: w.timestamp, Results: results}, "", "  ")
+		if err != nil {
+			return written, err
+		}
+		if err := writeFileAtomic(base+".json", append(data, '\n')); err != nil {
+			return written, err
+		}
+		written = append(written, base+".json")
+	}
+	return written, nil
+}
+
+// writeCSVRows writes rows with encoding/csv quoting
+func writeCSVRows(path string, rows [][]string) error {
+	file, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := csv.NewWriter(file)
+	w.WriteAll(rows)
+	return w.Error()
+}
+
+// csvToXLSX writes an .xlsx copy of a CSV report beside it
+func csvToXLSX(csvPath, sheetName string) (string, error) {
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", csvPath, err)
+	}
+	path := strings.TrimSuffix(csvPath, filepath.Ext(csvPath)) + ".xlsx"
+	return path, writeXLSX(path, sheetName, rows)
+}
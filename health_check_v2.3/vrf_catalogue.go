@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// VRF CATALOGUE (-vrf-catalogue)
+// ============================================================================
+//
+// Onboarding a set of VRFs meant editing -critical-vrfs, the ping lines of
+// the command files and the thresholds by hand. -vrf-catalogue reads the
+// VRFs from the design workbook instead: a CSV file, or the first sheet of
+// an XLSX workbook whose header row names a VRF column:
+//
+//   VRF       RD          Import_RT            Export_RT   Priority  PEs         Destinations
+//   TELEPROT  65000:100   65000:100 65000:900  65000:100   1         UPE1 UPE21  10.20.0.1 10.20.0.2
+//   SCADA     65000:200   65000:200            65000:200   2         UPE1        10.30.0.1
+//   CORP      65000:300   65000:300            65000:300             UPE2
+//
+// Headers are matched without case, spaces and underscores ("RT Import",
+// "Hosting PEs" and "Test Destinations" work too, RT fills both import and
+// export); lists are separated by spaces, commas or semicolons. The whole
+// file is validated before the run, every error with its row:
+//
+//   - VRF names are unique and valid, RDs unique, RDs and RTs ASN:NN or
+//     A.B.C.D:NN, priorities unique positive numbers, destinations IP
+//     addresses, and every PE is in the inventory
+//
+// With a catalogue the VRFs with a priority are the critical VRFs (unless
+// -critical-vrfs is given), highest first, and every hosting PE pings the
+// destinations of its VRFs each run. The critical service gate also fails a
+// critical VRF that the catalogue places on a PE whose VRF table lacks it
+// or shows another RD.
+
+var vrfRTRe = regexp.MustCompile(`^(\d+:\d+|\d+\.\d+\.\d+\.\d+:\d+)$`)
+
+// VRFDefinition is one row of the catalogue
+type VRFDefinition struct {
+	Name         string
+	RD           string
+	ImportRTs    []string
+	ExportRTs    []string
+	Priority     int // 0 = not critical
+	PEs          []string
+	Destinations []string
+}
+
+// vrfCatalogue is the loaded -vrf-catalogue; a nil catalogue is empty
+type vrfCatalogue struct {
+	Source string
+	VRFs   []VRFDefinition
+}
+
+// vrfCatalogueColumns maps the normalized header names to the fields
+var vrfCatalogueColumns = map[string]string{
+	"VRF": "name", "NAME": "name", "VRFNAME": "name",
+	"RD": "rd", "ROUTEDISTINGUISHER": "rd",
+	"RT": "rt", "RTS": "rt", "ROUTETARGET": "rt", "ROUTETARGETS": "rt",
+	"IMPORTRT": "import", "RTIMPORT": "import", "IMPORTRTS": "import", "IMPORT": "import",
+	"EXPORTRT": "export", "RTEXPORT": "export", "EXPORTRTS": "export", "EXPORT": "export",
+	"PRIORITY": "priority",
+	"PES":      "pes", "PE": "pes", "HOSTINGPES": "pes", "HOSTS": "pes",
+	"DESTINATIONS": "dests", "TESTDESTINATIONS": "dests", "DESTINATION": "dests", "TARGETS": "dests",
+}
+
+var vrfListSplitRe = regexp.MustCompile(`[\s,;]+`)
+
+func splitVRFList(cell string) []string {
+	var out []string
+	for _, f := range vrfListSplitRe.Split(strings.TrimSpace(cell), -1) {
+		if f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// loadVRFCatalogue reads and validates a CSV or XLSX catalogue
+func loadVRFCatalogue(path string) (*vrfCatalogue, error) {
+	var rows [][]string
+	if strings.EqualFold(filepath.Ext(path), ".xlsx") {
+		sheets, err := readXLSXSheets(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, sheet := range sheets {
+			if len(sheet) > 0 && xlsxHasVRFColumn(sheet[0]) {
+				rows = xlsxRowsToSlices(sheet)
+				break
+			}
+		}
+		if rows == nil {
+			return nil, fmt.Errorf("%s: no sheet with a VRF column", path)
+		}
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r := csv.NewReader(file)
+		r.FieldsPerRecord = -1
+		r.Comment = '#'
+		if rows, err = r.ReadAll(); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return parseVRFCatalogue(rows, path)
+}
+
+func xlsxHasVRFColumn(header map[string]string) bool {
+	for _, h := range header {
+		if vrfCatalogueColumns[normalizeCatalogueHeader(h)] == "name" {
+			return true
+		}
+	}
+	return false
+}
+
+// xlsxRowsToSlices lays the lettered cells of a sheet out as columns
+func xlsxRowsToSlices(sheet []map[string]string) [][]string {
+	width := 0
+	for _, row := range sheet {
+		for col := range row {
+			if i := xlsxColumnIndex(col) + 1; i > width {
+				width = i
+			}
+		}
+	}
+	rows := make([][]string, len(sheet))
+	for i, row := range sheet {
+		rows[i] = make([]string, width)
+		for col, v := range row {
+			rows[i][xlsxColumnIndex(col)] = v
+		}
+	}
+	return rows
+}
+
+// xlsxColumnIndex is the 0-based index of a column letter (A, ..., Z, AA)
+func xlsxColumnIndex(col string) int {
+	n := 0
+	for _, c := range col {
+		n = n*26 + int(c-'A'+1)
+	}
+	return n - 1
+}
+
+func normalizeCatalogueHeader(h string) string {
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToUpper(strings.TrimSpace(h)))
+}
+
+// parseVRFCatalogue validates the rows (header first) of a catalogue
+func parseVRFCatalogue(rows [][]string, source string) (*vrfCatalogue, error) {
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s: empty", source)
+	}
+	cols := make(map[string]int)
+	for i, h := range rows[0] {
+		if field, ok := vrfCatalogueColumns[normalizeCatalogueHeader(h)]; ok {
+			if _, dup := cols[field]; !dup {
+				cols[field] = i
+			}
+		}
+	}
+	if _, ok := cols["name"]; !ok {
+		return nil, fmt.Errorf("%s: header has no VRF column", source)
+	}
+	cell := func(row []string, field string) string {
+		if i, ok := cols[field]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	c := &vrfCatalogue{Source: source}
+	var errs []string
+	fail := func(n int, format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf("%s:%d: %s", source, n, fmt.Sprintf(format, args...)))
+	}
+	names := make(map[string]int)
+	rds := make(map[string]string)
+	priorities := make(map[int]string)
+	for i, row := range rows[1:] {
+		n := i + 2
+		v := VRFDefinition{Name: cell(row, "name"), RD: cell(row, "rd")}
+		if v.Name == "" {
+			continue
+		}
+		if !apiVRFRe.MatchString(v.Name) {
+			fail(n, "invalid VRF name %q", v.Name)
+		}
+		if first, ok := names[strings.ToUpper(v.Name)]; ok {
+			fail(n, "VRF %s already defined in row %d", v.Name, first)
+		}
+		names[strings.ToUpper(v.Name)] = n
+
+		if v.RD != "" {
+			if !vrfRTRe.MatchString(v.RD) {
+				fail(n, "%s: invalid RD %q (ASN:NN or A.B.C.D:NN)", v.Name, v.RD)
+			} else if other, ok := rds[v.RD]; ok {
+				fail(n, "%s: RD %s also used by VRF %s", v.Name, v.RD, other)
+			}
+			rds[v.RD] = v.Name
+		}
+		both := splitVRFList(cell(row, "rt"))
+		v.ImportRTs = append(append([]string{}, both...), splitVRFList(cell(row, "import"))...)
+		v.ExportRTs = append(append([]string{}, both...), splitVRFList(cell(row, "export"))...)
+		for _, rt := range append(append([]string{}, v.ImportRTs...), v.ExportRTs...) {
+			if !vrfRTRe.MatchString(rt) {
+				fail(n, "%s: invalid route target %q", v.Name, rt)
+			}
+		}
+
+		if p := cell(row, "priority"); p != "" {
+			prio, err := strconv.Atoi(p)
+			switch {
+			case err != nil || prio < 1:
+				fail(n, "%s: priority %q is not a positive number", v.Name, p)
+			case priorities[prio] != "":
+				fail(n, "%s: priority %d already given to VRF %s", v.Name, prio, priorities[prio])
+			default:
+				v.Priority = prio
+				priorities[prio] = v.Name
+			}
+		}
+
+		v.PEs = splitVRFList(cell(row, "pes"))
+		for _, d := range splitVRFList(cell(row, "dests")) {
+			if !isIPAddress(d) {
+				fail(n, "%s: destination %q is not an IP address", v.Name, d)
+				continue
+			}
+			v.Destinations = append(v.Destinations, d)
+		}
+		if len(v.Destinations) > 0 && len(v.PEs) == 0 {
+			fail(n, "%s: test destinations but no PEs to ping them from", v.Name)
+		}
+		c.VRFs = append(c.VRFs, v)
+	}
+	if len(c.VRFs) == 0 && len(errs) == 0 {
+		errs = append(errs, fmt.Sprintf("%s: no VRFs", source))
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%d errors in the VRF catalogue:\n  %s", len(errs), strings.Join(errs, "\n  "))
+	}
+	return c, nil
+}
+
+// checkPEs reports the hosting PEs missing from the inventory
+func (c *vrfCatalogue) checkPEs(devices map[string]DeviceInfo) error {
+	var missing []string
+	for _, v := range c.VRFs {
+		for _, pe := range v.PEs {
+			if _, ok := devices[strings.ToUpper(pe)]; !ok {
+				missing = append(missing, fmt.Sprintf("%s (VRF %s)", pe, v.Name))
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s: PEs not in the inventory: %s", c.Source, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// criticalVRFs lists the VRFs with a priority, highest first
+func (c *vrfCatalogue) criticalVRFs() []string {
+	if c == nil {
+		return nil
+	}
+	var list []VRFDefinition
+	for _, v := range c.VRFs {
+		if v.Priority > 0 {
+			list = append(list, v)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Priority < list[j].Priority })
+	names := make([]string, len(list))
+	for i, v := range list {
+		names[i] = v.Name
+	}
+	return names
+}
+
+// hosting returns the definition of vrf when the catalogue places it on host
+func (c *vrfCatalogue) hosting(vrf, host string) (VRFDefinition, bool) {
+	if c == nil {
+		return VRFDefinition{}, false
+	}
+	for _, v := range c.VRFs {
+		if !strings.EqualFold(v.Name, vrf) {
+			continue
+		}
+		for _, pe := range v.PEs {
+			if strings.EqualFold(pe, host) {
+				return v, true
+			}
+		}
+	}
+	return VRFDefinition{}, false
+}
+
+// pingCommands are the catalogue pings of a device
+func (c *vrfCatalogue) pingCommands(d DeviceInfo) []string {
+	if c == nil {
+		return nil
+	}
+	var cmds []string
+	for _, v := range c.VRFs {
+		if _, ok := c.hosting(v.Name, d.Hostname); !ok {
+			continue
+		}
+		for _, dest := range v.Destinations {
+			if strings.EqualFold(v.Name, "default") {
+				cmds = append(cmds, expandCommand(fmt.Sprintf("ping %s {count} 5", dest), d.DetectedOS))
+				continue
+			}
+			cmds = append(cmds, expandCommand(fmt.Sprintf("ping vrf %s %s {count} 5", v.Name, dest), d.DetectedOS))
+		}
+	}
+	return cmds
+}
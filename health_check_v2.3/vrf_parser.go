@@ -0,0 +1,70 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ============================================================================
+// VRF TABLE PARSER
+// ============================================================================
+
+// VRFEntry is one VRF definition as reported by the device
+type VRFEntry struct {
+	Name string
+	RD   string
+}
+
+var (
+	rdRe          = regexp.MustCompile(`^(\d+:\d+|\d+\.\d+\.\d+\.\d+:\d+)$`)
+	vrfDetailXRRe = regexp.MustCompile(`^\s*VRF (\S+); RD (not set|\S+?);`)
+	vrfDetailXERe = regexp.MustCompile(`^\s*VRF (\S+) \(VRF Id = \d+\); default RD (<not set>|\S+?);`)
+)
+
+// parseVRFTable extracts VRF name/RD pairs from "show vrf", "show vrf all",
+// "show ip vrf" and their "detail" variants on IOS-XR and IOS-XE.
+func parseVRFTable(output string) []VRFEntry {
+	var entries []VRFEntry
+	seen := make(map[string]bool)
+	add := func(name, rd string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		entries = append(entries, VRFEntry{Name: name, RD: rd})
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if m := vrfDetailXRRe.FindStringSubmatch(line); m != nil {
+			add(m[1], normalizeRD(m[2]))
+			continue
+		}
+		if m := vrfDetailXERe.FindStringSubmatch(line); m != nil {
+			add(m[1], normalizeRD(m[2]))
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch strings.ToLower(fields[0]) {
+		case "vrf", "name", "import", "export":
+			continue
+		}
+		if rdRe.MatchString(fields[1]) {
+			add(fields[0], fields[1])
+		} else if len(fields) >= 3 && fields[1] == "not" && fields[2] == "set" {
+			add(fields[0], "")
+		} else if fields[1] == "<not" {
+			add(fields[0], "")
+		}
+	}
+	return entries
+}
+
+func normalizeRD(rd string) string {
+	if rd == "not set" || rd == "<not set>" {
+		return ""
+	}
+	return rd
+}
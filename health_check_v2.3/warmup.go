@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// CONNECTION WARM-UP (-warmup)
+// ============================================================================
+//
+// A locked TACACS account or a device that takes a minute to hand out a
+// prompt is found by the first check of the window, when there is no time
+// left to chase it. -warmup logs in to every target before the run starts
+// (the window, runbook or schedule waits only after it) and reports per
+// device how long the login took:
+//
+//   READY        logged in and answered "show clock"
+//   SLOW         the same, but slower than -warmup-slow
+//   AUTH_FAIL    permission denied: wrong password, locked account, AAA
+//   UNREACHABLE  connect timeout, refused, no route, no prompt
+//   ERROR        anything else
+//
+// With -persist the sessions stay parked in the pool, kept alive every
+// -keepalive, so the first snapshot of the run reuses them; without it
+// each login is closed again and only the credentials are checked.
+// WARMUP_<ts>.log goes to <output>/warmup/. Devices that are not READY
+// raise an alert (critical for AAA failures); the run goes on.
+
+const warmupDirName = "warmup"
+
+const warmupProbe = "show clock"
+
+// warmupAuthHints and warmupReachHints classify a failed login
+var (
+	warmupAuthHints  = []string{"permission denied", "authentication", "password", "locked", "access denied"}
+	warmupReachHints = []string{"timeout", "timed out", "refused", "no route", "unreachable", "resolve", "no prompt", "closed by remote"}
+)
+
+// WarmupResult is the login of one device
+type WarmupResult struct {
+	Device DeviceInfo
+	Login  time.Duration
+	Status string // READY, SLOW, AUTH_FAIL, UNREACHABLE, ERROR
+	Error  string
+}
+
+// warmupStatus classifies a login attempt
+func warmupStatus(err error, took, slow time.Duration) string {
+	if err == nil {
+		if slow > 0 && took > slow {
+			return "SLOW"
+		}
+		return "READY"
+	}
+	msg := strings.ToLower(err.Error())
+	for _, h := range warmupAuthHints {
+		if strings.Contains(msg, h) {
+			return "AUTH_FAIL"
+		}
+	}
+	for _, h := range warmupReachHints {
+		if strings.Contains(msg, h) {
+			return "UNREACHABLE"
+		}
+	}
+	return "ERROR"
+}
+
+// warmupDevice logs in to one device and runs the probe; the session
+// stays in the pool when there is one
+func warmupDevice(config *Config, d DeviceInfo) WarmupResult {
+	client := newDeviceClient(d, config)
+	if client.pool == nil {
+		// A prompt-driven login reports why it failed, the piped script
+		// only returns no output
+		client.expect = true
+	}
+	start := time.Now()
+	outputs, err := client.ExecuteCommands([]string{warmupProbe})
+	took := time.Since(start)
+	if err == nil && isIncompleteOutput(outputs[warmupProbe]) {
+		err = fmt.Errorf("session closed during the probe")
+	}
+	r := WarmupResult{Device: d, Login: took, Status: warmupStatus(err, took, config.WarmupSlow)}
+	switch {
+	case err != nil:
+		r.Error = err.Error()
+	case r.Status == "SLOW":
+		r.Error = fmt.Sprintf("login and probe took %s (limit %s)", took.Round(100*time.Millisecond), config.WarmupSlow)
+	}
+	return r
+}
+
+// runWarmup logs in to every target, writes the report and alerts on the
+// devices that are not ready; it returns the number of those
+func runWarmup(config *Config, targets []DeviceInfo) int {
+	log.Printf("Warm-up: logging in to %d devices...", len(targets))
+	var mu sync.Mutex
+	var results []WarmupResult
+	forEachDevice(config, targets, func(d DeviceInfo) {
+		r := warmupDevice(config, d)
+		mu.Lock()
+		results = append(results, r)
+		mu.Unlock()
+	})
+	sort.Slice(results, func(i, j int) bool { return results[i].Device.Hostname < results[j].Device.Hostname })
+
+	dir := filepath.Join(config.OutputDir, warmupDirName)
+	path := filepath.Join(dir, fmt.Sprintf("WARMUP_%s.log", time.Now().Format("20060102_150405")))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("⚠ Warm-up report: %v", err)
+	} else if file, err := createAtomic(path); err != nil {
+		log.Printf("⚠ Warm-up report: %v", err)
+	} else {
+		writeWarmupTable(file, results, config)
+		file.Close()
+	}
+	counts := writeWarmupTable(os.Stdout, results, config)
+
+	var details []string
+	severity := "warning"
+	for _, r := range results {
+		if r.Status == "READY" {
+			continue
+		}
+		if r.Status == "AUTH_FAIL" {
+			severity = "critical"
+		}
+		details = append(details, fmt.Sprintf("%s %s: %s", r.Device.Hostname, r.Status, r.Error))
+	}
+	log.Printf("Warm-up: READY %d | SLOW %d | AUTH_FAIL %d | UNREACHABLE %d | ERROR %d (%s)",
+		counts["READY"], counts["SLOW"], counts["AUTH_FAIL"], counts["UNREACHABLE"], counts["ERROR"], path)
+	if config.Pool != nil {
+		log.Printf("Warm-up: %d sessions parked until the run", counts["READY"]+counts["SLOW"])
+	}
+	if len(details) > 0 {
+		config.Notify.notify(Alert{Event: "fail", Severity: severity, Check: "connection warm-up", Details: details})
+	}
+	return len(details)
+}
+
+// writeWarmupTable writes the login table and returns the status counts
+func writeWarmupTable(out io.Writer, results []WarmupResult, config *Config) map[string]int {
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.Status]++
+	}
+	sessions := "closed after login"
+	if config.Pool != nil {
+		sessions = fmt.Sprintf("parked, keepalive %s", config.Keepalive)
+	}
+	fmt.Fprintf(out, "================================================================================\n")
+	fmt.Fprintf(out, " MERALCO Connection Warm-up\n")
+	fmt.Fprintf(out, " Time: %s | Slow above: %s | Sessions: %s\n", time.Now().Format("2006-01-02 15:04:05"), config.WarmupSlow, sessions)
+	fmt.Fprintf(out, " READY: %d | SLOW: %d | AUTH_FAIL: %d | UNREACHABLE: %d | ERROR: %d\n",
+		counts["READY"], counts["SLOW"], counts["AUTH_FAIL"], counts["UNREACHABLE"], counts["ERROR"])
+	fmt.Fprintf(out, "================================================================================\n\n")
+
+	table := newTextTable("HOSTNAME", "IP ADDRESS", "OS", "LOGIN", "STATUS").alignRight(3)
+	for _, r := range results {
+		table.add(r.Device.Site, displayHost(r.Device.Hostname), r.Device.IPAddress, r.Device.DetectedOS,
+			fmt.Sprintf("%.1fs", r.Login.Seconds()), r.Status)
+		if r.Error != "" {
+			table.note("    - %s", r.Error)
+		}
+	}
+	table.write(out)
+	fmt.Fprintln(out)
+	return counts
+}
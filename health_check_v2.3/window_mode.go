@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// WINDOW MODE - time-boxed during-migration monitoring
+// ============================================================================
+
+// windowWarnings are the remaining-time marks announced to the operator
+var windowWarnings = []time.Duration{30 * time.Minute, 10 * time.Minute}
+
+// runWindowMode takes a baseline snapshot, keeps collecting every
+// WindowEvery until the declared window expires, then captures a final
+// post-window snapshot and compares it against the baseline. It returns
+// true when a rollback rule halted the window early.
+func runWindowMode(config *Config, targetDevices []DeviceInfo, commands *CommandSet) bool {
+	start := time.Now()
+	deadline := start.Add(config.Window)
+	log.Printf("WINDOW MODE: %v window, ends at %s, snapshot every %v",
+		config.Window, deadline.Format("15:04:05"), config.WindowEvery)
+
+	// Stopped on return, so a window halted early announces no T-marks
+	var warnings []*time.Timer
+	defer func() {
+		for _, t := range warnings {
+			t.Stop()
+		}
+	}()
+	for _, mark := range windowWarnings {
+		if config.Window <= mark {
+			continue
+		}
+		mark := mark
+		warnings = append(warnings, time.AfterFunc(time.Until(deadline.Add(-mark)), func() {
+			log.Printf("⚠ WINDOW: T-%d minutes (window ends at %s)", int(mark.Minutes()), deadline.Format("15:04:05"))
+		}))
+	}
+
+	specs, err := loadMonitorSpecs(config.Monitors)
+	if err != nil {
+		log.Fatalf("Failed to load monitors: %v", err)
+	}
+	log.Printf("WINDOW: %d monitors active", len(specs))
+	samples := newSampler(specs)
+
+	var rollback *rollbackEngine
+	if config.RollbackRules != "" {
+		rules, err := parseRollbackRules(config.RollbackRules)
+		if err != nil {
+			log.Fatalf("Failed to load rollback rules: %v", err)
+		}
+		rollback = newRollbackEngine(config, rules, targetDevices)
+		log.Printf("WINDOW: %d rollback rules armed (log: %s)", len(rules), rollback.logFile)
+	}
+
+	config.Changes = newChangeWatcher(config, targetDevices)
+	config.Changes.start()
+	defer config.Changes.close()
+	if config.ChangeAllow != "" {
+		var mop []DeviceInfo
+		for _, d := range targetDevices {
+			for _, h := range strings.Split(config.ChangeAllow, ",") {
+				if strings.EqualFold(strings.TrimSpace(h), d.Hostname) {
+					mop = append(mop, d)
+				}
+			}
+		}
+		config.Changes.allow("window MOP", mop)
+	}
+
+	baseWriter, baseResults := runCollection(config, targetDevices, commands, config.Phase+"-window-start")
+	log.Printf("Window baseline: %s", baseWriter.dir)
+	samples.add(time.Now(), baseResults)
+	samples.evaluate()
+	if rollback != nil {
+		rollback.setBaseline(baseResults)
+	}
+
+	halted := false
+	snapshots := 1
+	lastWriter, lastResults := baseWriter, baseResults
+	for !halted && !config.Stop.stopping() {
+		next := time.Now().Add(config.WindowEvery)
+		if !next.Before(deadline) {
+			break
+		}
+		if !config.Stop.sleep(time.Until(next)) {
+			break
+		}
+		snapshots++
+		log.Printf("WINDOW: snapshot %d (%s remaining)", snapshots, time.Until(deadline).Round(time.Second))
+		lastWriter, lastResults = runCollection(config, targetDevices, commands, config.Phase+"-window")
+		samples.add(time.Now(), lastResults)
+		samples.evaluate()
+		if rollback != nil {
+			halted = rollback.evaluate(lastResults)
+		}
+	}
+
+	if wait := time.Until(deadline); wait > 0 && !halted && !config.Stop.stopping() {
+		log.Printf("WINDOW: waiting %s for window to expire", wait.Round(time.Second))
+		config.Stop.sleep(wait)
+	}
+
+	// A stopped window reports on the snapshots it has; the last one, cut
+	// short or not, stands in for the final snapshot
+	finalWriter, finalResults := lastWriter, lastResults
+	switch {
+	case config.Stop.stopping():
+		log.Printf("⏹ WINDOW STOPPED: comparing the last snapshot (%s) with the baseline", finalWriter.dir)
+		snapshots--
+	case halted:
+		log.Printf("⛔ WINDOW HALTED: capturing final snapshot")
+	default:
+		log.Printf("⏰ WINDOW EXPIRED: capturing final post-window snapshot")
+	}
+	if !config.Stop.stopping() {
+		finalWriter, finalResults = runCollection(config, targetDevices, commands, config.Phase+"-window-final")
+		samples.add(time.Now(), finalResults)
+		samples.evaluate()
+		if rollback != nil && !halted {
+			halted = rollback.evaluate(finalResults)
+		}
+	}
+	if err := finalWriter.WriteMonitorReport(samples); err != nil {
+		log.Printf("✗ Monitor report failed: %v", err)
+	}
+	printRunFooter(finalWriter, finalResults)
+
+	report := filepath.Join(finalWriter.dir, "COMPARISON_REPORT.txt")
+	verdict, err := comparePhases(baseWriter.dir, finalWriter.dir, report, config.Bands)
+	if err != nil {
+		log.Printf("✗ Window comparison failed: %v", err)
+		return halted
+	}
+	fmt.Printf(" Window:   %d snapshots over %s\n", snapshots+1, time.Since(start).Round(time.Second))
+	fmt.Printf(" Compare:  %s (%s)\n", report, verdict)
+	if halted {
+		fmt.Printf(" Halted:   by rollback rule, see %s\n", rollback.logFile)
+	}
+	return halted
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================================
+// WORKER STALL MONITOR
+// ============================================================================
+//
+// Every worker owns a heartbeat slot. The ssh output stream beats it on each
+// chunk and moves the "current command" forward as the echo markers arrive.
+// A worker with no heartbeat for -stall-after is reported; with -stall-skip
+// set, its ssh session is killed after the extra grace period so the run can
+// finish and the device is recorded as FAILED.
+
+// workerHeartbeat is one worker's slot in the stall monitor
+type workerHeartbeat struct {
+	mu      sync.Mutex
+	id      int
+	device  string
+	command string
+	last    time.Time
+	warned  bool
+	client  *SSHClient
+}
+
+func (h *workerHeartbeat) begin(device string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.device, h.command, h.last, h.warned, h.client = device, "(connecting)", time.Now(), false, nil
+}
+
+func (h *workerHeartbeat) attach(c *SSHClient) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.client = c
+	h.mu.Unlock()
+	c.progress = h.beat
+}
+
+// beat records activity; an empty command keeps the current one
+func (h *workerHeartbeat) beat(command string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if command != "" {
+		h.command = command
+	}
+	h.last = time.Now()
+	h.warned = false
+}
+
+func (h *workerHeartbeat) idle() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.device, h.command, h.client = "", "", nil
+}
+
+// stallMonitor periodically checks every worker's heartbeat
+type stallMonitor struct {
+	workers []*workerHeartbeat
+	after   time.Duration
+	skip    time.Duration // 0 = report only
+	stop    chan struct{}
+}
+
+// newStallMonitor starts monitoring n workers; returns nil when disabled
+func newStallMonitor(n int, after, skip time.Duration) *stallMonitor {
+	if after <= 0 {
+		return nil
+	}
+	m := &stallMonitor{after: after, skip: skip, stop: make(chan struct{})}
+	for i := 0; i < n; i++ {
+		m.workers = append(m.workers, &workerHeartbeat{id: i + 1})
+	}
+
+	interval := after / 4
+	if interval > 30*time.Second {
+		interval = 30 * time.Second
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.check()
+			}
+		}
+	}()
+	return m
+}
+
+// worker returns the heartbeat slot for worker i (nil-safe when disabled)
+func (m *stallMonitor) worker(i int) *workerHeartbeat {
+	if m == nil {
+		return nil
+	}
+	return m.workers[i]
+}
+
+func (m *stallMonitor) Stop() {
+	if m != nil {
+		close(m.stop)
+	}
+}
+
+func (m *stallMonitor) check() {
+	for _, h := range m.workers {
+		h.mu.Lock()
+		if h.device == "" {
+			h.mu.Unlock()
+			continue
+		}
+		quiet := time.Since(h.last).Round(time.Second)
+		device, command, client := h.device, h.command, h.client
+		warn := quiet >= m.after && !h.warned
+		if warn {
+			h.warned = true
+		}
+		h.mu.Unlock()
+
+		if warn {
+			log.Printf("⚠ STALL: worker %d on %s, command %q, no output for %s", h.id, device, command, quiet)
+		}
+		if m.skip > 0 && quiet >= m.after+m.skip && client != nil {
+			if client.abort(fmt.Sprintf("stalled on %q, skipped after %s without output", command, quiet)) {
+				log.Printf("✗ STALL: skipping %s (worker %d) after %s", device, h.id, quiet)
+			}
+		}
+	}
+}
+
+// heartbeatWriter collects ssh output, beating the worker on every chunk and
+// reporting the command whose ===START_n=== marker was seen last.
+type heartbeatWriter struct {
+	out      strings.Builder
+	commands []string
+	next     int
+	scanned  int
+	beat     func(string)
+	last     atomic.Int64 // UnixNano of the last chunk, read by ExecuteCommands
+	started  atomic.Int32 // commands whose START marker was seen
+	since    atomic.Int64 // UnixNano the last of them started (-cmd-deadline)
+}
+
+func (w *heartbeatWriter) touch() {
+	w.last.Store(time.Now().UnixNano())
+}
+
+// quietFor is how long the session has produced no output
+func (w *heartbeatWriter) quietFor() time.Duration {
+	return time.Since(time.Unix(0, w.last.Load()))
+}
+
+// running is the index of the command whose START marker was seen last and
+// how long ago; -1 before the first
+func (w *heartbeatWriter) running() (int, time.Duration) {
+	since := w.since.Load()
+	if since == 0 {
+		return -1, 0
+	}
+	return int(w.started.Load()) - 1, time.Since(time.Unix(0, since))
+}
+
+func (w *heartbeatWriter) Write(p []byte) (int, error) {
+	w.touch()
+	n, err := w.out.Write(p)
+	current := ""
+	s := w.out.String()
+	for w.next < len(w.commands) {
+		marker := fmt.Sprintf("===START_%d===", w.next)
+		idx := strings.Index(s[w.scanned:], marker)
+		if idx < 0 {
+			break
+		}
+		w.scanned += idx + len(marker)
+		current = w.commands[w.next]
+		w.next++
+		w.started.Store(int32(w.next))
+		w.since.Store(time.Now().UnixNano())
+	}
+	if w.beat != nil {
+		w.beat(current)
+	}
+	return n, err
+}
+
+func (w *heartbeatWriter) String() string {
+	return w.out.String()
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ============================================================================
+// MINIMAL YAML READER
+// ============================================================================
+//
+// The tool builds without third-party modules, so runbooks and other
+// hand-written files are read with this subset of YAML:
+//
+//   key: value              maps (block style)
+//   - item                  lists, of scalars or of maps ("- key: value")
+//   key: [a, b, "c d"]      flow lists of scalars
+//   key: |                  literal block scalars
+//   "quoted" / 'quoted'     quoted scalars; # starts a comment outside quotes
+//
+// Values come back as map[string]interface{}, []interface{} and string.
+// Anchors, tags, multi-document streams and flow maps are not supported.
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// parseYAML reads a document of the supported subset
+func parseYAML(data string) (interface{}, error) {
+	var lines []yamlLine
+	raw := strings.Split(strings.ReplaceAll(data, "\r", ""), "\n")
+	for i := 0; i < len(raw); i++ {
+		l := raw[i]
+		body := strings.TrimLeft(l, " ")
+		if strings.HasPrefix(body, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		text := strings.TrimSpace(stripYAMLComment(body))
+		if text == "" || text == "---" {
+			continue
+		}
+		indent := len(l) - len(body)
+		lines = append(lines, yamlLine{num: i + 1, indent: indent, text: text})
+
+		// A literal block keeps its lines verbatim, comments included
+		if strings.HasSuffix(text, ": |") || text == "- |" || strings.HasSuffix(text, ": |-") {
+			var block []string
+			blockIndent := -1
+			for i+1 < len(raw) {
+				next := raw[i+1]
+				nb := strings.TrimLeft(next, " ")
+				ni := len(next) - len(nb)
+				if strings.TrimSpace(next) != "" && ni <= indent {
+					break
+				}
+				if blockIndent < 0 && strings.TrimSpace(next) != "" {
+					blockIndent = ni
+				}
+				if blockIndent >= 0 && len(next) >= blockIndent {
+					block = append(block, next[blockIndent:])
+				} else {
+					block = append(block, "")
+				}
+				i++
+			}
+			for len(block) > 0 && block[len(block)-1] == "" {
+				block = block[:len(block)-1]
+			}
+			lines[len(lines)-1].text = strings.TrimSuffix(strings.TrimSuffix(text, "-"), "|") + "|" + strings.Join(block, "\n")
+		}
+	}
+	if len(lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	value, next, err := parseYAMLBlock(lines, 0, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected %q", lines[next].num, lines[next].text)
+	}
+	return value, nil
+}
+
+// stripYAMLComment removes a trailing comment outside quotes
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' '):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// parseYAMLBlock parses the list or map starting at lines[i] with indent
+func parseYAMLBlock(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	if strings.HasPrefix(lines[i].text, "- ") || lines[i].text == "-" {
+		return parseYAMLList(lines, i, indent)
+	}
+	return parseYAMLMap(lines, i, indent)
+}
+
+func parseYAMLList(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	var list []interface{}
+	// A list may sit at its parent key's indent, so it ends at the first
+	// line of that indent that is not an item
+	for i < len(lines) && lines[i].indent == indent && (strings.HasPrefix(lines[i].text, "- ") || lines[i].text == "-") {
+		l := lines[i]
+		content := strings.TrimSpace(strings.TrimPrefix(l.text, "-"))
+		switch {
+		case content == "":
+			if i+1 >= len(lines) || lines[i+1].indent <= indent {
+				list = append(list, "")
+				i++
+				continue
+			}
+			v, next, err := parseYAMLBlock(lines, i+1, lines[i+1].indent)
+			if err != nil {
+				return nil, next, err
+			}
+			list = append(list, v)
+			i = next
+		case isYAMLMapEntry(content) || strings.HasPrefix(content, "- "):
+			// "- key: value" opens a map whose keys line up with "key"
+			// (and "- - x" a nested list), so reparse the line from there
+			lines[i] = yamlLine{num: l.num, indent: indent + strings.Index(l.text, content), text: content}
+			v, next, err := parseYAMLBlock(lines, i, lines[i].indent)
+			if err != nil {
+				return nil, next, err
+			}
+			list = append(list, v)
+			i = next
+		case strings.HasPrefix(content, "|"):
+			list = append(list, content[1:])
+			i++
+		default:
+			v, err := yamlScalar(content, l.num)
+			if err != nil {
+				return nil, i, err
+			}
+			list = append(list, v)
+			i++
+		}
+	}
+	return list, i, nil
+}
+
+func parseYAMLMap(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	m := make(map[string]interface{})
+	for i < len(lines) && lines[i].indent == indent {
+		l := lines[i]
+		if !isYAMLMapEntry(l.text) {
+			return nil, i, fmt.Errorf("line %d: expected \"key: value\"", l.num)
+		}
+		key, rest := splitYAMLEntry(l.text)
+		if _, dup := m[key]; dup {
+			return nil, i, fmt.Errorf("line %d: duplicate key %q", l.num, key)
+		}
+		i++
+		switch {
+		case strings.HasPrefix(rest, "|"):
+			m[key] = rest[1:]
+		case rest != "":
+			v, err := yamlScalar(rest, l.num)
+			if err != nil {
+				return nil, i, err
+			}
+			m[key] = v
+		case i < len(lines) && (lines[i].indent > indent ||
+			(lines[i].indent == indent && strings.HasPrefix(lines[i].text, "- "))):
+			v, next, err := parseYAMLBlock(lines, i, lines[i].indent)
+			if err != nil {
+				return nil, next, err
+			}
+			m[key] = v
+			i = next
+		default:
+			m[key] = ""
+		}
+	}
+	if i < len(lines) && lines[i].indent > indent {
+		return nil, i, fmt.Errorf("line %d: unexpected indentation", lines[i].num)
+	}
+	return m, i, nil
+}
+
+// isYAMLMapEntry reports whether text is "key:" or "key: value" (key unquoted)
+func isYAMLMapEntry(text string) bool {
+	if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") || strings.HasPrefix(text, "[") {
+		return false
+	}
+	i := strings.Index(text, ":")
+	return i > 0 && (i == len(text)-1 || text[i+1] == ' ')
+}
+
+func splitYAMLEntry(text string) (string, string) {
+	i := strings.Index(text, ":")
+	return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+}
+
+// yamlScalar unquotes a scalar or splits a flow list
+func yamlScalar(s string, num int) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("line %d: unterminated flow list", num)
+		}
+		var list []interface{}
+		inner := strings.TrimSpace(s[1 : len(s)-1])
+		if inner == "" {
+			return list, nil
+		}
+		for _, item := range splitYAMLFlow(inner) {
+			v, err := yamlScalar(strings.TrimSpace(item), num)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case strings.HasPrefix(s, "\""):
+		if len(s) < 2 || !strings.HasSuffix(s, "\"") {
+			return nil, fmt.Errorf("line %d: unterminated string", num)
+		}
+		r := strings.NewReplacer(`\"`, `"`, `\\`, `\`, `\n`, "\n", `\t`, "\t")
+		return r.Replace(s[1 : len(s)-1]), nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("line %d: unterminated string", num)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	return s, nil
+}
+
+// splitYAMLFlow splits a flow list body on commas outside quotes
+func splitYAMLFlow(s string) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// ----------------------------------------------------------------------------
+// Typed accessors
+// ----------------------------------------------------------------------------
+
+// yamlString returns m[key] as a string ("" when absent)
+func yamlString(m map[string]interface{}, key string) (string, error) {
+	switch v := m[key].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("%s: expected a value, got a list or map", key)
+}
+
+// yamlStrings returns m[key] as a list of strings; a single value is a list of one
+func yamlStrings(m map[string]interface{}, key string) ([]string, error) {
+	switch v := m[key].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		return []string{v}, nil
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: expected a list of values", key)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("%s: expected a list", key)
+}
+
+// yamlBool reads true/false/yes/no; def when absent
+func yamlBool(m map[string]interface{}, key string, def bool) (bool, error) {
+	s, err := yamlString(m, key)
+	if err != nil || s == "" {
+		return def, err
+	}
+	switch strings.ToLower(s) {
+	case "true", "yes", "on":
+		return true, nil
+	case "false", "no", "off":
+		return false, nil
+	}
+	return def, fmt.Errorf("%s: expected true or false, got %q", key, s)
+}